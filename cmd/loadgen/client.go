@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client of the harvester web server's API, scheduling jobs and checking on
+// their status.
+type harvesterClient struct {
+	// URL of the web server's API, including its HTTP root path.
+	baseURL string
+
+	// If scheduled jobs force crawling previously crawled URLs.
+	forceCrawl bool
+
+	client *http.Client
+}
+
+// Error response of the web server's API.
+type apiError struct {
+	Code string `json:"code"`
+	Msg  string `json:"message"`
+}
+
+// Schedules a job crawling the URLs. Returns the job's id.
+func (c *harvesterClient) schedule(urls []string) (common.JobId, error) {
+	u := c.baseURL + "/"
+	if c.forceCrawl {
+		u += "?forceCrawl"
+	}
+
+	resp, err := c.client.Post(u, "text/plain", strings.NewReader(strings.Join(urls, "\n")))
+	if err != nil {
+		return common.InvalidId, err
+	}
+	defer resp.Body.Close()
+
+	msg := struct {
+		JobId common.JobId `json:"jobId"`
+	}{}
+	if err := decodeResponse(resp, &msg); err != nil {
+		return common.InvalidId, fmt.Errorf("Failed to schedule job, %v", err)
+	}
+	return msg.JobId, nil
+}
+
+// Status of a scheduled job.
+type jobStatus struct {
+	// Number of the job's URLs completely crawled, and pending completion.
+	Completed int `json:"completed"`
+	Pending   int `json:"pending"`
+}
+
+// Returns the status of the job.
+func (c *harvesterClient) status(id common.JobId) (*jobStatus, error) {
+	resp, err := c.client.Get(fmt.Sprintf("%s/status/%d", c.baseURL, id))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	status := &jobStatus{}
+	if err := decodeResponse(resp, status); err != nil {
+		return nil, fmt.Errorf("Failed to get job %d status, %v", id, err)
+	}
+	return status, nil
+}
+
+// Decodes the API's JSON response into v. An error is returned with the
+// API's error message if the response is not successful.
+func decodeResponse(resp *http.Response, v interface{}) error {
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := apiError{}
+		if err := json.Unmarshal(body.Bytes(), &apiErr); err != nil || apiErr.Code == "" {
+			return fmt.Errorf("%s", resp.Status)
+		}
+		return fmt.Errorf("%s: %s, %s", resp.Status, apiErr.Code, apiErr.Msg)
+	}
+	return json.Unmarshal(body.Bytes(), v)
+}
+
+// Returns the API base URL without a trailing slash. Returns an error if
+// the URL isn't absolute.
+func apiBaseURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	} else if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("Invalid harvester URL %s, must be absolute", raw)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Loadgen load tests a running harvester end to end. It serves a local target
+// site of generated HTML pages, schedules jobs crawling the site with the
+// harvester web server, and waits for them to complete. Once all jobs complete,
+// or time out, the crawl throughput in URLs per second and latency percentiles
+// are reported.
+//
+// The target site's pages each link to the number of pages set by -fanout, are
+// padded to the -size in bytes, and are responded to after the -latency plus up
+// to the -jitter. Each job crawls its own copy of the site, so no job's URLs are
+// already crawled. How many of a site's pages are crawled depends on the
+// workers' maxLevel configuration.
+//
+// The URL latency is the time from a job being scheduled until each of its
+// URLs is requested from the target site. The job latency is the time from a
+// job being scheduled until its status is complete.
+//
+// e.g:
+// loadgen -harvester http://localhost:8080 -siteURL http://localhost:9090 -jobs 20 -concurrency 4
+//
+func main() {
+	harvesterURL := flag.String("harvester", "http://localhost:8080", "URL of the harvester web server, including its HTTP root path.")
+	listenAddr := flag.String("listen", ":9090", "Address the target site listens on.")
+	siteURL := flag.String("siteURL", "http://localhost:9090", "URL the harvester workers request the target site at.")
+	jobs := flag.Int("jobs", 10, "Number of jobs to schedule.")
+	concurrency := flag.Int("concurrency", 2, "Number of jobs crawling at the same time.")
+	pages := flag.Int("pages", 100, "Number of pages of each job's site.")
+	fanOut := flag.Int("fanout", 5, "Number of links on each page.")
+	size := flag.Int("size", 16*1024, "Approximate size of each page in bytes.")
+	latency := flag.Duration("latency", 50*time.Millisecond, "Delay before the target site responds.")
+	jitter := flag.Duration("jitter", 25*time.Millisecond, "Random jitter added to the target site's latency.")
+	poll := flag.Duration("poll", 500*time.Millisecond, "Interval job status is checked at.")
+	timeout := flag.Duration("timeout", 5*time.Minute, "Longest a job is waited for to complete.")
+	forceCrawl := flag.Bool("forceCrawl", true, "Schedule jobs with forceCrawl.")
+
+	flag.Parse()
+	if *jobs < 1 || *concurrency < 1 || *pages < 1 || *fanOut < 0 || *size < 0 {
+		log.Fatalln("Invalid load test, jobs, concurrency, and pages must be positive")
+	}
+
+	baseURL, err := apiBaseURL(*harvesterURL)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	client := &harvesterClient{baseURL: baseURL, forceCrawl: *forceCrawl, client: &http.Client{Timeout: 30 * time.Second}}
+
+	s := newSite(siteConfig{Pages: *pages, FanOut: *fanOut, PageSize: *size, Latency: *latency, Jitter: *jitter})
+	l, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		log.Fatalln("Target site: failed to listen:", err)
+	}
+	go http.Serve(l, s)
+	log.Println("Target site listening on", l.Addr().String(), "requested at", *siteURL)
+
+	// Each run crawls new URLs, so URLs crawled by previous runs aren't reused.
+	run := strconv.FormatInt(time.Now().Unix(), 36)
+
+	started := time.Now()
+	results := make([]jobResult, *jobs)
+	sem := make(chan struct{}, *concurrency)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			prefix := fmt.Sprintf("/%s/%d", run, i)
+			results[i] = runJob(client, *siteURL+firstPagePath(prefix), *poll, *timeout)
+			results[i].prefix = prefix
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Now().Sub(started)
+
+	report(s, results, elapsed)
+}
+
+// Result of a load test job.
+type jobResult struct {
+	id     common.JobId
+	prefix string
+
+	scheduledAt time.Time
+	completedAt time.Time
+
+	// Error scheduling, or checking the status of the job. Set if the job
+	// timed out.
+	err error
+}
+
+// Schedules a job crawling the URL, and waits for it to complete.
+func runJob(client *harvesterClient, u string, poll, timeout time.Duration) jobResult {
+	res := jobResult{scheduledAt: time.Now()}
+	res.id, res.err = client.schedule([]string{u})
+	if res.err != nil {
+		log.Println("Job failed to schedule", u, res.err)
+		return res
+	}
+	log.Println("Job scheduled", res.id, u)
+
+	for time.Now().Sub(res.scheduledAt) < timeout {
+		<-time.After(poll)
+
+		status, err := client.status(res.id)
+		if err != nil {
+			res.err = err
+			log.Println("Job status failed", res.id, err)
+			return res
+		}
+		if status.Pending == 0 && status.Completed > 0 {
+			res.completedAt = time.Now()
+			log.Println("Job complete", res.id, "duration", res.completedAt.Sub(res.scheduledAt).String())
+			return res
+		}
+	}
+	res.err = fmt.Errorf("Job %d timed out after %s", res.id, timeout)
+	log.Println(res.err)
+	return res
+}
+
+// Writes the load test's throughput, and latency percentiles to stdout.
+func report(s *site, results []jobResult, elapsed time.Duration) {
+	completed, failed := 0, 0
+	urlLatencies, jobLatencies := []time.Duration{}, []time.Duration{}
+	for _, res := range results {
+		if res.err != nil {
+			failed++
+		} else {
+			completed++
+			jobLatencies = append(jobLatencies, res.completedAt.Sub(res.scheduledAt))
+		}
+		for _, requestedAt := range s.requestedUnder(res.prefix) {
+			urlLatencies = append(urlLatencies, requestedAt.Sub(res.scheduledAt))
+		}
+	}
+	requests, pages := s.counts()
+
+	fmt.Printf("jobs:        %d completed, %d failed or timed out, in %v\n", completed, failed, elapsed)
+	fmt.Printf("urls:        %d crawled, %d requests, %.2f URLs/sec\n", pages, requests, float64(pages)/elapsed.Seconds())
+	fmt.Printf("url latency: %v\n", newLatencies(urlLatencies))
+	fmt.Printf("job latency: %v\n", newLatencies(jobLatencies))
+}
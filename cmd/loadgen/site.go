@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shape of the generated target site, and how slowly it responds.
+type siteConfig struct {
+	// Number of pages of each job's site.
+	Pages int
+
+	// Number of links on each page.
+	FanOut int
+
+	// Approximate size of each page in bytes.
+	PageSize int
+
+	// Delay before each page is responded to, and the random jitter added
+	// to it.
+	Latency time.Duration
+	Jitter  time.Duration
+}
+
+// Local target site harvester crawls. Each job crawls its own copy of the site
+// under the job's path prefix, e.g: /<run>/<job>/page/<n>, so no job's URLs
+// are already crawled. Records the first time each page is requested.
+type site struct {
+	cfg siteConfig
+
+	mu        sync.Mutex
+	firstSeen map[string]time.Time
+	requests  int
+}
+
+// Creates a new target site with the configuration.
+func newSite(cfg siteConfig) *site {
+	return &site{cfg: cfg, firstSeen: map[string]time.Time{}}
+}
+
+func (s *site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/robots.txt" {
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(w, "User-agent: *\nAllow: /")
+		return
+	}
+
+	prefix, n, ok := parsePagePath(r.URL.Path)
+	if !ok || n >= s.cfg.Pages {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	if _, ok := s.firstSeen[r.URL.Path]; !ok {
+		s.firstSeen[r.URL.Path] = time.Now()
+	}
+	s.mu.Unlock()
+
+	delay := s.cfg.Latency
+	if s.cfg.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(s.cfg.Jitter)))
+	}
+	<-time.After(delay)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(s.page(prefix, n))
+}
+
+// Returns the HTML of the nth page of the site under the prefix. Pages link to
+// the next pages in breadth first order, so every page is reachable from the
+// first, and are padded with paragraphs to the page size.
+func (s *site) page(prefix string, n int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<html><head><title>Page %d</title></head><body><h1>Page %d</h1>\n", n, n)
+	for i := 0; i < s.cfg.FanOut; i++ {
+		fmt.Fprintf(&buf, "<a href=\"%s/page/%d\">Link %d</a>\n", prefix, (n*s.cfg.FanOut+i+1)%s.cfg.Pages, i)
+	}
+	for buf.Len() < s.cfg.PageSize {
+		buf.WriteString("<p>Harvester load generator filler text for the page.</p>\n")
+	}
+	buf.WriteString("</body></html>\n")
+	return buf.Bytes()
+}
+
+// Returns the path of the site's first page under the prefix.
+func firstPagePath(prefix string) string {
+	return prefix + "/page/0"
+}
+
+// Splits a page path into its prefix, and page number. False is returned if
+// the path isn't a page.
+func parsePagePath(p string) (string, int, bool) {
+	i := strings.LastIndex(p, "/page/")
+	if i < 0 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(p[i+len("/page/"):])
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	return p[:i], n, true
+}
+
+// Returns the first time each page under the prefix was requested.
+func (s *site) requestedUnder(prefix string) []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := []time.Time{}
+	for p, t := range s.firstSeen {
+		if pagePrefix, _, ok := parsePagePath(p); ok && pagePrefix == prefix {
+			seen = append(seen, t)
+		}
+	}
+	return seen
+}
+
+// Returns the number of page requests, and distinct pages requested.
+func (s *site) counts() (requests, pages int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, len(s.firstSeen)
+}
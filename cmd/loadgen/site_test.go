@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSitePage(t *testing.T) {
+	s := newSite(siteConfig{Pages: 10, FanOut: 3, PageSize: 1024})
+
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/run/1/page/3")
+	require.NoError(t, err, "Expect page requested")
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Expect page found")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"), "Expect HTML")
+	assert.True(t, len(body) >= 1024, "Expect page padded to size")
+	for _, link := range []string{`href="/run/1/page/0"`, `href="/run/1/page/1"`, `href="/run/1/page/2"`} {
+		assert.Contains(t, string(body), link, "Expect links to next pages wrapped")
+	}
+
+	resp, err = http.Get(server.URL + "/run/1/page/10")
+	require.NoError(t, err, "Expect page requested")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Expect page past site not found")
+
+	http.Get(server.URL + "/run/1/page/3")
+	http.Get(server.URL + "/run/2/page/0")
+	requests, pages := s.counts()
+	assert.Equal(t, 3, requests, "Expect page requests counted")
+	assert.Equal(t, 2, pages, "Expect distinct pages counted")
+	assert.Len(t, s.requestedUnder("/run/1"), 1, "Expect pages of prefix")
+}
+
+func TestParsePagePath(t *testing.T) {
+	prefix, n, ok := parsePagePath("/abc/2/page/15")
+	assert.True(t, ok, "Expect page path")
+	assert.Equal(t, "/abc/2", prefix, "Expect prefix")
+	assert.Equal(t, 15, n, "Expect page number")
+
+	for _, p := range []string{"/robots.txt", "/abc/page/x", "/abc/page/-1"} {
+		_, _, ok := parsePagePath(p)
+		assert.False(t, ok, "Expect %s not page path", p)
+	}
+	assert.True(t, strings.HasSuffix(firstPagePath("/abc"), "/page/0"), "Expect first page")
+}
+
+func TestLatenciesPercentile(t *testing.T) {
+	l := newLatencies([]time.Duration{5, 1, 4, 2, 3, 6, 7, 8, 9, 10})
+	assert.Equal(t, time.Duration(5), l.percentile(50), "Expect median")
+	assert.Equal(t, time.Duration(9), l.percentile(90), "Expect p90")
+	assert.Equal(t, time.Duration(10), l.percentile(99), "Expect p99")
+	assert.Equal(t, time.Duration(10), l.percentile(100), "Expect max")
+	assert.Equal(t, time.Duration(0), newLatencies(nil).percentile(50), "Expect zero without latencies")
+}
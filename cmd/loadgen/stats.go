@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Percentiles of the latencies reported by the load test.
+var reportPercentiles = []float64{50, 90, 99}
+
+// Sorted set of latencies.
+type latencies []time.Duration
+
+// Returns the latencies sorted.
+func newLatencies(durs []time.Duration) latencies {
+	l := make(latencies, len(durs))
+	copy(l, durs)
+	sort.Slice(l, func(i, j int) bool { return l[i] < l[j] })
+	return l
+}
+
+// Returns the pth percentile latency, by nearest rank. Zero if there are
+// no latencies.
+func (l latencies) percentile(p float64) time.Duration {
+	if len(l) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(l))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(l) {
+		rank = len(l) - 1
+	}
+	return l[rank]
+}
+
+// satisfies the stringer interface, e.g: "p50 10ms, p90 25ms, p99 40ms, max 42ms"
+func (l latencies) String() string {
+	s := ""
+	for _, p := range reportPercentiles {
+		s += fmt.Sprintf("p%g %v, ", p, l.percentile(p))
+	}
+	return s + fmt.Sprintf("max %v", l.percentile(100))
+}
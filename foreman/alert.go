@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"time"
+)
+
+// Metrics of a job's crawl alert rules can be evaluated on.
+const (
+	// Percent of the job's requests within the window which were errors.
+	AlertErrorRate = "errorRate"
+
+	// Job has made no progress, crawled no URLs, for the window.
+	AlertStalled = "stalled"
+
+	// Number of the job's requests within the window which were not found.
+	AlertNotFound = "notFound"
+)
+
+// Interval between evaluations of the alert rules if not configured.
+const defaultAlertInterval = time.Minute
+
+// Window alert rules are evaluated over if not configured.
+const defaultAlertWindow = 10 * time.Minute
+
+// Alert rules evaluated against the crawl of each pending job, and where
+// their alerts are sent.
+type AlertConfig struct {
+	// Interval between evaluations of the rules, e.g: 1m. Defaults to 1m.
+	// See http://golang.org/pkg/time/#ParseDuration for formatting
+	IntervalStr string `json:"interval"`
+
+	// The IntervalStr will be parsed, and its value placed into the Interval field.
+	Interval time.Duration `json:"-"`
+
+	// Destinations alerts are sent to.
+	Notify NotifyConfig `json:"notify"`
+
+	// Rules evaluated against each job. No alerts are evaluated if empty.
+	Rules []AlertRule `json:"rules"`
+}
+
+// Parses the interval and windows, setting defaults, and validates the rules.
+func (c *AlertConfig) setDefaults() error {
+	if c.IntervalStr == "" {
+		c.Interval = defaultAlertInterval
+	} else {
+		var err error
+		if c.Interval, err = time.ParseDuration(c.IntervalStr); err != nil {
+			return fmt.Errorf("%s, %s", err.Error(), c.IntervalStr)
+		} else if c.Interval <= 0 {
+			return fmt.Errorf("Invalid alert interval %s, must be positive", c.IntervalStr)
+		}
+	}
+
+	if len(c.Rules) > 0 && c.Notify.Webhook == "" && c.Notify.Slack == "" {
+		return fmt.Errorf("Alert rules configured without a webhook or Slack to notify")
+	}
+	for i := range c.Rules {
+		if err := c.Rules[i].setDefaults(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rule alerting when a job's crawl metric exceeds the threshold within the
+// window.
+type AlertRule struct {
+	// Name of the rule, included in its alerts.
+	Name string `json:"name"`
+
+	// Metric the rule is evaluated on. Either "errorRate", "stalled", or "notFound".
+	Metric string `json:"metric"`
+
+	// Threshold the metric must exceed to alert. Percent of requests for
+	// errorRate, and number of requests for notFound. Unused by stalled.
+	Threshold float64 `json:"threshold"`
+
+	// Window of the job's most recent requests the metric is evaluated over,
+	// and for stalled the time without progress to alert after, e.g: 10m.
+	// Defaults to 10m.
+	// See http://golang.org/pkg/time/#ParseDuration for formatting
+	WindowStr string `json:"window"`
+
+	// The WindowStr will be parsed, and its value placed into the Window field.
+	Window time.Duration `json:"-"`
+}
+
+// Parses the window, setting the default, and validates the rule.
+func (r *AlertRule) setDefaults() error {
+	switch r.Metric {
+	case AlertErrorRate, AlertStalled, AlertNotFound:
+	default:
+		return fmt.Errorf("Invalid alert rule %s metric %s", r.Name, r.Metric)
+	}
+	if r.Name == "" {
+		r.Name = r.Metric
+	}
+	if r.Threshold < 0 {
+		return fmt.Errorf("Invalid alert rule %s threshold %v, must not be negative", r.Name, r.Threshold)
+	}
+
+	if r.WindowStr == "" {
+		r.Window = defaultAlertWindow
+		return nil
+	}
+	var err error
+	if r.Window, err = time.ParseDuration(r.WindowStr); err != nil {
+		return fmt.Errorf("%s, %s", err.Error(), r.WindowStr)
+	} else if r.Window <= 0 {
+		return fmt.Errorf("Invalid alert rule %s window %s, must be positive", r.Name, r.WindowStr)
+	}
+	return nil
+}
+
+// Returns true, with a description of the metric, if the job's crawl stats
+// exceed the rule's threshold at the time. The stats are expected to be of the
+// rule's window.
+func (r AlertRule) evaluate(stats *common.JobCrawlStats, now time.Time) (bool, string) {
+	switch r.Metric {
+	case AlertErrorRate:
+		if stats.Requests == 0 {
+			return false, ""
+		}
+		rate := 100 * float64(stats.Errors) / float64(stats.Requests)
+		return rate > r.Threshold, fmt.Sprintf("error rate %.1f%% of %d requests in %s", rate, stats.Requests, r.Window)
+	case AlertStalled:
+		progress := stats.LastCrawled
+		if progress.IsZero() {
+			progress = stats.StartedOn
+		}
+		idle := now.Sub(progress)
+		return idle > r.Window, fmt.Sprintf("no progress for %s", idle.Truncate(time.Second))
+	case AlertNotFound:
+		return float64(stats.NotFound) > r.Threshold, fmt.Sprintf("%d not found requests in %s", stats.NotFound, r.Window)
+	}
+	return false, ""
+}
+
+// Alert of a job's rule, sent when the rule fires, and when it resolves.
+type alert struct {
+	JobId    common.JobId `json:"jobId"`
+	Rule     string       `json:"rule"`
+	Metric   string       `json:"metric"`
+	Resolved bool         `json:"resolved"`
+}
+
+// Key of a job's rule which has fired.
+type alertKey struct {
+	jobId common.JobId
+	rule  int
+}
+
+// Jobs the alert rules are evaluated against. Implemented by the storage
+// job client.
+type alertJobs interface {
+	PendingJobs() ([]common.JobId, error)
+	CrawlWindow(id common.JobId) (*common.CrawlWindow, error)
+	CrawlStats(id common.JobId, since time.Time) (*common.JobCrawlStats, error)
+}
+
+// Evaluates the alert rules against the crawl of each pending job, notifying
+// when a rule fires, and when it resolves.
+type alertWatcher struct {
+	jobs     alertJobs
+	cfg      AlertConfig
+	notifier *notifier
+
+	// Rules which have fired and not yet resolved. Only held in memory, so
+	// alerts should only be watched by a single foreman.
+	firing map[alertKey]bool
+}
+
+// Periodically evaluates the alert rules against the pending jobs. Blocks
+// forever, and is expected to be run in its own go routine.
+func watchAlerts(sc *storage.Client, cfg AlertConfig) {
+	w := &alertWatcher{
+		jobs:     sc.JobClient(),
+		cfg:      cfg,
+		notifier: newNotifier(cfg.Notify),
+		firing:   map[alertKey]bool{},
+	}
+	for {
+		if err := w.evaluate(time.Now()); err != nil {
+			log.Println("Foreman: Failed to evaluate alert rules", err)
+		}
+
+		time.Sleep(cfg.Interval)
+	}
+}
+
+// Evaluates the rules against each pending job at the time. Jobs outside of
+// their crawl window, or waiting for a running job slot, are not expected to
+// make progress, so are skipped. A job which fails to be evaluated is logged,
+// and doesn't prevent the other jobs being evaluated.
+func (w *alertWatcher) evaluate(now time.Time) error {
+	ids, err := w.jobs.PendingJobs()
+	if err != nil {
+		return err
+	}
+
+	pending := map[common.JobId]bool{}
+	for _, id := range ids {
+		pending[id] = true
+
+		window, err := w.jobs.CrawlWindow(id)
+		if err != nil {
+			log.Println("Foreman: Failed to get crawl window of job, skipping alerts", id, err)
+			continue
+		}
+		if window != nil && !window.Contains(now) {
+			continue
+		}
+
+		for i, rule := range w.cfg.Rules {
+			stats, err := w.jobs.CrawlStats(id, now.Add(-rule.Window))
+			if err != nil {
+				log.Println("Foreman: Failed to get crawl stats of job, skipping alert", id, rule.Name, err)
+				continue
+			} else if stats == nil || stats.StartedOn.IsZero() {
+				continue
+			}
+
+			fired, desc := rule.evaluate(stats, now)
+			key := alertKey{jobId: id, rule: i}
+			if fired == w.firing[key] {
+				continue
+			}
+			if fired {
+				w.firing[key] = true
+			} else {
+				delete(w.firing, key)
+			}
+			w.notify(id, rule, !fired, desc)
+		}
+	}
+
+	// Jobs which are no longer pending have completed or been paused, so
+	// their alerts are dropped without notifying.
+	for key := range w.firing {
+		if !pending[key.jobId] {
+			delete(w.firing, key)
+		}
+	}
+	return nil
+}
+
+// Notifies the job's rule fired, or resolved.
+func (w *alertWatcher) notify(id common.JobId, rule AlertRule, resolved bool, desc string) {
+	state := "firing"
+	if resolved {
+		state = "resolved"
+	}
+	msg := fmt.Sprintf("Harvester alert %s %s for job %d", rule.Name, state, id)
+	if !resolved {
+		msg += ": " + desc
+	}
+	log.Println("Foreman:", msg)
+
+	w.notifier.notify(notification{
+		Kind:    "alert",
+		Message: msg,
+		Details: alert{JobId: id, Rule: rule.Name, Metric: rule.Metric, Resolved: resolved},
+	})
+}
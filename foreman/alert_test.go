@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Jobs held in memory, failing the jobs with errors.
+type memAlertJobs struct {
+	pending []common.JobId
+	windows map[common.JobId]*common.CrawlWindow
+	stats   map[common.JobId]*common.JobCrawlStats
+	errs    map[common.JobId]error
+}
+
+func (j *memAlertJobs) PendingJobs() ([]common.JobId, error) {
+	return j.pending, nil
+}
+
+func (j *memAlertJobs) CrawlWindow(id common.JobId) (*common.CrawlWindow, error) {
+	return j.windows[id], nil
+}
+
+func (j *memAlertJobs) CrawlStats(id common.JobId, since time.Time) (*common.JobCrawlStats, error) {
+	if err := j.errs[id]; err != nil {
+		return nil, err
+	}
+	return j.stats[id], nil
+}
+
+func TestAlertRuleEvaluate(t *testing.T) {
+	now := time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		Rule  AlertRule
+		Stats common.JobCrawlStats
+		Fired bool
+	}{
+		{AlertRule{Metric: AlertErrorRate, Threshold: 10}, common.JobCrawlStats{Requests: 10, Errors: 2}, true},
+		{AlertRule{Metric: AlertErrorRate, Threshold: 20}, common.JobCrawlStats{Requests: 10, Errors: 2}, false},
+		{AlertRule{Metric: AlertErrorRate, Threshold: 0}, common.JobCrawlStats{}, false},
+		{AlertRule{Metric: AlertNotFound, Threshold: 2}, common.JobCrawlStats{NotFound: 3}, true},
+		{AlertRule{Metric: AlertNotFound, Threshold: 3}, common.JobCrawlStats{NotFound: 3}, false},
+		{AlertRule{Metric: AlertStalled, Window: time.Hour}, common.JobCrawlStats{LastCrawled: now.Add(-2 * time.Hour)}, true},
+		{AlertRule{Metric: AlertStalled, Window: time.Hour}, common.JobCrawlStats{LastCrawled: now.Add(-time.Minute)}, false},
+		// Jobs which haven't crawled anything are stalled since they started,
+		// not since they were created.
+		{AlertRule{Metric: AlertStalled, Window: time.Hour}, common.JobCrawlStats{CreatedOn: now.Add(-3 * time.Hour), StartedOn: now.Add(-2 * time.Hour)}, true},
+		{AlertRule{Metric: AlertStalled, Window: time.Hour}, common.JobCrawlStats{CreatedOn: now.Add(-3 * time.Hour), StartedOn: now.Add(-time.Minute)}, false},
+	}
+
+	for i, c := range cases {
+		fired, desc := c.Rule.evaluate(&c.Stats, now)
+		assert.Equal(t, c.Fired, fired, "case %d, %s", i, desc)
+	}
+}
+
+func TestAlertRuleSetDefaults(t *testing.T) {
+	r := AlertRule{Metric: AlertStalled}
+	require.NoError(t, r.setDefaults())
+	assert.Equal(t, AlertStalled, r.Name, "Expect name defaulted to metric")
+	assert.Equal(t, defaultAlertWindow, r.Window)
+
+	assert.Error(t, (&AlertRule{Metric: "unknown"}).setDefaults(), "Expect unknown metric rejected")
+	assert.Error(t, (&AlertRule{Metric: AlertNotFound, Threshold: -1}).setDefaults(), "Expect negative threshold rejected")
+	assert.Error(t, (&AlertRule{Metric: AlertNotFound, WindowStr: "-1m"}).setDefaults(), "Expect negative window rejected")
+}
+
+func TestAlertWatcherEvaluate(t *testing.T) {
+	alerts := []alert{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg struct {
+			Details alert `json:"details"`
+		}
+		json.NewDecoder(r.Body).Decode(&msg)
+		alerts = append(alerts, msg.Details)
+	}))
+	defer server.Close()
+
+	now := time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+	started := now.Add(-time.Hour)
+	closed, err := common.ParseCrawlWindow("00:00-01:00", "UTC")
+	require.NoError(t, err)
+	jobs := &memAlertJobs{
+		pending: []common.JobId{1, 2, 3, 4},
+		windows: map[common.JobId]*common.CrawlWindow{3: closed},
+		stats: map[common.JobId]*common.JobCrawlStats{
+			// Job 1 fails to be evaluated, and job 2 is waiting for a slot.
+			2: {JobId: 2, Requests: 10, Errors: 10},
+			3: {JobId: 3, StartedOn: started, Requests: 10, Errors: 10},
+			4: {JobId: 4, StartedOn: started, Requests: 10, Errors: 5},
+		},
+		errs: map[common.JobId]error{1: errors.New("stats failed")},
+	}
+	w := &alertWatcher{
+		jobs:     jobs,
+		cfg:      AlertConfig{Rules: []AlertRule{{Name: "errors", Metric: AlertErrorRate, Threshold: 20}}},
+		notifier: newNotifier(NotifyConfig{Webhook: server.URL}),
+		firing:   map[alertKey]bool{},
+	}
+
+	require.NoError(t, w.evaluate(now), "Expect job's failure not to fail evaluation")
+	assert.Equal(t, []alert{{JobId: 4, Rule: "errors", Metric: AlertErrorRate}}, alerts, "Expect only running job in its window alerted")
+
+	// Firing rules are not notified again until resolved.
+	alerts = nil
+	require.NoError(t, w.evaluate(now))
+	assert.Empty(t, alerts, "Expect firing rule not notified again")
+
+	jobs.stats[4] = &common.JobCrawlStats{JobId: 4, StartedOn: started, Requests: 10, Errors: 1}
+	require.NoError(t, w.evaluate(now))
+	assert.Equal(t, []alert{{JobId: 4, Rule: "errors", Metric: AlertErrorRate, Resolved: true}}, alerts, "Expect resolved notified")
+
+	// Alerts of jobs no longer pending are dropped without notifying.
+	alerts = nil
+	jobs.stats[4] = &common.JobCrawlStats{JobId: 4, StartedOn: started, Requests: 10, Errors: 10}
+	require.NoError(t, w.evaluate(now))
+	require.Len(t, alerts, 1, "Expect fired again")
+	jobs.pending = []common.JobId{1, 2, 3}
+	require.NoError(t, w.evaluate(now))
+	assert.Len(t, alerts, 1, "Expect no resolved notification")
+	assert.Empty(t, w.firing, "Expect alert dropped")
+}
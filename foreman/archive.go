@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"time"
+)
+
+// Interval between checks for job results which have passed the retention age.
+const archiveInterval = time.Hour
+
+// Retention of the results of a tenant's, or tag's jobs, overriding the
+// foreman's resultRetention, e.g: for teams whose legal requirements differ.
+type RetentionRule struct {
+	// Tag the jobs are tagged with. Any jobs if not set.
+	Tag string `json:"tag"`
+
+	// Id of the API key, the tenant, the jobs were scheduled with. Any
+	// jobs if not set.
+	APIKeyId int64 `json:"apiKeyId"`
+
+	// Age after a matching job completes that its bodies are tiered into
+	// the cold store. e.g: 2160h for 90 days.
+	// See http://golang.org/pkg/time/#ParseDuration for formatting
+	RetentionStr string `json:"retention"`
+
+	// The RetentionStr will be parsed, and its value placed into the Retention field.
+	Retention time.Duration `json:"-"`
+}
+
+// Parses the retention, and validates the rule matches jobs by a tag, or
+// API key.
+func (r *RetentionRule) setDefaults() error {
+	if r.Tag == "" && r.APIKeyId == 0 {
+		return fmt.Errorf("Invalid result retention rule, requires a tag, or apiKeyId")
+	}
+	if r.Tag != "" {
+		tag, err := common.ParseJobTag(r.Tag)
+		if err != nil {
+			return err
+		}
+		r.Tag = tag
+	}
+
+	var err error
+	if r.Retention, err = time.ParseDuration(r.RetentionStr); err != nil {
+		return fmt.Errorf("%s, %s", err.Error(), r.RetentionStr)
+	} else if r.Retention <= 0 {
+		return fmt.Errorf("Invalid result retention %s, must be positive", r.RetentionStr)
+	}
+	return nil
+}
+
+// Periodically archives jobs which completed longer ago than the retention
+// age, tiering their bodies into the cold store. Jobs matching a rule are archived by the
+// first rule they match instead. Jobs matching no rule are not archived if
+// the retention is zero. Blocks forever, and is expected to be run in its own
+// go routine.
+func archiveResults(sc *storage.Client, retention time.Duration, rules []RetentionRule) {
+	for {
+		now := time.Now().UTC()
+		var completedBefore time.Time
+		if retention > 0 {
+			completedBefore = now.Add(-retention)
+		}
+		retentions := make([]storage.ResultRetention, 0, len(rules))
+		for _, r := range rules {
+			retentions = append(retentions, storage.ResultRetention{
+				Tag:             r.Tag,
+				APIKeyId:        r.APIKeyId,
+				CompletedBefore: now.Add(-r.Retention),
+			})
+		}
+
+		ids, err := sc.JobClient().ArchiveResults(completedBefore, retentions)
+		if err != nil {
+			log.Println("Foreman: Failed to archive jobs", err)
+		}
+		if len(ids) > 0 {
+			log.Println("Foreman: Archived jobs", ids)
+		}
+
+		time.Sleep(archiveInterval)
+	}
+}
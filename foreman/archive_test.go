@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRetentionRuleSetDefaults(t *testing.T) {
+	cases := []struct {
+		Rule      RetentionRule
+		Err       bool
+		Tag       string
+		Retention time.Duration
+	}{
+		{Rule: RetentionRule{Tag: "Audit", RetentionStr: "2160h"}, Tag: "audit", Retention: 2160 * time.Hour},
+		{Rule: RetentionRule{APIKeyId: 7, RetentionStr: "24h"}, Retention: 24 * time.Hour},
+		{Rule: RetentionRule{Tag: "audit", APIKeyId: 7, RetentionStr: "1h"}, Tag: "audit", Retention: time.Hour},
+		{Rule: RetentionRule{RetentionStr: "24h"}, Err: true},
+		{Rule: RetentionRule{Tag: "not a tag!", RetentionStr: "24h"}, Err: true},
+		{Rule: RetentionRule{Tag: "audit"}, Err: true},
+		{Rule: RetentionRule{Tag: "audit", RetentionStr: "soon"}, Err: true},
+		{Rule: RetentionRule{Tag: "audit", RetentionStr: "0s"}, Err: true},
+		{Rule: RetentionRule{Tag: "audit", RetentionStr: "-1h"}, Err: true},
+	}
+
+	for i, c := range cases {
+		err := c.Rule.setDefaults()
+		if c.Err {
+			assert.Error(t, err, "case %d, Expect invalid rule", i)
+			continue
+		}
+		if assert.NoError(t, err, "case %d, Expect valid rule", i) {
+			assert.Equal(t, c.Tag, c.Rule.Tag, "case %d, Expect tag", i)
+			assert.Equal(t, c.Retention, c.Rule.Retention, "case %d, Expect retention", i)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"time"
+)
+
+// Interval between checks for parked jobs whose crawl window has opened.
+const unparkInterval = time.Minute
+
+// Periodically re-queues the parked URLs of jobs whose crawl window has opened,
+// and which are not preempted by an urgent job. Jobs are also unparked once no
+// urgent job is active. Blocks forever, and is expected to be run in its own go
+// routine.
+func unparkJobs(sc *storage.Client, urlQueuePub queue.Publisher, preemption *preemption) {
+	for {
+		if err := unparkOpenJobs(sc, urlQueuePub, preemption, time.Now()); err != nil {
+			log.Println("Foreman: Failed to unpark jobs", err)
+		}
+
+		select {
+		case <-time.After(unparkInterval):
+		case <-preemption.ended:
+		}
+	}
+}
+
+// Re-queues the parked URLs of jobs whose crawl window is open at the time,
+// and which are not preempted by an urgent job.
+func unparkOpenJobs(sc *storage.Client, urlQueuePub queue.Publisher, preemption *preemption, now time.Time) error {
+	ids, err := sc.JobClient().ParkedJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if preemption.preempted(id, now) {
+			continue
+		}
+
+		window, err := sc.JobClient().CrawlWindow(id)
+		if err != nil {
+			return err
+		}
+		if window != nil && !window.Contains(now) {
+			continue
+		}
+
+		items, err := sc.URLClient().UnparkPending(id)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			urlQueuePub.Send(item)
+		}
+		log.Println("Foreman: Unparked job", id, "queued", len(items))
+	}
+	return nil
+}
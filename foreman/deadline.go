@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"time"
+)
+
+// Interval jobs are checked for deadlines which have passed.
+const deadlineInterval = 10 * time.Second
+
+// Periodically finalizes the jobs whose deadline has passed, including jobs
+// whose items are parked, or waiting, and so aren't received by the foreman.
+// Blocks forever, and is expected to be run in its own go routine.
+func (f *Foreman) expireOverdueJobs() {
+	for {
+		ids, err := f.sc.JobClient().OverdueJobs(time.Now().UTC())
+		if err != nil {
+			log.Println("Foreman: Failed to get jobs past their deadline", err)
+		}
+		for _, id := range ids {
+			f.expire(id)
+		}
+
+		time.Sleep(deadlineInterval)
+	}
+}
+
+// Finalizes the job whose deadline has passed with its partial results. Its
+// pending URLs are recorded as never attempted, and dropped.
+func (f *Foreman) expire(jobId common.JobId) {
+	expired, err := f.sc.JobClient().Expire(jobId)
+	if err != nil {
+		log.Println("Foreman: Failed to expire job past its deadline", jobId, err)
+		return
+	}
+	if expired {
+		log.Println("Foreman: Job passed its deadline, finalized with partial results", jobId)
+		f.scoreLinksIfJobComplete(jobId)
+	}
+}
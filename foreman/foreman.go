@@ -27,17 +27,29 @@ type Foreman struct {
 
 	// Maximum age a cached URL can be before it can be crawled again.
 	cacheMaxAge time.Duration
+
+	// Algorithm used to score the job's internal links once the job completes.
+	linkScoring string
+
+	// Throttles the items of other jobs while an urgent job is active.
+	preemption *preemption
+
+	// Limits the jobs running at once.
+	slots *jobSlots
 }
 
 // Creates a new instance of the foreman and returns it.  The foreman's methods
 // are safe to be called across multiple go routines.
-func NewForeman(workQueuePub queue.Publisher, urlQueuePub queue.Publisher, sc *storage.Client, maxLevel int, cacheMaxAge time.Duration) *Foreman {
+func NewForeman(workQueuePub queue.Publisher, urlQueuePub queue.Publisher, sc *storage.Client, maxLevel int, cacheMaxAge time.Duration, linkScoring string, preemption *preemption, slots *jobSlots) *Foreman {
 	return &Foreman{
 		workQueuePub: workQueuePub,
 		urlQueuePub:  urlQueuePub,
 		sc:           sc,
 		maxLevel:     maxLevel,
 		cacheMaxAge:  cacheMaxAge,
+		linkScoring:  linkScoring,
+		preemption:   preemption,
+		slots:        slots,
 	}
 }
 
@@ -49,6 +61,63 @@ func (f *Foreman) ProcessQueueItem(item *common.URLQueueItem) {
 	urlClient := f.sc.URLClient()
 	log.Printf("Foreman: Queue URL: %s, from: %s, origin: %s, level: %d", item.URLId, item.ReferId, item.OriginId, item.Level)
 
+	// Items of cancelled jobs are dropped, along with any pending record
+	// added for them after the job's frontier was drained.
+	if cancelled, err := f.sc.JobClient().IsCancelled(item.JobId); err != nil {
+		log.Println("Foreman: Failed to check if job is cancelled", item.JobId, err)
+	} else if cancelled {
+		log.Println("Foreman: Dropping item of cancelled job", item.JobId, item.URLId)
+		if err := urlClient.DeletePending(item.JobId, item.URLId, item.OriginId); err != nil {
+			log.Println("Foreman: Failed to delete pending record for", item.URLId, item.OriginId)
+		}
+		return
+	}
+
+	// Items of jobs whose deadline has passed are not dispatched. The job is
+	// finalized, with its pending URLs recorded as never attempted.
+	if deadline, err := f.sc.JobClient().Deadline(item.JobId); err != nil {
+		log.Println("Foreman: Failed to get job deadline", item.JobId, err)
+	} else if !deadline.IsZero() && !time.Now().Before(deadline) {
+		log.Println("Foreman: Dropping item of job past its deadline", item.JobId, item.URLId, deadline)
+		f.expire(item.JobId)
+		return
+	}
+
+	// Items of paused jobs are parked. They remain in the job's frontier of
+	// pending URLs, and are re-queued when the job is resumed.
+	if paused, err := f.sc.JobClient().IsPaused(item.JobId); err != nil {
+		log.Println("Foreman: Failed to check if job is paused", item.JobId, err)
+	} else if paused {
+		log.Println("Foreman: Parking item of paused job", item.JobId, item.URLId)
+		return
+	}
+
+	// Items of jobs waiting for a running job slot are parked, and re-queued
+	// once the job is started. The job is started straight away if a slot is
+	// free, unless jobs were just started.
+	if !f.slots.admit(item.JobId) {
+		if err := urlClient.ParkPending(item); err != nil {
+			log.Println("Foreman: Failed to park item", item.JobId, item.URLId, err)
+		}
+		log.Println("Foreman: Parking item of waiting job", item.JobId, item.URLId)
+		if err := f.slots.startWaitingSoon(time.Now()); err != nil {
+			log.Println("Foreman: Failed to start waiting jobs", err)
+		}
+		return
+	}
+
+	// Items of jobs outside of their crawl window are parked, and re-queued
+	// once the job's crawl window opens.
+	if window, err := f.sc.JobClient().CrawlWindow(item.JobId); err != nil {
+		log.Println("Foreman: Failed to get job crawl window", item.JobId, err)
+	} else if window != nil && !window.Contains(time.Now()) {
+		if err := urlClient.ParkPending(item); err != nil {
+			log.Println("Foreman: Failed to park item", item.JobId, item.URLId, err)
+		}
+		log.Println("Foreman: Parking item of job outside crawl window", item.JobId, item.URLId, window)
+		return
+	}
+
 	urlRec, err := urlClient.GetURLById(item.URLId)
 	if err != nil || urlRec == nil {
 		log.Println("Foreman: Failed to get URL", item.URLId, err)
@@ -56,13 +125,25 @@ func (f *Foreman) ProcessQueueItem(item *common.URLQueueItem) {
 	}
 
 	// If the item URL has already been crawled or a mime type
-	// that can be skipped, use the cache instead.
+	// that can be skipped, use the cache instead. Downloads are always
+	// sent to the workers, which skip files already downloaded.
 	now := time.Now().UTC()
-	if (urlRec.Crawled && now.Sub(urlRec.CrawledOn) < f.cacheMaxAge && !item.ForceCrawl) || common.CanSkipMime(urlRec.Mime) {
+	cached := (urlRec.Crawled && now.Sub(urlRec.CrawledOn) < f.cacheMaxAge && !item.ForceCrawl) || common.CanSkipMime(urlRec.Mime)
+	if cached && !item.Download {
 		f.processFromCache(item, urlRec)
 		return
 	}
 
+	// While an urgent job is active, items of other jobs over the throttled
+	// rate are parked, and re-queued once no urgent job is active.
+	if !f.preemption.admit(item.JobId, now) {
+		if err := urlClient.ParkPending(item); err != nil {
+			log.Println("Foreman: Failed to park item", item.JobId, item.URLId, err)
+		}
+		log.Println("Foreman: Parking item of job preempted by urgent job", item.JobId, item.URLId)
+		return
+	}
+
 	f.workQueuePub.Send(item)
 }
 
@@ -84,6 +165,7 @@ func (f *Foreman) processFromCache(item *common.URLQueueItem, urlRec *storage.UR
 			log.Println("Foreman: Failed to update if Job URL is complete", item.OriginId, err)
 		} else if complete {
 			log.Println("Foreman: Marked Job URL as complete", item.JobId, item.OriginId)
+			f.scoreLinksIfJobComplete(item.JobId)
 		}
 	}()
 
@@ -91,7 +173,7 @@ func (f *Foreman) processFromCache(item *common.URLQueueItem, urlRec *storage.UR
 	// because the first layer is the URLs that are used to start a job,
 	// so they do not make sense to be inserted into the results without a refer.
 	if item.Level > 0 {
-		urlClient.AddResult(item.JobId, item.ReferId, item.URLId)
+		urlClient.AddResult(item.JobId, item.ReferId, item.URLId, item.Level)
 	}
 
 	if err := f.processDescendants(item); err != nil {
@@ -100,9 +182,23 @@ func (f *Foreman) processFromCache(item *common.URLQueueItem, urlRec *storage.UR
 	}
 }
 
+// Scores the job's internal links if all of the job's URLs have been completed.
+func (f *Foreman) scoreLinksIfJobComplete(jobId common.JobId) {
+	jobClient := f.sc.JobClient()
+	if complete, err := jobClient.IsComplete(jobId); err != nil || !complete {
+		return
+	}
+
+	if err := jobClient.ScoreLinks(jobId, f.linkScoring); err != nil {
+		log.Println("Foreman: Failed to score job links", jobId, f.linkScoring, err)
+		return
+	}
+	log.Println("Foreman: Scored job links", jobId, f.linkScoring)
+}
+
 // Processes descendants of a URL which is both known and already crawled.
-// The descendants will be either added to the urlQueue if the maxLevel hasn't
-// been reached yet, or will be just added as results to
+// The descendants will be either added to the urlQueue if the maxLevel, or the
+// job's max depth hasn't been reached yet, or will be just added as results to
 func (f *Foreman) processDescendants(item *common.URLQueueItem) error {
 	urlClient := f.sc.URLClient()
 
@@ -113,36 +209,149 @@ func (f *Foreman) processDescendants(item *common.URLQueueItem) error {
 		return fmt.Errorf("Failed to get URL descendants of", item.URLId, err)
 	}
 
+	// The descendants were found by a crawl of another job, which may strip
+	// its links differently, so the job's own stripping rules are applied.
+	if urlRecs, err = f.stripURLs(item.JobId, urlRecs); err != nil {
+		return fmt.Errorf("Failed to strip URL descendants of %d, %v", item.URLId, err)
+	}
+
+	// Jobs skipping alternates do not crawl the known alternate representations
+	// of the URL.
+	if item.SkipAlternates {
+		if urlRecs, err = f.withoutAlternates(item.URLId, urlRecs); err != nil {
+			return fmt.Errorf("Failed to get URL alternates of %d, %v", item.URLId, err)
+		}
+	}
+
 	// Get all URLs where this URL is the refer, and enqueue them. But if the
-	// level would exceed the max, just add the descendants to the results.
-	if item.Level+1 < f.maxLevel {
+	// level would exceed the max, or the job has crawled its max URLs, just
+	// add the descendants to the results.
+	if item.QueuesDescendants(f.maxLevel) && !f.urlBudgetSpent(item.JobId) {
+		// Descendants outside of the job's scope, or excluded by its URL
+		// patterns are only added to the results.
+		queued, results := f.splitQueueable(item, urlRecs)
+		if len(results) > 0 {
+			urlClient.AddURLsToResults(item.JobId, item.URLId, results, item.Level+1)
+		}
+
 		log.Println("enqueue descendants")
-		if err := f.enqueueURLs(item, urlRecs); err != nil {
+		if err := f.enqueueURLs(item, queued); err != nil {
 			return fmt.Errorf("Failed to enqueue URLs", err)
 		}
 	} else {
 		log.Println("Adding descendants to results")
-		urlClient.AddURLsToResults(item.JobId, item.URLId, urlRecs)
+		urlClient.AddURLsToResults(item.JobId, item.URLId, urlRecs, item.Level+1)
 	}
 
 	return nil
 }
 
+// Returns true if the job has crawled its max URLs. If the job can't be checked
+// it is assumed not to have.
+func (f *Foreman) urlBudgetSpent(jobId common.JobId) bool {
+	spent, err := f.sc.JobClient().URLBudgetSpent(jobId)
+	if err != nil {
+		log.Println("Foreman: Failed to check job URL budget", jobId, err)
+		return false
+	}
+	return spent
+}
+
+// Splits the URLs into those which can be queued, within the scope of the
+// item's job, relative to the job URL the item descends from, and allowed by
+// the job's URL patterns, and those which can't. If the scope, or patterns
+// can't be determined they don't restrict the URLs.
+func (f *Foreman) splitQueueable(item *common.URLQueueItem, urls []*storage.URL) (queued, results []*storage.URL) {
+	scope, err := f.sc.JobClient().Scope(item.JobId)
+	if err != nil {
+		log.Println("Foreman: Failed to get job scope", item.JobId, err)
+		scope = common.JobScopeAny
+	}
+	var origin string
+	if scope != common.JobScopeAny {
+		if u, err := f.sc.URLClient().GetURLById(item.OriginId); err != nil {
+			log.Println("Foreman: Failed to get job URL for scope", item.JobId, item.OriginId, err)
+			scope = common.JobScopeAny
+		} else {
+			origin = u.URL
+		}
+	}
+
+	var filter *common.JobURLFilter
+	if patterns, err := f.sc.JobClient().URLPatterns(item.JobId); err != nil {
+		log.Println("Foreman: Failed to get job URL patterns", item.JobId, err)
+	} else if len(patterns) > 0 {
+		if filter, err = common.NewJobURLFilter(patterns); err != nil {
+			log.Println("Foreman: Failed to compile job URL patterns", item.JobId, err)
+		}
+	}
+
+	for _, u := range urls {
+		if common.InJobScope(scope, origin, u.URL) && filter.Allows(u.URL) {
+			queued = append(queued, u)
+		} else {
+			results = append(results, u)
+		}
+	}
+	return queued, results
+}
+
+// Strips the URLs with the job's stripping rules, replacing the URLs stripped
+// by the records of their stripped URL, and dropping the URLs which duplicate
+// an earlier URL once stripped. The default tracking parameters are stripped
+// if the job's rules can't be read.
+func (f *Foreman) stripURLs(jobId common.JobId, urls []*storage.URL) ([]*storage.URL, error) {
+	stripping, err := f.sc.JobClient().URLStripping(jobId)
+	if err != nil {
+		log.Println("Foreman: Failed to get job URL stripping", jobId, err)
+		stripping = common.NewURLStripping(nil, false)
+	}
+
+	stripped := make([]*storage.URL, 0, len(urls))
+	seen := make(map[common.URLId]struct{}, len(urls))
+	for _, u := range urls {
+		if s := stripping.Strip(u.URL); s != u.URL {
+			if u, err = f.sc.URLClient().GetOrAddURLByURL(s, common.GuessURLsMime(s)); err != nil {
+				return nil, err
+			}
+		}
+		if _, ok := seen[u.Id]; ok {
+			continue
+		}
+		seen[u.Id] = struct{}{}
+		stripped = append(stripped, u)
+	}
+	return stripped, nil
+}
+
+// Returns the URLs with the known alternate representations of the URL removed.
+func (f *Foreman) withoutAlternates(urlId common.URLId, urls []*storage.URL) ([]*storage.URL, error) {
+	ids, err := f.sc.URLClient().GetAlternateIds(urlId)
+	if err != nil {
+		return nil, err
+	}
+	skip := make(map[common.URLId]struct{}, len(ids))
+	for _, id := range ids {
+		skip[id] = struct{}{}
+	}
+
+	kept := []*storage.URL{}
+	for _, u := range urls {
+		if _, ok := skip[u.Id]; !ok {
+			kept = append(kept, u)
+		}
+	}
+	return kept, nil
+}
+
 // Enqueue a list of URLs with a single refer.  The URLs are added to both the
 // pending Job, and urlQueue.
 func (f *Foreman) enqueueURLs(refer *common.URLQueueItem, urls []*storage.URL) error {
 	urlClient := f.sc.URLClient()
 
 	for _, u := range urls {
-		q := &common.URLQueueItem{
-			JobId:      refer.JobId,
-			OriginId:   refer.OriginId,
-			ReferId:    refer.URLId,
-			URLId:      u.Id,
-			Level:      refer.Level + 1,
-			ForceCrawl: refer.ForceCrawl,
-		}
-		if err := urlClient.AddPending(refer.JobId, u.Id, q.OriginId); err != nil {
+		q := refer.Descendant(u.Id)
+		if err := urlClient.AddPending(q); err != nil {
 			return err
 		}
 
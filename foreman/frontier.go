@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+)
+
+// Re-queues the persisted frontier of pending URLs of every job which is not
+// paused. Used when the harvester is restarted after its queued items were lost,
+// so jobs continue where they left off instead of never completing.
+func requeueFrontiers(sc *storage.Client, urlQueuePub queue.Publisher) error {
+	ids, err := sc.JobClient().PendingJobs()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		items, err := sc.URLClient().GetPending(id)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			urlQueuePub.Send(item)
+		}
+		log.Println("Foreman: Re-queued job frontier", id, "pending", len(items))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/safehttp"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Interval between checks for job groups whose jobs have all completed.
+const groupInterval = time.Minute
+
+// Periodically completes the job groups whose jobs have all completed, and
+// notifies their webhooks. Webhooks are set by the groups' creators, so are
+// only posted to at public addresses, without following redirects to other
+// hosts. Blocks forever, and is expected to be run in its own go routine.
+func notifyGroups(sc *storage.Client) {
+	client := safehttp.NewClient(webhookTimeout)
+	for {
+		if err := notifyCompletedGroups(sc, client); err != nil {
+			log.Println("Foreman: Failed to complete job groups", err)
+		}
+
+		time.Sleep(groupInterval)
+	}
+}
+
+// Completes the job groups whose jobs have all completed, posting each group's
+// status to its webhook as JSON. Groups are only completed once, so a webhook
+// which fails all of its attempts, or whose group's status fails to be read,
+// is not notified again.
+func notifyCompletedGroups(sc *storage.Client, client *http.Client) error {
+	groups, err := sc.JobClient().CompleteGroups()
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		log.Println("Foreman: Job group", group.Id, group.Name, "completed")
+		if group.Webhook == "" {
+			continue
+		}
+
+		status, err := sc.JobClient().GroupStatus(group.Id)
+		if err != nil {
+			log.Println("Foreman: Failed to get job group", group.Id, "status, not notifying webhook", err)
+			continue
+		}
+		if err := postWebhook(client, group.Webhook, status); err != nil {
+			log.Println("Foreman: Failed to notify job group", group.Id, "webhook", group.Webhook, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"time"
+)
+
+// Defaults of the host reputation settings not configured.
+const (
+	defaultReputationInterval          = 10 * time.Minute
+	defaultReputationWindow            = time.Hour
+	defaultReputationBaseline          = 7 * 24 * time.Hour
+	defaultReputationMinRequests       = 20
+	defaultReputationErrorRateIncrease = 25
+	defaultReputationSizeRatio         = 0.2
+)
+
+// Tracking of the metrics of each host's crawls over time, and detection of
+// anomalies in them, e.g: a monitored site which started erroring, or was
+// parked.
+type HostReputationConfig struct {
+	// If the hosts' crawls are tracked. No other setting is used if false.
+	Enabled bool `json:"enabled"`
+
+	// Interval between evaluations of the hosts' crawls, e.g: 10m. Defaults
+	// to 10m.
+	// See http://golang.org/pkg/time/#ParseDuration for formatting
+	IntervalStr string `json:"interval"`
+
+	// The IntervalStr will be parsed, and its value placed into the Interval field.
+	Interval time.Duration `json:"-"`
+
+	// Window of each host's most recent requests checked for anomalies,
+	// e.g: 1h. Defaults to 1h.
+	WindowStr string `json:"window"`
+
+	// The WindowStr will be parsed, and its value placed into the Window field.
+	Window time.Duration `json:"-"`
+
+	// Period of each host's requests before the window its recent requests
+	// are compared to, e.g: 168h. Defaults to 168h, 7 days.
+	BaselineStr string `json:"baseline"`
+
+	// The BaselineStr will be parsed, and its value placed into the Baseline field.
+	Baseline time.Duration `json:"-"`
+
+	// Minimum requests both the window, and the baseline must have for their
+	// error rates, and sizes to be compared. Defaults to 20.
+	MinRequests int64 `json:"minRequests"`
+
+	// Percentage points the error rate must increase by over the baseline
+	// to spike. Defaults to 25.
+	ErrorRateIncrease float64 `json:"errorRateIncrease"`
+
+	// Fraction of the baseline's average response size the window's average
+	// must fall under to collapse. Defaults to 0.2.
+	SizeRatio float64 `json:"sizeRatio"`
+
+	// Domains of parking services, redirects to which are anomalies.
+	// Defaults to common.DefaultParkingDomains.
+	ParkingDomains []string `json:"parkingDomains"`
+
+	// Destinations anomalies are sent to. Anomalies are only recorded if
+	// neither is set.
+	Notify NotifyConfig `json:"notify"`
+}
+
+// Parses the durations, setting defaults, and validates the thresholds.
+func (c *HostReputationConfig) setDefaults() error {
+	if !c.Enabled {
+		return nil
+	}
+
+	durations := []struct {
+		name  string
+		str   string
+		value *time.Duration
+		def   time.Duration
+	}{
+		{"interval", c.IntervalStr, &c.Interval, defaultReputationInterval},
+		{"window", c.WindowStr, &c.Window, defaultReputationWindow},
+		{"baseline", c.BaselineStr, &c.Baseline, defaultReputationBaseline},
+	}
+	for _, d := range durations {
+		if d.str == "" {
+			*d.value = d.def
+			continue
+		}
+		var err error
+		if *d.value, err = time.ParseDuration(d.str); err != nil {
+			return fmt.Errorf("%s, %s", err.Error(), d.str)
+		} else if *d.value <= 0 {
+			return fmt.Errorf("Invalid host reputation %s %s, must be positive", d.name, d.str)
+		}
+	}
+
+	if c.MinRequests == 0 {
+		c.MinRequests = defaultReputationMinRequests
+	} else if c.MinRequests < 0 {
+		return fmt.Errorf("Invalid host reputation minRequests %d, must be positive", c.MinRequests)
+	}
+	if c.ErrorRateIncrease == 0 {
+		c.ErrorRateIncrease = defaultReputationErrorRateIncrease
+	} else if c.ErrorRateIncrease < 0 || c.ErrorRateIncrease > 100 {
+		return fmt.Errorf("Invalid host reputation errorRateIncrease %v, must be between 0 and 100", c.ErrorRateIncrease)
+	}
+	if c.SizeRatio == 0 {
+		c.SizeRatio = defaultReputationSizeRatio
+	} else if c.SizeRatio < 0 || c.SizeRatio >= 1 {
+		return fmt.Errorf("Invalid host reputation sizeRatio %v, must be between 0 and 1", c.SizeRatio)
+	}
+	if len(c.ParkingDomains) == 0 {
+		c.ParkingDomains = common.DefaultParkingDomains
+	}
+	return nil
+}
+
+// Returns the thresholds anomalies are detected with.
+func (c HostReputationConfig) thresholds() common.HostAnomalyThresholds {
+	return common.HostAnomalyThresholds{
+		MinRequests:       c.MinRequests,
+		ErrorRateIncrease: c.ErrorRateIncrease,
+		SizeRatio:         c.SizeRatio,
+	}
+}
+
+// Periodically records the metrics of the hosts crawled within the window,
+// and checks each job's crawls of them for anomalies. Blocks forever, and is
+// expected to be run in its own go routine.
+func watchHostReputation(sc *storage.Client, cfg HostReputationConfig) {
+	n := newNotifier(cfg.Notify)
+	for {
+		if err := evaluateHostReputation(sc, cfg, n, time.Now().UTC()); err != nil {
+			log.Println("Foreman: Failed to evaluate host reputation", err)
+		}
+
+		time.Sleep(cfg.Interval)
+	}
+}
+
+// Records the metrics of each host crawled within the window up to the time,
+// and compares each job's requests to the host within the window to the
+// host's requests within the baseline before it. Anomalies are recorded, and
+// only notified the first time they are detected for a job's crawls of a host.
+func evaluateHostReputation(sc *storage.Client, cfg HostReputationConfig, n *notifier, now time.Time) error {
+	hc := sc.HostClient()
+	from := now.Add(-cfg.Window)
+
+	recent, err := hc.CrawlMetrics(from, now)
+	if err != nil {
+		return err
+	}
+	if len(recent) == 0 {
+		return nil
+	}
+
+	hosts := []string{}
+	totals := map[string]*common.HostMetrics{}
+	for _, r := range recent {
+		total, ok := totals[r.Metrics.Host]
+		if !ok {
+			total = &common.HostMetrics{Host: r.Metrics.Host}
+			totals[r.Metrics.Host] = total
+			hosts = append(hosts, r.Metrics.Host)
+		}
+		total.Add(r.Metrics)
+	}
+	snapshots := make([]common.HostMetrics, 0, len(hosts))
+	for _, host := range hosts {
+		snapshots = append(snapshots, *totals[host])
+	}
+	if err := hc.StoreMetrics(snapshots); err != nil {
+		return err
+	}
+
+	baselines, err := hc.Metrics(hosts, from.Add(-cfg.Baseline), from)
+	if err != nil {
+		return err
+	}
+
+	redirects, err := hc.CrawledRedirects(from, now)
+	if err != nil {
+		return err
+	}
+	type jobHost struct {
+		jobId common.JobId
+		host  string
+	}
+	targets := map[jobHost][]string{}
+	for _, r := range redirects {
+		key := jobHost{jobId: r.JobId, host: r.Host}
+		targets[key] = append(targets[key], r.Target)
+	}
+
+	for _, r := range recent {
+		anomalies := common.DetectHostAnomalies(r.JobId, r.Metrics, baselines[r.Metrics.Host],
+			targets[jobHost{jobId: r.JobId, host: r.Metrics.Host}], cfg.ParkingDomains, cfg.thresholds(), now)
+		for _, a := range anomalies {
+			added, err := hc.AddAnomaly(a)
+			if err != nil {
+				return err
+			} else if !added {
+				continue
+			}
+
+			msg := fmt.Sprintf("Harvester host %s anomaly %s in job %d: %s", a.Host, a.Kind, a.JobId, a.Detail)
+			log.Println("Foreman:", msg)
+			n.notify(notification{Kind: "hostAnomaly", Message: msg, Details: a})
+		}
+	}
+	return nil
+}
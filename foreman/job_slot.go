@@ -0,0 +1,132 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// Interval waiting jobs are checked for running job slots which freed up.
+const jobSlotInterval = 10 * time.Second
+
+// Least time between starts of waiting jobs when their items are received, so
+// the items of a large waiting job don't each try to start it.
+const jobSlotRetry = time.Second
+
+// Limits the jobs running at once. Jobs are started by the foreman when it
+// receives their first item if a running job slot is free, otherwise their
+// items are parked, and the job waits until a slot frees up. Waiting jobs are
+// started urgent jobs first, then oldest first.
+type jobSlots struct {
+	sc *storage.Client
+
+	// Queue the parked items of started jobs are re-queued to
+	urlQueuePub queue.Publisher
+
+	// Most jobs running at once, and most jobs of an API key running at
+	// once. Zero if unlimited.
+	max, maxPerKey int
+
+	// Jobs known to be started, so their items don't need to be checked.
+	// Cleared each interval so it doesn't grow forever.
+	mu      sync.Mutex
+	started map[common.JobId]struct{}
+
+	// When waiting jobs were last started from a received item.
+	triedOn time.Time
+}
+
+// Creates the running job slots of the limits.
+func newJobSlots(sc *storage.Client, urlQueuePub queue.Publisher, max, maxPerKey int) *jobSlots {
+	return &jobSlots{
+		sc:          sc,
+		urlQueuePub: urlQueuePub,
+		max:         max,
+		maxPerKey:   maxPerKey,
+		started:     map[common.JobId]struct{}{},
+	}
+}
+
+// Returns true if the job has been started, and its items can be crawled. If
+// the job can't be checked it is assumed to be started.
+func (s *jobSlots) admit(jobId common.JobId) bool {
+	s.mu.Lock()
+	_, ok := s.started[jobId]
+	s.mu.Unlock()
+	if ok {
+		return true
+	}
+
+	started, err := s.sc.JobClient().IsStarted(jobId)
+	if err != nil {
+		log.Println("Foreman: Failed to check if job is started", jobId, err)
+		return true
+	}
+	if started {
+		s.mu.Lock()
+		s.started[jobId] = struct{}{}
+		s.mu.Unlock()
+	}
+	return started
+}
+
+// Starts the waiting jobs, unless they were started from a received item
+// within the retry time. The jobs which aren't started are left to the
+// periodic check.
+func (s *jobSlots) startWaitingSoon(now time.Time) error {
+	s.mu.Lock()
+	due := now.Sub(s.triedOn) >= jobSlotRetry
+	if due {
+		s.triedOn = now
+	}
+	s.mu.Unlock()
+
+	if !due {
+		return nil
+	}
+	return s.startWaiting()
+}
+
+// Starts the waiting jobs which fit within the free running job slots, and
+// re-queues their parked items.
+func (s *jobSlots) startWaiting() error {
+	ids, err := s.sc.JobClient().StartWaitingJobs(s.max, s.maxPerKey)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		s.mu.Lock()
+		s.started[id] = struct{}{}
+		s.mu.Unlock()
+
+		items, err := s.sc.URLClient().UnparkPending(id)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			s.urlQueuePub.Send(item)
+		}
+		log.Println("Foreman: Started job", id, "queued", len(items))
+	}
+	return nil
+}
+
+// Periodically starts the waiting jobs as running job slots free up. Blocks
+// forever, and is expected to be run in its own go routine.
+func (s *jobSlots) run() {
+	for {
+		s.mu.Lock()
+		s.started = map[common.JobId]struct{}{}
+		s.mu.Unlock()
+
+		if err := s.startWaiting(); err != nil {
+			log.Println("Foreman: Failed to start waiting jobs", err)
+		}
+
+		time.Sleep(jobSlotInterval)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/jasdel/harvester/internal/common"
 	"github.com/jasdel/harvester/internal/queue"
 	"github.com/jasdel/harvester/internal/storage"
 	"log"
@@ -28,10 +29,67 @@ import (
 // Once a URL item is filtered, and not cached it will be sent
 // to the Work Queue to be crawled.
 //
+// If the resultRetention configuration is set, the foreman will also
+// periodically archive jobs completed longer ago than the retention age,
+// tiering their stored HTML, and cached fetch bodies into the storage's
+// cold store. The resultRetentionRules
+// configuration sets the retention of the jobs of a tenant's API key, or
+// tag, instead. Jobs are archived by the first rule they match.
+//
+// Items of paused jobs are not crawled, and remain in the job's frontier of
+// pending URLs until the job is resumed. If started with the -resume flag, the
+// foreman re-queues the frontiers of all jobs which are not paused, so jobs
+// continue after a restart of the harvester.
+//
+// Items of jobs with a crawl window are parked while outside of the window,
+// and re-queued by the foreman once the window opens.
+//
+// Items of cancelled jobs are dropped instead of being crawled.
+//
+// Items of jobs whose deadline has passed are no longer sent to the workers.
+// The foreman finalizes the job with its partial results, recording its pending
+// URLs as never attempted.
+//
+// If maxRunningJobs, or maxRunningJobsPerKey are configured, no more than that
+// many jobs, or jobs of each API key, are running at once. Jobs scheduled once
+// the limit is reached are waiting, and their items are parked until the
+// foreman starts them, oldest first, as running jobs complete, are paused, or
+// are cancelled. Jobs scheduled without an API key share a per key limit.
+//
+// While a job flagged as urgent is active, items of all other jobs are only
+// sent to the workers at the urgentThrottleRate, and the items over the rate
+// are parked until no urgent job is active, so urgent crawls don't wait behind
+// the queued items of other jobs.
+//
+// If the urlQueue is configured with a priorityBuffer, the items received
+// while the foreman is busy are filtered highest job priority first.
+//
+// Job groups whose jobs have all completed are marked complete by the foreman,
+// and their status is posted to the group's webhook, if it has one.
+//
+// The webhooks of API key quotas are notified as the key's usage within the
+// month crosses each of the quotaThresholds percents of the quota.
+//
+// If alert rules are configured, the foreman periodically evaluates them
+// against the crawl of each pending job, notifying the configured webhook or
+// Slack when a rule fires, and when it resolves. Alerts which have fired are
+// only held in memory, so rules should be configured on a single foreman.
+//
+// If host reputation is enabled, the foreman periodically records the metrics
+// of each host crawled, and compares each job's recent requests to the host
+// with the host's earlier requests. Error spikes, collapses of the response
+// sizes, and redirects to parked domains are recorded as anomalies of the host,
+// and notified once per job.
+//
 func main() {
 	// Configuration file containing all basic configuration for a server instance to run
 	cfgFilename := flag.String("config", "config.json", "The foreman configuration file.")
 
+	// Re-queues the pending URLs of all jobs which are not paused. Should be used
+	// by a single foreman when the harvester is restarted, and the queued items
+	// were lost.
+	resume := flag.Bool("resume", false, "Re-queue the pending URLs of unpaused jobs on start.")
+
 	flag.Parse()
 	cfg, err := LoadConfig(*cfgFilename)
 	if err != nil {
@@ -70,7 +128,37 @@ func main() {
 	}
 	defer sc.Close()
 
-	foreman := NewForeman(workQueuePub, urlQueuePub, sc, cfg.MaxLevel, cfg.CacheMaxAge)
+	if cfg.ResultRetention > 0 || len(cfg.ResultRetentionRules) > 0 {
+		go archiveResults(sc, cfg.ResultRetention, cfg.ResultRetentionRules)
+	}
+
+	// Other jobs are throttled while urgent jobs are active.
+	preemption := newPreemption(sc.JobClient().ActiveUrgentJobs, cfg.UrgentThrottleRate)
+
+	go unparkJobs(sc, urlQueuePub, preemption)
+
+	// Jobs wait to be started once the running job limits are reached.
+	slots := newJobSlots(sc, urlQueuePub, cfg.MaxRunningJobs, cfg.MaxRunningJobsPerKey)
+	go slots.run()
+	go notifyGroups(sc)
+	go notifyQuotas(sc, cfg.QuotaThresholds)
+
+	if len(cfg.Alerts.Rules) > 0 {
+		go watchAlerts(sc, cfg.Alerts)
+	}
+
+	if cfg.HostReputation.Enabled {
+		go watchHostReputation(sc, cfg.HostReputation)
+	}
+
+	if *resume {
+		if err := requeueFrontiers(sc, urlQueuePub); err != nil {
+			log.Fatalln("Failed to re-queue job frontiers:", err)
+		}
+	}
+
+	foreman := NewForeman(workQueuePub, urlQueuePub, sc, cfg.MaxLevel, cfg.CacheMaxAge, cfg.LinkScoring, preemption, slots)
+	go foreman.expireOverdueJobs()
 
 	log.Println("Ready: Waiting for URL queue items...")
 	for {
@@ -103,6 +191,43 @@ type Config struct {
 	// The CacheMaxAgeStr will be parsed, and its value placed into the CacheMaxAge field.
 	// Used to determine maximum age to cache a URL for before it is crawled again.
 	CacheMaxAge time.Duration `json:"-"`
+
+	// Algorithm used to score a job's internal links once the job completes.
+	// Either "pagerank" or "indegree". Defaults to "pagerank".
+	LinkScoring string `json:"linkScoring"`
+
+	// Age after a job completes that its bodies are tiered into the cold
+	// store. e.g: 720h for 30 days. Jobs are never archived if not set.
+	// Requires the storage's coldStore.
+	// See http://golang.org/pkg/time/#ParseDuration for formatting
+	ResultRetentionStr string `json:"resultRetention"`
+
+	// The ResultRetentionStr will be parsed, and its value placed into the ResultRetention field.
+	ResultRetention time.Duration `json:"-"`
+
+	// Retention of the results of the jobs of a tenant, or tag, instead of
+	// ResultRetention. Jobs are archived by the first rule they match. Jobs
+	// matching no rule are archived by ResultRetention if set.
+	ResultRetentionRules []RetentionRule `json:"resultRetentionRules"`
+
+	// Alert rules evaluated against the crawl of each pending job.
+	Alerts AlertConfig `json:"alerts"`
+
+	// Tracking of each host's crawls, and detection of anomalies in them.
+	HostReputation HostReputationConfig `json:"hostReputation"`
+
+	// Items per second of all other jobs sent to the workers while an urgent
+	// job is active. Items of other jobs are all parked if not set.
+	UrgentThrottleRate float64 `json:"urgentThrottleRate"`
+
+	// Percents of an API key's monthly quota its webhook is notified at as
+	// the key's usage crosses them. Defaults to defaultQuotaThresholds.
+	QuotaThresholds []int `json:"quotaThresholds"`
+
+	// Most jobs running at once, and most jobs of each API key running at
+	// once. Jobs over the limits wait to be started. Unlimited if not set.
+	MaxRunningJobs       int `json:"maxRunningJobs"`
+	MaxRunningJobsPerKey int `json:"maxRunningJobsPerKey"`
 }
 
 // Loads the configuration file from disk in as a JSON blob.
@@ -128,5 +253,53 @@ func LoadConfig(filename string) (Config, error) {
 		}
 	}
 
+	if cfg.ResultRetentionStr != "" {
+		cfg.ResultRetention, err = time.ParseDuration(cfg.ResultRetentionStr)
+		if err != nil {
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.ResultRetentionStr)
+		} else if cfg.ResultRetention <= 0 {
+			return cfg, fmt.Errorf("Invalid result retention %s, must be positive", cfg.ResultRetentionStr)
+		}
+	}
+	for i := range cfg.ResultRetentionRules {
+		if err := cfg.ResultRetentionRules[i].setDefaults(); err != nil {
+			return cfg, err
+		}
+	}
+	if (cfg.ResultRetention > 0 || len(cfg.ResultRetentionRules) > 0) && cfg.StorageConfig.ColdStore.Dir == "" {
+		return cfg, fmt.Errorf("Invalid result retention, requires the storage coldStore to archive into")
+	}
+
+	if cfg.LinkScoring == "" {
+		cfg.LinkScoring = common.LinkScorePageRank
+	} else if !common.ValidLinkScoreAlgorithm(cfg.LinkScoring) {
+		return cfg, fmt.Errorf("Invalid link scoring algorithm %s", cfg.LinkScoring)
+	}
+
+	if err := cfg.Alerts.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.HostReputation.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if cfg.UrgentThrottleRate < 0 {
+		return cfg, fmt.Errorf("Invalid urgent throttle rate %v, must be positive", cfg.UrgentThrottleRate)
+	}
+
+	if len(cfg.QuotaThresholds) == 0 {
+		cfg.QuotaThresholds = defaultQuotaThresholds
+	}
+	for _, percent := range cfg.QuotaThresholds {
+		if percent <= 0 || percent > 100 {
+			return cfg, fmt.Errorf("Invalid quota threshold %d, must be a percent between 1 and 100", percent)
+		}
+	}
+
+	if cfg.MaxRunningJobs < 0 || cfg.MaxRunningJobsPerKey < 0 {
+		return cfg, fmt.Errorf("Invalid running job limits %d, %d, must be positive", cfg.MaxRunningJobs, cfg.MaxRunningJobsPerKey)
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Longest a webhook is waited on for each attempt.
+const webhookTimeout = 10 * time.Second
+
+// Number of times a webhook is attempted before giving up.
+const webhookAttempts = 3
+
+// Destinations the foreman's notifications, e.g: alerts, are sent to. Either
+// may be omitted.
+type NotifyConfig struct {
+	// URL notifications are posted to as JSON.
+	Webhook string `json:"webhook"`
+
+	// Slack incoming webhook URL notifications are posted to as messages.
+	Slack string `json:"slack"`
+}
+
+// Notification sent by the foreman.
+type notification struct {
+	// Kind of the notification, e.g: "alert", and a human readable message.
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+
+	// Details of the notification, posted to the webhook as is.
+	Details interface{} `json:"details,omitempty"`
+
+	SentOn time.Time `json:"sentOn"`
+}
+
+// Sends notifications to the configured destinations.
+type notifier struct {
+	cfg    NotifyConfig
+	client *http.Client
+}
+
+// Creates a notifier of the destinations.
+func newNotifier(cfg NotifyConfig) *notifier {
+	return &notifier{cfg: cfg, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Sends the notification to each destination. Failures are logged, and
+// don't prevent the notification being sent to the other destinations.
+func (n *notifier) notify(msg notification) {
+	msg.SentOn = time.Now().UTC()
+
+	if n.cfg.Webhook != "" {
+		if err := postWebhook(n.client, n.cfg.Webhook, msg); err != nil {
+			log.Println("Foreman: Failed to notify webhook", n.cfg.Webhook, err)
+		}
+	}
+	if n.cfg.Slack != "" {
+		slack := struct {
+			Text string `json:"text"`
+		}{Text: msg.Message}
+		if err := postWebhook(n.client, n.cfg.Slack, slack); err != nil {
+			log.Println("Foreman: Failed to notify Slack", err)
+		}
+	}
+}
+
+// Posts the value as JSON to the webhook, retrying failed attempts.
+func postWebhook(client *http.Client, webhook string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = postWebhookOnce(client, webhook, body)
+		if err == nil || attempt == webhookAttempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// Posts the body to the webhook once, failing if the webhook does not
+// respond with a success status.
+func postWebhookOnce(client *http.Client, webhook string, body []byte) error {
+	resp, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
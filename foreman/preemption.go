@@ -0,0 +1,126 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"sync"
+	"time"
+)
+
+// Interval the active urgent jobs are checked at.
+const preemptionCheckInterval = 5 * time.Second
+
+// Preempts the workers' capacity for urgent jobs. While an urgent job is
+// active the items of all other jobs are only sent to the workers at the
+// throttled rate, and the items over the rate are parked. Parked items are
+// re-queued once no urgent job is active.
+type preemption struct {
+	// Returns the ids of the active urgent jobs
+	urgentJobs func() ([]common.JobId, error)
+
+	// Items per second of all other jobs sent to the workers while an
+	// urgent job is active. Items of other jobs are all parked if zero.
+	rate float64
+
+	// Signaled when the last urgent job is no longer active, so parked
+	// items can be re-queued without waiting for the unpark interval.
+	ended chan struct{}
+
+	mu        sync.Mutex
+	urgent    map[common.JobId]struct{}
+	checkedOn time.Time
+	allowance float64
+	last      time.Time
+}
+
+// Creates a preemption of the urgent jobs, throttling other jobs to the rate.
+func newPreemption(urgentJobs func() ([]common.JobId, error), rate float64) *preemption {
+	return &preemption{
+		urgentJobs: urgentJobs,
+		rate:       rate,
+		ended:      make(chan struct{}, 1),
+		urgent:     map[common.JobId]struct{}{},
+	}
+}
+
+// Returns true if the job's item can be sent to the workers, false if it
+// must be parked because an urgent job is active, and the throttled rate of
+// other jobs has been reached.
+func (p *preemption) admit(jobId common.JobId, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.refresh(now)
+	if len(p.urgent) == 0 {
+		return true
+	}
+	if _, ok := p.urgent[jobId]; ok {
+		return true
+	}
+	if p.rate <= 0 {
+		return false
+	}
+
+	// Token bucket of the throttled rate, bursting at most a second of items.
+	burst := p.rate
+	if burst < 1 {
+		burst = 1
+	}
+	p.allowance += now.Sub(p.last).Seconds() * p.rate
+	if p.allowance > burst {
+		p.allowance = burst
+	}
+	p.last = now
+	if p.allowance < 1 {
+		return false
+	}
+	p.allowance--
+	return true
+}
+
+// Returns true if the job's parked items must stay parked, because an urgent
+// job other than the job is active.
+func (p *preemption) preempted(jobId common.JobId, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.refresh(now)
+	if len(p.urgent) == 0 {
+		return false
+	}
+	_, ok := p.urgent[jobId]
+	return !ok
+}
+
+// Updates the active urgent jobs if they were checked longer than the check
+// interval ago. Failures are logged, and the previous jobs are kept. Expects
+// the lock to be held.
+func (p *preemption) refresh(now time.Time) {
+	if now.Sub(p.checkedOn) < preemptionCheckInterval {
+		return
+	}
+	p.checkedOn = now
+
+	ids, err := p.urgentJobs()
+	if err != nil {
+		log.Println("Foreman: Failed to get active urgent jobs", err)
+		return
+	}
+
+	wasActive := len(p.urgent) > 0
+	p.urgent = make(map[common.JobId]struct{}, len(ids))
+	for _, id := range ids {
+		p.urgent[id] = struct{}{}
+	}
+
+	if !wasActive && len(p.urgent) > 0 {
+		log.Println("Foreman: Urgent jobs active, throttling other jobs", ids)
+		p.allowance, p.last = 0, now
+	} else if wasActive && len(p.urgent) == 0 {
+		log.Println("Foreman: No urgent jobs active, no longer throttling other jobs")
+		select {
+		case p.ended <- struct{}{}:
+		default:
+		}
+	}
+}
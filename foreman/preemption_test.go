@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Returns the active urgent jobs of the ids, counting the calls made.
+func urgentJobsOf(ids *[]common.JobId, calls *int) func() ([]common.JobId, error) {
+	return func() ([]common.JobId, error) {
+		*calls++
+		return *ids, nil
+	}
+}
+
+func TestPreemptionAdmitNoUrgentJobs(t *testing.T) {
+	var ids []common.JobId
+	var calls int
+	p := newPreemption(urgentJobsOf(&ids, &calls), 0)
+
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		assert.True(t, p.admit(2, now), "Expect items admitted without urgent jobs")
+	}
+	assert.False(t, p.preempted(2, now))
+	assert.Equal(t, 1, calls, "Expect urgent jobs checked once within the interval")
+}
+
+func TestPreemptionAdmitThrottles(t *testing.T) {
+	ids := []common.JobId{1}
+	var calls int
+	p := newPreemption(urgentJobsOf(&ids, &calls), 2)
+
+	now := time.Now()
+	assert.True(t, p.admit(1, now), "Expect urgent job's items admitted")
+	assert.False(t, p.admit(2, now), "Expect no allowance once throttling starts")
+	assert.True(t, p.preempted(2, now))
+	assert.False(t, p.preempted(1, now))
+
+	now = now.Add(time.Second)
+	assert.True(t, p.admit(2, now))
+	assert.True(t, p.admit(3, now))
+	assert.False(t, p.admit(2, now), "Expect items over the rate parked")
+
+	// The allowance bursts at most a second of items.
+	now = now.Add(time.Minute)
+	assert.True(t, p.admit(2, now))
+	assert.True(t, p.admit(2, now))
+	assert.False(t, p.admit(2, now), "Expect burst capped at the rate")
+	for i := 0; i < 10; i++ {
+		assert.True(t, p.admit(1, now), "Expect urgent job's items never throttled")
+	}
+}
+
+func TestPreemptionAdmitSlowRate(t *testing.T) {
+	ids := []common.JobId{1}
+	var calls int
+	p := newPreemption(urgentJobsOf(&ids, &calls), 0.5)
+
+	now := time.Now()
+	assert.False(t, p.admit(2, now))
+	assert.False(t, p.admit(2, now.Add(time.Second)), "Expect half an item of allowance")
+	assert.True(t, p.admit(2, now.Add(2*time.Second)))
+	assert.False(t, p.admit(2, now.Add(2*time.Second)))
+}
+
+func TestPreemptionAdmitZeroRate(t *testing.T) {
+	ids := []common.JobId{1}
+	var calls int
+	p := newPreemption(urgentJobsOf(&ids, &calls), 0)
+
+	now := time.Now()
+	assert.True(t, p.admit(1, now))
+	assert.False(t, p.admit(2, now.Add(time.Hour)), "Expect other jobs' items all parked")
+}
+
+func TestPreemptionRefresh(t *testing.T) {
+	ids := []common.JobId{1}
+	var calls int
+	p := newPreemption(urgentJobsOf(&ids, &calls), 1)
+
+	now := time.Now()
+	assert.True(t, p.preempted(2, now))
+
+	// The urgent jobs aren't checked again within the interval.
+	ids = nil
+	assert.True(t, p.preempted(2, now.Add(preemptionCheckInterval/2)))
+	assert.Equal(t, 1, calls)
+
+	now = now.Add(preemptionCheckInterval)
+	assert.False(t, p.preempted(2, now), "Expect no longer preempted once urgent jobs end")
+	select {
+	case <-p.ended:
+	default:
+		t.Error("Expect end of urgent jobs signaled")
+	}
+
+	// Failures keep the previous urgent jobs.
+	p.urgentJobs = func() ([]common.JobId, error) { return nil, errors.New("failed") }
+	p.urgent = map[common.JobId]struct{}{1: {}}
+	assert.True(t, p.preempted(2, now.Add(preemptionCheckInterval)), "Expect previous urgent jobs kept")
+}
+
+func TestPreemptionUrgentJobWaitingForSlot(t *testing.T) {
+	// Active urgent jobs as storage reports them, only once started.
+	started := map[common.JobId]bool{}
+	urgentJobs := func() ([]common.JobId, error) {
+		if started[1] {
+			return []common.JobId{1}, nil
+		}
+		return nil, nil
+	}
+	p := newPreemption(urgentJobs, 0)
+
+	// While the urgent job waits for a slot, the running jobs aren't
+	// throttled, so they can complete, and free a slot.
+	now := time.Now()
+	for i := 0; i < 10; i++ {
+		assert.True(t, p.admit(2, now), "Expect running jobs admitted while urgent job waits")
+	}
+	assert.False(t, p.preempted(2, now))
+
+	started[1] = true
+	now = now.Add(preemptionCheckInterval)
+	assert.True(t, p.admit(1, now))
+	assert.False(t, p.admit(2, now), "Expect running jobs throttled once urgent job starts")
+}
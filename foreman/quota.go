@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Interval the API key quotas are checked at.
+const quotaInterval = time.Minute
+
+// Default percents of an API key's quota its webhook is notified at.
+var defaultQuotaThresholds = []int{80, 100}
+
+// Details of a quota notification, posted to the quota's webhook.
+type quotaNotice struct {
+	APIKeyId int64 `json:"apiKeyId"`
+
+	// Month the usage is of, UTC, e.g: 2015-01
+	Month string `json:"month"`
+
+	// Metric of the quota, urls, bytes, or jobs, and the percent of its
+	// limit which was crossed.
+	Metric  string `json:"metric"`
+	Percent int    `json:"percent"`
+
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
+}
+
+// Periodically notifies the webhooks of the API key quotas whose usage crossed
+// one of the thresholds. Blocks forever, and is expected to be run in its own
+// go routine.
+func notifyQuotas(sc *storage.Client, thresholds []int) {
+	client := &http.Client{Timeout: webhookTimeout}
+	for {
+		if err := notifyQuotaThresholds(sc, client, thresholds, time.Now().UTC()); err != nil {
+			log.Println("Foreman: Failed to check API key quotas", err)
+		}
+
+		time.Sleep(quotaInterval)
+	}
+}
+
+// Notifies the webhooks of the quotas whose usage within the month crossed one
+// of the thresholds. Each threshold is only notified once a month, so a webhook
+// which fails all of its attempts is not notified again. If usage crossed
+// several thresholds since last checked only the highest is notified.
+func notifyQuotaThresholds(sc *storage.Client, client *http.Client, thresholds []int, now time.Time) error {
+	keyClient := sc.APIKeyClient()
+	quotas, err := keyClient.Quotas()
+	if err != nil {
+		return err
+	}
+
+	month := now.Format(common.UsageMonthFormat)
+	for _, quota := range quotas {
+		if quota.Webhook == "" {
+			continue
+		}
+		usage, err := keyClient.QuotaUsage(quota.APIKeyId, now)
+		if err != nil {
+			return err
+		}
+
+		for _, metric := range []string{common.QuotaURLs, common.QuotaBytes, common.QuotaJobs} {
+			notice, err := crossedThreshold(keyClient, quota, usage, metric, month, thresholds)
+			if err != nil {
+				return err
+			}
+			if notice == nil {
+				continue
+			}
+
+			log.Println("Foreman: API key", quota.APIKeyId, "crossed", notice.Percent, "percent of its", metric, "quota")
+			msg := notification{
+				Kind: "quota",
+				Message: fmt.Sprintf("API key %d has used %d%% of its monthly %s quota, %d of %d",
+					quota.APIKeyId, notice.Percent, metric, notice.Used, notice.Limit),
+				Details: notice,
+				SentOn:  now,
+			}
+			if err := postWebhook(client, quota.Webhook, msg); err != nil {
+				log.Println("Foreman: Failed to notify API key", quota.APIKeyId, "quota webhook", quota.Webhook, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Marks the thresholds of the metric the usage has crossed as notified,
+// returning the notice of the highest threshold which wasn't notified before.
+// Nil is returned if no new threshold was crossed.
+func crossedThreshold(keyClient *storage.APIKeyClient, quota common.APIKeyQuota, usage common.APIKeyQuotaUsage, metric, month string, thresholds []int) (*quotaNotice, error) {
+	limit, used := quota.Limit(metric), usage.Used(metric)
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var notice *quotaNotice
+	for _, percent := range thresholds {
+		if used*100 < limit*int64(percent) {
+			continue
+		}
+		marked, err := keyClient.MarkQuotaNotified(quota.APIKeyId, month, metric, percent)
+		if err != nil {
+			return nil, err
+		}
+		if marked && (notice == nil || percent > notice.Percent) {
+			notice = &quotaNotice{
+				APIKeyId: quota.APIKeyId,
+				Month:    month,
+				Metric:   metric,
+				Percent:  percent,
+				Used:     used,
+				Limit:    limit,
+			}
+		}
+	}
+	return notice, nil
+}
@@ -0,0 +1,28 @@
+// +build integration
+
+package integration
+
+import (
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/queue/queuetest"
+	"github.com/jasdel/harvester/internal/storage/storagetest"
+	"testing"
+	"time"
+)
+
+func TestNATSQueueConformance(t *testing.T) {
+	queuetest.Run(t, queuetest.Driver{
+		NewPublisher: func(topic string) (queue.Publisher, error) {
+			return queue.NewPublisher(queue.QueueConfig{Topic: topic, ConnURL: natsURL})
+		},
+		NewReceiver: func(topic string) (queue.Receiver, error) {
+			return queue.NewReceiver(queue.QueueConfig{Topic: topic, ConnURL: natsURL})
+		},
+		// Subscriptions are registered with the server asynchronously.
+		Settle: 100 * time.Millisecond,
+	})
+}
+
+func TestPostgresStorageConformance(t *testing.T) {
+	storagetest.Run(t, storageConfig)
+}
@@ -0,0 +1,97 @@
+// +build integration
+
+package integration
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Longest a job is waited for to complete.
+const jobTimeout = time.Minute
+
+// Returns a test site of linked HTML pages, keyed by path.
+func newTestSite(pages map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>%s</body></html>", r.URL.Path, page)
+	}))
+}
+
+// Schedules a job crawling the URLs, and returns its id.
+func scheduleJob(t *testing.T, urls ...string) int64 {
+	resp, err := http.Post(harvesterURL+"/?forceCrawl", "text/plain", strings.NewReader(strings.Join(urls, "\n")))
+	require.NoError(t, err, "Expect job scheduled")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "Expect job scheduled")
+
+	msg := struct {
+		JobId int64 `json:"jobId"`
+	}{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg), "Expect job id")
+	return msg.JobId
+}
+
+// Waits for the job to complete, failing the test if it doesn't before the
+// timeout.
+func waitForJob(t *testing.T, id int64) {
+	for started := time.Now(); time.Now().Sub(started) < jobTimeout; <-time.After(250 * time.Millisecond) {
+		status := struct {
+			Completed int `json:"completed"`
+			Pending   int `json:"pending"`
+		}{}
+		getJSON(t, fmt.Sprintf("%s/status/%d", harvesterURL, id), &status)
+		if status.Pending == 0 && status.Completed > 0 {
+			return
+		}
+	}
+	t.Fatalf("Job %d did not complete within %s", id, jobTimeout)
+}
+
+// Requests the URL, decoding its JSON response into v.
+func getJSON(t *testing.T, u string, v interface{}) {
+	resp, err := http.Get(u)
+	require.NoError(t, err, "Expect %s requested", u)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode, "Expect %s successful", u)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v), "Expect %s JSON response", u)
+}
+
+func TestCrawlJob(t *testing.T) {
+	site := newTestSite(map[string]string{
+		"/":  `<a href="/a">a</a> <a href="/b">b</a>`,
+		"/a": `<a href="/c">c</a> <img src="/a.png">`,
+		"/b": `<a href="/">home</a>`,
+		"/c": `no links`,
+	})
+	defer site.Close()
+
+	id := scheduleJob(t, site.URL+"/")
+	waitForJob(t, id)
+
+	results := map[string][]string{}
+	getJSON(t, fmt.Sprintf("%s/result/%d", harvesterURL, id), &results)
+
+	assert.Subset(t, results[site.URL+"/"], []string{site.URL + "/a", site.URL + "/b"}, "Expect links of job URL")
+	assert.Subset(t, results[site.URL+"/a"], []string{site.URL + "/c", site.URL + "/a.png"}, "Expect links of descendant")
+	assert.Subset(t, results[site.URL+"/b"], []string{site.URL + "/"}, "Expect link back to job URL")
+}
+
+func TestCrawlJobStatusNotFound(t *testing.T) {
+	resp, err := http.Get(harvesterURL + "/status/999999")
+	require.NoError(t, err, "Expect status requested")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "Expect unknown job not found")
+}
@@ -0,0 +1,10 @@
+// Package integration tests the harvester services end to end. The storage
+// and queue dependencies are started in docker containers with dockertest, and
+// the web_server, foreman, and worker are built and run against them. Jobs are
+// scheduled against local test sites, and their results asserted.
+//
+// The tests require docker, and are only built with the integration build tag:
+//
+//	go test -tags integration github.com/jasdel/harvester/integration
+//
+package integration
@@ -0,0 +1,230 @@
+// +build integration
+
+package integration
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/ory/dockertest"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// URL of the web server's API the tests schedule jobs with.
+var harvesterURL string
+
+// Configuration of the harvester's database, and URL of the NATS server the
+// services are run against.
+var (
+	storageConfig storage.ClientConfig
+	natsURL       string
+)
+
+// Longest the dependencies, and services are waited for to start.
+const startTimeout = 2 * time.Minute
+
+// Starts the harvester's dependencies, and services, runs the tests, and
+// tears them down.
+func TestMain(m *testing.M) {
+	h, err := startHarness()
+	if err != nil {
+		log.Println("integration: failed to start harness:", err)
+		if h != nil {
+			h.stop()
+		}
+		os.Exit(1)
+	}
+	harvesterURL = h.webURL
+
+	code := m.Run()
+	h.stop()
+	os.Exit(code)
+}
+
+// Dependencies, and services of the harvester under test.
+type harness struct {
+	pool      *dockertest.Pool
+	resources []*dockertest.Resource
+	procs     []*exec.Cmd
+	dir       string
+
+	webURL string
+}
+
+// Starts the Postgres and NATS containers, creates the schema, and runs the
+// web_server, foreman, and worker against them.
+func startHarness() (*harness, error) {
+	h := &harness{}
+
+	var err error
+	if h.dir, err = ioutil.TempDir("", "harvester-integration"); err != nil {
+		return nil, err
+	}
+	if h.pool, err = dockertest.NewPool(""); err != nil {
+		return h, err
+	}
+	h.pool.MaxWait = startTimeout
+
+	pg, err := h.pool.Run("postgres", "9.6", []string{"POSTGRES_USER=docker", "POSTGRES_PASSWORD=docker", "POSTGRES_DB=docker"})
+	if err != nil {
+		return h, fmt.Errorf("Failed to start postgres, %v", err)
+	}
+	h.resources = append(h.resources, pg)
+
+	nats, err := h.pool.Run("nats", "latest", nil)
+	if err != nil {
+		return h, fmt.Errorf("Failed to start nats, %v", err)
+	}
+	h.resources = append(h.resources, nats)
+
+	storageConfig = storage.ClientConfig{
+		User: "docker", Pass: "docker", DBName: "docker",
+		Host: "localhost", Port: portOf(pg, "5432/tcp"),
+	}
+	if err := createSchema(h.pool, storageConfig); err != nil {
+		return h, err
+	}
+
+	natsURL = fmt.Sprintf("nats://localhost:%d", portOf(nats, "4222/tcp"))
+	urlQueue := map[string]interface{}{"connURL": natsURL, "topic": "url_queue"}
+	workQueue := map[string]interface{}{"connURL": natsURL, "topic": "work_queue"}
+
+	webAddr, err := freeAddr()
+	if err != nil {
+		return h, err
+	}
+	h.webURL = "http://" + webAddr
+
+	services := []struct {
+		name string
+		cfg  map[string]interface{}
+	}{
+		{"web_server", map[string]interface{}{
+			"storage": storageConfig, "urlQueue": urlQueue,
+			"httpAddr": webAddr, "httpRootPath": "",
+			"thinContentWords": 250, "instanceName": "integration", "peers": []interface{}{},
+			"cacheMaxAge": "1s",
+		}},
+		{"foreman", map[string]interface{}{
+			"storage": storageConfig, "urlQueue": urlQueue, "workQueue": workQueue,
+			"maxLevel": 2, "linkScoring": "pagerank", "cacheMaxAge": "1s",
+		}},
+		{"worker", map[string]interface{}{
+			"storage": storageConfig, "urlQueue": urlQueue, "workQueue": workQueue,
+			"maxLevel": 2, "linkScoring": "pagerank", "ignoreRobots": true,
+		}},
+	}
+	for _, s := range services {
+		if err := h.runService(s.name, s.cfg); err != nil {
+			return h, err
+		}
+	}
+
+	// The web server is ready once it responds.
+	err = h.pool.Retry(func() error {
+		resp, err := http.Get(h.webURL + "/jobs")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	})
+	if err != nil {
+		return h, fmt.Errorf("Web server did not start, %v", err)
+	}
+	return h, nil
+}
+
+// Creates the harvester's tables once the database accepts connections.
+func createSchema(pool *dockertest.Pool, cfg storage.ClientConfig) error {
+	var db *sql.DB
+	err := pool.Retry(func() error {
+		var err error
+		if db, err = sql.Open("postgres", cfg.String()); err != nil {
+			return err
+		}
+		return db.Ping()
+	})
+	if err != nil {
+		return fmt.Errorf("Postgres did not start, %v", err)
+	}
+	defer db.Close()
+
+	schema, err := ioutil.ReadFile(filepath.Join("..", "setup", "db.sql"))
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec(string(schema)); err != nil {
+		return fmt.Errorf("Failed to create schema, %v", err)
+	}
+	return nil
+}
+
+// Builds the service, and runs it with the configuration.
+func (h *harness) runService(name string, cfg map[string]interface{}) error {
+	bin := filepath.Join(h.dir, name)
+	build := exec.Command("go", "build", "-o", bin, "github.com/jasdel/harvester/"+name)
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		return fmt.Errorf("Failed to build %s, %v", name, err)
+	}
+
+	cfgFile := filepath.Join(h.dir, name+".json")
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(cfgFile, b, 0600); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(bin, "-config", cfgFile)
+	cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to run %s, %v", name, err)
+	}
+	h.procs = append(h.procs, cmd)
+	return nil
+}
+
+// Stops the services, and removes the containers.
+func (h *harness) stop() {
+	for _, cmd := range h.procs {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	for _, r := range h.resources {
+		if err := h.pool.Purge(r); err != nil {
+			log.Println("integration: failed to remove container", r.Container.Name, err)
+		}
+	}
+	os.RemoveAll(h.dir)
+}
+
+// Returns the host port the container's port is bound to.
+func portOf(r *dockertest.Resource, port string) int {
+	var p int
+	fmt.Sscanf(r.GetPort(port), "%d", &p)
+	return p
+}
+
+// Returns a free local address to listen on.
+func freeAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
@@ -0,0 +1,158 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"io"
+	"time"
+)
+
+// Names of the files within a job archive tarball.
+const (
+	jobFile     = "job.json"
+	urlsFile    = "urls.json"
+	resultsFile = "results.json"
+	linksFile   = "links.json"
+	scoresFile  = "scores.json"
+	bodiesFile  = "bodies.json"
+)
+
+// Maximum sizes of the files within a job archive, the bodies file, and of
+// all of its files uncompressed. Prevents a malicious archive from exhausting
+// memory when it is read.
+const (
+	MaxFileSize    = 64 * 1024 * 1024
+	MaxBodiesSize  = 256 * 1024 * 1024
+	MaxArchiveSize = 384 * 1024 * 1024
+)
+
+// Contents of the scores file.
+type scores struct {
+	Algorithm string             `json:"algorithm"`
+	Scores    map[string]float64 `json:"scores"`
+}
+
+// Writes the job archive as a gzip compressed tarball. Each part of the
+// archive is written as a separate JSON file. The bodies are only written if
+// archived.
+func Write(w io.Writer, a *common.JobArchive) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{jobFile, a.Job},
+		{urlsFile, a.URLs},
+		{resultsFile, a.Results},
+		{linksFile, a.Links},
+		{scoresFile, scores{Algorithm: a.LinkScoring, Scores: a.LinkScores}},
+	}
+	if a.Bodies != nil {
+		files = append(files, struct {
+			name string
+			data interface{}
+		}{bodiesFile, a.Bodies})
+	}
+	for _, f := range files {
+		if err := writeFile(tw, f.name, f.data, a.Job.CreatedOn); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data interface{}, modTime time.Time) error {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(buf)),
+		ModTime: modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = bytes.NewBuffer(buf).WriteTo(tw)
+	return err
+}
+
+// Reads a job archive from a gzip compressed tarball written by Write. Each
+// file is decoded as it is read, without buffering it. Unknown files are
+// ignored. Returns an error if the archive doesn't contain a job, a file
+// exceeds its maximum size, or it was written with a newer archive version.
+func Read(r io.Reader) (*common.JobArchive, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gr.Close()
+
+	a := &common.JobArchive{}
+	s := scores{}
+	foundJob := false
+	var total int64
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		var v interface{}
+		limit := int64(MaxFileSize)
+		switch hdr.Name {
+		case jobFile:
+			v, foundJob = &a.Job, true
+		case urlsFile:
+			v = &a.URLs
+		case resultsFile:
+			v = &a.Results
+		case linksFile:
+			v = &a.Links
+		case scoresFile:
+			v = &s
+		case bodiesFile:
+			v, limit = &a.Bodies, MaxBodiesSize
+		default:
+			continue
+		}
+
+		// The tar reader doesn't read past the size of the file's header.
+		if hdr.Size > limit {
+			return nil, fmt.Errorf("Archive file %s too large, %d bytes", hdr.Name, hdr.Size)
+		}
+		if total += hdr.Size; total > MaxArchiveSize {
+			return nil, fmt.Errorf("Archive too large, more than %d bytes uncompressed", MaxArchiveSize)
+		}
+		if err := json.NewDecoder(tr).Decode(v); err != nil {
+			return nil, fmt.Errorf("Invalid archive file %s, %v", hdr.Name, err)
+		}
+	}
+
+	if !foundJob {
+		return nil, fmt.Errorf("Archive does not contain %s", jobFile)
+	}
+	if a.Job.Version > common.JobArchiveVersion {
+		return nil, fmt.Errorf("Unsupported archive version %d", a.Job.Version)
+	}
+	a.LinkScoring, a.LinkScores = s.Algorithm, s.Scores
+
+	return a, nil
+}
@@ -0,0 +1,80 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWriteRead(t *testing.T) {
+	createdOn := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	level := 1
+	a := &common.JobArchive{
+		Job: common.ArchivedJob{
+			Version:   common.JobArchiveVersion,
+			Id:        1234,
+			CreatedOn: createdOn,
+			URLs:      []common.ArchivedJobURL{{URL: "http://example.com", CompletedOn: &createdOn}},
+			Settings: &common.ArchivedJobSettings{
+				CrawlWindow:   "22:00-06:00",
+				CrawlWindowTZ: "Europe/Berlin",
+				Flags:         []common.JobFlag{{Name: "sale", Pattern: "(?i)sale"}},
+				Tags:          []string{"team-a"},
+				Scope:         common.JobScopeSameHost,
+				StripParams:   []string{},
+			},
+		},
+		URLs: []common.ArchivedURL{
+			{URL: "http://example.com", Mime: "text/html", Status: 200, CrawledOn: &createdOn, Title: "Example"},
+			{URL: "http://example.com/a"},
+		},
+		Results:     []common.ArchivedResult{{Refer: "http://example.com", URL: "http://example.com/a", Level: &level}},
+		Links:       []common.ArchivedLink{{Refer: "http://example.com", URL: "http://example.com/a"}},
+		LinkScoring: common.LinkScorePageRank,
+		LinkScores:  map[string]float64{"http://example.com": 0.25, "http://example.com/a": 0.75},
+	}
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, Write(buf, a), "Expect no write error")
+
+	read, err := Read(buf)
+	require.Nil(t, err, "Expect no read error")
+	assert.Equal(t, a, read, "Expect archive to match after read")
+
+	a.Bodies = []common.ArchivedBody{{URL: "http://example.com", HTML: "<html></html>", Sanitized: "<html></html>", StoredOn: createdOn}}
+	buf.Reset()
+	require.Nil(t, Write(buf, a), "Expect no write error")
+	read, err = Read(buf)
+	require.Nil(t, err, "Expect no read error")
+	assert.Equal(t, a.Bodies, read.Bodies, "Expect bodies to match after read")
+}
+
+func TestReadTooLarge(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	require.Nil(t, tw.WriteHeader(&tar.Header{Name: urlsFile, Mode: 0644, Size: MaxFileSize + 1}))
+	tw.Flush()
+	gw.Close()
+
+	_, err := Read(buf)
+	require.NotNil(t, err, "Expect error for file too large")
+	assert.Contains(t, err.Error(), "too large")
+}
+
+func TestReadMissingJob(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	require.Nil(t, writeFile(tw, urlsFile, []common.ArchivedURL{}, time.Now()), "Expect no write error")
+	tw.Close()
+	gw.Close()
+
+	_, err := Read(buf)
+	assert.NotNil(t, err, "Expect error for archive without job")
+}
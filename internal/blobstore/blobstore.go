@@ -0,0 +1,125 @@
+// Package blobstore provides the object store bodies are tiered into once they
+// are no longer hot, e.g: the stored HTML of archived jobs, so they are kept
+// out of the database.
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Returned by Get if no object is stored under the key.
+var ErrNotFound = errors.New("Object not found")
+
+// Object store bodies are put into, and read back from by key. Keys are '/'
+// separated names, e.g: html/1234/raw. Stores must be safe to use across
+// multiple go routines, and by multiple services at once.
+type Store interface {
+	// Stores the body under the key, replacing any object already stored.
+	Put(key string, body []byte) error
+
+	// Returns the body stored under the key, or ErrNotFound.
+	Get(key string) ([]byte, error)
+
+	// Removes the object stored under the key. Removing a key which has no
+	// object is not an error.
+	Delete(key string) error
+}
+
+// Configuration of the object store.
+type Config struct {
+	// Directory objects are stored in, e.g: the mount point of a network
+	// file system, or object storage bucket. Every service sharing the
+	// database must be configured with the same store. No store is used
+	// if not set.
+	Dir string `json:"dir"`
+}
+
+// Creates the configured object store. Nil is returned if no store is
+// configured.
+func New(cfg Config) (Store, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create object store directory %s, %v", cfg.Dir, err)
+	}
+	return dirStore{dir: cfg.Dir}, nil
+}
+
+// Object store keeping each object as a file of the directory.
+type dirStore struct {
+	dir string
+}
+
+// Returns the file the key's object is stored in. An error is returned if the
+// key would escape the directory.
+func (s dirStore) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return "", fmt.Errorf("Invalid object key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("Invalid object key %q", key)
+		}
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Writes the object to a temporary file first, so readers never see a
+// partially written object.
+func (s dirStore) Put(key string, body []byte) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(p), ".put-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (s dirStore) Get(key string) ([]byte, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return body, err
+}
+
+func (s dirStore) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package blobstore
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobstore")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := New(Config{Dir: dir})
+	require.NoError(t, err)
+
+	_, err = s.Get("html/1/raw")
+	assert.Equal(t, ErrNotFound, err, "Expect missing object not found")
+
+	require.NoError(t, s.Put("html/1/raw", []byte("<html>")))
+	require.NoError(t, s.Put("html/1/raw", []byte("<html></html>")))
+	body, err := s.Get("html/1/raw")
+	require.NoError(t, err)
+	assert.Equal(t, "<html></html>", string(body), "Expect object replaced")
+
+	require.NoError(t, s.Delete("html/1/raw"))
+	require.NoError(t, s.Delete("html/1/raw"), "Expect deleting a missing object to succeed")
+	_, err = s.Get("html/1/raw")
+	assert.Equal(t, ErrNotFound, err)
+
+	for _, key := range []string{"", "/abs", "../escape", "html//raw", "html/./raw"} {
+		assert.Error(t, s.Put(key, nil), "Expect invalid key %q", key)
+	}
+}
+
+func TestNewNotConfigured(t *testing.T) {
+	s, err := New(Config{})
+	require.NoError(t, err)
+	assert.Nil(t, s, "Expect no store")
+}
@@ -0,0 +1,20 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAPIKeyQuotaExceeded(t *testing.T) {
+	quota := APIKeyQuota{URLs: 100, Jobs: 10}
+
+	assert.Equal(t, "", quota.Exceeded(APIKeyQuotaUsage{URLs: 99, Bytes: 1 << 30, Jobs: 9}, 1), "Expect quota within limits, bytes not enforced")
+	assert.Equal(t, QuotaURLs, quota.Exceeded(APIKeyQuotaUsage{URLs: 100, Jobs: 9}, 1), "Expect URLs quota used up")
+	assert.Equal(t, QuotaJobs, quota.Exceeded(APIKeyQuotaUsage{URLs: 100, Jobs: 10}, 1), "Expect jobs quota reported first")
+	assert.Equal(t, QuotaJobs, quota.Exceeded(APIKeyQuotaUsage{Jobs: 8}, 3), "Expect batch over the remaining jobs quota")
+	assert.Equal(t, "", quota.Exceeded(APIKeyQuotaUsage{Jobs: 8}, 2), "Expect batch within the remaining jobs quota")
+	assert.Equal(t, "", APIKeyQuota{}.Exceeded(APIKeyQuotaUsage{URLs: 1, Bytes: 1, Jobs: 1}, 1), "Expect empty quota not enforced")
+
+	assert.Equal(t, int64(100), quota.Limit(QuotaURLs), "Expect URLs limit")
+	assert.Equal(t, int64(0), quota.Limit("unknown"), "Expect no limit of unknown metric")
+}
@@ -0,0 +1,179 @@
+package common
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/jsonpath"
+	"time"
+)
+
+// Version of the job archive format. Incremented when the format changes
+// in a way older versions can not import.
+const JobArchiveVersion = 1
+
+// Self-contained copy of a job, its crawled URLs, results, and link graph.
+// Used to move a job between harvester instances. URL and job ids are not
+// included, because they are only meaningful within a single instance.
+// The HTML stored for the crawled URLs is only archived if requested.
+type JobArchive struct {
+	// The job, and the URLs it was scheduled with
+	Job ArchivedJob `json:"job"`
+
+	// All Job URLs and results, and the information found when they were crawled
+	URLs []ArchivedURL `json:"urls"`
+
+	// The job's results, each URL grouped under the URL it was found on
+	Results []ArchivedResult `json:"results"`
+
+	// Links between the job's URLs
+	Links []ArchivedLink `json:"links"`
+
+	// Algorithm used to score the job's links. Empty if not scored.
+	LinkScoring string `json:"linkScoring"`
+
+	// Link authority scores of the job's URLs, mapped by URL
+	LinkScores map[string]float64 `json:"linkScores"`
+
+	// Raw, and sanitized HTML stored for the job's URLs. Nil if bodies were
+	// not archived.
+	Bodies []ArchivedBody `json:"bodies,omitempty"`
+}
+
+// Archived job, and the URLs it was scheduled with.
+type ArchivedJob struct {
+	// Version of the archive format, JobArchiveVersion
+	Version int `json:"version"`
+
+	// Id of the job in the instance it was archived from
+	Id JobId `json:"id"`
+
+	CreatedOn time.Time        `json:"createdOn"`
+	URLs      []ArchivedJobURL `json:"urls"`
+
+	// Settings the job was scheduled with. Nil in archives exported before
+	// settings were archived, the job is then imported with the defaults.
+	Settings *ArchivedJobSettings `json:"settings,omitempty"`
+}
+
+// Settings an archived job was scheduled with. The job's API key, deadline,
+// and group are not archived, because they are only meaningful within a
+// single instance.
+type ArchivedJobSettings struct {
+	// Crawl window in the form HH:MM-HH:MM, and its IANA time zone. Empty if
+	// the job could be crawled at any time.
+	CrawlWindow   string `json:"crawlWindow,omitempty"`
+	CrawlWindowTZ string `json:"crawlWindowTZ,omitempty"`
+
+	ExtractText bool            `json:"extractText,omitempty"`
+	JSONPaths   *JobJSONPaths   `json:"jsonPaths,omitempty"`
+	Flags       []JobFlag       `json:"flags,omitempty"`
+	URLPatterns []JobURLPattern `json:"urlPatterns,omitempty"`
+	Tags        []string        `json:"tags,omitempty"`
+	StatusRules []JobStatusRule `json:"statusRules,omitempty"`
+	MaxURLs     int             `json:"maxURLs,omitempty"`
+	Scope       string          `json:"scope,omitempty"`
+
+	// Query parameters stripped from links, null if the default tracking
+	// parameters, and empty if none.
+	StripParams   []string `json:"stripParams"`
+	KeepFragments bool     `json:"keepFragments,omitempty"`
+}
+
+// Validates the settings the same as the settings of a scheduled job, since
+// archives are imported from other instances. An error is returned for the
+// first invalid setting.
+func (s *ArchivedJobSettings) Validate() error {
+	if s.CrawlWindow != "" {
+		if _, err := ParseCrawlWindow(s.CrawlWindow, s.CrawlWindowTZ); err != nil {
+			return err
+		}
+	}
+	if s.JSONPaths != nil {
+		for _, expr := range s.JSONPaths.Links {
+			if _, err := jsonpath.Compile(expr); err != nil {
+				return err
+			}
+		}
+		for _, expr := range s.JSONPaths.Fields {
+			if _, err := jsonpath.Compile(expr); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range s.Flags {
+		if f.Name == "" {
+			return fmt.Errorf("flag must have a name")
+		}
+		if _, err := f.Compile(); err != nil {
+			return err
+		}
+	}
+	if _, err := NewJobURLFilter(s.URLPatterns); err != nil {
+		return err
+	}
+	for _, tag := range s.Tags {
+		if _, err := ParseJobTag(tag); err != nil {
+			return err
+		}
+	}
+	for _, r := range s.StatusRules {
+		if _, err := ParseJobStatusRule(r.String()); err != nil {
+			return err
+		}
+	}
+	if s.MaxURLs < 0 {
+		return fmt.Errorf("Invalid max URLs %d", s.MaxURLs)
+	}
+	if _, err := ParseJobScope(s.Scope); err != nil {
+		return err
+	}
+	for _, p := range s.StripParams {
+		if _, err := ParseStripParam(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// URL a job was scheduled with. CompletedOn is nil if the URL was not completed.
+type ArchivedJobURL struct {
+	URL         string     `json:"url"`
+	CompletedOn *time.Time `json:"completedOn"`
+}
+
+// URL and the information extracted when it was crawled. CrawledOn is nil
+// if the URL was not crawled.
+type ArchivedURL struct {
+	URL         string     `json:"url"`
+	Mime        string     `json:"mime"`
+	Status      int        `json:"status"`
+	CrawledOn   *time.Time `json:"crawledOn"`
+	PublishedOn *time.Time `json:"publishedOn"`
+	ModifiedOn  *time.Time `json:"modifiedOn"`
+	WordCount   int        `json:"wordCount"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	H1          string     `json:"h1"`
+}
+
+// Job result URL found on the refer URL. Level is nil if the URL's depth
+// was not recorded.
+type ArchivedResult struct {
+	Refer string `json:"refer"`
+	URL   string `json:"url"`
+	Level *int   `json:"level"`
+}
+
+// HTML stored for the URL when it was crawled. HTML is the raw HTML, and
+// Sanitized the sanitized copy, either is empty if it was not stored.
+type ArchivedBody struct {
+	URL       string    `json:"url"`
+	HTML      string    `json:"html"`
+	Sanitized string    `json:"sanitized,omitempty"`
+	StoredOn  time.Time `json:"storedOn"`
+}
+
+// Link from the refer URL to the URL.
+type ArchivedLink struct {
+	Refer string `json:"refer"`
+	URL   string `json:"url"`
+}
@@ -0,0 +1,49 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestArchivedJobSettingsValidate(t *testing.T) {
+	valid := ArchivedJobSettings{
+		CrawlWindow:   "22:00-06:00",
+		CrawlWindowTZ: "Europe/Berlin",
+		JSONPaths:     &JobJSONPaths{Links: []string{"$.next"}, Fields: map[string]string{"price": "$.price"}},
+		Flags:         []JobFlag{{Name: "sale", Pattern: "(?i)sale"}},
+		URLPatterns:   []JobURLPattern{{Pattern: "/blog/*"}, {Pattern: "\\?page=", Regexp: true, Exclude: true}},
+		Tags:          []string{"team-a"},
+		StatusRules:   []JobStatusRule{{Status: "4xx", Action: StatusActionRetry, RetryDelay: time.Minute, Retries: 2}},
+		MaxURLs:       100,
+		Scope:         JobScopeSameHost,
+		StripParams:   []string{"utm_*"},
+	}
+	assert.NoError(t, valid.Validate())
+	assert.NoError(t, (&ArchivedJobSettings{}).Validate(), "Expect defaults valid")
+
+	cases := map[string]func(s *ArchivedJobSettings){
+		"crawl window": func(s *ArchivedJobSettings) { s.CrawlWindow = "25:00-06:00" },
+		"time zone":    func(s *ArchivedJobSettings) { s.CrawlWindowTZ = "Nowhere/Town" },
+		"JSONPath":     func(s *ArchivedJobSettings) { s.JSONPaths.Fields["price"] = "price" },
+		"flag":         func(s *ArchivedJobSettings) { s.Flags[0].Pattern = "(" },
+		"flag name":    func(s *ArchivedJobSettings) { s.Flags[0].Name = "" },
+		"URL pattern":  func(s *ArchivedJobSettings) { s.URLPatterns[1].Pattern = "(" },
+		"tag":          func(s *ArchivedJobSettings) { s.Tags[0] = "team a" },
+		"status rule":  func(s *ArchivedJobSettings) { s.StatusRules[0].Action = "explode" },
+		"max URLs":     func(s *ArchivedJobSettings) { s.MaxURLs = -1 },
+		"scope":        func(s *ArchivedJobSettings) { s.Scope = "everywhere" },
+		"strip param":  func(s *ArchivedJobSettings) { s.StripParams[0] = "a=b" },
+	}
+	for name, invalidate := range cases {
+		s := valid
+		s.JSONPaths = &JobJSONPaths{Links: []string{"$.next"}, Fields: map[string]string{"price": "$.price"}}
+		s.Flags = append([]JobFlag{}, valid.Flags...)
+		s.URLPatterns = append([]JobURLPattern{}, valid.URLPatterns...)
+		s.Tags = append([]string{}, valid.Tags...)
+		s.StatusRules = append([]JobStatusRule{}, valid.StatusRules...)
+		s.StripParams = append([]string{}, valid.StripParams...)
+		invalidate(&s)
+		assert.Error(t, s.Validate(), "Expect invalid %s refused", name)
+	}
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Hours of the day a job's URLs are allowed to be crawled, in the time zone of
+// the crawled sites. A window whose end is before its start wraps past midnight,
+// e.g: 22:00-04:00.
+type CrawlWindow struct {
+	// Start and end of the window in minutes since midnight. The start is
+	// inclusive, and the end exclusive.
+	Start, End int
+
+	// Time zone the window is in
+	Location *time.Location
+}
+
+// Parses a crawl window in the form HH:MM-HH:MM, in the IANA time zone, e.g:
+// Europe/Berlin. The time zone defaults to UTC if empty.
+func ParseCrawlWindow(window, tz string) (*CrawlWindow, error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid crawl window %s, expected HH:MM-HH:MM", window)
+	}
+
+	w := &CrawlWindow{Location: time.UTC}
+	var err error
+	if w.Start, err = parseTimeOfDay(parts[0]); err != nil {
+		return nil, err
+	}
+	if w.End, err = parseTimeOfDay(parts[1]); err != nil {
+		return nil, err
+	}
+	if w.Start == w.End {
+		return nil, fmt.Errorf("Invalid crawl window %s, start and end are the same", window)
+	}
+
+	if tz != "" {
+		if w.Location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("Invalid crawl window time zone %s", tz)
+		}
+	}
+
+	return w, nil
+}
+
+// Parses a time of day in the form HH:MM, returning the minutes since midnight.
+func parseTimeOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time of day %s, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Returns true if the time is within the window.
+func (w *CrawlWindow) Contains(t time.Time) bool {
+	t = t.In(w.Location)
+	m := t.Hour()*60 + t.Minute()
+	if w.Start < w.End {
+		return m >= w.Start && m < w.End
+	}
+	return m >= w.Start || m < w.End
+}
+
+// Returns the window in the form HH:MM-HH:MM, without its time zone.
+func (w *CrawlWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseCrawlWindow(t *testing.T) {
+	w, err := ParseCrawlWindow("01:00-05:30", "")
+	require.NoError(t, err, "Expect valid window")
+	assert.Equal(t, 60, w.Start, "Expect start minutes")
+	assert.Equal(t, 330, w.End, "Expect end minutes")
+	assert.Equal(t, time.UTC, w.Location, "Expect UTC default")
+	assert.Equal(t, "01:00-05:30", w.String(), "Expect window string")
+
+	for _, c := range []struct{ window, tz string }{
+		{"01:00", ""},
+		{"01:00-25:00", ""},
+		{"1am-5am", ""},
+		{"01:00-01:00", ""},
+		{"01:00-05:00", "Not/AZone"},
+	} {
+		_, err := ParseCrawlWindow(c.window, c.tz)
+		assert.Error(t, err, "Expect invalid window %s %s", c.window, c.tz)
+	}
+}
+
+func TestCrawlWindowContains(t *testing.T) {
+	day := time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	w, _ := ParseCrawlWindow("01:00-05:00", "")
+	assert.False(t, w.Contains(day.Add(59*time.Minute)), "Expect before start outside")
+	assert.True(t, w.Contains(day.Add(time.Hour)), "Expect start inside")
+	assert.True(t, w.Contains(day.Add(4*time.Hour+59*time.Minute)), "Expect before end inside")
+	assert.False(t, w.Contains(day.Add(5*time.Hour)), "Expect end outside")
+
+	w, _ = ParseCrawlWindow("22:00-04:00", "")
+	assert.True(t, w.Contains(day.Add(23*time.Hour)), "Expect before midnight inside")
+	assert.True(t, w.Contains(day.Add(3*time.Hour)), "Expect after midnight inside")
+	assert.False(t, w.Contains(day.Add(12*time.Hour)), "Expect midday outside")
+
+	w, err := ParseCrawlWindow("01:00-05:00", "Asia/Tokyo")
+	require.NoError(t, err, "Expect valid time zone")
+	assert.False(t, w.Contains(day.Add(-22*time.Hour)), "Expect 02:00 UTC, 11:00 in Tokyo, outside")
+	assert.True(t, w.Contains(day.Add(-7*time.Hour)), "Expect 17:00 UTC, 02:00 in Tokyo, inside")
+}
@@ -0,0 +1,202 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Longest a cron schedule's next time is searched for. Schedules which
+// don't match within it, e.g: 0 0 30 2 *, never run.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// Shorthands of common cron schedules.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Range of values, and the names accepted for the values, of each of a cron
+// expression's fields.
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string
+}{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+// Schedule of a standard five field cron expression, minute, hour, day of
+// month, month, and day of week, in a time zone. e.g: "30 2 * * mon-fri" for
+// 02:30 every weekday.
+type CronSchedule struct {
+	// Bits set for each value matched by the minute, hour, day of month,
+	// month, and day of week fields.
+	minute, hour, dom, month, dow uint64
+
+	// If the day of month, or day of week fields are not '*'. If both are
+	// restricted a day matching either is scheduled, as cron does.
+	domRestricted, dowRestricted bool
+
+	// Expression the schedule was parsed from
+	expr string
+
+	// Time zone the schedule is in
+	Location *time.Location
+}
+
+// Parses the cron expression, in the IANA time zone, e.g: America/New_York.
+// Each field is either '*', a value, a range a-b, or a comma separated list
+// of them. Either '*', or a range may be stepped, e.g: */15. Months, and days
+// of the week may be named by their first three letters, and Sunday is either
+// 0 or 7. The @yearly, @monthly, @weekly, @daily, and @hourly shorthands are
+// accepted. The time zone defaults to UTC if empty.
+func ParseCronSchedule(expr, tz string) (*CronSchedule, error) {
+	s := &CronSchedule{expr: strings.TrimSpace(expr), Location: time.UTC}
+
+	spec := s.expr
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("Invalid cron expression %s, expected 5 fields", expr)
+	}
+
+	bits := []*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		var err error
+		if *bits[i], err = parseCronField(field, i); err != nil {
+			return nil, fmt.Errorf("Invalid cron expression %s, %s", expr, err.Error())
+		}
+	}
+
+	// Sunday is matched by either 0, or 7
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domRestricted = fields[2] != "*"
+	s.dowRestricted = fields[4] != "*"
+
+	if tz != "" {
+		var err error
+		if s.Location, err = time.LoadLocation(tz); err != nil {
+			return nil, fmt.Errorf("Invalid cron time zone %s", tz)
+		}
+	}
+
+	return s, nil
+}
+
+// Parses the field of the index into cronFields, returning the bits of the
+// values it matches.
+func parseCronField(field string, index int) (uint64, error) {
+	f := cronFields[index]
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %s", f.name, part)
+			}
+		}
+
+		start, end := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], index); err != nil {
+				return 0, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = parseCronValue(bounds[1], index); err != nil {
+					return 0, err
+				}
+			} else if step != 1 {
+				// A stepped value, e.g: 5/15, continues to the field's max.
+				end = f.max
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid %s range %s", f.name, rng)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Parses a value, or name, of the field of the index into cronFields.
+func parseCronValue(s string, index int) (int, error) {
+	f := cronFields[index]
+	for i, name := range f.names {
+		if strings.ToLower(s) == name {
+			// Months are named from 1, days of the week from 0.
+			return i + f.min, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s %s, must be between %d and %d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Returns the first time after t the schedule matches, in the schedule's time
+// zone. Zero is returned if the schedule never matches, e.g: February 30th.
+// Times skipped by a daylight saving transition are not matched.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.In(s.Location)
+	limit := t.Add(cronSearchLimit)
+
+	// Schedules match whole minutes, so start at the minute after t
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, s.Location)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.Location)
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.Location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.Location)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Returns true if the day of t matches the schedule's day of month, and day
+// of week fields. If both are restricted matching either is enough.
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// Returns the expression the schedule was parsed from, without its time zone.
+func (s *CronSchedule) String() string {
+	return s.expr
+}
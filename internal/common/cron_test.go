@@ -0,0 +1,70 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	s, err := ParseCronSchedule("*/15 2,14 * jan-mar mon-fri", "Europe/Berlin")
+	require.NoError(t, err)
+	assert.Equal(t, "*/15 2,14 * jan-mar mon-fri", s.String())
+	assert.Equal(t, "Europe/Berlin", s.Location.String())
+
+	s, err = ParseCronSchedule("@daily", "")
+	require.NoError(t, err)
+	assert.Equal(t, time.UTC, s.Location, "Expect UTC if time zone not set")
+
+	invalid := []struct{ expr, tz string }{
+		{"* * * *", ""},
+		{"60 * * * *", ""},
+		{"* 24 * * *", ""},
+		{"* * 0 * *", ""},
+		{"* * * 13 *", ""},
+		{"* * * * 8", ""},
+		{"*/0 * * * *", ""},
+		{"5-1 * * * *", ""},
+		{"* * * foo *", ""},
+		{"@sometimes", ""},
+		{"* * * * *", "Mars/Olympus"},
+	}
+	for _, c := range invalid {
+		_, err := ParseCronSchedule(c.expr, c.tz)
+		assert.Error(t, err, "Expect error for %s %s", c.expr, c.tz)
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	start := time.Date(2015, 1, 30, 10, 20, 30, 0, time.UTC) // Friday
+
+	cases := []struct {
+		expr   string
+		expect time.Time
+	}{
+		{"* * * * *", time.Date(2015, 1, 30, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2015, 1, 30, 10, 30, 0, 0, time.UTC)},
+		{"0 3 * * *", time.Date(2015, 1, 31, 3, 0, 0, 0, time.UTC)},
+		{"30 2 * * mon-fri", time.Date(2015, 2, 2, 2, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2015, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2016, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2015, 2, 1, 12, 0, 0, 0, time.UTC)},
+		{"0 0 15 * sat", time.Date(2015, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2015, 1, 30, 11, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		s, err := ParseCronSchedule(c.expr, "")
+		require.NoError(t, err, c.expr)
+		assert.Equal(t, c.expect, s.Next(start).UTC(), "Expect next time of %s", c.expr)
+	}
+}
+
+func TestCronScheduleNextTimeZone(t *testing.T) {
+	s, err := ParseCronSchedule("0 9 * * *", "America/New_York")
+	require.NoError(t, err)
+
+	next := s.Next(time.Date(2015, 1, 30, 15, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2015, 1, 31, 14, 0, 0, 0, time.UTC), next.UTC(), "Expect 9:00 in the schedule's time zone")
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"net/url"
+	"time"
+)
+
+// Named age range that content is grouped into by its last updated date.
+type FreshnessBucket struct {
+	// Name the bucket is reported as
+	Name string
+
+	// Maximum age content can be to fall into this bucket. Zero
+	// means there is no maximum.
+	MaxAge time.Duration
+}
+
+// Bucket name used for content which has no known updated date.
+const FreshnessUnknown = "unknown"
+
+// Age ranges used by the FreshnessReport, in ascending order of age.
+var FreshnessBuckets = []FreshnessBucket{
+	{Name: "day", MaxAge: 24 * time.Hour},
+	{Name: "week", MaxAge: 7 * 24 * time.Hour},
+	{Name: "month", MaxAge: 30 * 24 * time.Hour},
+	{Name: "quarter", MaxAge: 90 * 24 * time.Hour},
+	{Name: "year", MaxAge: 365 * 24 * time.Hour},
+	{Name: "older"},
+}
+
+// Returns the name of the freshness bucket the age falls within.
+func FreshnessBucketName(age time.Duration) string {
+	for _, b := range FreshnessBuckets {
+		if b.MaxAge == 0 || age < b.MaxAge {
+			return b.Name
+		}
+	}
+	return FreshnessUnknown
+}
+
+// Freshness distribution of a single host's crawled content.
+type HostFreshness struct {
+	// Number of crawled URLs for the host
+	Total int `json:"total"`
+
+	// Number of URLs in each freshness bucket, keyed by the bucket name.
+	Buckets map[string]int `json:"buckets"`
+
+	// Oldest last updated date found for the host's content. Nil if
+	// no dates are known.
+	Oldest *time.Time `json:"oldest"`
+
+	// Newest last updated date found for the host's content. Nil if
+	// no dates are known.
+	Newest *time.Time `json:"newest"`
+}
+
+// Freshness distribution of a job's crawled content grouped by host.
+type FreshnessReport map[string]*HostFreshness
+
+// Adds the URL's last updated date to the report, relative to now. A zero
+// updated time will be counted as unknown.
+func (r FreshnessReport) Add(u string, updated, now time.Time) {
+	host := u
+	if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+
+	h, ok := r[host]
+	if !ok {
+		h = &HostFreshness{Buckets: make(map[string]int)}
+		r[host] = h
+	}
+	h.Total++
+
+	if updated.IsZero() {
+		h.Buckets[FreshnessUnknown]++
+		return
+	}
+	h.Buckets[FreshnessBucketName(now.Sub(updated))]++
+
+	if h.Oldest == nil || updated.Before(*h.Oldest) {
+		t := updated
+		h.Oldest = &t
+	}
+	if h.Newest == nil || updated.After(*h.Newest) {
+		t := updated
+		h.Newest = &t
+	}
+}
@@ -0,0 +1,37 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFreshnessBucketName(t *testing.T) {
+	assert.Equal(t, "day", FreshnessBucketName(time.Hour), "Expect bucket to match")
+	assert.Equal(t, "month", FreshnessBucketName(10*24*time.Hour), "Expect bucket to match")
+	assert.Equal(t, "older", FreshnessBucketName(400*24*time.Hour), "Expect bucket to match")
+}
+
+func TestFreshnessReportAdd(t *testing.T) {
+	now := time.Date(2015, 1, 30, 0, 0, 0, 0, time.UTC)
+	report := FreshnessReport{}
+
+	report.Add("http://example.com/a", now.Add(-time.Hour), now)
+	report.Add("http://example.com/b", now.AddDate(-2, 0, 0), now)
+	report.Add("http://example.com/c", time.Time{}, now)
+	report.Add("https://www.google.com", now.AddDate(0, 0, -3), now)
+
+	require.Len(t, report, 2, "Expect a report per host")
+
+	host := report["example.com"]
+	require.NotNil(t, host, "Expect example.com host in report")
+	assert.Equal(t, 3, host.Total, "Expect all example.com URLs counted")
+	assert.Equal(t, 1, host.Buckets["day"], "Expect day bucket count")
+	assert.Equal(t, 1, host.Buckets["older"], "Expect older bucket count")
+	assert.Equal(t, 1, host.Buckets[FreshnessUnknown], "Expect unknown bucket count")
+	assert.Equal(t, now.AddDate(-2, 0, 0), *host.Oldest, "Expect oldest date")
+	assert.Equal(t, now.Add(-time.Hour), *host.Newest, "Expect newest date")
+
+	assert.Equal(t, 1, report["www.google.com"].Buckets["week"], "Expect week bucket count")
+}
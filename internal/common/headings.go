@@ -0,0 +1,102 @@
+package common
+
+import (
+	"sort"
+	"strings"
+)
+
+// Group of URLs which share the same value.
+type DuplicateGroup struct {
+	// Value shared by the URLs
+	Value string `json:"value"`
+
+	// URLs with the duplicate value, sorted.
+	URLs []string `json:"urls"`
+}
+
+// Report of a job's crawled HTML pages which have duplicate titles or h1
+// headings, or are missing a title or description.
+type HeadingReport struct {
+	// Titles shared by more than one page
+	DuplicateTitles []DuplicateGroup `json:"duplicateTitles"`
+
+	// h1 headings shared by more than one page
+	DuplicateH1s []DuplicateGroup `json:"duplicateH1s"`
+
+	// Pages which do not have a title
+	MissingTitles []string `json:"missingTitles"`
+
+	// Pages which do not have a description meta tag
+	MissingDescriptions []string `json:"missingDescriptions"`
+}
+
+// Generates the heading report from a mapping of page URLs to their page info.
+// Values are compared case insensitively, with surrounding white space ignored.
+// All lists in the report are sorted so the report is stable between requests.
+func NewHeadingReport(pages map[string]PageInfo) *HeadingReport {
+	report := &HeadingReport{
+		MissingTitles:       []string{},
+		MissingDescriptions: []string{},
+	}
+
+	// Iterate in URL order so the value reported for each group
+	// is stable between requests.
+	urls := make([]string, 0, len(pages))
+	for u := range pages {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	titles := make(map[string]*DuplicateGroup)
+	h1s := make(map[string]*DuplicateGroup)
+	for _, u := range urls {
+		info := pages[u]
+		if strings.TrimSpace(info.Title) == "" {
+			report.MissingTitles = append(report.MissingTitles, u)
+		} else {
+			addToDuplicateGroup(titles, info.Title, u)
+		}
+
+		if strings.TrimSpace(info.Description) == "" {
+			report.MissingDescriptions = append(report.MissingDescriptions, u)
+		}
+
+		if strings.TrimSpace(info.H1) != "" {
+			addToDuplicateGroup(h1s, info.H1, u)
+		}
+	}
+
+	report.DuplicateTitles = duplicateGroups(titles)
+	report.DuplicateH1s = duplicateGroups(h1s)
+
+	return report
+}
+
+func addToDuplicateGroup(groups map[string]*DuplicateGroup, value, u string) {
+	value = strings.TrimSpace(value)
+	key := strings.ToLower(value)
+	if g, ok := groups[key]; ok {
+		g.URLs = append(g.URLs, u)
+		return
+	}
+	groups[key] = &DuplicateGroup{Value: value, URLs: []string{u}}
+}
+
+// Returns only the groups which have more than a single URL, sorted by value.
+func duplicateGroups(groups map[string]*DuplicateGroup) []DuplicateGroup {
+	dups := []DuplicateGroup{}
+	for _, g := range groups {
+		if len(g.URLs) < 2 {
+			continue
+		}
+		dups = append(dups, *g)
+	}
+	sort.Sort(duplicateGroupsByValue(dups))
+	return dups
+}
+
+type duplicateGroupsByValue []DuplicateGroup
+
+func (d duplicateGroupsByValue) Len() int           { return len(d) }
+func (d duplicateGroupsByValue) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d duplicateGroupsByValue) Less(i, j int) bool { return d[i].Value < d[j].Value }
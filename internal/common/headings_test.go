@@ -0,0 +1,26 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewHeadingReport(t *testing.T) {
+	report := NewHeadingReport(map[string]PageInfo{
+		"http://example.com/a": PageInfo{Title: "Example", H1: "Welcome", Description: "A page"},
+		"http://example.com/b": PageInfo{Title: " example ", H1: "Other"},
+		"http://example.com/c": PageInfo{H1: "Welcome", Description: "C page"},
+		"http://example.com/d": PageInfo{Title: "Unique", Description: "D page"},
+	})
+
+	require.Len(t, report.DuplicateTitles, 1, "Expect one duplicate title")
+	assert.Equal(t, "Example", report.DuplicateTitles[0].Value, "Expect duplicate title value")
+	assert.Equal(t, []string{"http://example.com/a", "http://example.com/b"}, report.DuplicateTitles[0].URLs, "Expect duplicate title URLs")
+
+	require.Len(t, report.DuplicateH1s, 1, "Expect one duplicate h1")
+	assert.Equal(t, []string{"http://example.com/a", "http://example.com/c"}, report.DuplicateH1s[0].URLs, "Expect duplicate h1 URLs")
+
+	assert.Equal(t, []string{"http://example.com/c"}, report.MissingTitles, "Expect missing titles")
+	assert.Equal(t, []string{"http://example.com/b"}, report.MissingDescriptions, "Expect missing descriptions")
+}
@@ -0,0 +1,202 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Kinds of anomalies detected in the crawls of a host.
+const (
+	// Rate of errors of the host's recent requests spiked above its usual
+	// rate.
+	HostAnomalyErrorSpike = "errorSpike"
+
+	// Average size of the host's recent successful responses collapsed far
+	// below its usual size, e.g: pages replaced by an error or placeholder.
+	HostAnomalySizeCollapse = "sizeCollapse"
+
+	// Host's pages started redirecting to a domain parking service.
+	HostAnomalyParkedRedirect = "parkedRedirect"
+)
+
+// Domain parking services, whose hosts redirecting to them likely expired,
+// or were sold.
+var DefaultParkingDomains = []string{
+	"sedoparking.com",
+	"parkingcrew.net",
+	"bodis.com",
+	"above.com",
+	"dan.com",
+	"afternic.com",
+	"hugedomains.com",
+	"undeveloped.com",
+	"parklogic.com",
+}
+
+// Metrics of the requests made to a host within a period, from the crawl log.
+type HostMetrics struct {
+	Host string `json:"host"`
+
+	// Number of requests, requests which failed, or responded with a 4xx
+	// or 5xx status, and requests which succeeded with a 2xx status.
+	Requests  int64 `json:"requests"`
+	Errors    int64 `json:"errors"`
+	Successes int64 `json:"successes"`
+
+	// Average bytes of the bodies of the successful responses. Zero if
+	// there were none.
+	AvgBytes float64 `json:"avgBytes"`
+
+	// Period the requests were made within
+	From  time.Time `json:"from"`
+	Until time.Time `json:"until"`
+}
+
+// Returns the fraction of the requests which were errors, zero if there were
+// no requests.
+func (m HostMetrics) ErrorRate() float64 {
+	if m.Requests == 0 {
+		return 0
+	}
+	return float64(m.Errors) / float64(m.Requests)
+}
+
+// Adds the requests of the other metrics to the metrics, extending the period
+// to include the other's period.
+func (m *HostMetrics) Add(o HostMetrics) {
+	if successes := m.Successes + o.Successes; successes > 0 {
+		m.AvgBytes = (m.AvgBytes*float64(m.Successes) + o.AvgBytes*float64(o.Successes)) / float64(successes)
+	}
+	m.Requests += o.Requests
+	m.Errors += o.Errors
+	m.Successes += o.Successes
+
+	if m.From.IsZero() || (!o.From.IsZero() && o.From.Before(m.From)) {
+		m.From = o.From
+	}
+	if o.Until.After(m.Until) {
+		m.Until = o.Until
+	}
+}
+
+// Anomaly detected in a job's recent crawls of a host, compared to the host's
+// earlier crawls.
+type HostAnomaly struct {
+	Host string `json:"host"`
+
+	// Kind of the anomaly, one of the HostAnomaly constants, and a human
+	// readable description of it.
+	Kind   string `json:"kind"`
+	Detail string `json:"detail"`
+
+	// Job whose crawls of the host the anomaly was detected in
+	JobId JobId `json:"jobId"`
+
+	DetectedOn time.Time `json:"detectedOn"`
+}
+
+// Thresholds the recent crawls of a host must cross, compared to its earlier
+// crawls, to be anomalous.
+type HostAnomalyThresholds struct {
+	// Minimum requests both the recent, and earlier crawls must have made
+	// for their error rates, and response sizes to be compared.
+	MinRequests int64
+
+	// Increase of the error rate, in percentage points, for the errors to
+	// have spiked.
+	ErrorRateIncrease float64
+
+	// Fraction of the earlier average response size the recent average must
+	// be under for the size to have collapsed.
+	SizeRatio float64
+}
+
+// Returns the anomalies of the host's recent crawls by the job compared to the
+// host's baseline of earlier crawls, and the targets of redirects found in the
+// recent crawls. Redirects to a host of the parking domains, or their sub
+// domains, are anomalies. Error rates and sizes are only compared if both have
+// enough requests, so hosts without earlier crawls only have redirect
+// anomalies. The anomalies are detected at the time.
+func DetectHostAnomalies(jobId JobId, recent, baseline HostMetrics, redirects, parkingDomains []string, t HostAnomalyThresholds, now time.Time) []HostAnomaly {
+	anomalies := []HostAnomaly{}
+	add := func(kind, detail string) {
+		anomalies = append(anomalies, HostAnomaly{Host: recent.Host, Kind: kind, Detail: detail, JobId: jobId, DetectedOn: now})
+	}
+
+	if recent.Requests >= t.MinRequests && baseline.Requests >= t.MinRequests {
+		increase := 100 * (recent.ErrorRate() - baseline.ErrorRate())
+		if increase > t.ErrorRateIncrease {
+			add(HostAnomalyErrorSpike, fmt.Sprintf("error rate %.1f%% of %d requests, up from %.1f%%",
+				100*recent.ErrorRate(), recent.Requests, 100*baseline.ErrorRate()))
+		}
+	}
+
+	if recent.Successes >= t.MinRequests && baseline.Successes >= t.MinRequests && baseline.AvgBytes > 0 {
+		if recent.AvgBytes < t.SizeRatio*baseline.AvgBytes {
+			add(HostAnomalySizeCollapse, fmt.Sprintf("average response size %.0f bytes, down from %.0f bytes",
+				recent.AvgBytes, baseline.AvgBytes))
+		}
+	}
+
+	for _, target := range redirects {
+		if domain := parkingDomain(target, parkingDomains); domain != "" {
+			add(HostAnomalyParkedRedirect, fmt.Sprintf("redirects to %s, parked with %s", target, domain))
+			break
+		}
+	}
+	return anomalies
+}
+
+// Returns the parking domain the URL's host is, or is a sub domain of, empty
+// if it isn't parked.
+func parkingDomain(target string, parkingDomains []string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range parkingDomains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return domain
+		}
+	}
+	return ""
+}
+
+// Points a host's reputation score is reduced by for each of its recent
+// anomalies.
+const HostAnomalyPenalty = 10
+
+// Returns the reputation score of the host, between 0 and 100, from the
+// metrics of its crawls, and the number of anomalies recently detected in
+// them. A host which always responds successfully, without anomalies, scores
+// 100. The score is reduced by the error rate of its requests, and by
+// HostAnomalyPenalty for each anomaly.
+func HostReputationScore(m HostMetrics, anomalies int) int {
+	score := 100*(1-m.ErrorRate()) - float64(HostAnomalyPenalty*anomalies)
+	if score < 0 {
+		return 0
+	}
+	return int(score + 0.5)
+}
+
+// Reputation of a host, scored from its recent crawls, and the anomalies
+// detected in them.
+type HostReputation struct {
+	Host string `json:"host"`
+
+	// Reputation score of the host, between 0 and 100, see
+	// HostReputationScore.
+	Score int `json:"score"`
+
+	// Metrics of the host's crawls over the reputation's period, and of each
+	// evaluation of its crawls within it, most recent first.
+	Metrics HostMetrics   `json:"metrics"`
+	History []HostMetrics `json:"history"`
+
+	// Anomalies detected within the period, most recent first.
+	Anomalies []HostAnomaly `json:"anomalies"`
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+var testAnomalyThresholds = HostAnomalyThresholds{MinRequests: 10, ErrorRateIncrease: 25, SizeRatio: 0.2}
+
+func TestDetectHostAnomaliesErrorSpike(t *testing.T) {
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	baseline := HostMetrics{Host: "example.com", Requests: 100, Errors: 5}
+
+	recent := HostMetrics{Host: "example.com", Requests: 20, Errors: 12}
+	anomalies := DetectHostAnomalies(1234, recent, baseline, nil, nil, testAnomalyThresholds, now)
+	require.Len(t, anomalies, 1, "Expect error spike detected")
+	assert.Equal(t, HostAnomaly{
+		Host:       "example.com",
+		Kind:       HostAnomalyErrorSpike,
+		Detail:     "error rate 60.0% of 20 requests, up from 5.0%",
+		JobId:      1234,
+		DetectedOn: now,
+	}, anomalies[0])
+
+	recent = HostMetrics{Host: "example.com", Requests: 20, Errors: 5}
+	assert.Empty(t, DetectHostAnomalies(1234, recent, baseline, nil, nil, testAnomalyThresholds, now), "Expect small increase not anomalous")
+
+	recent = HostMetrics{Host: "example.com", Requests: 5, Errors: 5}
+	assert.Empty(t, DetectHostAnomalies(1234, recent, baseline, nil, nil, testAnomalyThresholds, now), "Expect too few recent requests not compared")
+
+	recent = HostMetrics{Host: "example.com", Requests: 20, Errors: 20}
+	assert.Empty(t, DetectHostAnomalies(1234, recent, HostMetrics{}, nil, nil, testAnomalyThresholds, now), "Expect host without earlier crawls not compared")
+}
+
+func TestDetectHostAnomaliesSizeCollapse(t *testing.T) {
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	baseline := HostMetrics{Host: "example.com", Requests: 50, Successes: 50, AvgBytes: 20000}
+
+	recent := HostMetrics{Host: "example.com", Requests: 10, Successes: 10, AvgBytes: 512}
+	anomalies := DetectHostAnomalies(1234, recent, baseline, nil, nil, testAnomalyThresholds, now)
+	require.Len(t, anomalies, 1, "Expect size collapse detected")
+	assert.Equal(t, HostAnomalySizeCollapse, anomalies[0].Kind)
+	assert.Equal(t, "average response size 512 bytes, down from 20000 bytes", anomalies[0].Detail)
+
+	recent.AvgBytes = 15000
+	assert.Empty(t, DetectHostAnomalies(1234, recent, baseline, nil, nil, testAnomalyThresholds, now), "Expect similar size not anomalous")
+}
+
+func TestDetectHostAnomaliesParkedRedirect(t *testing.T) {
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	recent := HostMetrics{Host: "example.com", Requests: 1, Successes: 1}
+
+	redirects := []string{"http://example.com/home", "http://ww1.SedoParking.com/?domain=example.com", "https://dan.com/buy"}
+	anomalies := DetectHostAnomalies(1234, recent, HostMetrics{}, redirects, DefaultParkingDomains, testAnomalyThresholds, now)
+	require.Len(t, anomalies, 1, "Expect a single parked redirect anomaly")
+	assert.Equal(t, HostAnomalyParkedRedirect, anomalies[0].Kind)
+	assert.Equal(t, "redirects to http://ww1.SedoParking.com/?domain=example.com, parked with sedoparking.com", anomalies[0].Detail)
+
+	redirects = []string{"http://notsedoparking.com/", "http://example.org/"}
+	assert.Empty(t, DetectHostAnomalies(1234, recent, HostMetrics{}, redirects, DefaultParkingDomains, testAnomalyThresholds, now), "Expect other domains not parked")
+}
+
+func TestHostReputationScore(t *testing.T) {
+	assert.Equal(t, 100, HostReputationScore(HostMetrics{}, 0), "Expect uncrawled host fully reputable")
+	assert.Equal(t, 100, HostReputationScore(HostMetrics{Requests: 10}, 0), "Expect host without errors fully reputable")
+	assert.Equal(t, 75, HostReputationScore(HostMetrics{Requests: 8, Errors: 2}, 0), "Expect score reduced by error rate")
+	assert.Equal(t, 55, HostReputationScore(HostMetrics{Requests: 8, Errors: 2}, 2), "Expect score reduced by anomalies")
+	assert.Equal(t, 0, HostReputationScore(HostMetrics{Requests: 8, Errors: 8}, 3), "Expect score not negative")
+}
+
+func TestHostMetricsAdd(t *testing.T) {
+	start := time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	m := HostMetrics{Host: "example.com"}
+	m.Add(HostMetrics{Requests: 4, Errors: 1, Successes: 3, AvgBytes: 100, From: start.Add(time.Hour), Until: start.Add(2 * time.Hour)})
+	m.Add(HostMetrics{Requests: 2, Successes: 1, AvgBytes: 500, From: start, Until: start.Add(time.Hour)})
+	m.Add(HostMetrics{Requests: 1, Errors: 1})
+
+	assert.Equal(t, HostMetrics{
+		Host:      "example.com",
+		Requests:  7,
+		Errors:    2,
+		Successes: 4,
+		AvgBytes:  200,
+		From:      start,
+		Until:     start.Add(2 * time.Hour),
+	}, m, "Expect requests summed, and sizes averaged over the successes")
+}
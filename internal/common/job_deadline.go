@@ -0,0 +1,64 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// Parses the deadline of a job, either an RFC 3339 time, or a timeout after
+// now, e.g: 2h30m. Only one of them may be set. Zero is returned if neither
+// is. An error is returned if the deadline is invalid, or not after now.
+func ParseJobDeadline(deadline, timeout string, now time.Time) (time.Time, error) {
+	switch {
+	case deadline != "" && timeout != "":
+		return time.Time{}, fmt.Errorf("Only one of deadline, or timeout can be set")
+
+	case timeout != "":
+		d, err := time.ParseDuration(timeout)
+		if err != nil || d <= 0 {
+			return time.Time{}, fmt.Errorf("Invalid timeout %s, must be a positive duration, e.g: 2h30m", timeout)
+		}
+		return now.Add(d).UTC(), nil
+
+	case deadline != "":
+		t, err := time.Parse(time.RFC3339, deadline)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid deadline %s, must be an RFC 3339 time", deadline)
+		}
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("Invalid deadline %s, must be in the future", deadline)
+		}
+		return t.UTC(), nil
+	}
+	return time.Time{}, nil
+}
+
+// Deadline of a job, and the URLs it never attempted because of it.
+type JobDeadline struct {
+	// Time after which the job's URLs are no longer dispatched
+	Deadline time.Time `json:"deadline"`
+
+	// When the job was finalized because its deadline passed. Nil if the
+	// job finished before its deadline, or it hasn't passed yet.
+	ExpiredOn *time.Time `json:"expiredOn,omitempty"`
+
+	// Number of the job's pending URLs which were never attempted.
+	Unattempted int `json:"unattempted"`
+}
+
+// URL of a job which was pending when the job's deadline passed, and was
+// never attempted.
+type UnattemptedURL struct {
+	URL string `json:"url"`
+
+	// URL the URL was found on, empty for the job's URLs, and the distance
+	// from the job's URL it was found at.
+	Refer string `json:"refer,omitempty"`
+	Level int    `json:"level"`
+}
+
+// Report of the URLs a job never attempted because its deadline passed.
+type UnattemptedReport struct {
+	// Unattempted URLs, ordered by level, and URL.
+	URLs []UnattemptedURL `json:"urls"`
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseJobDeadline(t *testing.T) {
+	now := time.Date(2015, 1, 30, 10, 0, 0, 0, time.UTC)
+
+	d, err := ParseJobDeadline("", "", now)
+	require.NoError(t, err)
+	assert.True(t, d.IsZero(), "Expect no deadline")
+
+	d, err = ParseJobDeadline("", "2h30m", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2015, 1, 30, 12, 30, 0, 0, time.UTC), d, "Expect timeout after now")
+
+	d, err = ParseJobDeadline("2015-01-30T12:00:00+01:00", "", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2015, 1, 30, 11, 0, 0, 0, time.UTC), d, "Expect deadline in UTC")
+
+	invalid := []struct{ deadline, timeout string }{
+		{"2015-01-30T12:00:00Z", "1h"},
+		{"", "-1h"},
+		{"", "soon"},
+		{"2015-01-30", ""},
+		{"2015-01-30T09:00:00Z", ""},
+	}
+	for _, c := range invalid {
+		_, err := ParseJobDeadline(c.deadline, c.timeout, now)
+		assert.Error(t, err, "Expect error for %q %q", c.deadline, c.timeout)
+	}
+}
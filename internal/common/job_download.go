@@ -0,0 +1,79 @@
+package common
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// States of a download job's file
+const (
+	// The file has not been downloaded yet
+	DownloadPending = "pending"
+
+	// The file was downloaded, and its checksum recorded
+	DownloadComplete = "downloaded"
+
+	// The file was downloaded, and its checksum matches the checksum it
+	// was scheduled with
+	DownloadVerified = "verified"
+
+	// The file's download failed, or its checksum did not match
+	DownloadFailed = "failed"
+)
+
+// File of a download job's URL, downloaded by the workers.
+type JobDownload struct {
+	JobId JobId  `json:"-"`
+	URLId URLId  `json:"-"`
+	URL   string `json:"url"`
+
+	// Path of the file, relative to the workers' download directory.
+	// Empty until downloaded.
+	File string `json:"file,omitempty"`
+
+	// Size, and lower cased hex SHA-256 checksum of the file
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Checksum the file was scheduled with, empty if the file isn't verified
+	ExpectedSHA256 string `json:"expectedSHA256,omitempty"`
+
+	// Content type of the file's response
+	Mime string `json:"mime,omitempty"`
+
+	// If the download was resumed from a previous partial download
+	Resumed bool `json:"resumed"`
+
+	// Why the download failed, empty if it didn't
+	Error string `json:"error,omitempty"`
+
+	// When the file was last downloaded, or failed to, zero if never attempted
+	DownloadedOn time.Time `json:"downloadedOn"`
+}
+
+// Returns the state of the download, one of the Download* constants.
+func (d JobDownload) Status() string {
+	switch {
+	case d.Error != "":
+		return DownloadFailed
+	case d.SHA256 == "":
+		return DownloadPending
+	case d.ExpectedSHA256 != "" && d.ExpectedSHA256 == d.SHA256:
+		return DownloadVerified
+	default:
+		return DownloadComplete
+	}
+}
+
+// Parses the hex SHA-256 checksum, optionally prefixed with "sha256:",
+// returning it lower cased. An error is returned if it isn't a valid checksum.
+func ParseSHA256(s string) (string, error) {
+	sum := strings.ToLower(strings.TrimSpace(s))
+	sum = strings.TrimPrefix(sum, "sha256:")
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+		return "", fmt.Errorf("Invalid SHA-256 checksum: %s", s)
+	}
+	return sum, nil
+}
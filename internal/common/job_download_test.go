@@ -0,0 +1,31 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseSHA256(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+
+	parsed, err := ParseSHA256(" SHA256:" + strings.ToUpper(sum))
+	require.NoError(t, err, "Expect prefixed checksum parsed")
+	assert.Equal(t, sum, parsed, "Expect lower cased checksum without prefix")
+
+	for _, s := range []string{"", "abc", strings.Repeat("zz", 32), strings.Repeat("ab", 31), "md5:" + sum} {
+		_, err := ParseSHA256(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestJobDownloadStatus(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+
+	assert.Equal(t, DownloadPending, JobDownload{}.Status())
+	assert.Equal(t, DownloadPending, JobDownload{ExpectedSHA256: sum}.Status())
+	assert.Equal(t, DownloadComplete, JobDownload{SHA256: sum}.Status())
+	assert.Equal(t, DownloadVerified, JobDownload{SHA256: sum, ExpectedSHA256: sum}.Status())
+	assert.Equal(t, DownloadFailed, JobDownload{SHA256: sum, ExpectedSHA256: strings.Repeat("cd", 32), Error: "checksum mismatch"}.Status())
+}
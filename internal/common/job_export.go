@@ -0,0 +1,50 @@
+package common
+
+import (
+	"time"
+)
+
+// URLs of a job exported to a destination, crawled since the job was
+// previously exported to it.
+type JobExport struct {
+	JobId JobId `json:"jobId"`
+
+	// Name of the system the URLs were exported to, e.g: warehouse
+	Destination string `json:"destination"`
+
+	// Watermark of the previous export. Nil if all of the job's crawled URLs
+	// were exported.
+	Since *time.Time `json:"since"`
+
+	// Watermark of this export, the time the latest URL exported was crawled.
+	// The next export to the destination starts from it. Nil if the job has
+	// not crawled any URLs.
+	Until *time.Time `json:"until"`
+
+	// The job's URLs crawled after Since, ordered by when they were crawled.
+	URLs []ArchivedURL `json:"urls"`
+}
+
+// Watermark of a job's previous export to a destination.
+type JobExportWatermark struct {
+	Destination string `json:"destination"`
+
+	// Time the latest URL exported was crawled
+	ExportedUntil time.Time `json:"exportedUntil"`
+
+	// When the job was last exported to the destination
+	ExportedOn time.Time `json:"exportedOn"`
+}
+
+// Returns the watermark following an export of the URLs since the previous
+// watermark, the latest time one of the URLs was crawled. The previous
+// watermark is kept if none of the URLs were crawled after it.
+func NextExportWatermark(since *time.Time, urls []ArchivedURL) *time.Time {
+	until := since
+	for _, u := range urls {
+		if u.CrawledOn != nil && (until == nil || u.CrawledOn.After(*until)) {
+			until = u.CrawledOn
+		}
+	}
+	return until
+}
@@ -0,0 +1,27 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestNextExportWatermark(t *testing.T) {
+	since := time.Date(2016, 1, 2, 0, 0, 0, 0, time.UTC)
+	earlier := since.Add(-time.Hour)
+	later := since.Add(time.Hour)
+	latest := since.Add(2 * time.Hour)
+
+	urls := []ArchivedURL{
+		{URL: "http://example.com/a", CrawledOn: &later},
+		{URL: "http://example.com/b"},
+		{URL: "http://example.com/c", CrawledOn: &latest},
+		{URL: "http://example.com/d", CrawledOn: &earlier},
+	}
+
+	assert.Equal(t, &latest, NextExportWatermark(&since, urls))
+	assert.Equal(t, &latest, NextExportWatermark(nil, urls))
+	assert.Equal(t, &since, NextExportWatermark(&since, nil))
+	assert.Equal(t, &since, NextExportWatermark(&since, urls[1:2]))
+	assert.Nil(t, NextExportWatermark(nil, []ArchivedURL{{URL: "http://example.com/b"}}))
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Regular expression a job flags its crawled pages with, when the page's
+// content matches it.
+type JobFlag struct {
+	// Lower cased name the flagged pages are filtered by. Flags may share a
+	// name, then pages matching any of them are flagged with the name.
+	Name string `json:"name"`
+
+	// Regular expression matched against the page's content, in RE2 syntax
+	Pattern string `json:"pattern"`
+}
+
+// Returns the flag matching the keyword as a whole word, in any case. The flag
+// is named by the lower cased keyword.
+func NewKeywordFlag(keyword string) JobFlag {
+	const wordBoundary = `[^\pL\pN_]`
+	return JobFlag{
+		Name:    strings.ToLower(keyword),
+		Pattern: `(?i)(?:^|` + wordBoundary + `)` + regexp.QuoteMeta(keyword) + `(?:$|` + wordBoundary + `)`,
+	}
+}
+
+// Parses the flag from its name:pattern form, lower casing the name. An error
+// is returned if the name is missing, or the pattern is not a valid regular
+// expression.
+func ParseJobFlag(s string) (JobFlag, error) {
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return JobFlag{}, fmt.Errorf("flag must be in the form name:pattern")
+	}
+
+	flag := JobFlag{Name: strings.ToLower(s[:i]), Pattern: s[i+1:]}
+	if _, err := flag.Compile(); err != nil {
+		return JobFlag{}, err
+	}
+	return flag, nil
+}
+
+// Compiles the flag's pattern.
+func (f JobFlag) Compile() (*regexp.Regexp, error) {
+	if f.Pattern == "" {
+		return nil, fmt.Errorf("flag %s has no pattern", f.Name)
+	}
+	return regexp.Compile(f.Pattern)
+}
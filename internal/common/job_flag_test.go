@@ -0,0 +1,45 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewKeywordFlag(t *testing.T) {
+	cases := []struct {
+		keyword string
+		content string
+		match   bool
+	}{
+		{"Recall", "Product recall issued", true},
+		{"recall", "RECALL: batch 12", true},
+		{"recall", "recalled products", false},
+		{"recall", "no recalls", false},
+		{"C++", "Jobs for C++ developers", true},
+		{"C++", "C+ grade", false},
+		{"out of stock", "Item is Out of Stock.", true},
+		{"café", "Le café, ouvert", true},
+		{"café", "cafés", false},
+	}
+
+	for _, c := range cases {
+		flag := NewKeywordFlag(c.keyword)
+		re, err := flag.Compile()
+		require.NoError(t, err, c.keyword)
+		assert.Equal(t, c.match, re.MatchString(c.content), "%s in %q", c.keyword, c.content)
+	}
+
+	assert.Equal(t, "c++", NewKeywordFlag("C++").Name, "Expect keyword flag named by lower cased keyword")
+}
+
+func TestParseJobFlag(t *testing.T) {
+	flag, err := ParseJobFlag(`Price:\$\d+(\.\d\d)?`)
+	require.NoError(t, err, "Expect valid flag parsed")
+	assert.Equal(t, JobFlag{Name: "price", Pattern: `\$\d+(\.\d\d)?`}, flag)
+
+	for _, s := range []string{"price", ":abc", "price:", "price:(abc"} {
+		_, err := ParseJobFlag(s)
+		assert.Error(t, err, s)
+	}
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Priorities a job's items are dispatched with. Items of a higher priority
+// are dispatched ahead of the items of lower priorities which are waiting
+// in the same queue.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// Names of the job priorities, as they are requested.
+var jobPriorityNames = map[string]int{
+	"low":    PriorityLow,
+	"normal": PriorityNormal,
+	"high":   PriorityHigh,
+}
+
+// Parses the name of a job priority, one of low, normal, or high. Empty is
+// the normal priority. An error is returned if the priority is unknown.
+func ParseJobPriority(s string) (int, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "" {
+		return PriorityNormal, nil
+	}
+	p, ok := jobPriorityNames[name]
+	if !ok {
+		return PriorityNormal, fmt.Errorf("Invalid priority: %q, must be low, normal, or high", s)
+	}
+	return p, nil
+}
+
+// Returns the name of the job priority. Priorities above high, or below low
+// are named as the nearest of them.
+func JobPriorityName(p int) string {
+	switch {
+	case p >= PriorityHigh:
+		return "high"
+	case p <= PriorityLow:
+		return "low"
+	}
+	return "normal"
+}
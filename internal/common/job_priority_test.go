@@ -0,0 +1,26 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseJobPriority(t *testing.T) {
+	cases := map[string]int{"": PriorityNormal, "low": PriorityLow, " Normal ": PriorityNormal, "HIGH": PriorityHigh}
+	for s, expect := range cases {
+		p, err := ParseJobPriority(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expect, p, s)
+		assert.Equal(t, JobPriorityName(p), JobPriorityName(expect), s)
+	}
+
+	_, err := ParseJobPriority("urgent")
+	assert.Error(t, err)
+}
+
+func TestJobPriorityName(t *testing.T) {
+	assert.Equal(t, "high", JobPriorityName(5))
+	assert.Equal(t, "normal", JobPriorityName(PriorityNormal))
+	assert.Equal(t, "low", JobPriorityName(-5))
+}
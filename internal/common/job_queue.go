@@ -0,0 +1,32 @@
+package common
+
+import (
+	"time"
+)
+
+// Position of a waiting job in the queue of jobs waiting for a running job
+// slot, and when it is expected to start.
+type JobQueuePosition struct {
+	// Position of the job in the queue, 1 for the next job to start. Jobs of
+	// API keys at their limit may be passed by later jobs of other keys.
+	Position int `json:"position"`
+
+	// Number of jobs which were started within the recent window, the rate
+	// the estimate is based on.
+	RecentlyStarted int `json:"recentlyStarted"`
+
+	// When the job is estimated to start. Nil if no jobs were started
+	// recently, so no estimate can be made.
+	EstimatedStart *time.Time `json:"estimatedStart,omitempty"`
+}
+
+// Estimates when the job at the position in the queue will start, given the
+// number of jobs started within the window before now. Jobs are assumed to
+// keep starting at the same rate. Nil is returned if no jobs were started.
+func EstimateJobStart(position, started int, window time.Duration, now time.Time) *time.Time {
+	if started <= 0 || position <= 0 {
+		return nil
+	}
+	start := now.Add(window * time.Duration(position) / time.Duration(started))
+	return &start
+}
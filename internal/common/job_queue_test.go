@@ -0,0 +1,23 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestEstimateJobStart(t *testing.T) {
+	now := time.Date(2015, 1, 30, 10, 0, 0, 0, time.UTC)
+
+	start := EstimateJobStart(1, 4, time.Hour, now)
+	require.NotNil(t, start)
+	assert.Equal(t, now.Add(15*time.Minute), *start, "Expect next job after one start")
+
+	start = EstimateJobStart(6, 4, time.Hour, now)
+	require.NotNil(t, start)
+	assert.Equal(t, now.Add(90*time.Minute), *start, "Expect estimate to scale with position")
+
+	assert.Nil(t, EstimateJobStart(3, 0, time.Hour, now), "Expect no estimate without recent starts")
+	assert.Nil(t, EstimateJobStart(0, 4, time.Hour, now), "Expect no estimate without position")
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"fmt"
+	"golang.org/x/net/publicsuffix"
+	"strings"
+)
+
+// Scopes restricting the links of a job's pages which are crawled, relative
+// to the job URL the pages descend from. Links outside of the scope are only
+// added to the job's results.
+const (
+	// Links to any host are crawled.
+	JobScopeAny = "any"
+
+	// Only links to the job URL's host are crawled.
+	JobScopeSameHost = "same-host"
+
+	// Only links to the job URL's host, and its subdomains are crawled.
+	JobScopeSubdomains = "subdomains"
+
+	// Only links within the job URL's registered domain, e.g: example.co.uk,
+	// including its other subdomains, are crawled.
+	JobScopeSameDomain = "same-registered-domain"
+)
+
+// Parses the scope a job is scheduled with, one of any, same-host, subdomains,
+// or same-registered-domain. Empty is any scope. An error is returned if the
+// scope is unknown.
+func ParseJobScope(s string) (string, error) {
+	switch scope := strings.ToLower(strings.TrimSpace(s)); scope {
+	case "":
+		return JobScopeAny, nil
+	case JobScopeAny, JobScopeSameHost, JobScopeSubdomains, JobScopeSameDomain:
+		return scope, nil
+	}
+	return "", fmt.Errorf("Invalid scope: %q, must be any, same-host, subdomains, or same-registered-domain", s)
+}
+
+// Returns true if the URL is within the scope of the job URL it was found
+// descending from. URLs whose host can't be determined are out of any scope
+// but any.
+func InJobScope(scope, origin, u string) bool {
+	if scope == "" || scope == JobScopeAny {
+		return true
+	}
+
+	originHost, host := URLHost(origin), URLHost(u)
+	if originHost == "" || host == "" {
+		return false
+	}
+
+	switch scope {
+	case JobScopeSameHost:
+		return host == originHost
+	case JobScopeSubdomains:
+		return host == originHost || strings.HasSuffix(host, "."+originHost)
+	case JobScopeSameDomain:
+		return registeredDomain(host) == registeredDomain(originHost)
+	}
+	return false
+}
+
+// Returns the registered domain of the host, its public suffix plus one label.
+// The host itself is returned if it has none, e.g: IP addresses, or localhost.
+func registeredDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
@@ -0,0 +1,45 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseJobScope(t *testing.T) {
+	scope, err := ParseJobScope("")
+	require.NoError(t, err)
+	assert.Equal(t, JobScopeAny, scope, "Expect any scope by default")
+
+	scope, err = ParseJobScope(" Same-Host ")
+	require.NoError(t, err)
+	assert.Equal(t, JobScopeSameHost, scope)
+
+	_, err = ParseJobScope("same-site")
+	assert.Error(t, err, "Expect unknown scope invalid")
+}
+
+func TestInJobScope(t *testing.T) {
+	origin := "http://www.example.co.uk/a"
+	cases := []struct {
+		scope, u string
+		in       bool
+	}{
+		{JobScopeAny, "http://other.com/", true},
+		{"", "http://other.com/", true},
+		{JobScopeSameHost, "https://www.example.co.uk:8080/b", true},
+		{JobScopeSameHost, "http://blog.example.co.uk/", false},
+		{JobScopeSubdomains, "http://blog.www.example.co.uk/", true},
+		{JobScopeSubdomains, "http://blog.example.co.uk/", false},
+		{JobScopeSubdomains, "http://notwww.example.co.uk/", false},
+		{JobScopeSameDomain, "http://blog.example.co.uk/", true},
+		{JobScopeSameDomain, "http://example.co.uk/", true},
+		{JobScopeSameDomain, "http://other.co.uk/", false},
+		{JobScopeSameHost, "mailto:someone", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.in, InJobScope(c.scope, origin, c.u), "Expect %s in %s scope %t", c.u, c.scope, c.in)
+	}
+
+	assert.True(t, InJobScope(JobScopeSameDomain, "http://127.0.0.1/", "http://127.0.0.1:8080/"), "Expect IP hosts compared whole")
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Longest tag a job can be scheduled with
+const maxJobTagLen = 64
+
+// Regex of the tags a job can be scheduled with
+const jobTagRegexp = `^[a-z0-9_-]+$`
+
+var jobTagRegexpComp = regexp.MustCompile(jobTagRegexp)
+
+// Parses the tag a job is scheduled with, e.g: the team or client it was
+// scheduled for, returning it lower cased. Tags are letters, numbers, '-',
+// or '_'. An error is returned if the tag is invalid.
+func ParseJobTag(s string) (string, error) {
+	tag := strings.ToLower(strings.TrimSpace(s))
+	if len(tag) > maxJobTagLen || !jobTagRegexpComp.MatchString(tag) {
+		return "", fmt.Errorf("Invalid tag: %q, must be up to %d letters, numbers, '-', or '_'", s, maxJobTagLen)
+	}
+	return tag, nil
+}
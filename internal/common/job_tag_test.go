@@ -0,0 +1,27 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseJobTag(t *testing.T) {
+	tag, err := ParseJobTag(" Team-SEO_2 ")
+	require.NoError(t, err, "Expect tag parsed")
+	assert.Equal(t, "team-seo_2", tag, "Expect lower cased tag")
+
+	for _, s := range []string{"", "a,b", "a b", "ü", strings.Repeat("a", maxJobTagLen+1)} {
+		_, err := ParseJobTag(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestValidJobStatus(t *testing.T) {
+	for _, status := range []string{JobStatusRunning, JobStatusCompleted, JobStatusPaused, JobStatusCancelled} {
+		assert.True(t, ValidJobStatus(status), status)
+	}
+	assert.False(t, ValidJobStatus("archived"))
+	assert.False(t, ValidJobStatus(""))
+}
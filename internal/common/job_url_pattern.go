@@ -0,0 +1,109 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Prefix of the URL patterns which are regular expressions instead of globs.
+const regexpURLPatternPrefix = "re:"
+
+// Regular expression of a URL's scheme and host, which globs match after.
+const urlGlobHostRegexp = `^[^:/?#]+://[^/?#]*`
+
+// Pattern the links of a job's pages are matched against before they are
+// queued. Links matching an exclude pattern are never queued, and if the job
+// has any include patterns links must match one of them to be queued.
+type JobURLPattern struct {
+	// Glob matched against the URL's path and query, where '*' matches any
+	// characters, including '/', e.g: /calendar/*. Or if Regexp is set, an
+	// RE2 regular expression matched against anywhere in the whole URL.
+	Pattern string `json:"pattern"`
+	Regexp  bool   `json:"regexp,omitempty"`
+
+	// If URLs matching the pattern are excluded, instead of included.
+	Exclude bool `json:"exclude,omitempty"`
+}
+
+// Parses the pattern, a glob, or a regular expression prefixed with 're:'. An
+// error is returned if the pattern is empty, or not a valid regular expression.
+func ParseJobURLPattern(s string, exclude bool) (JobURLPattern, error) {
+	p := JobURLPattern{Pattern: s, Exclude: exclude}
+	if strings.HasPrefix(s, regexpURLPatternPrefix) {
+		p.Pattern, p.Regexp = s[len(regexpURLPatternPrefix):], true
+	}
+	if _, err := p.Compile(); err != nil {
+		return JobURLPattern{}, err
+	}
+	return p, nil
+}
+
+// Returns the pattern in the form it is parsed from.
+func (p JobURLPattern) String() string {
+	if p.Regexp {
+		return regexpURLPatternPrefix + p.Pattern
+	}
+	return p.Pattern
+}
+
+// Compiles the pattern to the regular expression matching the whole URL.
+func (p JobURLPattern) Compile() (*regexp.Regexp, error) {
+	if p.Pattern == "" {
+		return nil, fmt.Errorf("URL pattern is empty")
+	}
+	if p.Regexp {
+		return regexp.Compile(p.Pattern)
+	}
+
+	parts := strings.Split(p.Pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.Compile(urlGlobHostRegexp + strings.Join(parts, ".*") + `$`)
+}
+
+// Compiled include, and exclude URL patterns of a job.
+type JobURLFilter struct {
+	include, exclude []*regexp.Regexp
+}
+
+// Compiles the job's URL patterns to the filter of the URLs queued. An error is
+// returned if a pattern is invalid.
+func NewJobURLFilter(patterns []JobURLPattern) (*JobURLFilter, error) {
+	f := &JobURLFilter{}
+	for _, p := range patterns {
+		re, err := p.Compile()
+		if err != nil {
+			return nil, err
+		}
+		if p.Exclude {
+			f.exclude = append(f.exclude, re)
+		} else {
+			f.include = append(f.include, re)
+		}
+	}
+	return f, nil
+}
+
+// Returns true if the URL matches none of the exclude patterns, and one of the
+// include patterns if there are any. A nil filter allows all URLs.
+func (f *JobURLFilter) Allows(u string) bool {
+	if f == nil {
+		return true
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(u) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseJobURLPattern(t *testing.T) {
+	p, err := ParseJobURLPattern("/calendar/*", true)
+	require.NoError(t, err)
+	assert.Equal(t, JobURLPattern{Pattern: "/calendar/*", Exclude: true}, p)
+	assert.Equal(t, "/calendar/*", p.String())
+
+	p, err = ParseJobURLPattern(`re:\?.*sessionid=`, false)
+	require.NoError(t, err)
+	assert.Equal(t, JobURLPattern{Pattern: `\?.*sessionid=`, Regexp: true}, p)
+	assert.Equal(t, `re:\?.*sessionid=`, p.String(), "Expect prefix kept in string")
+
+	_, err = ParseJobURLPattern("re:(", false)
+	assert.Error(t, err, "Expect invalid regexp rejected")
+	_, err = ParseJobURLPattern("", false)
+	assert.Error(t, err, "Expect empty pattern rejected")
+}
+
+func TestJobURLFilter(t *testing.T) {
+	parse := func(s string, exclude bool) JobURLPattern {
+		p, err := ParseJobURLPattern(s, exclude)
+		require.NoError(t, err)
+		return p
+	}
+
+	f, err := NewJobURLFilter([]JobURLPattern{
+		parse("/calendar/*", true),
+		parse("*?*", true),
+		parse("re:(?i)logout", true),
+	})
+	require.NoError(t, err)
+	assert.True(t, f.Allows("http://example.com/about"))
+	assert.False(t, f.Allows("http://example.com/calendar/2015/01"), "Expect glob excluded")
+	assert.True(t, f.Allows("http://example.com/events/calendar/"), "Expect glob anchored to path")
+	assert.False(t, f.Allows("http://example.com/list?page=2"), "Expect query excluded")
+	assert.False(t, f.Allows("http://example.com/account/LogOut"), "Expect regexp excluded")
+
+	f, err = NewJobURLFilter([]JobURLPattern{
+		parse("/blog/*", false),
+		parse("/blog/drafts/*", true),
+	})
+	require.NoError(t, err)
+	assert.True(t, f.Allows("https://example.com:8080/blog/post"), "Expect included")
+	assert.False(t, f.Allows("https://example.com/shop/"), "Expect not included")
+	assert.False(t, f.Allows("https://example.com/blog/drafts/post"), "Expect exclude over include")
+
+	var none *JobURLFilter
+	assert.True(t, none.Allows("http://example.com/"), "Expect nil filter allows all")
+}
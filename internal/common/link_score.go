@@ -0,0 +1,137 @@
+package common
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// Scores URLs with the PageRank algorithm. Scores of all URLs sum to 1.
+	LinkScorePageRank = "pagerank"
+
+	// Scores URLs by the number of distinct URLs linking to them.
+	LinkScoreInDegree = "indegree"
+)
+
+const (
+	// Probability the PageRank random surfer follows a link instead of
+	// jumping to a random URL.
+	pageRankDamping = 0.85
+
+	// PageRank iterations stop once the total change of scores is below
+	// this value, or the max iterations are reached.
+	pageRankTolerance     = 1e-6
+	pageRankMaxIterations = 100
+)
+
+// Returns if the link score algorithm is known.
+func ValidLinkScoreAlgorithm(algorithm string) bool {
+	return algorithm == LinkScorePageRank || algorithm == LinkScoreInDegree
+}
+
+// Directed graph of links between URLs used to score the authority of
+// each URL based on the links to it.
+type LinkGraph struct {
+	nodes map[URLId]struct{}
+	links map[URLId]map[URLId]struct{}
+}
+
+// Creates a new empty link graph.
+func NewLinkGraph() *LinkGraph {
+	return &LinkGraph{
+		nodes: make(map[URLId]struct{}),
+		links: make(map[URLId]map[URLId]struct{}),
+	}
+}
+
+// Adds a URL to the graph. URLs without any links to or from them
+// are still scored.
+func (g *LinkGraph) AddNode(id URLId) {
+	g.nodes[id] = struct{}{}
+}
+
+// Adds a link from the refer URL to the URL. Both URLs are added to the
+// graph if they are not already. Links from a URL to itself are ignored.
+func (g *LinkGraph) AddLink(referId, urlId URLId) {
+	g.AddNode(referId)
+	g.AddNode(urlId)
+	if referId == urlId {
+		return
+	}
+
+	if _, ok := g.links[referId]; !ok {
+		g.links[referId] = make(map[URLId]struct{})
+	}
+	g.links[referId][urlId] = struct{}{}
+}
+
+// Scores each URL of the graph with the link score algorithm.
+func (g *LinkGraph) Score(algorithm string) (map[URLId]float64, error) {
+	switch algorithm {
+	case LinkScorePageRank:
+		return g.pageRank(), nil
+	case LinkScoreInDegree:
+		return g.inDegree(), nil
+	default:
+		return nil, fmt.Errorf("Unknown link score algorithm %s", algorithm)
+	}
+}
+
+// Scores URLs by the number of distinct URLs which link to them.
+func (g *LinkGraph) inDegree() map[URLId]float64 {
+	scores := make(map[URLId]float64, len(g.nodes))
+	for id := range g.nodes {
+		scores[id] = 0
+	}
+	for _, to := range g.links {
+		for id := range to {
+			scores[id]++
+		}
+	}
+	return scores
+}
+
+// Scores URLs with the iterative PageRank algorithm. URLs without outbound
+// links distribute their score evenly across all URLs.
+func (g *LinkGraph) pageRank() map[URLId]float64 {
+	n := float64(len(g.nodes))
+	scores := make(map[URLId]float64, len(g.nodes))
+	if n == 0 {
+		return scores
+	}
+	for id := range g.nodes {
+		scores[id] = 1 / n
+	}
+
+	for i := 0; i < pageRankMaxIterations; i++ {
+		dangling := 0.0
+		for id := range g.nodes {
+			if len(g.links[id]) == 0 {
+				dangling += scores[id]
+			}
+		}
+
+		base := (1-pageRankDamping)/n + pageRankDamping*dangling/n
+		next := make(map[URLId]float64, len(g.nodes))
+		for id := range g.nodes {
+			next[id] = base
+		}
+		for from, to := range g.links {
+			share := pageRankDamping * scores[from] / float64(len(to))
+			for id := range to {
+				next[id] += share
+			}
+		}
+
+		delta := 0.0
+		for id := range g.nodes {
+			delta += math.Abs(next[id] - scores[id])
+		}
+		scores = next
+		if delta < pageRankTolerance {
+			break
+		}
+	}
+
+	return scores
+}
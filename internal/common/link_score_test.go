@@ -0,0 +1,63 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLinkGraphPageRank(t *testing.T) {
+	g := NewLinkGraph()
+	g.AddLink(1, 2)
+	g.AddLink(2, 3)
+	g.AddLink(3, 1)
+
+	scores, err := g.Score(LinkScorePageRank)
+	require.Nil(t, err, "Expect no error")
+	for id := URLId(1); id <= 3; id++ {
+		assert.InDelta(t, 1.0/3.0, scores[id], 1e-4, "Expect cycle URLs to have equal scores")
+	}
+
+	g = NewLinkGraph()
+	g.AddLink(1, 3)
+	g.AddLink(2, 3)
+	g.AddLink(3, 3)
+	g.AddNode(4)
+
+	scores, err = g.Score(LinkScorePageRank)
+	require.Nil(t, err, "Expect no error")
+	sum := 0.0
+	for _, s := range scores {
+		sum += s
+	}
+	assert.InDelta(t, 1.0, sum, 1e-4, "Expect scores to sum to 1")
+	assert.True(t, scores[3] > scores[1], "Expect linked to URL to score higher")
+	assert.InDelta(t, scores[1], scores[4], 1e-4, "Expect unlinked URLs to score equally")
+}
+
+func TestLinkGraphInDegree(t *testing.T) {
+	g := NewLinkGraph()
+	g.AddLink(1, 3)
+	g.AddLink(2, 3)
+	g.AddLink(2, 3)
+	g.AddLink(3, 1)
+
+	scores, err := g.Score(LinkScoreInDegree)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, 2.0, scores[3], "Expect distinct refers counted")
+	assert.Equal(t, 1.0, scores[1], "Expect single refer counted")
+	assert.Equal(t, 0.0, scores[2], "Expect no refers")
+
+	_, err = g.Score("unknown")
+	assert.NotNil(t, err, "Expect unknown algorithm to fail")
+}
+
+func TestJobResultsWithScores(t *testing.T) {
+	results := JobResults{"http://example.com": []string{"http://example.com/a", "http://example.com/b"}}
+	scored := results.WithScores(map[string]float64{"http://example.com/a": 0.5})
+
+	require.Len(t, scored["http://example.com"], 2, "Expect all results")
+	require.NotNil(t, scored["http://example.com"][0].Score, "Expect scored URL")
+	assert.Equal(t, 0.5, *scored["http://example.com"][0].Score, "Expect score to match")
+	assert.Nil(t, scored["http://example.com"][1].Score, "Expect unscored URL")
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Number of bytes of content sniffed for its content type.
+const SniffLen = 512
+
+// Content types sniffed from content which doesn't identify a specific type,
+// so never mismatch the declared content type.
+var genericMimes = map[string]bool{
+	"text/plain":               true,
+	"application/octet-stream": true,
+}
+
+// Returns the content type (mime) sniffed from the start of the content,
+// without parameters, using the algorithm browsers use, e.g: text/html, or
+// image/png. Content starting with a JSON object or array is sniffed as
+// application/json. Only the first SniffLen bytes are considered.
+func SniffMime(content []byte) string {
+	if len(content) > SniffLen {
+		content = content[:SniffLen]
+	}
+	mime := http.DetectContentType(content)
+	if i := strings.Index(mime, ";"); i >= 0 {
+		mime = mime[:i]
+	}
+
+	if mime == "text/plain" {
+		trimmed := bytes.TrimLeft(content, " \t\r\n\ufeff")
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			return "application/json"
+		}
+	}
+	return mime
+}
+
+// Returns true if the content type sniffed from a response's content doesn't
+// match the content type the response declared, e.g: a PNG image declared as
+// text/html. Sniffed types which don't identify specific content, text/plain,
+// and application/octet-stream, never mismatch. HTML, and XML are treated as
+// the same kind of content, because XHTML sniffs as XML, and feeds often sniff
+// as HTML.
+func MimeMismatched(declared, sniffed string) bool {
+	if sniffed == "" || genericMimes[sniffed] {
+		return false
+	}
+	return mimeKind(strings.ToLower(declared)) != mimeKind(sniffed)
+}
+
+// Returns the kind of content of the content type, which content types that
+// are handled the same way share.
+func mimeKind(mime string) string {
+	switch {
+	case mime == "text/html", mime == "application/xhtml+xml",
+		mime == "text/xml", mime == "application/xml", strings.HasSuffix(mime, "+xml"):
+		return "markup"
+	case mime == "application/json", mime == "text/json", strings.HasSuffix(mime, "+json"):
+		return "json"
+	case strings.HasPrefix(mime, "image/"), strings.HasPrefix(mime, "audio/"), strings.HasPrefix(mime, "video/"):
+		return mime[:strings.Index(mime, "/")]
+	}
+	return mime
+}
+
+// URL of a job whose response declared a content type which didn't match the
+// content type sniffed from its content.
+type MimeMismatch struct {
+	// URL of the response
+	URL string `json:"url"`
+
+	// Content type of the response's Content-Type header, and the content
+	// type sniffed from its content, which the response was scraped as.
+	Declared string `json:"declared"`
+	Sniffed  string `json:"sniffed"`
+
+	// When the mismatch was detected
+	DetectedOn time.Time `json:"detectedOn"`
+}
+
+// Report of a job's URLs whose content didn't match their declared content
+// type.
+type MimeMismatchReport struct {
+	// Mismatched URLs, ordered by URL.
+	URLs []MimeMismatch `json:"urls"`
+}
@@ -0,0 +1,55 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestSniffMime(t *testing.T) {
+	cases := map[string]string{
+		"<!DOCTYPE html><html><body>hi</body></html>": "text/html",
+		"<?xml version=\"1.0\"?><rss></rss>":          "text/xml",
+		"%PDF-1.4\n":                                  "application/pdf",
+		"\x89PNG\r\n\x1a\n\x00\x00":                   "image/png",
+		"  {\"a\": 1}":                                "application/json",
+		"[1, 2]":                                      "application/json",
+		"plain words":                                 "text/plain",
+		"":                                            "text/plain",
+	}
+	for content, expect := range cases {
+		assert.Equal(t, expect, SniffMime([]byte(content)), "Expect sniffed mime of %q", content)
+	}
+
+	// Only the start of the content is sniffed.
+	long := strings.Repeat(" ", SniffLen) + "<html>"
+	assert.Equal(t, "text/plain", SniffMime([]byte(long)), "Expect content past the sniff length ignored")
+}
+
+func TestMimeMismatched(t *testing.T) {
+	mismatched := []struct{ declared, sniffed string }{
+		{"text/html", "image/png"},
+		{"application/json", "text/html"},
+		{"application/octet-stream", "text/html"},
+		{"text/plain", "application/json"},
+		{"image/jpeg", "application/pdf"},
+	}
+	for _, c := range mismatched {
+		assert.True(t, MimeMismatched(c.declared, c.sniffed), "Expect %s sniffed as %s mismatched", c.declared, c.sniffed)
+	}
+
+	matched := []struct{ declared, sniffed string }{
+		{"text/html", "text/html"},
+		{"TEXT/HTML", "text/html"},
+		{"application/xhtml+xml", "text/xml"},
+		{"application/rss+xml", "text/html"},
+		{"application/vnd.api+json", "application/json"},
+		{"image/jpeg", "image/png"},
+		{"text/html", "text/plain"},
+		{"application/pdf", "application/octet-stream"},
+		{"text/html", ""},
+	}
+	for _, c := range matched {
+		assert.False(t, MimeMismatched(c.declared, c.sniffed), "Expect %s sniffed as %s matched", c.declared, c.sniffed)
+	}
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Report comparing the URLs listed in a site's sitemaps with the URLs
+// reachable by crawling a job.
+type OrphanReport struct {
+	// Sitemaps the job's URLs were compared against
+	Sitemaps []string `json:"sitemaps"`
+
+	// URLs listed in the sitemaps, but not linked to by any crawled page.
+	Orphaned []string `json:"orphaned"`
+
+	// HTML pages linked to by crawled pages, but not listed in the sitemaps.
+	// Only pages on hosts covered by the sitemaps are included.
+	Uncharted []string `json:"uncharted"`
+}
+
+// Generates the orphan report comparing the sitemap URLs with the job's linked
+// URLs. The linked URLs map is keyed by URL with the URL's mime type as the value.
+// URLs are compared ignoring fragments, and the case of the host.
+func NewOrphanReport(sitemaps, sitemapURLs []string, linked map[string]string) *OrphanReport {
+	report := &OrphanReport{
+		Sitemaps:  sitemaps,
+		Orphaned:  []string{},
+		Uncharted: []string{},
+	}
+
+	inSitemap := make(map[string]struct{})
+	hosts := make(map[string]struct{})
+	for _, u := range sitemapURLs {
+		norm, host := normalizeReportURL(u)
+		inSitemap[norm] = struct{}{}
+		hosts[host] = struct{}{}
+	}
+
+	isLinked := make(map[string]struct{})
+	for u, mime := range linked {
+		norm, host := normalizeReportURL(u)
+		isLinked[norm] = struct{}{}
+
+		if _, ok := hosts[host]; !ok || mime != "text/html" {
+			continue
+		}
+		if _, ok := inSitemap[norm]; !ok {
+			report.Uncharted = append(report.Uncharted, u)
+		}
+	}
+
+	for _, u := range sitemapURLs {
+		norm, _ := normalizeReportURL(u)
+		if _, ok := isLinked[norm]; !ok {
+			report.Orphaned = append(report.Orphaned, u)
+			// Prevent duplicate sitemap entries being reported multiple times
+			isLinked[norm] = struct{}{}
+		}
+	}
+
+	sort.Strings(report.Orphaned)
+	sort.Strings(report.Uncharted)
+
+	return report
+}
+
+// Normalizes the URL for comparison, returning it and its host. An empty
+// path is treated as '/'. If the URL cannot be parsed it is returned as is.
+func normalizeReportURL(u string) (string, string) {
+	parsed, err := url.Parse(strings.TrimSpace(u))
+	if err != nil {
+		return u, ""
+	}
+	parsed.Fragment = ""
+	parsed.Host = strings.ToLower(parsed.Host)
+	if parsed.Path == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String(), parsed.Host
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewOrphanReport(t *testing.T) {
+	sitemapURLs := []string{
+		"http://www.example.com",
+		"http://www.example.com/about",
+		"http://www.example.com/orphan",
+	}
+	linked := map[string]string{
+		"http://WWW.example.com/":          "text/html",
+		"http://www.example.com/about#top": "text/html",
+		"http://www.example.com/hidden":    "text/html",
+		"http://www.example.com/logo.png":  "image/png",
+		"http://www.google.com/":           "text/html",
+	}
+
+	report := NewOrphanReport([]string{"http://www.example.com/sitemap.xml"}, sitemapURLs, linked)
+	assert.Equal(t, []string{"http://www.example.com/sitemap.xml"}, report.Sitemaps, "Expect sitemaps to match")
+	assert.Equal(t, []string{"http://www.example.com/orphan"}, report.Orphaned, "Expect orphaned URLs to match")
+	assert.Equal(t, []string{"http://www.example.com/hidden"}, report.Uncharted, "Expect uncharted URLs to match")
+}
@@ -0,0 +1,58 @@
+package common
+
+import "sort"
+
+// Maximum number of redirects followed when resolving a URL's final URL.
+// Chains longer than the limit are treated as loops.
+const MaxRedirectHops = 20
+
+// Redirect of a URL to the final URL its chain of redirects ends at.
+type RedirectMapping struct {
+	// URL which redirects
+	From string `json:"from"`
+
+	// URL the chain of redirects ends at
+	To string `json:"to"`
+
+	// Number of redirects in the chain
+	Hops int `json:"hops"`
+}
+
+// Resolves the redirect edges into a map of each redirecting URL to its final
+// URL. Only the first edge of a URL is followed, so edges are expected to be
+// ordered by preference. URLs whose chain loops, or ends back at the URL, are
+// not included. The mappings are sorted by the redirecting URL.
+func NewRedirectMap(edges []RedirectEdge) []RedirectMapping {
+	next := make(map[string]string)
+	for _, e := range edges {
+		if _, ok := next[e.From]; !ok {
+			next[e.From] = e.To
+		}
+	}
+
+	mappings := []RedirectMapping{}
+	for from, to := range next {
+		hops := 1
+		visited := map[string]struct{}{from: struct{}{}}
+		for hops <= MaxRedirectHops {
+			if _, ok := visited[to]; ok {
+				break
+			}
+			n, ok := next[to]
+			if !ok {
+				break
+			}
+			visited[to] = struct{}{}
+			to = n
+			hops++
+		}
+		if _, loops := visited[to]; loops || hops > MaxRedirectHops {
+			continue
+		}
+
+		mappings = append(mappings, RedirectMapping{From: from, To: to, Hops: hops})
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].From < mappings[j].From })
+
+	return mappings
+}
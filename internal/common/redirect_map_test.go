@@ -0,0 +1,33 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewRedirectMap(t *testing.T) {
+	edges := []RedirectEdge{
+		{From: "http://example.com/a", To: "http://example.com/b", Kind: "meta-refresh"},
+		{From: "http://example.com/a", To: "http://example.com/ignored", Kind: "javascript"},
+		{From: "http://example.com/b", To: "http://example.com/c", Kind: "javascript"},
+		{From: "http://example.com/loop1", To: "http://example.com/loop2", Kind: "meta-refresh"},
+		{From: "http://example.com/loop2", To: "http://example.com/loop1", Kind: "meta-refresh"},
+		{From: "http://example.com/self", To: "http://example.com/self", Kind: "meta-refresh"},
+	}
+
+	assert.Equal(t, []RedirectMapping{
+		{From: "http://example.com/a", To: "http://example.com/c", Hops: 2},
+		{From: "http://example.com/b", To: "http://example.com/c", Hops: 1},
+	}, NewRedirectMap(edges), "Expect chains resolved to their final URL, without loops")
+}
+
+func TestNewRedirectMapLongChain(t *testing.T) {
+	edges := []RedirectEdge{}
+	for i := 0; i <= MaxRedirectHops; i++ {
+		edges = append(edges, RedirectEdge{From: string(rune('a' + i)), To: string(rune('a' + i + 1))})
+	}
+
+	m := NewRedirectMap(edges)
+	assert.Len(t, m, MaxRedirectHops, "Expect chain longer than the limit excluded")
+	assert.Equal(t, RedirectMapping{From: "b", To: string(rune('a' + MaxRedirectHops + 1)), Hops: MaxRedirectHops}, m[0], "Expect longest chain within limit")
+}
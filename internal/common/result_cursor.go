@@ -0,0 +1,68 @@
+package common
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// Position in a job's results a page of results continues from. Results are
+// paged in the order of their refer URL id, then URL id.
+type ResultCursor struct {
+	JobId JobId
+
+	// Ids of the refer URL, and URL of the last result of the previous page
+	ReferId URLId
+	URLId   URLId
+}
+
+// Returns the cursor as an opaque token, to be returned by clients to
+// request the next page of results.
+func (c ResultCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%d", c.JobId, c.ReferId, c.URLId)))
+}
+
+// Parses the token of the job's result cursor. An error is returned if the
+// token is invalid, or is the cursor of another job's results.
+func ParseResultCursor(id JobId, token string) (ResultCursor, error) {
+	c := ResultCursor{}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, fmt.Errorf("Invalid cursor: %s", token)
+	}
+	var extra string
+	if n, _ := fmt.Sscanf(string(b), "%d:%d:%d%s", &c.JobId, &c.ReferId, &c.URLId, &extra); n != 3 {
+		return c, fmt.Errorf("Invalid cursor: %s", token)
+	}
+	if c.JobId != id {
+		return c, fmt.Errorf("Invalid cursor: %s, not a cursor of job %d's results", token, id)
+	}
+	return c, nil
+}
+
+// Position in a list of URLs a page of URLs continues from. URLs are paged in
+// the order of their id.
+type URLCursor struct {
+	// Id of the last URL of the previous page
+	URLId URLId
+}
+
+// Returns the cursor as an opaque token, to be returned by clients to
+// request the next page of URLs.
+func (c URLCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("url:%d", c.URLId)))
+}
+
+// Parses the token of a URL cursor. An error is returned if the token is
+// invalid.
+func ParseURLCursor(token string) (URLCursor, error) {
+	c := URLCursor{}
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, fmt.Errorf("Invalid cursor: %s", token)
+	}
+	var extra string
+	if n, _ := fmt.Sscanf(string(b), "url:%d%s", &c.URLId, &extra); n != 1 {
+		return c, fmt.Errorf("Invalid cursor: %s", token)
+	}
+	return c, nil
+}
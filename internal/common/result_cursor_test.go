@@ -0,0 +1,37 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestResultCursor(t *testing.T) {
+	c := ResultCursor{JobId: 12, ReferId: 34, URLId: 56}
+	token := c.String()
+	assert.NotContains(t, token, "34", "Expect opaque token")
+
+	parsed, err := ParseResultCursor(12, token)
+	require.NoError(t, err, "Expect token parsed")
+	assert.Equal(t, c, parsed, "Expect cursor of token")
+
+	_, err = ParseResultCursor(13, token)
+	assert.Error(t, err, "Expect cursor of another job rejected")
+
+	for _, token := range []string{"", "!!", ResultCursor{}.String()[:2], "MTI6MzQ6NTY6Nzg"} {
+		_, err := ParseResultCursor(12, token)
+		assert.Error(t, err, token)
+	}
+}
+
+func TestURLCursor(t *testing.T) {
+	c := URLCursor{URLId: 56}
+	parsed, err := ParseURLCursor(c.String())
+	require.NoError(t, err, "Expect token parsed")
+	assert.Equal(t, c, parsed, "Expect cursor of token")
+
+	for _, token := range []string{"", "!!", ResultCursor{JobId: 1}.String(), "dXJsOjU2Ojc4"} {
+		_, err := ParseURLCursor(token)
+		assert.Error(t, err, token)
+	}
+}
@@ -0,0 +1,235 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Minimum number of crawled URLs under a directory before it can be
+// suggested to be disallowed for being error-prone.
+const RobotsMinDirectoryURLs = 5
+
+// Fraction of a directory's crawled URLs which must be errors for the
+// directory to be suggested to be disallowed.
+const RobotsErrorRate = 0.5
+
+// Reasons a robots.txt rule is suggested.
+const (
+	// Most of the URLs under the path were errors.
+	RobotsReasonErrors = "errors"
+
+	// URLs differing by the query parameter had the same content.
+	RobotsReasonDuplicateParam = "duplicateParam"
+)
+
+// Crawled URL a robots.txt suggestion is generated from.
+type RobotsCrawledURL struct {
+	// URL which was crawled
+	URL string
+
+	// HTTP status code the URL was crawled with. Zero if the request failed.
+	Status int
+
+	// Hash of the URL's content. Empty if the content wasn't read.
+	ContentHash string
+}
+
+// Suggested robots.txt rules of each host crawled by a job.
+type RobotsSuggestion struct {
+	// Suggestions of each host with at least one rule, sorted by host.
+	Hosts []RobotsHostSuggestion `json:"hosts"`
+}
+
+// Suggested robots.txt rules of a host.
+type RobotsHostSuggestion struct {
+	// Host the robots.txt is suggested for
+	Host string `json:"host"`
+
+	// Rules suggested, sorted by path.
+	Rules []RobotsRule `json:"rules"`
+
+	// robots.txt of the suggested rules, ready to be served.
+	RobotsTxt string `json:"robotsTxt"`
+}
+
+// Suggested robots.txt Disallow rule.
+type RobotsRule struct {
+	// Path pattern to be disallowed
+	Disallow string `json:"disallow"`
+
+	// Reason the rule was suggested, either "errors" or "duplicateParam".
+	Reason string `json:"reason"`
+
+	// Number of crawled URLs the reason applies to, e.g: the number of
+	// errors under the path.
+	URLs int `json:"urls"`
+
+	// Number of crawled URLs matched by the rule.
+	Matched int `json:"matched"`
+}
+
+// Generates the robots.txt suggestion of the crawled URLs. Directories, the
+// first segment of a path, whose URLs were mostly errors are suggested to be
+// disallowed. Query parameters whose values differ between URLs of the same
+// path with the same content are duplicate parameters, and URLs with them are
+// suggested to be disallowed.
+func NewRobotsSuggestion(urls []RobotsCrawledURL) *RobotsSuggestion {
+	type directory struct{ urls, errors int }
+	type variant struct {
+		url   string
+		query url.Values
+	}
+	type host struct {
+		directories map[string]*directory
+
+		// First variant of each path crawled with each content hash.
+		pages map[string]map[string]variant
+
+		// URLs which differed by the parameter with the same content.
+		params map[string]map[string]struct{}
+	}
+
+	hosts := map[string]*host{}
+	for _, u := range urls {
+		parsed, err := url.Parse(u.URL)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+		name := URLHost(u.URL)
+		h, ok := hosts[name]
+		if !ok {
+			h = &host{
+				directories: map[string]*directory{},
+				pages:       map[string]map[string]variant{},
+				params:      map[string]map[string]struct{}{},
+			}
+			hosts[name] = h
+		}
+
+		if dir := robotsDirectory(parsed.EscapedPath()); dir != "" {
+			d, ok := h.directories[dir]
+			if !ok {
+				d = &directory{}
+				h.directories[dir] = d
+			}
+			d.urls++
+			if u.Status == 0 || u.Status >= 400 {
+				d.errors++
+			}
+		}
+
+		if u.ContentHash == "" {
+			continue
+		}
+		variants, ok := h.pages[parsed.EscapedPath()]
+		if !ok {
+			variants = map[string]variant{}
+			h.pages[parsed.EscapedPath()] = variants
+		}
+		v := variant{url: u.URL, query: parsed.Query()}
+		first, ok := variants[u.ContentHash]
+		if !ok {
+			variants[u.ContentHash] = v
+			continue
+		}
+		for _, param := range differingParams(v.query, first.query) {
+			if h.params[param] == nil {
+				h.params[param] = map[string]struct{}{}
+			}
+			h.params[param][v.url] = struct{}{}
+			h.params[param][first.url] = struct{}{}
+		}
+	}
+
+	suggestion := &RobotsSuggestion{Hosts: []RobotsHostSuggestion{}}
+	for name, h := range hosts {
+		rules := []RobotsRule{}
+		for dir, d := range h.directories {
+			if d.urls >= RobotsMinDirectoryURLs && float64(d.errors) >= RobotsErrorRate*float64(d.urls) {
+				rules = append(rules, RobotsRule{Disallow: dir, Reason: RobotsReasonErrors, URLs: d.errors, Matched: d.urls})
+			}
+		}
+		for param, dups := range h.params {
+			rules = append(rules, RobotsRule{
+				Disallow: "/*?*" + url.QueryEscape(param) + "=",
+				Reason:   RobotsReasonDuplicateParam,
+				URLs:     len(dups),
+				Matched:  robotsParamMatches(urls, name, param),
+			})
+		}
+		if len(rules) == 0 {
+			continue
+		}
+
+		sort.Slice(rules, func(i, j int) bool { return rules[i].Disallow < rules[j].Disallow })
+		suggestion.Hosts = append(suggestion.Hosts, RobotsHostSuggestion{
+			Host:      name,
+			Rules:     rules,
+			RobotsTxt: robotsTxt(rules),
+		})
+	}
+	sort.Slice(suggestion.Hosts, func(i, j int) bool { return suggestion.Hosts[i].Host < suggestion.Hosts[j].Host })
+
+	return suggestion
+}
+
+// Returns the first directory of the path, e.g: "/a/" of "/a/b/c". Empty if
+// the path is not within a directory.
+func robotsDirectory(p string) string {
+	i := strings.Index(strings.TrimPrefix(p, "/"), "/")
+	if !strings.HasPrefix(p, "/") || i < 0 {
+		return ""
+	}
+	return p[:i+2]
+}
+
+// Returns the names of the parameters whose values differ between the queries,
+// including parameters only in one of them.
+func differingParams(a, b url.Values) []string {
+	params := []string{}
+	for name, v := range a {
+		if strings.Join(v, "&") != strings.Join(b[name], "&") {
+			params = append(params, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			params = append(params, name)
+		}
+	}
+	return params
+}
+
+// Returns the number of the host's crawled URLs with the query parameter.
+func robotsParamMatches(urls []RobotsCrawledURL, host, param string) int {
+	n := 0
+	for _, u := range urls {
+		parsed, err := url.Parse(u.URL)
+		if err != nil || URLHost(u.URL) != host {
+			continue
+		}
+		if _, ok := parsed.Query()[param]; ok {
+			n++
+		}
+	}
+	return n
+}
+
+// Formats the rules as a robots.txt applying to all user agents.
+func robotsTxt(rules []RobotsRule) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintln(buf, "User-agent: *")
+	for _, r := range rules {
+		switch r.Reason {
+		case RobotsReasonErrors:
+			fmt.Fprintf(buf, "# %d of %d crawled URLs were errors\n", r.URLs, r.Matched)
+		case RobotsReasonDuplicateParam:
+			fmt.Fprintf(buf, "# %d crawled URLs were duplicates differing by the parameter\n", r.URLs)
+		}
+		fmt.Fprintf(buf, "Disallow: %s\n", r.Disallow)
+	}
+	return buf.String()
+}
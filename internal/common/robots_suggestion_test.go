@@ -0,0 +1,46 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewRobotsSuggestion(t *testing.T) {
+	urls := []RobotsCrawledURL{
+		{URL: "http://www.example.com/", Status: 200, ContentHash: "home"},
+		{URL: "http://www.example.com/?sessionid=1", Status: 200, ContentHash: "home"},
+		{URL: "http://www.example.com/?sessionid=2", Status: 200, ContentHash: "home"},
+		{URL: "http://www.example.com/list?page=1", Status: 200, ContentHash: "list1"},
+		{URL: "http://www.example.com/list?page=2", Status: 200, ContentHash: "list2"},
+		{URL: "http://www.example.com/list?page=3&sessionid=3", Status: 200, ContentHash: "list3"},
+		{URL: "http://www.example.com/old/a", Status: 404},
+		{URL: "http://www.example.com/old/b", Status: 404},
+		{URL: "http://www.example.com/old/c", Status: 500},
+		{URL: "http://www.example.com/old/d"},
+		{URL: "http://www.example.com/old/e", Status: 200, ContentHash: "e"},
+		{URL: "http://www.example.com/new/a", Status: 404},
+		{URL: "http://www.example.org/about", Status: 200, ContentHash: "about"},
+	}
+
+	s := NewRobotsSuggestion(urls)
+	require.Len(t, s.Hosts, 1, "Expect only host with rules")
+	assert.Equal(t, "www.example.com", s.Hosts[0].Host, "Expect host")
+	assert.Equal(t, []RobotsRule{
+		{Disallow: "/*?*sessionid=", Reason: RobotsReasonDuplicateParam, URLs: 3, Matched: 3},
+		{Disallow: "/old/", Reason: RobotsReasonErrors, URLs: 4, Matched: 5},
+	}, s.Hosts[0].Rules, "Expect error-prone directory and duplicate parameter disallowed")
+	assert.Equal(t, `User-agent: *
+# 3 crawled URLs were duplicates differing by the parameter
+Disallow: /*?*sessionid=
+# 4 of 5 crawled URLs were errors
+Disallow: /old/
+`, s.Hosts[0].RobotsTxt, "Expect robots.txt of rules")
+}
+
+func TestRobotsDirectory(t *testing.T) {
+	assert.Equal(t, "/a/", robotsDirectory("/a/b/c"), "Expect first directory")
+	assert.Equal(t, "/a/", robotsDirectory("/a/"), "Expect directory")
+	assert.Equal(t, "", robotsDirectory("/a"), "Expect no directory of root file")
+	assert.Equal(t, "", robotsDirectory("/"), "Expect no directory of root")
+}
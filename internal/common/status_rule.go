@@ -0,0 +1,150 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions a job takes for the responses of the statuses matched by its
+// status rules.
+const (
+	// The response is scraped, added to the job's results, and its links
+	// are followed. The action of statuses without a rule.
+	StatusActionFollow = "follow"
+
+	// The response is scraped, and added to the job's results, but its
+	// links are not followed.
+	StatusActionRecord = "record"
+
+	// The response is not scraped, or added to the job's results.
+	StatusActionFail = "fail"
+
+	// The URL is requested again after a delay, up to the rule's number of
+	// retries. A response still matching the rule after the last retry is
+	// failed.
+	StatusActionRetry = "retry"
+)
+
+// Retries of a retry rule if not set, and the most a rule may retry.
+const (
+	DefaultStatusRetries = 3
+	MaxStatusRetries     = 10
+)
+
+// Longest delay a retry rule may wait before retrying a URL.
+const MaxStatusRetryDelay = time.Hour
+
+// Rule of how a job handles the responses of a status code, or class of
+// status codes, instead of following them.
+type JobStatusRule struct {
+	// Status code, e.g: "403", or class of status codes, e.g: "4xx"
+	Status string `json:"status"`
+
+	// One of the StatusAction constants
+	Action string `json:"action"`
+
+	// Delay before retrying the URL. Zero waits for the response's
+	// Retry-After header. Retry rules only.
+	RetryDelay time.Duration `json:"retryDelay,omitempty"`
+
+	// Number of times the URL is retried. Retry rules only.
+	Retries int `json:"retries,omitempty"`
+}
+
+// Parses the rule from its status:action[:delay[:retries]] form, e.g: 403:fail,
+// or 420:retry:60s:5. Only retry rules may have a delay, and number of retries.
+// An error is returned if the status is not a status code or class, the action
+// is unknown, or the delay or retries are out of range.
+func ParseJobStatusRule(s string) (JobStatusRule, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 4 {
+		return JobStatusRule{}, fmt.Errorf("status rule must be in the form status:action[:delay[:retries]]")
+	}
+
+	rule := JobStatusRule{Status: strings.ToLower(parts[0]), Action: strings.ToLower(parts[1])}
+	if !validRuleStatus(rule.Status) {
+		return JobStatusRule{}, fmt.Errorf("status %s must be a status code, e.g: 404, or class, e.g: 4xx", parts[0])
+	}
+
+	switch rule.Action {
+	case StatusActionFollow, StatusActionRecord, StatusActionFail:
+		if len(parts) > 2 {
+			return JobStatusRule{}, fmt.Errorf("only retry rules have a delay, and retries")
+		}
+		return rule, nil
+	case StatusActionRetry:
+	default:
+		return JobStatusRule{}, fmt.Errorf("unknown status action %s", parts[1])
+	}
+
+	rule.Retries = DefaultStatusRetries
+	if len(parts) > 2 && parts[2] != "" {
+		delay, err := time.ParseDuration(parts[2])
+		if err != nil || delay <= 0 || delay > MaxStatusRetryDelay {
+			return JobStatusRule{}, fmt.Errorf("retry delay %s must be a duration up to %s", parts[2], MaxStatusRetryDelay)
+		}
+		rule.RetryDelay = delay
+	}
+	if len(parts) > 3 {
+		retries, err := strconv.Atoi(parts[3])
+		if err != nil || retries <= 0 || retries > MaxStatusRetries {
+			return JobStatusRule{}, fmt.Errorf("retries %s must be 1 to %d", parts[3], MaxStatusRetries)
+		}
+		rule.Retries = retries
+	}
+	return rule, nil
+}
+
+// Returns the rule in its status:action[:delay[:retries]] form.
+func (r JobStatusRule) String() string {
+	if r.Action != StatusActionRetry {
+		return r.Status + ":" + r.Action
+	}
+	var delay string
+	if r.RetryDelay > 0 {
+		delay = r.RetryDelay.String()
+	}
+	return fmt.Sprintf("%s:%s:%s:%d", r.Status, r.Action, delay, r.Retries)
+}
+
+// Returns if the rule matches the status code. Class rules match any status
+// code of the class.
+func (r JobStatusRule) Matches(status int) bool {
+	code := strconv.Itoa(status)
+	if len(r.Status) == 3 && strings.HasSuffix(r.Status, "xx") {
+		return len(code) == 3 && code[0] == r.Status[0]
+	}
+	return code == r.Status
+}
+
+// Returns the rule of the status code, false if none match. Rules of the
+// status code take precedence over rules of its class.
+func MatchJobStatusRule(rules []JobStatusRule, status int) (JobStatusRule, bool) {
+	var class *JobStatusRule
+	for i, r := range rules {
+		if !r.Matches(status) {
+			continue
+		}
+		if !strings.HasSuffix(r.Status, "xx") {
+			return r, true
+		} else if class == nil {
+			class = &rules[i]
+		}
+	}
+	if class != nil {
+		return *class, true
+	}
+	return JobStatusRule{}, false
+}
+
+// Returns if the status is a status code, 100 to 599, or a class of status
+// codes, 1xx to 5xx.
+func validRuleStatus(status string) bool {
+	if len(status) == 3 && strings.HasSuffix(status, "xx") {
+		return status[0] >= '1' && status[0] <= '5'
+	}
+	code, err := strconv.Atoi(status)
+	return err == nil && len(status) == 3 && code >= 100 && code <= 599
+}
@@ -0,0 +1,64 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseJobStatusRule(t *testing.T) {
+	cases := []struct {
+		in   string
+		rule JobStatusRule
+	}{
+		{"403:fail", JobStatusRule{Status: "403", Action: StatusActionFail}},
+		{"4XX:Record", JobStatusRule{Status: "4xx", Action: StatusActionRecord}},
+		{"301:follow", JobStatusRule{Status: "301", Action: StatusActionFollow}},
+		{"420:retry:60s", JobStatusRule{Status: "420", Action: StatusActionRetry, RetryDelay: time.Minute, Retries: DefaultStatusRetries}},
+		{"5xx:retry::5", JobStatusRule{Status: "5xx", Action: StatusActionRetry, Retries: 5}},
+		{"503:retry", JobStatusRule{Status: "503", Action: StatusActionRetry, Retries: DefaultStatusRetries}},
+	}
+	for _, c := range cases {
+		rule, err := ParseJobStatusRule(c.in)
+		require.NoError(t, err, c.in)
+		assert.Equal(t, c.rule, rule, c.in)
+
+		again, err := ParseJobStatusRule(rule.String())
+		require.NoError(t, err, rule.String())
+		assert.Equal(t, rule, again, "Expect %s round tripped", rule)
+	}
+
+	for _, in := range []string{"403", "403:ignore", "99:fail", "600:fail", "6xx:fail", "40x:fail", "0403:fail",
+		"403:fail:10s", "420:retry:soon", "420:retry:2h", "420:retry:-1s", "420:retry:1s:0", "420:retry:1s:11", "420:retry:1s:1:1"} {
+		_, err := ParseJobStatusRule(in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestMatchJobStatusRule(t *testing.T) {
+	rules := []JobStatusRule{
+		{Status: "4xx", Action: StatusActionRecord},
+		{Status: "403", Action: StatusActionFail},
+		{Status: "5xx", Action: StatusActionRetry},
+	}
+
+	cases := []struct {
+		status int
+		action string
+	}{
+		{403, StatusActionFail},
+		{404, StatusActionRecord},
+		{503, StatusActionRetry},
+	}
+	for _, c := range cases {
+		rule, ok := MatchJobStatusRule(rules, c.status)
+		require.True(t, ok, "Expect %d matched", c.status)
+		assert.Equal(t, c.action, rule.Action, "Expect %d %s", c.status, c.action)
+	}
+
+	_, ok := MatchJobStatusRule(rules, 200)
+	assert.False(t, ok, "Expect status without rule not matched")
+	_, ok = MatchJobStatusRule(nil, 404)
+	assert.False(t, ok, "Expect no rules not matched")
+}
@@ -0,0 +1,150 @@
+package common
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Approximate number of characters of a word per token, of the subword
+// tokenizers used by embedding models and LLMs for English text.
+const CharsPerToken = 4
+
+// Segment of a text, with the approximate number of tokens it is.
+type TextChunk struct {
+	Text   string `json:"text"`
+	Tokens int    `json:"tokens"`
+}
+
+// Word, punctuation mark, or symbol of a text, by its byte offsets.
+type textPiece struct {
+	start, end int
+	tokens     int
+}
+
+// Returns the approximate number of tokens the text is. Words are counted as
+// a token per CharsPerToken characters, and each punctuation mark, symbol, and
+// CJK character as a token. The count is deterministic, and close to, but not
+// the same as, the counts of model specific tokenizers.
+func CountTokens(text string) int {
+	tokens := 0
+	for _, p := range textPieces(text) {
+		tokens += p.tokens
+	}
+	return tokens
+}
+
+// Splits the text into chunks of at most size tokens, counted the same as
+// CountTokens, with each chunk repeating up to overlap tokens of the end of
+// the chunk before it, so context isn't lost at the chunks' boundaries.
+// Chunks end at a paragraph or sentence end if one is in the chunk's second
+// half. Words longer than the size are a chunk of their own. Chunks are
+// segments of the text as is, without leading or trailing white space. The
+// overlap is limited to less than the size. No chunks are returned for text
+// without any words.
+func ChunkText(text string, size, overlap int) []TextChunk {
+	if size < 1 {
+		size = 1
+	}
+	if overlap >= size {
+		overlap = size - 1
+	}
+	if overlap < 0 {
+		overlap = 0
+	}
+
+	pieces := textPieces(text)
+	chunks := []TextChunk{}
+	for start := 0; start < len(pieces); {
+		end, tokens := start, 0
+		brk, brkTokens := -1, 0
+		for end < len(pieces) && (end == start || tokens+pieces[end].tokens <= size) {
+			tokens += pieces[end].tokens
+			end++
+			if end < len(pieces) && isTextBreak(text, pieces[end-1], pieces[end]) {
+				brk, brkTokens = end, tokens
+			}
+		}
+		if end < len(pieces) && brk > start && brkTokens*2 >= size {
+			end, tokens = brk, brkTokens
+		}
+
+		chunks = append(chunks, TextChunk{
+			Text:   text[pieces[start].start:pieces[end-1].end],
+			Tokens: tokens,
+		})
+		if end == len(pieces) {
+			break
+		}
+
+		// The next chunk starts with as many of the chunk's last pieces as
+		// fit in the overlap, always moving past the chunk's start.
+		next, over := end, 0
+		for next > start+1 && over+pieces[next-1].tokens <= overlap {
+			next--
+			over += pieces[next].tokens
+		}
+		start = next
+	}
+	return chunks
+}
+
+// Returns true if the text between the two pieces is a paragraph, or
+// sentence break.
+func isTextBreak(text string, prev, next textPiece) bool {
+	gap := text[prev.end:next.start]
+	if gap == "" {
+		return false
+	}
+	if strings.Contains(gap, "\n") {
+		return true
+	}
+	switch text[prev.start:prev.end] {
+	case ".", "!", "?":
+		return true
+	}
+	return false
+}
+
+// Splits the text into its words, punctuation marks, and symbols, with the
+// approximate number of tokens of each. White space separates the pieces, and
+// is not counted.
+func textPieces(text string) []textPiece {
+	pieces := []textPiece{}
+	wordStart, wordLen := -1, 0
+	endWord := func(end int) {
+		if wordStart >= 0 {
+			pieces = append(pieces, textPiece{
+				start:  wordStart,
+				end:    end,
+				tokens: (wordLen + CharsPerToken - 1) / CharsPerToken,
+			})
+		}
+		wordStart, wordLen = -1, 0
+	}
+
+	for i, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			endWord(i)
+		case isCJK(r):
+			endWord(i)
+			pieces = append(pieces, textPiece{start: i, end: i + len(string(r)), tokens: 1})
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.IsMark(r):
+			if wordStart < 0 {
+				wordStart = i
+			}
+			wordLen++
+		default:
+			endWord(i)
+			pieces = append(pieces, textPiece{start: i, end: i + len(string(r)), tokens: 1})
+		}
+	}
+	endWord(len(text))
+	return pieces
+}
+
+// Returns true if the rune is a Chinese, Japanese, or Korean character, which
+// are written without spaces between words.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
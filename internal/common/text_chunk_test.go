@@ -0,0 +1,79 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestCountTokens(t *testing.T) {
+	assert.Equal(t, 0, CountTokens(""), "Expect no tokens for empty text")
+	assert.Equal(t, 0, CountTokens(" \n\t "), "Expect white space not counted")
+	assert.Equal(t, 3, CountTokens("the cat sat"), "Expect short words counted as a token each")
+	assert.Equal(t, 5, CountTokens("internationalization"), "Expect long words counted per characters")
+	assert.Equal(t, 7, CountTokens("Hello, world! ok"), "Expect punctuation counted as a token each")
+	assert.Equal(t, 4, CountTokens("日本語 a"), "Expect CJK characters counted as a token each")
+}
+
+func TestChunkText(t *testing.T) {
+	text := "one two six ten red big hot dog"
+
+	chunks := ChunkText(text, 3, 1)
+	assert.Equal(t, []TextChunk{
+		{Text: "one two six", Tokens: 3},
+		{Text: "six ten red", Tokens: 3},
+		{Text: "red big hot", Tokens: 3},
+		{Text: "hot dog", Tokens: 2},
+	}, chunks, "Expect chunks overlapping by a token")
+
+	assert.Equal(t, []TextChunk{
+		{Text: "one two six ten", Tokens: 4},
+		{Text: "red big hot dog", Tokens: 4},
+	}, ChunkText(text, 4, 0), "Expect chunks without overlap")
+
+	assert.Equal(t, []TextChunk{{Text: text, Tokens: 8}}, ChunkText(text, 100, 10),
+		"Expect a single chunk for text within the size")
+	assert.Empty(t, ChunkText(" \n ", 10, 2), "Expect no chunks without words")
+}
+
+func TestChunkTextBreaks(t *testing.T) {
+	text := "First sentence here. Second one is longer than that.\n\nNew paragraph starts"
+
+	chunks := ChunkText(text, 10, 0)
+	assert.Equal(t, []string{
+		"First sentence here.",
+		"Second one is longer than that.",
+		"New paragraph starts",
+	}, chunkTexts(chunks), "Expect chunks to end at sentences, and paragraphs")
+
+	chunks = ChunkText("Hi. aa bb cc dd ee ff", 6, 0)
+	assert.Equal(t, []string{"Hi. aa bb cc dd", "ee ff"}, chunkTexts(chunks), "Expect no break in the chunk's first half")
+}
+
+func TestChunkTextLongWord(t *testing.T) {
+	long := strings.Repeat("a", 40)
+
+	chunks := ChunkText("x "+long+" y", 5, 4)
+	assert.Equal(t, []TextChunk{
+		{Text: "x", Tokens: 1},
+		{Text: long, Tokens: 10},
+		{Text: "y", Tokens: 1},
+	}, chunks, "Expect long words a chunk of their own")
+}
+
+func TestChunkTextOverlapLimited(t *testing.T) {
+	chunks := ChunkText("a b c d", 2, 5)
+	assert.Equal(t, []TextChunk{
+		{Text: "a b", Tokens: 2},
+		{Text: "b c", Tokens: 2},
+		{Text: "c d", Tokens: 2},
+	}, chunks, "Expect overlap limited to less than the size")
+}
+
+func chunkTexts(chunks []TextChunk) []string {
+	texts := []string{}
+	for _, c := range chunks {
+		texts = append(texts, c.Text)
+	}
+	return texts
+}
@@ -48,12 +48,189 @@ type JobStatus struct {
 	// Mapping of individual URL status.  A true for a URL means that
 	// it has been processed, and only the false, URLs are pending.
 	URLs map[string]bool
+
+	// If the job's stored HTML, and cached fetch bodies have been
+	// tiered into the cold store.
+	Archived bool
+
+	// If the job is paused, and its pending URLs are not being crawled.
+	Paused bool
+
+	// If the job was cancelled, and its pending URLs were dropped.
+	Cancelled bool
+
+	// If the job is waiting for a running job slot before it is crawled.
+	Waiting bool
+
+	// Hours of the day the job's URLs are allowed to be crawled. Nil if the
+	// job can be crawled at any time.
+	CrawlWindow *CrawlWindow
+}
+
+// Summary of a job's progress, used when listing jobs.
+type JobSummary struct {
+	// Job unique identifier.
+	Id JobId `json:"id"`
+
+	// The time stamp the job was created on.
+	CreatedOn time.Time `json:"createdOn"`
+
+	// Number of completed, and pending Job URLs.
+	Completed int `json:"completed"`
+	Pending   int `json:"pending"`
+
+	// If the job's bodies have been tiered into the cold store.
+	Archived bool `json:"archived"`
+
+	// If the job is paused.
+	Paused bool `json:"paused"`
+
+	// If the job was cancelled.
+	Cancelled bool `json:"cancelled"`
+
+	// State of the job, one of the JobStatus constants.
+	Status string `json:"status"`
+
+	// Tags the job was scheduled with, ordered by tag.
+	Tags []string `json:"tags"`
+}
+
+// Active job whose seed URLs overlap the seed URLs of a job being scheduled.
+type JobOverlap struct {
+	// Id of the active job.
+	JobId JobId `json:"jobId"`
+
+	// Number of the scheduled job's seed URLs which are seeds of the active
+	// job, and the number of seed URLs of the active job.
+	Overlapping int `json:"overlapping"`
+	Seeds       int `json:"seeds"`
+}
+
+// States of a job, as summarized in job lists
+const (
+	// The job has pending URLs being crawled
+	JobStatusRunning = "running"
+
+	// The job has pending URLs, but is waiting for a running job slot
+	// before they are crawled
+	JobStatusWaiting = "waiting"
+
+	// All of the job's URLs have been crawled
+	JobStatusCompleted = "completed"
+
+	// The job is paused, and its pending URLs are not being crawled
+	JobStatusPaused = "paused"
+
+	// The job was cancelled, and its pending URLs were dropped
+	JobStatusCancelled = "cancelled"
+)
+
+// Returns if the status is one of the JobStatus constants.
+func ValidJobStatus(status string) bool {
+	switch status {
+	case JobStatusRunning, JobStatusWaiting, JobStatusCompleted, JobStatusPaused, JobStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Group Id, used for identifying named groups of jobs submitted together.
+type GroupId int64
+
+// satisfies the stringer interface
+func (id GroupId) String() string {
+	return fmt.Sprintf("%d", id)
+}
+
+// Named group of jobs submitted together.
+type JobGroup struct {
+	Id GroupId
+
+	Name string
+
+	// URL notified once all of the group's jobs complete, empty if none
+	Webhook string
+
+	CreatedOn time.Time
+
+	// When all of the group's jobs were scheduled, zero until then
+	ScheduledOn time.Time
+
+	// When the group's jobs were all completed, zero until then
+	CompletedOn time.Time
+}
+
+// Status of a job group, aggregated from the status of its jobs. Also the
+// payload posted to the group's webhook once all of its jobs complete.
+type JobGroupStatus struct {
+	Id   GroupId `json:"groupId"`
+	Name string  `json:"name"`
+
+	CreatedOn time.Time `json:"createdOn"`
+
+	// If all of the group's jobs are complete
+	Complete bool `json:"complete"`
+
+	// Number of the group's jobs which are complete, and pending.
+	CompletedJobs int `json:"completedJobs"`
+	PendingJobs   int `json:"pendingJobs"`
+
+	// Number of completed, and pending Job URLs of all the group's jobs.
+	CompletedURLs int `json:"completedURLs"`
+	PendingURLs   int `json:"pendingURLs"`
+
+	// Summaries of the group's jobs, ordered by id
+	Jobs []JobSummary `json:"jobs"`
 }
 
 // Result map for a Job.  The map contains a mapping between refer URL and a list
 // of all direct descendant URL which are linked on the refer URL's page.
 type JobResults map[string][]string
 
+// Result URL with its internal link authority score.
+type ScoredURL struct {
+	// Result URL
+	URL string `json:"url"`
+
+	// Internal link authority score of the URL. Nil if the URL has not been scored.
+	Score *float64 `json:"score"`
+}
+
+// Result map for a Job including link scores. Same as JobResults, but each
+// result URL includes its link authority score.
+type JobScoredResults map[string][]ScoredURL
+
+// Result URL of a job, with the refer URL it was found on, and the state it
+// was crawled in.
+type JobResultRow struct {
+	URL   string `json:"url"`
+	Refer string `json:"refer"`
+
+	// HTTP status code the URL was crawled with. Zero if not crawled.
+	Status int `json:"status"`
+
+	Mime string `json:"mime"`
+
+	// Time the URL was last crawled. Zero if not crawled.
+	CrawledOn time.Time `json:"crawledOn"`
+}
+
+// Combines the job results with the link scores mapped by URL.
+func (r JobResults) WithScores(scores map[string]float64) JobScoredResults {
+	scored := make(JobScoredResults, len(r))
+	for refer, urls := range r {
+		scored[refer] = make([]ScoredURL, 0, len(urls))
+		for _, u := range urls {
+			s := ScoredURL{URL: u}
+			if score, ok := scores[u]; ok {
+				s.Score = &score
+			}
+			scored[refer] = append(scored[refer], s)
+		}
+	}
+	return scored
+}
+
 // URL task to be queued for processing. This item will be processed by the foreman
 // and sent to workers to crawl.
 type URLQueueItem struct {
@@ -77,4 +254,628 @@ type URLQueueItem struct {
 	// be passed down to descendants to ensure they are also crawled.
 	// Note: Does not apply to skipped mime types.
 	ForceCrawl bool `json:"forceCrawl"`
+
+	// Flag instructing the worker to only follow links from pages whose
+	// content changed since they were last crawled. The links of unchanged
+	// pages are added to the results without being crawled. Delta crawls
+	// are also force crawls, and the flag should be passed down to descendants.
+	Delta bool `json:"delta"`
+
+	// Flag instructing the worker to always fetch the URL, instead of
+	// reusing a response fetched by another job from the shared fetch
+	// cache. The flag should be passed down to descendants.
+	NoFetchCache bool `json:"noFetchCache"`
+
+	// Flag instructing the worker and foreman not to crawl the alternate
+	// representations of pages, e.g: AMP variants. Alternates are still
+	// recorded. The flag should be passed down to descendants.
+	SkipAlternates bool `json:"skipAlternates"`
+
+	// Flag instructing the foreman and worker to download the URL's content
+	// as a file, instead of crawling it. Downloads are never satisfied from
+	// the cache, or skipped by their mime type, and their links aren't followed.
+	Download bool `json:"download"`
+
+	// Priority the item is dispatched with, one of the Priority constants.
+	// Items of higher priorities are dispatched ahead of the items of lower
+	// priorities waiting in the same queue. Passed down to descendants.
+	Priority int `json:"priority,omitempty"`
+
+	// Max level of the job, as the foreman and worker's maxLevel, one more
+	// than the job's max depth. Only applies if lower than their maxLevel.
+	// Zero if the job has no max depth. Passed down to descendants.
+	MaxLevel int `json:"maxLevel,omitempty"`
+
+	// Number of times the URL has been retried by the job's status rules.
+	// Not passed down to descendants.
+	Attempt int `json:"attempt,omitempty"`
+}
+
+// Returns true if the item's descendants are queued to be crawled by a foreman,
+// or worker configured with the max level, instead of only being added to the
+// job's results. The job's own max level applies if lower.
+func (i *URLQueueItem) QueuesDescendants(maxLevel int) bool {
+	if i.MaxLevel > 0 && i.MaxLevel < maxLevel {
+		maxLevel = i.MaxLevel
+	}
+	return i.Level+1 < maxLevel
+}
+
+// Returns the queue item of the URL found on the item's URL, one level below
+// it. The item's job, origin, and the flags passed down to descendants are
+// copied, the attempt is not.
+func (i *URLQueueItem) Descendant(urlId URLId) *URLQueueItem {
+	return &URLQueueItem{
+		JobId:          i.JobId,
+		OriginId:       i.OriginId,
+		ReferId:        i.URLId,
+		URLId:          urlId,
+		Level:          i.Level + 1,
+		ForceCrawl:     i.ForceCrawl,
+		Delta:          i.Delta,
+		NoFetchCache:   i.NoFetchCache,
+		SkipAlternates: i.SkipAlternates,
+		Priority:       i.Priority,
+		MaxLevel:       i.MaxLevel,
+	}
+}
+
+// JSONPath expressions a job applies to the crawled JSON responses of its URLs.
+type JobJSONPaths struct {
+	// Expressions selecting the URLs to follow. If any are set, only the URLs
+	// they select are followed from JSON responses.
+	Links []string
+
+	// Expressions selecting the fields to store, keyed by field name.
+	Fields map[string]string
+}
+
+// Upload Id, used for identifying seed list uploads scheduled as a job in
+// the background.
+type UploadId int64
+
+// satisfies the stringer interface
+func (id UploadId) String() string {
+	return fmt.Sprintf("%d", id)
+}
+
+// States of a job upload
+const (
+	// The upload's seed list is being parsed, and validated
+	JobUploadParsing = "parsing"
+
+	// The upload's URLs are being added to its job, and scheduled
+	JobUploadScheduling = "scheduling"
+
+	// The upload's job has been scheduled
+	JobUploadCompleted = "completed"
+
+	// The upload failed, and no job was scheduled
+	JobUploadFailed = "failed"
+)
+
+// Seed list uploaded to be scheduled as a job in the background.
+type JobUpload struct {
+	Id UploadId
+
+	// State of the upload, one of the JobUpload states
+	State string
+
+	// Number of valid URLs, and of the rejected, and duplicate URLs parsed
+	// from the seed list. Set once the seed list is parsed.
+	URLs, Rejected, Duplicates int
+
+	// Job the upload was scheduled as, InvalidId until completed
+	JobId JobId
+
+	// Reason the upload failed
+	Error string
+
+	CreatedOn time.Time
+
+	// When the upload completed or failed, zero until then
+	FinishedOn time.Time
+}
+
+// Summary of a job's crawl of a single host.
+type HostCrawl struct {
+	// Job the host was crawled for
+	JobId JobId `json:"jobId"`
+
+	// Time of the first and last request made to the host for the job
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	// Number of distinct URLs requested
+	URLs int `json:"urls"`
+
+	// Total number of requests made, including re-crawls of the same URL
+	Requests int `json:"requests"`
+
+	// Number of requests which failed, or responded with a 4xx or 5xx status
+	Errors int `json:"errors"`
+
+	// Fraction of requests which were errors, 0 to 1
+	ErrorRate float64 `json:"errorRate"`
+
+	// Total response body bytes received
+	Bytes int64 `json:"bytes"`
+
+	// Average duration of a request in milliseconds
+	AvgRequestMs int64 `json:"avgRequestMs"`
+}
+
+// Crawl history of a host, most recent crawl first.
+type HostHistory struct {
+	Host string `json:"host"`
+
+	// Time of the most recent request to the host. Nil if never crawled.
+	LastCrawled *time.Time `json:"lastCrawled"`
+
+	Crawls []HostCrawl `json:"crawls"`
+}
+
+// Crawl statistics of a job over a window of time, from the job's crawl log.
+type JobCrawlStats struct {
+	JobId     JobId     `json:"jobId"`
+	CreatedOn time.Time `json:"createdOn"`
+
+	// Time the job started running. Zero if the job is waiting for a running
+	// job slot.
+	StartedOn time.Time `json:"startedOn"`
+
+	// Time of the job's most recent request. Zero if the job has not made
+	// any requests.
+	LastCrawled time.Time `json:"lastCrawled"`
+
+	// Requests made within the window, the requests which failed or
+	// responded with an error status, and which were not found.
+	Requests int `json:"requests"`
+	Errors   int `json:"errors"`
+	NotFound int `json:"notFound"`
+}
+
+// Request made while crawling a job, from the job's crawl log.
+type JobCrawlEvent struct {
+	// Id of the request's crawl log entry, increasing as requests are logged
+	Id int64 `json:"-"`
+
+	URL       string    `json:"url"`
+	CrawledOn time.Time `json:"crawledOn"`
+
+	// HTTP status code of the response. Zero if the request failed.
+	Status int `json:"status"`
+
+	Bytes      int64 `json:"bytes"`
+	DurationMs int64 `json:"durationMs"`
+}
+
+// Returns true if the request failed, or responded with an error status.
+func (e JobCrawlEvent) Failed() bool {
+	return e.Status == 0 || e.Status >= 400
+}
+
+// Kinds of events of the live crawl feed
+const (
+	// The URL was requested, and responded with a successful status
+	CrawlFeedFetched = "fetched"
+
+	// The URL's crawl was skipped before it was requested
+	CrawlFeedSkipped = "skipped"
+
+	// The URL's request failed, or responded with an error status
+	CrawlFeedErrored = "errored"
+)
+
+// Crawl of a job's URL by a worker, pushed to clients of the live crawl feed.
+type CrawlFeedEvent struct {
+	// Kind of event, CrawlFeedFetched, CrawlFeedSkipped, or CrawlFeedErrored
+	Event string `json:"event"`
+
+	JobId JobId  `json:"jobId"`
+	URL   string `json:"url"`
+
+	// When the URL was requested, or its crawl skipped
+	On time.Time `json:"on"`
+
+	// Response of the request. Omitted if skipped, or the request failed.
+	Status     int   `json:"status,omitempty"`
+	Bytes      int64 `json:"bytes,omitempty"`
+	DurationMs int64 `json:"durationMs,omitempty"`
+
+	// Why the crawl was skipped. Omitted unless skipped.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Entry in the opt-out registry. URLs of an opted out host, or any of its
+// sub domains, are not scheduled or crawled.
+type HostOptOut struct {
+	// Lower cased host name, without port
+	Host string `json:"host"`
+
+	// Reason the host was opted out, logged when its URLs are skipped
+	Reason string `json:"reason"`
+
+	// Who requested the opt out, HostOptOutAdmin, HostOptOutOwner, or
+	// HostOptOutLegal
+	RequestedBy string `json:"requestedBy"`
+
+	CreatedOn time.Time `json:"createdOn"`
+}
+
+// URL of a job which responded 451 Unavailable For Legal Reasons, RFC 7725.
+type LegalRestriction struct {
+	URL string `json:"url"`
+
+	// Lower cased host of the URL, without port
+	Host string `json:"host"`
+
+	// Entity implementing the block, from the response's Link header with
+	// the "blocked-by" relation. Empty if the response didn't identify it.
+	BlockedBy string `json:"blockedBy,omitempty"`
+
+	// When the response was received
+	RecordedOn time.Time `json:"recordedOn"`
+}
+
+// URLs of a job which are legally restricted, responding 451.
+type JobLegalRestrictions struct {
+	// Number of the job's URLs which responded 451
+	Count int `json:"count"`
+
+	// Most recently restricted of the URLs, up to the limit requested.
+	URLs []LegalRestriction `json:"urls"`
+}
+
+// Budget of the URLs a job may crawl, and how much of it has been used.
+type JobURLBudget struct {
+	// Most URLs the job may crawl
+	Max int `json:"max"`
+
+	// Number of URLs the job has crawled, or started crawling.
+	Crawled int `json:"crawled"`
+
+	// When the job ran out of its budget, and its remaining pending URLs
+	// were dropped. Nil if the budget hasn't run out.
+	ExhaustedOn *time.Time `json:"exhaustedOn,omitempty"`
+}
+
+// Well-known files of a host, e.g: security.txt, found while crawling the host.
+type HostWellKnown struct {
+	// Lower cased host name, without port
+	Host string `json:"host"`
+
+	// Well-known files the host has, ordered by path
+	Files []WellKnownFile `json:"files"`
+}
+
+// Contents of a well-known file of a host.
+type WellKnownFile struct {
+	// Path of the file, e.g: /.well-known/security.txt
+	Path string `json:"path"`
+
+	Content string `json:"content"`
+
+	// When the file was last requested from the host
+	FetchedOn time.Time `json:"fetchedOn"`
+}
+
+// Paths of the well-known files requested from each crawled host.
+var WellKnownPaths = []string{"/.well-known/security.txt", "/llms.txt", "/humans.txt"}
+
+// Identity of a site, captured from its host's home page and web app manifest.
+type HostIdentity struct {
+	// Lower cased host name, without port
+	Host string `json:"host"`
+
+	// Name of the site from its og:site_name, or manifest. Empty if the site
+	// has no name.
+	SiteName string `json:"siteName"`
+
+	// URL the site's favicon was requested from, empty if it has no favicon.
+	IconURL string `json:"iconURL"`
+
+	// Content type (mime) of the stored favicon
+	IconMime string `json:"iconMime"`
+
+	// When the identity was captured
+	FetchedOn time.Time `json:"fetchedOn"`
+}
+
+// Requesters of a host opt out
+const (
+	// Opted out by an administrator of this harvester
+	HostOptOutAdmin = "admin"
+
+	// Opted out by the site's owner, verified by the host serving its
+	// verification token.
+	HostOptOutOwner = "owner"
+
+	// Opted out by a worker after one of the host's URLs responded 451
+	// Unavailable For Legal Reasons.
+	HostOptOutLegal = "legal"
+)
+
+// Key clients authorize their requests to the web server with. Only the key's
+// hash is stored, so the key itself is only known when created.
+type APIKey struct {
+	Id int64 `json:"id"`
+
+	// Name describing who, or what, the key was created for
+	Name string `json:"name"`
+
+	// Leading characters of the key, to identify it by
+	Prefix string `json:"prefix"`
+
+	// Disabled keys are refused, but can be enabled again
+	Enabled bool `json:"enabled"`
+
+	CreatedOn time.Time `json:"createdOn"`
+}
+
+// Job scheduled again, with the same URLs and options, each time its cron
+// schedule matches.
+type RecurringJob struct {
+	Id int64 `json:"id"`
+
+	// Name describing what the recurring job crawls
+	Name string `json:"name"`
+
+	// Cron expression the job is scheduled by, and the IANA time zone it is
+	// in, see ParseCronSchedule.
+	Cron   string `json:"cron"`
+	CronTZ string `json:"cronTZ"`
+
+	// Normalized URLs each of the scheduled jobs crawl
+	URLs []string `json:"urls"`
+
+	// Query parameters of the schedule job API each job is scheduled with,
+	// e.g: forceCrawl&tag=nightly. Empty if none.
+	Options string `json:"options"`
+
+	// API key the recurring job was created with, and its jobs are scheduled
+	// with, zero if none.
+	APIKeyId int64 `json:"apiKeyId,omitempty"`
+
+	CreatedOn time.Time `json:"createdOn"`
+
+	// When the next job is scheduled
+	NextRunOn time.Time `json:"nextRunOn"`
+
+	// When the last job was scheduled, and its id. Zero if no job has been
+	// scheduled yet.
+	LastRunOn time.Time `json:"lastRunOn"`
+	LastJobId JobId     `json:"lastJobId"`
+
+	// When the recurring job was disabled, and why, e.g: its API key was
+	// disabled, or exceeded its quota. Disabled recurring jobs don't
+	// schedule any more jobs. Omitted if enabled.
+	DisabledOn     *time.Time `json:"disabledOn,omitempty"`
+	DisabledReason string     `json:"disabledReason,omitempty"`
+}
+
+// Layout of the months API key usage is reported by, e.g: 2015-01
+const UsageMonthFormat = "2006-01"
+
+// Usage of the crawls of jobs scheduled with an API key, within a month.
+type APIKeyUsage struct {
+	APIKeyId int64 `json:"apiKeyId"`
+
+	// Name of the key, empty if the key was revoked
+	Name string `json:"name"`
+
+	// Month the crawls were made in, UTC, e.g: 2015-01
+	Month string `json:"month"`
+
+	// URLs requested, including failed requests
+	URLs int64 `json:"urls"`
+
+	// Bytes of the response bodies downloaded
+	Bytes int64 `json:"bytes"`
+
+	// Time the workers spent requesting, and reading responses in minutes
+	CrawlMinutes float64 `json:"crawlMinutes"`
+}
+
+// Metrics of an API key's monthly quota
+const (
+	QuotaURLs  = "urls"
+	QuotaBytes = "bytes"
+	QuotaJobs  = "jobs"
+)
+
+// Monthly quota of the jobs scheduled with an API key. Limits of zero are not
+// enforced.
+type APIKeyQuota struct {
+	APIKeyId int64 `json:"apiKeyId"`
+
+	// URLs the key's jobs can request per month, including failed requests
+	URLs int64 `json:"urls"`
+
+	// Bytes of response bodies the key's jobs can download per month
+	Bytes int64 `json:"bytes"`
+
+	// Jobs which can be scheduled with the key per month
+	Jobs int64 `json:"jobs"`
+
+	// URL notified as the key's usage crosses the quota's thresholds, empty
+	// if not notified.
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// Returns the limit of the quota's metric.
+func (q APIKeyQuota) Limit(metric string) int64 {
+	switch metric {
+	case QuotaURLs:
+		return q.URLs
+	case QuotaBytes:
+		return q.Bytes
+	case QuotaJobs:
+		return q.Jobs
+	}
+	return 0
+}
+
+// Usage of an API key's quota within a month.
+type APIKeyQuotaUsage struct {
+	URLs  int64 `json:"urls"`
+	Bytes int64 `json:"bytes"`
+	Jobs  int64 `json:"jobs"`
+}
+
+// Returns the usage of the quota's metric.
+func (u APIKeyQuotaUsage) Used(metric string) int64 {
+	switch metric {
+	case QuotaURLs:
+		return u.URLs
+	case QuotaBytes:
+		return u.Bytes
+	case QuotaJobs:
+		return u.Jobs
+	}
+	return 0
+}
+
+// Returns the first metric whose usage has reached the quota's limit, or would
+// exceed it if the number of jobs were scheduled, empty if none would.
+func (q APIKeyQuota) Exceeded(u APIKeyQuotaUsage, jobs int64) string {
+	if q.Jobs > 0 && u.Jobs+jobs > q.Jobs {
+		return QuotaJobs
+	}
+	for _, metric := range []string{QuotaURLs, QuotaBytes} {
+		if limit := q.Limit(metric); limit > 0 && u.Used(metric) >= limit {
+			return metric
+		}
+	}
+	return ""
+}
+
+// Information extracted from a crawled URL's response headers and content.
+type PageInfo struct {
+	// Date the content states it was published on, from meta tags or
+	// JSON-LD datePublished. Zero if unknown.
+	PublishedOn time.Time
+
+	// Date the content was last modified on, from meta tags, JSON-LD
+	// dateModified, or the Last-Modified header. Zero if unknown.
+	ModifiedOn time.Time
+
+	// Number of words visible in the HTML document's body. Zero
+	// for content that isn't HTML.
+	WordCount int
+
+	// Text of the HTML document's title element
+	Title string
+
+	// Content of the HTML document's description meta tag
+	Description string
+
+	// Text of the HTML document's first h1 element
+	H1 string
+}
+
+// Returns the most recent date the content is known to have been updated on.
+// The modified date is preferred over the published date. Zero is returned
+// if neither are known.
+func (p PageInfo) LastUpdated() time.Time {
+	if !p.ModifiedOn.IsZero() {
+		return p.ModifiedOn
+	}
+	return p.PublishedOn
+}
+
+// Redirect recorded from the content of a crawled URL.
+type RedirectEdge struct {
+	// URL whose content redirects, and the URL it redirects to
+	From string
+	To   string
+
+	// How the URL redirects, e.g: meta-refresh or javascript
+	Kind string
+}
+
+// Crawled HTML page listed in a job's generated sitemap.
+type SitemapPage struct {
+	// URL of the page
+	URL string
+
+	// Most recent date the page's content is known to have been updated
+	// on. Zero if unknown.
+	LastUpdated time.Time
+}
+
+// Crawled HTML page with fewer visible words than the thin content threshold.
+type ThinPage struct {
+	// URL of the page
+	URL string `json:"url"`
+
+	// Number of visible words on the page
+	Words int `json:"words"`
+}
+
+// Crawled URL of a job whose content failed to be parsed, quarantined with its
+// raw content.
+type ParseFailure struct {
+	// URL of the page
+	URL string `json:"url"`
+
+	// Content type the page was parsed as
+	Mime string `json:"mime"`
+
+	// Why the content failed to be parsed, e.g: Invalid UTF-8 at byte 120
+	Error string `json:"error"`
+
+	// Size of the page's content in bytes, and if only the start of it was
+	// stored.
+	Size      int64 `json:"size"`
+	Truncated bool  `json:"truncated"`
+
+	// When the page failed to be parsed
+	FailedOn time.Time `json:"failedOn"`
+
+	// Raw content of the page, up to the workers' quarantine limit. Not
+	// included in reports.
+	Raw []byte `json:"-"`
+}
+
+// Report of a job's crawled URLs whose content failed to be parsed.
+type ParseFailureReport struct {
+	// Pages which failed to be parsed, ordered by URL.
+	URLs []ParseFailure `json:"urls"`
+}
+
+// Panic a worker recovered from while crawling a URL of a job, recorded with
+// the stack of the goroutine which panicked.
+type URLPanic struct {
+	// URL being crawled
+	URL string `json:"url"`
+
+	// Stage of the crawl the panic happened in, e.g: parse
+	Stage string `json:"stage"`
+
+	// Value the worker panicked with, and the stack it panicked at.
+	Panic string `json:"panic"`
+	Stack string `json:"stack"`
+
+	PanickedOn time.Time `json:"panickedOn"`
+
+	// If the URL has panicked enough times it is poisoned, and is no
+	// longer crawled by any job.
+	Poisoned bool `json:"poisoned"`
+}
+
+// Report of the panics of a job's crawled URLs.
+type URLPanicReport struct {
+	// Panics of the job's URLs, most recent first.
+	URLs []URLPanic `json:"urls"`
+}
+
+// Report of a job's crawled HTML pages which have fewer visible words
+// than the threshold.
+type ThinContentReport struct {
+	// Word count pages must be under to be considered thin
+	Threshold int `json:"threshold"`
+
+	// Pages with a word count under the threshold, ordered by word count.
+	Pages []ThinPage `json:"pages"`
 }
@@ -0,0 +1,342 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kind of value a URL query field is compared with.
+type URLQueryKind int
+
+const (
+	URLQueryInt URLQueryKind = iota
+	URLQueryString
+	URLQueryTime
+)
+
+// Fields which can be used in URL query predicates, and the kind of
+// value each is compared with.
+var URLQueryFields = map[string]URLQueryKind{
+	"status":      URLQueryInt,    // HTTP status code the URL was crawled with
+	"depth":       URLQueryInt,    // Recursive distance from the Job URL
+	"words":       URLQueryInt,    // Visible word count of HTML pages
+	"mime":        URLQueryString, // Content type
+	"host":        URLQueryString, // Lower cased host of the URL
+	"url":         URLQueryString, // Full URL
+	"title":       URLQueryString, // HTML page title
+	"description": URLQueryString, // HTML page description meta tag
+	"h1":          URLQueryString, // HTML page's first h1 heading
+	"tag":         URLQueryString, // Kind of content the URL was classified as, e.g: product
+	"crawled":     URLQueryTime,   // When the URL was crawled
+	"published":   URLQueryTime,   // Publish date stated by the content
+	"modified":    URLQueryTime,   // Last modified date of the content
+}
+
+// Comparison operators which can be used with each kind of field. The '~'
+// operator is a case insensitive contains match.
+var urlQueryKindOps = map[URLQueryKind][]string{
+	URLQueryInt:    {"=", "!=", "<", "<=", ">", ">="},
+	URLQueryString: {"=", "!=", "~"},
+	URLQueryTime:   {"=", "!=", "<", "<=", ">", ">="},
+}
+
+// Date formats time values can be written in.
+var urlQueryTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Node of a parsed URL query expression. Either a URLQueryAnd, URLQueryOr,
+// URLQueryNot, or URLQueryPredicate.
+type URLQueryExpr interface {
+	urlQueryExpr()
+}
+
+// Matches if both expressions match.
+type URLQueryAnd struct {
+	Left, Right URLQueryExpr
+}
+
+// Matches if either expression matches.
+type URLQueryOr struct {
+	Left, Right URLQueryExpr
+}
+
+// Matches if the expression does not match.
+type URLQueryNot struct {
+	Expr URLQueryExpr
+}
+
+// Compares a field with a value, e.g: status >= 400
+type URLQueryPredicate struct {
+	// Field being compared, one of URLQueryFields
+	Field string
+
+	// Comparison operator
+	Op string
+
+	// Value compared with. Either an int, string, or time.Time
+	// depending on the field's kind.
+	Value interface{}
+}
+
+func (URLQueryAnd) urlQueryExpr()       {}
+func (URLQueryOr) urlQueryExpr()        {}
+func (URLQueryNot) urlQueryExpr()       {}
+func (URLQueryPredicate) urlQueryExpr() {}
+
+// A URL matching a URL query.
+type URLMatch struct {
+	URL    string `json:"url"`
+	Mime   string `json:"mime"`
+	Status int    `json:"status"`
+
+	// Recursive distance from the Job URL. Nil if not known.
+	Depth *int `json:"depth"`
+
+	Words int    `json:"words"`
+	Title string `json:"title"`
+
+	// Kinds of content the URL was classified as, sorted
+	Tags []string `json:"tags"`
+}
+
+// Result of a URL query over a job's URLs.
+type URLQueryResult struct {
+	// Query expression evaluated
+	Query string `json:"query"`
+
+	// URLs matching the query, ordered by when they were first found
+	URLs []URLMatch `json:"urls"`
+
+	// True if more URLs matched than the result limit
+	Truncated bool `json:"truncated"`
+}
+
+// Parses a URL query filter expression. Expressions are made up of field
+// predicates combined with 'and', 'or', 'not', and grouped with parentheses.
+// Values can be quoted with single or double quotes, and must be quoted if
+// they contain white space.
+//
+// e.g: status >= 400 and (mime = text/html or host ~ "example") and not depth > 2
+func ParseURLQuery(expr string) (URLQueryExpr, error) {
+	tokens, err := lexURLQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty query")
+	}
+
+	p := &urlQueryParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	return e, nil
+}
+
+type urlQueryTokenKind int
+
+const (
+	urlQueryWord urlQueryTokenKind = iota
+	urlQueryQuoted
+	urlQueryOp
+	urlQueryParen
+)
+
+type urlQueryToken struct {
+	kind urlQueryTokenKind
+	text string
+}
+
+// Splits the expression into words, quoted strings, operators, and parentheses.
+func lexURLQuery(expr string) ([]urlQueryToken, error) {
+	tokens := []urlQueryToken{}
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, urlQueryToken{kind: urlQueryParen, text: string(r)})
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(rs) && rs[end] != r {
+				end++
+			}
+			if end == len(rs) {
+				return nil, fmt.Errorf("unterminated quote at %d", i)
+			}
+			tokens = append(tokens, urlQueryToken{kind: urlQueryQuoted, text: string(rs[i+1 : end])})
+			i = end + 1
+		case isURLQueryOpRune(r):
+			end := i + 1
+			for end < len(rs) && isURLQueryOpRune(rs[end]) {
+				end++
+			}
+			tokens = append(tokens, urlQueryToken{kind: urlQueryOp, text: string(rs[i:end])})
+			i = end
+		default:
+			end := i + 1
+			for end < len(rs) && !unicode.IsSpace(rs[end]) && !isURLQueryOpRune(rs[end]) &&
+				rs[end] != '(' && rs[end] != ')' && rs[end] != '"' && rs[end] != '\'' {
+				end++
+			}
+			tokens = append(tokens, urlQueryToken{kind: urlQueryWord, text: string(rs[i:end])})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+func isURLQueryOpRune(r rune) bool {
+	return r == '=' || r == '!' || r == '<' || r == '>' || r == '~'
+}
+
+// Recursive descent parser for URL query expressions. 'not' binds
+// tightest, followed by 'and', then 'or'.
+type urlQueryParser struct {
+	tokens []urlQueryToken
+	pos    int
+}
+
+// Returns the next token if it is a word matching the keyword, case insensitively.
+func (p *urlQueryParser) acceptKeyword(keyword string) bool {
+	if p.pos < len(p.tokens) && p.tokens[p.pos].kind == urlQueryWord && strings.EqualFold(p.tokens[p.pos].text, keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *urlQueryParser) next() (urlQueryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return urlQueryToken{}, false
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, true
+}
+
+func (p *urlQueryParser) parseOr() (URLQueryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = URLQueryOr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *urlQueryParser) parseAnd() (URLQueryExpr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = URLQueryAnd{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *urlQueryParser) parseNot() (URLQueryExpr, error) {
+	if p.acceptKeyword("not") {
+		e, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return URLQueryNot{Expr: e}, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *urlQueryParser) parseTerm() (URLQueryExpr, error) {
+	t, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	if t.kind == urlQueryParen && t.text == "(" {
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.next(); !ok || t.kind != urlQueryParen || t.text != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+		return e, nil
+	}
+	if t.kind != urlQueryWord {
+		return nil, fmt.Errorf("expected field, got %q", t.text)
+	}
+
+	field := strings.ToLower(t.text)
+	kind, ok := URLQueryFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q", t.text)
+	}
+
+	op, ok := p.next()
+	if !ok || op.kind != urlQueryOp {
+		return nil, fmt.Errorf("expected operator after %q", field)
+	}
+	if !containsString(urlQueryKindOps[kind], op.text) {
+		return nil, fmt.Errorf("operator %q not supported by field %q", op.text, field)
+	}
+
+	v, ok := p.next()
+	if !ok || (v.kind != urlQueryWord && v.kind != urlQueryQuoted) {
+		return nil, fmt.Errorf("expected value after %s %s", field, op.text)
+	}
+
+	value, err := parseURLQueryValue(kind, v.text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value for %q, %v", field, err)
+	}
+
+	return URLQueryPredicate{Field: field, Op: op.text, Value: value}, nil
+}
+
+// Converts the value to the type of the field's kind.
+func parseURLQueryValue(kind URLQueryKind, s string) (interface{}, error) {
+	switch kind {
+	case URLQueryInt:
+		return strconv.Atoi(s)
+	case URLQueryTime:
+		for _, layout := range urlQueryTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t.UTC(), nil
+			}
+		}
+		return nil, fmt.Errorf("%q is not a date", s)
+	}
+	return s, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseURLQuery(t *testing.T) {
+	expr, err := ParseURLQuery(`status >= 400 AND (mime=text/html or title ~ "Not Found") and not depth > 2`)
+	require.Nil(t, err, "Expect query to parse")
+
+	expect := URLQueryAnd{
+		Left: URLQueryAnd{
+			Left: URLQueryPredicate{Field: "status", Op: ">=", Value: 400},
+			Right: URLQueryOr{
+				Left:  URLQueryPredicate{Field: "mime", Op: "=", Value: "text/html"},
+				Right: URLQueryPredicate{Field: "title", Op: "~", Value: "Not Found"},
+			},
+		},
+		Right: URLQueryNot{Expr: URLQueryPredicate{Field: "depth", Op: ">", Value: 2}},
+	}
+	assert.Equal(t, expect, expr, "Expect 'and' to bind tighter than 'or', and groups respected")
+}
+
+func TestParseURLQueryTime(t *testing.T) {
+	expr, err := ParseURLQuery(`modified < '2015-01-02'`)
+	require.Nil(t, err, "Expect query to parse")
+	assert.Equal(t, URLQueryPredicate{Field: "modified", Op: "<", Value: time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)}, expr, "Expect date value")
+}
+
+var invalidURLQueries = []string{
+	``,
+	`status`,
+	`status =`,
+	`unknown = 1`,
+	`status ~ 404`,
+	`words < many`,
+	`host = "example.com`,
+	`(status = 404`,
+	`status = 404 host = example.com`,
+	`published > yesterday`,
+}
+
+func TestParseURLQueryInvalid(t *testing.T) {
+	for _, q := range invalidURLQueries {
+		_, err := ParseURLQuery(q)
+		assert.NotNil(t, err, "Expect error for query %q", q)
+	}
+}
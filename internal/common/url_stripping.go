@@ -0,0 +1,165 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Tracking parameters stripped from the links of crawled pages when a job
+// doesn't override them. A trailing * matches any parameter with the prefix.
+// Parameters are matched case insensitively.
+var DefaultStripParams = []string{
+	// Google Analytics campaigns, and Google Ads click ids
+	"utm_*", "gclid", "gclsrc", "dclid", "gbraid", "wbraid", "_ga", "_gl",
+	// Facebook, Microsoft, Twitter, Yandex, and Instagram click ids
+	"fbclid", "msclkid", "twclid", "yclid", "igshid",
+	// Mailchimp, HubSpot, and Marketo email campaigns
+	"mc_cid", "mc_eid", "_hsenc", "_hsmi", "mkt_tok",
+}
+
+// Value of a job's strip params which strips none of the default tracking
+// parameters, and value which expands to them.
+const (
+	StripParamsNone    = "none"
+	StripParamsDefault = "default"
+)
+
+// Parses the name of a tracking parameter to strip, e.g: gclid, or utm_* to
+// strip all parameters with the prefix. An error is returned if the name is
+// empty, or isn't a plain query parameter name.
+func ParseStripParam(s string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "" || name == "*" {
+		return "", fmt.Errorf("Invalid strip param, must not be empty")
+	}
+	if strings.ContainsAny(name, "=&#? ") {
+		return "", fmt.Errorf("Invalid strip param %s, must be a query parameter name", s)
+	}
+	if i := strings.Index(name, "*"); i >= 0 && i != len(name)-1 {
+		return "", fmt.Errorf("Invalid strip param %s, * is only allowed at the end", s)
+	}
+	return name, nil
+}
+
+// Parses the strip params a job overrides the default tracking parameters
+// with. 'none' strips no parameters, and 'default' is expanded to the default
+// parameters, so they can be added to. Duplicates are dropped. Nil is returned
+// if there are no values, and the defaults apply.
+func ParseStripParams(values []string) ([]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	params := []string{}
+	seen := map[string]struct{}{}
+	add := func(p string) {
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			params = append(params, p)
+		}
+	}
+	for _, v := range values {
+		switch strings.ToLower(v) {
+		case StripParamsNone:
+			if len(values) > 1 {
+				return nil, fmt.Errorf("Invalid strip params, %s can't be combined with other params", StripParamsNone)
+			}
+		case StripParamsDefault:
+			for _, p := range DefaultStripParams {
+				add(p)
+			}
+		default:
+			p, err := ParseStripParam(v)
+			if err != nil {
+				return nil, err
+			}
+			add(p)
+		}
+	}
+	return params, nil
+}
+
+// Rules of what is stripped from the links found on a job's pages before they
+// are recorded, so links which only differ by them aren't crawled twice.
+type URLStripping struct {
+	// Query parameters stripped. A trailing * matches any parameter with
+	// the prefix.
+	Params []string `json:"params"`
+
+	// If the params are the default tracking parameters, or the job's own.
+	Default bool `json:"default"`
+
+	// If fragments are kept instead of being stripped. Hash-bang, #!,
+	// fragments are always kept, since they address the pages of AJAX
+	// applications.
+	KeepFragments bool `json:"keepFragments"`
+}
+
+// Returns the stripping rules of a job with the strip params, and fragment
+// setting. Nil params strip the default tracking parameters.
+func NewURLStripping(params []string, keepFragments bool) URLStripping {
+	if params == nil {
+		return URLStripping{
+			Params:        append([]string{}, DefaultStripParams...),
+			Default:       true,
+			KeepFragments: keepFragments,
+		}
+	}
+	return URLStripping{Params: params, KeepFragments: keepFragments}
+}
+
+// Returns true if the query parameter is stripped.
+func (s URLStripping) strips(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range s.Params {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(name, p[:len(p)-1]) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Strips the URL's tracking parameters, and fragment. The order, and encoding
+// of the other parameters are kept. The URL is returned as is if it is not
+// valid, or nothing is stripped.
+func (s URLStripping) Strip(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+
+	stripped := false
+	if !s.KeepFragments && parsed.Fragment != "" && !strings.HasPrefix(parsed.Fragment, "!") {
+		parsed.Fragment, parsed.RawFragment = "", ""
+		stripped = true
+	}
+
+	if parsed.RawQuery != "" && len(s.Params) > 0 {
+		kept := []string{}
+		for _, pair := range strings.Split(parsed.RawQuery, "&") {
+			name := pair
+			if i := strings.Index(pair, "="); i >= 0 {
+				name = pair[:i]
+			}
+			if n, err := url.QueryUnescape(name); err == nil {
+				name = n
+			}
+			if pair != "" && s.strips(name) {
+				stripped = true
+				continue
+			}
+			kept = append(kept, pair)
+		}
+		parsed.RawQuery = strings.Join(kept, "&")
+	}
+
+	if !stripped {
+		return u
+	}
+	return parsed.String()
+}
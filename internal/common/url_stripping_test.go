@@ -0,0 +1,52 @@
+package common
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseStripParams(t *testing.T) {
+	params, err := ParseStripParams(nil)
+	require.NoError(t, err)
+	assert.Nil(t, params, "Expect defaults to apply")
+
+	params, err = ParseStripParams([]string{"none"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, params, "Expect no params stripped")
+
+	params, err = ParseStripParams([]string{"Ref", "sid_*", "ref"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ref", "sid_*"}, params)
+
+	params, err = ParseStripParams([]string{"default", "ref"})
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]string{}, DefaultStripParams...), "ref"), params, "Expect defaults expanded")
+
+	for _, v := range [][]string{{""}, {"*"}, {"a=b"}, {"u*m"}, {"none", "ref"}} {
+		_, err := ParseStripParams(v)
+		assert.Error(t, err, "Expect invalid strip params %q", v)
+	}
+}
+
+func TestURLStrippingStrip(t *testing.T) {
+	defaults := NewURLStripping(nil, false)
+	assert.True(t, defaults.Default)
+
+	cases := []struct {
+		s       URLStripping
+		in, out string
+	}{
+		{defaults, "http://example.com/a?utm_source=x&id=1&UTM_Medium=y", "http://example.com/a?id=1"},
+		{defaults, "http://example.com/a?gclid=1&fbclid=2", "http://example.com/a"},
+		{defaults, "http://example.com/a?b=%20c&a=1#top", "http://example.com/a?b=%20c&a=1"},
+		{defaults, "http://example.com/#!/page", "http://example.com/#!/page"},
+		{defaults, "http://example.com/a?id=1", "http://example.com/a?id=1"},
+		{NewURLStripping(nil, true), "http://example.com/a?fbclid=2#top", "http://example.com/a#top"},
+		{NewURLStripping([]string{}, false), "http://example.com/a?utm_source=x#top", "http://example.com/a?utm_source=x"},
+		{NewURLStripping([]string{"ref"}, false), "http://example.com/a?ref=home&utm_source=x", "http://example.com/a?utm_source=x"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.out, c.s.Strip(c.in), "Expect %s stripped", c.in)
+	}
+}
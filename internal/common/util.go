@@ -2,6 +2,7 @@ package common
 
 import (
 	"log"
+	"net"
 	"net/url"
 	"path"
 	"strings"
@@ -47,3 +48,18 @@ func CanSkipMime(mime string) bool {
 		mime == "text/css" ||
 		mime == "text/javascript"
 }
+
+// Returns the lower cased host of the URL without its port. An empty
+// string is returned if the URL can not be parsed.
+func URLHost(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host
+}
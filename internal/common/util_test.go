@@ -22,3 +22,27 @@ func TestGuessURLsMime(t *testing.T) {
 	kind = GuessURLsMime("http://ecx.images-amazon.com/")
 	assert.Equal(t, "text/html", kind, "Expect kind to match html page.")
 }
+
+func TestURLHost(t *testing.T) {
+	assert.Equal(t, "www.example.com", URLHost("http://WWW.Example.com/path"), "Expect lower cased host")
+	assert.Equal(t, "example.com", URLHost("https://example.com:8443/"), "Expect port removed")
+	assert.Equal(t, "", URLHost("%zz"), "Expect empty host for invalid URL")
+}
+
+func TestURLQueueItemQueuesDescendants(t *testing.T) {
+	item := &URLQueueItem{Level: 1}
+	assert.True(t, item.QueuesDescendants(3), "Expect descendants queued below max level")
+	assert.False(t, item.QueuesDescendants(2), "Expect descendants not queued at max level")
+
+	item.MaxLevel = 2
+	assert.False(t, item.QueuesDescendants(3), "Expect job's lower max level applied")
+
+	item.MaxLevel = 5
+	assert.False(t, item.QueuesDescendants(2), "Expect configured max level applied if lower")
+}
+
+func TestURLQueueItemDescendant(t *testing.T) {
+	item := &URLQueueItem{JobId: 1, OriginId: 2, ReferId: 3, URLId: 4, Level: 1, Delta: true, Priority: PriorityHigh, MaxLevel: 3, Attempt: 2}
+	assert.Equal(t, &URLQueueItem{JobId: 1, OriginId: 2, ReferId: 4, URLId: 5, Level: 2, Delta: true, Priority: PriorityHigh, MaxLevel: 3},
+		item.Descendant(5), "Expect flags passed down, and attempt reset")
+}
@@ -0,0 +1,167 @@
+// Package embedding requests the embedding vectors of text from an OpenAI
+// compatible embeddings endpoint, e.g: a self-hosted model server, and
+// compares the vectors by their cosine similarity.
+package embedding
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// Timeout of each request to the endpoint if not configured.
+const DefaultTimeout = 30 * time.Second
+
+// Largest response read from the endpoint.
+const maxResponseSize = 64 * 1024 * 1024
+
+// Configuration of the embeddings endpoint.
+type Config struct {
+	// URL of the embeddings endpoint, e.g: https://api.openai.com/v1/embeddings.
+	// Text is not embedded if not set.
+	URL string `json:"url"`
+
+	// Model the endpoint embeds text with.
+	Model string `json:"model"`
+
+	// Bearer token requests to the endpoint are authorized with, if set.
+	APIKey string `json:"apiKey"`
+
+	// Timeout of each request. Defaults to DefaultTimeout.
+	// time.Duration string formated value, e.g: 1m
+	TimeoutStr string `json:"timeout"`
+
+	// The TimeoutStr will be parsed, and its value placed into this field.
+	Timeout time.Duration `json:"-"`
+}
+
+// Returns true if text is embedded, the URL is set.
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// Parses the timeout, and validates the configuration if text is embedded.
+func (c *Config) SetDefaults() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid embeddings url %s, must be a http or https URL", c.URL)
+	}
+	if c.Model == "" {
+		return fmt.Errorf("Invalid embeddings, model must be set")
+	}
+
+	c.Timeout = DefaultTimeout
+	if c.TimeoutStr != "" {
+		timeout, err := time.ParseDuration(c.TimeoutStr)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid embeddings timeout %q, must be a positive duration", c.TimeoutStr)
+		}
+		c.Timeout = timeout
+	}
+	return nil
+}
+
+// Client of an embeddings endpoint, embedding text with a model.
+type Client struct {
+	url, model, apiKey string
+	client             *http.Client
+}
+
+// Creates a client of the endpoint at the URL, embedding text with the model.
+// Requests are authorized with the API key if it is set.
+func NewClient(u, model, apiKey string, client *http.Client) *Client {
+	return &Client{url: u, model: model, apiKey: apiKey, client: client}
+}
+
+// Returns the model the client embeds text with.
+func (c *Client) Model() string {
+	return c.model
+}
+
+// Request to the embeddings endpoint.
+type request struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// Response of the embeddings endpoint, with a vector for each of the
+// request's inputs.
+type response struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Requests the embedding vectors of the inputs, returned in the order of the
+// inputs. An error is returned if the endpoint fails, or doesn't return a
+// vector for each input.
+func (c *Client) Embed(inputs []string) ([][]float32, error) {
+	body, err := json.Marshal(request{Model: c.model, Input: inputs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("embeddings endpoint responded with status %d", resp.StatusCode)
+	}
+
+	var msg response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&msg); err != nil {
+		return nil, fmt.Errorf("invalid embeddings response, %v", err)
+	}
+	if len(msg.Data) != len(inputs) {
+		return nil, fmt.Errorf("embeddings endpoint returned %d vectors for %d inputs", len(msg.Data), len(inputs))
+	}
+	sort.Slice(msg.Data, func(i, j int) bool { return msg.Data[i].Index < msg.Data[j].Index })
+
+	vectors := make([][]float32, 0, len(msg.Data))
+	for i, d := range msg.Data {
+		if d.Index != i || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("embeddings endpoint returned no vector for input %d", i)
+		}
+		vectors = append(vectors, d.Embedding)
+	}
+	return vectors, nil
+}
+
+// Returns the cosine similarity of the vectors, between -1 and 1, where 1 is
+// the most similar. Vectors of different dimensions, or without a direction,
+// are not similar and zero is returned.
+func CosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,81 @@
+package embedding
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConfigSetDefaults(t *testing.T) {
+	cfg := Config{}
+	assert.NoError(t, cfg.SetDefaults(), "Expect no validation if not enabled")
+	assert.False(t, cfg.Enabled())
+
+	cfg = Config{URL: "http://localhost:8000/v1/embeddings", Model: "m"}
+	require.NoError(t, cfg.SetDefaults())
+	assert.True(t, cfg.Enabled())
+	assert.Equal(t, DefaultTimeout, cfg.Timeout)
+
+	cfg = Config{URL: "http://localhost:8000/v1/embeddings", Model: "m", TimeoutStr: "5s"}
+	require.NoError(t, cfg.SetDefaults())
+	assert.Equal(t, 5*time.Second, cfg.Timeout)
+
+	invalid := []Config{
+		{URL: "ftp://localhost/embeddings", Model: "m"},
+		{URL: "http://localhost/embeddings"},
+		{URL: "http://localhost/embeddings", Model: "m", TimeoutStr: "soon"},
+		{URL: "http://localhost/embeddings", Model: "m", TimeoutStr: "-1s"},
+	}
+	for i, c := range invalid {
+		assert.Error(t, c.SetDefaults(), "Expect error for config %d", i)
+	}
+}
+
+func TestClientEmbed(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		var req request
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test-model", req.Model)
+
+		// Vectors are returned in reverse order of the inputs
+		w.Write([]byte(`{"data": [{"index": 1, "embedding": [2, 0]}, {"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	defer s.Close()
+
+	c := NewClient(s.URL, "test-model", "secret", &http.Client{Timeout: time.Second})
+	assert.Equal(t, "test-model", c.Model())
+
+	vectors, err := c.Embed([]string{"a", "bb"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1, 0}, {2, 0}}, vectors, "Expect vectors in order of the inputs")
+
+	_, err = c.Embed([]string{"a", "bb", "ccc"})
+	assert.Error(t, err, "Expect error for missing vectors")
+}
+
+func TestClientEmbedFailure(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	_, err := NewClient(s.URL, "m", "", &http.Client{}).Embed([]string{"a"})
+	assert.Error(t, err, "Expect error for failed request")
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	assert.InDelta(t, 1, CosineSimilarity([]float32{1, 2}, []float32{2, 4}), 1e-9, "Expect same direction most similar")
+	assert.InDelta(t, 0, CosineSimilarity([]float32{1, 0}, []float32{0, 3}), 1e-9, "Expect orthogonal vectors not similar")
+	assert.InDelta(t, -1, CosineSimilarity([]float32{1, 0}, []float32{-1, 0}), 1e-9, "Expect opposite vectors least similar")
+
+	assert.Equal(t, 0.0, CosineSimilarity([]float32{1, 0}, []float32{1, 0, 0}), "Expect different dimensions not similar")
+	assert.Equal(t, 0.0, CosineSimilarity([]float32{0, 0}, []float32{1, 0}), "Expect zero vector not similar")
+	assert.Equal(t, 0.0, CosineSimilarity(nil, nil), "Expect empty vectors not similar")
+}
@@ -0,0 +1,196 @@
+// Package errreport counts the panics the harvester services recover from, and
+// reports them to a Sentry compatible error reporting service if configured,
+// so crashes which would otherwise only be logged are noticed.
+package errreport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/metrics"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Timeout of the requests reporting a panic.
+const reportTimeout = 5 * time.Second
+
+// Client the panics are reported as.
+const sentryClient = "harvester-errreport/1.0"
+
+// Configuration of where panics are reported to.
+type Config struct {
+	// DSN of the Sentry project panics are reported to, e.g:
+	// https://<key>@sentry.example.com/42. Panics are only counted, and
+	// logged if not set.
+	DSN string `json:"dsn"`
+
+	// Environment the panics are reported from, e.g: production.
+	Environment string `json:"environment"`
+}
+
+// Counts the panics of a service, and reports them to the configured error
+// reporting service. The reporter is safe across multiple go routines. A nil
+// Reporter doesn't count, or report panics.
+type Reporter struct {
+	service     string
+	environment string
+	serverName  string
+
+	// Endpoint events are stored with, and the authentication header sent
+	// with them. Empty if panics are not reported.
+	storeURL string
+	auth     string
+	client   *http.Client
+
+	panics *metrics.Counter
+}
+
+// Creates the reporter of the service's panics. Returns an error if the DSN
+// is invalid.
+func New(cfg Config, service string) (*Reporter, error) {
+	r := &Reporter{
+		service:     service,
+		environment: cfg.Environment,
+		client:      &http.Client{Timeout: reportTimeout},
+		panics:      metrics.NewCounter(),
+	}
+	r.serverName, _ = os.Hostname()
+
+	if cfg.DSN != "" {
+		storeURL, auth, err := parseDSN(cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		r.storeURL, r.auth = storeURL, auth
+	}
+	return r, nil
+}
+
+// Parses the DSN of a Sentry project into the endpoint events are stored with,
+// and the authentication header sent with them.
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", "", fmt.Errorf("Invalid error reporting DSN, %v", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", fmt.Errorf("Invalid error reporting DSN, must be an http, or https URL")
+	}
+	if u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("Invalid error reporting DSN, missing public key")
+	}
+	dir, project := path.Split(strings.TrimSuffix(u.Path, "/"))
+	if project == "" {
+		return "", "", fmt.Errorf("Invalid error reporting DSN, missing project id")
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", sentryClient, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+	storeURL := fmt.Sprintf("%s://%s%sapi/%s/store/", u.Scheme, u.Host, dir, project)
+	return storeURL, auth, nil
+}
+
+// Returns the count of the panics recovered from, by the label they were
+// counted with. Nil if the reporter is nil.
+func (r *Reporter) Panics() *metrics.Counter {
+	if r == nil {
+		return nil
+	}
+	return r.panics
+}
+
+// Counts the panic recovered from, with the stack it panicked at, by the
+// label of where it happened, e.g: the crawl stage. If reporting is configured
+// the panic is reported in the background, tagged with the label, and tags.
+func (r *Reporter) Panic(label string, recovered interface{}, stack []byte, tags map[string]string) {
+	if r == nil {
+		return
+	}
+	r.panics.Add(label)
+	if r.storeURL == "" {
+		return
+	}
+
+	e := r.newEvent(label, recovered, stack, tags, time.Now().UTC())
+	go func() {
+		if err := r.report(e); err != nil {
+			log.Println("errreport: Failed to report panic", e.EventId, err)
+		}
+	}()
+}
+
+// Event of a panic, as stored by the error reporting service.
+type event struct {
+	EventId     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger"`
+	ServerName  string            `json:"server_name,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Tags        map[string]string `json:"tags"`
+	Extra       map[string]string `json:"extra"`
+}
+
+// Creates the event of the panic.
+func (r *Reporter) newEvent(label string, recovered interface{}, stack []byte, tags map[string]string, now time.Time) event {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	e := event{
+		EventId:     hex.EncodeToString(id),
+		Timestamp:   now.Format("2006-01-02T15:04:05"),
+		Level:       "fatal",
+		Platform:    "go",
+		Logger:      r.service,
+		ServerName:  r.serverName,
+		Environment: r.environment,
+		Message:     fmt.Sprintf("panic: %v", recovered),
+		Tags:        map[string]string{"service": r.service},
+		Extra:       map[string]string{"stack": string(stack)},
+	}
+	if label != "" {
+		e.Tags["label"] = label
+	}
+	for k, v := range tags {
+		e.Tags[k] = v
+	}
+	return e
+}
+
+// Sends the event to the error reporting service.
+func (r *Reporter) report(e event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", r.storeURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Error reporting service responded %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package fault injects latency, errors, and duplicate deliveries into the
+// storage and queue clients, so the retry and idempotency behavior of the
+// services can be exercised by integration tests. Faults are only injected
+// if configured, and must never be configured in production.
+package fault
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Returned by operations an injected fault failed.
+var ErrInjected = errors.New("fault: injected error")
+
+// Configuration of the faults injected into a client. Rates are the chance,
+// between 0 and 1, of each operation having the fault.
+type Config struct {
+	// Delay added to each operation, and the random jitter added to it.
+	// time.Duration string formated values, e.g: 50ms
+	Latency string `json:"latency"`
+	Jitter  string `json:"jitter"`
+
+	// Rate operations fail with ErrInjected.
+	ErrorRate float64 `json:"errorRate"`
+
+	// Rate queue messages are delivered twice. Ignored by storage.
+	DuplicateRate float64 `json:"duplicateRate"`
+
+	// Seed of the faults' randomness, so a test's faults are repeatable.
+	// Seeded by the time if not set.
+	Seed int64 `json:"seed"`
+}
+
+// Injects the faults of its configuration. A nil Injector injects no faults.
+// The injector is safe across multiple go routines.
+type Injector struct {
+	latency, jitter time.Duration
+	errorRate       float64
+	duplicateRate   float64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// Creates an injector of the configuration's faults. Returns an error if the
+// configuration is invalid.
+func New(cfg Config) (*Injector, error) {
+	inj := &Injector{errorRate: cfg.ErrorRate, duplicateRate: cfg.DuplicateRate}
+
+	var err error
+	if cfg.Latency != "" {
+		if inj.latency, err = time.ParseDuration(cfg.Latency); err != nil || inj.latency < 0 {
+			return nil, fmt.Errorf("Invalid fault latency %s", cfg.Latency)
+		}
+	}
+	if cfg.Jitter != "" {
+		if inj.jitter, err = time.ParseDuration(cfg.Jitter); err != nil || inj.jitter < 0 {
+			return nil, fmt.Errorf("Invalid fault jitter %s", cfg.Jitter)
+		}
+	}
+	for _, rate := range []float64{cfg.ErrorRate, cfg.DuplicateRate} {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("Invalid fault rate %g, must be between 0 and 1", rate)
+		}
+	}
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	inj.rnd = rand.New(rand.NewSource(seed))
+
+	log.Printf("fault: injecting faults, latency %v, jitter %v, error rate %g, duplicate rate %g, seed %d",
+		inj.latency, inj.jitter, inj.errorRate, inj.duplicateRate, seed)
+	return inj, nil
+}
+
+// Blocks for the injected latency.
+func (i *Injector) Delay() {
+	if i == nil {
+		return
+	}
+	delay := i.latency
+	if i.jitter > 0 {
+		i.mu.Lock()
+		delay += time.Duration(i.rnd.Int63n(int64(i.jitter)))
+		i.mu.Unlock()
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// Returns ErrInjected at the error rate, otherwise nil.
+func (i *Injector) Err() error {
+	if i == nil || !i.chance(i.errorRate) {
+		return nil
+	}
+	return ErrInjected
+}
+
+// Returns true at the duplicate rate.
+func (i *Injector) Duplicate() bool {
+	return i != nil && i.chance(i.duplicateRate)
+}
+
+// Returns true with the probability of the rate.
+func (i *Injector) chance(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.rnd.Float64() < rate
+}
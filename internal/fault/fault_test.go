@@ -0,0 +1,49 @@
+package fault
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestInjectorRates(t *testing.T) {
+	inj, err := New(Config{ErrorRate: 0.5, DuplicateRate: 0.25, Seed: 1})
+	require.NoError(t, err, "Expect valid config")
+
+	errs, dups := 0, 0
+	for i := 0; i < 1000; i++ {
+		if err := inj.Err(); err != nil {
+			assert.Equal(t, ErrInjected, err, "Expect injected error")
+			errs++
+		}
+		if inj.Duplicate() {
+			dups++
+		}
+	}
+	assert.InDelta(t, 500, errs, 75, "Expect errors at rate")
+	assert.InDelta(t, 250, dups, 75, "Expect duplicates at rate")
+}
+
+func TestInjectorDelay(t *testing.T) {
+	inj, err := New(Config{Latency: "10ms", Jitter: "5ms"})
+	require.NoError(t, err, "Expect valid config")
+
+	started := time.Now()
+	inj.Delay()
+	assert.True(t, time.Now().Sub(started) >= 10*time.Millisecond, "Expect latency injected")
+}
+
+func TestNilInjector(t *testing.T) {
+	var inj *Injector
+	inj.Delay()
+	assert.NoError(t, inj.Err(), "Expect no error from nil injector")
+	assert.False(t, inj.Duplicate(), "Expect no duplicate from nil injector")
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, cfg := range []Config{{Latency: "x"}, {Jitter: "-1s"}, {ErrorRate: 1.5}, {DuplicateRate: -0.1}} {
+		_, err := New(cfg)
+		assert.Error(t, err, "Expect %v invalid", cfg)
+	}
+}
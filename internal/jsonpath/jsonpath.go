@@ -0,0 +1,178 @@
+package jsonpath
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Compiled JSONPath expression. Supports the root '$', child members '.name'
+// and "['name']", array indexes '[0]' and '[-1]', wildcards '.*' and '[*]', and
+// recursive descent '..name'. Filters, slices, and scripts are not supported.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Selector of a single step of a path.
+type segment struct {
+	// Selects from the node and all of its descendants, instead of only the node.
+	recursive bool
+
+	wildcard bool
+	name     string
+	index    int
+	isIndex  bool
+}
+
+// Compiles the JSONPath expression, returning an error if the expression is
+// invalid, or uses unsupported syntax.
+func Compile(expr string) (*Path, error) {
+	s := strings.TrimSpace(expr)
+	if !strings.HasPrefix(s, "$") {
+		return nil, fmt.Errorf("Invalid JSONPath %s, must start with $", expr)
+	}
+	s = s[1:]
+
+	p := &Path{expr: expr}
+	for len(s) > 0 {
+		seg := segment{}
+		switch {
+		case strings.HasPrefix(s, ".."):
+			seg.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(s, "."):
+			if !seg.recursive {
+				s = s[1:]
+			}
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			name := s[:end]
+			s = s[end:]
+			if name == "" {
+				return nil, fmt.Errorf("Invalid JSONPath %s, missing member name", expr)
+			}
+			if name == "*" {
+				seg.wildcard = true
+			} else {
+				seg.name = name
+			}
+			p.segments = append(p.segments, seg)
+			continue
+		case !strings.HasPrefix(s, "["):
+			return nil, fmt.Errorf("Invalid JSONPath %s, unexpected %q", expr, s)
+		}
+
+		// Bracket selector
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("Invalid JSONPath %s, missing ]", expr)
+		}
+		sel := strings.TrimSpace(s[1:end])
+		s = s[end+1:]
+		switch {
+		case sel == "*":
+			seg.wildcard = true
+		case len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0]:
+			seg.name = sel[1 : len(sel)-1]
+		default:
+			i, err := strconv.Atoi(sel)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid JSONPath %s, unsupported selector [%s]", expr, sel)
+			}
+			seg.index, seg.isIndex = i, true
+		}
+		p.segments = append(p.segments, seg)
+	}
+
+	return p, nil
+}
+
+// Returns the expression the path was compiled from.
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Returns the values the path selects from the document. The document is
+// expected to be decoded by encoding/json into an interface{}. Members of
+// objects selected by wildcards are returned in order of their names.
+func (p *Path) Eval(doc interface{}) []interface{} {
+	nodes := []interface{}{doc}
+	for _, seg := range p.segments {
+		if seg.recursive {
+			nodes = descendants(nodes)
+		}
+		next := []interface{}{}
+		for _, n := range nodes {
+			next = append(next, seg.children(n)...)
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Returns the children of the node selected by the segment.
+func (seg segment) children(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		if seg.wildcard {
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			children := make([]interface{}, 0, len(v))
+			for _, name := range names {
+				children = append(children, v[name])
+			}
+			return children
+		}
+		if c, ok := v[seg.name]; ok && !seg.isIndex {
+			return []interface{}{c}
+		}
+	case []interface{}:
+		if seg.wildcard {
+			return v
+		}
+		if seg.isIndex {
+			i := seg.index
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				return []interface{}{v[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the nodes and all of their descendants. Object members are in order
+// of their names.
+func descendants(nodes []interface{}) []interface{} {
+	all := []interface{}{}
+	for _, n := range nodes {
+		all = append(all, n)
+		switch v := n.(type) {
+		case map[string]interface{}:
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				all = append(all, descendants([]interface{}{v[name]})...)
+			}
+		case []interface{}:
+			all = append(all, descendants(v)...)
+		}
+	}
+	return all
+}
@@ -0,0 +1,51 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testDoc = `{
+	"links": {"next": "/api/items?page=2", "prev": null},
+	"items": [
+		{"id": 1, "name": "first", "url": "/api/items/1"},
+		{"id": 2, "name": "second", "url": "/api/items/2", "tags": {"url": "/api/tags/a"}}
+	],
+	"odd key": true
+}`
+
+func eval(t *testing.T, expr string) []interface{} {
+	var doc interface{}
+	require.NoError(t, json.Unmarshal([]byte(testDoc), &doc), "Expect valid test document")
+
+	p, err := Compile(expr)
+	require.NoError(t, err, "Expect %s to compile", expr)
+	assert.Equal(t, expr, p.String(), "Expect expression")
+	return p.Eval(doc)
+}
+
+func TestEval(t *testing.T) {
+	assert.Equal(t, []interface{}{"/api/items?page=2"}, eval(t, "$.links.next"), "Expect member")
+	assert.Equal(t, []interface{}{"/api/items?page=2"}, eval(t, "$['links'][\"next\"]"), "Expect bracket members")
+	assert.Equal(t, []interface{}{nil}, eval(t, "$.links.prev"), "Expect null member")
+	assert.Equal(t, []interface{}{true}, eval(t, "$['odd key']"), "Expect quoted member with space")
+	assert.Equal(t, []interface{}{"first"}, eval(t, "$.items[0].name"), "Expect index")
+	assert.Equal(t, []interface{}{"second"}, eval(t, "$.items[-1].name"), "Expect negative index")
+	assert.Equal(t, []interface{}{float64(1), float64(2)}, eval(t, "$.items[*].id"), "Expect array wildcard")
+	assert.Equal(t, []interface{}{"/api/items?page=2", nil}, eval(t, "$.links.*"), "Expect object wildcard in name order")
+	assert.Equal(t, []interface{}{"/api/items/1", "/api/items/2", "/api/tags/a"}, eval(t, "$..url"), "Expect recursive descent")
+	assert.Equal(t, []interface{}{"first"}, eval(t, "$..[0].name"), "Expect recursive bracket")
+	assert.Empty(t, eval(t, "$.missing.next"), "Expect missing member empty")
+	assert.Empty(t, eval(t, "$.items[5]"), "Expect out of range index empty")
+	assert.Empty(t, eval(t, "$.links[0]"), "Expect index of object empty")
+	assert.Len(t, eval(t, "$"), 1, "Expect root")
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, expr := range []string{"", "links.next", "$.", "$.items[", "$.items[?(@.id>1)]", "$.items[0:2]", "$items"} {
+		_, err := Compile(expr)
+		assert.Error(t, err, "Expect %s invalid", expr)
+	}
+}
@@ -0,0 +1,295 @@
+// Package jwt verifies JWT (RFC 7519) bearer tokens issued by an identity
+// provider, with the public keys the provider publishes as a JWKS (RFC 7517),
+// so requests can be authorized by an existing identity provider. Only tokens
+// signed with the RSA, and ECDSA algorithms are accepted.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Clock skew allowed between the issuer and verifier when validating the
+// expiry, and not before times of tokens.
+const Leeway = time.Minute
+
+// Timeout of the requests made for the issuer's configuration, and keys.
+const requestTimeout = 10 * time.Second
+
+// Configuration of the tokens accepted.
+type Config struct {
+	// Issuer tokens must be issued by, their 'iss' claim, e.g:
+	// https://login.example.com/. Tokens are not accepted if not set.
+	Issuer string `json:"issuer"`
+
+	// URL of the issuer's JWKS. If not set the JWKS URL is discovered from
+	// the issuer's OpenID configuration, <issuer>/.well-known/openid-configuration.
+	JWKSURL string `json:"jwksURL"`
+
+	// Audience tokens must be issued for, one of their 'aud' claim. Tokens
+	// of any audience are accepted if not set.
+	Audience string `json:"audience"`
+
+	// Interval the issuer's keys are requested again at. Keys not known are
+	// requested again immediately, e.g: when the issuer rotates keys.
+	// Defaults to DefaultRefresh. time.Duration string formated value, e.g: 1h
+	RefreshStr string `json:"jwksRefresh"`
+
+	// The RefreshStr will be parsed, and its value placed into this field.
+	Refresh time.Duration `json:"-"`
+}
+
+// Interval keys are requested again at if not configured.
+const DefaultRefresh = time.Hour
+
+// Returns true if tokens are accepted, the issuer is set.
+func (c Config) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// Parses the refresh interval if configured.
+func (c *Config) SetDefaults() error {
+	if c.RefreshStr == "" {
+		c.Refresh = DefaultRefresh
+		return nil
+	}
+	refresh, err := time.ParseDuration(c.RefreshStr)
+	if err != nil {
+		return fmt.Errorf("Invalid JWT jwksRefresh %q, %v", c.RefreshStr, err)
+	} else if refresh <= 0 {
+		return fmt.Errorf("Invalid JWT jwksRefresh %s, must be positive", c.RefreshStr)
+	}
+	c.Refresh = refresh
+	return nil
+}
+
+// Claims of a verified token.
+type Claims struct {
+	// Issuer of the token
+	Issuer string
+
+	// Who the token was issued to, e.g: a user, or client id
+	Subject string
+
+	// Audiences the token was issued for
+	Audience []string
+
+	// When the token expires
+	ExpiresAt time.Time
+}
+
+// Verifies tokens issued by the configuration's issuer.
+type Verifier struct {
+	issuer   string
+	audience string
+	keys     *keySet
+
+	// Returns the current time, replaced by tests
+	now func() time.Time
+}
+
+// Creates a verifier of the configuration's tokens. The issuer's keys are
+// requested once a token is verified.
+func NewVerifier(cfg Config) *Verifier {
+	client := &http.Client{Timeout: requestTimeout}
+	return &Verifier{
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		keys:     newKeySet(client, cfg.Issuer, cfg.JWKSURL, cfg.Refresh),
+		now:      time.Now,
+	}
+}
+
+// Algorithms tokens are accepted with, and the hash they are signed with.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// Header of a token
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Registered claims of a token validated. The audience is either a single
+// string, or an array of strings.
+type claims struct {
+	Iss string          `json:"iss"`
+	Sub string          `json:"sub"`
+	Aud json.RawMessage `json:"aud"`
+	Exp *json.Number    `json:"exp"`
+	Nbf *json.Number    `json:"nbf"`
+}
+
+// Returns true if the token is in the compact form of a JWT, three base64url
+// segments separated by periods. The token is not verified.
+func IsToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Verifies the token's signature with the issuer's keys, and that it was
+// issued by the issuer, for the audience, and is not expired. Returns the
+// token's claims.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token")
+	}
+
+	h := header{}
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("malformed token header, %v", err)
+	}
+	hash, ok := algorithms[h.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported token algorithm %q", h.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature, %v", err)
+	}
+
+	key, err := v.keys.key(h.Kid, h.Alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(key, hash, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	c := claims{}
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, fmt.Errorf("malformed token claims, %v", err)
+	}
+	return v.validate(c)
+}
+
+// Validates the token's registered claims.
+func (v *Verifier) validate(c claims) (*Claims, error) {
+	if c.Iss != v.issuer {
+		return nil, fmt.Errorf("token issued by %q, not %q", c.Iss, v.issuer)
+	}
+
+	aud, err := audience(c.Aud)
+	if err != nil {
+		return nil, err
+	}
+	if v.audience != "" && !contains(aud, v.audience) {
+		return nil, fmt.Errorf("token not issued for audience %q", v.audience)
+	}
+
+	now := v.now()
+	if c.Exp == nil {
+		return nil, fmt.Errorf("token has no expiry")
+	}
+	exp, err := numericDate(*c.Exp)
+	if err != nil {
+		return nil, err
+	}
+	if !now.Before(exp.Add(Leeway)) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if c.Nbf != nil {
+		nbf, err := numericDate(*c.Nbf)
+		if err != nil {
+			return nil, err
+		}
+		if now.Add(Leeway).Before(nbf) {
+			return nil, fmt.Errorf("token not valid yet")
+		}
+	}
+
+	return &Claims{Issuer: c.Iss, Subject: c.Sub, Audience: aud, ExpiresAt: exp}, nil
+}
+
+// Verifies the signature of the signed content with the public key.
+func verifySignature(key crypto.PublicKey, hash crypto.Hash, signed string, sig []byte) error {
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, sig); err != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+	case *ecdsa.PublicKey:
+		// ECDSA signatures are the R, and S values concatenated, each the
+		// size of the curve.
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return fmt.Errorf("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// Decodes the base64url JSON segment of a token into v.
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// Returns the audiences of the 'aud' claim, either a single string, or an
+// array of strings.
+func audience(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(raw, &multiple); err != nil {
+		return nil, fmt.Errorf("malformed token audience")
+	}
+	return multiple, nil
+}
+
+// Returns the time of the NumericDate, seconds since the epoch.
+func numericDate(n json.Number) (time.Time, error) {
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed token date %s", n)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(frac*float64(time.Second))).UTC(), nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
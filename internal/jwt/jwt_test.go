@@ -0,0 +1,121 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Signs the token of the header, and claims with the private key.
+func sign(t *testing.T, key crypto.Signer, header, claims map[string]interface{}) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+		require.NoError(t, err, "Expect RSA signature")
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		require.NoError(t, err, "Expect ECDSA signature")
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err, "Expect RSA key")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "Expect EC key")
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"jwks_uri": server.URL + "/keys"})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+				{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeInt(ecKey.X), "y": encodeInt(ecKey.Y)},
+				{"kty": "RSA", "kid": "enc", "use": "enc", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := NewVerifier(Config{Issuer: server.URL, Audience: "harvester"})
+	v.now = func() time.Time { return now }
+
+	valid := map[string]interface{}{"iss": server.URL, "sub": "user", "aud": []string{"other", "harvester"}, "exp": now.Add(time.Hour).Unix()}
+	claims, err := v.Verify(sign(t, rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, valid))
+	require.NoError(t, err, "Expect RSA token verified")
+	assert.Equal(t, "user", claims.Subject, "Expect token's subject")
+	assert.Equal(t, now.Add(time.Hour), claims.ExpiresAt, "Expect token's expiry")
+
+	_, err = v.Verify(sign(t, ecKey, map[string]interface{}{"alg": "ES256", "kid": "ec"}, valid))
+	assert.NoError(t, err, "Expect ECDSA token verified")
+
+	cases := []struct {
+		name   string
+		key    crypto.Signer
+		header map[string]interface{}
+		claims map[string]interface{}
+	}{
+		{"unsigned", rsaKey, map[string]interface{}{"alg": "none", "kid": "rsa"}, valid},
+		{"wrong key", ecKey, map[string]interface{}{"alg": "ES256", "kid": "rsa"}, valid},
+		{"unknown key", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "unknown"}, valid},
+		{"encryption key", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "enc"}, valid},
+		{"ambiguous key", rsaKey, map[string]interface{}{"alg": "RS256"}, valid},
+		{"other issuer", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"},
+			map[string]interface{}{"iss": "https://other.example.com", "aud": "harvester", "exp": now.Add(time.Hour).Unix()}},
+		{"other audience", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"},
+			map[string]interface{}{"iss": server.URL, "aud": "other", "exp": now.Add(time.Hour).Unix()}},
+		{"no expiry", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"},
+			map[string]interface{}{"iss": server.URL, "aud": "harvester"}},
+		{"expired", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"},
+			map[string]interface{}{"iss": server.URL, "aud": "harvester", "exp": now.Add(-2 * Leeway).Unix()}},
+		{"not yet valid", rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"},
+			map[string]interface{}{"iss": server.URL, "aud": "harvester", "exp": now.Add(time.Hour).Unix(), "nbf": now.Add(2 * Leeway).Unix()}},
+	}
+	for _, c := range cases {
+		_, err := v.Verify(sign(t, c.key, c.header, c.claims))
+		assert.Error(t, err, "Expect %s token refused", c.name)
+	}
+
+	// Expiry within the leeway is accepted.
+	_, err = v.Verify(sign(t, rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"},
+		map[string]interface{}{"iss": server.URL, "aud": "harvester", "exp": now.Add(-Leeway / 2).Unix()}))
+	assert.NoError(t, err, "Expect token expired within leeway verified")
+
+	token := sign(t, rsaKey, map[string]interface{}{"alg": "RS256", "kid": "rsa"}, valid)
+	_, err = v.Verify(token[:len(token)-4] + "AAAA")
+	assert.Error(t, err, "Expect token with modified signature refused")
+	assert.True(t, IsToken(token), "Expect token")
+	assert.False(t, IsToken("hv_0123"), "Expect API key not a token")
+}
@@ -0,0 +1,248 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shortest interval the keys are requested again at for an unknown key id,
+// so tokens of unknown keys can't flood the issuer with requests.
+const minRefresh = time.Minute
+
+// Maximum size of the issuer's configuration, and JWKS responses.
+const maxResponseSize = 1024 * 1024
+
+// JSON Web Key of a JWKS. Only the members of RSA, and EC public keys are
+// decoded.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+
+	// RSA modulus, and exponent
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC curve, and point
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Public key of the issuer, and the algorithm it is restricted to, if any.
+type publicKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// Keys of the issuer, requested from its JWKS URL, and cached for the
+// refresh interval.
+type keySet struct {
+	client  *http.Client
+	issuer  string
+	url     string
+	refresh time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]publicKey
+	fetchedOn time.Time
+}
+
+// Creates the key set of the JWKS URL. If the URL is empty it is discovered
+// from the issuer's OpenID configuration when the keys are first requested.
+func newKeySet(client *http.Client, issuer, url string, refresh time.Duration) *keySet {
+	if refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	return &keySet{client: client, issuer: issuer, url: url, refresh: refresh}
+}
+
+// Returns the key of the key id for the algorithm. If the token has no key id
+// the key set's only key is returned. The keys are requested again if they
+// were requested longer than the refresh interval ago, or the key id is not
+// known, at most once every minRefresh.
+func (s *keySet) key(kid, alg string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.find(kid)
+	age := time.Now().Sub(s.fetchedOn)
+	if s.keys == nil || age > s.refresh || (!ok && age > minRefresh) {
+		keys, err := s.fetch()
+		if err != nil && s.keys == nil {
+			return nil, err
+		} else if err == nil {
+			s.keys, s.fetchedOn = keys, time.Now()
+		}
+		k, ok = s.find(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown token key %q", kid)
+	}
+
+	if k.alg != "" && k.alg != alg {
+		return nil, fmt.Errorf("token key %q not for algorithm %s", kid, alg)
+	}
+	if !keyMatches(k.key, alg) {
+		return nil, fmt.Errorf("token key %q not for algorithm %s", kid, alg)
+	}
+	return k.key, nil
+}
+
+// Returns the key of the key id, or the only key if the key id is empty.
+func (s *keySet) find(kid string) (publicKey, bool) {
+	if kid == "" {
+		if len(s.keys) != 1 {
+			return publicKey{}, false
+		}
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+// Requests the issuer's JWKS, discovering its URL first if not known. Keys
+// which aren't signing keys, or of an unsupported type, are skipped.
+func (s *keySet) fetch() (map[string]publicKey, error) {
+	if s.url == "" {
+		u, err := s.discover()
+		if err != nil {
+			return nil, err
+		}
+		s.url = u
+	}
+
+	set := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := s.get(s.url, &set); err != nil {
+		return nil, fmt.Errorf("failed to get JWKS, %v", err)
+	}
+
+	keys := map[string]publicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+	}
+	return keys, nil
+}
+
+// Returns the JWKS URL of the issuer's OpenID configuration.
+func (s *keySet) discover() (string, error) {
+	cfg := struct {
+		JWKSURI string `json:"jwks_uri"`
+	}{}
+	u := strings.TrimSuffix(s.issuer, "/") + "/.well-known/openid-configuration"
+	if err := s.get(u, &cfg); err != nil {
+		return "", fmt.Errorf("failed to get issuer's OpenID configuration, %v", err)
+	}
+	if cfg.JWKSURI == "" {
+		return "", fmt.Errorf("issuer's OpenID configuration has no jwks_uri")
+	}
+	return cfg.JWKSURI, nil
+}
+
+// Requests the JSON document of the URL into v.
+func (s *keySet) get(u string, v interface{}) error {
+	resp, err := s.client.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %d", u, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// Returns the public key of the JWK.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid EC point")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+}
+
+// Returns true if the key is of the algorithm's type, and curve.
+func keyMatches(key crypto.PublicKey, alg string) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS")
+	case *ecdsa.PublicKey:
+		switch alg {
+		case "ES256":
+			return k.Curve == elliptic.P256()
+		case "ES384":
+			return k.Curve == elliptic.P384()
+		case "ES512":
+			return k.Curve == elliptic.P521()
+		}
+	}
+	return false
+}
+
+// Decodes the base64url big-endian integer.
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
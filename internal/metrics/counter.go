@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Count of events, e.g: recovered panics, in total, and by the label of
+// where each happened. Safe to be used across multiple go-routines.
+type Counter struct {
+	mu     sync.Mutex
+	total  int64
+	labels map[string]int64
+}
+
+// Creates a counter without any events counted.
+func NewCounter() *Counter {
+	return &Counter{labels: map[string]int64{}}
+}
+
+// Counts an event of the label. Empty labels are only counted in the total.
+func (c *Counter) Add(label string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total++
+	if label != "" {
+		c.labels[label]++
+	}
+}
+
+// Point in time counts of a counter.
+type CounterSnapshot struct {
+	Total  int64            `json:"total"`
+	Labels map[string]int64 `json:"labels"`
+}
+
+// Returns the counter's current counts.
+func (c *Counter) Snapshot() CounterSnapshot {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := CounterSnapshot{Total: c.total, Labels: make(map[string]int64, len(c.labels))}
+	for label, n := range c.labels {
+		s.Labels[label] = n
+	}
+	return s
+}
+
+// Returns the counter's snapshot as JSON, implementing expvar.Var.
+func (c *Counter) String() string {
+	b, err := json.Marshal(c.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter()
+	c.Add("parse")
+	c.Add("parse")
+	c.Add("persist")
+	c.Add("")
+
+	s := c.Snapshot()
+	assert.Equal(t, int64(4), s.Total, "Expect all events counted")
+	assert.Equal(t, map[string]int64{"parse": 2, "persist": 1}, s.Labels, "Expect events counted by label")
+
+	decoded := CounterSnapshot{}
+	require.NoError(t, json.Unmarshal([]byte(c.String()), &decoded), "Expect JSON snapshot")
+	assert.Equal(t, s, decoded)
+}
@@ -0,0 +1,106 @@
+// Package metrics provides the histograms the harvester services expose their
+// timings with. Histograms implement expvar.Var, so they are served as JSON
+// at /debug/vars once published.
+package metrics
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Upper bounds of the buckets durations are counted in if not provided.
+var DefaultBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// Histogram of durations counted into buckets of their upper bound. Safe to
+// be used across multiple go-routines.
+type Histogram struct {
+	buckets []time.Duration
+
+	mu     sync.Mutex
+	counts []int64
+	count  int64
+	sum    time.Duration
+}
+
+// Creates a histogram of the bucket upper bounds, which must be sorted.
+// Durations greater than the last bound are only counted in the total.
+func NewHistogram(buckets []time.Duration) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Histogram{buckets: buckets, counts: make([]int64, len(buckets))}
+}
+
+// Counts the duration in the histogram.
+func (h *Histogram) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.buckets {
+		if d <= b {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += d
+}
+
+// Point in time counts of a histogram.
+type Snapshot struct {
+	// Number of durations observed, and their sum in milliseconds.
+	Count int64   `json:"count"`
+	SumMs float64 `json:"sumMs"`
+
+	// Cumulative count of the durations less than or equal to each bucket's
+	// upper bound.
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Cumulative count of a histogram's bucket.
+type Bucket struct {
+	LE    string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+// Returns the histogram's current counts.
+func (h *Histogram) Snapshot() Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := Snapshot{
+		Count:   h.count,
+		SumMs:   float64(h.sum) / float64(time.Millisecond),
+		Buckets: make([]Bucket, len(h.buckets)),
+	}
+	var total int64
+	for i, b := range h.buckets {
+		total += h.counts[i]
+		s.Buckets[i] = Bucket{LE: b.String(), Count: total}
+	}
+	return s
+}
+
+// Returns the histogram's snapshot as JSON, implementing expvar.Var.
+func (h *Histogram) String() string {
+	b, err := json.Marshal(h.Snapshot())
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
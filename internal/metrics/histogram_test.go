@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram([]time.Duration{time.Millisecond, 10 * time.Millisecond})
+	h.Observe(500 * time.Microsecond)
+	h.Observe(time.Millisecond)
+	h.Observe(5 * time.Millisecond)
+	h.Observe(time.Second)
+
+	s := h.Snapshot()
+	assert.Equal(t, int64(4), s.Count, "Expect all durations counted")
+	assert.Equal(t, 1006.5, s.SumMs, "Expect sum of durations")
+	assert.Equal(t, []Bucket{{LE: "1ms", Count: 2}, {LE: "10ms", Count: 3}}, s.Buckets, "Expect cumulative bucket counts")
+}
+
+func TestHistogramString(t *testing.T) {
+	h := NewHistogram(nil)
+	h.Observe(2 * time.Millisecond)
+
+	s := Snapshot{}
+	require.NoError(t, json.Unmarshal([]byte(h.String()), &s), "Expect JSON snapshot")
+	assert.Equal(t, int64(1), s.Count, "Expect count")
+	assert.Len(t, s.Buckets, len(DefaultBuckets), "Expect default buckets")
+	assert.Equal(t, int64(0), s.Buckets[0].Count, "Expect duration not in 1ms bucket")
+	assert.Equal(t, int64(1), s.Buckets[1].Count, "Expect duration in 5ms bucket")
+}
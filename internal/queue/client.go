@@ -3,6 +3,7 @@ package queue
 import (
 	"github.com/apcera/nats"
 	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/fault"
 )
 
 // Client for communicating with th eNATS message queue. The publishers
@@ -50,14 +51,53 @@ type Receiver interface {
 
 // Creates a new Queue Publisher which is only able to send
 // to to topic provided. The Close of a
+//
+// If the configuration has faults, the publisher injects them into the items
+// it sends.
 func NewPublisher(cfg QueueConfig) (Publisher, error) {
+	if cfg.Faults != nil {
+		faults, err := fault.New(*cfg.Faults)
+		if err != nil {
+			return nil, err
+		}
+		c, err := newClient(cfg, true, false)
+		if err != nil {
+			return nil, err
+		}
+		return &faultPublisher{Publisher: c, faults: faults}, nil
+	}
 	return newClient(cfg, true, false)
 }
 
 // Creates a new Queue Receiver which is only able to receive from
 // the topic provided.
+//
+// If the configuration has faults, the receiver injects them into the items
+// it receives. If the configuration has a priority buffer, the received items
+// are reordered by their priority.
 func NewReceiver(cfg QueueConfig) (Receiver, error) {
-	return newClient(cfg, false, true)
+	var faults *fault.Injector
+	if cfg.Faults != nil {
+		var err error
+		if faults, err = fault.New(*cfg.Faults); err != nil {
+			return nil, err
+		}
+	}
+
+	var r Receiver
+	c, err := newClient(cfg, false, true)
+	if err != nil {
+		return nil, err
+	}
+	r = c
+
+	if faults != nil {
+		r = newFaultReceiver(r, faults)
+	}
+	if cfg.PriorityBuffer > 0 {
+		r = newPriorityReceiver(r, cfg.PriorityBuffer)
+	}
+	return r, nil
 }
 
 // Creates a new Queue Client. The client can be configured as a sender,
@@ -117,4 +157,14 @@ type QueueConfig struct {
 
 	// Connection URL to the messaging service.
 	ConnURL string `json:"connURL"`
+
+	// Faults injected into the items sent or received, for integration
+	// tests. No faults are injected if not set.
+	Faults *fault.Config `json:"faults,omitempty"`
+
+	// Number of received items buffered, so the items of higher priority
+	// jobs are received ahead of the buffered items of lower priorities.
+	// Only used by receivers, which receive items in the order they were
+	// sent if zero.
+	PriorityBuffer int `json:"priorityBuffer,omitempty"`
 }
@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/fault"
+	"log"
+)
+
+// Publisher injecting faults into the items it sends. Each item is delayed,
+// dropped at the error rate, and sent twice at the duplicate rate.
+type faultPublisher struct {
+	Publisher
+	faults *fault.Injector
+}
+
+// Sends the items to the topic, injecting faults.
+func (p *faultPublisher) Send(items ...*common.URLQueueItem) {
+	for _, item := range items {
+		p.faults.Delay()
+		if err := p.faults.Err(); err != nil {
+			log.Println("queue: dropping item", item.URLId, err)
+			continue
+		}
+		p.Publisher.Send(item)
+		if p.faults.Duplicate() {
+			dup := *item
+			p.Publisher.Send(&dup)
+		}
+	}
+}
+
+// Receiver injecting faults into the items it receives. Each item is delayed,
+// and received twice at the duplicate rate.
+type faultReceiver struct {
+	Receiver
+	recvCh chan *common.URLQueueItem
+}
+
+// Creates a receiver injecting faults into the items the receiver receives.
+func newFaultReceiver(r Receiver, faults *fault.Injector) *faultReceiver {
+	f := &faultReceiver{Receiver: r, recvCh: make(chan *common.URLQueueItem)}
+	go func() {
+		for item := range r.Receive() {
+			faults.Delay()
+			f.recvCh <- item
+			if faults.Duplicate() {
+				dup := *item
+				f.recvCh <- &dup
+			}
+		}
+		close(f.recvCh)
+	}()
+	return f
+}
+
+// Returns a read only channel of the received items, with faults injected.
+func (f *faultReceiver) Receive() <-chan *common.URLQueueItem {
+	return f.recvCh
+}
@@ -0,0 +1,64 @@
+package queue
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/fault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// Publisher recording the items sent.
+type recordPublisher struct {
+	sent []*common.URLQueueItem
+}
+
+func (p *recordPublisher) Close() {}
+
+func (p *recordPublisher) Send(items ...*common.URLQueueItem) {
+	p.sent = append(p.sent, items...)
+}
+
+// Receiver of the items of a channel.
+type chanReceiver chan *common.URLQueueItem
+
+func (r chanReceiver) Close() {}
+
+func (r chanReceiver) Receive() <-chan *common.URLQueueItem {
+	return r
+}
+
+func TestFaultPublisher(t *testing.T) {
+	faults, err := fault.New(fault.Config{DuplicateRate: 1})
+	require.NoError(t, err, "Expect valid config")
+
+	rec := &recordPublisher{}
+	p := &faultPublisher{Publisher: rec, faults: faults}
+	p.Send(&common.URLQueueItem{URLId: 1}, &common.URLQueueItem{URLId: 2})
+
+	require.Len(t, rec.sent, 4, "Expect every item duplicated")
+	assert.Equal(t, rec.sent[0].URLId, rec.sent[1].URLId, "Expect duplicate of first item")
+	assert.Equal(t, rec.sent[2].URLId, rec.sent[3].URLId, "Expect duplicate of second item")
+
+	faults, err = fault.New(fault.Config{ErrorRate: 1})
+	require.NoError(t, err, "Expect valid config")
+	rec = &recordPublisher{}
+	p = &faultPublisher{Publisher: rec, faults: faults}
+	p.Send(&common.URLQueueItem{URLId: 1})
+	assert.Empty(t, rec.sent, "Expect errored items dropped")
+}
+
+func TestFaultReceiver(t *testing.T) {
+	faults, err := fault.New(fault.Config{DuplicateRate: 1})
+	require.NoError(t, err, "Expect valid config")
+
+	ch := make(chanReceiver, 1)
+	ch <- &common.URLQueueItem{URLId: 3}
+	close(ch)
+
+	received := []common.URLId{}
+	for item := range newFaultReceiver(ch, faults).Receive() {
+		received = append(received, item.URLId)
+	}
+	assert.Equal(t, []common.URLId{3, 3}, received, "Expect item received twice")
+}
@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"sync"
+)
+
+// Number of items a memory queue topic buffers before its publishers block.
+const memoryTopicSize = 1024
+
+// In memory queue, for tests and single process deployments. Like the NATS
+// queue, receivers of the same topic compete for its items, so each item is
+// received by a single receiver, and items are received in the order they
+// were sent. Items are copied when sent, as they would be when encoded.
+type MemoryQueue struct {
+	mu     sync.Mutex
+	topics map[string]chan *common.URLQueueItem
+}
+
+// Creates a new empty memory queue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{topics: map[string]chan *common.URLQueueItem{}}
+}
+
+// Returns the channel of the topic, creating it if needed.
+func (q *MemoryQueue) topic(name string) chan *common.URLQueueItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ch, ok := q.topics[name]
+	if !ok {
+		ch = make(chan *common.URLQueueItem, memoryTopicSize)
+		q.topics[name] = ch
+	}
+	return ch
+}
+
+// Returns a publisher sending to the topic.
+func (q *MemoryQueue) Publisher(topic string) Publisher {
+	return memoryPublisher(q.topic(topic))
+}
+
+// Returns a receiver receiving from the topic.
+func (q *MemoryQueue) Receiver(topic string) Receiver {
+	return memoryReceiver(q.topic(topic))
+}
+
+type memoryPublisher chan *common.URLQueueItem
+
+// Closing a memory publisher has no effect, because other publishers may
+// still send to the topic.
+func (p memoryPublisher) Close() {}
+
+func (p memoryPublisher) Send(items ...*common.URLQueueItem) {
+	for _, item := range items {
+		sent := *item
+		p <- &sent
+	}
+}
+
+type memoryReceiver chan *common.URLQueueItem
+
+// Closing a memory receiver has no effect, because other receivers may
+// still receive from the topic.
+func (r memoryReceiver) Close() {}
+
+func (r memoryReceiver) Receive() <-chan *common.URLQueueItem {
+	return r
+}
@@ -0,0 +1,19 @@
+package queue_test
+
+import (
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/queue/queuetest"
+	"testing"
+)
+
+func TestMemoryQueueConformance(t *testing.T) {
+	q := queue.NewMemoryQueue()
+	queuetest.Run(t, queuetest.Driver{
+		NewPublisher: func(topic string) (queue.Publisher, error) {
+			return q.Publisher(topic), nil
+		},
+		NewReceiver: func(topic string) (queue.Receiver, error) {
+			return q.Receiver(topic), nil
+		},
+	})
+}
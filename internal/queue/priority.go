@@ -0,0 +1,98 @@
+package queue
+
+import (
+	"container/heap"
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Receiver reordering the items it receives by their priority. Up to its size
+// of items are buffered while the items are not being received fast enough,
+// and the buffered item of the highest priority is received first. Items of
+// the same priority are received in the order they were sent. Once the buffer
+// is full no more items are taken from the queue, leaving them for other
+// receivers of the topic.
+type priorityReceiver struct {
+	Receiver
+	recvCh chan *common.URLQueueItem
+}
+
+// Creates a receiver reordering the items the receiver receives, buffering
+// up to size items.
+func newPriorityReceiver(r Receiver, size int) *priorityReceiver {
+	p := &priorityReceiver{Receiver: r, recvCh: make(chan *common.URLQueueItem)}
+	go p.run(r.Receive(), size)
+	return p
+}
+
+// Buffers the items received until they are received from the reordered
+// channel. The reordered channel is closed once the received channel is
+// closed, and the buffered items have been received.
+func (p *priorityReceiver) run(in <-chan *common.URLQueueItem, size int) {
+	buf := &priorityItems{}
+	var seq uint64
+	for {
+		if in == nil && buf.Len() == 0 {
+			close(p.recvCh)
+			return
+		}
+
+		recv := in
+		if buf.Len() >= size {
+			recv = nil
+		}
+		var out chan<- *common.URLQueueItem
+		var next *common.URLQueueItem
+		if buf.Len() > 0 {
+			out, next = p.recvCh, buf.items[0].item
+		}
+
+		select {
+		case item, ok := <-recv:
+			if !ok {
+				in = nil
+				continue
+			}
+			seq++
+			heap.Push(buf, priorityItem{item: item, seq: seq})
+		case out <- next:
+			heap.Pop(buf)
+		}
+	}
+}
+
+// Returns a read only channel of the received items, reordered by priority.
+func (p *priorityReceiver) Receive() <-chan *common.URLQueueItem {
+	return p.recvCh
+}
+
+// Buffered item, and the order it was received in.
+type priorityItem struct {
+	item *common.URLQueueItem
+	seq  uint64
+}
+
+// Heap of the buffered items, highest priority, and earliest received first.
+type priorityItems struct {
+	items []priorityItem
+}
+
+func (h *priorityItems) Len() int { return len(h.items) }
+
+func (h *priorityItems) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if a.item.Priority != b.item.Priority {
+		return a.item.Priority > b.item.Priority
+	}
+	return a.seq < b.seq
+}
+
+func (h *priorityItems) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *priorityItems) Push(x interface{}) { h.items = append(h.items, x.(priorityItem)) }
+
+func (h *priorityItems) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items[len(h.items)-1] = priorityItem{}
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
@@ -0,0 +1,44 @@
+package queue
+
+import (
+	"container/heap"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPriorityItems(t *testing.T) {
+	sent := []*common.URLQueueItem{
+		{URLId: 1, Priority: common.PriorityLow},
+		{URLId: 2},
+		{URLId: 3, Priority: common.PriorityHigh},
+		{URLId: 4},
+		{URLId: 5, Priority: common.PriorityHigh},
+		{URLId: 6, Priority: common.PriorityLow},
+	}
+	h := &priorityItems{}
+	for i, item := range sent {
+		heap.Push(h, priorityItem{item: item, seq: uint64(i)})
+	}
+
+	received := []common.URLId{}
+	for h.Len() > 0 {
+		received = append(received, heap.Pop(h).(priorityItem).item.URLId)
+	}
+	assert.Equal(t, []common.URLId{3, 5, 2, 4, 1, 6}, received, "Expect items by priority, in the order sent")
+}
+
+func TestPriorityReceiverFullBuffer(t *testing.T) {
+	ch := make(chanReceiver, 3)
+	ch <- &common.URLQueueItem{URLId: 1}
+	ch <- &common.URLQueueItem{URLId: 2}
+	ch <- &common.URLQueueItem{URLId: 3, Priority: common.PriorityHigh}
+	close(ch)
+
+	r := newPriorityReceiver(ch, 1)
+	received := []common.URLId{}
+	for item := range r.Receive() {
+		received = append(received, item.URLId)
+	}
+	assert.Equal(t, []common.URLId{1, 2, 3}, received, "Expect items not buffered past the buffer size")
+}
@@ -0,0 +1,236 @@
+// Package queuetest is the conformance suite queue implementations must pass
+// to be used by the harvester services. Each implementation's tests call Run
+// with a Driver creating its publishers and receivers.
+//
+// The suite expects every published item to be received by a receiver of its
+// topic, and only of its topic. Items received by a single receiver from a
+// single publisher are in the order they were sent. Receivers of the same
+// topic compete for its items, so each item is received by one receiver.
+// Drivers which redeliver items must set AtLeastOnce, and are then expected
+// to deliver each item at least once, instead of exactly once. The services
+// tolerate redelivered items, because crawls are idempotent.
+package queuetest
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Longest an item is waited for to be received.
+const receiveTimeout = 5 * time.Second
+
+// Number of items sent by each test.
+const numItems = 50
+
+// Queue implementation under test.
+type Driver struct {
+	// Creates a publisher, and receiver of the topic. Topics are unique to
+	// each test.
+	NewPublisher func(topic string) (queue.Publisher, error)
+	NewReceiver  func(topic string) (queue.Receiver, error)
+
+	// If items may be redelivered, and received more than once.
+	AtLeastOnce bool
+
+	// Time waited after receivers are created before items are sent, for
+	// implementations which subscribe receivers asynchronously.
+	Settle time.Duration
+}
+
+// Runs the conformance suite against the queue implementation.
+func Run(t *testing.T, d Driver) {
+	prefix := "queuetest." + strconv.FormatInt(time.Now().UnixNano(), 36) + "."
+	tests := []struct {
+		name string
+		fn   func(*testing.T, Driver, string)
+	}{
+		{"Fields", testFields},
+		{"Ordering", testOrdering},
+		{"CompetingReceivers", testCompetingReceivers},
+		{"TopicIsolation", testTopicIsolation},
+	}
+	for _, test := range tests {
+		topic := prefix + test.name
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, d, topic)
+		})
+	}
+}
+
+// Returns a publisher, and the receivers of the topic, closing them once
+// the test completes.
+func open(t *testing.T, d Driver, topic string, receivers int) (queue.Publisher, []queue.Receiver) {
+	recvs := make([]queue.Receiver, receivers)
+	for i := range recvs {
+		r, err := d.NewReceiver(topic)
+		require.NoError(t, err, "Expect receiver of %s", topic)
+		recvs[i] = r
+	}
+	<-time.After(d.Settle)
+
+	p, err := d.NewPublisher(topic)
+	require.NoError(t, err, "Expect publisher of %s", topic)
+	return p, recvs
+}
+
+// Closes the publisher and receivers.
+func closeAll(p queue.Publisher, recvs []queue.Receiver) {
+	p.Close()
+	for _, r := range recvs {
+		r.Close()
+	}
+}
+
+// Returns the numbered items to send.
+func items(n int) []*common.URLQueueItem {
+	items := make([]*common.URLQueueItem, n)
+	for i := range items {
+		items[i] = &common.URLQueueItem{JobId: 1, OriginId: 2, URLId: common.URLId(i + 1), Level: 1}
+	}
+	return items
+}
+
+// Receives the items from the receivers until n distinct items are received,
+// or the timeout. Returns the URL ids of the items received by each receiver,
+// in the order received.
+func receive(t *testing.T, recvs []queue.Receiver, n int) [][]common.URLId {
+	var (
+		mu       sync.Mutex
+		received = make([][]common.URLId, len(recvs))
+		distinct = map[common.URLId]struct{}{}
+		done     = make(chan struct{})
+		isDone   bool
+		stop     = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	for i, r := range recvs {
+		wg.Add(1)
+		go func(i int, r queue.Receiver) {
+			defer wg.Done()
+			for {
+				select {
+				case item := <-r.Receive():
+					if item == nil {
+						return
+					}
+					mu.Lock()
+					received[i] = append(received[i], item.URLId)
+					distinct[item.URLId] = struct{}{}
+					if len(distinct) == n && !isDone {
+						isDone = true
+						close(done)
+					}
+					mu.Unlock()
+				case <-stop:
+					return
+				}
+			}
+		}(i, r)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(receiveTimeout):
+	}
+	// Wait for any redelivered or unexpected items.
+	<-time.After(100 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	require.Len(t, distinct, n, "Expect every item received")
+	return received
+}
+
+// Asserts each item is received once, unless the driver redelivers.
+func assertDelivery(t *testing.T, d Driver, received [][]common.URLId, n int) {
+	counts := map[common.URLId]int{}
+	for _, ids := range received {
+		for _, id := range ids {
+			counts[id]++
+		}
+	}
+	for id, count := range counts {
+		if d.AtLeastOnce {
+			assert.True(t, count >= 1, "Expect item %d received at least once", id)
+		} else {
+			assert.Equal(t, 1, count, "Expect item %d received once", id)
+		}
+	}
+	assert.Len(t, counts, n, "Expect every item received")
+}
+
+func testFields(t *testing.T, d Driver, topic string) {
+	p, recvs := open(t, d, topic, 1)
+	defer closeAll(p, recvs)
+
+	sent := &common.URLQueueItem{
+		JobId: 7, OriginId: 8, ReferId: 9, URLId: 10, Level: 2,
+		ForceCrawl: true, Delta: true, NoFetchCache: true, SkipAlternates: true, Download: true, Priority: common.PriorityHigh, MaxLevel: 3,
+	}
+	p.Send(sent)
+
+	select {
+	case item := <-recvs[0].Receive():
+		require.NotNil(t, item, "Expect item received")
+		assert.Equal(t, *sent, *item, "Expect all fields of item received")
+	case <-time.After(receiveTimeout):
+		t.Fatal("Expect item received")
+	}
+}
+
+func testOrdering(t *testing.T, d Driver, topic string) {
+	p, recvs := open(t, d, topic, 1)
+	defer closeAll(p, recvs)
+
+	sent := items(numItems)
+	p.Send(sent[:numItems/2]...)
+	for _, item := range sent[numItems/2:] {
+		p.Send(item)
+	}
+	received := receive(t, recvs, numItems)
+	assertDelivery(t, d, received, numItems)
+
+	// Redelivered items may be received again later, so only the first
+	// receipt of each item is ordered.
+	first := []common.URLId{}
+	seen := map[common.URLId]struct{}{}
+	for _, id := range received[0] {
+		if _, ok := seen[id]; !ok {
+			seen[id] = struct{}{}
+			first = append(first, id)
+		}
+	}
+	for i, id := range first {
+		assert.Equal(t, common.URLId(i+1), id, "Expect items received in order sent")
+	}
+}
+
+func testCompetingReceivers(t *testing.T, d Driver, topic string) {
+	p, recvs := open(t, d, topic, 3)
+	defer closeAll(p, recvs)
+
+	p.Send(items(numItems)...)
+	assertDelivery(t, d, receive(t, recvs, numItems), numItems)
+}
+
+func testTopicIsolation(t *testing.T, d Driver, topic string) {
+	p, recvs := open(t, d, topic, 1)
+	defer closeAll(p, recvs)
+	other, otherRecvs := open(t, d, topic+".other", 1)
+	defer closeAll(other, otherRecvs)
+
+	p.Send(items(1)...)
+	receive(t, recvs, 1)
+
+	select {
+	case item := <-otherRecvs[0].Receive():
+		t.Errorf("Expect no items received from other topic, received %v", item)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
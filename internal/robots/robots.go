@@ -0,0 +1,338 @@
+package robots
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximum size of a robots.txt file which will be parsed. Content after the
+// limit is ignored, matching the limit crawlers are expected to support.
+const MaxRobotsSize = 500 * 1024
+
+// Parsed robots.txt file of a host. Rules are matched following the Robots
+// Exclusion Protocol as implemented by Google's reference parser. The group
+// with the most specific matching user agent is used, where groups listing the
+// same user agent are combined. The longest matching rule wins, and allow wins
+// over disallow if matching rules are the same length.
+type Robots struct {
+	// URLs of the sitemaps listed by the robots.txt. Sitemaps are not part
+	// of any group, and apply to all user agents.
+	Sitemaps []string
+
+	groups []*group
+
+	// If all URLs are disallowed, because the robots.txt could not be
+	// requested due to a server error.
+	disallowAll bool
+}
+
+// Group of rules for one or more user agents.
+type group struct {
+	agents []string
+	rules  []rule
+
+	// Delay between requests. Only set if hasCrawlDelay is true.
+	crawlDelay    time.Duration
+	hasCrawlDelay bool
+}
+
+// Allow or disallow rule of a group.
+type rule struct {
+	pattern string
+	allow   bool
+}
+
+// Parses the content of a robots.txt file. Lines which are not valid directives
+// are ignored, as are rules which are not part of a group.
+func Parse(r io.Reader) *Robots {
+	robots := &Robots{}
+
+	var g *group
+	inAgents := false
+	scanner := bufio.NewScanner(io.LimitReader(r, MaxRobotsSize))
+	for scanner.Scan() {
+		key, value, ok := parseLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "user-agent":
+			// Consecutive user agent lines share the same group.
+			if !inAgents {
+				g = &group{}
+				robots.groups = append(robots.groups, g)
+				inAgents = true
+			}
+			g.agents = append(g.agents, userAgentToken(value))
+			continue
+		case "sitemap":
+			if value != "" {
+				robots.Sitemaps = append(robots.Sitemaps, value)
+			}
+			continue
+		case "allow", "disallow", "crawl-delay":
+			// Rules end the group's user agents, so a following user
+			// agent line starts a new group.
+			inAgents = false
+		default:
+			continue
+		}
+
+		if g == nil {
+			continue
+		}
+		switch key {
+		case "allow":
+			g.rules = append(g.rules, rule{pattern: normalizePath(value), allow: true})
+		case "disallow":
+			// An empty disallow rule allows everything, which is the default.
+			if value != "" {
+				g.rules = append(g.rules, rule{pattern: normalizePath(value)})
+			}
+		case "crawl-delay":
+			if d, err := strconv.ParseFloat(value, 64); err == nil && d >= 0 {
+				g.crawlDelay = time.Duration(d * float64(time.Second))
+				g.hasCrawlDelay = true
+			}
+		}
+	}
+
+	return robots
+}
+
+// Splits the line into its lower case key, and value without comments. False
+// is returned if the line does not contain a directive.
+func parseLine(line string) (key, value string, ok bool) {
+	if i := strings.Index(line, "#"); i >= 0 {
+		line = line[:i]
+	}
+	i := strings.Index(line, ":")
+	if i < 0 {
+		// Google also accepts a directive separated by whitespace instead
+		// of a colon, e.g: "Disallow /path".
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return "", "", false
+		}
+		return strings.ToLower(fields[0]), fields[1], true
+	}
+
+	key = strings.ToLower(strings.TrimSpace(line[:i]))
+	if key == "" {
+		return "", "", false
+	}
+	switch key {
+	case "useragent", "user agent":
+		key = "user-agent"
+	case "dissallow", "dissalow", "disalow", "diasllow", "disallaw":
+		key = "disallow"
+	case "site-map":
+		key = "sitemap"
+	}
+	return key, strings.TrimSpace(line[i+1:]), true
+}
+
+// Returns the product token of the user agent, the leading letters, '-', and
+// '_' characters. e.g: "Googlebot/2.1" is "googlebot". Tokens are compared case
+// insensitively, so are returned lower case.
+func userAgentToken(agent string) string {
+	agent = strings.TrimSpace(agent)
+	if strings.HasPrefix(agent, "*") {
+		return "*"
+	}
+	end := 0
+	for end < len(agent) {
+		c := agent[end]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-' || c == '_') {
+			break
+		}
+		end++
+	}
+	return strings.ToLower(agent[:end])
+}
+
+// Returns true if the user agent is allowed to crawl the URL. The URL may be
+// absolute, or a path with optional query. The robots.txt itself is always
+// allowed.
+func (r *Robots) Allowed(userAgent, rawURL string) bool {
+	path := pathOf(rawURL)
+	if path == "/robots.txt" {
+		return true
+	}
+	if r.disallowAll {
+		return false
+	}
+
+	var best *rule
+	for _, g := range r.agentGroups(userAgent) {
+		for i := range g.rules {
+			ru := &g.rules[i]
+			if !match(path, ru.pattern) {
+				continue
+			}
+			if best == nil || len(ru.pattern) > len(best.pattern) ||
+				(len(ru.pattern) == len(best.pattern) && ru.allow) {
+				best = ru
+			}
+		}
+	}
+
+	return best == nil || best.allow
+}
+
+// Returns the delay the user agent must wait between requests to the host, and
+// true if the robots.txt set a delay for the user agent.
+func (r *Robots) CrawlDelay(userAgent string) (time.Duration, bool) {
+	for _, g := range r.agentGroups(userAgent) {
+		if g.hasCrawlDelay {
+			return g.crawlDelay, true
+		}
+	}
+	return 0, false
+}
+
+// Returns the groups which apply to the user agent. The groups listing the user
+// agent's product token are used if there are any, otherwise the global groups
+// listing '*'.
+func (r *Robots) agentGroups(userAgent string) []*group {
+	token := userAgentToken(userAgent)
+
+	var specific, global []*group
+	for _, g := range r.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				global = append(global, g)
+				break
+			} else if agent != "" && agent == token {
+				specific = append(specific, g)
+				break
+			}
+		}
+	}
+
+	if len(specific) > 0 {
+		return specific
+	}
+	return global
+}
+
+// Returns true if the pattern matches the beginning of the path. The pattern
+// may contain '*' matching any sequence of characters, and end with '$' to
+// only match the end of the path.
+func match(path, pattern string) bool {
+	// Positions in the path the pattern has matched up to so far, in
+	// ascending order.
+	pos := []int{0}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '$' && i == len(pattern)-1 {
+			return pos[len(pos)-1] == len(path)
+		}
+
+		if c == '*' {
+			next := make([]int, 0, len(path)-pos[0]+1)
+			for p := pos[0]; p <= len(path); p++ {
+				next = append(next, p)
+			}
+			pos = next
+			continue
+		}
+
+		next := make([]int, 0, len(pos))
+		for _, p := range pos {
+			if p < len(path) && path[p] == c {
+				next = append(next, p+1)
+			}
+		}
+		if len(next) == 0 {
+			return false
+		}
+		pos = next
+	}
+	return true
+}
+
+// Returns the path and query of the URL, normalized so it can be matched
+// against rules.
+func pathOf(rawURL string) string {
+	path := rawURL
+	if u, err := url.Parse(rawURL); err == nil && (u.Scheme != "" || u.Host != "") {
+		path = u.EscapedPath()
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+	}
+	if path == "" {
+		path = "/"
+	}
+	return normalizePath(path)
+}
+
+// Percent encodes the non-ASCII characters of the path or pattern, and upper
+// cases existing percent encodings, so equivalent paths and patterns match.
+func normalizePath(path string) string {
+	const hex = "0123456789ABCDEF"
+
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c >= 0x80:
+			buf = append(buf, '%', hex[c>>4], hex[c&0xf])
+		case c == '%' && i+2 < len(path) && isHex(path[i+1]) && isHex(path[i+2]):
+			buf = append(buf, '%', upper(path[i+1]), upper(path[i+2]))
+			i += 2
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+func upper(c byte) byte {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+// Requests the robots.txt of the URL's host. A robots.txt which doesn't exist,
+// or can't be requested due to a client error, allows all URLs. A server error
+// or too many requests response disallows all URLs, because the host may be
+// unable to handle the load of being crawled. An error is returned if the request could not be made.
+func Fetch(client *http.Client, rawURL string) (*Robots, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("URL %s has no host", rawURL)
+	}
+	robotsURL := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}).String()
+
+	resp, err := client.Get(robotsURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return &Robots{disallowAll: true}, nil
+	case resp.StatusCode >= 300:
+		return &Robots{}, nil
+	}
+
+	return Parse(resp.Body), nil
+}
@@ -0,0 +1,256 @@
+package robots
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Cases are adapted from Google's robots.txt reference parser test suite.
+type allowedCase struct {
+	robots string
+	agent  string
+	url    string
+	expect bool
+}
+
+func assertAllowed(t *testing.T, cases []allowedCase) {
+	for _, c := range cases {
+		r := Parse(strings.NewReader(c.robots))
+		assert.Equal(t, c.expect, r.Allowed(c.agent, c.url), "Expect %s allowed %t for %s with:\n%s", c.url, c.expect, c.agent, c.robots)
+	}
+}
+
+func TestAllowedLineSyntax(t *testing.T) {
+	assertAllowed(t, []allowedCase{
+		// Lines which aren't directives are ignored.
+		{"foo: FooBot\nbar: /\n", "FooBot", "http://foo.bar/x/y", true},
+		// Whitespace separated directives are accepted.
+		{"user-agent FooBot\ndisallow /\n", "FooBot", "http://foo.bar/x/y", false},
+		// Comments are ignored.
+		{"user-agent: FooBot # a comment\ndisallow: / # another\n", "FooBot", "http://foo.bar/x/y", false},
+		{"# user-agent: FooBot\n# disallow: /\n", "FooBot", "http://foo.bar/x/y", true},
+		// Common typos of directive keys are accepted.
+		{"useragent: FooBot\ndissallow: /\n", "FooBot", "http://foo.bar/x/y", false},
+		// Keys are case insensitive.
+		{"USER-AGENT: FooBot\nDisAllow: /\n", "FooBot", "http://foo.bar/x/y", false},
+		// Windows line endings.
+		{"user-agent: FooBot\r\ndisallow: /\r\n", "FooBot", "http://foo.bar/x/y", false},
+	})
+}
+
+func TestAllowedGroups(t *testing.T) {
+	robots := `allow: /foo/bar/
+
+user-agent: FooBot
+disallow: /
+allow: /x/
+user-agent: BarBot
+disallow: /
+allow: /y/
+
+
+allow: /w/
+user-agent: BazBot
+
+user-agent: FooBot
+allow: /z/
+disallow: /
+`
+	assertAllowed(t, []allowedCase{
+		{robots, "FooBot", "http://foo.bar/x/b", true},
+		{robots, "FooBot", "http://foo.bar/z/d", true},
+		{robots, "FooBot", "http://foo.bar/y/c", false},
+		{robots, "BarBot", "http://foo.bar/y/c", true},
+		{robots, "BarBot", "http://foo.bar/w/a", true},
+		{robots, "BarBot", "http://foo.bar/z/d", false},
+		{robots, "BazBot", "http://foo.bar/z/d", true},
+		// Rules before any user agent are ignored.
+		{robots, "FooBot", "http://foo.bar/foo/bar/", false},
+		{robots, "BarBot", "http://foo.bar/foo/bar/", false},
+		{robots, "BazBot", "http://foo.bar/foo/bar/", false},
+	})
+
+	// Sitemap lines do not end a group's user agents.
+	robots = "user-agent: FooBot\nsitemap: http://foo.bar/sitemap.xml\nuser-agent: BarBot\ndisallow: /\n"
+	assertAllowed(t, []allowedCase{
+		{robots, "FooBot", "http://foo.bar/x", false},
+		{robots, "BarBot", "http://foo.bar/x", false},
+	})
+}
+
+func TestAllowedUserAgent(t *testing.T) {
+	assertAllowed(t, []allowedCase{
+		// User agents are case insensitive.
+		{"USER-AGENT: FOO BAR\ndisallow: /x/\n", "foo", "http://foo.bar/x/y", false},
+		{"user-agent: foo bar\ndisallow: /x/\n", "FOO", "http://foo.bar/x/y", false},
+		// Only the product token of the user agent is matched.
+		{"user-agent: FooBot/1.0\ndisallow: /\n", "FooBot", "http://foo.bar/x/y", false},
+		{"user-agent: FooBot\ndisallow: /\n", "FooBot/2.1 (+http://foo.bar)", "http://foo.bar/x/y", false},
+		{"user-agent: Foo Bar\ndisallow: /\n", "Foo Bar", "http://foo.bar/x/y", false},
+		{"user-agent: FooBot\ndisallow: /\n", "FooBotExtra", "http://foo.bar/x/y", true},
+	})
+}
+
+func TestAllowedGlobalGroups(t *testing.T) {
+	empty := ""
+	global := "user-agent: *\nallow: /\nuser-agent: FooBot\ndisallow: /\n"
+	onlySpecific := "user-agent: FooBot\nallow: /\nuser-agent: BarBot\ndisallow: /\nuser-agent: BazBot\ndisallow: /\n"
+	assertAllowed(t, []allowedCase{
+		{empty, "FooBot", "http://foo.bar/x/y", true},
+		{global, "FooBot", "http://foo.bar/x/y", false},
+		{global, "QuxBot", "http://foo.bar/x/y", true},
+		{onlySpecific, "QuxBot", "http://foo.bar/x/y", true},
+	})
+
+	// The global group is ignored if a specific group matches, even if the
+	// specific group has no rules.
+	assertAllowed(t, []allowedCase{
+		{"user-agent: *\ndisallow: /\nuser-agent: FooBot\n", "FooBot", "http://foo.bar/x", true},
+		{"user-agent: *\ndisallow: /\nuser-agent: FooBot\n", "BarBot", "http://foo.bar/x", false},
+	})
+}
+
+func TestAllowedValueCase(t *testing.T) {
+	assertAllowed(t, []allowedCase{
+		{"user-agent: FooBot\ndisallow: /x/\n", "FooBot", "http://foo.bar/x/y", false},
+		{"user-agent: FooBot\ndisallow: /X/\n", "FooBot", "http://foo.bar/x/y", true},
+	})
+}
+
+func TestAllowedLongestMatch(t *testing.T) {
+	url := "http://foo.bar/x/page.html"
+	assertAllowed(t, []allowedCase{
+		{"user-agent: FooBot\ndisallow: /x/page.html\nallow: /x/page.html\n", "FooBot", url, true},
+		{"user-agent: FooBot\nallow: /x/page.html\ndisallow: /x/\n", "FooBot", url, true},
+		{"user-agent: FooBot\nallow: /x/page.html\ndisallow: /x/\n", "FooBot", "http://foo.bar/x/", false},
+		// An empty disallow allows everything.
+		{"user-agent: FooBot\ndisallow: \nallow: \n", "FooBot", url, true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /\n", "FooBot", url, true},
+		{"user-agent: FooBot\ndisallow: /x\nallow: /x/\n", "FooBot", "http://foo.bar/x", false},
+		{"user-agent: FooBot\ndisallow: /x\nallow: /x/\n", "FooBot", "http://foo.bar/x/", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /page\n", "FooBot", "http://foo.bar/page", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /page\n", "FooBot", "http://foo.bar/pages", true},
+		{"user-agent: FooBot\ndisallow: /*.html\nallow: /page\n", "FooBot", "http://foo.bar/page.html", false},
+		{"user-agent: FooBot\nallow: /page\ndisallow: /*.html\n", "FooBot", "http://foo.bar/page", true},
+		// Rules of groups listing the same user agent are combined.
+		{"user-agent: FooBot\nallow: /x/page.\nuser-agent: FooBot\ndisallow: /x/page.html\n", "FooBot", url, false},
+		{"user-agent: FooBot\nallow: /x/page.html\nuser-agent: FooBot\ndisallow: /x/\n", "FooBot", url, true},
+	})
+}
+
+func TestAllowedWildcards(t *testing.T) {
+	assertAllowed(t, []allowedCase{
+		{"user-agent: FooBot\ndisallow: /\nallow: /fish*.php\n", "FooBot", "http://foo.bar/fish.php", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /fish*.php\n", "FooBot", "http://foo.bar/fishheads/catfish.php?parameters", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /fish*.php\n", "FooBot", "http://foo.bar/Fish.PHP", false},
+		{"user-agent: FooBot\ndisallow: /\nallow: /*.php$\n", "FooBot", "http://foo.bar/filename.php", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /*.php$\n", "FooBot", "http://foo.bar/folder/filename.php", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /*.php$\n", "FooBot", "http://foo.bar/filename.php?parameters", false},
+		{"user-agent: FooBot\ndisallow: /\nallow: /*.php$\n", "FooBot", "http://foo.bar/filename.php/", false},
+		{"user-agent: FooBot\ndisallow: /\nallow: /*.php$\n", "FooBot", "http://foo.bar/filename.php5", false},
+		{"user-agent: FooBot\ndisallow: /\nallow: /fish$\n", "FooBot", "http://foo.bar/fish", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /fish$\n", "FooBot", "http://foo.bar/fish.html", false},
+		{"user-agent: FooBot\ndisallow: /\nallow: /fish$\n", "FooBot", "http://foo.bar/fish?foo=bar", false},
+		// A '$' before the end of the pattern is not an anchor.
+		{"user-agent: FooBot\ndisallow: /x$y\n", "FooBot", "http://foo.bar/x$y/z", false},
+		{"user-agent: FooBot\ndisallow: /*x*y*\n", "FooBot", "http://foo.bar/axbyc", false},
+		{"user-agent: FooBot\ndisallow: /*x*y*\n", "FooBot", "http://foo.bar/aybxc", true},
+		{"user-agent: FooBot\ndisallow: /**\n", "FooBot", "http://foo.bar/", false},
+	})
+}
+
+func TestAllowedEncoding(t *testing.T) {
+	assertAllowed(t, []allowedCase{
+		// Non-ASCII characters of rules are percent encoded.
+		{"user-agent: FooBot\ndisallow: /\nallow: /foo/bar/ツ\n", "FooBot", "http://foo.bar/foo/bar/%E3%83%84", true},
+		{"user-agent: FooBot\ndisallow: /\nallow: /foo/bar/%E3%83%84\n", "FooBot", "http://foo.bar/foo/bar/%E3%83%84", true},
+		// Percent encodings are matched case insensitively.
+		{"user-agent: FooBot\ndisallow: /\nallow: /foo/bar/%e3%83%84\n", "FooBot", "http://foo.bar/foo/bar/%E3%83%84", true},
+		// Encoded and unencoded ASCII characters are not the same.
+		{"user-agent: FooBot\ndisallow: /\nallow: /foo/bar/%62%61%7A\n", "FooBot", "http://foo.bar/foo/bar/baz", false},
+		// Paths without a URL are matched as is.
+		{"user-agent: FooBot\ndisallow: /x\n", "FooBot", "/x?y", false},
+		{"user-agent: FooBot\ndisallow: /\n", "FooBot", "http://foo.bar", false},
+	})
+}
+
+func TestAllowedRobotsTxt(t *testing.T) {
+	r := Parse(strings.NewReader("user-agent: *\ndisallow: /\n"))
+	assert.True(t, r.Allowed("FooBot", "http://foo.bar/robots.txt"), "Expect robots.txt always allowed")
+	assert.False(t, r.Allowed("FooBot", "http://foo.bar/robots.txt.bak"), "Expect other URLs disallowed")
+}
+
+func TestCrawlDelay(t *testing.T) {
+	r := Parse(strings.NewReader(`user-agent: *
+crawl-delay: 10
+
+user-agent: FooBot
+crawl-delay: 0.5
+disallow: /x
+
+user-agent: BarBot
+disallow: /
+`))
+
+	d, ok := r.CrawlDelay("FooBot/1.0")
+	assert.True(t, ok, "Expect FooBot crawl delay")
+	assert.Equal(t, 500*time.Millisecond, d, "Expect fractional delay")
+
+	d, ok = r.CrawlDelay("QuxBot")
+	assert.True(t, ok, "Expect global crawl delay")
+	assert.Equal(t, 10*time.Second, d, "Expect global delay")
+
+	_, ok = r.CrawlDelay("BarBot")
+	assert.False(t, ok, "Expect no BarBot crawl delay, not the global delay")
+
+	_, ok = Parse(strings.NewReader("user-agent: *\ncrawl-delay: soon\n")).CrawlDelay("FooBot")
+	assert.False(t, ok, "Expect invalid delay ignored")
+}
+
+func TestSitemaps(t *testing.T) {
+	r := Parse(strings.NewReader(`Sitemap: http://foo.bar/sitemap.xml
+user-agent: FooBot
+disallow: /x
+SITEMAP: http://foo.bar/news.xml # news
+sitemap:
+`))
+	assert.Equal(t, []string{"http://foo.bar/sitemap.xml", "http://foo.bar/news.xml"}, r.Sitemaps, "Expect sitemaps of all groups")
+	assert.False(t, r.Allowed("FooBot", "http://foo.bar/x"), "Expect sitemap not to end group")
+}
+
+func TestFetch(t *testing.T) {
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte("user-agent: *\ndisallow: /private\nsitemap: http://foo.bar/sitemap.xml\n"))
+	}))
+	defer ts.Close()
+
+	r, err := Fetch(http.DefaultClient, ts.URL+"/some/page")
+	require.NoError(t, err, "Expect robots.txt fetched")
+	assert.False(t, r.Allowed("FooBot", ts.URL+"/private/page"), "Expect private disallowed")
+	assert.True(t, r.Allowed("FooBot", ts.URL+"/public"), "Expect public allowed")
+	assert.Equal(t, []string{"http://foo.bar/sitemap.xml"}, r.Sitemaps, "Expect sitemap")
+
+	status = http.StatusNotFound
+	r, err = Fetch(http.DefaultClient, ts.URL)
+	require.NoError(t, err, "Expect missing robots.txt not to fail")
+	assert.True(t, r.Allowed("FooBot", ts.URL+"/private/page"), "Expect missing robots.txt to allow all")
+
+	status = http.StatusServiceUnavailable
+	r, err = Fetch(http.DefaultClient, ts.URL)
+	require.NoError(t, err, "Expect unavailable robots.txt not to fail")
+	assert.False(t, r.Allowed("FooBot", ts.URL+"/public"), "Expect unavailable robots.txt to disallow all")
+
+	_, err = Fetch(http.DefaultClient, "/no/host")
+	assert.Error(t, err, "Expect URL without host to fail")
+}
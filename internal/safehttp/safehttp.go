@@ -0,0 +1,84 @@
+// Package safehttp provides an HTTP client for requesting URLs given by users,
+// e.g. a site's verification token or a webhook. The client refuses to connect
+// to loopback, private, link-local, and other non public addresses, so the
+// services cannot be used to reach internal hosts, and refuses redirects to a
+// host other than the one requested.
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// Returned when a request would connect to an address which is not public.
+var ErrPrivateAddress = errors.New("safehttp: address is not public")
+
+// Returned when a request is redirected to a different host.
+var ErrRedirectHost = errors.New("safehttp: redirect to a different host")
+
+// Maximum number of redirects followed, the same as the default client.
+const maxRedirects = 10
+
+// Creates a client with the timeout which only connects to public addresses,
+// and only follows redirects to the requested host.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   dialControl,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: checkRedirect,
+	}
+}
+
+// Checks the address being connected to after it is resolved, so a host
+// resolving to a private address, or re-resolving to one, is refused.
+func dialControl(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%v, %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+// Refuses redirects to a host other than the original request's.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if req.URL.Host != via[0].URL.Host {
+		return fmt.Errorf("%v, %s", ErrRedirectHost, req.URL.Host)
+	}
+	return nil
+}
+
+// Returns if the IP is a public unicast address, and not a loopback, private,
+// link-local, unspecified, or multicast address.
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	// IPv4 shared address space, and the "this network" range.
+	if ip4 := ip.To4(); ip4 != nil {
+		if ip4[0] == 0 || (ip4[0] == 100 && ip4[1]&0xc0 == 64) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package safehttp
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := []struct {
+		IP     string
+		Public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"fc00::1", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Public, IsPublicIP(net.ParseIP(c.IP)), c.IP)
+	}
+}
+
+func TestClientRefusesPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	_, err := NewClient(time.Second).Get(server.URL)
+	assert.Error(t, err, "Expect loopback address refused")
+	assert.Contains(t, err.Error(), ErrPrivateAddress.Error())
+}
+
+func TestCheckRedirect(t *testing.T) {
+	req := func(u string) *http.Request {
+		parsed, _ := url.Parse(u)
+		return &http.Request{URL: parsed}
+	}
+	via := []*http.Request{req("http://example.com/a")}
+
+	assert.NoError(t, checkRedirect(req("https://example.com/b"), via), "Expect same host redirect followed")
+	assert.Error(t, checkRedirect(req("http://other.example.com/b"), via), "Expect other host redirect refused")
+	assert.Error(t, checkRedirect(req("http://example.com:8080/b"), via), "Expect other port redirect refused")
+}
@@ -0,0 +1,115 @@
+package sitemap
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Maximum number of sitemap files which will be fetched when following
+// a sitemap index. Prevents runaway or circular sitemap indexes.
+const MaxSitemaps = 50
+
+// Maximum size of a single sitemap file. Matches the sitemap protocol's
+// uncompressed size limit.
+const MaxSitemapSize = 50 * 1024 * 1024
+
+// URL entry of a sitemap, or a sitemap entry of a sitemap index.
+type URL struct {
+	// Location of the URL
+	Loc string `xml:"loc"`
+
+	// Date the URL's content was last modified, if provided.
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Root element of a sitemap urlset or sitemapindex document.
+type document struct {
+	XMLName  xml.Name
+	URLs     []URL `xml:"url"`
+	Sitemaps []URL `xml:"sitemap"`
+}
+
+// Parses a sitemap document. A sitemap urlset document's URLs will be
+// returned as the urls, where a sitemapindex's entries will be returned
+// as sitemaps.
+func Parse(r io.Reader) (urls []URL, sitemaps []URL, err error) {
+	doc := document{}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset":
+		return trimURLs(doc.URLs), nil, nil
+	case "sitemapindex":
+		return nil, trimURLs(doc.Sitemaps), nil
+	default:
+		return nil, nil, fmt.Errorf("Unknown sitemap root element %s", doc.XMLName.Local)
+	}
+}
+
+// Requests the sitemap, and returns all URLs listed by it. If the sitemap
+// is a sitemap index, the index's sitemaps will be requested as well, up
+// to MaxSitemaps. Gzip compressed sitemaps are supported.
+func Fetch(client *http.Client, sitemapURL string) ([]URL, error) {
+	urls := []URL{}
+	pending := []string{sitemapURL}
+	fetched := make(map[string]struct{})
+
+	for len(pending) > 0 && len(fetched) < MaxSitemaps {
+		u := pending[0]
+		pending = pending[1:]
+		if _, ok := fetched[u]; ok {
+			continue
+		}
+		fetched[u] = struct{}{}
+
+		found, sitemaps, err := fetchOne(client, u)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, found...)
+		for _, s := range sitemaps {
+			pending = append(pending, s.Loc)
+		}
+	}
+
+	return urls, nil
+}
+
+// Requests and parses a single sitemap document.
+func fetchOne(client *http.Client, sitemapURL string) (urls []URL, sitemaps []URL, err error) {
+	resp, err := client.Get(sitemapURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Sitemap %s request failed with status %d", sitemapURL, resp.StatusCode)
+	}
+
+	var body io.Reader = resp.Body
+	if strings.HasSuffix(sitemapURL, ".gz") || strings.Contains(resp.Header.Get("Content-Type"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	return Parse(io.LimitReader(body, MaxSitemapSize))
+}
+
+func trimURLs(urls []URL) []URL {
+	for i := range urls {
+		urls[i].Loc = strings.TrimSpace(urls[i].Loc)
+		urls[i].LastMod = strings.TrimSpace(urls[i].LastMod)
+	}
+	return urls
+}
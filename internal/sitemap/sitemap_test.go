@@ -0,0 +1,55 @@
+package sitemap
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseURLSet(t *testing.T) {
+	urls, sitemaps, err := Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc> http://www.example.com/ </loc><lastmod>2015-01-01</lastmod></url>
+	<url><loc>http://www.example.com/about</loc></url>
+</urlset>`))
+	require.Nil(t, err, "Expect no error")
+	assert.Len(t, sitemaps, 0, "Expect no sitemaps")
+	require.Len(t, urls, 2, "Expect URLs")
+	assert.Equal(t, URL{Loc: "http://www.example.com/", LastMod: "2015-01-01"}, urls[0], "Expect URL to match")
+	assert.Equal(t, "http://www.example.com/about", urls[1].Loc, "Expect URL to match")
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, _, err := Parse(strings.NewReader(`<html><body></body></html>`))
+	assert.NotNil(t, err, "Expect non sitemap document to fail")
+}
+
+func TestFetchIndex(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%[1]s/a.xml</loc></sitemap><sitemap><loc>%[1]s/b.xml</loc></sitemap></sitemapindex>`, ts.URL)
+		case "/a.xml":
+			fmt.Fprint(w, `<urlset><url><loc>http://www.example.com/a</loc></url></urlset>`)
+		case "/b.xml":
+			fmt.Fprint(w, `<urlset><url><loc>http://www.example.com/b</loc></url></urlset>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	urls, err := Fetch(http.DefaultClient, ts.URL+"/sitemap.xml")
+	require.Nil(t, err, "Expect no error")
+	require.Len(t, urls, 2, "Expect URLs from both sitemaps")
+	assert.Equal(t, "http://www.example.com/a", urls[0].Loc, "Expect URL to match")
+	assert.Equal(t, "http://www.example.com/b", urls[1].Loc, "Expect URL to match")
+
+	_, err = Fetch(http.DefaultClient, ts.URL+"/missing.xml")
+	assert.NotNil(t, err, "Expect missing sitemap to fail")
+}
@@ -0,0 +1,53 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Maximum number of URLs a single sitemap may list. Matches the sitemap
+// protocol's limit. URLs beyond the limit must be split across multiple
+// sitemaps, listed by a sitemap index.
+const MaxURLs = 50000
+
+// Namespace of the sitemap protocol's documents.
+const xmlns = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// Root element of a sitemap urlset document being written.
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []URL    `xml:"url"`
+}
+
+// Root element of a sitemap index document being written.
+type sitemapIndex struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	Sitemaps []URL    `xml:"sitemap"`
+}
+
+// Writes the URLs as a sitemap urlset document. No more than MaxURLs
+// should be written to a single sitemap.
+func WriteURLSet(w io.Writer, urls []URL) error {
+	return write(w, urlSet{XMLNS: xmlns, URLs: urls})
+}
+
+// Writes the sitemaps as a sitemap index document.
+func WriteIndex(w io.Writer, sitemaps []URL) error {
+	return write(w, sitemapIndex{XMLNS: xmlns, Sitemaps: sitemaps})
+}
+
+// Writes the document with the XML header.
+func write(w io.Writer, doc interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
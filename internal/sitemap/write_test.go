@@ -0,0 +1,39 @@
+package sitemap
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestWriteURLSet(t *testing.T) {
+	written := []URL{
+		{Loc: "http://www.example.com/?a=1&b=2", LastMod: "2015-01-01"},
+		{Loc: "http://www.example.com/about"},
+	}
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, WriteURLSet(buf, written), "Expect no error")
+	assert.True(t, strings.HasPrefix(buf.String(), `<?xml version="1.0" encoding="UTF-8"?>`), "Expect XML header")
+	assert.Contains(t, buf.String(), `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`, "Expect sitemap namespace")
+	assert.NotContains(t, buf.String(), `<lastmod></lastmod>`, "Expect unknown lastmod omitted")
+
+	urls, sitemaps, err := Parse(buf)
+	require.Nil(t, err, "Expect written sitemap to parse")
+	assert.Len(t, sitemaps, 0, "Expect no sitemaps")
+	assert.Equal(t, written, urls, "Expect written URLs")
+}
+
+func TestWriteIndex(t *testing.T) {
+	written := []URL{{Loc: "http://localhost:8080/job/1/sitemap.xml?page=1"}, {Loc: "http://localhost:8080/job/1/sitemap.xml?page=2"}}
+
+	buf := &bytes.Buffer{}
+	require.Nil(t, WriteIndex(buf, written), "Expect no error")
+
+	urls, sitemaps, err := Parse(buf)
+	require.Nil(t, err, "Expect written index to parse")
+	assert.Len(t, urls, 0, "Expect no URLs")
+	assert.Equal(t, written, sitemaps, "Expect written sitemaps")
+}
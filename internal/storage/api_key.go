@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Columns of the api_key table selected when querying keys.
+const apiKeyColumns = `id,name,prefix,enabled,created_on`
+
+// Number of leading characters of a key stored to identify it by
+const apiKeyPrefixLen = 8
+
+// Provides a name spaced collection of API key storage operations. APIKeyClient
+// does not hold non go-routine state, and is safe to share across multiples.
+type APIKeyClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Stores the key, enabled, under the name. Only the key's hash, and its
+// leading characters are stored.
+func (a *APIKeyClient) Create(name, key string) (*common.APIKey, error) {
+	const queryInsertKey = `
+INSERT INTO api_key (name, key_hash, prefix) VALUES ($1, $2, $3)
+RETURNING ` + apiKeyColumns
+
+	prefix := key
+	if len(prefix) > apiKeyPrefixLen {
+		prefix = prefix[:apiKeyPrefixLen]
+	}
+	return getAPIKeyFromRow(a.client.db.QueryRow(queryInsertKey, name, hashAPIKey(key), prefix))
+}
+
+// Returns the stored key matching the key. Nil is returned if the key
+// is unknown, or was revoked.
+func (a *APIKeyClient) GetByKey(key string) (*common.APIKey, error) {
+	const queryGetKey = `SELECT ` + apiKeyColumns + ` FROM api_key WHERE key_hash = $1`
+
+	return getAPIKeyFromRow(a.client.db.QueryRow(queryGetKey, hashAPIKey(key)))
+}
+
+// Returns the stored key of the id. Nil is returned if the key does not
+// exist, or was revoked.
+func (a *APIKeyClient) Get(id int64) (*common.APIKey, error) {
+	const queryGetKeyById = `SELECT ` + apiKeyColumns + ` FROM api_key WHERE id = $1`
+
+	return getAPIKeyFromRow(a.client.db.QueryRow(queryGetKeyById, id))
+}
+
+// Returns all stored keys, ordered by id.
+func (a *APIKeyClient) List() ([]common.APIKey, error) {
+	const queryListKeys = `SELECT ` + apiKeyColumns + ` FROM api_key ORDER BY id`
+
+	rows, err := a.client.db.Query(queryListKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []common.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, rows.Err()
+}
+
+// Enables, or disables the key. Nil is returned if the key does not exist.
+func (a *APIKeyClient) SetEnabled(id int64, enabled bool) (*common.APIKey, error) {
+	const queryUpdateEnabled = `
+UPDATE api_key SET enabled = $2 WHERE id = $1
+RETURNING ` + apiKeyColumns
+
+	return getAPIKeyFromRow(a.client.db.QueryRow(queryUpdateEnabled, id, enabled))
+}
+
+// Revokes the key, deleting it. False is returned if the key does not exist.
+func (a *APIKeyClient) Revoke(id int64) (bool, error) {
+	const queryDeleteKey = `DELETE FROM api_key WHERE id = $1`
+
+	res, err := a.client.db.Exec(queryDeleteKey, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Returns the hex SHA-256 hash the key is stored as.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Extracts the key from a QueryRow row. If no key is found, nil will be returned.
+func getAPIKeyFromRow(row *sql.Row) (*common.APIKey, error) {
+	k, err := scanAPIKey(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return k, err
+}
+
+// Scans the apiKeyColumns into a key with the scan function provided.
+func scanAPIKey(scan func(dest ...interface{}) error) (*common.APIKey, error) {
+	var (
+		id           sql.NullInt64
+		name, prefix sql.NullString
+		enabled      sql.NullBool
+		createdOn    pq.NullTime
+	)
+	if err := scan(&id, &name, &prefix, &enabled, &createdOn); err != nil {
+		return nil, err
+	}
+
+	return &common.APIKey{
+		Id:        id.Int64,
+		Name:      name.String,
+		Prefix:    prefix.String,
+		Enabled:   enabled.Bool,
+		CreatedOn: createdOn.Time,
+	}, nil
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Columns of the api_key_quota table selected when querying quotas.
+const apiKeyQuotaColumns = `api_key_id,urls,bytes,jobs,webhook`
+
+// Sets the key's monthly quota, replacing any previous quota.
+func (a *APIKeyClient) SetQuota(q common.APIKeyQuota) error {
+	const queryUpsertQuota = `
+WITH u AS (
+    UPDATE api_key_quota SET urls = $2, bytes = $3, jobs = $4, webhook = $5
+    WHERE api_key_id = $1
+    RETURNING api_key_id
+)
+INSERT INTO api_key_quota (api_key_id, urls, bytes, jobs, webhook)
+    SELECT $1, $2, $3, $4, $5
+    WHERE NOT EXISTS (SELECT 1 FROM u)`
+
+	webhook := sql.NullString{String: q.Webhook, Valid: q.Webhook != ""}
+	if _, err := a.client.db.Exec(queryUpsertQuota, q.APIKeyId, q.URLs, q.Bytes, q.Jobs, webhook); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the key's quota. Nil is returned if the key has no quota.
+func (a *APIKeyClient) GetQuota(keyId int64) (*common.APIKeyQuota, error) {
+	const queryGetQuota = `SELECT ` + apiKeyQuotaColumns + ` FROM api_key_quota WHERE api_key_id = $1`
+
+	q, err := scanAPIKeyQuota(a.client.db.QueryRow(queryGetQuota, keyId).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return q, err
+}
+
+// Removes the key's quota, so its usage is no longer limited. False is
+// returned if the key has no quota.
+func (a *APIKeyClient) DeleteQuota(keyId int64) (bool, error) {
+	const queryDeleteQuota = `DELETE FROM api_key_quota WHERE api_key_id = $1`
+
+	res, err := a.client.db.Exec(queryDeleteQuota, keyId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Returns the quotas of the keys which have not been revoked, ordered by key.
+func (a *APIKeyClient) Quotas() ([]common.APIKeyQuota, error) {
+	const queryQuotas = `
+SELECT ` + apiKeyQuotaColumns + ` FROM api_key_quota
+WHERE EXISTS (SELECT 1 FROM api_key WHERE api_key.id = api_key_quota.api_key_id)
+ORDER BY api_key_id`
+
+	rows, err := a.client.db.Query(queryQuotas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quotas := []common.APIKeyQuota{}
+	for rows.Next() {
+		q, err := scanAPIKeyQuota(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, *q)
+	}
+	return quotas, rows.Err()
+}
+
+// Returns the key's usage of its quota within the month of the time, UTC. URLs
+// and bytes are of the crawls of the key's jobs made within the month, and
+// jobs are those scheduled with the key within the month.
+func (a *APIKeyClient) QuotaUsage(keyId int64, now time.Time) (common.APIKeyQuotaUsage, error) {
+	const queryQuotaUsage = `
+SELECT
+	(SELECT COUNT(*) FROM crawl_log JOIN job ON job.id = crawl_log.job_id
+		WHERE job.api_key_id = $1 AND crawl_log.crawled_on >= $2 AND crawl_log.crawled_on < $3),
+	(SELECT COALESCE(SUM(crawl_log.bytes), 0) FROM crawl_log JOIN job ON job.id = crawl_log.job_id
+		WHERE job.api_key_id = $1 AND crawl_log.crawled_on >= $2 AND crawl_log.crawled_on < $3),
+	(SELECT COUNT(*) FROM job WHERE api_key_id = $1 AND created_on >= $2 AND created_on < $3)`
+
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	var urls, bytes, jobs sql.NullInt64
+	if err := a.client.db.QueryRow(queryQuotaUsage, keyId, start, end).Scan(&urls, &bytes, &jobs); err != nil {
+		return common.APIKeyQuotaUsage{}, err
+	}
+	return common.APIKeyQuotaUsage{URLs: urls.Int64, Bytes: bytes.Int64, Jobs: jobs.Int64}, nil
+}
+
+// Records the key's webhook was notified of its usage crossing the percent
+// of the quota's metric within the month. False is returned if it was already
+// notified, so each threshold is only notified once a month.
+func (a *APIKeyClient) MarkQuotaNotified(keyId int64, month, metric string, percent int) (bool, error) {
+	const queryInsertNotice = `
+INSERT INTO api_key_quota_notice (api_key_id, month, metric, percent, notified_on)
+	SELECT $1, $2, $3, $4, $5
+	WHERE NOT EXISTS (SELECT 1 FROM api_key_quota_notice
+		WHERE api_key_id = $1 AND month = $2 AND metric = $3 AND percent = $4)`
+
+	res, err := a.client.db.Exec(queryInsertNotice, keyId, month, metric, percent, time.Now().UTC())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Scans the apiKeyQuotaColumns into a quota with the scan function provided.
+func scanAPIKeyQuota(scan func(dest ...interface{}) error) (*common.APIKeyQuota, error) {
+	var (
+		id, urls, bytes, jobs sql.NullInt64
+		webhook               sql.NullString
+	)
+	if err := scan(&id, &urls, &bytes, &jobs, &webhook); err != nil {
+		return nil, err
+	}
+
+	return &common.APIKeyQuota{
+		APIKeyId: id.Int64,
+		URLs:     urls.Int64,
+		Bytes:    bytes.Int64,
+		Jobs:     jobs.Int64,
+		Webhook:  webhook.String,
+	}, nil
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Records the API key the job was scheduled with, so the usage of the job's
+// crawls is reported for the key.
+func (j *JobClient) SetAPIKey(id common.JobId, keyId int64) error {
+	const querySetAPIKey = `UPDATE job SET api_key_id = $2 WHERE id = $1`
+
+	if _, err := j.client.db.Exec(querySetAPIKey, id, keyId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the monthly usage of the crawls of jobs scheduled with each API key,
+// made within the months from, up to and including the month to, ordered by
+// month, and key. If the key id is non-zero only the usage of that key is
+// returned. Usage of revoked keys is still reported, without their name.
+// Months without crawls are not included.
+func (a *APIKeyClient) Usage(keyId int64, from, to time.Time) ([]common.APIKeyUsage, error) {
+	const queryUsage = `
+SELECT job.api_key_id, api_key.name, date_trunc('month', crawl_log.crawled_on AT TIME ZONE 'UTC') AS month,
+	COUNT(*), COALESCE(SUM(crawl_log.bytes), 0), COALESCE(SUM(crawl_log.duration_ms), 0)
+FROM crawl_log
+JOIN job ON job.id = crawl_log.job_id
+LEFT JOIN api_key ON api_key.id = job.api_key_id
+WHERE job.api_key_id IS NOT NULL AND ($1 = 0 OR job.api_key_id = $1)
+  AND crawl_log.crawled_on >= $2 AND crawl_log.crawled_on < $3
+GROUP BY job.api_key_id, api_key.name, month
+ORDER BY month, job.api_key_id`
+
+	start := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(to.Year(), to.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	rows, err := a.client.db.Query(queryUsage, keyId, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []common.APIKeyUsage{}
+	for rows.Next() {
+		var (
+			id, urls, bytes, durationMs sql.NullInt64
+			name                        sql.NullString
+			month                       time.Time
+		)
+		if err := rows.Scan(&id, &name, &month, &urls, &bytes, &durationMs); err != nil {
+			return nil, err
+		}
+		usage = append(usage, common.APIKeyUsage{
+			APIKeyId:     id.Int64,
+			Name:         name.String,
+			Month:        month.Format(common.UsageMonthFormat),
+			URLs:         urls.Int64,
+			Bytes:        bytes.Int64,
+			CrawlMinutes: time.Duration(durationMs.Int64 * int64(time.Millisecond)).Minutes(),
+		})
+	}
+	return usage, rows.Err()
+}
@@ -3,24 +3,49 @@ package storage
 import (
 	"database/sql"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/jasdel/harvester/internal/blobstore"
+	"github.com/jasdel/harvester/internal/fault"
+	"github.com/lib/pq"
 )
 
 // Client for communicating with the storage service. Provides a way to
 // Create jobs, update jobs, and manipulate URL entries
 type Client struct {
 	db *sql.DB
+
+	// Object store the bodies of archived jobs are tiered into, nil if
+	// none is configured.
+	cold blobstore.Store
 }
 
 // Creates a new instance of the storage client. returning a client instance
 // to perform operations with. The client is safe across multiple go routines.
+//
+// If the configuration has faults, the client injects them into its queries.
 func NewClient(cfg ClientConfig) (*Client, error) {
+	cold, err := blobstore.New(cfg.ColdStore)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Faults != nil {
+		faults, err := fault.New(*cfg.Faults)
+		if err != nil {
+			return nil, err
+		}
+		return &Client{
+			db:   sql.OpenDB(&faultConnector{dsn: cfg.String(), driver: pq.Driver{}, faults: faults}),
+			cold: cold,
+		}, nil
+	}
+
 	db, err := sql.Open("postgres", cfg.String())
 	if err != nil {
 		return nil, err
 	}
 	return &Client{
-		db: db,
+		db:   db,
+		cold: cold,
 	}, nil
 }
 
@@ -46,6 +71,46 @@ func (c *Client) URLClient() *URLClient {
 	}
 }
 
+// Return a HostClient which can be used to perform queries and manipulation
+// of host data stored in storage.
+func (c *Client) HostClient() *HostClient {
+	return &HostClient{
+		client: c,
+	}
+}
+
+// Return a FetchCacheClient which can be used to store, and reuse
+// responses fetched by the workers.
+func (c *Client) FetchCacheClient() *FetchCacheClient {
+	return &FetchCacheClient{
+		client: c,
+	}
+}
+
+// Return an APIKeyClient which can be used to manage the keys clients
+// authorize their web server requests with.
+func (c *Client) APIKeyClient() *APIKeyClient {
+	return &APIKeyClient{
+		client: c,
+	}
+}
+
+// Return a ClusterLimitClient which can be used to share the concurrent
+// fetch, and bandwidth limits between the workers of the cluster.
+func (c *Client) ClusterLimitClient() *ClusterLimitClient {
+	return &ClusterLimitClient{
+		client: c,
+	}
+}
+
+// Return a RecurringJobClient which can be used to manage the jobs scheduled
+// again on a cron schedule.
+func (c *Client) RecurringJobClient() *RecurringJobClient {
+	return &RecurringJobClient{
+		client: c,
+	}
+}
+
 // Configuration for the storage connection info
 type ClientConfig struct {
 	// User name the storage will connect as
@@ -60,6 +125,16 @@ type ClientConfig struct {
 	Port int `json:"port"`
 	// If SSL mode will be enabled/disabled
 	SSLMode bool `json:"sslmode"`
+
+	// Object store the stored HTML, and cached fetch bodies of archived
+	// jobs are tiered into. Every service must be configured with the
+	// same store, since they all read the bodies. Jobs can't be archived
+	// if not set.
+	ColdStore blobstore.Config `json:"coldStore"`
+
+	// Faults injected into the storage's queries, for integration tests.
+	// No faults are injected if not set.
+	Faults *fault.Config `json:"faults,omitempty"`
 }
 
 // Converts the configuration into a string for the sql.Open's connInfo parameter
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Keys of the advisory locks serializing the workers' updates of the cluster's
+// fetch slots, and bandwidth counters, so the limits can't be exceeded by
+// concurrent updates.
+const (
+	fetchSlotLockKey = 0x68617276001
+	bandwidthLockKey = 0x68617276002
+)
+
+// Seconds of bandwidth counters kept, older counters are removed as bandwidth
+// is reserved.
+const bandwidthHistorySeconds = 60
+
+// Provides a name spaced collection of the storage operations of the limits
+// shared by all workers of the cluster. ClusterLimitClient does not hold non
+// go-routine state, and is safe to share across multiples.
+type ClusterLimitClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Current utilization of the cluster's limits.
+type ClusterUsage struct {
+	// Fetch slots held by the workers
+	Fetches int
+
+	// Bytes reserved by the workers during the previous second
+	BytesPerSecond int64
+}
+
+// Acquires a fetch slot for the worker if fewer than limit slots are held
+// across the cluster. The slot expires after the ttl unless renewed, so the
+// slots of workers which stopped are freed. Returns the slot's id, and false
+// if the limit was reached.
+func (c *ClusterLimitClient) AcquireFetchSlot(worker string, limit int, ttl time.Duration) (int64, bool, error) {
+	const queryLock = `SELECT pg_advisory_xact_lock($1)`
+	const queryExpire = `DELETE FROM cluster_fetch_slot WHERE expires_on <= NOW()`
+	const queryAcquire = `
+INSERT INTO cluster_fetch_slot (worker, expires_on)
+SELECT $1, NOW() + $2 * INTERVAL '1 millisecond'
+WHERE (SELECT count(*) FROM cluster_fetch_slot) < $3
+RETURNING id`
+
+	tx, err := c.client.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := tx.Exec(queryLock, fetchSlotLockKey); err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+	if _, err := tx.Exec(queryExpire); err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+
+	var id int64
+	if err := tx.QueryRow(queryAcquire, worker, ttl/time.Millisecond, limit).Scan(&id); err == sql.ErrNoRows {
+		tx.Rollback()
+		return 0, false, nil
+	} else if err != nil {
+		tx.Rollback()
+		return 0, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+	return id, true, nil
+}
+
+// Releases the fetch slot, freeing it for any worker.
+func (c *ClusterLimitClient) ReleaseFetchSlot(id int64) error {
+	const queryRelease = `DELETE FROM cluster_fetch_slot WHERE id = $1`
+
+	_, err := c.client.db.Exec(queryRelease, id)
+	return err
+}
+
+// Extends the expiry of all of the worker's fetch slots to the ttl from now.
+func (c *ClusterLimitClient) RenewFetchSlots(worker string, ttl time.Duration) error {
+	const queryRenew = `
+UPDATE cluster_fetch_slot SET expires_on = NOW() + $2 * INTERVAL '1 millisecond'
+WHERE worker = $1`
+
+	_, err := c.client.db.Exec(queryRenew, worker, ttl/time.Millisecond)
+	return err
+}
+
+// Reserves up to n bytes of the current second's bandwidth, limited to the
+// bytes of the second not already reserved across the cluster. Seconds are
+// of the storage's clock. Returns the bytes reserved, zero if the second's
+// bandwidth is exhausted.
+func (c *ClusterLimitClient) ReserveBandwidth(n, limit int64) (int64, error) {
+	const queryLock = `SELECT pg_advisory_xact_lock($1)`
+	const querySecond = `SELECT floor(extract(epoch FROM NOW()))::BIGINT`
+	const queryReserved = `SELECT bytes FROM cluster_bandwidth WHERE second = $1`
+	const queryUpdateReserved = `UPDATE cluster_bandwidth SET bytes = bytes + $2 WHERE second = $1`
+	const queryAddReserved = `INSERT INTO cluster_bandwidth (second, bytes) VALUES ($1, $2)`
+	const queryPrune = `DELETE FROM cluster_bandwidth WHERE second < $1`
+
+	tx, err := c.client.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(queryLock, bandwidthLockKey); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	var second, reserved int64
+	if err := tx.QueryRow(querySecond).Scan(&second); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	exists := true
+	if err := tx.QueryRow(queryReserved, second).Scan(&reserved); err == sql.ErrNoRows {
+		exists = false
+	} else if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if n > limit-reserved {
+		n = limit - reserved
+	}
+	if n <= 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	if exists {
+		_, err = tx.Exec(queryUpdateReserved, second, n)
+	} else {
+		_, err = tx.Exec(queryAddReserved, second, n)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if _, err := tx.Exec(queryPrune, second-bandwidthHistorySeconds); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// Returns the current utilization of the cluster's limits.
+func (c *ClusterLimitClient) Usage() (ClusterUsage, error) {
+	const queryUsage = `
+SELECT
+    (SELECT count(*) FROM cluster_fetch_slot WHERE expires_on > NOW()),
+    COALESCE((SELECT bytes FROM cluster_bandwidth
+              WHERE second = floor(extract(epoch FROM NOW()))::BIGINT - 1), 0)`
+
+	usage := ClusterUsage{}
+	err := c.client.db.QueryRow(queryUsage).Scan(&usage.Fetches, &usage.BytesPerSecond)
+	return usage, err
+}
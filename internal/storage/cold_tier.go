@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jasdel/harvester/internal/blobstore"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Returned when a job is archived but no cold store is configured to tier
+// its bodies into, or read them back from.
+var ErrNoColdStore = errors.New("No cold store is configured")
+
+// Keys the versions of a URL's stored HTML, and cached fetch bodies are
+// tiered under in the cold store.
+func coldHTMLKey(urlId common.URLId, version string) string {
+	return fmt.Sprintf("html/%d/%s", urlId, version)
+}
+func coldFetchBodyKey(hash string) string {
+	return "fetch/" + hash
+}
+
+// Reads the body tiered under the key from the cold store.
+func (c *Client) coldBody(key string) ([]byte, error) {
+	if c.cold == nil {
+		return nil, ErrNoColdStore
+	}
+	body, err := c.cold.Get(key)
+	if err == blobstore.ErrNotFound {
+		return nil, fmt.Errorf("Tiered body %s missing from the cold store", key)
+	}
+	return body, err
+}
+
+// Reads the version of the URL's HTML from the cold store if it was tiered,
+// otherwise the stored value is returned as is.
+func (c *Client) tieredHTML(urlId common.URLId, version string, stored sql.NullString, tiered bool) (string, error) {
+	if !tiered {
+		return stored.String, nil
+	}
+	body, err := c.coldBody(coldHTMLKey(urlId, version))
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// Moves the job's stored HTML, and the bodies of the responses cached for its
+// URLs, from the database into the cold store. The metadata stays in the
+// database. Bodies are only cleared if they weren't replaced while they were
+// put into the store.
+func (j *JobClient) tierBodies(id common.JobId) error {
+	const queryJobHTML = `
+SELECT url_id FROM url_html
+WHERE (raw IS NOT NULL OR sanitized IS NOT NULL) AND url_id IN (` + queryJobURLIds + `)`
+	const queryHTML = `SELECT raw, sanitized, stored_on FROM url_html WHERE url_id = $1`
+	const queryTierHTML = `
+UPDATE url_html SET raw = NULL, sanitized = NULL,
+	raw_tiered = raw_tiered OR raw IS NOT NULL, sanitized_tiered = sanitized_tiered OR sanitized IS NOT NULL
+WHERE url_id = $1 AND stored_on = $2`
+	const queryJobFetchBodies = `
+SELECT DISTINCT fetch_body.hash FROM fetch_body
+JOIN fetch_cache ON fetch_cache.body_hash = fetch_body.hash
+JOIN url ON url.url = fetch_cache.url
+WHERE NOT fetch_body.tiered AND url.id IN (` + queryJobURLIds + `)`
+	const queryFetchBody = `SELECT body FROM fetch_body WHERE hash = $1 AND NOT tiered`
+	const queryTierFetchBody = `UPDATE fetch_body SET body = NULL, tiered = TRUE WHERE hash = $1`
+
+	cold := j.client.cold
+	if cold == nil {
+		return ErrNoColdStore
+	}
+
+	urlIds, err := j.urlIds(queryJobHTML, id)
+	if err != nil {
+		return err
+	}
+	for _, urlId := range urlIds {
+		var (
+			raw, sanitized sql.NullString
+			storedOn       pq.NullTime
+		)
+		if err := j.client.db.QueryRow(queryHTML, urlId).Scan(&raw, &sanitized, &storedOn); err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if raw.Valid {
+			if err := cold.Put(coldHTMLKey(urlId, "raw"), []byte(raw.String)); err != nil {
+				return err
+			}
+		}
+		if sanitized.Valid {
+			if err := cold.Put(coldHTMLKey(urlId, "sanitized"), []byte(sanitized.String)); err != nil {
+				return err
+			}
+		}
+		if _, err := j.client.db.Exec(queryTierHTML, urlId, storedOn); err != nil {
+			return err
+		}
+	}
+
+	hashes, err := j.hashes(queryJobFetchBodies, id)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		var body []byte
+		if err := j.client.db.QueryRow(queryFetchBody, hash).Scan(&body); err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if err := cold.Put(coldFetchBodyKey(hash), body); err != nil {
+			return err
+		}
+		// Bodies are content addressed, so they can't have been replaced.
+		if _, err := j.client.db.Exec(queryTierFetchBody, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Moves the job's tiered bodies from the cold store back into the database,
+// and removes them from the store.
+func (j *JobClient) untierBodies(id common.JobId) error {
+	const queryJobHTML = `
+SELECT url_id FROM url_html
+WHERE (raw_tiered OR sanitized_tiered) AND url_id IN (` + queryJobURLIds + `)`
+	const queryHTML = `SELECT raw_tiered, sanitized_tiered, stored_on FROM url_html WHERE url_id = $1`
+	const queryUntierHTML = `
+UPDATE url_html SET raw = $3, sanitized = $4, raw_tiered = FALSE, sanitized_tiered = FALSE
+WHERE url_id = $1 AND stored_on = $2`
+	const queryJobFetchBodies = `
+SELECT DISTINCT fetch_body.hash FROM fetch_body
+JOIN fetch_cache ON fetch_cache.body_hash = fetch_body.hash
+JOIN url ON url.url = fetch_cache.url
+WHERE fetch_body.tiered AND url.id IN (` + queryJobURLIds + `)`
+	const queryUntierFetchBody = `UPDATE fetch_body SET body = $2, tiered = FALSE WHERE hash = $1 AND tiered`
+
+	cold := j.client.cold
+	if cold == nil {
+		return ErrNoColdStore
+	}
+
+	urlIds, err := j.urlIds(queryJobHTML, id)
+	if err != nil {
+		return err
+	}
+	for _, urlId := range urlIds {
+		var (
+			rawTiered, sanitizedTiered bool
+			storedOn                   pq.NullTime
+		)
+		if err := j.client.db.QueryRow(queryHTML, urlId).Scan(&rawTiered, &sanitizedTiered, &storedOn); err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		raw, err := j.client.tieredHTML(urlId, "raw", sql.NullString{}, rawTiered)
+		if err != nil {
+			return err
+		}
+		sanitized, err := j.client.tieredHTML(urlId, "sanitized", sql.NullString{}, sanitizedTiered)
+		if err != nil {
+			return err
+		}
+		if _, err := j.client.db.Exec(queryUntierHTML, urlId, storedOn,
+			sql.NullString{String: raw, Valid: rawTiered}, sql.NullString{String: sanitized, Valid: sanitizedTiered}); err != nil {
+			return err
+		}
+		// Once the body is back in the database a failed delete only
+		// leaves an unreferenced object, which is replaced if tiered again.
+		cold.Delete(coldHTMLKey(urlId, "raw"))
+		cold.Delete(coldHTMLKey(urlId, "sanitized"))
+	}
+
+	hashes, err := j.hashes(queryJobFetchBodies, id)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		body, err := j.client.coldBody(coldFetchBodyKey(hash))
+		if err != nil {
+			return err
+		}
+		if _, err := j.client.db.Exec(queryUntierFetchBody, hash, body); err != nil {
+			return err
+		}
+		cold.Delete(coldFetchBodyKey(hash))
+	}
+
+	return nil
+}
+
+// Marks the job as archived, or restored if the time is zero. Returns false
+// if the job was already in the requested state.
+func (j *JobClient) setArchivedOn(id common.JobId, archivedOn time.Time) (bool, error) {
+	if archivedOn.IsZero() {
+		return j.updateJob(`UPDATE job SET archived_on = NULL WHERE id = $1 AND archived_on IS NOT NULL`, id)
+	}
+	return j.updateJob(`UPDATE job SET archived_on = $2 WHERE id = $1 AND archived_on IS NULL`, id, archivedOn)
+}
+
+// Executes the query returning a column of URL ids.
+func (j *JobClient) urlIds(query string, args ...interface{}) ([]common.URLId, error) {
+	rows, err := j.client.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []common.URLId{}
+	for rows.Next() {
+		var id sql.NullInt64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if id.Valid {
+			ids = append(ids, common.URLId(id.Int64))
+		}
+	}
+	return ids, rows.Err()
+}
+
+// Executes the query returning a column of fetch body hashes.
+func (j *JobClient) hashes(query string, args ...interface{}) ([]string, error) {
+	rows, err := j.client.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
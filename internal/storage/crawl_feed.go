@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"sort"
+)
+
+// Position in the live crawl feed, of the last crawl log and crawl skip
+// entries read.
+type CrawlFeedCursor struct {
+	LogId  int64
+	SkipId int64
+}
+
+// Records a crawl a worker skipped before requesting its URL.
+func (u *URLClient) AddCrawlSkip(entry CrawlSkipEntry) error {
+	const queryAddCrawlSkip = `INSERT INTO crawl_skip (job_id, url_id, skipped_on, reason) VALUES ($1, $2, $3, $4)`
+
+	if _, err := u.client.db.Exec(queryAddCrawlSkip, entry.JobId, entry.URLId, entry.SkippedOn, entry.Reason); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the cursor of the most recent crawls of all jobs, so a feed started
+// from it only includes crawls made after it.
+func (j *JobClient) LatestCrawlFeedCursor() (CrawlFeedCursor, error) {
+	const queryLatest = `SELECT (SELECT MAX(id) FROM crawl_log), (SELECT MAX(id) FROM crawl_skip)`
+
+	var logId, skipId sql.NullInt64
+	if err := j.client.db.QueryRow(queryLatest).Scan(&logId, &skipId); err != nil {
+		return CrawlFeedCursor{}, err
+	}
+	return CrawlFeedCursor{LogId: logId.Int64, SkipId: skipId.Int64}, nil
+}
+
+// Returns the crawls made after the cursor, ordered by when they were made,
+// and the cursor of the last crawls returned. Only the job's crawls are
+// returned, unless the job id is common.InvalidId. At most limit requests,
+// and limit skipped crawls, are returned, so the feed should be read until no
+// crawls are returned.
+func (j *JobClient) CrawlFeedSince(cursor CrawlFeedCursor, jobId common.JobId, limit int) ([]common.CrawlFeedEvent, CrawlFeedCursor, error) {
+	const queryCrawlLog = `
+SELECT crawl_log.id, crawl_log.job_id, url.url, crawl_log.crawled_on, crawl_log.status, crawl_log.bytes, crawl_log.duration_ms
+FROM crawl_log
+JOIN url ON url.id = crawl_log.url_id
+WHERE crawl_log.id > $1 AND ($2 = -1 OR crawl_log.job_id = $2)
+ORDER BY crawl_log.id
+LIMIT $3`
+	const queryCrawlSkip = `
+SELECT crawl_skip.id, crawl_skip.job_id, url.url, crawl_skip.skipped_on, crawl_skip.reason
+FROM crawl_skip
+JOIN url ON url.id = crawl_skip.url_id
+WHERE crawl_skip.id > $1 AND ($2 = -1 OR crawl_skip.job_id = $2)
+ORDER BY crawl_skip.id
+LIMIT $3`
+
+	events := []common.CrawlFeedEvent{}
+
+	rows, err := j.client.db.Query(queryCrawlLog, cursor.LogId, jobId, limit)
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			logId, eventJobId, status, bytes, duration sql.NullInt64
+			u                                          sql.NullString
+			crawledOn                                  pq.NullTime
+		)
+		if err := rows.Scan(&logId, &eventJobId, &u, &crawledOn, &status, &bytes, &duration); err != nil {
+			return nil, cursor, err
+		}
+		if !logId.Valid || !u.Valid {
+			return nil, cursor, fmt.Errorf("Invalid crawl log entry after id %d", cursor.LogId)
+		}
+
+		crawl := common.JobCrawlEvent{Status: int(status.Int64)}
+		event := common.CrawlFeedEvent{
+			Event:      common.CrawlFeedFetched,
+			JobId:      common.JobId(eventJobId.Int64),
+			URL:        u.String,
+			On:         crawledOn.Time,
+			Status:     crawl.Status,
+			Bytes:      bytes.Int64,
+			DurationMs: duration.Int64,
+		}
+		if crawl.Failed() {
+			event.Event = common.CrawlFeedErrored
+		}
+		events = append(events, event)
+		cursor.LogId = logId.Int64
+	}
+	if err := rows.Err(); err != nil {
+		return nil, cursor, err
+	}
+
+	skipRows, err := j.client.db.Query(queryCrawlSkip, cursor.SkipId, jobId, limit)
+	if err != nil {
+		return nil, cursor, err
+	}
+	defer skipRows.Close()
+	for skipRows.Next() {
+		var (
+			skipId, eventJobId sql.NullInt64
+			u, reason          sql.NullString
+			skippedOn          pq.NullTime
+		)
+		if err := skipRows.Scan(&skipId, &eventJobId, &u, &skippedOn, &reason); err != nil {
+			return nil, cursor, err
+		}
+		if !skipId.Valid || !u.Valid {
+			return nil, cursor, fmt.Errorf("Invalid crawl skip entry after id %d", cursor.SkipId)
+		}
+
+		events = append(events, common.CrawlFeedEvent{
+			Event:  common.CrawlFeedSkipped,
+			JobId:  common.JobId(eventJobId.Int64),
+			URL:    u.String,
+			On:     skippedOn.Time,
+			Reason: reason.String,
+		})
+		cursor.SkipId = skipId.Int64
+	}
+	if err := skipRows.Err(); err != nil {
+		return nil, cursor, err
+	}
+
+	sort.SliceStable(events, func(a, b int) bool { return events[a].On.Before(events[b].On) })
+	return events, cursor, nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+	"database/sql/driver"
+	"github.com/jasdel/harvester/internal/fault"
+)
+
+// Connector of database connections injecting faults into the statements
+// and transactions of each connection. Each is delayed, and fails at the
+// error rate.
+type faultConnector struct {
+	dsn    string
+	driver driver.Driver
+	faults *fault.Injector
+}
+
+func (c *faultConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &faultConn{Conn: conn, faults: c.faults}, nil
+}
+
+func (c *faultConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Connection injecting faults. Only preparing statements, and beginning
+// transactions are wrapped, so every query is prepared through the faults.
+type faultConn struct {
+	driver.Conn
+	faults *fault.Injector
+}
+
+func (c *faultConn) Prepare(query string) (driver.Stmt, error) {
+	c.faults.Delay()
+	if err := c.faults.Err(); err != nil {
+		return nil, err
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *faultConn) Begin() (driver.Tx, error) {
+	c.faults.Delay()
+	if err := c.faults.Err(); err != nil {
+		return nil, err
+	}
+	return c.Conn.Begin()
+}
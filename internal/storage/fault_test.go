@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"github.com/jasdel/harvester/internal/fault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+// Driver of connections whose statements return no rows.
+type emptyDriver struct{}
+
+func (emptyDriver) Open(name string) (driver.Conn, error) { return emptyConn{}, nil }
+
+type emptyConn struct{}
+
+func (emptyConn) Prepare(query string) (driver.Stmt, error) { return emptyStmt{}, nil }
+func (emptyConn) Close() error                              { return nil }
+func (emptyConn) Begin() (driver.Tx, error)                 { return emptyTx{}, nil }
+
+type emptyStmt struct{}
+
+func (emptyStmt) Close() error                                    { return nil }
+func (emptyStmt) NumInput() int                                   { return -1 }
+func (emptyStmt) Exec(args []driver.Value) (driver.Result, error) { return driver.RowsAffected(0), nil }
+func (emptyStmt) Query(args []driver.Value) (driver.Rows, error)  { return emptyRows{}, nil }
+
+type emptyTx struct{}
+
+func (emptyTx) Commit() error   { return nil }
+func (emptyTx) Rollback() error { return nil }
+
+type emptyRows struct{}
+
+func (emptyRows) Columns() []string              { return []string{} }
+func (emptyRows) Close() error                   { return nil }
+func (emptyRows) Next(dest []driver.Value) error { return io.EOF }
+
+func faultDB(t *testing.T, cfg fault.Config) *sql.DB {
+	faults, err := fault.New(cfg)
+	require.NoError(t, err, "Expect valid config")
+	return sql.OpenDB(&faultConnector{driver: emptyDriver{}, faults: faults})
+}
+
+func TestFaultConnectorErrors(t *testing.T) {
+	db := faultDB(t, fault.Config{ErrorRate: 1})
+	defer db.Close()
+
+	_, err := db.Exec("DELETE FROM job")
+	assert.Equal(t, fault.ErrInjected, err, "Expect exec to fail")
+	_, err = db.Begin()
+	assert.Equal(t, fault.ErrInjected, err, "Expect begin to fail")
+}
+
+func TestFaultConnectorNoErrors(t *testing.T) {
+	db := faultDB(t, fault.Config{})
+	defer db.Close()
+
+	_, err := db.Exec("DELETE FROM job")
+	assert.NoError(t, err, "Expect exec to succeed")
+	tx, err := db.Begin()
+	require.NoError(t, err, "Expect begin to succeed")
+	assert.NoError(t, tx.Commit(), "Expect commit to succeed")
+}
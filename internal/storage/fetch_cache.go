@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/lib/pq"
+	"net/http"
+	"time"
+)
+
+// Provides a name spaced collection of fetch cache storage operations. FetchCacheClient
+// does not hold non go-routine state, and is safe to share across multiples.
+type FetchCacheClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Returns the response cached under the key if it was fetched on or after
+// notBefore. Bodies tiered into the cold store are read from it. Nil is
+// returned if there is no such response.
+func (f *FetchCacheClient) Get(key string, notBefore time.Time) (*CachedResponse, error) {
+	const queryGetCached = `
+SELECT fetch_cache.url, fetch_cache.status, fetch_cache.header, fetch_body.hash, fetch_body.body, fetch_body.tiered, fetch_cache.fetched_on
+FROM fetch_cache
+JOIN fetch_body ON fetch_body.hash = fetch_cache.body_hash
+WHERE fetch_cache.key = $1 AND fetch_cache.fetched_on >= $2`
+
+	var (
+		u, header sql.NullString
+		status    sql.NullInt64
+		hash      string
+		body      []byte
+		tiered    bool
+		fetchedOn pq.NullTime
+	)
+	if err := f.client.db.QueryRow(queryGetCached, key, notBefore).Scan(&u, &status, &header, &hash, &body, &tiered, &fetchedOn); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if tiered {
+		var err error
+		if body, err = f.client.coldBody(coldFetchBodyKey(hash)); err != nil {
+			return nil, err
+		}
+	}
+
+	r := &CachedResponse{
+		Key:       key,
+		URL:       u.String,
+		Status:    int(status.Int64),
+		Header:    http.Header{},
+		Body:      body,
+		FetchedOn: fetchedOn.Time,
+	}
+	if err := json.Unmarshal([]byte(header.String), &r.Header); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Stores the response in the cache under its key, replacing any previously
+// cached response. The body is only stored if no identical body is already.
+func (f *FetchCacheClient) Put(r *CachedResponse) error {
+	const queryPutBody = `
+INSERT INTO fetch_body (hash, body)
+	SELECT $1, $2
+	WHERE NOT EXISTS (SELECT 1 FROM fetch_body WHERE hash = $1)`
+	const queryPutCached = `
+WITH s AS (
+    UPDATE fetch_cache SET url = $2, status = $3, header = $4, body_hash = $5, fetched_on = $6
+    WHERE key = $1
+    RETURNING key
+)
+INSERT INTO fetch_cache (key, url, status, header, body_hash, fetched_on)
+    SELECT $1, $2, $3, $4, $5, $6
+    WHERE NOT EXISTS (SELECT 1 FROM s)`
+
+	header, err := json.Marshal(r.Header)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(r.Body)
+	hash := hex.EncodeToString(sum[:])
+
+	if _, err := f.client.db.Exec(queryPutBody, hash, r.Body); err != nil {
+		return err
+	}
+	if _, err := f.client.db.Exec(queryPutCached, r.Key, r.URL, r.Status, string(header), hash, r.FetchedOn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Removes responses fetched before the time, and the bodies no longer
+// referenced by a cached response, including those tiered into the cold
+// store. Returns the number of responses removed.
+func (f *FetchCacheClient) Prune(before time.Time) (int64, error) {
+	const queryPruneCached = `DELETE FROM fetch_cache WHERE fetched_on < $1`
+	const queryPruneBodies = `
+DELETE FROM fetch_body
+WHERE NOT EXISTS (SELECT 1 FROM fetch_cache WHERE fetch_cache.body_hash = fetch_body.hash)
+RETURNING hash, tiered`
+
+	res, err := f.client.db.Exec(queryPruneCached, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := f.client.db.Query(queryPruneBodies)
+	if err != nil {
+		return n, err
+	}
+	defer rows.Close()
+
+	tiered := []string{}
+	for rows.Next() {
+		var hash string
+		var isTiered bool
+		if err := rows.Scan(&hash, &isTiered); err != nil {
+			return n, err
+		}
+		if isTiered {
+			tiered = append(tiered, hash)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	if len(tiered) > 0 && f.client.cold == nil {
+		return n, ErrNoColdStore
+	}
+	for _, hash := range tiered {
+		if err := f.client.cold.Delete(coldFetchBodyKey(hash)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"strings"
+)
+
+// Columns of the host_opt_out table selected when querying opt outs.
+const hostOptOutColumns = `host,reason,requested_by,created_on`
+
+// Provides a name spaced collection of host based storage operations. HostClient
+// does not hold non go-routine state, and is safe to share across multiples.
+type HostClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Adds the host to the opt-out registry. If the host is already opted out
+// its reason and requester are replaced.
+func (h *HostClient) OptOut(host, reason, requestedBy string) (*common.HostOptOut, error) {
+	const queryUpsertOptOut = `
+WITH u AS (
+    UPDATE host_opt_out SET reason = $2, requested_by = $3
+    WHERE host = $1
+    RETURNING ` + hostOptOutColumns + `
+), i AS (
+    INSERT INTO host_opt_out (host, reason, requested_by)
+    SELECT $1, $2, $3
+    WHERE NOT EXISTS (SELECT 1 FROM u)
+    RETURNING ` + hostOptOutColumns + `
+)
+SELECT * FROM u
+UNION ALL
+SELECT * FROM i`
+
+	return getHostOptOutFromRow(h.client.db.QueryRow(queryUpsertOptOut, strings.ToLower(host), reason, requestedBy))
+}
+
+// Removes the host from the opt-out registry. False is returned if the
+// host was not opted out.
+func (h *HostClient) RemoveOptOut(host string) (bool, error) {
+	const queryDeleteOptOut = `DELETE FROM host_opt_out WHERE host = $1`
+
+	res, err := h.client.db.Exec(queryDeleteOptOut, strings.ToLower(host))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Returns the opt out covering the host, either the host's own, or one of
+// its parent domains'. Nil is returned if the host is not opted out.
+func (h *HostClient) GetOptOut(host string) (*common.HostOptOut, error) {
+	const queryGetOptOut = `
+SELECT ` + hostOptOutColumns + ` FROM host_opt_out
+WHERE host = $1 OR right($1, length(host) + 1) = '.' || host
+ORDER BY length(host) DESC
+LIMIT 1`
+
+	return getHostOptOutFromRow(h.client.db.QueryRow(queryGetOptOut, strings.ToLower(host)))
+}
+
+// Returns all hosts in the opt-out registry, ordered by host.
+func (h *HostClient) ListOptOuts() ([]common.HostOptOut, error) {
+	const queryListOptOuts = `SELECT ` + hostOptOutColumns + ` FROM host_opt_out ORDER BY host`
+
+	rows, err := h.client.db.Query(queryListOptOuts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	optOuts := []common.HostOptOut{}
+	for rows.Next() {
+		o, err := scanHostOptOut(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		optOuts = append(optOuts, *o)
+	}
+	return optOuts, rows.Err()
+}
+
+// Extracts the opt out from a QueryRow row. If no opt out is found, nil will be returned.
+func getHostOptOutFromRow(row *sql.Row) (*common.HostOptOut, error) {
+	o, err := scanHostOptOut(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return o, err
+}
+
+// Scans the hostOptOutColumns into an opt out with the scan function provided.
+func scanHostOptOut(scan func(dest ...interface{}) error) (*common.HostOptOut, error) {
+	var (
+		host, reason, requestedBy sql.NullString
+		createdOn                 pq.NullTime
+	)
+	if err := scan(&host, &reason, &requestedBy, &createdOn); err != nil {
+		return nil, err
+	}
+
+	return &common.HostOptOut{
+		Host:        host.String,
+		Reason:      reason.String,
+		RequestedBy: requestedBy.String,
+		CreatedOn:   createdOn.Time,
+	}, nil
+}
+
+// Stores the content of the host's well-known file, replacing the content
+// previously stored for the path.
+func (h *HostClient) StoreWellKnown(host, path, content string) error {
+	const queryUpsertWellKnown = `
+WITH u AS (
+    UPDATE host_well_known SET content = $3, fetched_on = NOW()
+    WHERE host = $1 AND path = $2
+    RETURNING host
+)
+INSERT INTO host_well_known (host, path, content)
+SELECT $1, $2, $3
+WHERE NOT EXISTS (SELECT 1 FROM u)`
+
+	_, err := h.client.db.Exec(queryUpsertWellKnown, strings.ToLower(host), path, content)
+	return err
+}
+
+// Removes the host's well-known file, e.g: if the host no longer has it.
+func (h *HostClient) RemoveWellKnown(host, path string) error {
+	const queryDeleteWellKnown = `DELETE FROM host_well_known WHERE host = $1 AND path = $2`
+
+	_, err := h.client.db.Exec(queryDeleteWellKnown, strings.ToLower(host), path)
+	return err
+}
+
+// Returns the well-known files stored for the host. A host which has none, or
+// was never crawled, has no files.
+func (h *HostClient) WellKnown(host string) (*common.HostWellKnown, error) {
+	const queryWellKnown = `SELECT path, content, fetched_on FROM host_well_known WHERE host = $1 ORDER BY path`
+
+	host = strings.ToLower(host)
+	rows, err := h.client.db.Query(queryWellKnown, host)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wellKnown := &common.HostWellKnown{Host: host, Files: []common.WellKnownFile{}}
+	for rows.Next() {
+		var (
+			path, content sql.NullString
+			fetchedOn     pq.NullTime
+		)
+		if err := rows.Scan(&path, &content, &fetchedOn); err != nil {
+			return nil, err
+		}
+		wellKnown.Files = append(wellKnown.Files, common.WellKnownFile{
+			Path:      path.String,
+			Content:   content.String,
+			FetchedOn: fetchedOn.Time,
+		})
+	}
+	return wellKnown, rows.Err()
+}
+
+// Columns of the host_identity table selected when querying identities.
+const hostIdentityColumns = `host,site_name,icon_url,icon_mime,fetched_on`
+
+// Stores the site identity of the host captured by the job, replacing any
+// previously stored. The icon is the favicon's content, nil if the site has none.
+func (h *HostClient) StoreIdentity(jobId common.JobId, identity *common.HostIdentity, icon []byte) error {
+	const queryUpsertIdentity = `
+WITH u AS (
+    UPDATE host_identity SET site_name = $2, icon_url = $3, icon_mime = $4, icon = $5, job_id = $6, fetched_on = NOW()
+    WHERE host = $1
+    RETURNING host
+)
+INSERT INTO host_identity (host, site_name, icon_url, icon_mime, icon, job_id)
+SELECT $1, $2, $3, $4, $5, $6
+WHERE NOT EXISTS (SELECT 1 FROM u)`
+
+	_, err := h.client.db.Exec(queryUpsertIdentity, strings.ToLower(identity.Host), identity.SiteName,
+		identity.IconURL, identity.IconMime, icon, jobId)
+	return err
+}
+
+// Returns if the host's site identity was already captured by the job.
+func (h *HostClient) IdentityCapturedBy(host string, jobId common.JobId) (bool, error) {
+	const queryIdentityJob = `SELECT EXISTS (SELECT 1 FROM host_identity WHERE host = $1 AND job_id = $2)`
+
+	var captured bool
+	err := h.client.db.QueryRow(queryIdentityJob, strings.ToLower(host), jobId).Scan(&captured)
+	return captured, err
+}
+
+// Returns the site identity of the host. Nil is returned if the identity of
+// the host was never captured.
+func (h *HostClient) Identity(host string) (*common.HostIdentity, error) {
+	const queryIdentity = `SELECT ` + hostIdentityColumns + ` FROM host_identity WHERE host = $1`
+
+	var (
+		storedHost, siteName, iconURL, iconMime sql.NullString
+		fetchedOn                               pq.NullTime
+	)
+	err := h.client.db.QueryRow(queryIdentity, strings.ToLower(host)).Scan(&storedHost, &siteName, &iconURL, &iconMime, &fetchedOn)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &common.HostIdentity{
+		Host:      storedHost.String,
+		SiteName:  siteName.String,
+		IconURL:   iconURL.String,
+		IconMime:  iconMime.String,
+		FetchedOn: fetchedOn.Time,
+	}, nil
+}
+
+// Returns the content type and content of the host's stored favicon. Nil is
+// returned if the host has no stored favicon.
+func (h *HostClient) Favicon(host string) (string, []byte, error) {
+	const queryFavicon = `SELECT icon_mime, icon FROM host_identity WHERE host = $1 AND icon IS NOT NULL`
+
+	var (
+		mime sql.NullString
+		icon []byte
+	)
+	err := h.client.db.QueryRow(queryFavicon, strings.ToLower(host)).Scan(&mime, &icon)
+	if err == sql.ErrNoRows {
+		return "", nil, nil
+	}
+	return mime.String, icon, err
+}
@@ -0,0 +1,260 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Columns aggregating the metrics of the crawl_log requests of a host, in the
+// order read by scanHostMetrics. Errors are requests which failed, or
+// responded with a 4xx or 5xx status.
+const hostMetricColumns = `COUNT(*),
+	SUM(CASE WHEN status IS NULL OR status >= 400 THEN 1 ELSE 0 END),
+	SUM(CASE WHEN status >= 200 AND status < 300 THEN 1 ELSE 0 END),
+	COALESCE(AVG(CASE WHEN status >= 200 AND status < 300 THEN bytes END), 0)`
+
+// Columns of the host_anomaly table selected when querying anomalies.
+const hostAnomalyColumns = `host,kind,detail,job_id,detected_on`
+
+// Returns the metrics of the requests each job made to each host within the
+// period from, up to until, ordered by host, and job.
+func (h *HostClient) CrawlMetrics(from, until time.Time) ([]JobHostMetrics, error) {
+	const queryCrawlMetrics = `
+SELECT host, job_id, ` + hostMetricColumns + `
+FROM crawl_log
+WHERE crawled_on >= $1 AND crawled_on < $2
+GROUP BY host, job_id
+ORDER BY host, job_id`
+
+	rows, err := h.client.db.Query(queryCrawlMetrics, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := []JobHostMetrics{}
+	for rows.Next() {
+		var host sql.NullString
+		var jobId sql.NullInt64
+		m, err := scanHostMetrics(rows.Scan, &host, &jobId)
+		if err != nil {
+			return nil, err
+		}
+		m.From, m.Until = from, until
+		metrics = append(metrics, JobHostMetrics{JobId: common.JobId(jobId.Int64), Metrics: *m})
+	}
+	return metrics, rows.Err()
+}
+
+// Returns the metrics of all requests made to each of the hosts within the
+// period from, up to until, keyed by host. Hosts without requests within the
+// period are not included.
+func (h *HostClient) Metrics(hosts []string, from, until time.Time) (map[string]common.HostMetrics, error) {
+	const queryHostMetrics = `
+SELECT host, ` + hostMetricColumns + `
+FROM crawl_log
+WHERE host = ANY($1) AND crawled_on >= $2 AND crawled_on < $3
+GROUP BY host`
+
+	rows, err := h.client.db.Query(queryHostMetrics, pq.Array(hosts), from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metrics := map[string]common.HostMetrics{}
+	for rows.Next() {
+		var host sql.NullString
+		m, err := scanHostMetrics(rows.Scan, &host)
+		if err != nil {
+			return nil, err
+		}
+		m.From, m.Until = from, until
+		metrics[m.Host] = *m
+	}
+	return metrics, rows.Err()
+}
+
+// Returns the redirects found in the content of the URLs crawled within the
+// period from, up to until, by the job which crawled them.
+func (h *HostClient) CrawledRedirects(from, until time.Time) ([]HostRedirect, error) {
+	const queryCrawledRedirects = `
+SELECT DISTINCT crawl_log.job_id, crawl_log.host, target.url
+FROM crawl_log
+JOIN url_redirect ON url_redirect.url_id = crawl_log.url_id
+JOIN url AS target ON target.id = url_redirect.target_id
+WHERE crawl_log.crawled_on >= $1 AND crawl_log.crawled_on < $2
+ORDER BY crawl_log.host, crawl_log.job_id, target.url`
+
+	rows, err := h.client.db.Query(queryCrawledRedirects, from, until)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redirects := []HostRedirect{}
+	for rows.Next() {
+		var jobId sql.NullInt64
+		var host, target sql.NullString
+		if err := rows.Scan(&jobId, &host, &target); err != nil {
+			return nil, err
+		}
+		if !host.Valid || !target.Valid {
+			return nil, fmt.Errorf("Invalid crawled redirect")
+		}
+		redirects = append(redirects, HostRedirect{JobId: common.JobId(jobId.Int64), Host: host.String, Target: target.String})
+	}
+	return redirects, rows.Err()
+}
+
+// Stores the metrics of each host's requests within their period, so the
+// hosts' crawls are tracked over time. Metrics of a host already stored for
+// the end of the period are replaced.
+func (h *HostClient) StoreMetrics(metrics []common.HostMetrics) error {
+	const queryDeleteMetric = `DELETE FROM host_metric WHERE host = $1 AND period_end = $2`
+	const queryInsertMetric = `
+INSERT INTO host_metric (host, period_start, period_end, requests, errors, successes, avg_bytes)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	tx, err := h.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, m := range metrics {
+		if _, err := tx.Exec(queryDeleteMetric, m.Host, m.Until); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(queryInsertMetric, m.Host, m.From, m.Until, m.Requests, m.Errors, m.Successes, m.AvgBytes); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Records the anomaly detected in the job's crawls of the host. False is
+// returned if the kind of anomaly was already detected in the job's crawls of
+// the host, so each is only recorded, and notified, once.
+func (h *HostClient) AddAnomaly(a common.HostAnomaly) (bool, error) {
+	const queryInsertAnomaly = `
+INSERT INTO host_anomaly (host, kind, detail, job_id, detected_on)
+	SELECT $1, $2, $3, $4, $5
+	WHERE NOT EXISTS (SELECT 1 FROM host_anomaly WHERE host = $1 AND kind = $2 AND job_id = $4)`
+
+	res, err := h.client.db.Exec(queryInsertAnomaly, a.Host, a.Kind, a.Detail, a.JobId, a.DetectedOn)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Returns the reputation of the host from the metrics stored of its crawls, and
+// the anomalies detected in them, since the time. A host whose crawls were
+// never evaluated has an empty history, and a full score.
+func (h *HostClient) Reputation(host string, since time.Time) (*common.HostReputation, error) {
+	const queryMetrics = `
+SELECT host, period_start, period_end, requests, errors, successes, avg_bytes
+FROM host_metric
+WHERE host = $1 AND period_end > $2
+ORDER BY period_end DESC`
+	const queryAnomalies = `SELECT ` + hostAnomalyColumns + `
+FROM host_anomaly
+WHERE host = $1 AND detected_on >= $2
+ORDER BY detected_on DESC, id DESC`
+
+	rep := &common.HostReputation{
+		Host:      host,
+		Metrics:   common.HostMetrics{Host: host},
+		History:   []common.HostMetrics{},
+		Anomalies: []common.HostAnomaly{},
+	}
+
+	rows, err := h.client.db.Query(queryMetrics, host, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			metricHost                  sql.NullString
+			from, until                 pq.NullTime
+			requests, errors, successes sql.NullInt64
+			avgBytes                    sql.NullFloat64
+		)
+		if err := rows.Scan(&metricHost, &from, &until, &requests, &errors, &successes, &avgBytes); err != nil {
+			return nil, err
+		}
+		m := common.HostMetrics{
+			Host:      metricHost.String,
+			Requests:  requests.Int64,
+			Errors:    errors.Int64,
+			Successes: successes.Int64,
+			AvgBytes:  avgBytes.Float64,
+			From:      from.Time,
+			Until:     until.Time,
+		}
+		rep.History = append(rep.History, m)
+		rep.Metrics.Add(m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	anomalyRows, err := h.client.db.Query(queryAnomalies, host, since)
+	if err != nil {
+		return nil, err
+	}
+	defer anomalyRows.Close()
+	for anomalyRows.Next() {
+		var (
+			anomalyHost, kind, detail sql.NullString
+			jobId                     sql.NullInt64
+			detectedOn                pq.NullTime
+		)
+		if err := anomalyRows.Scan(&anomalyHost, &kind, &detail, &jobId, &detectedOn); err != nil {
+			return nil, err
+		}
+		rep.Anomalies = append(rep.Anomalies, common.HostAnomaly{
+			Host:       anomalyHost.String,
+			Kind:       kind.String,
+			Detail:     detail.String,
+			JobId:      common.JobId(jobId.Int64),
+			DetectedOn: detectedOn.Time,
+		})
+	}
+	if err := anomalyRows.Err(); err != nil {
+		return nil, err
+	}
+
+	rep.Score = common.HostReputationScore(rep.Metrics, len(rep.Anomalies))
+	return rep, nil
+}
+
+// Scans the host, any other leading columns into dest, and the
+// hostMetricColumns, into metrics with the scan function provided.
+func scanHostMetrics(scan func(dest ...interface{}) error, host *sql.NullString, dest ...interface{}) (*common.HostMetrics, error) {
+	var (
+		requests, errors, successes sql.NullInt64
+		avgBytes                    sql.NullFloat64
+	)
+	dest = append([]interface{}{host}, dest...)
+	if err := scan(append(dest, &requests, &errors, &successes, &avgBytes)...); err != nil {
+		return nil, err
+	}
+	if !host.Valid {
+		return nil, fmt.Errorf("Invalid host metrics")
+	}
+
+	return &common.HostMetrics{
+		Host:      host.String,
+		Requests:  requests.Int64,
+		Errors:    errors.Int64,
+		Successes: successes.Int64,
+		AvgBytes:  avgBytes.Float64,
+	}, nil
+}
@@ -0,0 +1,468 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Exports the job, its settings, crawled URLs, results, links, and link scores
+// into a self-contained archive. If bodies is set the raw, and sanitized HTML
+// stored for the job's URLs are exported as well. Archived jobs can be exported
+// without restoring them. Nil is returned if the job does not exist.
+func (j *JobClient) Export(id common.JobId, bodies bool) (*common.JobArchive, error) {
+	job, err := j.GetJob(id)
+	if err != nil || job == nil {
+		return nil, err
+	}
+
+	const jobURLIds = `
+	SELECT url_id FROM job_url WHERE job_id = $1
+	UNION
+	SELECT url_id FROM job_result WHERE job_id = $1
+	UNION
+	SELECT refer_id FROM job_result WHERE job_id = $1`
+
+	a := &common.JobArchive{
+		Job: common.ArchivedJob{
+			Version:   common.JobArchiveVersion,
+			Id:        job.Id,
+			CreatedOn: job.CreatedOn,
+			URLs:      make([]common.ArchivedJobURL, 0, len(job.URLs)),
+		},
+		URLs:       []common.ArchivedURL{},
+		Results:    []common.ArchivedResult{},
+		Links:      []common.ArchivedLink{},
+		LinkScores: map[string]float64{},
+	}
+	if a.Job.Settings, err = j.exportSettings(id); err != nil {
+		return nil, err
+	}
+	for _, u := range job.URLs {
+		ju := common.ArchivedJobURL{URL: u.URL}
+		if u.Completed {
+			ju.CompletedOn = archivedTime(u.CompletedOn)
+		}
+		a.Job.URLs = append(a.Job.URLs, ju)
+	}
+
+	urls, err := j.client.URLClient().queryURLs(`SELECT `+urlColumns+` FROM url WHERE url.id IN (`+jobURLIds+`) ORDER BY url.id`, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range urls {
+		a.URLs = append(a.URLs, archivedURL(u))
+	}
+	if bodies {
+		if a.Bodies, err = j.exportBodies(id, urls); err != nil {
+			return nil, err
+		}
+	}
+
+	const queryResults = `
+SELECT refer.url, url.url, r.level
+FROM job_result AS r
+JOIN url AS refer ON r.refer_id = refer.id
+JOIN url ON r.url_id = url.id
+WHERE r.job_id = $1`
+	if err := j.queryArchivePairs(queryResults, id, func(refer, u string, level sql.NullInt64) {
+		r := common.ArchivedResult{Refer: refer, URL: u}
+		if level.Valid {
+			l := int(level.Int64)
+			r.Level = &l
+		}
+		a.Results = append(a.Results, r)
+	}); err != nil {
+		return nil, err
+	}
+
+	const queryLinks = `
+SELECT refer.url, url.url, NULL
+FROM url_link
+JOIN url AS refer ON url_link.refer_id = refer.id
+JOIN url ON url_link.url_id = url.id
+WHERE url_link.refer_id IN (` + jobURLIds + `) AND url_link.url_id IN (` + jobURLIds + `)`
+	if err := j.queryArchivePairs(queryLinks, id, func(refer, u string, _ sql.NullInt64) {
+		a.Links = append(a.Links, common.ArchivedLink{Refer: refer, URL: u})
+	}); err != nil {
+		return nil, err
+	}
+
+	const queryScoreAlgorithm = `SELECT algorithm FROM job_link_score WHERE job_id = $1 LIMIT 1`
+	var algorithm sql.NullString
+	if err := j.client.db.QueryRow(queryScoreAlgorithm, id).Scan(&algorithm); err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if algorithm.Valid {
+		a.LinkScoring = algorithm.String
+		if a.LinkScores, err = j.LinkScores(id); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Returns the settings the job was scheduled with.
+func (j *JobClient) exportSettings(id common.JobId) (*common.ArchivedJobSettings, error) {
+	const querySettings = `
+SELECT crawl_window, crawl_window_tz, extract_text, max_urls, scope, strip_params, keep_fragments
+FROM job WHERE id = $1`
+
+	var (
+		window, tz, scope sql.NullString
+		maxURLs           sql.NullInt64
+	)
+	settings := &common.ArchivedJobSettings{}
+	if err := j.client.db.QueryRow(querySettings, id).Scan(&window, &tz, &settings.ExtractText, &maxURLs, &scope,
+		pq.Array(&settings.StripParams), &settings.KeepFragments); err != nil {
+		return nil, err
+	}
+	settings.CrawlWindow, settings.CrawlWindowTZ = window.String, tz.String
+	settings.MaxURLs, settings.Scope = int(maxURLs.Int64), scope.String
+
+	var err error
+	if settings.JSONPaths, err = j.JSONPaths(id); err != nil {
+		return nil, err
+	}
+	if settings.Flags, err = j.Flags(id); err != nil {
+		return nil, err
+	}
+	if settings.URLPatterns, err = j.URLPatterns(id); err != nil {
+		return nil, err
+	}
+	if settings.Tags, err = j.Tags(id); err != nil {
+		return nil, err
+	}
+	if settings.StatusRules, err = j.StatusRules(id); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Returns the raw HTML stored for the job's URLs, read from the cold store if
+// the job is archived.
+func (j *JobClient) exportBodies(id common.JobId, urls []*URL) ([]common.ArchivedBody, error) {
+	const queryJobHTML = `
+SELECT url_id FROM url_html
+WHERE (raw IS NOT NULL OR raw_tiered OR sanitized IS NOT NULL OR sanitized_tiered) AND url_id IN (` + queryJobURLIds + `)
+ORDER BY url_id`
+
+	ids, err := j.urlIds(queryJobHTML, id)
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[common.URLId]string, len(urls))
+	for _, u := range urls {
+		byId[u.Id] = u.URL
+	}
+
+	bodies := make([]common.ArchivedBody, 0, len(ids))
+	for _, urlId := range ids {
+		u, ok := byId[urlId]
+		if !ok {
+			continue
+		}
+		h, err := j.client.URLClient().GetHTML(urlId)
+		if err != nil {
+			return nil, err
+		}
+		if h == nil || (h.Raw == "" && h.Sanitized == "") {
+			continue
+		}
+		bodies = append(bodies, common.ArchivedBody{URL: u, HTML: h.Raw, Sanitized: h.Sanitized, StoredOn: h.StoredOn})
+	}
+	return bodies, nil
+}
+
+// Queries refer URL, URL, and level rows for the job id, calling fn for each row.
+func (j *JobClient) queryArchivePairs(query string, id common.JobId, fn func(refer, url string, level sql.NullInt64)) error {
+	rows, err := j.client.db.Query(query, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var refer, u sql.NullString
+		var level sql.NullInt64
+		if err := rows.Scan(&refer, &u, &level); err != nil {
+			return err
+		}
+		if !refer.Valid || !u.Valid {
+			return fmt.Errorf("Invalid archive row for job id %d", id)
+		}
+		fn(refer.String, u.String, level)
+	}
+	return rows.Err()
+}
+
+// Imports a job archive as a new job, with the archived settings, returning the
+// new job's id. The import is transactional, either all of the job is imported,
+// or none of it is if any part fails.
+//
+// Archives are untrusted, so the crawl information, links, and HTML shared by
+// all jobs are never replaced. URLs already known keep theirs, and only URLs
+// added by the import take the archive's, with their crawl time at most the
+// time of import, so a URL can't be imported as fresh forever. The archived
+// sanitized HTML is not imported, since it is served to be rendered, and the
+// archive's can't be trusted to be sanitized. Job URLs which were not completed
+// when the job was archived are imported as completed at the time of import,
+// because their crawl can not be resumed.
+func (j *JobClient) Import(a *common.JobArchive) (common.JobId, error) {
+	if len(a.Job.URLs) == 0 {
+		return common.InvalidId, fmt.Errorf("Archived job has no URLs")
+	}
+	if a.LinkScoring != "" && !common.ValidLinkScoreAlgorithm(a.LinkScoring) {
+		return common.InvalidId, fmt.Errorf("Invalid link scoring algorithm %s", a.LinkScoring)
+	}
+	settings := common.ArchivedJobSettings{}
+	if a.Job.Settings != nil {
+		settings = *a.Job.Settings
+	}
+	if err := settings.Validate(); err != nil {
+		return common.InvalidId, err
+	}
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return common.InvalidId, err
+	}
+	id, err := j.importJob(tx, a, settings)
+	if err != nil {
+		tx.Rollback()
+		return common.InvalidId, err
+	}
+	return id, tx.Commit()
+}
+
+// Imports the archive as a new job with the settings within the transaction.
+// See Import.
+func (j *JobClient) importJob(tx *sql.Tx, a *common.JobArchive, settings common.ArchivedJobSettings) (common.JobId, error) {
+	const queryInsertJob = `
+INSERT INTO job (created_on, started_on, crawl_window, crawl_window_tz, extract_text, max_urls, scope, strip_params, keep_fragments)
+VALUES ($1, $1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id,created_on,archived_on,paused_on,crawl_window,crawl_window_tz,cancelled_on,started_on`
+	const queryInsertJobURL = `INSERT INTO job_url (job_id, url_id, completed_on) VALUES ($1, $2, $3)`
+	const queryInsertResult = `
+INSERT INTO job_result (job_id, refer_id, url_id, level)
+	SELECT $1, $2, $3, $4
+	WHERE NOT EXISTS (SELECT 1 FROM job_result WHERE job_id = $1 AND refer_id = $2 AND url_id = $3)`
+	const queryInsertLink = `
+INSERT INTO url_link (url_id, refer_id)
+	SELECT $1, $2
+	WHERE NOT EXISTS (SELECT 1 FROM url_link WHERE url_id = $1 AND refer_id = $2)`
+	const queryInsertHTML = `INSERT INTO url_html (url_id, raw, stored_on) VALUES ($1, $2, $3)`
+	const queryInsertLinkScore = `INSERT INTO job_link_score (job_id, url_id, score, algorithm) VALUES ($1, $2, $3, $4)`
+
+	now := time.Now().UTC()
+
+	// URLs added by the import, whose crawl information, links, and HTML are
+	// the archive's.
+	added := map[string]bool{}
+	ids := make(map[string]common.URLId, len(a.URLs))
+	urlId := func(u, mime string) (common.URLId, error) {
+		if id, ok := ids[u]; ok {
+			return id, nil
+		}
+		id, isNew, err := importURL(tx, u, mime)
+		if err != nil {
+			return 0, err
+		}
+		ids[u], added[u] = id, isNew
+		return id, nil
+	}
+
+	for _, au := range a.URLs {
+		id, err := urlId(au.URL, au.Mime)
+		if err != nil {
+			return common.InvalidId, err
+		}
+		if added[au.URL] && au.CrawledOn != nil {
+			if err := importURLCrawl(tx, id, au, now); err != nil {
+				return common.InvalidId, err
+			}
+		}
+	}
+
+	for _, b := range a.Bodies {
+		id, ok := ids[b.URL]
+		if !ok || !added[b.URL] || b.HTML == "" {
+			continue
+		}
+		if _, err := tx.Exec(queryInsertHTML, id, b.HTML, importedTime(b.StoredOn, now)); err != nil {
+			return common.InvalidId, err
+		}
+	}
+
+	createdOn := importedTime(a.Job.CreatedOn, now)
+	if a.Job.CreatedOn.IsZero() {
+		createdOn = now
+	}
+	var window, tz sql.NullString
+	if settings.CrawlWindow != "" {
+		window = sql.NullString{String: settings.CrawlWindow, Valid: true}
+		tz = sql.NullString{String: settings.CrawlWindowTZ, Valid: true}
+	}
+	maxURLs := sql.NullInt64{Int64: int64(settings.MaxURLs), Valid: settings.MaxURLs > 0}
+	scope := sql.NullString{String: settings.Scope, Valid: settings.Scope != ""}
+	job, err := getJobFromRow(tx.QueryRow(queryInsertJob, createdOn, window, tz, settings.ExtractText, maxURLs, scope,
+		pq.Array(settings.StripParams), settings.KeepFragments))
+	if err != nil {
+		return common.InvalidId, err
+	}
+	if job == nil {
+		return common.InvalidId, fmt.Errorf("Failed to get created job")
+	}
+	if err := createJobSettings(tx, job.Id, JobSettings{
+		JSONPaths:   settings.JSONPaths,
+		Flags:       settings.Flags,
+		URLPatterns: settings.URLPatterns,
+		Tags:        settings.Tags,
+		StatusRules: settings.StatusRules,
+	}); err != nil {
+		return common.InvalidId, err
+	}
+
+	for _, ju := range a.Job.URLs {
+		id, err := urlId(ju.URL, common.GuessURLsMime(ju.URL))
+		if err != nil {
+			return common.InvalidId, err
+		}
+		completedOn := now
+		if ju.CompletedOn != nil {
+			completedOn = importedTime(*ju.CompletedOn, now)
+		}
+		if _, err := tx.Exec(queryInsertJobURL, job.Id, id, completedOn); err != nil {
+			return common.InvalidId, err
+		}
+	}
+
+	// Only the links found on URLs added by the import are imported, so the
+	// links of known URLs, which are reused by other jobs, aren't changed.
+	for _, l := range a.Links {
+		referId, err := urlId(l.Refer, common.GuessURLsMime(l.Refer))
+		if err != nil {
+			return common.InvalidId, err
+		}
+		if !added[l.Refer] {
+			continue
+		}
+		id, err := urlId(l.URL, common.GuessURLsMime(l.URL))
+		if err != nil {
+			return common.InvalidId, err
+		}
+		if _, err := tx.Exec(queryInsertLink, id, referId); err != nil {
+			return common.InvalidId, err
+		}
+	}
+
+	for _, r := range a.Results {
+		referId, err := urlId(r.Refer, common.GuessURLsMime(r.Refer))
+		if err != nil {
+			return common.InvalidId, err
+		}
+		id, err := urlId(r.URL, common.GuessURLsMime(r.URL))
+		if err != nil {
+			return common.InvalidId, err
+		}
+		level := sql.NullInt64{}
+		if r.Level != nil {
+			level = sql.NullInt64{Int64: int64(*r.Level), Valid: true}
+		}
+		if _, err := tx.Exec(queryInsertResult, job.Id, referId, id, level); err != nil {
+			return common.InvalidId, err
+		}
+	}
+
+	if a.LinkScoring != "" {
+		for u, score := range a.LinkScores {
+			id, err := urlId(u, common.GuessURLsMime(u))
+			if err != nil {
+				return common.InvalidId, err
+			}
+			if _, err := tx.Exec(queryInsertLinkScore, job.Id, id, score, a.LinkScoring); err != nil {
+				return common.InvalidId, err
+			}
+		}
+	}
+
+	return job.Id, nil
+}
+
+// Returns the id of the URL, adding it with the mime if it is not known
+// within the transaction. isNew is true if the URL was added.
+func importURL(tx *sql.Tx, u, mime string) (id common.URLId, isNew bool, err error) {
+	const queryInsertURL = `INSERT INTO url (url, mime) VALUES ($1, $2) ON CONFLICT (url) DO NOTHING RETURNING id`
+	const queryURLId = `SELECT id FROM url WHERE url = $1`
+
+	err = tx.QueryRow(queryInsertURL, u, mime).Scan(&id)
+	if err == nil {
+		return id, true, nil
+	} else if err != sql.ErrNoRows {
+		return 0, false, err
+	}
+	if err := tx.QueryRow(queryURLId, u).Scan(&id); err != nil {
+		return 0, false, err
+	}
+	return id, false, nil
+}
+
+// Sets the crawl information of the URL added by the import to the archived
+// URL's within the transaction. The crawl time is at most the time of import.
+func importURLCrawl(tx *sql.Tx, urlId common.URLId, au common.ArchivedURL, now time.Time) error {
+	const queryURLUpdateCrawl = `
+UPDATE url SET crawled_on = $1, status = $2, published_on = $3, modified_on = $4, word_count = $5, title = $6, description = $7, h1 = $8
+	WHERE id = $9`
+
+	var publishedOn, modifiedOn pq.NullTime
+	if au.PublishedOn != nil {
+		publishedOn = pq.NullTime{Time: *au.PublishedOn, Valid: true}
+	}
+	if au.ModifiedOn != nil {
+		modifiedOn = pq.NullTime{Time: *au.ModifiedOn, Valid: true}
+	}
+	if _, err := tx.Exec(queryURLUpdateCrawl, importedTime(*au.CrawledOn, now), au.Status, publishedOn, modifiedOn,
+		au.WordCount, au.Title, au.Description, au.H1, urlId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the archived time, or the time of import if the archived time is
+// after it.
+func importedTime(t, now time.Time) time.Time {
+	if t.After(now) {
+		return now
+	}
+	return t
+}
+
+// Returns the archived form of the URL and the information crawled from it.
+func archivedURL(u *URL) common.ArchivedURL {
+	au := common.ArchivedURL{
+		URL:         u.URL,
+		Mime:        u.Mime,
+		Status:      u.Status,
+		PublishedOn: archivedTime(u.Info.PublishedOn),
+		ModifiedOn:  archivedTime(u.Info.ModifiedOn),
+		WordCount:   u.Info.WordCount,
+		Title:       u.Info.Title,
+		Description: u.Info.Description,
+		H1:          u.Info.H1,
+	}
+	if u.Crawled {
+		au.CrawledOn = archivedTime(u.CrawledOn)
+	}
+	return au
+}
+
+// Returns a pointer to the time, or nil if the time is zero.
+func archivedTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -5,8 +5,18 @@ import (
 	"fmt"
 	"github.com/jasdel/harvester/internal/common"
 	"github.com/lib/pq"
+	"net/url"
+	"strings"
+	"time"
 )
 
+// Sub query selecting the ids of all Job URLs and their crawled results for
+// the job id parameter $1.
+const queryJobURLIds = `
+	SELECT url_id FROM job_url WHERE job_id = $1
+	UNION
+	SELECT url_id FROM job_result WHERE job_id = $1`
+
 // Provides a name spaced collection of Job based storage operations. JobClient
 // does not hold non go-routine state, and is safe to share across multiples.
 type JobClient struct {
@@ -17,14 +27,20 @@ type JobClient struct {
 // Extracts a job from a QueryRow.  Nil for the job will be returned
 // if the job does not exist.
 // Expects the query columns to be in the order of:
-// 		job_id, created_on
+// 		job_id, created_on, archived_on, paused_on, crawl_window, crawl_window_tz, cancelled_on, started_on
 func getJobFromRow(row *sql.Row) (*Job, error) {
 	var (
-		id        sql.NullInt64
-		createdOn pq.NullTime
+		id            sql.NullInt64
+		createdOn     pq.NullTime
+		archivedOn    pq.NullTime
+		pausedOn      pq.NullTime
+		crawlWindow   sql.NullString
+		crawlWindowTZ sql.NullString
+		cancelledOn   pq.NullTime
+		startedOn     pq.NullTime
 	)
 
-	if err := row.Scan(&id, &createdOn); err != nil {
+	if err := row.Scan(&id, &createdOn, &archivedOn, &pausedOn, &crawlWindow, &crawlWindowTZ, &cancelledOn, &startedOn); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
@@ -35,10 +51,23 @@ func getJobFromRow(row *sql.Row) (*Job, error) {
 		return nil, fmt.Errorf("Invalid result for get job")
 	}
 
-	return &Job{
-		Id:        common.JobId(id.Int64),
-		CreatedOn: createdOn.Time,
-	}, nil
+	job := &Job{
+		Id:          common.JobId(id.Int64),
+		CreatedOn:   createdOn.Time,
+		ArchivedOn:  archivedOn.Time,
+		PausedOn:    pausedOn.Time,
+		CancelledOn: cancelledOn.Time,
+		StartedOn:   startedOn.Time,
+	}
+	if crawlWindow.Valid {
+		w, err := common.ParseCrawlWindow(crawlWindow.String, crawlWindowTZ.String)
+		if err != nil {
+			return nil, err
+		}
+		job.CrawlWindow = w
+	}
+
+	return job, nil
 }
 
 // Extracts the Job URLs from a Query of rows.
@@ -76,7 +105,7 @@ func getJobURLFromRows(rows *sql.Rows) (jobURL JobURL, err error) {
 // Create a new job entry with its URLS, returning a pointer to the newly
 // created Job.
 func (j *JobClient) CreateJobFromURLs(urls []string) (*Job, error) {
-	const queryInsertJob = `INSERT INTO job DEFAULT VALUES RETURNING id,created_on`
+	const queryInsertJob = `INSERT INTO job DEFAULT VALUES RETURNING id,created_on,archived_on,paused_on,crawl_window,crawl_window_tz,cancelled_on,started_on`
 	const queryInsertJobURLs = `INSERT INTO job_url (job_id, url_id) VALUES ($1, $2)`
 
 	job, err := getJobFromRow(j.client.db.QueryRow(queryInsertJob))
@@ -103,10 +132,113 @@ func (j *JobClient) CreateJobFromURLs(urls []string) (*Job, error) {
 	return job, nil
 }
 
+// Creates a job for each of the lists of URLs, with the settings, returning
+// the created jobs in the order of the lists. The jobs are created in a single
+// transaction, so either all of the jobs are created, or none are if any
+// fails. The URLs themselves are added before the jobs, since they are shared
+// by all jobs.
+func (j *JobClient) CreateJobsFromURLs(urls [][]string, settings JobSettings) ([]*Job, error) {
+	const queryInsertJob = `
+INSERT INTO job (crawl_window, crawl_window_tz, extract_text, api_key_id, max_urls, deadline, scope, strip_params, keep_fragments)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id,created_on,archived_on,paused_on,crawl_window,crawl_window_tz,cancelled_on,started_on`
+	const queryInsertJobURLs = `INSERT INTO job_url (job_id, url_id) VALUES ($1, $2)`
+
+	urlIds := make([][]common.URLId, len(urls))
+	for i, list := range urls {
+		urlIds[i] = make([]common.URLId, 0, len(list))
+		for _, u := range list {
+			url, err := j.client.URLClient().GetOrAddURLByURL(u, common.DefaultURLMime)
+			if err != nil {
+				return nil, err
+			}
+			urlIds[i] = append(urlIds[i], url.Id)
+		}
+	}
+
+	var window, tz sql.NullString
+	if w := settings.CrawlWindow; w != nil {
+		window = sql.NullString{String: w.String(), Valid: true}
+		tz = sql.NullString{String: w.Location.String(), Valid: true}
+	}
+	apiKeyId := sql.NullInt64{Int64: settings.APIKeyId, Valid: settings.APIKeyId != 0}
+	maxURLs := sql.NullInt64{Int64: int64(settings.MaxURLs), Valid: settings.MaxURLs > 0}
+	deadline := pq.NullTime{Time: settings.Deadline, Valid: !settings.Deadline.IsZero()}
+	scope := sql.NullString{String: settings.Scope, Valid: settings.Scope != ""}
+	stripParams := pq.Array(settings.StripParams)
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]*Job, 0, len(urls))
+	for _, ids := range urlIds {
+		job, err := getJobFromRow(tx.QueryRow(queryInsertJob, window, tz, settings.ExtractText, apiKeyId, maxURLs, deadline, scope, stripParams, settings.KeepFragments))
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if job == nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("Failed to get created job")
+		}
+		if err := createJobSettings(tx, job.Id, settings); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		job.URLs = make([]JobURL, 0, len(ids))
+		for _, urlId := range ids {
+			if _, err := tx.Exec(queryInsertJobURLs, job.Id, urlId); err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+			job.URLs = append(job.URLs, JobURL{JobId: job.Id, URLId: urlId})
+		}
+		jobs = append(jobs, job)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Sets the settings of the created job stored outside of the job's row within
+// the transaction.
+func createJobSettings(tx *sql.Tx, id common.JobId, settings JobSettings) error {
+	if settings.JSONPaths != nil {
+		if err := setJSONPaths(tx, id, settings.JSONPaths); err != nil {
+			return err
+		}
+	}
+	if settings.Flags != nil {
+		if err := setFlags(tx, id, settings.Flags); err != nil {
+			return err
+		}
+	}
+	if settings.URLPatterns != nil {
+		if err := setURLPatterns(tx, id, settings.URLPatterns); err != nil {
+			return err
+		}
+	}
+	if settings.Tags != nil {
+		if err := setTags(tx, id, settings.Tags); err != nil {
+			return err
+		}
+	}
+	if settings.StatusRules != nil {
+		if err := setStatusRules(tx, id, settings.StatusRules); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Searches for a job, and returns it and its URLs if the job exist. Nil is return if
 // the job does not exist
 func (j *JobClient) GetJob(id common.JobId) (*Job, error) {
-	const queryJob = `SELECT id,created_on FROM job WHERE id = $1`
+	const queryJob = `SELECT id,created_on,archived_on,paused_on,crawl_window,crawl_window_tz,cancelled_on,started_on FROM job WHERE id = $1`
 
 	job, err := getJobFromRow(j.client.db.QueryRow(queryJob, id))
 	if err != nil || job == nil {
@@ -139,6 +271,103 @@ WHERE job_url.job_id = $1`
 	return job, err
 }
 
+// State of a job in a query grouped by job.id, one of the common.JobStatus
+// constants. Cancelled jobs are cancelled even if paused, and paused jobs are
+// paused even if waiting.
+const queryJobSummaryStatus = `CASE
+	WHEN job.cancelled_on IS NOT NULL THEN '` + common.JobStatusCancelled + `'
+	WHEN job.paused_on IS NOT NULL THEN '` + common.JobStatusPaused + `'
+	WHEN job.started_on IS NULL AND COUNT(job_url.url_id) > COUNT(job_url.completed_on) THEN '` + common.JobStatusWaiting + `'
+	WHEN COUNT(job_url.url_id) > COUNT(job_url.completed_on) THEN '` + common.JobStatusRunning + `'
+	ELSE '` + common.JobStatusCompleted + `' END`
+
+// Columns, and joins of job summaries. Queries selecting job summaries must
+// group by job.id, and can use jobSummaries to extract them.
+const queryJobSummaries = `
+SELECT job.id, job.created_on, job.archived_on IS NOT NULL, job.paused_on IS NOT NULL, job.cancelled_on IS NOT NULL,
+	COUNT(job_url.completed_on), COUNT(job_url.url_id) - COUNT(job_url.completed_on),
+	` + queryJobSummaryStatus + `,
+	(SELECT string_agg(job_tag.tag, ',' ORDER BY job_tag.tag) FROM job_tag WHERE job_tag.job_id = job.id)
+FROM job
+LEFT JOIN job_url ON job_url.job_id = job.id`
+
+// Returns summaries of the jobs matching the filter, newest first. Up to the
+// limit of jobs are returned, skipping the offset of newer jobs.
+func (j *JobClient) ListJobs(filter JobListFilter, limit, offset int) ([]common.JobSummary, error) {
+	where, args := filter.where(nil)
+	having, args := filter.having(args)
+	args = append(args, limit, offset)
+
+	queryJobList := queryJobSummaries + `
+WHERE TRUE` + where + `
+GROUP BY job.id` + having + fmt.Sprintf(`
+ORDER BY job.id DESC
+LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+
+	return j.jobSummaries(queryJobList, args...)
+}
+
+// Returns the summary of the job, nil if the job doesn't exist.
+func (j *JobClient) Summary(id common.JobId) (*common.JobSummary, error) {
+	const queryJobSummary = queryJobSummaries + `
+WHERE job.id = $1
+GROUP BY job.id`
+
+	jobs, err := j.jobSummaries(queryJobSummary, id)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// Queries the job summaries selected by the query.
+func (j *JobClient) jobSummaries(query string, args ...interface{}) ([]common.JobSummary, error) {
+	rows, err := j.client.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []common.JobSummary{}
+	for rows.Next() {
+		var (
+			id                          sql.NullInt64
+			createdOn                   pq.NullTime
+			archived, paused, cancelled sql.NullBool
+			completed, pending          sql.NullInt64
+			status, tags                sql.NullString
+		)
+		if err := rows.Scan(&id, &createdOn, &archived, &paused, &cancelled, &completed, &pending, &status, &tags); err != nil {
+			return nil, err
+		}
+		if !id.Valid {
+			return nil, fmt.Errorf("Invalid result for job list")
+		}
+
+		job := common.JobSummary{
+			Id:        common.JobId(id.Int64),
+			CreatedOn: createdOn.Time,
+			Completed: int(completed.Int64),
+			Pending:   int(pending.Int64),
+			Archived:  archived.Valid && archived.Bool,
+			Paused:    paused.Valid && paused.Bool,
+			Cancelled: cancelled.Valid && cancelled.Bool,
+			Status:    status.String,
+			Tags:      []string{},
+		}
+		if tags.Valid && tags.String != "" {
+			// Tags can't contain commas
+			job.Tags = strings.Split(tags.String, ",")
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
 // Returns if the Job id matches an existing job.
 func (j *JobClient) JobExists(id common.JobId) (bool, error) {
 	const queryJobExists = `SELECT exists(SELECT 1 FROM job WHERE id = $1)`
@@ -152,45 +381,278 @@ func (j *JobClient) JobExists(id common.JobId) (bool, error) {
 
 }
 
+// Pauses the job. Queued items of a paused job are parked in its frontier of
+// pending URLs instead of being crawled. False is returned if the job was
+// already paused, or does not exist.
+func (j *JobClient) Pause(id common.JobId) (bool, error) {
+	const queryPauseJob = `UPDATE job SET paused_on = $2 WHERE id = $1 AND paused_on IS NULL`
+
+	return j.updateJob(queryPauseJob, id, time.Now().UTC())
+}
+
+// Resumes the paused job, returning its frontier of pending URLs which must be
+// re-queued to continue crawling. False is returned if the job was not paused,
+// or does not exist.
+func (j *JobClient) Resume(id common.JobId) (bool, []*common.URLQueueItem, error) {
+	const queryResumeJob = `UPDATE job SET paused_on = NULL WHERE id = $1 AND paused_on IS NOT NULL`
+
+	resumed, err := j.updateJob(queryResumeJob, id)
+	if err != nil || !resumed {
+		return false, nil, err
+	}
+
+	// All of the job's pending URLs are re-queued, so parked URLs must not also
+	// be re-queued when the job's crawl window opens.
+	if _, err := j.client.URLClient().UnparkPending(id); err != nil {
+		return false, nil, err
+	}
+
+	items, err := j.client.URLClient().GetPending(id)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, items, nil
+}
+
+// Cancels the job. The job's frontier of pending URLs is drained, and its Job
+// URLs which have not completed are marked complete, so the job ends. Queued
+// items of a cancelled job are dropped instead of being crawled. False is
+// returned if the job was already cancelled, or does not exist.
+func (j *JobClient) Cancel(id common.JobId) (bool, error) {
+	const queryCancelJob = `UPDATE job SET cancelled_on = $2 WHERE id = $1 AND cancelled_on IS NULL`
+	const queryDeletePending = `DELETE FROM url_pending WHERE job_id = $1`
+	const queryCompleteJobURLs = `UPDATE job_url SET completed_on = $2 WHERE job_id = $1 AND completed_on IS NULL`
+
+	now := time.Now().UTC()
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.Exec(queryCancelJob, id, now)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		return false, err
+	}
+
+	if _, err := tx.Exec(queryDeletePending, id); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if _, err := tx.Exec(queryCompleteJobURLs, id, now); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns true if the job is cancelled.
+func (j *JobClient) IsCancelled(id common.JobId) (bool, error) {
+	const queryJobCancelled = `SELECT cancelled_on IS NOT NULL FROM job WHERE id = $1`
+
+	var cancelled sql.NullBool
+	if err := j.client.db.QueryRow(queryJobCancelled, id).Scan(&cancelled); err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	return cancelled.Valid && cancelled.Bool, nil
+}
+
+// Returns true if the job is paused.
+func (j *JobClient) IsPaused(id common.JobId) (bool, error) {
+	const queryJobPaused = `SELECT paused_on IS NOT NULL FROM job WHERE id = $1`
+
+	var paused sql.NullBool
+	if err := j.client.db.QueryRow(queryJobPaused, id).Scan(&paused); err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	return paused.Valid && paused.Bool, nil
+}
+
+// Returns the ids of jobs which are not paused, but still have pending URLs.
+func (j *JobClient) PendingJobs() ([]common.JobId, error) {
+	const queryPendingJobs = `
+SELECT DISTINCT url_pending.job_id
+FROM url_pending
+JOIN job ON job.id = url_pending.job_id
+WHERE job.paused_on IS NULL
+ORDER BY url_pending.job_id`
+
+	return j.jobIds(queryPendingJobs)
+}
+
+// Returns the job ids selected by the query.
+func (j *JobClient) jobIds(query string, args ...interface{}) ([]common.JobId, error) {
+	rows, err := j.client.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []common.JobId{}
+	for rows.Next() {
+		var id sql.NullInt64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, common.JobId(id.Int64))
+	}
+	return ids, rows.Err()
+}
+
+// Sets the hours of the day the job's URLs are allowed to be crawled. A nil
+// window allows the job to be crawled at any time.
+func (j *JobClient) SetCrawlWindow(id common.JobId, w *common.CrawlWindow) error {
+	const querySetCrawlWindow = `UPDATE job SET crawl_window = $2, crawl_window_tz = $3 WHERE id = $1`
+
+	var window, tz sql.NullString
+	if w != nil {
+		window = sql.NullString{String: w.String(), Valid: true}
+		tz = sql.NullString{String: w.Location.String(), Valid: true}
+	}
+
+	if _, err := j.client.db.Exec(querySetCrawlWindow, id, window, tz); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the job's crawl window, nil if the job can be crawled at any time,
+// or does not exist.
+func (j *JobClient) CrawlWindow(id common.JobId) (*common.CrawlWindow, error) {
+	const queryCrawlWindow = `SELECT crawl_window, crawl_window_tz FROM job WHERE id = $1`
+
+	var window, tz sql.NullString
+	if err := j.client.db.QueryRow(queryCrawlWindow, id).Scan(&window, &tz); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !window.Valid {
+		return nil, nil
+	}
+	return common.ParseCrawlWindow(window.String, tz.String)
+}
+
+// Returns the ids of jobs which are not paused, or waiting to be started, but
+// have URLs parked outside of their crawl window.
+func (j *JobClient) ParkedJobs() ([]common.JobId, error) {
+	const queryParkedJobs = `
+SELECT DISTINCT url_pending.job_id
+FROM url_pending
+JOIN job ON job.id = url_pending.job_id
+WHERE job.paused_on IS NULL AND job.started_on IS NOT NULL AND url_pending.parked_on IS NOT NULL
+ORDER BY url_pending.job_id`
+
+	return j.jobIds(queryParkedJobs)
+}
+
+// Executes the update query of a single job, returning true if the job was updated.
+func (j *JobClient) updateJob(query string, args ...interface{}) (bool, error) {
+	res, err := j.client.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Returns an error if the job does not exist.
+func (j *JobClient) mustExist(id common.JobId) error {
+	exists, err := j.JobExists(id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("Job does not exist")
+	}
+	return nil
+}
+
 // Queries the result URLs for a job by id, and generates the JobResult object.
 // Results will be grouped in list under the refer URL which those result URLs
 // were found from.  Duplicate results under the same refer URL will be removed,
-// and not included in the JobResults returned.
-func (j *JobClient) Result(id common.JobId, mimeFilter string) (common.JobResults, error) {
-	if exists, err := j.JobExists(id); err != nil {
-		return nil, err
-	} else if exists == false {
-		return nil, fmt.Errorf("Job does not exist")
+// and not included in the JobResults returned. Only results matching the
+// filter are included.
+func (j *JobClient) Result(id common.JobId, filter ResultFilter) (common.JobResults, error) {
+	result, _, err := j.result(id, filter, nil, 0)
+	return result, err
+}
+
+// Returns a page of the job's results, up to the limit of results, continuing
+// from the cursor. A nil cursor returns the first page. Results are filtered
+// the same as Result. The cursor of the next page is returned, nil if this is
+// the last page.
+func (j *JobClient) ResultPage(id common.JobId, filter ResultFilter, after *common.ResultCursor, limit int) (common.JobResults, *common.ResultCursor, error) {
+	return j.result(id, filter, after, limit)
+}
+
+// Queries the job's results, paging them if limit is greater than zero.
+func (j *JobClient) result(id common.JobId, filter ResultFilter, after *common.ResultCursor, limit int) (common.JobResults, *common.ResultCursor, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, nil, err
 	}
 
-	const queryJobResult = `
-SELECT refer.url as refer, url.url as url, url.mime as mime
+	queryJobResult := `
+SELECT job_result.refer_id, job_result.url_id, refer.url as refer, url.url as url, url.mime as mime
 FROM job_result
 LEFT JOIN url AS url on job_result.url_id = url.id
 LEFT join url as refer on job_result.refer_id = refer.id
-WHERE job_result.job_id = $1 and url.mime LIKE $2`
+WHERE job_result.job_id = $1`
+	cond, args := filter.where([]interface{}{id})
+	queryJobResult += cond
+	if after != nil {
+		args = append(args, after.ReferId, after.URLId)
+		queryJobResult += fmt.Sprintf(`
+	and (job_result.refer_id, job_result.url_id) > ($%d, $%d)`, len(args)-1, len(args))
+	}
+	if limit > 0 {
+		// One more result than the limit is selected to know if there
+		// is a next page.
+		args = append(args, limit+1)
+		queryJobResult += fmt.Sprintf(`
+ORDER BY job_result.refer_id, job_result.url_id
+LIMIT $%d`, len(args))
+	}
 
-	rows, err := j.client.db.Query(queryJobResult, id, mimeFilter+"%")
+	rows, err := j.client.db.Query(queryJobResult, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	result := make(common.JobResults)
 	knownResults := make(map[string]map[string]struct{})
+	var last, next *common.ResultCursor
+	n := 0
 	for rows.Next() {
+		var referId, urlId sql.NullInt64
 		var refer sql.NullString
 		var u sql.NullString
 		var mime sql.NullString
-		if err := rows.Scan(&refer, &u, &mime); err != nil {
-			return nil, err
+		if err := rows.Scan(&referId, &urlId, &refer, &u, &mime); err != nil {
+			return nil, nil, err
 		}
 		if !refer.Valid || !u.Valid {
 			// Invalid mimes are ignored, because they might be null, if the URL
 			// wasn't crawled deeper.
-			return nil, fmt.Errorf("Invalid job result for job id %d", id)
+			return nil, nil, fmt.Errorf("Invalid job result for job id %d", id)
 		}
 
+		if n++; limit > 0 && n > limit {
+			next = last
+			break
+		}
+		last = &common.ResultCursor{JobId: id, ReferId: common.URLId(referId.Int64), URLId: common.URLId(urlId.Int64)}
+
 		if _, ok := result[refer.String]; !ok {
 			result[refer.String] = []string{}
 			knownResults[refer.String] = make(map[string]struct{})
@@ -204,9 +666,614 @@ WHERE job_result.job_id = $1 and url.mime LIKE $2`
 
 		result[refer.String] = append(result[refer.String], u.String)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return result, next, nil
+}
+
+// Generates the freshness report of a job's crawled URLs, grouped by host. Both
+// the Job URLs and their crawled results are included in the report. URLs are
+// reported by their last updated date relative to the current time.
+func (j *JobClient) Freshness(id common.JobId) (common.FreshnessReport, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryJobFreshness = `
+SELECT url.url, url.published_on, url.modified_on
+FROM url
+WHERE url.crawled_on IS NOT NULL AND url.id IN (` + queryJobURLIds + `)`
+
+	rows, err := j.client.db.Query(queryJobFreshness, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	now := time.Now().UTC()
+	report := make(common.FreshnessReport)
+	for rows.Next() {
+		var (
+			u           sql.NullString
+			publishedOn pq.NullTime
+			modifiedOn  pq.NullTime
+		)
+		if err := rows.Scan(&u, &publishedOn, &modifiedOn); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid job freshness for job id %d", id)
+		}
+
+		info := common.PageInfo{PublishedOn: publishedOn.Time, ModifiedOn: modifiedOn.Time}
+		report.Add(u.String, info.LastUpdated(), now)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Conditions of the job's crawled HTML pages with a visible word count less
+// than the threshold, $2.
+const queryJobThinContentWhere = `
+WHERE url.crawled_on IS NOT NULL AND url.mime = 'text/html' AND url.word_count < $2
+AND url.id IN (` + queryJobURLIds + `)`
+
+// Generates the thin content report of a job's crawled HTML pages. Pages
+// with a visible word count less than the threshold are included in the report.
+func (j *JobClient) ThinContent(id common.JobId, threshold int) (*common.ThinContentReport, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryJobThinContent = `
+SELECT url.url, url.word_count
+FROM url` + queryJobThinContentWhere + `
+ORDER BY url.word_count, url.url`
+
+	rows, err := j.client.db.Query(queryJobThinContent, id, threshold)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &common.ThinContentReport{Threshold: threshold, Pages: []common.ThinPage{}}
+	for rows.Next() {
+		var u sql.NullString
+		var words sql.NullInt64
+		if err := rows.Scan(&u, &words); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid job thin content for job id %d", id)
+		}
+
+		report.Pages = append(report.Pages, common.ThinPage{URL: u.String, Words: int(words.Int64)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Returns the number of the job's crawled HTML pages in its thin content report,
+// without generating the report.
+func (j *JobClient) ThinContentCount(id common.JobId, threshold int) (int, error) {
+	const queryJobThinContentCount = `SELECT COUNT(*) FROM url` + queryJobThinContentWhere
+
+	var count sql.NullInt64
+	if err := j.client.db.QueryRow(queryJobThinContentCount, id, threshold).Scan(&count); err != nil {
+		return 0, err
+	}
+	return int(count.Int64), nil
+}
+
+// Generates the heading report of a job's crawled HTML pages. The report
+// contains pages with duplicate titles and h1 headings, and pages missing
+// titles or descriptions.
+func (j *JobClient) Headings(id common.JobId) (*common.HeadingReport, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryJobHeadings = `
+SELECT url.url, url.title, url.description, url.h1
+FROM url
+WHERE url.crawled_on IS NOT NULL AND url.mime = 'text/html'
+AND url.id IN (` + queryJobURLIds + `)`
+
+	rows, err := j.client.db.Query(queryJobHeadings, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := make(map[string]common.PageInfo)
+	for rows.Next() {
+		var u, title, description, h1 sql.NullString
+		if err := rows.Scan(&u, &title, &description, &h1); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid job headings for job id %d", id)
+		}
+
+		pages[u.String] = common.PageInfo{Title: title.String, Description: description.String, H1: h1.String}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return common.NewHeadingReport(pages), nil
+}
+
+// Returns all Job URLs and their crawled results for a job, mapped to the
+// URL's mime type. Nil is returned if the job does not exist.
+func (j *JobClient) LinkedURLs(id common.JobId) (map[string]string, error) {
+	if exists, err := j.JobExists(id); err != nil || !exists {
+		return nil, err
+	}
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryJobLinkedURLs = `
+SELECT url.url, url.mime
+FROM url
+WHERE url.id IN (` + queryJobURLIds + `)`
+
+	rows, err := j.client.db.Query(queryJobLinkedURLs, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := make(map[string]string)
+	for rows.Next() {
+		var u, mime sql.NullString
+		if err := rows.Scan(&u, &mime); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid job linked URL for job id %d", id)
+		}
+		urls[u.String] = mime.String
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+// Returns if all of the job's URLs have been completely crawled.
+func (j *JobClient) IsComplete(id common.JobId) (bool, error) {
+	const queryJobIncomplete = `SELECT exists(SELECT 1 FROM job_url WHERE job_id = $1 AND completed_on IS NULL)`
+
+	var incomplete sql.NullBool
+	if err := j.client.db.QueryRow(queryJobIncomplete, id).Scan(&incomplete); err != nil {
+		return false, err
+	}
+
+	return incomplete.Valid && !incomplete.Bool, nil
+}
+
+// Computes the internal link authority score of each of the job's URLs, and
+// stores them replacing any previously computed scores. Only links between URLs
+// of the job which share the same host are considered internal links.
+func (j *JobClient) ScoreLinks(id common.JobId, algorithm string) error {
+	const queryJobURLHosts = `SELECT url.id, url.url FROM url WHERE url.id IN (` + queryJobURLIds + `)`
+	const queryJobLinks = `
+SELECT url_link.refer_id, url_link.url_id
+FROM url_link
+WHERE url_link.refer_id IN (` + queryJobURLIds + `) AND url_link.url_id IN (` + queryJobURLIds + `)`
+
+	hosts := make(map[common.URLId]string)
+	rows, err := j.client.db.Query(queryJobURLHosts, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	graph := common.NewLinkGraph()
+	for rows.Next() {
+		var urlId sql.NullInt64
+		var u sql.NullString
+		if err := rows.Scan(&urlId, &u); err != nil {
+			return err
+		}
+		if parsed, err := url.Parse(u.String); err == nil {
+			hosts[common.URLId(urlId.Int64)] = parsed.Host
+		}
+		graph.AddNode(common.URLId(urlId.Int64))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	linkRows, err := j.client.db.Query(queryJobLinks, id)
+	if err != nil {
+		return err
+	}
+	defer linkRows.Close()
+
+	for linkRows.Next() {
+		var referId, urlId sql.NullInt64
+		if err := linkRows.Scan(&referId, &urlId); err != nil {
+			return err
+		}
+		refer, u := common.URLId(referId.Int64), common.URLId(urlId.Int64)
+		if hosts[refer] != hosts[u] {
+			// External link, not part of the internal link graph
+			continue
+		}
+		graph.AddLink(refer, u)
+	}
+	if err := linkRows.Err(); err != nil {
+		return err
+	}
+
+	scores, err := graph.Score(algorithm)
+	if err != nil {
+		return err
+	}
+
+	return j.replaceLinkScores(id, algorithm, scores)
+}
+
+// Replaces the job's link scores with the scores provided.
+func (j *JobClient) replaceLinkScores(id common.JobId, algorithm string, scores map[common.URLId]float64) error {
+	const queryDeleteLinkScores = `DELETE FROM job_link_score WHERE job_id = $1`
+	const queryInsertLinkScore = `INSERT INTO job_link_score (job_id, url_id, score, algorithm) VALUES ($1, $2, $3, $4)`
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(queryDeleteLinkScores, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for urlId, score := range scores {
+		if _, err := tx.Exec(queryInsertLinkScore, id, urlId, score, algorithm); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Returns the job's link scores mapped by URL. The map will be empty if
+// the job hasn't completed, and its links have not been scored yet.
+func (j *JobClient) LinkScores(id common.JobId) (map[string]float64, error) {
+	const queryJobLinkScores = `
+SELECT url.url, job_link_score.score
+FROM job_link_score
+LEFT JOIN url on job_link_score.url_id = url.id
+WHERE job_link_score.job_id = $1`
+
+	rows, err := j.client.db.Query(queryJobLinkScores, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := make(map[string]float64)
+	for rows.Next() {
+		var u sql.NullString
+		var score sql.NullFloat64
+		if err := rows.Scan(&u, &score); err != nil {
+			return nil, err
+		}
+		if !u.Valid || !score.Valid {
+			return nil, fmt.Errorf("Invalid job link score for job id %d", id)
+		}
+		scores[u.String] = score.Float64
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return scores, nil
+}
+
+// Returns the job's Job URLs and their crawled results, filtered by the filter.
+func (j *JobClient) URLs(id common.JobId, filter URLFilter) ([]*URL, error) {
+	const queryJobURLs = `
+SELECT ` + urlColumns + `
+FROM url
+WHERE url.id IN (` + queryJobURLIds + `)`
+
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	cond, args := filter.where([]interface{}{id})
+	return j.client.URLClient().queryURLs(queryJobURLs+cond+` ORDER BY url.id`, args...)
+}
+
+// Returns a page of the job's URLs, and all URLs found while crawling them,
+// filtered by the filter, the same as URLClient.GetLinkedURLs.
+func (j *JobClient) URLPage(id common.JobId, filter URLFilter, after *common.URLCursor, limit int) ([]*URL, *common.URLCursor, error) {
+	const queryJobURLs = `
+SELECT ` + urlColumns + `
+FROM url
+WHERE url.id IN (` + queryJobURLIds + `)`
+
+	if err := j.mustExist(id); err != nil {
+		return nil, nil, err
+	}
+
+	cond, args := filter.where([]interface{}{id})
+	return j.client.URLClient().queryURLPage(queryJobURLs+cond, args, after, limit)
+}
+
+// Returns the job's Job URLs and crawled results matching the URL query expression,
+// up to the limit. Job URLs have a depth of zero, and results found before depths
+// were recorded have an unknown depth.
+func (j *JobClient) Query(id common.JobId, expr common.URLQueryExpr, limit int) (*common.URLQueryResult, error) {
+	const queryJobURLDepths = `
+SELECT ` + urlColumns + `, job_depth.depth,
+	(SELECT string_agg(url_tag.tag, ',' ORDER BY url_tag.tag) FROM url_tag WHERE url_tag.url_id = url.id)
+FROM url
+JOIN (
+	SELECT url_id, MIN(depth) AS depth FROM (
+		SELECT url_id, 0 AS depth FROM job_url WHERE job_id = $1
+		UNION ALL
+		SELECT url_id, level AS depth FROM job_result WHERE job_id = $1
+	) AS d GROUP BY url_id
+) AS job_depth ON job_depth.url_id = url.id
+WHERE `
+
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	cond, args, err := urlQueryWhere(expr, []interface{}{id})
+	if err != nil {
+		return nil, err
+	}
+	// Request one more than the limit to know if the result was truncated.
+	args = append(args, limit+1)
+	query := fmt.Sprintf("%s%s ORDER BY url.id LIMIT $%d", queryJobURLDepths, cond, len(args))
+
+	rows, err := j.client.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := &common.URLQueryResult{URLs: []common.URLMatch{}}
+	for rows.Next() {
+		var depth sql.NullInt64
+		var tags sql.NullString
+		u, err := scanURL(func(dest ...interface{}) error {
+			return rows.Scan(append(dest, &depth, &tags)...)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(result.URLs) == limit {
+			result.Truncated = true
+			break
+		}
+
+		match := common.URLMatch{
+			URL:    u.URL,
+			Mime:   u.Mime,
+			Status: u.Status,
+			Words:  u.Info.WordCount,
+			Title:  u.Info.Title,
+			Tags:   []string{},
+		}
+		if depth.Valid {
+			d := int(depth.Int64)
+			match.Depth = &d
+		}
+		if tags.Valid && tags.String != "" {
+			match.Tags = strings.Split(tags.String, ",")
+		}
+		result.URLs = append(result.URLs, match)
+	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
 	return result, nil
 }
+
+// Retention of the results of the jobs tagged with the tag, and scheduled
+// with the API key, e.g: of a tenant whose results must be kept longer.
+type ResultRetention struct {
+	// Tag the jobs are tagged with, any if empty.
+	Tag string
+
+	// API key the jobs were scheduled with, any if zero.
+	APIKeyId int64
+
+	// Time the jobs' Job URLs must all have completed before for their
+	// results to be archived.
+	CompletedBefore time.Time
+}
+
+// Returns the SQL expression of the time each job's Job URLs must have all
+// completed before for it to be archived, and its args. The time is that of
+// the first rule the job matches, or the default if none. NULL, a zero
+// default, is never before.
+func resultRetentionCutoff(completedBefore time.Time, rules []ResultRetention) (string, []interface{}) {
+	args := []interface{}{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	cutoff := "CASE"
+	for _, r := range rules {
+		conds := []string{}
+		if r.Tag != "" {
+			conds = append(conds, "EXISTS (SELECT 1 FROM job_tag WHERE job_tag.job_id = job.id AND job_tag.tag = "+arg(r.Tag)+")")
+		}
+		if r.APIKeyId != 0 {
+			conds = append(conds, "job.api_key_id = "+arg(r.APIKeyId))
+		}
+		if len(conds) == 0 {
+			conds = append(conds, "TRUE")
+		}
+		cutoff += " WHEN " + strings.Join(conds, " AND ") + " THEN " + arg(r.CompletedBefore)
+	}
+	def := pq.NullTime{Time: completedBefore, Valid: !completedBefore.IsZero()}
+	cutoff += " ELSE " + arg(def) + "::TIMESTAMP WITH TIME ZONE END"
+	return cutoff, args
+}
+
+// Archives completed jobs, whose Job URLs all completed before the time, by
+// tiering their stored HTML, and cached fetch bodies into the cold store. The
+// job's metadata, results, and reports are kept in the database, and the
+// tiered bodies are read back from the cold store when requested. Returns
+// the ids of the archived jobs. ErrNoColdStore is returned if no cold store
+// is configured.
+//
+// Jobs matching one of the retention rules are archived by the first rule they
+// match instead. Jobs matching none aren't archived if the time is zero.
+func (j *JobClient) ArchiveResults(completedBefore time.Time, rules []ResultRetention) ([]common.JobId, error) {
+	if j.client.cold == nil {
+		return nil, ErrNoColdStore
+	}
+
+	const queryArchivableJobs = `
+SELECT job.id
+FROM job
+JOIN job_url ON job_url.job_id = job.id
+WHERE job.archived_on IS NULL
+GROUP BY job.id
+HAVING bool_and(job_url.completed_on IS NOT NULL) AND MAX(job_url.completed_on) < `
+
+	cutoff, args := resultRetentionCutoff(completedBefore, rules)
+	rows, err := j.client.db.Query(queryArchivableJobs+"("+cutoff+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []common.JobId{}
+	for rows.Next() {
+		var id sql.NullInt64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		if id.Valid {
+			ids = append(ids, common.JobId(id.Int64))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	archived := make([]common.JobId, 0, len(ids))
+	for _, id := range ids {
+		if err := j.tierBodies(id); err != nil {
+			return archived, err
+		}
+		marked, err := j.setArchivedOn(id, time.Now().UTC())
+		if err != nil {
+			return archived, err
+		}
+		if marked {
+			archived = append(archived, id)
+		}
+	}
+
+	return archived, nil
+}
+
+// Restores the archived job's bodies from the cold store into the database.
+// Returns false if the job was not archived.
+func (j *JobClient) RestoreResults(id common.JobId) (bool, error) {
+	const queryJobArchived = `SELECT archived_on IS NOT NULL FROM job WHERE id = $1`
+
+	var archived bool
+	if err := j.client.db.QueryRow(queryJobArchived, id).Scan(&archived); err == sql.ErrNoRows {
+		return false, fmt.Errorf("Job does not exist")
+	} else if err != nil {
+		return false, err
+	}
+	if !archived {
+		return false, nil
+	}
+
+	if err := j.untierBodies(id); err != nil {
+		return false, err
+	}
+	return j.setArchivedOn(id, time.Time{})
+}
+
+// Returns the crawl history of the host, summarized per job, with the most
+// recent crawl first up to the limit. The host is compared case insensitively.
+func (j *JobClient) HostHistory(host string, limit int) (*common.HostHistory, error) {
+	const queryHostHistory = `
+SELECT job_id, MIN(crawled_on), MAX(crawled_on), COUNT(DISTINCT url_id), COUNT(*),
+	SUM(CASE WHEN status IS NULL OR status >= 400 THEN 1 ELSE 0 END),
+	SUM(bytes), AVG(duration_ms)
+FROM crawl_log
+WHERE host = $1
+GROUP BY job_id
+ORDER BY MAX(crawled_on) DESC
+LIMIT $2`
+
+	host = strings.ToLower(host)
+	rows, err := j.client.db.Query(queryHostHistory, host, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := &common.HostHistory{Host: host, Crawls: []common.HostCrawl{}}
+	for rows.Next() {
+		var (
+			jobId                    sql.NullInt64
+			started, finished        pq.NullTime
+			urls, requests, errCount sql.NullInt64
+			bytes                    sql.NullInt64
+			avgMs                    sql.NullFloat64
+		)
+		if err := rows.Scan(&jobId, &started, &finished, &urls, &requests, &errCount, &bytes, &avgMs); err != nil {
+			return nil, err
+		}
+		if !jobId.Valid {
+			return nil, fmt.Errorf("Invalid host history result for %s", host)
+		}
+
+		crawl := common.HostCrawl{
+			JobId:        common.JobId(jobId.Int64),
+			Started:      started.Time,
+			Finished:     finished.Time,
+			URLs:         int(urls.Int64),
+			Requests:     int(requests.Int64),
+			Errors:       int(errCount.Int64),
+			Bytes:        bytes.Int64,
+			AvgRequestMs: int64(avgMs.Float64),
+		}
+		if crawl.Requests > 0 {
+			crawl.ErrorRate = float64(crawl.Errors) / float64(crawl.Requests)
+		}
+		history.Crawls = append(history.Crawls, crawl)
+
+		if history.LastCrawled == nil || history.LastCrawled.Before(crawl.Finished) {
+			finished := crawl.Finished
+			history.LastCrawled = &finished
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
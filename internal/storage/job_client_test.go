@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestResultRetentionCutoff(t *testing.T) {
+	def := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	tagged := def.Add(-time.Hour)
+	keyed := def.Add(time.Hour)
+	const tagCond = "EXISTS (SELECT 1 FROM job_tag WHERE job_tag.job_id = job.id AND job_tag.tag = "
+	cases := []struct {
+		Default time.Time
+		Rules   []ResultRetention
+		Cutoff  string
+		Args    []interface{}
+	}{
+		{
+			// Jobs matching no rule are archived by the default.
+			Default: def,
+			Cutoff:  "CASE ELSE $1::TIMESTAMP WITH TIME ZONE END",
+			Args:    []interface{}{pq.NullTime{Time: def, Valid: true}},
+		},
+		{
+			// A zero default is NULL, so jobs matching no rule aren't archived.
+			Rules:  []ResultRetention{{Tag: "a", CompletedBefore: tagged}},
+			Cutoff: "CASE WHEN " + tagCond + "$1) THEN $2 ELSE $3::TIMESTAMP WITH TIME ZONE END",
+			Args:   []interface{}{"a", tagged, pq.NullTime{}},
+		},
+		{
+			// Rules are matched in order, the first rule a job matches wins.
+			Default: def,
+			Rules: []ResultRetention{
+				{Tag: "a", APIKeyId: 7, CompletedBefore: tagged},
+				{APIKeyId: 7, CompletedBefore: keyed},
+				{Tag: "b", CompletedBefore: tagged},
+			},
+			Cutoff: "CASE WHEN " + tagCond + "$1) AND job.api_key_id = $2 THEN $3" +
+				" WHEN job.api_key_id = $4 THEN $5" +
+				" WHEN " + tagCond + "$6) THEN $7" +
+				" ELSE $8::TIMESTAMP WITH TIME ZONE END",
+			Args: []interface{}{"a", int64(7), tagged, int64(7), keyed, "b", tagged, pq.NullTime{Time: def, Valid: true}},
+		},
+		{
+			// Rules without conditions match every job.
+			Default: def,
+			Rules:   []ResultRetention{{CompletedBefore: keyed}, {Tag: "a", CompletedBefore: tagged}},
+			Cutoff:  "CASE WHEN TRUE THEN $1 WHEN " + tagCond + "$2) THEN $3 ELSE $4::TIMESTAMP WITH TIME ZONE END",
+			Args:    []interface{}{keyed, "a", tagged, pq.NullTime{Time: def, Valid: true}},
+		},
+	}
+
+	for i, c := range cases {
+		cutoff, args := resultRetentionCutoff(c.Default, c.Rules)
+		assert.Equal(t, c.Cutoff, cutoff, "case %d, Expect cutoff SQL", i)
+		assert.Equal(t, c.Args, args, "case %d, Expect args", i)
+	}
+}
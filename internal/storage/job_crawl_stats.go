@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Returns the crawl statistics of the job's requests made since the time.
+// Errors are requests which failed, or responded with a 4xx or 5xx status.
+// Nil is returned if the job does not exist.
+func (j *JobClient) CrawlStats(id common.JobId, since time.Time) (*common.JobCrawlStats, error) {
+	const queryCrawlStats = `
+SELECT job.created_on, job.started_on,
+	(SELECT MAX(crawled_on) FROM crawl_log WHERE crawl_log.job_id = job.id),
+	COUNT(crawl_log.job_id),
+	SUM(CASE WHEN crawl_log.job_id IS NOT NULL AND (crawl_log.status IS NULL OR crawl_log.status >= 400) THEN 1 ELSE 0 END),
+	SUM(CASE WHEN crawl_log.status = 404 THEN 1 ELSE 0 END)
+FROM job
+LEFT JOIN crawl_log ON crawl_log.job_id = job.id AND crawl_log.crawled_on >= $2
+WHERE job.id = $1
+GROUP BY job.id`
+
+	var (
+		createdOn, startedOn       pq.NullTime
+		lastCrawled                pq.NullTime
+		requests, errors, notFound sql.NullInt64
+	)
+	err := j.client.db.QueryRow(queryCrawlStats, id, since).Scan(&createdOn, &startedOn, &lastCrawled, &requests, &errors, &notFound)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &common.JobCrawlStats{
+		JobId:       id,
+		CreatedOn:   createdOn.Time,
+		StartedOn:   startedOn.Time,
+		LastCrawled: lastCrawled.Time,
+		Requests:    int(requests.Int64),
+		Errors:      int(errors.Int64),
+		NotFound:    int(notFound.Int64),
+	}, nil
+}
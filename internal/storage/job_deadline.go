@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Sets the deadline of the job, after which its URLs are no longer dispatched.
+func (j *JobClient) SetDeadline(id common.JobId, deadline time.Time) error {
+	const querySetDeadline = `UPDATE job SET deadline = $2 WHERE id = $1`
+
+	if _, err := j.client.db.Exec(querySetDeadline, id, deadline); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the deadline of the job. Zero is returned if the job has no
+// deadline, or does not exist.
+func (j *JobClient) Deadline(id common.JobId) (time.Time, error) {
+	const queryDeadline = `SELECT deadline FROM job WHERE id = $1`
+
+	var deadline pq.NullTime
+	if err := j.client.db.QueryRow(queryDeadline, id).Scan(&deadline); err != nil && err != sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	return deadline.Time, nil
+}
+
+// Returns the ids of jobs whose deadline has passed at the time, but which
+// still have incomplete Job URLs. Cancelled jobs are not included.
+func (j *JobClient) OverdueJobs(now time.Time) ([]common.JobId, error) {
+	const queryOverdueJobs = `
+SELECT job.id FROM job
+WHERE job.deadline <= $1 AND job.cancelled_on IS NULL
+	AND EXISTS (SELECT 1 FROM job_url WHERE job_url.job_id = job.id AND job_url.completed_on IS NULL)
+ORDER BY job.id`
+
+	return j.jobIds(queryOverdueJobs, now)
+}
+
+// Finalizes the job whose deadline has passed with its partial results. The
+// job's frontier of pending URLs is drained into its unattempted URLs, and its
+// Job URLs which have not completed are marked complete. URLs added to the
+// frontier after the job expired are drained by expiring it again. True is
+// returned if the job was expired for the first time.
+func (j *JobClient) Expire(id common.JobId) (bool, error) {
+	const queryExpireJob = `UPDATE job SET expired_on = $2 WHERE id = $1 AND expired_on IS NULL`
+	const queryAddUnattempted = `
+INSERT INTO job_unattempted (job_id, url_id, refer_id, level)
+	SELECT job_id, url_id, MIN(refer_id), MIN(level) FROM url_pending
+	WHERE job_id = $1 AND NOT EXISTS (
+		SELECT 1 FROM job_unattempted WHERE job_unattempted.job_id = $1 AND job_unattempted.url_id = url_pending.url_id)
+	GROUP BY job_id, url_id`
+	const queryDeletePending = `DELETE FROM url_pending WHERE job_id = $1`
+	const queryCompleteJobURLs = `UPDATE job_url SET completed_on = $2 WHERE job_id = $1 AND completed_on IS NULL`
+
+	now := time.Now().UTC()
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.Exec(queryExpireJob, id, now)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if _, err := tx.Exec(queryAddUnattempted, id); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if _, err := tx.Exec(queryDeletePending, id); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if _, err := tx.Exec(queryCompleteJobURLs, id, now); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Returns the job's deadline, when it expired, and the number of URLs it never
+// attempted. Nil is returned if the job has no deadline, or does not exist.
+func (j *JobClient) DeadlineStatus(id common.JobId) (*common.JobDeadline, error) {
+	const queryDeadlineStatus = `
+SELECT deadline, expired_on, (SELECT COUNT(*) FROM job_unattempted WHERE job_unattempted.job_id = job.id)
+FROM job WHERE id = $1`
+
+	var (
+		deadline, expiredOn pq.NullTime
+		unattempted         int
+	)
+	err := j.client.db.QueryRow(queryDeadlineStatus, id).Scan(&deadline, &expiredOn, &unattempted)
+	if err == sql.ErrNoRows || (err == nil && !deadline.Valid) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	status := &common.JobDeadline{Deadline: deadline.Time, Unattempted: unattempted}
+	if expiredOn.Valid {
+		status.ExpiredOn = &expiredOn.Time
+	}
+	return status, nil
+}
+
+// Generates the report of the URLs the job never attempted because its
+// deadline passed. The report is empty if the job does not exist, or hasn't
+// expired.
+func (j *JobClient) Unattempted(id common.JobId) (*common.UnattemptedReport, error) {
+	const queryUnattempted = `
+SELECT url.url, refer.url, u.level
+FROM job_unattempted AS u
+JOIN url ON url.id = u.url_id
+LEFT JOIN url AS refer ON refer.id = u.refer_id
+WHERE u.job_id = $1
+ORDER BY u.level, url.url`
+
+	rows, err := j.client.db.Query(queryUnattempted, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &common.UnattemptedReport{URLs: []common.UnattemptedURL{}}
+	for rows.Next() {
+		var (
+			u, refer sql.NullString
+			level    sql.NullInt64
+		)
+		if err := rows.Scan(&u, &refer, &level); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid unattempted URL for job id %d", id)
+		}
+
+		report.URLs = append(report.URLs, common.UnattemptedURL{
+			URL:   u.String,
+			Refer: refer.String,
+			Level: int(level.Int64),
+		})
+	}
+	return report, rows.Err()
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Columns of a job download joined with its URL, in the order read by
+// scanJobDownload.
+const jobDownloadColumns = `job_download.job_id, job_download.url_id, url.url, job_download.file, job_download.bytes,
+	job_download.sha256, job_download.expected_sha256, job_download.mime, job_download.resumed,
+	job_download.error, job_download.downloaded_on`
+
+// Sets the checksums the download job's files are verified against, keyed by
+// the URL of the file.
+func (j *JobClient) SetExpectedChecksums(id common.JobId, checksums map[common.URLId]string) error {
+	const queryAddExpected = `INSERT INTO job_download (job_id, url_id, expected_sha256) VALUES ($1, $2, $3)`
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	for urlId, sum := range checksums {
+		if _, err := tx.Exec(queryAddExpected, id, urlId, sum); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Returns the download of the job's URL, nil if the URL has no checksum to be
+// verified against, and hasn't been downloaded.
+func (j *JobClient) Download(id common.JobId, urlId common.URLId) (*common.JobDownload, error) {
+	query := `SELECT ` + jobDownloadColumns + `
+FROM job_download
+JOIN url ON url.id = job_download.url_id
+WHERE job_download.job_id = $1 AND job_download.url_id = $2`
+
+	d, err := scanJobDownload(j.client.db.QueryRow(query, id, urlId).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Stores the download of the job's URL, replacing the previous download of the
+// URL. The checksum the URL was scheduled with is kept.
+func (j *JobClient) StoreDownload(d common.JobDownload) error {
+	const queryUpdateDownload = `
+UPDATE job_download SET file = $3, bytes = $4, sha256 = $5, mime = $6, resumed = $7, error = $8, downloaded_on = $9
+WHERE job_id = $1 AND url_id = $2`
+	const queryAddDownload = `
+INSERT INTO job_download (job_id, url_id, file, bytes, sha256, mime, resumed, error, downloaded_on)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	args := []interface{}{d.JobId, d.URLId,
+		sql.NullString{String: d.File, Valid: d.File != ""},
+		d.Bytes,
+		sql.NullString{String: d.SHA256, Valid: d.SHA256 != ""},
+		sql.NullString{String: d.Mime, Valid: d.Mime != ""},
+		d.Resumed,
+		sql.NullString{String: d.Error, Valid: d.Error != ""},
+		pq.NullTime{Time: d.DownloadedOn, Valid: !d.DownloadedOn.IsZero()},
+	}
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	res, err := tx.Exec(queryUpdateDownload, args...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		tx.Rollback()
+		return err
+	} else if n == 0 {
+		if _, err := tx.Exec(queryAddDownload, args...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Returns the downloads of each of the job's URLs, ordered by URL. URLs which
+// haven't been downloaded yet are included as pending.
+func (j *JobClient) Downloads(id common.JobId) ([]common.JobDownload, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	// Selects the jobDownloadColumns of each of the job's URLs.
+	const queryDownloads = `
+SELECT $1::INT, url.id, url.url, job_download.file, COALESCE(job_download.bytes, 0),
+	job_download.sha256, job_download.expected_sha256, job_download.mime, COALESCE(job_download.resumed, false),
+	job_download.error, job_download.downloaded_on
+FROM job_url
+JOIN url ON url.id = job_url.url_id
+LEFT JOIN job_download ON job_download.job_id = job_url.job_id AND job_download.url_id = job_url.url_id
+WHERE job_url.job_id = $1
+ORDER BY url.url`
+
+	rows, err := j.client.db.Query(queryDownloads, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	downloads := []common.JobDownload{}
+	for rows.Next() {
+		d, err := scanJobDownload(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		downloads = append(downloads, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return downloads, nil
+}
+
+// Scans the jobDownloadColumns into a job download with the scan function provided.
+func scanJobDownload(scan func(dest ...interface{}) error) (*common.JobDownload, error) {
+	var (
+		jobId, urlId, bytes                     sql.NullInt64
+		u, file, sum, expected, mime, errString sql.NullString
+		resumed                                 sql.NullBool
+		downloadedOn                            pq.NullTime
+	)
+	if err := scan(&jobId, &urlId, &u, &file, &bytes, &sum, &expected, &mime, &resumed, &errString, &downloadedOn); err != nil {
+		return nil, err
+	}
+	if !jobId.Valid || !urlId.Valid || !u.Valid {
+		return nil, fmt.Errorf("Invalid job download")
+	}
+
+	return &common.JobDownload{
+		JobId:          common.JobId(jobId.Int64),
+		URLId:          common.URLId(urlId.Int64),
+		URL:            u.String,
+		File:           file.String,
+		Bytes:          bytes.Int64,
+		SHA256:         sum.String,
+		ExpectedSHA256: expected.String,
+		Mime:           mime.String,
+		Resumed:        resumed.Bool,
+		Error:          errString.String,
+		DownloadedOn:   downloadedOn.Time,
+	}, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Returns the job's requests logged after the crawl log id, in the order they
+// were logged, up to the limit.
+func (j *JobClient) CrawlEventsSince(id common.JobId, afterId int64, limit int) ([]common.JobCrawlEvent, error) {
+	const queryCrawlEvents = `
+SELECT crawl_log.id, url.url, crawl_log.crawled_on, crawl_log.status, crawl_log.bytes, crawl_log.duration_ms
+FROM crawl_log
+JOIN url ON url.id = crawl_log.url_id
+WHERE crawl_log.job_id = $1 AND crawl_log.id > $2
+ORDER BY crawl_log.id
+LIMIT $3`
+
+	rows, err := j.client.db.Query(queryCrawlEvents, id, afterId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []common.JobCrawlEvent{}
+	for rows.Next() {
+		var (
+			logId, status, bytes, duration sql.NullInt64
+			u                              sql.NullString
+			crawledOn                      pq.NullTime
+		)
+		if err := rows.Scan(&logId, &u, &crawledOn, &status, &bytes, &duration); err != nil {
+			return nil, err
+		}
+		if !logId.Valid || !u.Valid {
+			return nil, fmt.Errorf("Invalid crawl log entry for job id %d", id)
+		}
+
+		events = append(events, common.JobCrawlEvent{
+			Id:         logId.Int64,
+			URL:        u.String,
+			CrawledOn:  crawledOn.Time,
+			Status:     int(status.Int64),
+			Bytes:      bytes.Int64,
+			DurationMs: duration.Int64,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Returns the crawl log id of the job's most recently logged request. Zero if
+// the job has not made any requests.
+func (j *JobClient) LastCrawlEventId(id common.JobId) (int64, error) {
+	const queryLastCrawlEvent = `SELECT MAX(id) FROM crawl_log WHERE job_id = $1`
+
+	var last sql.NullInt64
+	if err := j.client.db.QueryRow(queryLastCrawlEvent, id).Scan(&last); err != nil {
+		return 0, err
+	}
+	return last.Int64, nil
+}
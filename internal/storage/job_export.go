@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Exports the job's URLs crawled since the job was previously exported to the
+// destination, and advances the destination's watermark to the latest URL
+// exported. If full is set all of the job's crawled URLs are exported, and the
+// watermark is reset to them. URLs re-crawled by monitoring jobs are exported
+// again, because their crawl moves past the watermark. The destination's
+// watermark is locked while exporting, so concurrent exports to the same
+// destination do not export the same URLs.
+func (j *JobClient) ExportSince(id common.JobId, destination string, full bool) (*common.JobExport, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryWatermark = `SELECT exported_until FROM job_export WHERE job_id = $1 AND destination = $2 FOR UPDATE`
+	const queryUpdateWatermark = `UPDATE job_export SET exported_until = $3, exported_on = $4 WHERE job_id = $1 AND destination = $2`
+	const queryAddWatermark = `INSERT INTO job_export (job_id, destination, exported_until, exported_on) VALUES ($1, $2, $3, $4)`
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	export := &common.JobExport{JobId: id, Destination: destination}
+	var watermark pq.NullTime
+	if err := tx.QueryRow(queryWatermark, id, destination).Scan(&watermark); err != nil && err != sql.ErrNoRows {
+		tx.Rollback()
+		return nil, err
+	}
+	if watermark.Valid && !full {
+		since := watermark.Time
+		export.Since = &since
+	}
+
+	if export.URLs, err = queryExportURLs(tx, id, export.Since); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	export.Until = common.NextExportWatermark(export.Since, export.URLs)
+	if export.Until == nil {
+		// Nothing has been crawled, so there is no watermark to record.
+		tx.Rollback()
+		return export, nil
+	}
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(queryUpdateWatermark, id, destination, *export.Until, now)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		tx.Rollback()
+		return nil, err
+	} else if n == 0 {
+		if _, err := tx.Exec(queryAddWatermark, id, destination, *export.Until, now); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// Returns the watermark of each destination the job has been exported to,
+// ordered by destination.
+func (j *JobClient) ExportWatermarks(id common.JobId) ([]common.JobExportWatermark, error) {
+	const queryWatermarks = `
+SELECT destination, exported_until, exported_on
+FROM job_export
+WHERE job_id = $1
+ORDER BY destination`
+
+	rows, err := j.client.db.Query(queryWatermarks, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	watermarks := []common.JobExportWatermark{}
+	for rows.Next() {
+		var destination sql.NullString
+		var until, on pq.NullTime
+		if err := rows.Scan(&destination, &until, &on); err != nil {
+			return nil, err
+		}
+
+		watermarks = append(watermarks, common.JobExportWatermark{
+			Destination:   destination.String,
+			ExportedUntil: until.Time,
+			ExportedOn:    on.Time,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return watermarks, nil
+}
+
+// Queries the job's URLs crawled after the time within the transaction,
+// ordered by when they were crawled. All crawled URLs are returned if the
+// time is nil.
+func queryExportURLs(tx *sql.Tx, id common.JobId, since *time.Time) ([]common.ArchivedURL, error) {
+	query := `SELECT ` + urlColumns + ` FROM url WHERE url.id IN (` + queryJobURLIds + `) AND url.crawled_on IS NOT NULL`
+	args := []interface{}{id}
+	if since != nil {
+		query += ` AND url.crawled_on > $2`
+		args = append(args, *since)
+	}
+	query += ` ORDER BY url.crawled_on, url.id`
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []common.ArchivedURL{}
+	for rows.Next() {
+		u, err := getURLFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, archivedURL(u))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
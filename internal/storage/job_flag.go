@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Sets the flags the job's crawled pages are matched against, replacing any
+// previously set.
+func (j *JobClient) SetFlags(id common.JobId, flags []common.JobFlag) error {
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := setFlags(tx, id, flags); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replaces the job's flags within the transaction.
+func setFlags(tx *sql.Tx, id common.JobId, flags []common.JobFlag) error {
+	const queryDeleteFlags = `DELETE FROM job_flag WHERE job_id = $1`
+	const queryInsertFlag = `INSERT INTO job_flag (job_id, name, pattern) VALUES ($1, $2, $3)`
+
+	if _, err := tx.Exec(queryDeleteFlags, id); err != nil {
+		return err
+	}
+	for _, flag := range flags {
+		if _, err := tx.Exec(queryInsertFlag, id, flag.Name, flag.Pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the flags the job's crawled pages are matched against, ordered by
+// name. Nil is returned if the job has none.
+func (j *JobClient) Flags(id common.JobId) ([]common.JobFlag, error) {
+	const queryFlags = `SELECT name, pattern FROM job_flag WHERE job_id = $1 ORDER BY name, pattern`
+
+	rows, err := j.client.db.Query(queryFlags, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var flags []common.JobFlag
+	for rows.Next() {
+		var name, pattern sql.NullString
+		if err := rows.Scan(&name, &pattern); err != nil {
+			return nil, err
+		}
+		if !name.Valid || !pattern.Valid {
+			return nil, fmt.Errorf("Invalid flag for job id %d", id)
+		}
+
+		flags = append(flags, common.JobFlag{Name: name.String, Pattern: pattern.String})
+	}
+	return flags, rows.Err()
+}
+
+// Stores the names of the flags the job's crawled page matched, replacing the
+// flags the page previously matched.
+func (j *JobClient) StoreFlagged(id common.JobId, urlId common.URLId, names []string) error {
+	const queryDeleteFlagged = `DELETE FROM job_url_flag WHERE job_id = $1 AND url_id = $2`
+	const queryInsertFlagged = `INSERT INTO job_url_flag (job_id, url_id, name) VALUES ($1, $2, $3)`
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(queryDeleteFlagged, id, urlId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, name := range names {
+		if _, err := tx.Exec(queryInsertFlagged, id, urlId, name); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Returns the URLs of the job's crawled pages which matched its flags, keyed
+// by flag name. URLs are sorted.
+func (j *JobClient) Flagged(id common.JobId) (map[string][]string, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryFlagged = `
+SELECT job_url_flag.name, url.url
+FROM job_url_flag
+JOIN url ON url.id = job_url_flag.url_id
+WHERE job_url_flag.job_id = $1
+ORDER BY job_url_flag.name, url.url`
+
+	rows, err := j.client.db.Query(queryFlagged, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flagged := map[string][]string{}
+	for rows.Next() {
+		var name, u sql.NullString
+		if err := rows.Scan(&name, &u); err != nil {
+			return nil, err
+		}
+		if !name.Valid || !u.Valid {
+			return nil, fmt.Errorf("Invalid flagged URL for job id %d", id)
+		}
+
+		flagged[name.String] = append(flagged[name.String], u.String)
+	}
+	return flagged, rows.Err()
+}
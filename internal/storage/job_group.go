@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Columns of the job_group table selected when querying groups.
+const jobGroupColumns = `id,name,webhook,created_on,scheduled_on,completed_on`
+
+// Creates a new job group. The webhook is optional, and notified once all
+// of the group's jobs complete. The group's completion is not checked until
+// its jobs are scheduled, see GroupScheduled.
+func (j *JobClient) CreateGroup(name, webhook string) (*common.JobGroup, error) {
+	const queryInsertGroup = `INSERT INTO job_group (name, webhook) VALUES ($1, $2) RETURNING ` + jobGroupColumns
+
+	hook := sql.NullString{String: webhook, Valid: webhook != ""}
+	return getJobGroupFromRow(j.client.db.QueryRow(queryInsertGroup, name, hook))
+}
+
+// Adds the job to the group.
+func (j *JobClient) SetJobGroup(id common.JobId, groupId common.GroupId) error {
+	const querySetJobGroup = `UPDATE job SET group_id = $2 WHERE id = $1`
+
+	if _, err := j.client.db.Exec(querySetJobGroup, id, groupId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Marks all of the group's jobs as scheduled. Only scheduled groups are
+// completed by CompleteGroups, so a group isn't completed while its jobs
+// are still being added.
+func (j *JobClient) GroupScheduled(id common.GroupId) error {
+	const queryGroupScheduled = `UPDATE job_group SET scheduled_on = NOW() WHERE id = $1 AND scheduled_on IS NULL`
+
+	if _, err := j.client.db.Exec(queryGroupScheduled, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the group by id. Nil is returned if the group does not exist.
+func (j *JobClient) Group(id common.GroupId) (*common.JobGroup, error) {
+	const queryGroup = `SELECT ` + jobGroupColumns + ` FROM job_group WHERE id = $1`
+
+	return getJobGroupFromRow(j.client.db.QueryRow(queryGroup, id))
+}
+
+// Returns the status of the group aggregated from its jobs. Nil is returned
+// if the group does not exist.
+func (j *JobClient) GroupStatus(id common.GroupId) (*common.JobGroupStatus, error) {
+	const queryGroupJobs = queryJobSummaries + `
+WHERE job.group_id = $1
+GROUP BY job.id
+ORDER BY job.id`
+
+	group, err := j.Group(id)
+	if err != nil || group == nil {
+		return nil, err
+	}
+
+	jobs, err := j.jobSummaries(queryGroupJobs, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &common.JobGroupStatus{
+		Id:        group.Id,
+		Name:      group.Name,
+		CreatedOn: group.CreatedOn,
+		Jobs:      jobs,
+	}
+	for _, job := range jobs {
+		if job.Pending == 0 {
+			status.CompletedJobs++
+		} else {
+			status.PendingJobs++
+		}
+		status.CompletedURLs += job.Completed
+		status.PendingURLs += job.Pending
+	}
+	status.Complete = !group.ScheduledOn.IsZero() && status.PendingJobs == 0
+	return status, nil
+}
+
+// Marks the scheduled groups whose jobs are all complete as completed, and
+// returns them. Each group is only returned once, even when called
+// concurrently, so its webhook is notified once.
+func (j *JobClient) CompleteGroups() ([]common.JobGroup, error) {
+	const queryCompleteGroups = `
+UPDATE job_group SET completed_on = NOW()
+WHERE completed_on IS NULL AND scheduled_on IS NOT NULL
+AND NOT EXISTS (
+	SELECT 1 FROM job
+	JOIN job_url ON job_url.job_id = job.id
+	WHERE job.group_id = job_group.id AND job_url.completed_on IS NULL)
+RETURNING ` + jobGroupColumns
+
+	rows, err := j.client.db.Query(queryCompleteGroups)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []common.JobGroup{}
+	for rows.Next() {
+		g, err := scanJobGroup(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *g)
+	}
+	return groups, rows.Err()
+}
+
+// Extracts the group from a QueryRow row. If no group is found, nil will be returned.
+func getJobGroupFromRow(row *sql.Row) (*common.JobGroup, error) {
+	g, err := scanJobGroup(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return g, err
+}
+
+// Scans the jobGroupColumns into a group with the scan function provided.
+func scanJobGroup(scan func(dest ...interface{}) error) (*common.JobGroup, error) {
+	var (
+		id                                  sql.NullInt64
+		name, webhook                       sql.NullString
+		createdOn, scheduledOn, completedOn pq.NullTime
+	)
+	if err := scan(&id, &name, &webhook, &createdOn, &scheduledOn, &completedOn); err != nil {
+		return nil, err
+	}
+
+	return &common.JobGroup{
+		Id:          common.GroupId(id.Int64),
+		Name:        name.String,
+		Webhook:     webhook.String,
+		CreatedOn:   createdOn.Time,
+		ScheduledOn: scheduledOn.Time,
+		CompletedOn: completedOn.Time,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Reserves the client's idempotency key for a job about to be scheduled, with
+// the hash of the request it was sent with, and the request's random token.
+// Keys are scoped to the principal the client's requests are authorized as,
+// empty if none. Keys reserved longer than the window ago have expired, and
+// are reserved again. Keys not completed within the lease were reserved by a
+// request which didn't finish, e.g: its web server stopped, and are reserved
+// again as well.
+//
+// If the key is reserved true is returned, and the key must be completed with
+// the scheduled job, or released if the job fails to be scheduled, with the
+// token. Otherwise the job the key was completed with, and the hash of the
+// request it was reserved with are returned. The job is InvalidId if the
+// key's job is still being scheduled.
+func (j *JobClient) ReserveIdempotencyKey(principal, key, requestHash, token string, window, lease time.Duration) (common.JobId, string, bool, error) {
+	const queryReserve = `
+INSERT INTO job_idempotency (principal, key, request_hash, token) VALUES ($1, $2, $3, $4)
+ON CONFLICT (principal, key) DO UPDATE SET request_hash = $3, token = $4, job_id = NULL, created_on = NOW()
+    WHERE job_idempotency.created_on <= NOW() - $5 * INTERVAL '1 millisecond'
+        OR (job_idempotency.job_id IS NULL AND job_idempotency.created_on <= NOW() - $6 * INTERVAL '1 millisecond')
+RETURNING key`
+	const queryGet = `SELECT job_id, request_hash FROM job_idempotency WHERE principal = $1 AND key = $2`
+
+	// A key which isn't reserved was reserved by another request, unless it
+	// was released before it could be read, and is reserved again.
+	for attempt := 0; attempt < 3; attempt++ {
+		var reserved string
+		if err := j.client.db.QueryRow(queryReserve, principal, key, requestHash, token, window/time.Millisecond, lease/time.Millisecond).Scan(&reserved); err == nil {
+			return common.InvalidId, requestHash, true, nil
+		} else if err != sql.ErrNoRows {
+			return common.InvalidId, "", false, err
+		}
+
+		var (
+			jobId sql.NullInt64
+			hash  sql.NullString
+		)
+		if err := j.client.db.QueryRow(queryGet, principal, key).Scan(&jobId, &hash); err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return common.InvalidId, "", false, err
+		}
+		if !jobId.Valid {
+			return common.InvalidId, hash.String, false, nil
+		}
+		return common.JobId(jobId.Int64), hash.String, false, nil
+	}
+	return common.InvalidId, "", false, fmt.Errorf("Failed to reserve idempotency key, key repeatedly released")
+}
+
+// Completes the idempotency key reserved with the token with the job
+// scheduled, so requests replaying the key are responded to with the job.
+// Keys reserved again by another request once their lease ended are not
+// completed.
+func (j *JobClient) CompleteIdempotencyKey(principal, key, token string, jobId common.JobId) error {
+	const queryComplete = `UPDATE job_idempotency SET job_id = $4 WHERE principal = $1 AND key = $2 AND token = $3 AND job_id IS NULL`
+
+	_, err := j.client.db.Exec(queryComplete, principal, key, token, jobId)
+	return err
+}
+
+// Releases the idempotency key reserved with the token of a job which failed
+// to be scheduled, so the request can be retried with the key. Keys reserved
+// again by another request once their lease ended are not released.
+func (j *JobClient) ReleaseIdempotencyKey(principal, key, token string) error {
+	const queryRelease = `DELETE FROM job_idempotency WHERE principal = $1 AND key = $2 AND token = $3 AND job_id IS NULL`
+
+	_, err := j.client.db.Exec(queryRelease, principal, key, token)
+	return err
+}
+
+// Removes the idempotency keys reserved longer than the window ago. Returns
+// the number of keys removed.
+func (j *JobClient) ExpireIdempotencyKeys(window time.Duration) (int64, error) {
+	const queryExpire = `DELETE FROM job_idempotency WHERE created_on <= NOW() - $1 * INTERVAL '1 millisecond'`
+
+	res, err := j.client.db.Exec(queryExpire, window/time.Millisecond)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Sets the JSONPath expressions the job applies to its crawled JSON responses,
+// replacing any previously set.
+func (j *JobClient) SetJSONPaths(id common.JobId, paths *common.JobJSONPaths) error {
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := setJSONPaths(tx, id, paths); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replaces the job's JSONPath expressions within the transaction.
+func setJSONPaths(tx *sql.Tx, id common.JobId, paths *common.JobJSONPaths) error {
+	const queryDeleteJSONPaths = `DELETE FROM job_json_path WHERE job_id = $1`
+	const queryInsertJSONPath = `INSERT INTO job_json_path (job_id, name, expr) VALUES ($1, $2, $3)`
+
+	if _, err := tx.Exec(queryDeleteJSONPaths, id); err != nil {
+		return err
+	}
+	for _, expr := range paths.Links {
+		if _, err := tx.Exec(queryInsertJSONPath, id, sql.NullString{}, expr); err != nil {
+			return err
+		}
+	}
+	for name, expr := range paths.Fields {
+		if _, err := tx.Exec(queryInsertJSONPath, id, name, expr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the JSONPath expressions the job applies to its crawled JSON responses.
+// Nil is returned if the job has none.
+func (j *JobClient) JSONPaths(id common.JobId) (*common.JobJSONPaths, error) {
+	const queryJSONPaths = `SELECT name, expr FROM job_json_path WHERE job_id = $1`
+
+	rows, err := j.client.db.Query(queryJSONPaths, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths *common.JobJSONPaths
+	for rows.Next() {
+		var name, expr sql.NullString
+		if err := rows.Scan(&name, &expr); err != nil {
+			return nil, err
+		}
+		if !expr.Valid {
+			return nil, fmt.Errorf("Invalid JSONPath for job id %d", id)
+		}
+
+		if paths == nil {
+			paths = &common.JobJSONPaths{Links: []string{}, Fields: map[string]string{}}
+		}
+		if name.Valid {
+			paths.Fields[name.String] = expr.String
+		} else {
+			paths.Links = append(paths.Links, expr.String)
+		}
+	}
+	return paths, rows.Err()
+}
+
+// Stores the fields extracted from a JSON response of the job's URL, replacing
+// the fields previously extracted from the URL. Field values are JSON encoded.
+func (j *JobClient) StoreJSONFields(id common.JobId, urlId common.URLId, fields map[string]string) error {
+	const queryDeleteJSONFields = `DELETE FROM job_json_field WHERE job_id = $1 AND url_id = $2`
+	const queryInsertJSONField = `INSERT INTO job_json_field (job_id, url_id, name, value) VALUES ($1, $2, $3, $4)`
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(queryDeleteJSONFields, id, urlId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for name, value := range fields {
+		if _, err := tx.Exec(queryInsertJSONField, id, urlId, name, value); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Returns the fields extracted from the job's crawled JSON responses, keyed by
+// URL, then field name. Each field's value is the list of values its JSONPath
+// selected.
+func (j *JobClient) JSONFields(id common.JobId) (map[string]map[string]interface{}, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryJSONFields = `
+SELECT url.url, job_json_field.name, job_json_field.value
+FROM job_json_field
+JOIN url ON url.id = job_json_field.url_id
+WHERE job_json_field.job_id = $1`
+
+	rows, err := j.client.db.Query(queryJSONFields, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fields := map[string]map[string]interface{}{}
+	for rows.Next() {
+		var u, name, value sql.NullString
+		if err := rows.Scan(&u, &name, &value); err != nil {
+			return nil, err
+		}
+		if !u.Valid || !name.Valid || !value.Valid {
+			return nil, fmt.Errorf("Invalid JSON field for job id %d", id)
+		}
+
+		var v interface{}
+		if err := json.Unmarshal([]byte(value.String), &v); err != nil {
+			return nil, err
+		}
+		if fields[u.String] == nil {
+			fields[u.String] = map[string]interface{}{}
+		}
+		fields[u.String][name.String] = v
+	}
+	return fields, rows.Err()
+}
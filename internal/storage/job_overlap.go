@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Returns the active jobs, those running or paused, with seed URLs in common
+// with the URLs, and how many of the URLs are their seeds, most overlapping
+// first. Nil is returned if no active job has any of the URLs as a seed.
+func (j *JobClient) ActiveJobOverlaps(urls []string) ([]common.JobOverlap, error) {
+	const queryActiveJobOverlaps = `
+SELECT job_url.job_id, COUNT(DISTINCT job_url.url_id),
+	(SELECT COUNT(*) FROM job_url AS seed WHERE seed.job_id = job_url.job_id)
+FROM job_url
+JOIN url ON url.id = job_url.url_id
+JOIN job ON job.id = job_url.job_id
+WHERE url.url = ANY($1) AND job.cancelled_on IS NULL
+AND EXISTS (SELECT 1 FROM job_url AS pending WHERE pending.job_id = job.id AND pending.completed_on IS NULL)
+GROUP BY job_url.job_id
+ORDER BY COUNT(DISTINCT job_url.url_id) DESC, job_url.job_id DESC`
+
+	rows, err := j.client.db.Query(queryActiveJobOverlaps, pq.Array(urls))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overlaps []common.JobOverlap
+	for rows.Next() {
+		var id, overlapping, seeds sql.NullInt64
+		if err := rows.Scan(&id, &overlapping, &seeds); err != nil {
+			return nil, err
+		}
+		if !id.Valid {
+			return nil, fmt.Errorf("Invalid result for active job overlaps")
+		}
+
+		overlaps = append(overlaps, common.JobOverlap{
+			JobId:       common.JobId(id.Int64),
+			Overlapping: int(overlapping.Int64),
+			Seeds:       int(seeds.Int64),
+		})
+	}
+	return overlaps, rows.Err()
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Returns the redirects recorded from the content of the job's URLs, ordered
+// by the redirecting URL. A URL's meta refresh redirects are ordered before
+// its JavaScript redirects.
+func (j *JobClient) Redirects(id common.JobId) ([]common.RedirectEdge, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryJobRedirects = `
+SELECT from_url.url, to_url.url, url_redirect.kind
+FROM url_redirect
+JOIN url AS from_url ON from_url.id = url_redirect.url_id
+JOIN url AS to_url ON to_url.id = url_redirect.target_id
+WHERE url_redirect.url_id IN (` + queryJobURLIds + `)
+ORDER BY from_url.url, url_redirect.kind DESC, to_url.url`
+
+	rows, err := j.client.db.Query(queryJobRedirects, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	edges := []common.RedirectEdge{}
+	for rows.Next() {
+		var from, to, kind sql.NullString
+		if err := rows.Scan(&from, &to, &kind); err != nil {
+			return nil, err
+		}
+		if !from.Valid || !to.Valid {
+			return nil, fmt.Errorf("Invalid job redirect for job id %d", id)
+		}
+
+		edges = append(edges, common.RedirectEdge{From: from.String, To: to.String, Kind: kind.String})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return edges, nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Calls fn with each of the job's results matching the filter, ordered the
+// same as the pages of ResultPage, as they are read from the database, so
+// the results of large jobs can be streamed without being held in memory.
+// Duplicate results under the same refer URL are only included once. If fn
+// returns an error no more results are read, and the error is returned.
+func (j *JobClient) ResultRows(id common.JobId, filter ResultFilter, fn func(common.JobResultRow) error) error {
+	return j.resultRows(id, filter, nil, 0, func(row common.JobResultRow, _ common.ResultCursor) error {
+		return fn(row)
+	})
+}
+
+// Returns a page of the job's results, with the state each was crawled in,
+// up to the limit of results, continuing from the cursor. A nil cursor
+// returns the first page. Results are filtered, and ordered the same as
+// ResultRows. The cursor of the next page is returned, nil if this is the
+// last page.
+func (j *JobClient) ResultRowPage(id common.JobId, filter ResultFilter, after *common.ResultCursor, limit int) ([]common.JobResultRow, *common.ResultCursor, error) {
+	rows := []common.JobResultRow{}
+	cursors := []common.ResultCursor{}
+
+	// One more result than the limit is selected to know if there is a
+	// next page.
+	err := j.resultRows(id, filter, after, limit+1, func(row common.JobResultRow, cursor common.ResultCursor) error {
+		rows = append(rows, row)
+		cursors = append(cursors, cursor)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(rows) > limit {
+		next := cursors[limit-1]
+		return rows[:limit], &next, nil
+	}
+	return rows, nil, nil
+}
+
+// Calls fn with each of the job's results matching the filter after the
+// cursor, and the cursor of the result. Up to limit results are read if
+// limit is greater than zero.
+func (j *JobClient) resultRows(id common.JobId, filter ResultFilter, after *common.ResultCursor, limit int, fn func(common.JobResultRow, common.ResultCursor) error) error {
+	if err := j.mustExist(id); err != nil {
+		return err
+	}
+
+	queryJobResultRows := `
+SELECT DISTINCT ON (job_result.refer_id, job_result.url_id)
+	job_result.refer_id, job_result.url_id, refer.url, url.url, url.status, url.mime, url.crawled_on
+FROM job_result
+LEFT JOIN url AS url on job_result.url_id = url.id
+LEFT join url as refer on job_result.refer_id = refer.id
+WHERE job_result.job_id = $1`
+	cond, args := filter.where([]interface{}{id})
+	queryJobResultRows += cond
+	if after != nil {
+		args = append(args, after.ReferId, after.URLId)
+		queryJobResultRows += fmt.Sprintf(`
+	and (job_result.refer_id, job_result.url_id) > ($%d, $%d)`, len(args)-1, len(args))
+	}
+	queryJobResultRows += `
+ORDER BY job_result.refer_id, job_result.url_id`
+	if limit > 0 {
+		args = append(args, limit)
+		queryJobResultRows += fmt.Sprintf(`
+LIMIT $%d`, len(args))
+	}
+
+	rows, err := j.client.db.Query(queryJobResultRows, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			referId, urlId sql.NullInt64
+			refer, u, mime sql.NullString
+			status         sql.NullInt64
+			crawledOn      pq.NullTime
+		)
+		if err := rows.Scan(&referId, &urlId, &refer, &u, &status, &mime, &crawledOn); err != nil {
+			return err
+		}
+		if !refer.Valid || !u.Valid {
+			return fmt.Errorf("Invalid job result for job id %d", id)
+		}
+
+		row := common.JobResultRow{
+			URL:       u.String,
+			Refer:     refer.String,
+			Status:    int(status.Int64),
+			Mime:      mime.String,
+			CrawledOn: crawledOn.Time,
+		}
+		cursor := common.ResultCursor{JobId: id, ReferId: common.URLId(referId.Int64), URLId: common.URLId(urlId.Int64)}
+		if err := fn(row, cursor); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
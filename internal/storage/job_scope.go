@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Sets the scope of the links the job's pages are crawled within, one of the
+// JobScope constants.
+func (j *JobClient) SetScope(id common.JobId, scope string) error {
+	const querySetScope = `UPDATE job SET scope = $2 WHERE id = $1`
+
+	if _, err := j.client.db.Exec(querySetScope, id, scope); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the scope of the links the job's pages are crawled within. Jobs
+// which were scheduled without a scope, or do not exist, have any scope.
+func (j *JobClient) Scope(id common.JobId) (string, error) {
+	const queryScope = `SELECT scope FROM job WHERE id = $1`
+
+	var scope sql.NullString
+	if err := j.client.db.QueryRow(queryScope, id).Scan(&scope); err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if !scope.Valid || scope.String == "" {
+		return common.JobScopeAny, nil
+	}
+	return scope.String, nil
+}
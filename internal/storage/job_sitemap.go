@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Returns the job's HTML pages which were successfully crawled, ordered by
+// URL, for the job's sitemap to be generated from. The pages' last updated
+// dates are from the dates stored when they were crawled.
+func (j *JobClient) SitemapPages(id common.JobId) ([]common.SitemapPage, error) {
+	if err := j.mustExist(id); err != nil {
+		return nil, err
+	}
+
+	const queryJobSitemapPages = `
+SELECT url.url, url.published_on, url.modified_on
+FROM url
+WHERE url.crawled_on IS NOT NULL AND url.mime = 'text/html' AND url.status BETWEEN 200 AND 299
+AND url.id IN (` + queryJobURLIds + `)
+ORDER BY url.url`
+
+	rows, err := j.client.db.Query(queryJobSitemapPages, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pages := []common.SitemapPage{}
+	for rows.Next() {
+		var (
+			u           sql.NullString
+			publishedOn pq.NullTime
+			modifiedOn  pq.NullTime
+		)
+		if err := rows.Scan(&u, &publishedOn, &modifiedOn); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid job sitemap page for job id %d", id)
+		}
+
+		info := common.PageInfo{PublishedOn: publishedOn.Time, ModifiedOn: modifiedOn.Time}
+		pages = append(pages, common.SitemapPage{URL: u.String, LastUpdated: info.LastUpdated()})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
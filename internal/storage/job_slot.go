@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Key of the advisory lock serializing the starts of waiting jobs, so
+// foremen starting jobs concurrently don't exceed the running job limits.
+const jobSlotLockKey = 0x68617276004
+
+// Jobs which have been started, and still have incomplete Job URLs. Paused,
+// and cancelled jobs don't hold a running job slot.
+const queryRunningJobs = `
+job.started_on IS NOT NULL AND job.paused_on IS NULL AND job.cancelled_on IS NULL
+AND EXISTS (SELECT 1 FROM job_url WHERE job_url.job_id = job.id AND job_url.completed_on IS NULL)`
+
+// Jobs which have not been started, and have incomplete Job URLs. Paused
+// waiting jobs are not started until resumed.
+const queryWaitingJobs = `
+job.started_on IS NULL AND job.paused_on IS NULL AND job.cancelled_on IS NULL
+AND EXISTS (SELECT 1 FROM job_url WHERE job_url.job_id = job.id AND job_url.completed_on IS NULL)`
+
+// Window of recently started jobs the start of waiting jobs is estimated from.
+const jobStartRateWindow = time.Hour
+
+// Job waiting for a running job slot, and the API key it was scheduled with.
+type waitingJob struct {
+	id       common.JobId
+	apiKeyId int64
+}
+
+// Returns true if the job has been started by the foreman. Jobs which do not
+// exist are considered started, so their items are not held waiting forever.
+func (j *JobClient) IsStarted(id common.JobId) (bool, error) {
+	const queryJobStarted = `SELECT started_on IS NOT NULL FROM job WHERE id = $1`
+
+	var started sql.NullBool
+	if err := j.client.db.QueryRow(queryJobStarted, id).Scan(&started); err == sql.ErrNoRows {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return started.Valid && started.Bool, nil
+}
+
+// Returns the job's position in the queue of waiting jobs, urgent jobs ahead
+// of the others, and its estimated start from the rate jobs were started at
+// within the recent window. Nil is
+// returned if the job isn't waiting, or does not exist.
+func (j *JobClient) QueuePosition(id common.JobId, now time.Time) (*common.JobQueuePosition, error) {
+	const queryPosition = `
+SELECT
+	(SELECT COUNT(*) FROM job WHERE ` + queryWaitingJobs + `
+		AND (job.urgent_on IS NULL, job.id) <= (target.urgent_on IS NULL, target.id)),
+	(SELECT COUNT(*) FROM job WHERE job.started_on > $2)
+FROM (SELECT job.id, job.urgent_on FROM job WHERE ` + queryWaitingJobs + ` AND job.id = $1) AS target`
+
+	var position, started int
+	err := j.client.db.QueryRow(queryPosition, id, now.Add(-jobStartRateWindow)).Scan(&position, &started)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &common.JobQueuePosition{
+		Position:        position,
+		RecentlyStarted: started,
+		EstimatedStart:  common.EstimateJobStart(position, started, jobStartRateWindow, now),
+	}, nil
+}
+
+// Starts the waiting jobs which fit within the running job limits, urgent jobs
+// first, then oldest job first, returning the ids of the jobs started. No more than max jobs are
+// running at once, and no more than maxPerKey jobs of each API key. Jobs
+// scheduled without an API key share a limit. Zero limits are unlimited. A
+// job whose API key is at its limit doesn't hold back the jobs of other keys.
+func (j *JobClient) StartWaitingJobs(max, maxPerKey int) ([]common.JobId, error) {
+	const queryLock = `SELECT pg_advisory_xact_lock($1)`
+	const queryRunning = `
+SELECT COALESCE(job.api_key_id, 0), COUNT(*) FROM job
+WHERE ` + queryRunningJobs + `
+GROUP BY 1`
+	const queryWaiting = `
+SELECT job.id, COALESCE(job.api_key_id, 0) FROM job
+WHERE ` + queryWaitingJobs + `
+ORDER BY job.urgent_on IS NULL, job.id`
+	const queryStart = `UPDATE job SET started_on = $2 WHERE id = $1 AND started_on IS NULL`
+
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(queryLock, jobSlotLockKey); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	running := map[int64]int{}
+	rows, err := tx.Query(queryRunning)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		var apiKeyId int64
+		var n int
+		if err := rows.Scan(&apiKeyId, &n); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		running[apiKeyId] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	waiting := []waitingJob{}
+	rows, err = tx.Query(queryWaiting)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	for rows.Next() {
+		var w waitingJob
+		if err := rows.Scan(&w.id, &w.apiKeyId); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		waiting = append(waiting, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	started := jobsToStart(waiting, running, max, maxPerKey)
+	now := time.Now().UTC()
+	for _, id := range started {
+		if _, err := tx.Exec(queryStart, id, now); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return started, nil
+}
+
+// Returns the ids of the waiting jobs, in order, which fit within the limits
+// given the number of jobs of each API key already running. Zero limits are
+// unlimited.
+func jobsToStart(waiting []waitingJob, running map[int64]int, max, maxPerKey int) []common.JobId {
+	total := 0
+	for _, n := range running {
+		total += n
+	}
+
+	ids := []common.JobId{}
+	for _, w := range waiting {
+		if max > 0 && total >= max {
+			break
+		}
+		if maxPerKey > 0 && running[w.apiKeyId] >= maxPerKey {
+			continue
+		}
+		running[w.apiKeyId]++
+		total++
+		ids = append(ids, w.id)
+	}
+	return ids
+}
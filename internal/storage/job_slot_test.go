@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestJobsToStart(t *testing.T) {
+	waiting := []waitingJob{{id: 1, apiKeyId: 7}, {id: 2, apiKeyId: 7}, {id: 3, apiKeyId: 8}, {id: 4}, {id: 5, apiKeyId: 8}}
+
+	ids := jobsToStart(waiting, map[int64]int{}, 0, 0)
+	assert.Equal(t, []common.JobId{1, 2, 3, 4, 5}, ids, "Expect all started if unlimited")
+
+	ids = jobsToStart(waiting, map[int64]int{7: 1}, 3, 0)
+	assert.Equal(t, []common.JobId{1, 2}, ids, "Expect oldest started up to the global limit")
+
+	ids = jobsToStart(waiting, map[int64]int{7: 1}, 0, 1)
+	assert.Equal(t, []common.JobId{3, 4}, ids, "Expect keys at their limit skipped")
+
+	ids = jobsToStart(waiting, map[int64]int{8: 1}, 3, 1)
+	assert.Equal(t, []common.JobId{1, 4}, ids, "Expect both limits applied")
+
+	ids = jobsToStart(waiting, map[int64]int{7: 2, 0: 2}, 4, 0)
+	assert.Equal(t, []common.JobId{}, ids, "Expect none started if no slots")
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Sets the rules of how the job handles the responses of status codes,
+// replacing any previously set.
+func (j *JobClient) SetStatusRules(id common.JobId, rules []common.JobStatusRule) error {
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := setStatusRules(tx, id, rules); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replaces the job's status code rules within the transaction.
+func setStatusRules(tx *sql.Tx, id common.JobId, rules []common.JobStatusRule) error {
+	const queryDeleteStatusRules = `DELETE FROM job_status_rule WHERE job_id = $1`
+	const queryInsertStatusRule = `
+INSERT INTO job_status_rule (job_id, status, action, retry_delay_ms, retries) VALUES ($1, $2, $3, $4, $5)`
+
+	if _, err := tx.Exec(queryDeleteStatusRules, id); err != nil {
+		return err
+	}
+	for _, r := range rules {
+		if _, err := tx.Exec(queryInsertStatusRule, id, r.Status, r.Action, int64(r.RetryDelay/time.Millisecond), r.Retries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the rules of how the job handles the responses of status codes,
+// ordered by status. Nil is returned if the job has none.
+func (j *JobClient) StatusRules(id common.JobId) ([]common.JobStatusRule, error) {
+	const queryStatusRules = `
+SELECT status, action, retry_delay_ms, retries FROM job_status_rule WHERE job_id = $1 ORDER BY status`
+
+	rows, err := j.client.db.Query(queryStatusRules, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []common.JobStatusRule
+	for rows.Next() {
+		var status, action sql.NullString
+		var delayMs, retries sql.NullInt64
+		if err := rows.Scan(&status, &action, &delayMs, &retries); err != nil {
+			return nil, err
+		}
+		if !status.Valid || !action.Valid {
+			return nil, fmt.Errorf("Invalid status rule for job id %d", id)
+		}
+
+		rules = append(rules, common.JobStatusRule{
+			Status:     status.String,
+			Action:     action.String,
+			RetryDelay: time.Duration(delayMs.Int64) * time.Millisecond,
+			Retries:    int(retries.Int64),
+		})
+	}
+	return rules, rows.Err()
+}
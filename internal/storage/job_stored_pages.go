@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Calls fn with each of the job's URLs whose raw HTML is stored, ordered by
+// URL id, as they are read from the database, so the pages of large jobs can
+// be streamed without being held in memory. HTML tiered into the cold store
+// is read from it. URLs whose HTML was only stored
+// sanitized are skipped. If fn returns an error no more pages are read, and
+// the error is returned.
+func (j *JobClient) StoredPages(id common.JobId, fn func(StoredPage) error) error {
+	if err := j.mustExist(id); err != nil {
+		return err
+	}
+
+	const queryJobStoredPages = `
+SELECT url.id, url.url, url.status, url.mime, url_html.raw, url_html.raw_tiered, url_html.stored_on
+FROM url
+JOIN url_html ON url_html.url_id = url.id
+WHERE (url_html.raw IS NOT NULL OR url_html.raw_tiered) AND url.id IN (` + queryJobURLIds + `)
+ORDER BY url.id`
+
+	rows, err := j.client.db.Query(queryJobStoredPages, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			urlId        int64
+			u, mime, raw sql.NullString
+			rawTiered    bool
+			status       sql.NullInt64
+			storedOn     pq.NullTime
+		)
+		if err := rows.Scan(&urlId, &u, &status, &mime, &raw, &rawTiered, &storedOn); err != nil {
+			return err
+		}
+		if !u.Valid {
+			return fmt.Errorf("Invalid job stored page for job id %d", id)
+		}
+		html, err := j.client.tieredHTML(common.URLId(urlId), "raw", raw, rawTiered)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(StoredPage{
+			URL:      u.String,
+			Status:   int(status.Int64),
+			Mime:     mime.String,
+			Raw:      html,
+			StoredOn: storedOn.Time,
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Sets the tags the job is listed by, replacing any previously set.
+func (j *JobClient) SetTags(id common.JobId, tags []string) error {
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := setTags(tx, id, tags); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replaces the job's tags within the transaction.
+func setTags(tx *sql.Tx, id common.JobId, tags []string) error {
+	const queryDeleteTags = `DELETE FROM job_tag WHERE job_id = $1`
+	const queryInsertTag = `INSERT INTO job_tag (job_id, tag) VALUES ($1, $2)`
+
+	if _, err := tx.Exec(queryDeleteTags, id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(queryInsertTag, id, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the tags the job is listed by, ordered by tag. An empty list is
+// returned if the job has no tags.
+func (j *JobClient) Tags(id common.JobId) ([]string, error) {
+	const queryTags = `SELECT tag FROM job_tag WHERE job_id = $1 ORDER BY tag`
+
+	rows, err := j.client.db.Query(queryTags, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
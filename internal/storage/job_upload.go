@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Columns of the job_upload table selected when querying uploads.
+const jobUploadColumns = `id,state,url_count,rejected,duplicates,job_id,error,created_on,finished_on`
+
+// Creates a new job upload in the parsing state, returning it.
+func (j *JobClient) CreateUpload() (*common.JobUpload, error) {
+	const queryInsertUpload = `INSERT INTO job_upload (state) VALUES ($1) RETURNING ` + jobUploadColumns
+
+	return getJobUploadFromRow(j.client.db.QueryRow(queryInsertUpload, common.JobUploadParsing))
+}
+
+// Updates the upload's state, counts, job, and error. The upload's finished
+// time is set once it completes or fails.
+func (j *JobClient) UpdateUpload(u *common.JobUpload) error {
+	const queryUpdateUpload = `
+UPDATE job_upload SET state = $2, url_count = $3, rejected = $4, duplicates = $5, job_id = $6, error = $7, finished_on = $8
+WHERE id = $1`
+
+	jobId := sql.NullInt64{Int64: int64(u.JobId), Valid: u.JobId != common.InvalidId}
+	errMsg := sql.NullString{String: u.Error, Valid: u.Error != ""}
+	finishedOn := pq.NullTime{Time: time.Now().UTC(), Valid: u.State == common.JobUploadCompleted || u.State == common.JobUploadFailed}
+	if _, err := j.client.db.Exec(queryUpdateUpload, u.Id, u.State, u.URLs, u.Rejected, u.Duplicates, jobId, errMsg, finishedOn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Fails the uploads still parsing, or scheduling, which were created longer
+// than the age ago, with the reason. Returns the number of uploads failed.
+func (j *JobClient) FailStaleUploads(age time.Duration, reason string) (int64, error) {
+	const queryFailStale = `
+UPDATE job_upload SET state = $1, error = $2, finished_on = NOW()
+WHERE state IN ($3, $4) AND created_on <= NOW() - $5 * INTERVAL '1 millisecond'`
+
+	res, err := j.client.db.Exec(queryFailStale, common.JobUploadFailed, reason,
+		common.JobUploadParsing, common.JobUploadScheduling, age/time.Millisecond)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Returns the upload by id. Nil is returned if the upload does not exist.
+func (j *JobClient) Upload(id common.UploadId) (*common.JobUpload, error) {
+	const queryUpload = `SELECT ` + jobUploadColumns + ` FROM job_upload WHERE id = $1`
+
+	return getJobUploadFromRow(j.client.db.QueryRow(queryUpload, id))
+}
+
+// Extracts the upload from a QueryRow row. If no upload is found, nil will be returned.
+func getJobUploadFromRow(row *sql.Row) (*common.JobUpload, error) {
+	var (
+		id, urls, rejected, duplicates, jobId sql.NullInt64
+		state, errMsg                         sql.NullString
+		createdOn, finishedOn                 pq.NullTime
+	)
+	if err := row.Scan(&id, &state, &urls, &rejected, &duplicates, &jobId, &errMsg, &createdOn, &finishedOn); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	u := &common.JobUpload{
+		Id:         common.UploadId(id.Int64),
+		State:      state.String,
+		URLs:       int(urls.Int64),
+		Rejected:   int(rejected.Int64),
+		Duplicates: int(duplicates.Int64),
+		JobId:      common.InvalidId,
+		Error:      errMsg.String,
+		CreatedOn:  createdOn.Time,
+		FinishedOn: finishedOn.Time,
+	}
+	if jobId.Valid {
+		u.JobId = common.JobId(jobId.Int64)
+	}
+	return u, nil
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Flags, or unflags the job as urgent. While an urgent job is active the
+// foreman throttles the items of all other jobs. False is returned if the
+// job does not exist, or is cancelled.
+func (j *JobClient) SetUrgent(id common.JobId, urgent bool) (bool, error) {
+	const queryFlagUrgent = `UPDATE job SET urgent_on = COALESCE(urgent_on, $2) WHERE id = $1 AND cancelled_on IS NULL`
+	const queryUnflagUrgent = `UPDATE job SET urgent_on = NULL WHERE id = $1 AND cancelled_on IS NULL`
+
+	if !urgent {
+		return j.updateJob(queryUnflagUrgent, id)
+	}
+	return j.updateJob(queryFlagUrgent, id, time.Now().UTC())
+}
+
+// Returns the ids of the urgent jobs which are still being crawled, jobs
+// flagged as urgent which are started, not paused, or cancelled, and have
+// pending URLs. Urgent jobs waiting for a running job slot are not active,
+// since their items are parked until they start, and throttling the running
+// jobs would keep them from ever freeing a slot.
+func (j *JobClient) ActiveUrgentJobs() ([]common.JobId, error) {
+	const queryActiveUrgentJobs = `
+SELECT job.id FROM job
+WHERE job.urgent_on IS NOT NULL AND job.started_on IS NOT NULL AND job.paused_on IS NULL AND job.cancelled_on IS NULL
+  AND EXISTS (SELECT 1 FROM url_pending WHERE url_pending.job_id = job.id)
+ORDER BY job.id`
+
+	return j.jobIds(queryActiveUrgentJobs)
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Sets the most URLs the job may crawl. Zero removes the job's limit.
+func (j *JobClient) SetMaxURLs(id common.JobId, max int) error {
+	const querySetMaxURLs = `UPDATE job SET max_urls = $2 WHERE id = $1`
+
+	maxURLs := sql.NullInt64{Int64: int64(max), Valid: max > 0}
+	if _, err := j.client.db.Exec(querySetMaxURLs, id, maxURLs); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Claims one of the URLs of the job's budget for a URL about to be crawled.
+// The claim is atomic, so workers crawling the job concurrently never crawl
+// more than the job's max URLs. Jobs without a max always have budget, and
+// their job row isn't updated, capped is false for them and their crawled
+// URLs are expected to be counted in batches with AddURLsCrawled. False is
+// returned if the job's budget is used up, or the job does not exist.
+func (j *JobClient) ClaimURLBudget(id common.JobId) (claimed, capped bool, err error) {
+	const queryClaimURLBudget = `
+WITH claim AS (
+    UPDATE job SET urls_crawled = urls_crawled + 1
+    WHERE id = $1 AND max_urls IS NOT NULL AND urls_crawled < max_urls
+    RETURNING id
+)
+SELECT max_urls IS NOT NULL, EXISTS (SELECT 1 FROM claim) FROM job WHERE id = $1`
+
+	if err := j.client.db.QueryRow(queryClaimURLBudget, id).Scan(&capped, &claimed); err == sql.ErrNoRows {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, err
+	}
+	return claimed || !capped, capped, nil
+}
+
+// Adds the number of URLs to the job's crawled URLs, e.g: the URLs crawled
+// by a job without a max since its count was last added.
+func (j *JobClient) AddURLsCrawled(id common.JobId, n int) error {
+	const queryAddURLsCrawled = `UPDATE job SET urls_crawled = urls_crawled + $2 WHERE id = $1`
+
+	if _, err := j.client.db.Exec(queryAddURLsCrawled, id, n); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns true if the job has a max, and has crawled as many URLs as it.
+func (j *JobClient) URLBudgetSpent(id common.JobId) (bool, error) {
+	const queryURLBudgetSpent = `SELECT max_urls IS NOT NULL AND urls_crawled >= max_urls FROM job WHERE id = $1`
+
+	var spent sql.NullBool
+	if err := j.client.db.QueryRow(queryURLBudgetSpent, id).Scan(&spent); err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	return spent.Valid && spent.Bool, nil
+}
+
+// Ends the job whose URL budget is used up. Like Cancel the job's frontier of
+// pending URLs is drained, and its Job URLs which have not completed are
+// marked complete, but the job keeps its results, and isn't cancelled. False
+// is returned if the job's budget was already exhausted, or the job does not
+// exist.
+func (j *JobClient) ExhaustURLBudget(id common.JobId) (bool, error) {
+	const queryExhaustJob = `UPDATE job SET url_budget_exhausted_on = $2 WHERE id = $1 AND url_budget_exhausted_on IS NULL`
+	const queryDeletePending = `DELETE FROM url_pending WHERE job_id = $1`
+	const queryCompleteJobURLs = `UPDATE job_url SET completed_on = $2 WHERE job_id = $1 AND completed_on IS NULL`
+
+	now := time.Now().UTC()
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	res, err := tx.Exec(queryExhaustJob, id, now)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		tx.Rollback()
+		return false, err
+	}
+
+	if _, err := tx.Exec(queryDeletePending, id); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if _, err := tx.Exec(queryCompleteJobURLs, id, now); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns the job's URL budget. Nil is returned if the job does not exist, or
+// has no max.
+func (j *JobClient) URLBudget(id common.JobId) (*common.JobURLBudget, error) {
+	const queryURLBudget = `SELECT max_urls, urls_crawled, url_budget_exhausted_on FROM job WHERE id = $1`
+
+	var (
+		max         sql.NullInt64
+		crawled     int
+		exhaustedOn pq.NullTime
+	)
+	err := j.client.db.QueryRow(queryURLBudget, id).Scan(&max, &crawled, &exhaustedOn)
+	if err == sql.ErrNoRows || (err == nil && !max.Valid) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	budget := &common.JobURLBudget{Max: int(max.Int64), Crawled: crawled}
+	if exhaustedOn.Valid {
+		budget.ExhaustedOn = &exhaustedOn.Time
+	}
+	return budget, nil
+}
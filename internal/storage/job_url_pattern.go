@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Sets the include, and exclude patterns the links of the job's pages are
+// matched against before they are queued, replacing any previously set.
+func (j *JobClient) SetURLPatterns(id common.JobId, patterns []common.JobURLPattern) error {
+	tx, err := j.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := setURLPatterns(tx, id, patterns); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Replaces the job's URL patterns within the transaction.
+func setURLPatterns(tx *sql.Tx, id common.JobId, patterns []common.JobURLPattern) error {
+	const queryDeleteURLPatterns = `DELETE FROM job_url_pattern WHERE job_id = $1`
+	const queryInsertURLPattern = `INSERT INTO job_url_pattern (job_id, pattern, regexp, exclude) VALUES ($1, $2, $3, $4)`
+
+	if _, err := tx.Exec(queryDeleteURLPatterns, id); err != nil {
+		return err
+	}
+	for _, p := range patterns {
+		if _, err := tx.Exec(queryInsertURLPattern, id, p.Pattern, p.Regexp, p.Exclude); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the include, and exclude patterns the links of the job's pages are
+// matched against, in the order they were set. Nil is returned if the job has
+// none.
+func (j *JobClient) URLPatterns(id common.JobId) ([]common.JobURLPattern, error) {
+	const queryURLPatterns = `SELECT pattern, regexp, exclude FROM job_url_pattern WHERE job_id = $1 ORDER BY id`
+
+	rows, err := j.client.db.Query(queryURLPatterns, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var patterns []common.JobURLPattern
+	for rows.Next() {
+		var pattern sql.NullString
+		var regexp, exclude bool
+		if err := rows.Scan(&pattern, &regexp, &exclude); err != nil {
+			return nil, err
+		}
+		if !pattern.Valid {
+			return nil, fmt.Errorf("Invalid URL pattern for job id %d", id)
+		}
+
+		patterns = append(patterns, common.JobURLPattern{Pattern: pattern.String, Regexp: regexp, Exclude: exclude})
+	}
+	return patterns, rows.Err()
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Sets what is stripped from the links found on the job's pages. Nil params
+// strip the default tracking parameters.
+func (j *JobClient) SetURLStripping(id common.JobId, params []string, keepFragments bool) error {
+	const querySetURLStripping = `UPDATE job SET strip_params = $2, keep_fragments = $3 WHERE id = $1`
+
+	if _, err := j.client.db.Exec(querySetURLStripping, id, pq.Array(params), keepFragments); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the effective rules of what is stripped from the links found on the
+// job's pages. Jobs which were scheduled without strip params, or do not
+// exist, strip the default tracking parameters.
+func (j *JobClient) URLStripping(id common.JobId) (common.URLStripping, error) {
+	const queryURLStripping = `SELECT strip_params, keep_fragments FROM job WHERE id = $1`
+
+	var (
+		params        []string
+		keepFragments bool
+	)
+	err := j.client.db.QueryRow(queryURLStripping, id).Scan(pq.Array(&params), &keepFragments)
+	if err != nil && err != sql.ErrNoRows {
+		return common.URLStripping{}, err
+	}
+	return common.NewURLStripping(params, keepFragments), nil
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Records the job's URL responded 451 Unavailable For Legal Reasons. If the
+// URL was already recorded for the job, the entity blocking it, and when it
+// was recorded are replaced.
+func (u *URLClient) AddLegalRestriction(jobId common.JobId, urlId common.URLId, r common.LegalRestriction) error {
+	const queryUpdateRestriction = `
+UPDATE url_legal_restriction SET blocked_by = $3, recorded_on = $4
+WHERE job_id = $1 AND url_id = $2`
+	const queryInsertRestriction = `
+INSERT INTO url_legal_restriction (job_id, url_id, host, blocked_by, recorded_on)
+	SELECT $1, $2, $3, $4, $5
+	WHERE NOT EXISTS (SELECT 1 FROM url_legal_restriction WHERE job_id = $1 AND url_id = $2)`
+
+	blockedBy := sql.NullString{String: r.BlockedBy, Valid: r.BlockedBy != ""}
+	res, err := u.client.db.Exec(queryUpdateRestriction, jobId, urlId, blockedBy, r.RecordedOn)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	_, err = u.client.db.Exec(queryInsertRestriction, jobId, urlId, r.Host, blockedBy, r.RecordedOn)
+	return err
+}
+
+// Returns true if the URL has responded 451 Unavailable For Legal Reasons to
+// the crawl of any job.
+func (u *URLClient) IsLegallyRestricted(urlId common.URLId) (bool, error) {
+	const queryRestricted = `SELECT EXISTS (SELECT 1 FROM url_legal_restriction WHERE url_id = $1)`
+
+	var restricted bool
+	if err := u.client.db.QueryRow(queryRestricted, urlId).Scan(&restricted); err != nil {
+		return false, err
+	}
+	return restricted, nil
+}
+
+// Returns the number of the job's URLs which responded 451 Unavailable For
+// Legal Reasons, and up to the limit of them, most recently restricted first.
+func (j *JobClient) LegalRestrictions(id common.JobId, limit int) (*common.JobLegalRestrictions, error) {
+	const queryCountRestrictions = `SELECT COUNT(*) FROM url_legal_restriction WHERE job_id = $1`
+	const queryRestrictions = `
+SELECT url.url, r.host, r.blocked_by, r.recorded_on
+FROM url_legal_restriction AS r
+JOIN url ON url.id = r.url_id
+WHERE r.job_id = $1
+ORDER BY r.recorded_on DESC, url.url
+LIMIT $2`
+
+	restrictions := &common.JobLegalRestrictions{URLs: []common.LegalRestriction{}}
+	if err := j.client.db.QueryRow(queryCountRestrictions, id).Scan(&restrictions.Count); err != nil {
+		return nil, err
+	}
+	if restrictions.Count == 0 {
+		return restrictions, nil
+	}
+
+	rows, err := j.client.db.Query(queryRestrictions, id, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			u, host, blockedBy sql.NullString
+			recordedOn         pq.NullTime
+		)
+		if err := rows.Scan(&u, &host, &blockedBy, &recordedOn); err != nil {
+			return nil, err
+		}
+		restrictions.URLs = append(restrictions.URLs, common.LegalRestriction{
+			URL:        u.String,
+			Host:       host.String,
+			BlockedBy:  blockedBy.String,
+			RecordedOn: recordedOn.Time,
+		})
+	}
+	return restrictions, rows.Err()
+}
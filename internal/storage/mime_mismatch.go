@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Records the content type the job's URL declared mismatched the content type
+// sniffed from its content. If the URL was already recorded for the job, its
+// content types, and when the mismatch was detected are replaced.
+func (u *URLClient) AddMimeMismatch(jobId common.JobId, urlId common.URLId, m common.MimeMismatch) error {
+	const queryUpdateMismatch = `
+UPDATE url_mime_mismatch SET declared = $3, sniffed = $4, detected_on = $5
+WHERE job_id = $1 AND url_id = $2`
+	const queryInsertMismatch = `
+INSERT INTO url_mime_mismatch (job_id, url_id, declared, sniffed, detected_on)
+	SELECT $1, $2, $3, $4, $5
+	WHERE NOT EXISTS (SELECT 1 FROM url_mime_mismatch WHERE job_id = $1 AND url_id = $2)`
+
+	res, err := u.client.db.Exec(queryUpdateMismatch, jobId, urlId, m.Declared, m.Sniffed, m.DetectedOn)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	_, err = u.client.db.Exec(queryInsertMismatch, jobId, urlId, m.Declared, m.Sniffed, m.DetectedOn)
+	return err
+}
+
+// Generates the report of the job's URLs whose declared content type mismatched
+// the content type sniffed from their content. The report is empty if the job
+// does not exist.
+func (j *JobClient) MimeMismatches(id common.JobId) (*common.MimeMismatchReport, error) {
+	const queryJobMimeMismatches = `
+SELECT url.url, m.declared, m.sniffed, m.detected_on
+FROM url_mime_mismatch AS m
+JOIN url ON url.id = m.url_id
+WHERE m.job_id = $1
+ORDER BY url.url`
+
+	rows, err := j.client.db.Query(queryJobMimeMismatches, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &common.MimeMismatchReport{URLs: []common.MimeMismatch{}}
+	for rows.Next() {
+		var (
+			u, declared, sniffed sql.NullString
+			detectedOn           pq.NullTime
+		)
+		if err := rows.Scan(&u, &declared, &sniffed, &detectedOn); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid job mime mismatch for job id %d", id)
+		}
+
+		report.URLs = append(report.URLs, common.MimeMismatch{
+			URL:        u.String,
+			Declared:   declared.String,
+			Sniffed:    sniffed.String,
+			DetectedOn: detectedOn.Time,
+		})
+	}
+	return report, rows.Err()
+}
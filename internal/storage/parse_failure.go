@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Quarantines the job's URL whose content failed to be parsed, storing its
+// raw content with the parse error. If the URL was already quarantined for
+// the job, its failure is replaced.
+func (u *URLClient) AddParseFailure(jobId common.JobId, urlId common.URLId, f common.ParseFailure) error {
+	const queryUpdateFailure = `
+UPDATE url_parse_failure SET mime = $3, error = $4, size = $5, truncated = $6, raw = $7, failed_on = $8
+WHERE job_id = $1 AND url_id = $2`
+	const queryInsertFailure = `
+INSERT INTO url_parse_failure (job_id, url_id, mime, error, size, truncated, raw, failed_on)
+	SELECT $1, $2, $3, $4, $5, $6, $7, $8
+	WHERE NOT EXISTS (SELECT 1 FROM url_parse_failure WHERE job_id = $1 AND url_id = $2)`
+
+	raw := f.Raw
+	if raw == nil {
+		raw = []byte{}
+	}
+	args := []interface{}{jobId, urlId, f.Mime, f.Error, f.Size, f.Truncated, raw, f.FailedOn}
+	res, err := u.client.db.Exec(queryUpdateFailure, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	_, err = u.client.db.Exec(queryInsertFailure, args...)
+	return err
+}
+
+// Generates the report of the job's URLs whose content failed to be parsed,
+// without their raw content. The report is empty if the job does not exist.
+func (j *JobClient) ParseFailures(id common.JobId) (*common.ParseFailureReport, error) {
+	const queryJobParseFailures = `
+SELECT url.url, f.mime, f.error, f.size, f.truncated, f.failed_on
+FROM url_parse_failure AS f
+JOIN url ON url.id = f.url_id
+WHERE f.job_id = $1
+ORDER BY url.url`
+
+	rows, err := j.client.db.Query(queryJobParseFailures, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &common.ParseFailureReport{URLs: []common.ParseFailure{}}
+	for rows.Next() {
+		f, err := scanParseFailure(rows.Scan, false)
+		if err != nil {
+			return nil, err
+		}
+		report.URLs = append(report.URLs, *f)
+	}
+	return report, rows.Err()
+}
+
+// Returns the quarantined failure, with its raw content, of the job's URL.
+// Nil is returned if the URL did not fail to be parsed by the job.
+func (j *JobClient) ParseFailure(id common.JobId, u string) (*common.ParseFailure, error) {
+	const queryJobParseFailure = `
+SELECT url.url, f.mime, f.error, f.size, f.truncated, f.failed_on, f.raw
+FROM url_parse_failure AS f
+JOIN url ON url.id = f.url_id
+WHERE f.job_id = $1 AND url.url = $2`
+
+	f, err := scanParseFailure(j.client.db.QueryRow(queryJobParseFailure, id, u).Scan, true)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return f, err
+}
+
+// Scans a parse failure row, of the url, mime, error, size, truncated, and
+// failed_on columns, followed by the raw column if withRaw is set.
+func scanParseFailure(scan func(dest ...interface{}) error, withRaw bool) (*common.ParseFailure, error) {
+	var (
+		u, mime, parseErr sql.NullString
+		size              sql.NullInt64
+		truncated         sql.NullBool
+		failedOn          pq.NullTime
+		raw               []byte
+	)
+	dest := []interface{}{&u, &mime, &parseErr, &size, &truncated, &failedOn}
+	if withRaw {
+		dest = append(dest, &raw)
+	}
+	if err := scan(dest...); err != nil {
+		return nil, err
+	}
+	if !u.Valid {
+		return nil, fmt.Errorf("Invalid parse failure record")
+	}
+
+	return &common.ParseFailure{
+		URL:       u.String,
+		Mime:      mime.String,
+		Error:     parseErr.String,
+		Size:      size.Int64,
+		Truncated: truncated.Bool,
+		FailedOn:  failedOn.Time,
+		Raw:       raw,
+	}, nil
+}
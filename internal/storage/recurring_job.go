@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"database/sql"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+	"time"
+)
+
+// Columns of the recurring_job table selected when querying recurring jobs.
+const recurringJobColumns = `id,name,cron,cron_tz,urls,options,api_key_id,created_on,next_run_on,last_run_on,last_job_id,disabled_on,disabled_reason`
+
+// Provides a name spaced collection of recurring job storage operations.
+// RecurringJobClient does not hold non go-routine state, and is safe to share
+// across multiples.
+type RecurringJobClient struct {
+	// Storage client already configured and connected to the storage provider
+	client *Client
+}
+
+// Stores the recurring job, whose first job is scheduled at its NextRunOn.
+// The job's id, and creation time are set by storage.
+func (r *RecurringJobClient) Create(rj common.RecurringJob) (*common.RecurringJob, error) {
+	const queryInsertRecurringJob = `
+INSERT INTO recurring_job (name, cron, cron_tz, urls, options, api_key_id, next_run_on)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+RETURNING ` + recurringJobColumns
+
+	apiKeyId := sql.NullInt64{Int64: rj.APIKeyId, Valid: rj.APIKeyId != 0}
+	return getRecurringJobFromRow(r.client.db.QueryRow(queryInsertRecurringJob,
+		rj.Name, rj.Cron, rj.CronTZ, pq.Array(rj.URLs), rj.Options, apiKeyId, rj.NextRunOn))
+}
+
+// Returns the recurring job of the id. Nil is returned if it does not exist.
+func (r *RecurringJobClient) Get(id int64) (*common.RecurringJob, error) {
+	const queryGetRecurringJob = `SELECT ` + recurringJobColumns + ` FROM recurring_job WHERE id = $1`
+
+	return getRecurringJobFromRow(r.client.db.QueryRow(queryGetRecurringJob, id))
+}
+
+// Returns all recurring jobs, ordered by id.
+func (r *RecurringJobClient) List() ([]common.RecurringJob, error) {
+	const queryListRecurringJobs = `SELECT ` + recurringJobColumns + ` FROM recurring_job ORDER BY id`
+
+	return r.query(queryListRecurringJobs)
+}
+
+// Returns the enabled recurring jobs whose next job is due to be scheduled at
+// the time, ordered by when they were due.
+func (r *RecurringJobClient) Due(now time.Time) ([]common.RecurringJob, error) {
+	const queryDueRecurringJobs = `
+SELECT ` + recurringJobColumns + ` FROM recurring_job
+WHERE next_run_on <= $1 AND disabled_on IS NULL
+ORDER BY next_run_on, id`
+
+	return r.query(queryDueRecurringJobs, now)
+}
+
+// Claims the recurring job's run which was due at the time, moving its next
+// run to next. False is returned if the run was already claimed, e.g: by
+// another web server, or the recurring job was deleted, so each run is only
+// scheduled once.
+func (r *RecurringJobClient) Claim(id int64, due, next time.Time) (bool, error) {
+	const queryClaimRun = `UPDATE recurring_job SET next_run_on = $3 WHERE id = $1 AND next_run_on = $2`
+
+	res, err := r.client.db.Exec(queryClaimRun, id, due, next)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Records the job scheduled by the recurring job's run at the time.
+func (r *RecurringJobClient) SetLastRun(id int64, jobId common.JobId, runOn time.Time) error {
+	const queryUpdateLastRun = `UPDATE recurring_job SET last_run_on = $2, last_job_id = $3 WHERE id = $1`
+
+	_, err := r.client.db.Exec(queryUpdateLastRun, id, runOn, jobId)
+	return err
+}
+
+// Disables the recurring job at the time, for the reason, so no more of its
+// jobs are scheduled. False is returned if it does not exist, or was already
+// disabled.
+func (r *RecurringJobClient) Disable(id int64, reason string, disabledOn time.Time) (bool, error) {
+	const queryDisable = `UPDATE recurring_job SET disabled_on = $2, disabled_reason = $3 WHERE id = $1 AND disabled_on IS NULL`
+
+	res, err := r.client.db.Exec(queryDisable, id, disabledOn, reason)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Deletes the recurring job, so no more of its jobs are scheduled. Jobs it
+// already scheduled are not affected. False is returned if it does not exist.
+func (r *RecurringJobClient) Delete(id int64) (bool, error) {
+	const queryDeleteRecurringJob = `DELETE FROM recurring_job WHERE id = $1`
+
+	res, err := r.client.db.Exec(queryDeleteRecurringJob, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// Queries the recurring jobs selected by the query's recurringJobColumns.
+func (r *RecurringJobClient) query(query string, args ...interface{}) ([]common.RecurringJob, error) {
+	rows, err := r.client.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []common.RecurringJob{}
+	for rows.Next() {
+		rj, err := scanRecurringJob(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *rj)
+	}
+	return jobs, rows.Err()
+}
+
+// Extracts the recurring job from a QueryRow row. If no recurring job is
+// found, nil will be returned.
+func getRecurringJobFromRow(row *sql.Row) (*common.RecurringJob, error) {
+	rj, err := scanRecurringJob(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return rj, err
+}
+
+// Scans the recurringJobColumns into a recurring job with the scan function
+// provided.
+func scanRecurringJob(scan func(dest ...interface{}) error) (*common.RecurringJob, error) {
+	var (
+		id, apiKeyId, lastJobId         sql.NullInt64
+		name, cron, cronTZ, options     sql.NullString
+		disabledReason                  sql.NullString
+		urls                            []string
+		createdOn, nextRunOn, lastRunOn pq.NullTime
+		disabledOn                      pq.NullTime
+	)
+	if err := scan(&id, &name, &cron, &cronTZ, pq.Array(&urls), &options, &apiKeyId, &createdOn, &nextRunOn, &lastRunOn, &lastJobId,
+		&disabledOn, &disabledReason); err != nil {
+		return nil, err
+	}
+
+	rj := &common.RecurringJob{
+		Id:        id.Int64,
+		Name:      name.String,
+		Cron:      cron.String,
+		CronTZ:    cronTZ.String,
+		URLs:      urls,
+		Options:   options.String,
+		APIKeyId:  apiKeyId.Int64,
+		CreatedOn: createdOn.Time,
+		NextRunOn: nextRunOn.Time,
+		LastRunOn: lastRunOn.Time,
+		LastJobId: common.JobId(lastJobId.Int64),
+	}
+	if disabledOn.Valid {
+		rj.DisabledOn = &disabledOn.Time
+		rj.DisabledReason = disabledReason.String
+	}
+	return rj, nil
+}
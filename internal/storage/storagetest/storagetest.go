@@ -0,0 +1,405 @@
+// Package storagetest is the conformance suite databases backing the storage
+// client must pass to be used by the harvester services. Each database's tests
+// call Run with the configuration of a database the harvester's schema has
+// been created in.
+//
+// The services run concurrently, and retry failed operations, so the suite
+// expects URLs to be unique even when added concurrently, adding pending URLs
+// and results to be idempotent, and operations replacing multiple records to
+// be transactional, so a failed replace leaves the previous records intact.
+package storagetest
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/fault"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Runs the conformance suite against the database of the configuration.
+func Run(t *testing.T, cfg storage.ClientConfig) {
+	sc, err := storage.NewClient(cfg)
+	require.NoError(t, err, "Expect storage client")
+	defer sc.Close()
+
+	// URLs are unique to each run, so runs don't depend on previous runs.
+	prefix := fmt.Sprintf("http://storagetest.example.com/%d", time.Now().UnixNano())
+
+	t.Run("URLUniqueness", func(t *testing.T) { testURLUniqueness(t, sc, prefix) })
+	t.Run("PendingIdempotent", func(t *testing.T) { testPendingIdempotent(t, sc, prefix) })
+	t.Run("ResultIdempotent", func(t *testing.T) { testResultIdempotent(t, sc, prefix) })
+	t.Run("ResultPages", func(t *testing.T) { testResultPages(t, sc, prefix) })
+	t.Run("TransactionalReplace", func(t *testing.T) { testTransactionalReplace(t, sc, cfg, prefix) })
+	t.Run("ActiveJobOverlaps", func(t *testing.T) { testActiveJobOverlaps(t, sc, prefix) })
+	t.Run("APIKeys", func(t *testing.T) { testAPIKeys(t, sc, prefix) })
+	t.Run("IdempotencyKeys", func(t *testing.T) { testIdempotencyKeys(t, sc, prefix) })
+	t.Run("WaitingUrgentJobs", func(t *testing.T) { testWaitingUrgentJobs(t, sc, prefix) })
+}
+
+func testURLUniqueness(t *testing.T, sc *storage.Client, prefix string) {
+	urlClient := sc.URLClient()
+	u := prefix + "/unique"
+
+	first, err := urlClient.GetOrAddURLByURL(u, common.DefaultURLMime)
+	require.NoError(t, err, "Expect URL added")
+	again, err := urlClient.GetOrAddURLByURL(u, common.DefaultURLMime)
+	require.NoError(t, err, "Expect URL found")
+	assert.Equal(t, first.Id, again.Id, "Expect same URL record")
+
+	// Concurrent adds may fail on the unique index, but must never create
+	// more than one record of the URL.
+	u = prefix + "/concurrent"
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		ids = map[common.URLId]struct{}{}
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rec, err := urlClient.Add(u, common.DefaultURLMime); err == nil {
+				mu.Lock()
+				ids[rec.Id] = struct{}{}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	rec, err := urlClient.GetURLByURL(u)
+	require.NoError(t, err, "Expect URL found")
+	require.NotNil(t, rec, "Expect URL added")
+	for id := range ids {
+		assert.Equal(t, rec.Id, id, "Expect concurrent adds to add one record")
+	}
+}
+
+// Creates a job of the URL, returning it.
+func createJob(t *testing.T, sc *storage.Client, u string) *storage.Job {
+	job, err := sc.JobClient().CreateJobFromURLs([]string{u})
+	require.NoError(t, err, "Expect job created")
+	require.Len(t, job.URLs, 1, "Expect job URL")
+	return job
+}
+
+func testPendingIdempotent(t *testing.T, sc *storage.Client, prefix string) {
+	urlClient := sc.URLClient()
+	job := createJob(t, sc, prefix+"/pending")
+	origin := job.URLs[0].URLId
+
+	item := &common.URLQueueItem{JobId: job.Id, OriginId: origin, URLId: origin, ReferId: common.InvalidId, Delta: true, Priority: common.PriorityHigh, MaxLevel: 3}
+	require.NoError(t, urlClient.AddPending(item), "Expect pending added")
+	require.NoError(t, urlClient.AddPending(item), "Expect pending added again")
+
+	pending, err := urlClient.GetPending(job.Id)
+	require.NoError(t, err, "Expect pending")
+	require.Len(t, pending, 1, "Expect one pending URL")
+	assert.Equal(t, *item, *pending[0], "Expect pending item as queued")
+
+	complete, err := urlClient.UpdateJobURLIfComplete(job.Id, origin)
+	require.NoError(t, err, "Expect job URL checked")
+	assert.False(t, complete, "Expect job URL with pending URLs not complete")
+
+	require.NoError(t, urlClient.DeletePending(job.Id, origin, origin), "Expect pending deleted")
+	require.NoError(t, urlClient.DeletePending(job.Id, origin, origin), "Expect pending deleted again")
+
+	complete, err = urlClient.UpdateJobURLIfComplete(job.Id, origin)
+	require.NoError(t, err, "Expect job URL checked")
+	assert.True(t, complete, "Expect job URL without pending URLs complete")
+
+	complete, err = sc.JobClient().IsComplete(job.Id)
+	require.NoError(t, err, "Expect job checked")
+	assert.True(t, complete, "Expect job complete")
+}
+
+func testResultIdempotent(t *testing.T, sc *storage.Client, prefix string) {
+	urlClient := sc.URLClient()
+	job := createJob(t, sc, prefix+"/result")
+	origin := job.URLs[0].URLId
+
+	u := prefix + "/result/child"
+	child, err := urlClient.GetOrAddURLByURL(u, common.DefaultURLMime)
+	require.NoError(t, err, "Expect URL added")
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, urlClient.AddResult(job.Id, origin, child.Id, 1), "Expect result added")
+	}
+
+	results, err := sc.JobClient().Result(job.Id, storage.ResultFilter{})
+	require.NoError(t, err, "Expect job results")
+	assert.Equal(t, common.JobResults{prefix + "/result": []string{u}}, results, "Expect result added once")
+
+	rows := []common.JobResultRow{}
+	err = sc.JobClient().ResultRows(job.Id, storage.ResultFilter{}, func(row common.JobResultRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	require.NoError(t, err, "Expect job result rows")
+	require.Len(t, rows, 1, "Expect result row added once")
+	assert.Equal(t, u, rows[0].URL)
+	assert.Equal(t, prefix+"/result", rows[0].Refer)
+}
+
+func testResultPages(t *testing.T, sc *storage.Client, prefix string) {
+	urlClient := sc.URLClient()
+	job := createJob(t, sc, prefix+"/pages")
+	origin := job.URLs[0].URLId
+
+	expected := []string{}
+	for i := 0; i < 5; i++ {
+		u := fmt.Sprintf("%s/pages/%d", prefix, i)
+		child, err := urlClient.GetOrAddURLByURL(u, common.DefaultURLMime)
+		require.NoError(t, err, "Expect URL added")
+		require.NoError(t, urlClient.AddResult(job.Id, origin, child.Id, 1), "Expect result added")
+		expected = append(expected, u)
+	}
+
+	paged := []string{}
+	var after *common.ResultCursor
+	for pages := 0; ; pages++ {
+		require.True(t, pages < 3, "Expect results in 3 pages")
+		results, next, err := sc.JobClient().ResultPage(job.Id, storage.ResultFilter{}, after, 2)
+		require.NoError(t, err, "Expect page of job results")
+		paged = append(paged, results[prefix+"/pages"]...)
+		if next == nil {
+			break
+		}
+		after = next
+	}
+	sort.Strings(paged)
+	assert.Equal(t, expected, paged, "Expect each result paged once")
+}
+
+func testTransactionalReplace(t *testing.T, sc *storage.Client, cfg storage.ClientConfig, prefix string) {
+	job := createJob(t, sc, prefix+"/transaction")
+
+	// Half of the statements of the faulty client fail, so most replaces
+	// fail part way through their transaction.
+	cfg.Faults = &fault.Config{ErrorRate: 0.5, Seed: 1}
+	faulty, err := storage.NewClient(cfg)
+	require.NoError(t, err, "Expect faulty storage client")
+	defer faulty.Close()
+
+	sets := []*common.JobJSONPaths{
+		{Links: []string{"$.a", "$.b"}, Fields: map[string]string{"a": "$.a", "b": "$.b"}},
+		{Links: []string{"$.c"}, Fields: map[string]string{"c": "$.c", "d": "$.d", "e": "$.e"}},
+	}
+	require.NoError(t, sc.JobClient().SetJSONPaths(job.Id, sets[0]), "Expect paths set")
+
+	failed := 0
+	for i := 0; i < 20; i++ {
+		if err := faulty.JobClient().SetJSONPaths(job.Id, sets[i%2]); err != nil {
+			failed++
+		}
+
+		paths, err := sc.JobClient().JSONPaths(job.Id)
+		require.NoError(t, err, "Expect paths")
+		require.NotNil(t, paths, "Expect paths of job")
+		sort.Strings(paths.Links)
+		assert.True(t, assert.ObjectsAreEqual(sets[0], paths) || assert.ObjectsAreEqual(sets[1], paths),
+			"Expect paths replaced entirely, or not at all, got %v", paths)
+	}
+	assert.True(t, failed > 0, "Expect some replaces to fail")
+}
+
+func testActiveJobOverlaps(t *testing.T, sc *storage.Client, prefix string) {
+	jobClient := sc.JobClient()
+	seeds := []string{prefix + "/overlap/a", prefix + "/overlap/b", prefix + "/overlap/c"}
+
+	active, err := jobClient.CreateJobFromURLs(seeds)
+	require.NoError(t, err, "Expect active job created")
+	cancelled, err := jobClient.CreateJobFromURLs(seeds[:2])
+	require.NoError(t, err, "Expect cancelled job created")
+	_, err = jobClient.Cancel(cancelled.Id)
+	require.NoError(t, err, "Expect job cancelled")
+
+	overlaps, err := jobClient.ActiveJobOverlaps([]string{seeds[0], seeds[1], prefix + "/overlap/new"})
+	require.NoError(t, err, "Expect overlaps")
+	assert.Equal(t, []common.JobOverlap{{JobId: active.Id, Overlapping: 2, Seeds: 3}}, overlaps, "Expect only active job to overlap")
+
+	overlaps, err = jobClient.ActiveJobOverlaps([]string{prefix + "/overlap/none"})
+	require.NoError(t, err, "Expect overlaps")
+	assert.Nil(t, overlaps, "Expect no overlaps")
+}
+
+func testWaitingUrgentJobs(t *testing.T, sc *storage.Client, prefix string) {
+	jobClient := sc.JobClient()
+	job := createJob(t, sc, prefix+"/urgent")
+	origin := job.URLs[0].URLId
+
+	ok, err := jobClient.SetUrgent(job.Id, true)
+	require.NoError(t, err, "Expect job flagged urgent")
+	require.True(t, ok, "Expect job flagged urgent")
+	item := &common.URLQueueItem{JobId: job.Id, OriginId: origin, URLId: origin, ReferId: common.InvalidId}
+	require.NoError(t, sc.URLClient().AddPending(item), "Expect pending added")
+
+	active, err := jobClient.ActiveUrgentJobs()
+	require.NoError(t, err, "Expect active urgent jobs")
+	assert.NotContains(t, active, job.Id, "Expect urgent job waiting for a slot not active")
+
+	position, err := jobClient.QueuePosition(job.Id, time.Now())
+	require.NoError(t, err, "Expect queue position")
+	require.NotNil(t, position, "Expect urgent job waiting")
+	assert.Equal(t, 1, position.Position, "Expect urgent job ahead of the waiting jobs")
+
+	started, err := jobClient.StartWaitingJobs(0, 0)
+	require.NoError(t, err, "Expect waiting jobs started")
+	require.Contains(t, started, job.Id, "Expect urgent job started")
+	assert.Equal(t, job.Id, started[0], "Expect urgent job started first")
+
+	active, err = jobClient.ActiveUrgentJobs()
+	require.NoError(t, err, "Expect active urgent jobs")
+	assert.Contains(t, active, job.Id, "Expect started urgent job active")
+}
+
+func testAPIKeys(t *testing.T, sc *storage.Client, prefix string) {
+	keyClient := sc.APIKeyClient()
+	key := "storagetest-" + prefix
+
+	created, err := keyClient.Create("storagetest", key)
+	require.NoError(t, err, "Expect key created")
+	require.NotNil(t, created, "Expect created key")
+	assert.True(t, created.Enabled, "Expect key created enabled")
+	assert.Equal(t, key[:8], created.Prefix, "Expect key's prefix")
+
+	found, err := keyClient.GetByKey(key)
+	require.NoError(t, err, "Expect key lookup")
+	assert.Equal(t, created, found, "Expect key found by key")
+	found, err = keyClient.Get(created.Id)
+	require.NoError(t, err, "Expect key lookup")
+	assert.Equal(t, created, found, "Expect key found by id")
+
+	disabled, err := keyClient.SetEnabled(created.Id, false)
+	require.NoError(t, err, "Expect key disabled")
+	require.NotNil(t, disabled, "Expect disabled key")
+	assert.False(t, disabled.Enabled, "Expect key disabled")
+
+	// Crawls of jobs scheduled with the key are reported as its usage.
+	job := createJob(t, sc, fmt.Sprintf("http://%s.storagetest.example.com/usage", prefix))
+	require.NoError(t, sc.JobClient().SetAPIKey(job.Id, created.Id), "Expect job's key set")
+	crawledOn := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sc.URLClient().AddCrawlLog(storage.CrawlLogEntry{
+			JobId: job.Id, URLId: job.URLs[0].URLId, Host: "storagetest.example.com",
+			CrawledOn: crawledOn, Status: 200, Bytes: 1024, Duration: 30 * time.Second,
+		}), "Expect crawl logged")
+	}
+	usage, err := keyClient.Usage(created.Id, crawledOn, crawledOn)
+	require.NoError(t, err, "Expect key's usage")
+	assert.Equal(t, []common.APIKeyUsage{{
+		APIKeyId: created.Id, Name: "storagetest", Month: "2015-01", URLs: 2, Bytes: 2048, CrawlMinutes: 1,
+	}}, usage, "Expect key's monthly usage")
+	usage, err = keyClient.Usage(created.Id, crawledOn.AddDate(0, 1, 0), crawledOn.AddDate(0, 2, 0))
+	require.NoError(t, err, "Expect key's usage")
+	assert.Empty(t, usage, "Expect no usage outside of the months")
+
+	// Quotas are replaced when set again, and their usage is of the month.
+	quota := common.APIKeyQuota{APIKeyId: created.Id, URLs: 2, Jobs: 10}
+	require.NoError(t, keyClient.SetQuota(quota), "Expect quota set")
+	quota.Webhook = "https://example.com/quota"
+	require.NoError(t, keyClient.SetQuota(quota), "Expect quota replaced")
+	foundQuota, err := keyClient.GetQuota(created.Id)
+	require.NoError(t, err, "Expect quota")
+	assert.Equal(t, &quota, foundQuota, "Expect replaced quota")
+	quotaUsage, err := keyClient.QuotaUsage(created.Id, crawledOn)
+	require.NoError(t, err, "Expect quota usage")
+	assert.Equal(t, common.APIKeyQuotaUsage{URLs: 2, Bytes: 2048}, quotaUsage, "Expect usage of the month's crawls")
+
+	marked, err := keyClient.MarkQuotaNotified(created.Id, "2015-01", common.QuotaURLs, 80)
+	require.NoError(t, err, "Expect threshold marked")
+	assert.True(t, marked, "Expect threshold marked")
+	marked, err = keyClient.MarkQuotaNotified(created.Id, "2015-01", common.QuotaURLs, 80)
+	require.NoError(t, err, "Expect threshold marked")
+	assert.False(t, marked, "Expect threshold only marked once a month")
+
+	deleted, err := keyClient.DeleteQuota(created.Id)
+	require.NoError(t, err, "Expect quota deleted")
+	assert.True(t, deleted, "Expect quota deleted")
+
+	revoked, err := keyClient.Revoke(created.Id)
+	require.NoError(t, err, "Expect key revoked")
+	assert.True(t, revoked, "Expect key revoked")
+	found, err = keyClient.GetByKey(key)
+	require.NoError(t, err, "Expect key lookup")
+	assert.Nil(t, found, "Expect revoked key not found")
+
+	revoked, err = keyClient.Revoke(created.Id)
+	require.NoError(t, err, "Expect revoke")
+	assert.False(t, revoked, "Expect revoked key not revoked again")
+}
+
+func testIdempotencyKeys(t *testing.T, sc *storage.Client, prefix string) {
+	jobClient := sc.JobClient()
+	key := "storagetest-" + prefix
+
+	_, _, reserved, err := jobClient.ReserveIdempotencyKey("", key, "hash", "a", time.Hour, time.Hour)
+	require.NoError(t, err, "Expect key reserved")
+	assert.True(t, reserved, "Expect key reserved")
+
+	// Keys are reserved once, and pending until completed with their job.
+	id, hash, reserved, err := jobClient.ReserveIdempotencyKey("", key, "other", "b", time.Hour, time.Hour)
+	require.NoError(t, err, "Expect key found")
+	assert.False(t, reserved, "Expect key only reserved once")
+	assert.Equal(t, common.InvalidId, id, "Expect key's job pending")
+	assert.Equal(t, "hash", hash, "Expect key's reserved hash")
+
+	// Keys are only released with the token they were reserved with.
+	require.NoError(t, jobClient.ReleaseIdempotencyKey("", key, "b"), "Expect release ignored")
+	_, _, reserved, err = jobClient.ReserveIdempotencyKey("", key, "hash", "b", time.Hour, time.Hour)
+	require.NoError(t, err, "Expect key found")
+	assert.False(t, reserved, "Expect key not released by another token")
+
+	// Keys are scoped to the principal.
+	_, _, reserved, err = jobClient.ReserveIdempotencyKey("key:1", key, "hash", "c", time.Hour, time.Hour)
+	require.NoError(t, err, "Expect key reserved")
+	assert.True(t, reserved, "Expect key reserved by another principal")
+	require.NoError(t, jobClient.ReleaseIdempotencyKey("key:1", key, "c"), "Expect key released")
+
+	job := createJob(t, sc, fmt.Sprintf("http://%s.storagetest.example.com/idempotent", prefix))
+	require.NoError(t, jobClient.CompleteIdempotencyKey("", key, "a", job.Id), "Expect key completed")
+	require.NoError(t, jobClient.ReleaseIdempotencyKey("", key, "a"), "Expect release ignored")
+	id, _, reserved, err = jobClient.ReserveIdempotencyKey("", key, "hash", "b", time.Hour, time.Millisecond)
+	require.NoError(t, err, "Expect key found")
+	assert.False(t, reserved, "Expect completed key not released, or leased again")
+	assert.Equal(t, job.Id, id, "Expect key's job")
+
+	// Keys reserved longer than the window ago are reserved again.
+	time.Sleep(10 * time.Millisecond)
+	_, _, reserved, err = jobClient.ReserveIdempotencyKey("", key, "hash", "b", time.Millisecond, time.Hour)
+	require.NoError(t, err, "Expect key reserved")
+	assert.True(t, reserved, "Expect expired key reserved again")
+
+	// Keys not completed within their lease are reserved again, and are no
+	// longer completed, or released by the request whose lease ended.
+	time.Sleep(10 * time.Millisecond)
+	_, _, reserved, err = jobClient.ReserveIdempotencyKey("", key, "hash", "c", time.Hour, time.Millisecond)
+	require.NoError(t, err, "Expect key reserved")
+	assert.True(t, reserved, "Expect key of ended lease reserved again")
+	require.NoError(t, jobClient.CompleteIdempotencyKey("", key, "b", job.Id), "Expect complete ignored")
+	require.NoError(t, jobClient.ReleaseIdempotencyKey("", key, "b"), "Expect release ignored")
+	id, _, reserved, err = jobClient.ReserveIdempotencyKey("", key, "hash", "d", time.Hour, time.Hour)
+	require.NoError(t, err, "Expect key found")
+	assert.False(t, reserved, "Expect key still reserved")
+	assert.Equal(t, common.InvalidId, id, "Expect key's job pending")
+	require.NoError(t, jobClient.ReleaseIdempotencyKey("", key, "c"), "Expect key released")
+
+	// Expired keys are removed.
+	_, _, reserved, err = jobClient.ReserveIdempotencyKey("", key, "hash", "e", time.Hour, time.Hour)
+	require.NoError(t, err, "Expect key reserved")
+	assert.True(t, reserved, "Expect released key reserved")
+	time.Sleep(10 * time.Millisecond)
+	n, err := jobClient.ExpireIdempotencyKeys(time.Millisecond)
+	require.NoError(t, err, "Expect keys expired")
+	assert.True(t, n >= 1, "Expect expired key removed")
+	_, _, reserved, err = jobClient.ReserveIdempotencyKey("", key, "other", "f", time.Hour, time.Hour)
+	require.NoError(t, err, "Expect key reserved")
+	assert.True(t, reserved, "Expect removed key reserved")
+	require.NoError(t, jobClient.ReleaseIdempotencyKey("", key, "f"), "Expect key released")
+}
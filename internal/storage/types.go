@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"fmt"
 	"github.com/jasdel/harvester/internal/common"
+	"net/http"
+	"strings"
 	"time"
 )
 
@@ -28,6 +31,17 @@ type URL struct {
 
 	// The time stamp the URL entry was created.
 	CrawledOn time.Time
+
+	// HTTP status code of the response when the URL was crawled. Zero
+	// if the URL hasn't been crawled.
+	Status int
+
+	// Hash of the URL's content when it was last crawled. Empty if the
+	// content wasn't read, or the URL hasn't been crawled.
+	ContentHash string
+
+	// Information extracted from the URL's content when it was crawled.
+	Info common.PageInfo
 }
 
 // Job Entry for the 'job' record. The Job also includes the
@@ -42,12 +56,65 @@ type Job struct {
 
 	// The time stamp the Job was created on.
 	CreatedOn time.Time
+
+	// The time stamp the Job's results were moved to the cold
+	// tier. Zero if the results have not been archived.
+	ArchivedOn time.Time
+
+	// The time stamp the Job was paused on. Zero if the job is not paused.
+	PausedOn time.Time
+
+	// The time stamp the Job was cancelled on. Zero if the job is not cancelled.
+	CancelledOn time.Time
+
+	// The time stamp the Job was started on by the foreman. Zero if the job
+	// is waiting for a running job slot.
+	StartedOn time.Time
+
+	// Hours of the day the job's URLs are allowed to be crawled. Nil if the
+	// job can be crawled at any time.
+	CrawlWindow *common.CrawlWindow
+}
+
+// Settings jobs are created with by CreateJobsFromURLs. The zero value
+// creates jobs without any settings.
+type JobSettings struct {
+	// Hours of the day the jobs' URLs are allowed to be crawled, nil if any time.
+	CrawlWindow *common.CrawlWindow
+
+	// If the main text content of the jobs' crawled pages is extracted
+	ExtractText bool
+
+	// JSONPath expressions, flags, URL patterns, tags, and status code rules
+	// of the jobs, nil if none.
+	JSONPaths   *common.JobJSONPaths
+	Flags       []common.JobFlag
+	URLPatterns []common.JobURLPattern
+	Tags        []string
+	StatusRules []common.JobStatusRule
+
+	// API key the jobs were scheduled with, zero if none.
+	APIKeyId int64
+
+	// Most URLs each of the jobs may crawl, zero if unlimited.
+	MaxURLs int
+
+	// Time after which the jobs' URLs are no longer dispatched, zero if none.
+	Deadline time.Time
+
+	// Scope of the links crawled, one of the JobScope constants. Empty if any.
+	Scope string
+
+	// Query parameters stripped from the links of the jobs' pages, nil if the
+	// default tracking parameters, and if the links' fragments are kept.
+	StripParams   []string
+	KeepFragments bool
 }
 
 // Returns the status of the job.  The status includes the progress
 // of completed vs pending, and total elapsed time.
 func (j *Job) Status() *common.JobStatus {
-	status := &common.JobStatus{Id: j.Id}
+	status := &common.JobStatus{Id: j.Id, Archived: !j.ArchivedOn.IsZero(), Paused: !j.PausedOn.IsZero(), Cancelled: !j.CancelledOn.IsZero(), CrawlWindow: j.CrawlWindow}
 	var compTime time.Time
 	status.URLs = make(map[string]bool)
 	for _, u := range j.URLs {
@@ -66,6 +133,7 @@ func (j *Job) Status() *common.JobStatus {
 		compTime = time.Now().UTC()
 	}
 	status.Elapsed = compTime.Sub(j.CreatedOn)
+	status.Waiting = j.StartedOn.IsZero() && j.CancelledOn.IsZero() && status.Pending != 0
 
 	return status
 }
@@ -89,3 +157,269 @@ type JobURL struct {
 	// The JobId this URL belongs to.
 	JobId common.JobId
 }
+
+// Record of a single request made by a worker while crawling a job.
+type CrawlLogEntry struct {
+	JobId common.JobId
+	URLId common.URLId
+
+	// Lower cased host of the URL, without port
+	Host string
+
+	// When the request was started
+	CrawledOn time.Time
+
+	// HTTP status code of the response. Zero if the request failed.
+	Status int
+
+	// Size of the response body in bytes
+	Bytes int64
+
+	// Time taken to request, and read the response
+	Duration time.Duration
+}
+
+// Crawl a worker skipped before requesting its URL, e.g: disallowed by the
+// host's robots.txt.
+type CrawlSkipEntry struct {
+	JobId common.JobId
+	URLId common.URLId
+
+	// When the crawl was skipped
+	SkippedOn time.Time
+
+	// Why the crawl was skipped, e.g: robots-disallowed
+	Reason string
+}
+
+// HTML content of a crawled URL stored by the workers. Either version
+// may be empty if the workers weren't configured to store it.
+type URLHTML struct {
+	URLId common.URLId
+
+	// HTML as it was received
+	Raw string
+
+	// HTML with scripts and other dangerous content removed, safe to render
+	Sanitized string
+
+	// When the HTML was stored
+	StoredOn time.Time
+}
+
+// Main text content extracted from a crawled URL's HTML, without the page's
+// navigation, footer, and other boilerplate.
+type URLText struct {
+	URLId common.URLId
+
+	// Title of the page, empty if none
+	Title string
+
+	// Paragraphs of the page's main content, separated by blank lines
+	Text string
+
+	// When the text was stored
+	StoredOn time.Time
+}
+
+// Embedding vector of a chunk of a URL's main text content.
+type URLEmbedding struct {
+	URLId common.URLId
+
+	// Index of the chunk within the URL's text, and its text
+	Chunk int
+	Text  string
+
+	// Approximate number of tokens of the chunk's text
+	Tokens int
+
+	// Model the vector was embedded with
+	Model  string
+	Vector []float32
+
+	// When the vector was stored
+	StoredOn time.Time
+}
+
+// Embedding vector of a chunk of a job's page, with the page's URL, and title.
+type PageEmbedding struct {
+	URL string
+
+	// Title of the page, empty if none
+	Title string
+
+	Embedding URLEmbedding
+}
+
+// Metrics of the requests a job made to a host within a period.
+type JobHostMetrics struct {
+	JobId   common.JobId
+	Metrics common.HostMetrics
+}
+
+// Redirect found in the content of a URL a job crawled, from the URL's host to
+// the target URL.
+type HostRedirect struct {
+	JobId  common.JobId
+	Host   string
+	Target string
+}
+
+// Main text content extracted from a URL of a job.
+type TextPage struct {
+	URL string
+
+	// Title of the page, empty if none
+	Title string
+
+	// Paragraphs of the page's main content, separated by blank lines
+	Text string
+
+	// When the text was stored
+	StoredOn time.Time
+}
+
+// Raw HTML stored for a URL of a job, with the state the URL was crawled in.
+type StoredPage struct {
+	URL string
+
+	// HTTP status code, and mime type the URL was crawled with
+	Status int
+	Mime   string
+
+	// HTML as it was received, and when it was stored
+	Raw      string
+	StoredOn time.Time
+}
+
+// Response stored in the shared fetch cache.
+type CachedResponse struct {
+	// Hash of the request's URL and headers the response is cached under
+	Key string
+
+	// URL the response was fetched from
+	URL string
+
+	// HTTP status code, and headers of the response
+	Status int
+	Header http.Header
+
+	// Response body
+	Body []byte
+
+	// When the response was fetched
+	FetchedOn time.Time
+}
+
+// Filter applied when querying for URL records. Zero value fields
+// are not filtered on.
+type URLFilter struct {
+	// HTTP status code the URL was crawled with
+	Status int
+
+	// Prefix of the URL's mime type, e.g: "image"
+	Mime string
+}
+
+// Returns the SQL conditions of the filter prefixed with AND, and the arguments
+// appended to the query's existing arguments. The placeholders of the conditions
+// are numbered after the existing arguments.
+func (f URLFilter) where(args []interface{}) (string, []interface{}) {
+	cond := ""
+	if f.Status != 0 {
+		args = append(args, f.Status)
+		cond += fmt.Sprintf(" AND url.status = $%d", len(args))
+	}
+	if f.Mime != "" {
+		args = append(args, f.Mime+"%")
+		cond += fmt.Sprintf(" AND url.mime LIKE $%d", len(args))
+	}
+	return cond, args
+}
+
+// Filter applied when querying a job's results. Zero value fields are not
+// filtered on, except for the mime, which always excludes results whose
+// content type isn't known.
+type ResultFilter struct {
+	// Prefix of the result URL's mime type, e.g: "image"
+	Mime string
+
+	// HTTP status code the result URL was crawled with, e.g: 404
+	Status int
+
+	// Host of the result URL, including its sub domains, e.g: example.com
+	// also matches www.example.com
+	Domain string
+
+	// Tag the result was classified with, e.g: product
+	Tag string
+
+	// Name of the job's flag the result's content matched
+	Flag string
+}
+
+// Returns the SQL conditions of the filter on the job_result, and its url
+// prefixed with AND, and the arguments appended to the query's existing
+// arguments. The placeholders of the conditions are numbered after the
+// existing arguments.
+func (f ResultFilter) where(args []interface{}) (string, []interface{}) {
+	args = append(args, f.Mime+"%")
+	cond := fmt.Sprintf(" AND url.mime LIKE $%d", len(args))
+	if f.Status != 0 {
+		args = append(args, f.Status)
+		cond += fmt.Sprintf(" AND url.status = $%d", len(args))
+	}
+	if f.Domain != "" {
+		domain := strings.ToLower(f.Domain)
+		args = append(args, domain, "%."+likeEscaper.Replace(domain))
+		cond += fmt.Sprintf(" AND (%s = $%d OR %s LIKE $%d)", urlHostSQL, len(args)-1, urlHostSQL, len(args))
+	}
+	if f.Tag != "" {
+		args = append(args, strings.ToLower(f.Tag))
+		cond += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM url_tag WHERE url_tag.url_id = url.id AND url_tag.tag = $%d)", len(args))
+	}
+	if f.Flag != "" {
+		args = append(args, strings.ToLower(f.Flag))
+		cond += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM job_url_flag WHERE job_url_flag.job_id = job_result.job_id AND job_url_flag.url_id = url.id AND job_url_flag.name = $%d)", len(args))
+	}
+	return cond, args
+}
+
+// Filter applied when listing jobs. Zero value fields are not filtered on.
+type JobListFilter struct {
+	// State of the job, one of the common.JobStatus constants
+	Status string
+
+	// Jobs created after the time
+	CreatedAfter time.Time
+
+	// Tags the job was scheduled with. Jobs must have all of the tags.
+	Tags []string
+}
+
+// Returns the SQL conditions of the filter on the job's columns prefixed with
+// AND, and the arguments appended to the query's existing arguments. The
+// placeholders of the conditions are numbered after the existing arguments.
+func (f JobListFilter) where(args []interface{}) (string, []interface{}) {
+	cond := ""
+	if !f.CreatedAfter.IsZero() {
+		args = append(args, f.CreatedAfter)
+		cond += fmt.Sprintf(" AND job.created_on > $%d", len(args))
+	}
+	for _, tag := range f.Tags {
+		args = append(args, tag)
+		cond += fmt.Sprintf(" AND EXISTS (SELECT 1 FROM job_tag WHERE job_tag.job_id = job.id AND job_tag.tag = $%d)", len(args))
+	}
+	return cond, args
+}
+
+// Returns the HAVING clause of the filter on the job's aggregated state, and
+// the arguments appended to the query's existing arguments. Empty if the
+// filter has no state.
+func (f JobListFilter) having(args []interface{}) (string, []interface{}) {
+	if f.Status == "" {
+		return "", args
+	}
+	args = append(args, f.Status)
+	return fmt.Sprintf("\nHAVING %s = $%d", queryJobSummaryStatus, len(args)), args
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLFilterWhere(t *testing.T) {
+	cond, args := URLFilter{}.where([]interface{}{1})
+	assert.Equal(t, "", cond, "Expect no conditions")
+	assert.Equal(t, []interface{}{1}, args, "Expect args unchanged")
+
+	cond, args = URLFilter{Status: 404, Mime: "text"}.where([]interface{}{1})
+	assert.Equal(t, " AND url.status = $2 AND url.mime LIKE $3", cond, "Expect conditions")
+	assert.Equal(t, []interface{}{1, 404, "text%"}, args, "Expect args appended")
+}
+
+func TestResultFilterWhere(t *testing.T) {
+	cond, args := ResultFilter{}.where([]interface{}{1})
+	assert.Equal(t, " AND url.mime LIKE $2", cond, "Expect only results with mimes")
+	assert.Equal(t, []interface{}{1, "%"}, args, "Expect args appended")
+
+	cond, args = ResultFilter{Mime: "image", Status: 404, Domain: "Example_1.com", Tag: "Product", Flag: "Recall"}.where([]interface{}{1})
+	assert.Equal(t, " AND url.mime LIKE $2 AND url.status = $3"+
+		" AND ("+urlHostSQL+" = $4 OR "+urlHostSQL+" LIKE $5)"+
+		" AND EXISTS (SELECT 1 FROM url_tag WHERE url_tag.url_id = url.id AND url_tag.tag = $6)"+
+		" AND EXISTS (SELECT 1 FROM job_url_flag WHERE job_url_flag.job_id = job_result.job_id AND job_url_flag.url_id = url.id AND job_url_flag.name = $7)", cond, "Expect conditions")
+	assert.Equal(t, []interface{}{1, "image%", 404, "example_1.com", `%.example\_1.com`, "product", "recall"}, args, "Expect args appended")
+}
+
+func TestJobStatusPausedArchived(t *testing.T) {
+	job := &Job{URLs: []JobURL{{URL: "http://example.com"}}}
+	status := job.Status()
+	assert.False(t, status.Paused, "Expect job not paused")
+	assert.False(t, status.Archived, "Expect job not archived")
+
+	job.PausedOn = job.CreatedOn.AddDate(0, 0, 1)
+	job.ArchivedOn = job.PausedOn
+	status = job.Status()
+	assert.True(t, status.Paused, "Expect job paused")
+	assert.True(t, status.Archived, "Expect job archived")
+	assert.Equal(t, 1, status.Pending, "Expect pending URL")
+}
+
+func TestJobStatusWaiting(t *testing.T) {
+	job := &Job{URLs: []JobURL{{URL: "http://example.com"}}}
+	assert.True(t, job.Status().Waiting, "Expect job waiting until started")
+
+	job.StartedOn = job.CreatedOn.Add(time.Minute)
+	assert.False(t, job.Status().Waiting, "Expect started job not waiting")
+
+	job = &Job{URLs: []JobURL{{URL: "http://example.com", Completed: true}}}
+	assert.False(t, job.Status().Waiting, "Expect completed job not waiting")
+}
+
+func TestJobListFilter(t *testing.T) {
+	where, args := JobListFilter{}.where(nil)
+	assert.Equal(t, "", where, "Expect no conditions")
+	having, args := JobListFilter{}.having(args)
+	assert.Equal(t, "", having, "Expect no having")
+	assert.Empty(t, args, "Expect no args")
+
+	after := time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC)
+	filter := JobListFilter{Status: common.JobStatusPaused, CreatedAfter: after, Tags: []string{"seo", "client-a"}}
+	where, args = filter.where(nil)
+	assert.Equal(t, " AND job.created_on > $1"+
+		" AND EXISTS (SELECT 1 FROM job_tag WHERE job_tag.job_id = job.id AND job_tag.tag = $2)"+
+		" AND EXISTS (SELECT 1 FROM job_tag WHERE job_tag.job_id = job.id AND job_tag.tag = $3)", where, "Expect conditions of each tag")
+	having, args = filter.having(args)
+	assert.True(t, strings.HasPrefix(having, "\nHAVING CASE"), "Expect having status")
+	assert.True(t, strings.HasSuffix(having, " END = $4"), "Expect status placeholder after conditions")
+	assert.Equal(t, []interface{}{after, "seo", "client-a", common.JobStatusPaused}, args, "Expect args appended")
+}
@@ -18,7 +18,7 @@ type URLClient struct {
 // Requests a URL record by Id.
 // If no URL is found, nil will be returned for the URL
 func (u *URLClient) GetURLById(id common.URLId) (*URL, error) {
-	const queryURLById = `SELECT id,url,mime,crawled_on FROM url WHERE id = $1`
+	const queryURLById = `SELECT ` + urlColumns + ` FROM url WHERE id = $1`
 	return getURLFromRow(u.client.db.QueryRow(queryURLById, id))
 
 }
@@ -26,7 +26,7 @@ func (u *URLClient) GetURLById(id common.URLId) (*URL, error) {
 // Requests a URL record for the URL by URL string value.
 // If no URL is found, nil will be returned for the URL
 func (u *URLClient) GetURLByURL(url string) (*URL, error) {
-	const queryURLByName = `SELECT id,url,mime,crawled_on FROM url WHERE url = $1`
+	const queryURLByName = `SELECT ` + urlColumns + ` FROM url WHERE url = $1`
 	return getURLFromRow(u.client.db.QueryRow(queryURLByName, url))
 }
 
@@ -52,7 +52,7 @@ func (u *URLClient) GetOrAddURLByURL(urlStr, mime string) (*URL, error) {
 // will be the 'refer' value for each of the returned URLs, if there are any.
 func (u *URLClient) GetAllURLsWithReferById(referId common.URLId) ([]*URL, error) {
 	const queryAllURLsWithRefer = `
-SELECT url.id, url.url, url.mime, url.crawled_on
+SELECT ` + urlColumns + `
 FROM url_link
 LEFT JOIN url on url_link.url_id = url.id
 WHERE url_link.refer_id = $1`
@@ -79,6 +79,83 @@ WHERE url_link.refer_id = $1`
 	return urls, nil
 }
 
+// Returns a page of the URLs which the refer URL links to, filtered by the
+// filter, up to the limit of URLs, continuing from the cursor. A nil cursor
+// returns the first page. The cursor of the next page is returned, nil if
+// this is the last page.
+func (u *URLClient) GetLinkedURLs(referId common.URLId, filter URLFilter, after *common.URLCursor, limit int) ([]*URL, *common.URLCursor, error) {
+	const queryLinkedURLs = `
+SELECT ` + urlColumns + `
+FROM url_link
+JOIN url on url_link.url_id = url.id
+WHERE url_link.refer_id = $1`
+
+	cond, args := filter.where([]interface{}{referId})
+	return u.queryURLPage(queryLinkedURLs+cond, args, after, limit)
+}
+
+// Returns a page of the URLs which link to the URL, filtered by the filter,
+// the same as GetLinkedURLs.
+func (u *URLClient) GetReferringURLs(urlId common.URLId, filter URLFilter, after *common.URLCursor, limit int) ([]*URL, *common.URLCursor, error) {
+	const queryReferringURLs = `
+SELECT ` + urlColumns + `
+FROM url_link
+JOIN url on url_link.refer_id = url.id
+WHERE url_link.url_id = $1`
+
+	cond, args := filter.where([]interface{}{urlId})
+	return u.queryURLPage(queryReferringURLs+cond, args, after, limit)
+}
+
+// Queries a page of URLs in the order of their id, up to the limit of URLs,
+// continuing from the cursor. The query is expected to select the urlColumns,
+// and end with its WHERE conditions. The cursor of the next page is returned,
+// nil if this is the last page.
+func (u *URLClient) queryURLPage(query string, args []interface{}, after *common.URLCursor, limit int) ([]*URL, *common.URLCursor, error) {
+	if after != nil {
+		args = append(args, after.URLId)
+		query += fmt.Sprintf(" AND url.id > $%d", len(args))
+	}
+	// One more URL than the limit is selected to know if there is a next
+	// page.
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" ORDER BY url.id LIMIT $%d", len(args))
+
+	urls, err := u.queryURLs(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(urls) > limit {
+		next := common.URLCursor{URLId: urls[limit-1].Id}
+		return urls[:limit], &next, nil
+	}
+	return urls, nil, nil
+}
+
+// Queries for a list of URLs. The query is expected to select the urlColumns.
+func (u *URLClient) queryURLs(query string, args ...interface{}) ([]*URL, error) {
+	rows, err := u.client.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []*URL{}
+	for rows.Next() {
+		url, err := getURLFromRows(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
 // Adds a new URL to the database returning a URL object for it.
 // If no mime is known us common.DefaultMime in its place.
 func (u *URLClient) Add(url, mime string) (*URL, error) {
@@ -128,31 +205,274 @@ INSERT INTO url_link (url_id, refer_id)
 	return nil
 }
 
-// Updates the mime content-type of a preexisting URL.
-func (u *URLClient) MarkCrawled(urlId common.URLId, mime string) error {
-	const queryURLUpdateMime = `UPDATE url SET mime = $1, crawled_on = $2 WHERE id = $3`
+// Records that the URL's content redirects to the target URL. If the redirect
+// is already known, the insert statement will be ignored.
+func (u *URLClient) AddRedirect(urlId, targetId common.URLId, kind string) error {
+	const queryURLInsertRedirect = `
+INSERT INTO url_redirect (url_id, target_id, kind)
+	SELECT $1, $2, $3
+	WHERE NOT EXISTS (SELECT 1 FROM url_redirect WHERE url_id = $1 AND target_id = $2 AND kind = $3)`
+
+	if _, err := u.client.db.Exec(queryURLInsertRedirect, urlId, targetId, kind); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Records the target URL as an alternate representation of the URL, e.g: an AMP
+// variant. The language is only stored for language alternates. If the alternate
+// is already known, the insert statement will be ignored.
+func (u *URLClient) AddAlternate(urlId, targetId common.URLId, kind, lang string) error {
+	const queryURLInsertAlternate = `
+INSERT INTO url_alternate (url_id, target_id, kind, lang)
+	SELECT $1, $2, $3, $4
+	WHERE NOT EXISTS (SELECT 1 FROM url_alternate WHERE url_id = $1 AND target_id = $2 AND kind = $3)`
+
+	nullLang := sql.NullString{String: lang, Valid: lang != ""}
+	if _, err := u.client.db.Exec(queryURLInsertAlternate, urlId, targetId, kind, nullLang); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the ids of the URLs which are alternate representations of the URL.
+func (u *URLClient) GetAlternateIds(urlId common.URLId) ([]common.URLId, error) {
+	const queryURLAlternateIds = `SELECT DISTINCT target_id FROM url_alternate WHERE url_id = $1`
+
+	rows, err := u.client.db.Query(queryURLAlternateIds, urlId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []common.URLId{}
+	for rows.Next() {
+		var id sql.NullInt64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, common.URLId(id.Int64))
+	}
+	return ids, rows.Err()
+}
+
+// Updates the mime content-type, response status code, and content hash of a
+// preexisting URL. An empty content hash is stored as null.
+func (u *URLClient) MarkCrawled(urlId common.URLId, mime string, status int, contentHash string) error {
+	const queryURLUpdateMime = `UPDATE url SET mime = $1, crawled_on = $2, status = $3, content_hash = $4 WHERE id = $5`
 
 	crawledOn := time.Now().UTC()
-	if _, err := u.client.db.Exec(queryURLUpdateMime, mime, crawledOn, urlId); err != nil {
+	hash := sql.NullString{String: contentHash, Valid: contentHash != ""}
+	if _, err := u.client.db.Exec(queryURLUpdateMime, mime, crawledOn, status, hash, urlId); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Updates the information extracted from a crawled URL's content. Zero
+// dates will be stored as null.
+func (u *URLClient) UpdatePageInfo(urlId common.URLId, info common.PageInfo) error {
+	const queryURLUpdatePageInfo = `
+UPDATE url SET published_on = $1, modified_on = $2, word_count = $3, title = $4, description = $5, h1 = $6
+	WHERE id = $7`
+
+	publishedOn := pq.NullTime{Time: info.PublishedOn, Valid: !info.PublishedOn.IsZero()}
+	modifiedOn := pq.NullTime{Time: info.ModifiedOn, Valid: !info.ModifiedOn.IsZero()}
+	if _, err := u.client.db.Exec(queryURLUpdatePageInfo, publishedOn, modifiedOn, info.WordCount,
+		info.Title, info.Description, info.H1, urlId); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Adds the URL as pending under a origin URL and job Id. If the record already exists the
-// insert statement will be ignored.
-func (u *URLClient) AddPending(jobId common.JobId, urlId, originId common.URLId) error {
+// Records a request made while crawling in the crawl log.
+func (u *URLClient) AddCrawlLog(entry CrawlLogEntry) error {
+	const queryAddCrawlLog = `
+INSERT INTO crawl_log (job_id, url_id, host, crawled_on, status, bytes, duration_ms)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	status := sql.NullInt64{Int64: int64(entry.Status), Valid: entry.Status != 0}
+	if _, err := u.client.db.Exec(queryAddCrawlLog, entry.JobId, entry.URLId, entry.Host, entry.CrawledOn,
+		status, entry.Bytes, int64(entry.Duration/time.Millisecond)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Stores the URL's HTML content, replacing any previously stored, or tiered
+// into the cold store. Empty versions of the HTML are stored as null.
+func (u *URLClient) StoreHTML(h URLHTML) error {
+	const queryStoreHTML = `
+WITH s AS (
+    UPDATE url_html SET raw = $2, sanitized = $3, stored_on = $4, raw_tiered = FALSE, sanitized_tiered = FALSE
+    WHERE url_id = $1
+    RETURNING url_id
+)
+INSERT INTO url_html (url_id, raw, sanitized, stored_on)
+    SELECT $1, $2, $3, $4
+    WHERE NOT EXISTS (SELECT 1 FROM s)`
+
+	raw := sql.NullString{String: h.Raw, Valid: h.Raw != ""}
+	sanitized := sql.NullString{String: h.Sanitized, Valid: h.Sanitized != ""}
+	if _, err := u.client.db.Exec(queryStoreHTML, h.URLId, raw, sanitized, h.StoredOn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Requests the HTML content stored for the URL. HTML tiered into the cold
+// store is read from it. If no HTML is stored nil will be returned.
+func (u *URLClient) GetHTML(urlId common.URLId) (*URLHTML, error) {
+	const queryGetHTML = `SELECT raw, sanitized, raw_tiered, sanitized_tiered, stored_on FROM url_html WHERE url_id = $1`
+
+	var (
+		raw, sanitized             sql.NullString
+		rawTiered, sanitizedTiered bool
+		storedOn                   pq.NullTime
+	)
+	if err := u.client.db.QueryRow(queryGetHTML, urlId).Scan(&raw, &sanitized, &rawTiered, &sanitizedTiered, &storedOn); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	h := &URLHTML{URLId: urlId, StoredOn: storedOn.Time}
+	var err error
+	if h.Raw, err = u.client.tieredHTML(urlId, "raw", raw, rawTiered); err != nil {
+		return nil, err
+	}
+	if h.Sanitized, err = u.client.tieredHTML(urlId, "sanitized", sanitized, sanitizedTiered); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// Returns the set of the URLs which have sanitized HTML stored. URLs which
+// are unknown, or have no sanitized HTML stored are not included.
+func (u *URLClient) HTMLStored(urls []string) (map[string]bool, error) {
+	const queryHTMLStored = `
+SELECT url.url FROM url
+JOIN url_html ON url_html.url_id = url.id
+WHERE url.url = ANY($1) AND (url_html.sanitized IS NOT NULL OR url_html.sanitized_tiered)`
+
+	stored := map[string]bool{}
+	if len(urls) == 0 {
+		return stored, nil
+	}
+
+	rows, err := u.client.db.Query(queryHTMLStored, pq.Array(urls))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var storedURL sql.NullString
+		if err := rows.Scan(&storedURL); err != nil {
+			return nil, err
+		}
+		stored[storedURL.String] = true
+	}
+	return stored, rows.Err()
+}
+
+// Adds the queued item's URL as pending under its origin URL and job Id. The item is
+// stored so it can be re-queued if the job is resumed. If the record already exists
+// the insert statement will be ignored.
+func (u *URLClient) AddPending(item *common.URLQueueItem) error {
 	const queryURLAddPending = `
-INSERT INTO url_pending (job_id, url_id, origin_id)
-	SELECT $1, $2, $3
+INSERT INTO url_pending (job_id, url_id, origin_id, refer_id, level, force_crawl, delta, no_fetch_cache, skip_alternates, download, priority, max_level)
+	SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
 	WHERE NOT EXISTS (SELECT 1 FROM url_pending WHERE job_id = $1 AND url_id = $2 AND origin_id = $3)`
 
-	if _, err := u.client.db.Exec(queryURLAddPending, jobId, urlId, originId); err != nil {
+	referId := sql.NullInt64{Int64: int64(item.ReferId), Valid: item.ReferId != common.InvalidId}
+	if _, err := u.client.db.Exec(queryURLAddPending, item.JobId, item.URLId, item.OriginId,
+		referId, item.Level, item.ForceCrawl, item.Delta, item.NoFetchCache, item.SkipAlternates, item.Download, item.Priority, item.MaxLevel); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns the job's pending URLs as the queue items they were queued with.
+func (u *URLClient) GetPending(jobId common.JobId) ([]*common.URLQueueItem, error) {
+	const queryURLGetPending = `
+SELECT origin_id, url_id, refer_id, level, force_crawl, delta, no_fetch_cache, skip_alternates, download, priority, max_level
+FROM url_pending WHERE job_id = $1`
+
+	return u.pendingItems(queryURLGetPending, jobId)
+}
+
+// Parks the pending URL of a job outside of its crawl window. Parked URLs remain
+// pending, and are re-queued once the job's crawl window opens.
+func (u *URLClient) ParkPending(item *common.URLQueueItem) error {
+	const queryURLParkPending = `
+UPDATE url_pending SET parked_on = $4
+WHERE job_id = $1 AND url_id = $2 AND origin_id = $3 AND parked_on IS NULL`
+
+	if _, err := u.client.db.Exec(queryURLParkPending, item.JobId, item.URLId, item.OriginId, time.Now().UTC()); err != nil {
 		return err
 	}
 	return nil
 }
 
+// Unparks the job's parked pending URLs, returning them as the queue items they
+// were queued with so they can be re-queued.
+func (u *URLClient) UnparkPending(jobId common.JobId) ([]*common.URLQueueItem, error) {
+	const queryURLUnparkPending = `
+UPDATE url_pending SET parked_on = NULL
+WHERE job_id = $1 AND parked_on IS NOT NULL
+RETURNING origin_id, url_id, refer_id, level, force_crawl, delta, no_fetch_cache, skip_alternates, download, priority, max_level`
+
+	return u.pendingItems(queryURLUnparkPending, jobId)
+}
+
+// Returns the job's pending URLs selected by the query as queue items.
+// Expects the query columns to be in the order of:
+// 		origin_id, url_id, refer_id, level, force_crawl, delta, no_fetch_cache, skip_alternates, download, priority, max_level
+func (u *URLClient) pendingItems(query string, jobId common.JobId) ([]*common.URLQueueItem, error) {
+	rows, err := u.client.db.Query(query, jobId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*common.URLQueueItem{}
+	for rows.Next() {
+		var (
+			originId, urlId, referId, level sql.NullInt64
+			priority, maxLevel              sql.NullInt64
+			forceCrawl, delta, noFetchCache sql.NullBool
+			skipAlternates, download        sql.NullBool
+		)
+		if err := rows.Scan(&originId, &urlId, &referId, &level, &forceCrawl, &delta, &noFetchCache, &skipAlternates, &download, &priority, &maxLevel); err != nil {
+			return nil, err
+		}
+		if !originId.Valid || !urlId.Valid {
+			return nil, fmt.Errorf("Invalid pending URL result for job %d", jobId)
+		}
+
+		item := &common.URLQueueItem{
+			JobId:          jobId,
+			OriginId:       common.URLId(originId.Int64),
+			URLId:          common.URLId(urlId.Int64),
+			ReferId:        common.InvalidId,
+			Level:          int(level.Int64),
+			ForceCrawl:     forceCrawl.Bool,
+			Delta:          delta.Bool,
+			NoFetchCache:   noFetchCache.Bool,
+			SkipAlternates: skipAlternates.Bool,
+			Download:       download.Bool,
+			Priority:       int(priority.Int64),
+			MaxLevel:       int(maxLevel.Int64),
+		}
+		if referId.Valid {
+			item.ReferId = common.URLId(referId.Int64)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
 // Deletes a pending record for a URL that no longer needs be crawled. The pending
 // record is a combination of job + url + origin, where origin is the origin URL the Job was
 // created with.
@@ -177,24 +497,25 @@ func (u *URLClient) HasPending(jobId common.JobId, originId common.URLId) (bool,
 	return pending.Valid && pending.Bool, nil
 }
 
-// Records a new crawled URL into the job results, for a specific jobId. If the result record
-// already exists, the insert statement will be ignored.
-func (u *URLClient) AddResult(jobId common.JobId, referId, urlId common.URLId) error {
+// Records a new crawled URL into the job results, for a specific jobId. The level is the
+// recursive distance of the URL from the Job URL. If the result record already exists,
+// the insert statement will be ignored.
+func (u *URLClient) AddResult(jobId common.JobId, referId, urlId common.URLId, level int) error {
 	const queryURLInsertResult = `
-INSERT INTO job_result (job_id, refer_id, url_id)
-	SELECT $1, $2, $3
+INSERT INTO job_result (job_id, refer_id, url_id, level)
+	SELECT $1, $2, $3, $4
 	WHERE NOT EXISTS (SELECT 1 FROM job_result WHERE job_id = $1 AND refer_id = $2 AND url_id = $3)`
 
-	if _, err := u.client.db.Exec(queryURLInsertResult, jobId, referId, urlId); err != nil {
+	if _, err := u.client.db.Exec(queryURLInsertResult, jobId, referId, urlId, level); err != nil {
 		return err
 	}
 	return nil
 }
 
-// Adds a batch of URLs to the job results. Will update the job result for each job Id provided
-func (u *URLClient) AddURLsToResults(jobId common.JobId, referId common.URLId, urls []*URL) error {
+// Adds a batch of URLs to the job results at the level. Will update the job result for each job Id provided
+func (u *URLClient) AddURLsToResults(jobId common.JobId, referId common.URLId, urls []*URL, level int) error {
 	for _, url := range urls {
-		if err := u.AddResult(jobId, referId, url.Id); err != nil {
+		if err := u.AddResult(jobId, referId, url.Id, level); err != nil {
 			return err
 		}
 	}
@@ -229,49 +550,47 @@ func (u *URLClient) UpdateJobURLIfComplete(jobId common.JobId, urlId common.URLI
 	return false, nil
 }
 
+// Columns of the url table selected when querying URL records. Queries selecting
+// these columns can use getURLFromRow and getURLFromRows to extract the URL.
+const urlColumns = `url.id, url.url, url.mime, url.crawled_on, url.status,
+	url.published_on, url.modified_on, url.word_count, url.title, url.description, url.h1,
+	url.content_hash`
+
 // Extracts the URL from a QueryRow row. If no URL is found, nil will be returned for the URL
-// Expects the query columns to be the following order:
-//		id, url, mime, crawled_on
+// Expects the query columns to be the urlColumns
 func getURLFromRow(row *sql.Row) (*URL, error) {
-	var (
-		id        sql.NullInt64
-		url       sql.NullString
-		mime      sql.NullString
-		crawledOn pq.NullTime
-	)
-
-	if err := row.Scan(&id, &url, &mime, &crawledOn); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, nil
-		}
-		return nil, err
+	url, err := scanURL(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
 	}
-
-	if !id.Valid || !url.Valid {
-		return nil, fmt.Errorf("Invalid URL result from QueryRow scan")
-	}
-
-	return &URL{
-		Id:        common.URLId(id.Int64),
-		URL:       url.String,
-		Mime:      mime.String,
-		Crawled:   crawledOn.Valid,
-		CrawledOn: crawledOn.Time,
-	}, nil
+	return url, err
 }
 
-// Extracts the URL fields from a Query rows. If no URL is found, nil will be returned for the URL
-// Expects the query columns to be the following order:
-//		id, url, mime, crawled_on
+// Extracts the URL fields from a Query rows.
+// Expects the query columns to be the urlColumns
 func getURLFromRows(rows *sql.Rows) (*URL, error) {
+	return scanURL(rows.Scan)
+}
+
+// Scans the urlColumns into a URL with the scan function provided.
+func scanURL(scan func(dest ...interface{}) error) (*URL, error) {
 	var (
-		id        sql.NullInt64
-		url       sql.NullString
-		mime      sql.NullString
-		crawledOn pq.NullTime
+		id          sql.NullInt64
+		url         sql.NullString
+		mime        sql.NullString
+		crawledOn   pq.NullTime
+		status      sql.NullInt64
+		publishedOn pq.NullTime
+		modifiedOn  pq.NullTime
+		wordCount   sql.NullInt64
+		title       sql.NullString
+		description sql.NullString
+		h1          sql.NullString
+		contentHash sql.NullString
 	)
 
-	if err := rows.Scan(&id, &url, &mime, &crawledOn); err != nil {
+	if err := scan(&id, &url, &mime, &crawledOn, &status,
+		&publishedOn, &modifiedOn, &wordCount, &title, &description, &h1, &contentHash); err != nil {
 		return nil, err
 	}
 
@@ -280,10 +599,20 @@ func getURLFromRows(rows *sql.Rows) (*URL, error) {
 	}
 
 	return &URL{
-		Id:        common.URLId(id.Int64),
-		URL:       url.String,
-		Mime:      mime.String,
-		Crawled:   crawledOn.Valid,
-		CrawledOn: crawledOn.Time,
+		Id:          common.URLId(id.Int64),
+		URL:         url.String,
+		Mime:        mime.String,
+		Crawled:     crawledOn.Valid,
+		CrawledOn:   crawledOn.Time,
+		Status:      int(status.Int64),
+		ContentHash: contentHash.String,
+		Info: common.PageInfo{
+			PublishedOn: publishedOn.Time,
+			ModifiedOn:  modifiedOn.Time,
+			WordCount:   int(wordCount.Int64),
+			Title:       title.String,
+			Description: description.String,
+			H1:          h1.String,
+		},
 	}, nil
 }
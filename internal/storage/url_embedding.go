@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Stores the embedding vectors of the chunks of the URL's main text, replacing
+// all previously stored for the URL, so no vectors remain of chunks the text
+// no longer has.
+func (u *URLClient) StoreEmbeddings(urlId common.URLId, embeddings []URLEmbedding) error {
+	const queryDeleteEmbeddings = `DELETE FROM url_embedding WHERE url_id = $1`
+	const queryStoreEmbedding = `
+INSERT INTO url_embedding (url_id, chunk, text, tokens, model, vector, stored_on)
+VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	tx, err := u.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(queryDeleteEmbeddings, urlId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, e := range embeddings {
+		if _, err := tx.Exec(queryStoreEmbedding, urlId, e.Chunk, e.Text, e.Tokens, e.Model, pq.Array(e.Vector), e.StoredOn); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Requests the embedding vectors of the chunks of the URL's main text, ordered
+// by chunk. If no vectors are stored an empty list will be returned.
+func (u *URLClient) GetEmbeddings(urlId common.URLId) ([]URLEmbedding, error) {
+	const queryGetEmbeddings = `
+SELECT chunk, text, tokens, model, vector, stored_on FROM url_embedding
+WHERE url_id = $1
+ORDER BY chunk`
+
+	rows, err := u.client.db.Query(queryGetEmbeddings, urlId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	embeddings := []URLEmbedding{}
+	for rows.Next() {
+		var (
+			chunk, tokens sql.NullInt64
+			text, model   sql.NullString
+			vector        []float32
+			storedOn      pq.NullTime
+		)
+		if err := rows.Scan(&chunk, &text, &tokens, &model, pq.Array(&vector), &storedOn); err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, URLEmbedding{
+			URLId:    urlId,
+			Chunk:    int(chunk.Int64),
+			Text:     text.String,
+			Tokens:   int(tokens.Int64),
+			Model:    model.String,
+			Vector:   vector,
+			StoredOn: storedOn.Time,
+		})
+	}
+	return embeddings, rows.Err()
+}
+
+// Calls fn with the embedding vector of each chunk of the job's pages embedded
+// with the model, ordered by URL id, and chunk, as they are read from the
+// database, so the vectors of large jobs can be compared without being held in
+// memory. If fn returns an error no more vectors are read, and the error is
+// returned.
+func (j *JobClient) Embeddings(id common.JobId, model string, fn func(PageEmbedding) error) error {
+	if err := j.mustExist(id); err != nil {
+		return err
+	}
+
+	const queryJobEmbeddings = `
+SELECT url.url, url_text.title, url_embedding.url_id, url_embedding.chunk, url_embedding.text,
+	url_embedding.tokens, url_embedding.vector, url_embedding.stored_on
+FROM url_embedding
+JOIN url ON url.id = url_embedding.url_id
+LEFT JOIN url_text ON url_text.url_id = url_embedding.url_id
+WHERE url_embedding.url_id IN (` + queryJobURLIds + `) AND url_embedding.model = $2
+ORDER BY url_embedding.url_id, url_embedding.chunk`
+
+	rows, err := j.client.db.Query(queryJobEmbeddings, id, model)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			u, title, text       sql.NullString
+			urlId, chunk, tokens sql.NullInt64
+			vector               []float32
+			storedOn             pq.NullTime
+		)
+		if err := rows.Scan(&u, &title, &urlId, &chunk, &text, &tokens, pq.Array(&vector), &storedOn); err != nil {
+			return err
+		}
+		if !u.Valid {
+			return fmt.Errorf("Invalid job embedding for job id %d", id)
+		}
+
+		if err := fn(PageEmbedding{
+			URL:   u.String,
+			Title: title.String,
+			Embedding: URLEmbedding{
+				URLId:    common.URLId(urlId.Int64),
+				Chunk:    int(chunk.Int64),
+				Text:     text.String,
+				Tokens:   int(tokens.Int64),
+				Model:    model,
+				Vector:   vector,
+				StoredOn: storedOn.Time,
+			},
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"time"
+)
+
+// Records the panic a worker recovered from while crawling the job's URL. Once
+// the URL has panicked the poison threshold number of times, by any job, it is
+// poisoned, and no longer crawled. Zero never poisons the URL. True is returned
+// if the URL was poisoned by this panic.
+func (u *URLClient) AddPanic(jobId common.JobId, urlId common.URLId, stage, panicked, stack string, poisonAfter int) (bool, error) {
+	const queryInsertPanic = `
+INSERT INTO url_panic (job_id, url_id, stage, panic, stack, panicked_on) VALUES ($1, $2, $3, $4, $5, $6)`
+	const queryPoison = `
+INSERT INTO url_poisoned (url_id, poisoned_on)
+	SELECT $1, $2
+	WHERE (SELECT COUNT(*) FROM url_panic WHERE url_id = $1) >= $3
+		AND NOT EXISTS (SELECT 1 FROM url_poisoned WHERE url_id = $1)`
+
+	now := time.Now().UTC()
+	tx, err := u.client.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(queryInsertPanic, jobId, urlId, stage, panicked, stack, now); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	var n int64
+	if poisonAfter > 0 {
+		res, err := tx.Exec(queryPoison, urlId, now, poisonAfter)
+		if err != nil {
+			tx.Rollback()
+			return false, err
+		}
+		if n, err = res.RowsAffected(); err != nil {
+			tx.Rollback()
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Returns true if the URL has been poisoned by the panics of its crawls.
+func (u *URLClient) IsPoisoned(urlId common.URLId) (bool, error) {
+	const queryPoisoned = `SELECT EXISTS (SELECT 1 FROM url_poisoned WHERE url_id = $1)`
+
+	var poisoned bool
+	if err := u.client.db.QueryRow(queryPoisoned, urlId).Scan(&poisoned); err != nil {
+		return false, err
+	}
+	return poisoned, nil
+}
+
+// Generates the report of the panics workers recovered from while crawling
+// the job's URLs, with their stacks. The report is empty if the job does not
+// exist.
+func (j *JobClient) Panics(id common.JobId) (*common.URLPanicReport, error) {
+	const queryJobPanics = `
+SELECT url.url, p.stage, p.panic, p.stack, p.panicked_on, poisoned.url_id IS NOT NULL
+FROM url_panic AS p
+JOIN url ON url.id = p.url_id
+LEFT JOIN url_poisoned AS poisoned ON poisoned.url_id = p.url_id
+WHERE p.job_id = $1
+ORDER BY p.panicked_on DESC, url.url`
+
+	rows, err := j.client.db.Query(queryJobPanics, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &common.URLPanicReport{URLs: []common.URLPanic{}}
+	for rows.Next() {
+		var (
+			u, stage, panicked, stack sql.NullString
+			p                         common.URLPanic
+		)
+		if err := rows.Scan(&u, &stage, &panicked, &stack, &p.PanickedOn, &p.Poisoned); err != nil {
+			return nil, err
+		}
+		if !u.Valid {
+			return nil, fmt.Errorf("Invalid panic URL for job id %d", id)
+		}
+
+		p.URL, p.Stage, p.Panic, p.Stack = u.String, stage.String, panicked.String, stack.String
+		report.URLs = append(report.URLs, p)
+	}
+	return report, rows.Err()
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"strings"
+)
+
+// SQL expression extracting the lower cased host from url.url. Must match the
+// url_host index expression in setup/db.sql for the index to be used.
+const urlHostSQL = `lower(substring(url.url from '^[a-zA-Z]+://([^/:?#]+)'))`
+
+// SQL expressions for each of the common.URLQueryFields, except tag, see
+// urlQueryTagWhere. Expects the job URL depths to be joined as job_depth.
+var urlQueryColumns = map[string]string{
+	"status":      "url.status",
+	"depth":       "job_depth.depth",
+	"words":       "url.word_count",
+	"mime":        "url.mime",
+	"host":        urlHostSQL,
+	"url":         "url.url",
+	"title":       "COALESCE(url.title, '')",
+	"description": "COALESCE(url.description, '')",
+	"h1":          "COALESCE(url.h1, '')",
+	"crawled":     "url.crawled_on",
+	"published":   "url.published_on",
+	"modified":    "url.modified_on",
+}
+
+// Escapes the LIKE pattern wild cards within the value.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Converts the URL query expression into a SQL condition, with the values
+// appended to the query's existing arguments as placeholders.
+func urlQueryWhere(expr common.URLQueryExpr, args []interface{}) (string, []interface{}, error) {
+	switch e := expr.(type) {
+	case common.URLQueryAnd:
+		return urlQueryWhereBinary("AND", e.Left, e.Right, args)
+	case common.URLQueryOr:
+		return urlQueryWhereBinary("OR", e.Left, e.Right, args)
+	case common.URLQueryNot:
+		cond, args, err := urlQueryWhere(e.Expr, args)
+		if err != nil {
+			return "", nil, err
+		}
+		// NULL values should match negated conditions
+		return fmt.Sprintf("(%s) IS NOT TRUE", cond), args, nil
+	case common.URLQueryPredicate:
+		if e.Field == "tag" {
+			return urlQueryTagWhere(e, args)
+		}
+
+		col, ok := urlQueryColumns[e.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("Unknown URL query field %s", e.Field)
+		}
+
+		value := e.Value
+		if e.Field == "host" {
+			value = strings.ToLower(value.(string))
+		}
+
+		switch e.Op {
+		case "=", "!=", "<", "<=", ">", ">=":
+			args = append(args, value)
+			return fmt.Sprintf("%s %s $%d", col, e.Op, len(args)), args, nil
+		case "~":
+			args = append(args, "%"+likeEscaper.Replace(fmt.Sprint(value))+"%")
+			return fmt.Sprintf("%s ILIKE $%d", col, len(args)), args, nil
+		}
+		return "", nil, fmt.Errorf("Unknown URL query operator %s", e.Op)
+	}
+
+	return "", nil, fmt.Errorf("Unknown URL query expression %T", expr)
+}
+
+// Converts a tag predicate into a SQL condition. URLs can have many tags, so
+// the predicate matches if any of the URL's tags match, and != matches if none
+// of the URL's tags are the value.
+func urlQueryTagWhere(e common.URLQueryPredicate, args []interface{}) (string, []interface{}, error) {
+	const tagExists = `EXISTS (SELECT 1 FROM url_tag WHERE url_tag.url_id = url.id AND url_tag.tag %s $%d)`
+
+	value := strings.ToLower(fmt.Sprint(e.Value))
+	switch e.Op {
+	case "=":
+		args = append(args, value)
+		return fmt.Sprintf(tagExists, "=", len(args)), args, nil
+	case "!=":
+		args = append(args, value)
+		return "NOT " + fmt.Sprintf(tagExists, "=", len(args)), args, nil
+	case "~":
+		args = append(args, "%"+likeEscaper.Replace(value)+"%")
+		return fmt.Sprintf(tagExists, "ILIKE", len(args)), args, nil
+	}
+	return "", nil, fmt.Errorf("Unknown URL query operator %s", e.Op)
+}
+
+func urlQueryWhereBinary(op string, left, right common.URLQueryExpr, args []interface{}) (string, []interface{}, error) {
+	lCond, args, err := urlQueryWhere(left, args)
+	if err != nil {
+		return "", nil, err
+	}
+	rCond, args, err := urlQueryWhere(right, args)
+	if err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("(%s %s %s)", lCond, op, rCond), args, nil
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestURLQueryWhere(t *testing.T) {
+	expr, err := common.ParseURLQuery(`status >= 400 and (host = Example.COM or title ~ "50%") and not depth > 2`)
+	require.Nil(t, err, "Expect query to parse")
+
+	cond, args, err := urlQueryWhere(expr, []interface{}{1})
+	require.Nil(t, err, "Expect query to convert")
+	assert.Equal(t, "((url.status >= $2 AND ("+urlHostSQL+" = $3 OR COALESCE(url.title, '') ILIKE $4)) AND (job_depth.depth > $5) IS NOT TRUE)", cond, "Expect SQL condition")
+	assert.Equal(t, []interface{}{1, 400, "example.com", `%50\%%`, 2}, args, "Expect args appended")
+}
+
+func TestURLQueryWhereTag(t *testing.T) {
+	expr, err := common.ParseURLQuery(`tag = Product or tag != error`)
+	require.Nil(t, err, "Expect query to parse")
+
+	cond, args, err := urlQueryWhere(expr, []interface{}{1})
+	require.Nil(t, err, "Expect query to convert")
+	assert.Equal(t, "(EXISTS (SELECT 1 FROM url_tag WHERE url_tag.url_id = url.id AND url_tag.tag = $2) OR "+
+		"NOT EXISTS (SELECT 1 FROM url_tag WHERE url_tag.url_id = url.id AND url_tag.tag = $3))", cond, "Expect tag SQL condition")
+	assert.Equal(t, []interface{}{1, "product", "error"}, args, "Expect lower cased tags appended")
+}
+
+func TestURLQueryWhereUnknownField(t *testing.T) {
+	_, _, err := urlQueryWhere(common.URLQueryPredicate{Field: "unknown", Op: "=", Value: 1}, nil)
+	assert.NotNil(t, err, "Expect unknown field error")
+}
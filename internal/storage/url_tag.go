@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+)
+
+// Stores the tags a crawled URL was classified with, replacing the tags it
+// was previously classified with.
+func (u *URLClient) SetTags(urlId common.URLId, tags []string) error {
+	const queryDeleteTags = `DELETE FROM url_tag WHERE url_id = $1`
+	const queryInsertTag = `INSERT INTO url_tag (url_id, tag) VALUES ($1, $2)`
+
+	tx, err := u.client.db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(queryDeleteTags, urlId); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(queryInsertTag, urlId, tag); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/lib/pq"
+)
+
+// Sets if the main text content of the job's crawled pages is extracted.
+func (j *JobClient) SetExtractText(id common.JobId, extract bool) error {
+	const querySetExtractText = `UPDATE job SET extract_text = $2 WHERE id = $1`
+
+	if _, err := j.client.db.Exec(querySetExtractText, id, extract); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns if the main text content of the job's crawled pages is extracted.
+// False is returned if the job does not exist.
+func (j *JobClient) ExtractText(id common.JobId) (bool, error) {
+	const queryExtractText = `SELECT extract_text FROM job WHERE id = $1`
+
+	var extract sql.NullBool
+	if err := j.client.db.QueryRow(queryExtractText, id).Scan(&extract); err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return extract.Bool, nil
+}
+
+// Stores the main text content extracted from the URL's HTML, replacing any
+// previously stored.
+func (u *URLClient) StoreText(t URLText) error {
+	const queryStoreText = `
+WITH s AS (
+    UPDATE url_text SET title = $2, text = $3, stored_on = $4
+    WHERE url_id = $1
+    RETURNING url_id
+)
+INSERT INTO url_text (url_id, title, text, stored_on)
+    SELECT $1, $2, $3, $4
+    WHERE NOT EXISTS (SELECT 1 FROM s)`
+
+	title := sql.NullString{String: t.Title, Valid: t.Title != ""}
+	if _, err := u.client.db.Exec(queryStoreText, t.URLId, title, t.Text, t.StoredOn); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Requests the main text content extracted from the URL's HTML. If no text
+// is stored nil will be returned.
+func (u *URLClient) GetText(urlId common.URLId) (*URLText, error) {
+	const queryGetText = `SELECT title, text, stored_on FROM url_text WHERE url_id = $1`
+
+	var (
+		title, text sql.NullString
+		storedOn    pq.NullTime
+	)
+	if err := u.client.db.QueryRow(queryGetText, urlId).Scan(&title, &text, &storedOn); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &URLText{
+		URLId:    urlId,
+		Title:    title.String,
+		Text:     text.String,
+		StoredOn: storedOn.Time,
+	}, nil
+}
+
+// Calls fn with the main text content extracted from each of the job's URLs,
+// ordered by URL id, as they are read from the database, so the text of large
+// jobs can be streamed without being held in memory. URLs without text stored
+// are skipped. If fn returns an error no more pages are read, and the error is
+// returned.
+func (j *JobClient) TextPages(id common.JobId, fn func(TextPage) error) error {
+	if err := j.mustExist(id); err != nil {
+		return err
+	}
+
+	const queryJobTextPages = `
+SELECT url.url, url_text.title, url_text.text, url_text.stored_on
+FROM url
+JOIN url_text ON url_text.url_id = url.id
+WHERE url.id IN (` + queryJobURLIds + `)
+ORDER BY url.id`
+
+	rows, err := j.client.db.Query(queryJobTextPages, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			u, title, text sql.NullString
+			storedOn       pq.NullTime
+		)
+		if err := rows.Scan(&u, &title, &text, &storedOn); err != nil {
+			return err
+		}
+		if !u.Valid {
+			return fmt.Errorf("Invalid job text page for job id %d", id)
+		}
+
+		if err := fn(TextPage{
+			URL:      u.String,
+			Title:    title.String,
+			Text:     text.String,
+			StoredOn: storedOn.Time,
+		}); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
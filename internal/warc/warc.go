@@ -0,0 +1,183 @@
+// Package warc writes crawled responses as WARC (ISO 28500) files, so they
+// can be replayed and indexed by web-archiving tools, e.g: pywb.
+package warc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Version of the WARC format records are written in.
+const Version = "WARC/1.1"
+
+// Types of the records written.
+const (
+	TypeWarcinfo = "warcinfo"
+	TypeResponse = "response"
+)
+
+// Content types of the record blocks.
+const (
+	warcFieldsType   = "application/warc-fields"
+	httpResponseType = "application/http; msgtype=response"
+)
+
+// Reason a record's block is truncated, the content was longer than was
+// captured.
+const TruncatedLength = "length"
+
+// Record of a WARC file.
+type Record struct {
+	// One of the Type constants
+	Type string
+
+	// URI of the content the record captures. Empty for warcinfo records.
+	TargetURI string
+
+	// When the content was captured
+	Date time.Time
+
+	// Content type of the record's block
+	ContentType string
+
+	// Digest of the block's payload, e.g: a HTTP response's body. Omitted
+	// if empty.
+	PayloadDigest string
+
+	// Reason the block was truncated, e.g: TruncatedLength. Omitted if
+	// the block is whole.
+	Truncated string
+
+	// Content of the record
+	Block []byte
+}
+
+// Creates a warcinfo record describing the WARC file, with the fields, e.g:
+// software, written in order of their names.
+func NewWarcinfo(date time.Time, fields map[string]string) *Record {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	block := &bytes.Buffer{}
+	for _, name := range names {
+		fmt.Fprintf(block, "%s: %s\r\n", name, fields[name])
+	}
+	return &Record{Type: TypeWarcinfo, Date: date, ContentType: warcFieldsType, Block: block.Bytes()}
+}
+
+// Creates a response record of the HTTP response of the URI. The response's
+// body is expected to already be decoded, so the Content-Encoding, and
+// Transfer-Encoding headers are dropped, and Content-Length is set to the
+// length of the body. If truncated the body is only the start of the
+// response's body.
+func NewResponse(uri string, date time.Time, status int, header http.Header, body []byte, truncated bool) *Record {
+	block := &bytes.Buffer{}
+	fmt.Fprintf(block, "HTTP/1.1 %d %s\r\n", status, http.StatusText(status))
+
+	h := http.Header{}
+	for k, v := range header {
+		h[k] = v
+	}
+	h.Del("Content-Encoding")
+	h.Del("Transfer-Encoding")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Write(block)
+	block.WriteString("\r\n")
+	block.Write(body)
+
+	r := &Record{
+		Type:          TypeResponse,
+		TargetURI:     uri,
+		Date:          date,
+		ContentType:   httpResponseType,
+		PayloadDigest: Digest(body),
+		Block:         block.Bytes(),
+	}
+	if truncated {
+		r.Truncated = TruncatedLength
+	}
+	return r
+}
+
+// Returns the SHA-1 digest of the content, in the base32 form of WARC
+// digests, e.g: sha1:3I42H3S6NNFQ2MSVX7XZKYAYSCX5QBYJ.
+func Digest(content []byte) string {
+	sum := sha1.Sum(content)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+// Writer of the records of a WARC file.
+type Writer struct {
+	w        io.Writer
+	compress bool
+}
+
+// Creates a writer of WARC records to the writer. If compress is set each
+// record is written as its own gzip member, the form of .warc.gz files, so
+// records can be read without decompressing the records before them.
+func NewWriter(w io.Writer, compress bool) *Writer {
+	return &Writer{w: w, compress: compress}
+}
+
+// Writes the record, returning its generated WARC-Record-ID.
+func (w *Writer) WriteRecord(r *Record) (string, error) {
+	id, err := newRecordId()
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s\r\n", Version)
+	fmt.Fprintf(buf, "WARC-Type: %s\r\n", r.Type)
+	fmt.Fprintf(buf, "WARC-Record-ID: %s\r\n", id)
+	fmt.Fprintf(buf, "WARC-Date: %s\r\n", r.Date.UTC().Format(time.RFC3339))
+	if r.TargetURI != "" {
+		fmt.Fprintf(buf, "WARC-Target-URI: %s\r\n", r.TargetURI)
+	}
+	fmt.Fprintf(buf, "WARC-Block-Digest: %s\r\n", Digest(r.Block))
+	if r.PayloadDigest != "" {
+		fmt.Fprintf(buf, "WARC-Payload-Digest: %s\r\n", r.PayloadDigest)
+	}
+	if r.Truncated != "" {
+		fmt.Fprintf(buf, "WARC-Truncated: %s\r\n", r.Truncated)
+	}
+	fmt.Fprintf(buf, "Content-Type: %s\r\n", r.ContentType)
+	fmt.Fprintf(buf, "Content-Length: %d\r\n", len(r.Block))
+	buf.WriteString("\r\n")
+	buf.Write(r.Block)
+	buf.WriteString("\r\n\r\n")
+
+	if !w.compress {
+		_, err := buf.WriteTo(w.w)
+		return id, err
+	}
+	gw := gzip.NewWriter(w.w)
+	if _, err := buf.WriteTo(gw); err != nil {
+		return "", err
+	}
+	return id, gw.Close()
+}
+
+// Returns a new random record id, as a UUID URN.
+func newRecordId() (string, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		return "", err
+	}
+	// Version 4, variant RFC 4122
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
@@ -0,0 +1,98 @@
+package warc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Reads the next record's version line, and header fields.
+func readRecordHeader(t *testing.T, r *bufio.Reader) textproto.MIMEHeader {
+	tp := textproto.NewReader(r)
+	version, err := tp.ReadLine()
+	require.NoError(t, err, "Expect version line")
+	assert.Equal(t, Version, version, "Expect WARC version")
+	header, err := tp.ReadMIMEHeader()
+	require.NoError(t, err, "Expect record header")
+	return header
+}
+
+func TestWriteResponse(t *testing.T) {
+	date := time.Date(2015, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	header := http.Header{"Content-Type": []string{"text/html"}, "Content-Encoding": []string{"gzip"}, "Content-Length": []string{"10"}}
+	body := []byte("<html></html>")
+
+	buf := &bytes.Buffer{}
+	id, err := NewWriter(buf, false).WriteRecord(NewResponse("http://example.com/", date, 200, header, body, true))
+	require.NoError(t, err, "Expect record written")
+	assert.Regexp(t, regexp.MustCompile(`^<urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}>$`), id, "Expect UUID record id")
+
+	r := bufio.NewReader(buf)
+	fields := readRecordHeader(t, r)
+	assert.Equal(t, TypeResponse, fields.Get("WARC-Type"), "Expect response record")
+	assert.Equal(t, id, fields.Get("WARC-Record-ID"), "Expect record id")
+	assert.Equal(t, "2015-01-02T02:04:05Z", fields.Get("WARC-Date"), "Expect UTC date")
+	assert.Equal(t, "http://example.com/", fields.Get("WARC-Target-URI"), "Expect target URI")
+	assert.Equal(t, Digest(body), fields.Get("WARC-Payload-Digest"), "Expect body's digest")
+	assert.Equal(t, TruncatedLength, fields.Get("WARC-Truncated"), "Expect truncated")
+	assert.Equal(t, httpResponseType, fields.Get("Content-Type"), "Expect HTTP response block")
+
+	length, err := strconv.Atoi(fields.Get("Content-Length"))
+	require.NoError(t, err, "Expect block length")
+	block := make([]byte, length)
+	_, err = io.ReadFull(r, block)
+	require.NoError(t, err, "Expect block")
+	assert.Equal(t, Digest(block), fields.Get("WARC-Block-Digest"), "Expect block's digest")
+	rest, _ := ioutil.ReadAll(r)
+	assert.Equal(t, "\r\n\r\n", string(rest), "Expect record terminated")
+
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(block)), nil)
+	require.NoError(t, err, "Expect HTTP response block")
+	assert.Equal(t, 200, resp.StatusCode, "Expect response status")
+	assert.Equal(t, "text/html", resp.Header.Get("Content-Type"), "Expect response headers")
+	assert.Empty(t, resp.Header.Get("Content-Encoding"), "Expect decoded body")
+	assert.Equal(t, int64(len(body)), resp.ContentLength, "Expect length of body")
+	got, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, body, got, "Expect response body")
+	assert.Equal(t, []string{"10"}, header["Content-Length"], "Expect header not modified")
+}
+
+func TestWriteCompressed(t *testing.T) {
+	date := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf, true)
+	_, err := w.WriteRecord(NewWarcinfo(date, map[string]string{"software": "harvester", "format": "WARC File Format 1.1"}))
+	require.NoError(t, err, "Expect warcinfo written")
+	_, err = w.WriteRecord(NewResponse("http://example.com/", date, 404, http.Header{}, nil, false))
+	require.NoError(t, err, "Expect response written")
+
+	// Each record is its own gzip member.
+	gr, err := gzip.NewReader(buf)
+	require.NoError(t, err, "Expect gzip")
+	gr.Multistream(false)
+	first, err := ioutil.ReadAll(gr)
+	require.NoError(t, err, "Expect first member")
+	require.NoError(t, gr.Reset(buf), "Expect second member")
+	second, err := ioutil.ReadAll(gr)
+	require.NoError(t, err, "Expect second member")
+
+	fields := readRecordHeader(t, bufio.NewReader(bytes.NewReader(first)))
+	assert.Equal(t, TypeWarcinfo, fields.Get("WARC-Type"), "Expect warcinfo record")
+	assert.Empty(t, fields.Get("WARC-Target-URI"), "Expect no target URI")
+	assert.Contains(t, string(first), "\r\n\r\nformat: WARC File Format 1.1\r\nsoftware: harvester\r\n", "Expect fields ordered by name")
+
+	fields = readRecordHeader(t, bufio.NewReader(bytes.NewReader(second)))
+	assert.Equal(t, TypeResponse, fields.Get("WARC-Type"), "Expect response record")
+	assert.Empty(t, fields.Get("WARC-Truncated"), "Expect whole response")
+	assert.Contains(t, string(second), "HTTP/1.1 404 Not Found\r\n", "Expect response status line")
+}
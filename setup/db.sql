@@ -1,12 +1,63 @@
 
 -- Collection of URLs encountered
 CREATE TABLE IF NOT EXISTS url (
-    id         serial PRIMARY KEY,
-    mime       TEXT,                   -- content type this URL references
-    url        TEXT   NOT NULL,        -- URL of the content
-    crawled_on TIMESTAMP WITH TIME ZONE
+    id           serial PRIMARY KEY,
+    mime         TEXT,                   -- content type this URL references
+    url          TEXT   NOT NULL,        -- URL of the content
+    crawled_on   TIMESTAMP WITH TIME ZONE,
+    status       INT,                      -- HTTP status code of the crawl response
+    published_on TIMESTAMP WITH TIME ZONE, -- publish date stated by the content
+    modified_on  TIMESTAMP WITH TIME ZONE, -- last modified date from the content or headers
+    word_count   INT,                      -- number of visible words in HTML content
+    title        TEXT,                     -- HTML content's title
+    description  TEXT,                     -- HTML content's description meta tag
+    h1           TEXT,                     -- HTML content's first h1 heading
+    content_hash TEXT                      -- SHA-256 of the content when last crawled
 );
 CREATE UNIQUE INDEX url_unique ON url(url);
+CREATE INDEX url_status ON url(status);
+CREATE INDEX url_mime ON url(mime);
+-- Must match the host expression used by job URL queries
+CREATE INDEX url_host ON url ((lower(substring(url from '^[a-zA-Z]+://([^/:?#]+)'))));
+
+-- HTML content of crawled URLs, only stored if the workers are configured to
+CREATE TABLE IF NOT EXISTS url_html (
+    url_id    INT                      PRIMARY KEY,
+    raw       TEXT,                             -- HTML as received
+    sanitized TEXT,                             -- HTML with scripts and dangerous attributes removed
+    stored_on TIMESTAMP WITH TIME ZONE NOT NULL,
+    raw_tiered       BOOLEAN NOT NULL DEFAULT FALSE, -- if raw was moved into the cold store, and is null here
+    sanitized_tiered BOOLEAN NOT NULL DEFAULT FALSE, -- if sanitized was moved into the cold store, and is null here
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+
+-- Main text content of crawled URLs, without navigation and other boilerplate,
+-- only extracted for jobs which extract text
+CREATE TABLE IF NOT EXISTS url_text (
+    url_id    INT                      PRIMARY KEY,
+    title     TEXT,                             -- title of the page, null if none
+    text      TEXT                     NOT NULL, -- paragraphs of the main content separated by blank lines
+    stored_on TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+
+-- Embedding vectors of the chunks of crawled URLs' main text, only stored by
+-- workers configured with an embedding endpoint. Vectors can be cast to
+-- pgvector's vector type, e.g: vector::vector
+CREATE TABLE IF NOT EXISTS url_embedding (
+    url_id    INT                      NOT NULL,
+    chunk     INT                      NOT NULL, -- index of the chunk within the URL's text
+    text      TEXT                     NOT NULL, -- text of the chunk embedded
+    tokens    INT                      NOT NULL, -- approximate number of tokens of the chunk
+    model     TEXT                     NOT NULL, -- model the vector was embedded with
+    vector    REAL[]                   NOT NULL,
+    stored_on TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (url_id, chunk),
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
 
 -- Links a refer URL with a content URL
 CREATE TABLE IF NOT EXISTS url_link (
@@ -15,11 +66,196 @@ CREATE TABLE IF NOT EXISTS url_link (
 );
 CREATE UNIQUE INDEX url_link_pair ON url_link (url_id, refer_id);
 
+-- Redirects found in the content of a crawled URL, e.g: meta refresh
+CREATE TABLE IF NOT EXISTS url_redirect (
+    url_id    INT  NOT NULL, -- URL whose content redirects
+    target_id INT  NOT NULL, -- URL redirected to
+    kind      TEXT NOT NULL  -- how the URL redirects, meta-refresh or javascript
+);
+CREATE UNIQUE INDEX url_redirect_pair ON url_redirect (url_id, target_id, kind);
+
+-- Alternate representations of a crawled URL, e.g: AMP variants, translations
+CREATE TABLE IF NOT EXISTS url_alternate (
+    url_id    INT  NOT NULL, -- URL the alternate is a representation of
+    target_id INT  NOT NULL, -- URL of the alternate
+    kind      TEXT NOT NULL, -- amp, language, feed, media, or alternate
+    lang      TEXT           -- hreflang of language alternates
+);
+CREATE UNIQUE INDEX url_alternate_pair ON url_alternate (url_id, target_id, kind);
+
+-- Kinds of content a crawled URL was classified as, e.g: product, article
+CREATE TABLE IF NOT EXISTS url_tag (
+    url_id INT  NOT NULL, -- URL which was classified
+    tag    TEXT NOT NULL  -- kind of content, e.g: product, article, category, login, or error
+);
+CREATE UNIQUE INDEX url_tag_pair ON url_tag (url_id, tag);
+
 -- Scheduled Job
 CREATE TABLE IF NOT EXISTS job (
     id           serial                   PRIMARY KEY,
+    created_on   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    archived_on  TIMESTAMP WITH TIME ZONE, -- when the job's bodies were tiered into the cold store
+    paused_on    TIMESTAMP WITH TIME ZONE, -- when the job was paused, null if not paused
+    crawl_window    TEXT,                 -- allowed crawling hours HH:MM-HH:MM, null if any time
+    crawl_window_tz TEXT,                 -- IANA time zone of the crawl window
+    group_id        INT,                  -- group the job was submitted with, null if none
+    cancelled_on    TIMESTAMP WITH TIME ZONE, -- when the job was cancelled, null if not cancelled
+    started_on      TIMESTAMP WITH TIME ZONE, -- when the foreman started the job, null while waiting for a slot
+    urgent_on       TIMESTAMP WITH TIME ZONE, -- when the job was flagged urgent, null if not urgent
+    api_key_id      INT,                      -- API key the job was scheduled with, null if none
+    extract_text    BOOLEAN NOT NULL DEFAULT FALSE, -- if the main text of the job's pages is extracted
+    max_urls        INT,                      -- most URLs the job may crawl, null if unlimited
+    urls_crawled    INT NOT NULL DEFAULT 0,   -- URLs the job has crawled, counted against max_urls
+    url_budget_exhausted_on TIMESTAMP WITH TIME ZONE, -- when the job ran out of max_urls, null if it hasn't
+    deadline        TIMESTAMP WITH TIME ZONE, -- time after which the job's URLs are not dispatched, null if none
+    expired_on      TIMESTAMP WITH TIME ZONE, -- when the job was finalized after its deadline, null if it wasn't
+    scope           TEXT,                     -- scope of the links crawled, e.g: same-host, null if any
+    strip_params    TEXT[],                   -- query params stripped from links, null if the default tracking params
+    keep_fragments  BOOLEAN NOT NULL DEFAULT FALSE -- if the fragments of links are kept
+);
+CREATE INDEX job_group_id ON job(group_id);
+CREATE INDEX job_api_key_id ON job(api_key_id);
+
+-- Named groups of jobs submitted together
+CREATE TABLE IF NOT EXISTS job_group (
+    id           serial                   PRIMARY KEY,
+    name         TEXT                     NOT NULL,
+    webhook      TEXT,                    -- URL notified once all of the group's jobs complete, null if none
+    created_on   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    scheduled_on TIMESTAMP WITH TIME ZONE, -- when all of the group's jobs were scheduled, null until then
+    completed_on TIMESTAMP WITH TIME ZONE  -- when all of the group's jobs were completed, null until then
+);
+
+-- Idempotency keys jobs were scheduled with, so replayed requests don't schedule duplicate jobs
+CREATE TABLE IF NOT EXISTS job_idempotency (
+    principal    TEXT                     NOT NULL, -- API key, or JWT issuer and subject the key is scoped to, empty if none
+    key          TEXT                     NOT NULL, -- Idempotency-Key header of the request
+    request_hash TEXT                     NOT NULL, -- hex SHA-256 of the request's options, and URLs
+    token        TEXT                     NOT NULL, -- random token of the request which reserved the key
+    job_id       INT,                               -- job scheduled, null while being scheduled
     created_on   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
+CREATE UNIQUE INDEX job_idempotency_key ON job_idempotency(principal, key);
+CREATE INDEX job_idempotency_created_on ON job_idempotency(created_on);
+
+-- Seed lists uploaded to be scheduled as a job in the background
+CREATE TABLE IF NOT EXISTS job_upload (
+    id          serial                   PRIMARY KEY,
+    state       TEXT                     NOT NULL, -- parsing, scheduling, completed, or failed
+    url_count   INT                      NOT NULL DEFAULT 0, -- valid URLs parsed from the seed list
+    rejected    INT                      NOT NULL DEFAULT 0, -- invalid, and opted out URLs
+    duplicates  INT                      NOT NULL DEFAULT 0,
+    job_id      INT,                     -- job the upload was scheduled as, null until completed
+    error       TEXT,                    -- reason the upload failed
+    created_on  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_on TIMESTAMP WITH TIME ZONE
+);
+
+-- Jobs scheduled again each time their cron expression matches
+CREATE TABLE IF NOT EXISTS recurring_job (
+    id          serial                   PRIMARY KEY,
+    name        TEXT                     NOT NULL,
+    cron        TEXT                     NOT NULL, -- five field cron expression
+    cron_tz     TEXT                     NOT NULL, -- IANA time zone of the expression
+    urls        TEXT[]                   NOT NULL, -- normalized URLs of each scheduled job
+    options     TEXT                     NOT NULL DEFAULT '', -- schedule job query parameters of each job
+    api_key_id  INT,                     -- API key the jobs are scheduled with, null if none
+    created_on  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    next_run_on TIMESTAMP WITH TIME ZONE NOT NULL, -- when the next job is scheduled
+    last_run_on TIMESTAMP WITH TIME ZONE, -- when the last job was scheduled, null if none yet
+    last_job_id INT,                      -- last job scheduled, null if none yet
+    disabled_on     TIMESTAMP WITH TIME ZONE, -- when the jobs stopped being scheduled, null if enabled
+    disabled_reason TEXT                      -- why the recurring job was disabled, e.g: its API key's quota was exceeded
+);
+CREATE INDEX recurring_job_next_run_on ON recurring_job(next_run_on);
+
+-- JSONPath expressions a job applies to its crawled JSON responses
+CREATE TABLE IF NOT EXISTS job_json_path (
+    job_id INT  NOT NULL,
+    name   TEXT,          -- field the selected values are stored as, null for expressions selecting URLs to follow
+    expr   TEXT NOT NULL  -- JSONPath expression
+);
+CREATE INDEX job_json_path_job ON job_json_path(job_id);
+
+-- Fields extracted from a job's crawled JSON responses
+CREATE TABLE IF NOT EXISTS job_json_field (
+    job_id INT  NOT NULL,
+    url_id INT  NOT NULL, -- URL of the JSON response
+    name   TEXT NOT NULL, -- field name of the job's JSONPath expression
+    value  TEXT NOT NULL  -- JSON encoded list of the values selected
+);
+CREATE INDEX job_json_field_job ON job_json_field(job_id, url_id);
+
+-- Tags a job was scheduled with, which jobs are listed by
+CREATE TABLE IF NOT EXISTS job_tag (
+    job_id INT  NOT NULL,
+    tag    TEXT NOT NULL  -- lower cased letters, numbers, - or _, e.g: team-seo
+);
+CREATE UNIQUE INDEX job_tag_pair ON job_tag(job_id, tag);
+CREATE INDEX job_tag_tag ON job_tag(tag);
+
+-- Regular expressions a job flags its crawled pages with, when their content matches
+CREATE TABLE IF NOT EXISTS job_flag (
+    job_id  INT  NOT NULL,
+    name    TEXT NOT NULL, -- flag the matching pages are filtered by, e.g: recall
+    pattern TEXT NOT NULL  -- RE2 regular expression
+);
+CREATE INDEX job_flag_job ON job_flag(job_id);
+
+-- Include, and exclude patterns the links of a job's pages are matched against before they are queued
+CREATE TABLE IF NOT EXISTS job_url_pattern (
+    id      SERIAL  PRIMARY KEY,
+    job_id  INT     NOT NULL,
+    pattern TEXT    NOT NULL, -- glob matched against the URL's path and query, or RE2 regular expression
+    regexp  BOOLEAN NOT NULL, -- if the pattern is a regular expression matched against the whole URL
+    exclude BOOLEAN NOT NULL  -- if matching URLs are excluded, instead of included
+);
+CREATE INDEX job_url_pattern_job ON job_url_pattern(job_id);
+
+-- Rules of how a job handles the responses of status codes, instead of following them
+CREATE TABLE IF NOT EXISTS job_status_rule (
+    job_id         INT  NOT NULL,
+    status         TEXT NOT NULL, -- status code, e.g: 403, or class, e.g: 4xx
+    action         TEXT NOT NULL, -- follow, record, fail, or retry
+    retry_delay_ms INT  NOT NULL, -- delay before retrying, 0 waits for the Retry-After header
+    retries        INT  NOT NULL  -- times the URL is retried
+);
+CREATE UNIQUE INDEX job_status_rule_status ON job_status_rule(job_id, status);
+
+-- Flags of a job's crawled pages whose content matched them
+CREATE TABLE IF NOT EXISTS job_url_flag (
+    job_id INT  NOT NULL,
+    url_id INT  NOT NULL, -- URL of the flagged page
+    name   TEXT NOT NULL  -- name of the flag matched
+);
+CREATE UNIQUE INDEX job_url_flag_pair ON job_url_flag(job_id, url_id, name);
+
+-- Watermark of the URLs exported from a job to each destination, so only the
+-- URLs crawled since the previous export are exported next.
+CREATE TABLE IF NOT EXISTS job_export (
+    job_id         INT                      NOT NULL,
+    destination    TEXT                     NOT NULL, -- name of the system exported to, e.g: warehouse
+    exported_until TIMESTAMP WITH TIME ZONE NOT NULL, -- crawled_on of the latest URL exported
+    exported_on    TIMESTAMP WITH TIME ZONE NOT NULL  -- when the job was last exported to the destination
+);
+CREATE UNIQUE INDEX job_export_destination ON job_export(job_id, destination);
+
+-- Files of a download job's URLs, downloaded by the workers
+CREATE TABLE IF NOT EXISTS job_download (
+    job_id          INT     NOT NULL,
+    url_id          INT     NOT NULL,
+    expected_sha256 TEXT,                           -- checksum the file was scheduled with, null if not verified
+    file            TEXT,                           -- path relative to the workers' download directory, null until downloaded
+    bytes           BIGINT  NOT NULL DEFAULT 0,
+    sha256          TEXT,                           -- hex SHA-256 of the file, null until downloaded
+    mime            TEXT,
+    resumed         BOOLEAN NOT NULL DEFAULT false, -- if resumed from a partial download
+    error           TEXT,                           -- why the download failed, null if it didn't
+    downloaded_on   TIMESTAMP WITH TIME ZONE,
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE UNIQUE INDEX job_download_url ON job_download(job_id, url_id);
 
 -- Origin URLs from a job
 CREATE TABLE IF NOT EXISTS job_url (
@@ -35,15 +271,259 @@ CREATE TABLE IF NOT EXISTS job_result (
     job_id   INT  NOT NULL,
     refer_Id INT  NOT NULL, -- URL which this job URL result was found on
     url_id   INT  NOT NULL, -- URL for this result
+    level    INT,           -- recursive distance of the URL from the Job URL
 
     FOREIGN KEY (refer_id) REFERENCES url(id),
     FOREIGN KEY (url_id)   REFERENCES url(id)
 );
 CREATE UNIQUE INDEX job_result_pair ON job_result(job_id,refer_id,url_id);
 
--- job URL still pending
+-- Internal link authority score of a job's URLs, computed on job completion.
+CREATE TABLE IF NOT EXISTS job_link_score (
+    job_id    INT              NOT NULL,
+    url_id    INT              NOT NULL,
+    score     DOUBLE PRECISION NOT NULL,
+    algorithm TEXT             NOT NULL, -- algorithm used to compute the score, e.g: pagerank
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE UNIQUE INDEX job_link_score_pair ON job_link_score(job_id,url_id);
+
+-- Each request made by a worker. Used for the host crawl history.
+CREATE TABLE IF NOT EXISTS crawl_log (
+    id          bigserial                PRIMARY KEY,
+    job_id      INT                      NOT NULL,
+    url_id      INT                      NOT NULL,
+    host        TEXT                     NOT NULL, -- lower cased host of the URL, without port
+    crawled_on  TIMESTAMP WITH TIME ZONE NOT NULL,
+    status      INT,                               -- HTTP status code, null if the request failed
+    bytes       BIGINT                   NOT NULL, -- response body size
+    duration_ms INT                      NOT NULL, -- time taken to request and read the response
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE INDEX crawl_log_host ON crawl_log(host, crawled_on);
+CREATE INDEX crawl_log_job ON crawl_log(job_id, crawled_on);
+CREATE INDEX crawl_log_job_id ON crawl_log(job_id, id);
+
+-- Each crawl skipped by a worker before its URL was requested. Used for the live crawl feed.
+CREATE TABLE IF NOT EXISTS crawl_skip (
+    id         bigserial                PRIMARY KEY,
+    job_id     INT                      NOT NULL,
+    url_id     INT                      NOT NULL,
+    skipped_on TIMESTAMP WITH TIME ZONE NOT NULL,
+    reason     TEXT                     NOT NULL, -- why the crawl was skipped, e.g: robots-disallowed
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE INDEX crawl_skip_job_id ON crawl_skip(job_id, id);
+
+-- URLs of jobs which responded 451 Unavailable For Legal Reasons
+CREATE TABLE IF NOT EXISTS url_legal_restriction (
+    job_id      INT                      NOT NULL,
+    url_id      INT                      NOT NULL,
+    host        TEXT                     NOT NULL, -- lower cased host, without port
+    blocked_by  TEXT,                    -- entity implementing the block, from the Link rel="blocked-by" header
+    recorded_on TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (job_id, url_id),
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE INDEX url_legal_restriction_url_id ON url_legal_restriction(url_id);
+
+-- Pending URLs of jobs which were never attempted because the job's deadline passed
+CREATE TABLE IF NOT EXISTS job_unattempted (
+    job_id   INT NOT NULL,
+    url_id   INT NOT NULL,
+    refer_id INT,              -- URL the URL was found on, null for Job URLs
+    level    INT NOT NULL,     -- distance from the Job URL the URL was found at
+
+    PRIMARY KEY (job_id, url_id),
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+
+-- URLs of jobs whose declared Content-Type mismatched the content type sniffed from their content
+CREATE TABLE IF NOT EXISTS url_mime_mismatch (
+    job_id      INT                      NOT NULL,
+    url_id      INT                      NOT NULL,
+    declared    TEXT                     NOT NULL, -- mime of the Content-Type header
+    sniffed     TEXT                     NOT NULL, -- mime sniffed from the content, which the URL was scraped as
+    detected_on TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (job_id, url_id),
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+
+-- URLs of jobs whose content failed to be parsed, quarantined with the start of their raw content
+CREATE TABLE IF NOT EXISTS url_parse_failure (
+    job_id    INT                      NOT NULL,
+    url_id    INT                      NOT NULL,
+    mime      TEXT                     NOT NULL, -- content type the URL was parsed as
+    error     TEXT                     NOT NULL,
+    size      BIGINT                   NOT NULL, -- size of the content, which may be larger than the raw content stored
+    truncated BOOLEAN                  NOT NULL DEFAULT false,
+    raw       BYTEA                    NOT NULL,
+    failed_on TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (job_id, url_id),
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+
+-- Panics workers recovered from while crawling a job's URL
+CREATE TABLE IF NOT EXISTS url_panic (
+    job_id      INT                      NOT NULL,
+    url_id      INT                      NOT NULL,
+    stage       TEXT                     NOT NULL, -- crawl stage which panicked, e.g: parse
+    panic       TEXT                     NOT NULL, -- value panicked with
+    stack       TEXT                     NOT NULL, -- stack of the goroutine which panicked
+    panicked_on TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+CREATE INDEX url_panic_job ON url_panic(job_id);
+CREATE INDEX url_panic_url ON url_panic(url_id);
+
+-- URLs which panicked workers too many times, and are no longer crawled by any job
+CREATE TABLE IF NOT EXISTS url_poisoned (
+    url_id      INT                      NOT NULL PRIMARY KEY,
+    poisoned_on TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    FOREIGN KEY (url_id) REFERENCES url(id)
+);
+
+-- Hosts which have opted out of being crawled. Sub domains of a host are also opted out.
+CREATE TABLE IF NOT EXISTS host_opt_out (
+    host         TEXT                     PRIMARY KEY, -- lower cased host, without port
+    reason       TEXT                     NOT NULL,
+    requested_by TEXT                     NOT NULL,    -- admin, a verified site owner, or legal
+    created_on   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Keys clients authorize their web server requests with. Revoked keys are deleted.
+CREATE TABLE IF NOT EXISTS api_key (
+    id         SERIAL                   PRIMARY KEY,
+    name       TEXT                     NOT NULL,
+    key_hash   TEXT                     NOT NULL UNIQUE, -- hex SHA-256 of the key
+    prefix     TEXT                     NOT NULL,        -- leading characters of the key, to identify it by
+    enabled    BOOLEAN                  NOT NULL DEFAULT true,
+    created_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Monthly quotas of the jobs scheduled with an API key. Zero limits are not enforced.
+CREATE TABLE IF NOT EXISTS api_key_quota (
+    api_key_id INT    PRIMARY KEY,
+    urls       BIGINT NOT NULL, -- URLs requested per month
+    bytes      BIGINT NOT NULL, -- bytes downloaded per month
+    jobs       INT    NOT NULL, -- jobs scheduled per month
+    webhook    TEXT             -- URL notified when usage crosses the quota thresholds, null if none
+);
+
+-- Quota thresholds an API key's webhook was notified of, so each is only notified once a month
+CREATE TABLE IF NOT EXISTS api_key_quota_notice (
+    api_key_id  INT                      NOT NULL,
+    month       TEXT                     NOT NULL, -- YYYY-MM, UTC
+    metric      TEXT                     NOT NULL, -- urls, bytes, or jobs
+    percent     INT                      NOT NULL, -- percent of the quota used
+    notified_on TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE UNIQUE INDEX api_key_quota_notice_unique ON api_key_quota_notice(api_key_id, month, metric, percent);
+
+-- Well-known files of crawled hosts, e.g: /.well-known/security.txt, /llms.txt.
+-- Only files a host has are stored.
+CREATE TABLE IF NOT EXISTS host_well_known (
+    host       TEXT                     NOT NULL, -- lower cased host, without port
+    path       TEXT                     NOT NULL,
+    content    TEXT                     NOT NULL,
+    fetched_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (host, path)
+);
+
+-- Favicon and name of crawled sites, captured once per host per job from the
+-- host's home page and web app manifest.
+CREATE TABLE IF NOT EXISTS host_identity (
+    host       TEXT                     PRIMARY KEY, -- lower cased host, without port
+    site_name  TEXT                     NOT NULL DEFAULT '',
+    icon_url   TEXT                     NOT NULL DEFAULT '',
+    icon_mime  TEXT                     NOT NULL DEFAULT '',
+    icon       BYTEA,
+    job_id     INT                      NOT NULL, -- job which last captured the identity
+    fetched_on TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Metrics of the requests made to each host within each period the foreman's
+-- host reputation watcher evaluated, tracking the hosts' crawls over time.
+CREATE TABLE IF NOT EXISTS host_metric (
+    host         TEXT                     NOT NULL, -- lower cased host, without port
+    period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+    period_end   TIMESTAMP WITH TIME ZONE NOT NULL,
+    requests     BIGINT                   NOT NULL,
+    errors       BIGINT                   NOT NULL, -- requests which failed, or responded with a 4xx or 5xx
+    successes    BIGINT                   NOT NULL, -- requests which responded with a 2xx
+    avg_bytes    DOUBLE PRECISION         NOT NULL, -- average body size of the successful responses
+    PRIMARY KEY (host, period_end)
+);
+
+-- Anomalies the foreman detected in a job's crawls of a host, compared to the
+-- host's earlier crawls. Each kind is only detected once per host per job.
+CREATE TABLE IF NOT EXISTS host_anomaly (
+    id          SERIAL                   PRIMARY KEY,
+    host        TEXT                     NOT NULL, -- lower cased host, without port
+    kind        TEXT                     NOT NULL, -- errorSpike, sizeCollapse, or parkedRedirect
+    detail      TEXT                     NOT NULL,
+    job_id      INT                      NOT NULL,
+    detected_on TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE UNIQUE INDEX host_anomaly_job ON host_anomaly(host, kind, job_id);
+CREATE INDEX host_anomaly_detected ON host_anomaly(host, detected_on);
+
+-- Responses fetched by the workers, shared between jobs for the cache TTL. Keyed
+-- by a hash of the request's URL and headers. Bodies are stored by content hash
+-- so identical responses are only stored once.
+CREATE TABLE IF NOT EXISTS fetch_cache (
+    key        TEXT                     PRIMARY KEY,
+    url        TEXT                     NOT NULL,
+    status     INT                      NOT NULL,
+    header     TEXT                     NOT NULL, -- JSON encoded response headers
+    body_hash  TEXT                     NOT NULL, -- SHA-256 of the body, see fetch_body
+    fetched_on TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX fetch_cache_fetched_on ON fetch_cache(fetched_on);
+
+CREATE TABLE IF NOT EXISTS fetch_body (
+    hash   TEXT    PRIMARY KEY,
+    body   BYTEA,                          -- null if tiered
+    tiered BOOLEAN NOT NULL DEFAULT FALSE  -- if the body was moved into the cold store
+);
+
+-- Fetch slots workers hold against the cluster's concurrent fetch limit. Slots of
+-- workers which stopped without releasing them expire.
+CREATE TABLE IF NOT EXISTS cluster_fetch_slot (
+    id         SERIAL                   PRIMARY KEY,
+    worker     TEXT                     NOT NULL, -- worker holding the slot
+    expires_on TIMESTAMP WITH TIME ZONE NOT NULL
+);
+CREATE INDEX cluster_fetch_slot_worker ON cluster_fetch_slot(worker);
+
+-- Bytes workers reserved against the cluster's bandwidth limit in each second.
+CREATE TABLE IF NOT EXISTS cluster_bandwidth (
+    second BIGINT PRIMARY KEY, -- unix time of the second
+    bytes  BIGINT NOT NULL
+);
+
+-- job URL still pending. The rows are the job's crawl frontier, and are re-queued when a job is resumed.
 CREATE TABLE IF NOT EXISTS url_pending (
-    job_id    INT NOT NULL, -- Job Id the origin URL started with
-	origin_id INT NOT NULL, -- The Job URL that this URL is a descendant of 
-	url_Id    INT NOT NULL  -- URL that is pending being crawled.
+    job_id         INT     NOT NULL, -- Job Id the origin URL started with
+	origin_id      INT     NOT NULL, -- The Job URL that this URL is a descendant of 
+	url_Id         INT     NOT NULL, -- URL that is pending being crawled.
+	refer_id       INT,              -- URL the pending URL was found on, null for Job URLs
+	level          INT     NOT NULL DEFAULT 0,     -- recursive distance from the origin URL
+	force_crawl    BOOLEAN NOT NULL DEFAULT false, -- crawl flags the URL was queued with
+	delta          BOOLEAN NOT NULL DEFAULT false,
+	no_fetch_cache BOOLEAN NOT NULL DEFAULT false,
+	skip_alternates BOOLEAN NOT NULL DEFAULT false,
+	download       BOOLEAN NOT NULL DEFAULT false,
+	priority       INT     NOT NULL DEFAULT 0,     -- priority the URL is dispatched with, higher first
+	max_level      INT     NOT NULL DEFAULT 0,     -- max level of the job, 0 if the configured max level
+	parked_on      TIMESTAMP WITH TIME ZONE        -- when the URL was parked outside of the job's crawl window
 );
+CREATE INDEX url_pending_job ON url_pending(job_id);
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Version of the web server's HTTP API a handler is serving. v1 responses
+// are written as ad-hoc JSON shapes, and are kept for existing clients.
+// v2 responses are wrapped in an envelope, and all field names are snake_case.
+type apiVersion int
+
+const (
+	// Original API mounted directly under the HTTP root path. Deprecated
+	// in favor of apiV2.
+	apiV1 apiVersion = iota
+
+	// API mounted under the "/v2/" path prefix.
+	apiV2
+)
+
+// satisfies the stringer interface
+func (v apiVersion) String() string {
+	return fmt.Sprintf("v%d", int(v)+1)
+}
+
+// Returns the path the route should be mounted at for this API version.
+// A trailing '/' on the route is preserved, because path.Join would
+// strip it off.
+func (v apiVersion) path(root, route string) string {
+	prefix := ""
+	if v != apiV1 {
+		prefix = v.String()
+	}
+
+	p := path.Join("/", root, prefix, route)
+	if strings.HasSuffix(route, "/") && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return p
+}
+
+// Writes the data back to the client in the shape of the API version.
+func (v apiVersion) writeData(w http.ResponseWriter, data interface{}, status int) error {
+	if v == apiV1 {
+		return writeJSON(w, data, status)
+	}
+	return writeJSON(w, apiEnvelope{Data: snakeCaseFields(data), Meta: apiMeta{Version: v.String()}}, status)
+}
+
+// Writes the error back to the client in the shape of the API version.
+func (v apiVersion) writeError(w http.ResponseWriter, code, msg string, status int) error {
+	if v == apiV1 {
+		return writeJSONError(w, code, msg, status)
+	}
+	return writeJSON(w, apiEnvelope{Error: &ErrorRsp{Code: code, Msg: msg}, Meta: apiMeta{Version: v.String()}}, status)
+}
+
+// Writes a method not allowed response, setting the allowed methods header.
+// v1 keeps its original plain text response.
+func (v apiVersion) methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	if v == apiV1 {
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		return
+	}
+	v.writeError(w, "MethodNotAllowed", fmt.Sprintf("Only %s is allowed", allow), http.StatusMethodNotAllowed)
+}
+
+// Response envelope all v2 responses are wrapped in. Only one of
+// Data or Error will be set.
+type apiEnvelope struct {
+	// Response payload of a successful request
+	Data interface{} `json:"data"`
+
+	// Error information of a failed request
+	Error *ErrorRsp `json:"error"`
+
+	// Information about the response itself
+	Meta apiMeta `json:"meta"`
+}
+
+// Meta information included with each v2 response
+type apiMeta struct {
+	// API version which served the response
+	Version string `json:"version"`
+}
+
+// Serves the API version's root path with the handler, and responds not found
+// to the version's paths no other route is mounted at. Mounted at the version's
+// path with a trailing '/', e.g: /v2/, so unknown paths of the version are not
+// served by the v1 routes mounted at the HTTP root.
+type apiRootHandler struct {
+	handler http.Handler
+	path    string
+	version apiVersion
+}
+
+func (h *apiRootHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != h.path {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("No route at %s", r.URL.Path), http.StatusNotFound)
+		return
+	}
+	h.handler.ServeHTTP(w, r)
+}
+
+// Wraps a v1 handler so that its responses advertise the route as deprecated,
+// and link to the successor v2 route.
+func deprecated(h http.Handler, successor string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Converts the value into a generic JSON value where all struct field names
+// are snake_case instead of their JSON tag name. Map keys are data, not field
+// names, and are left as is. Values implementing json.Marshaler, e.g. time.Time,
+// are not modified.
+func snakeCaseFields(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return snakeCaseValue(reflect.ValueOf(v))
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+func snakeCaseValue(v reflect.Value) interface{} {
+	if v.Type().Implements(jsonMarshalerType) {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return snakeCaseValue(v.Elem())
+
+	case reflect.Struct:
+		fields := make(map[string]interface{})
+		snakeCaseStruct(v, fields)
+		return fields
+
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		for _, k := range v.MapKeys() {
+			m[fmt.Sprint(k.Interface())] = snakeCaseValue(v.MapIndex(k))
+		}
+		return m
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// byte slices are encoded as base64 strings
+			return v.Interface()
+		}
+		s := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s[i] = snakeCaseValue(v.Index(i))
+		}
+		return s
+	}
+
+	return v.Interface()
+}
+
+// Adds the struct's exported fields to the fields map using the snake_case
+// version of their JSON name. Untagged embedded structs have their fields
+// promoted the same way encoding/json does.
+func snakeCaseStruct(v reflect.Value, fields map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+
+		fv := v.Field(i)
+		if f.Anonymous && name == "" && fv.Kind() == reflect.Struct {
+			snakeCaseStruct(fv, fields)
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported field
+			continue
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[toSnakeCase(name)] = snakeCaseValue(fv)
+	}
+}
+
+// Converts a camelCase or PascalCase name into snake_case. Acronyms, and
+// their plurals, are kept together, e.g: "connURL" => "conn_url",
+// "URLId" => "url_id", "URLs" => "urls".
+func toSnakeCase(name string) string {
+	runes := []rune(name)
+	out := make([]rune, 0, len(runes)+4)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if nextLower && runes[i+1] == 's' && (i+2 == len(runes) || unicode.IsUpper(runes[i+2])) {
+				// plural acronym, e.g: URLs
+				nextLower = false
+			}
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/jwt"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the keys created, so they can be recognized, e.g: by secret scanners
+const apiKeyPrefix = "hv_"
+
+// Maximum size of an API key create request body
+const maxAPIKeyReqSize = 4096
+
+// Key of the request context value of the API key a request was authorized by
+type apiKeyContextKey struct{}
+
+// Key of the request context value of the principal a request authorized by
+// the admin token, or a JWT was authorized as.
+type principalContextKey struct{}
+
+// Principal of requests authorized by the admin token
+const adminPrincipal = "admin"
+
+// Authorizes requests to the web server with the API keys stored in storage,
+// or JWT bearer tokens issued by an identity provider. Keys are sent with the
+// X-API-Key header, or as a bearer token. Requests authorized with the admin
+// token are always accepted, so keys can be managed without one.
+type apiKeyAuth struct {
+	// Token administrators authorize requests with
+	adminToken string
+
+	// Returns the stored key matching the key, nil if unknown
+	lookup func(key string) (*common.APIKey, error)
+
+	// Verifier of JWT bearer tokens. Tokens are not accepted if nil.
+	tokens *jwt.Verifier
+}
+
+// Returns a handler refusing requests to the handler not authorized with an
+// enabled API key, or a valid JWT. If the auth is nil requests are not
+// authorized, and the handler is returned.
+func (a *apiKeyAuth) handler(h http.Handler, version apiVersion) http.Handler {
+	if a == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAdminRequest(r, a.adminToken) {
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, adminPrincipal)))
+			return
+		}
+
+		key := requestAPIKey(r)
+		if key == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="harvester"`)
+			version.writeError(w, "Unauthorized", "API key required", http.StatusUnauthorized)
+			return
+		}
+
+		if a.tokens != nil && jwt.IsToken(key) {
+			claims, err := a.tokens.Verify(key)
+			if err != nil {
+				log.Println("apiKeyAuth request token refused.", err)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="harvester", error="invalid_token"`)
+				version.writeError(w, "Unauthorized", fmt.Sprintf("Invalid token, %v", err), http.StatusUnauthorized)
+				return
+			}
+			log.Println("apiKeyAuth request authorized by token of", claims.Subject)
+			principal := fmt.Sprintf("jwt:%q:%q", claims.Issuer, claims.Subject)
+			h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalContextKey{}, principal)))
+			return
+		}
+
+		apiKey, err := a.lookup(key)
+		if err != nil {
+			log.Println("apiKeyAuth request key lookup failed.", err)
+			version.writeError(w, "DependancyFailure", "Failed to authorize API key", http.StatusInternalServerError)
+			return
+		}
+		if apiKey == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="harvester", error="invalid_token"`)
+			version.writeError(w, "Unauthorized", "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if !apiKey.Enabled {
+			version.writeError(w, "Forbidden", "API key is disabled", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, apiKey)))
+	})
+}
+
+// Returns the id of the API key the request was authorized by, zero if the
+// request was not authorized by a key.
+func requestAPIKeyId(r *http.Request) int64 {
+	if apiKey, ok := r.Context().Value(apiKeyContextKey{}).(*common.APIKey); ok {
+		return apiKey.Id
+	}
+	return 0
+}
+
+// Returns the principal the request was authorized as, scoping what the client
+// owns, e.g: its idempotency keys. API keys are identified by their id, and
+// JWTs by their issuer and subject. Empty if the request was not authorized,
+// e.g: the web server doesn't require API keys.
+func requestPrincipal(r *http.Request) string {
+	if apiKey, ok := r.Context().Value(apiKeyContextKey{}).(*common.APIKey); ok {
+		return fmt.Sprintf("key:%d", apiKey.Id)
+	}
+	if principal, ok := r.Context().Value(principalContextKey{}).(string); ok {
+		return principal
+	}
+	return ""
+}
+
+// Prefix of the WebSocket subprotocol an API key can be sent as, by browsers
+// which can't set the headers of WebSocket requests, e.g: harvester.key.<key>.
+const apiKeyProtocolPrefix = "harvester.key."
+
+// Returns the API key the request was sent with, from the X-API-Key header,
+// the Authorization bearer token, or the WebSocket subprotocol prefixed with
+// apiKeyProtocolPrefix. Empty if the request has no key.
+func requestAPIKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	for _, p := range strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",") {
+		if p = strings.TrimSpace(p); strings.HasPrefix(p, apiKeyProtocolPrefix) {
+			return strings.TrimPrefix(p, apiKeyProtocolPrefix)
+		}
+	}
+	return ""
+}
+
+// Returns a new random API key.
+func newAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + hex.EncodeToString(b), nil
+}
+
+// Body of an API key create request
+type apiKeyReq struct {
+	// Name describing who, or what, the key is for
+	Name string `json:"name"`
+}
+
+// Response to a successful API key create request. The key is only returned
+// when created, only its hash is stored.
+type apiKeyCreatedMsg struct {
+	Key    string        `json:"key"`
+	APIKey common.APIKey `json:"apiKey"`
+}
+
+// Handles the admin requests to list the API keys, and create new keys.
+//
+// GET lists all keys, without the keys themselves.
+//
+// POST creates an enabled key with the name in the JSON body. The key is only
+// returned in the response, and can not be retrieved again.
+//
+// e.g:
+// curl -X POST -H "Authorization: Bearer <token>" "http://localhost:8080/apikeys" --data '{"name": "reporting"}'
+//
+// Response:
+//	- Success: {key: <key>, apiKey: {id: <id>, name: <name>, prefix: <prefix>, enabled: true, createdOn: <time>}}
+//	- Failure: {code: <code>, message: <message>}
+type APIKeyListHandler struct {
+	sc         *storage.Client
+	adminToken string
+	version    apiVersion
+}
+
+func (h *APIKeyListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		h.version.methodNotAllowed(w, "GET, POST")
+		return
+	}
+
+	if !isAdminRequest(r, h.adminToken) {
+		h.version.writeError(w, "Forbidden", "Admin authorization required", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == "POST" {
+		h.serveCreate(w, r)
+		return
+	}
+
+	keys, err := h.sc.APIKeyClient().List()
+	if err != nil {
+		log.Println("routeAPIKeyList request list keys failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, struct {
+		APIKeys []common.APIKey `json:"apiKeys"`
+	}{APIKeys: keys}, http.StatusOK)
+}
+
+// Creates a key with the name in the request's JSON body.
+func (h *APIKeyListHandler) serveCreate(w http.ResponseWriter, r *http.Request) {
+	req := apiKeyReq{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxAPIKeyReqSize)).Decode(&req); err != nil {
+		log.Println("routeAPIKeyList request parse failed.", err)
+		h.version.writeError(w, "BadRequest", "Invalid API key request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		h.version.writeError(w, "BadRequest", "An API key name is required", http.StatusBadRequest)
+		return
+	}
+
+	key, err := newAPIKey()
+	if err != nil {
+		log.Println("routeAPIKeyList request generate key failed.", err)
+		h.version.writeError(w, "InternalError", "Failed to generate API key", http.StatusInternalServerError)
+		return
+	}
+	apiKey, err := h.sc.APIKeyClient().Create(req.Name, key)
+	if err != nil || apiKey == nil {
+		log.Println("routeAPIKeyList request create key failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+	log.Println("routeAPIKeyList API key created", apiKey.Id, apiKey.Name)
+
+	h.version.writeData(w, apiKeyCreatedMsg{Key: key, APIKey: *apiKey}, http.StatusCreated)
+}
+
+// Handles the admin requests to enable, disable, and revoke an API key, and to
+// manage its quota. Disabled keys are refused until enabled again. Revoked keys
+// are deleted.
+//
+// POST: /apikeys/:id/enable, /apikeys/:id/disable
+// DELETE: /apikeys/:id
+// GET, PUT, DELETE: /apikeys/:id/quota, see serveQuota
+//
+// e.g:
+// curl -X POST -H "Authorization: Bearer <token>" "http://localhost:8080/apikeys/12/disable"
+//
+// Response:
+//	- Success: {id: <id>, name: <name>, prefix: <prefix>, enabled: false, createdOn: <time>}
+//	- Failure: {code: <code>, message: <message>}
+type APIKeyHandler struct {
+	sc         *storage.Client
+	adminToken string
+	version    apiVersion
+}
+
+func (h *APIKeyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, action, err := apiKeyPath(r.URL.Path)
+	if err != nil {
+		h.version.writeError(w, "NotFound", err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if action == "quota" {
+		h.serveQuota(w, r, id)
+		return
+	}
+
+	allow := "DELETE"
+	if action != "" {
+		allow = "POST"
+	}
+	if r.Method != allow {
+		h.version.methodNotAllowed(w, allow)
+		return
+	}
+
+	if !isAdminRequest(r, h.adminToken) {
+		h.version.writeError(w, "Forbidden", "Admin authorization required", http.StatusForbidden)
+		return
+	}
+
+	if action == "" {
+		h.serveRevoke(w, id)
+		return
+	}
+
+	apiKey, err := h.sc.APIKeyClient().SetEnabled(id, action == "enable")
+	if err != nil {
+		log.Println("routeAPIKey request", action, "key failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to %s API key %d", action, id), http.StatusInternalServerError)
+		return
+	}
+	if apiKey == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("API key %d does not exist", id), http.StatusNotFound)
+		return
+	}
+	log.Println("routeAPIKey API key", action+"d", id)
+
+	h.version.writeData(w, apiKey, http.StatusOK)
+}
+
+// Revokes the key, deleting it.
+func (h *APIKeyHandler) serveRevoke(w http.ResponseWriter, id int64) {
+	revoked, err := h.sc.APIKeyClient().Revoke(id)
+	if err != nil {
+		log.Println("routeAPIKey request revoke key failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to revoke API key %d", id), http.StatusInternalServerError)
+		return
+	}
+	if !revoked {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("API key %d does not exist", id), http.StatusNotFound)
+		return
+	}
+	log.Println("routeAPIKey API key revoked", id)
+
+	h.version.writeData(w, struct {
+		Id      int64 `json:"id"`
+		Revoked bool  `json:"revoked"`
+	}{Id: id, Revoked: true}, http.StatusOK)
+}
+
+// Parses the key id, and the action, enable, disable, or quota from the
+// request path, /apikeys/:id[/<action>]. The action is empty if not provided.
+func apiKeyPath(p string) (int64, string, error) {
+	idStr, action := path.Base(p), ""
+	if idStr == "enable" || idStr == "disable" || idStr == "quota" {
+		idStr, action = path.Base(path.Dir(p)), idStr
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, "", fmt.Errorf("Unknown API key resource")
+	}
+	return id, action, nil
+}
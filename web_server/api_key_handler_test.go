@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/jwt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	auth := &apiKeyAuth{adminToken: "admin", lookup: func(key string) (*common.APIKey, error) {
+		switch key {
+		case "enabled":
+			return &common.APIKey{Id: 1, Enabled: true}, nil
+		case "disabled":
+			return &common.APIKey{Id: 2}, nil
+		case "failed":
+			return nil, fmt.Errorf("storage unavailable")
+		}
+		return nil, nil
+	}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Key-Id", fmt.Sprint(requestAPIKeyId(r)))
+		w.Header().Set("X-Principal", requestPrincipal(r))
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := auth.handler(next, apiV2)
+
+	cases := []struct {
+		header, value string
+		status        int
+		keyId         string
+		principal     string
+	}{
+		{"", "", http.StatusUnauthorized, "", ""},
+		{"X-API-Key", "enabled", http.StatusTeapot, "1", "key:1"},
+		{"Authorization", "Bearer enabled", http.StatusTeapot, "1", "key:1"},
+		{"Authorization", "Bearer admin", http.StatusTeapot, "0", "admin"},
+		{"Sec-WebSocket-Protocol", "harvester.feed, harvester.key.enabled", http.StatusTeapot, "1", "key:1"},
+		{"Sec-WebSocket-Protocol", "harvester.feed", http.StatusUnauthorized, "", ""},
+		{"X-API-Key", "unknown", http.StatusUnauthorized, "", ""},
+		{"X-API-Key", "disabled", http.StatusForbidden, "", ""},
+		{"X-API-Key", "failed", http.StatusInternalServerError, "", ""},
+	}
+	for _, c := range cases {
+		r, _ := http.NewRequest("GET", "/v2/jobs", nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		assert.Equal(t, c.status, w.Code, "Expect status of %s %q", c.header, c.value)
+		assert.Equal(t, c.keyId, w.Header().Get("X-Key-Id"), "Expect key id of %s %q", c.header, c.value)
+		assert.Equal(t, c.principal, w.Header().Get("X-Principal"), "Expect principal of %s %q", c.header, c.value)
+	}
+
+	// Tokens are verified instead of being looked up as keys.
+	auth.tokens = jwt.NewVerifier(jwt.Config{Issuer: "https://login.example.com", JWKSURL: "http://127.0.0.1:0/keys"})
+	r, _ := http.NewRequest("GET", "/v2/jobs", nil)
+	r.Header.Set("Authorization", "Bearer a.b.c")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Expect unverified token refused")
+
+	var none *apiKeyAuth
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/v2/jobs", nil)
+	none.handler(next, apiV2).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTeapot, w.Code, "Expect requests not authorized without auth")
+}
+
+func TestAPIKeyPath(t *testing.T) {
+	id, action, err := apiKeyPath("/v2/apikeys/12")
+	assert.NoError(t, err, "Expect key path")
+	assert.Equal(t, int64(12), id, "Expect key id")
+	assert.Empty(t, action, "Expect no action")
+
+	id, action, err = apiKeyPath("/apikeys/12/disable")
+	assert.NoError(t, err, "Expect key action path")
+	assert.Equal(t, int64(12), id, "Expect key id")
+	assert.Equal(t, "disable", action, "Expect key action")
+
+	id, action, err = apiKeyPath("/apikeys/12/quota")
+	assert.NoError(t, err, "Expect key quota path")
+	assert.Equal(t, int64(12), id, "Expect key id")
+	assert.Equal(t, "quota", action, "Expect key quota")
+
+	for _, p := range []string{"/apikeys/", "/apikeys/abc", "/apikeys/12/rename", "/apikeys/0/enable"} {
+		_, _, err := apiKeyPath(p)
+		assert.Error(t, err, "Expect invalid key path %s", p)
+	}
+}
+
+func TestNewAPIKey(t *testing.T) {
+	a, err := newAPIKey()
+	assert.NoError(t, err, "Expect key")
+	b, _ := newAPIKey()
+	assert.True(t, strings.HasPrefix(a, apiKeyPrefix), "Expect key prefix")
+	assert.Len(t, a, len(apiKeyPrefix)+48, "Expect key length")
+	assert.NotEqual(t, a, b, "Expect random keys")
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Maximum size of an API key quota request body
+const maxQuotaReqSize = 4096
+
+// Body of an API key quota request. Limits of zero are not enforced.
+type apiKeyQuotaReq struct {
+	URLs    int64  `json:"urls"`
+	Bytes   int64  `json:"bytes"`
+	Jobs    int64  `json:"jobs"`
+	Webhook string `json:"webhook"`
+}
+
+// Response to an API key quota request
+type apiKeyQuotaMsg struct {
+	Quota common.APIKeyQuota `json:"quota"`
+
+	// Month the usage is of, UTC, e.g: 2015-01
+	Month string                  `json:"month"`
+	Usage common.APIKeyQuotaUsage `json:"usage"`
+}
+
+// Handles the admin requests for an API key's monthly quota. Once the key's
+// jobs have requested the quota's URLs, or downloaded its bytes, or the quota's
+// jobs have been scheduled with the key within the month, requests to schedule
+// jobs with the key are refused until the next month. The quota's webhook is
+// notified by the foreman as the key's usage crosses the foreman's quota
+// thresholds.
+//
+// GET returns the key's quota, and its usage within the current month.
+//
+// PUT sets the key's quota to the JSON body, replacing any previous quota.
+//
+// DELETE removes the key's quota.
+//
+// e.g:
+// curl -X PUT -H "Authorization: Bearer <token>" "http://localhost:8080/apikeys/12/quota" --data '{"urls": 100000, "jobs": 100, "webhook": "https://example.com/quota"}'
+//
+// Response:
+//	- Success: {quota: {apiKeyId: 12, urls: 100000, bytes: 0, jobs: 100, webhook: <webhook>}, month: "2015-01", usage: {urls: 512, bytes: 1048576, jobs: 3}}
+//	- Failure: {code: <code>, message: <message>}
+func (h *APIKeyHandler) serveQuota(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != "GET" && r.Method != "PUT" && r.Method != "DELETE" {
+		h.version.methodNotAllowed(w, "GET, PUT, DELETE")
+		return
+	}
+
+	if !isAdminRequest(r, h.adminToken) {
+		h.version.writeError(w, "Forbidden", "Admin authorization required", http.StatusForbidden)
+		return
+	}
+
+	keyClient := h.sc.APIKeyClient()
+	if apiKey, err := keyClient.Get(id); err != nil {
+		log.Println("routeAPIKeyQuota request get key failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get API key %d", id), http.StatusInternalServerError)
+		return
+	} else if apiKey == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("API key %d does not exist", id), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		quota, err := getRequestedQuota(io.LimitReader(r.Body, maxQuotaReqSize))
+		if err != nil {
+			log.Println("routeAPIKeyQuota request invalid quota.", err)
+			h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+			return
+		}
+		quota.APIKeyId = id
+		if err := keyClient.SetQuota(quota); err != nil {
+			log.Println("routeAPIKeyQuota request set quota failed.", id, err)
+			h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to set API key %d quota", id), http.StatusInternalServerError)
+			return
+		}
+		log.Println("routeAPIKeyQuota API key quota set", id)
+	case "DELETE":
+		deleted, err := keyClient.DeleteQuota(id)
+		if err != nil {
+			log.Println("routeAPIKeyQuota request delete quota failed.", id, err)
+			h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to delete API key %d quota", id), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			h.version.writeError(w, "NotFound", fmt.Sprintf("API key %d has no quota", id), http.StatusNotFound)
+			return
+		}
+		log.Println("routeAPIKeyQuota API key quota deleted", id)
+		h.version.writeData(w, struct {
+			Id      int64 `json:"id"`
+			Deleted bool  `json:"deleted"`
+		}{Id: id, Deleted: true}, http.StatusOK)
+		return
+	}
+
+	quota, err := keyClient.GetQuota(id)
+	if err != nil {
+		log.Println("routeAPIKeyQuota request get quota failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get API key %d quota", id), http.StatusInternalServerError)
+		return
+	}
+	if quota == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("API key %d has no quota", id), http.StatusNotFound)
+		return
+	}
+
+	now := time.Now().UTC()
+	usage, err := keyClient.QuotaUsage(id, now)
+	if err != nil {
+		log.Println("routeAPIKeyQuota request quota usage failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get API key %d usage", id), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, apiKeyQuotaMsg{
+		Quota: *quota,
+		Month: now.Format(common.UsageMonthFormat),
+		Usage: usage,
+	}, http.StatusOK)
+}
+
+// Reads, and validates the quota of the request body.
+func getRequestedQuota(in io.Reader) (common.APIKeyQuota, error) {
+	req := apiKeyQuotaReq{}
+	if err := json.NewDecoder(in).Decode(&req); err != nil {
+		return common.APIKeyQuota{}, fmt.Errorf("Invalid API key quota request body")
+	}
+	if req.URLs < 0 || req.Bytes < 0 || req.Jobs < 0 {
+		return common.APIKeyQuota{}, fmt.Errorf("Quota limits must be positive, or zero to not be enforced")
+	}
+	if req.Webhook != "" {
+		if u, err := url.Parse(req.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return common.APIKeyQuota{}, fmt.Errorf("Invalid webhook %s, must be an absolute http or https URL", req.Webhook)
+		}
+	}
+
+	return common.APIKeyQuota{URLs: req.URLs, Bytes: req.Bytes, Jobs: req.Jobs, Webhook: req.Webhook}, nil
+}
+
+// Refuses the request with 403 if the API key it was authorized by has used
+// any of its monthly quota, or has fewer jobs left of it than the request
+// schedules, and returns false. Requests not authorized by a key, or of keys
+// without a quota are not refused.
+func checkQuota(sc *storage.Client, w http.ResponseWriter, r *http.Request, version apiVersion, jobs int) bool {
+	id := requestAPIKeyId(r)
+	if id == 0 {
+		return true
+	}
+
+	msg, err := quotaExceeded(sc, id, time.Now().UTC(), jobs)
+	if err != nil {
+		log.Println("checkQuota failed.", id, err)
+		version.writeError(w, "DependancyFailure", "Failed to check API key quota", http.StatusInternalServerError)
+		return false
+	}
+	if msg != "" {
+		log.Println("checkQuota API key", id, "exceeded its quota.", msg)
+		version.writeError(w, "QuotaExceeded", msg, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// Returns the message of the API key's quota exceeded within the month of
+// now, or which scheduling the number of jobs would exceed, empty if the key
+// has no quota, or wouldn't exceed it.
+func quotaExceeded(sc *storage.Client, id int64, now time.Time, jobs int) (string, error) {
+	keyClient := sc.APIKeyClient()
+	quota, err := keyClient.GetQuota(id)
+	if err != nil || quota == nil {
+		return "", err
+	}
+
+	usage, err := keyClient.QuotaUsage(id, now)
+	if err != nil {
+		return "", err
+	}
+	metric := quota.Exceeded(usage, int64(jobs))
+	if metric == "" {
+		return "", nil
+	}
+	msg := quotaExceededMsg(*quota, metric, now)
+	if metric == common.QuotaJobs && jobs > 1 && usage.Jobs < quota.Jobs {
+		msg = fmt.Sprintf("%s, %d jobs requested, but %d remain", msg, jobs, quota.Jobs-usage.Jobs)
+	}
+	return msg, nil
+}
+
+// Returns the message of the quota's metric exceeded within the month of now.
+func quotaExceededMsg(quota common.APIKeyQuota, metric string, now time.Time) string {
+	resets := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return fmt.Sprintf("Monthly %s quota of %d exceeded, resets on %s",
+		metric, quota.Limit(metric), resets.Format("2006-01-02"))
+}
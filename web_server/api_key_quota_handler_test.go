@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRequestedQuota(t *testing.T) {
+	quota, err := getRequestedQuota(strings.NewReader(`{"urls": 1000, "jobs": 10, "webhook": "https://example.com/quota"}`))
+	assert.NoError(t, err, "Expect valid quota")
+	assert.Equal(t, common.APIKeyQuota{URLs: 1000, Jobs: 10, Webhook: "https://example.com/quota"}, quota, "Expect requested quota")
+
+	for _, body := range []string{
+		`not JSON`,
+		`{"urls": -1}`,
+		`{"bytes": -1}`,
+		`{"jobs": 1, "webhook": "/quota"}`,
+		`{"jobs": 1, "webhook": "ftp://example.com/quota"}`,
+	} {
+		_, err := getRequestedQuota(strings.NewReader(body))
+		assert.Error(t, err, "Expect invalid quota %s", body)
+	}
+}
+
+func TestQuotaExceededMsg(t *testing.T) {
+	now := time.Date(2015, 12, 14, 15, 9, 26, 0, time.UTC)
+	msg := quotaExceededMsg(common.APIKeyQuota{Jobs: 10}, common.QuotaJobs, now)
+	assert.Equal(t, "Monthly jobs quota of 10 exceeded, resets on 2016-01-01", msg, "Expect quota, and reset in message")
+}
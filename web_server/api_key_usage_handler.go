@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Number of months, including the current month, usage is reported for if
+// no range is requested.
+const defaultUsageMonths = 12
+
+// Response to a successful API key usage request
+type apiKeyUsageMsg struct {
+	// First, and last month of the report, inclusive
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Usage of each key, in each month the key's jobs were crawled
+	Usage []common.APIKeyUsage `json:"usage"`
+}
+
+// Handles the admin request for the usage report of the API keys, so the
+// crawls of the jobs scheduled with each key can be charged back. Usage is
+// rolled up by month in UTC, and includes the URLs requested, the bytes
+// downloaded, and the minutes the workers spent crawling. Only jobs scheduled
+// while requests were authorized by the key are attributed to it.
+//
+// The optional 'from', and 'to' query parameters are the first, and last month
+// of the report in the form YYYY-MM, and default to the last 12 months. The
+// optional 'apiKey' query parameter restricts the report to the key's id.
+//
+// e.g:
+// curl -H "Authorization: Bearer <token>" "http://localhost:8080/apikeys/usage?from=2015-01&to=2015-03"
+//
+// Response:
+//	- Success: {from: "2015-01", to: "2015-03", usage: [{apiKeyId: 12, name: "reporting", month: "2015-01", urls: 1024, bytes: 52428800, crawlMinutes: 42.5}]}
+//	- Failure: {code: <code>, message: <message>}
+type APIKeyUsageHandler struct {
+	sc         *storage.Client
+	adminToken string
+	version    apiVersion
+}
+
+func (h *APIKeyUsageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	if !isAdminRequest(r, h.adminToken) {
+		h.version.writeError(w, "Forbidden", "Admin authorization required", http.StatusForbidden)
+		return
+	}
+
+	keyId, from, to, err := getRequestedUsage(r.URL.Query(), time.Now().UTC())
+	if err != nil {
+		log.Println("routeAPIKeyUsage request invalid.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	usage, err := h.sc.APIKeyClient().Usage(keyId, from, to)
+	if err != nil {
+		log.Println("routeAPIKeyUsage request usage failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to get API key usage", http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, apiKeyUsageMsg{
+		From:  from.Format(common.UsageMonthFormat),
+		To:    to.Format(common.UsageMonthFormat),
+		Usage: usage,
+	}, http.StatusOK)
+}
+
+// Parses the key id, and the first, and last month of the usage requested.
+// The months default to the defaultUsageMonths up to the current month.
+func getRequestedUsage(query url.Values, now time.Time) (int64, time.Time, time.Time, error) {
+	var keyId int64
+	if v := query.Get("apiKey"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return 0, time.Time{}, time.Time{}, fmt.Errorf("Invalid apiKey %q, must be an API key id", v)
+		}
+		keyId = id
+	}
+
+	to := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if v := query.Get("to"); v != "" {
+		t, err := time.Parse(common.UsageMonthFormat, v)
+		if err != nil {
+			return 0, time.Time{}, time.Time{}, fmt.Errorf("Invalid to month %q, must be YYYY-MM", v)
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 1-defaultUsageMonths, 0)
+	if v := query.Get("from"); v != "" {
+		t, err := time.Parse(common.UsageMonthFormat, v)
+		if err != nil {
+			return 0, time.Time{}, time.Time{}, fmt.Errorf("Invalid from month %q, must be YYYY-MM", v)
+		}
+		from = t
+	}
+	if from.After(to) {
+		return 0, time.Time{}, time.Time{}, fmt.Errorf("Invalid range, from month %s is after to month %s",
+			from.Format(common.UsageMonthFormat), to.Format(common.UsageMonthFormat))
+	}
+
+	return keyId, from, to, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetRequestedUsage(t *testing.T) {
+	now := time.Date(2015, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	keyId, from, to, err := getRequestedUsage(url.Values{}, now)
+	assert.NoError(t, err, "Expect default usage range")
+	assert.Equal(t, int64(0), keyId, "Expect all keys")
+	assert.Equal(t, time.Date(2014, 4, 1, 0, 0, 0, 0, time.UTC), from, "Expect 12 months up to the current month")
+	assert.Equal(t, time.Date(2015, 3, 1, 0, 0, 0, 0, time.UTC), to, "Expect current month")
+
+	keyId, from, to, err = getRequestedUsage(url.Values{"apiKey": {"12"}, "from": {"2015-01"}, "to": {"2015-02"}}, now)
+	assert.NoError(t, err, "Expect requested usage range")
+	assert.Equal(t, int64(12), keyId, "Expect requested key")
+	assert.Equal(t, time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), from, "Expect requested from month")
+	assert.Equal(t, time.Date(2015, 2, 1, 0, 0, 0, 0, time.UTC), to, "Expect requested to month")
+
+	for _, q := range []url.Values{
+		{"apiKey": {"abc"}},
+		{"apiKey": {"0"}},
+		{"from": {"2015-13"}},
+		{"to": {"2015-01-02"}},
+		{"from": {"2015-03"}, "to": {"2015-01"}},
+	} {
+		_, _, _, err := getRequestedUsage(q, now)
+		assert.Error(t, err, "Expect invalid usage request %v", q)
+	}
+}
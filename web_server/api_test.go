@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type snakeCaseTestCase struct {
+	in  string
+	out string
+}
+
+var snakeCaseTestCases = []snakeCaseTestCase{
+	{in: "jobId", out: "job_id"},
+	{in: "connURL", out: "conn_url"},
+	{in: "URLId", out: "url_id"},
+	{in: "urls", out: "urls"},
+	{in: "URLs", out: "urls"},
+	{in: "httpRootPath", out: "http_root_path"},
+	{in: "Completed", out: "completed"},
+}
+
+func TestToSnakeCase(t *testing.T) {
+	for _, c := range snakeCaseTestCases {
+		assert.Equal(t, c.out, toSnakeCase(c.in), "Expect snake case of %s to match", c.in)
+	}
+}
+
+func TestSnakeCaseFields(t *testing.T) {
+	type inner struct {
+		ReferURL string `json:"referURL"`
+	}
+	data := struct {
+		JobId    int             `json:"jobId"`
+		Skipped  string          `json:"-"`
+		Empty    string          `json:"emptyField,omitempty"`
+		URLs     map[string]bool `json:"urls"`
+		Children []inner         `json:"children"`
+	}{
+		JobId:    1234,
+		Skipped:  "skipped",
+		URLs:     map[string]bool{"http://example.com/someURL": true},
+		Children: []inner{{ReferURL: "http://example.com"}},
+	}
+
+	buf, err := json.Marshal(snakeCaseFields(data))
+	require.Nil(t, err, "Expect no marshal error")
+	assert.JSONEq(t, `{
+		"job_id": 1234,
+		"urls": {"http://example.com/someURL": true},
+		"children": [{"refer_url": "http://example.com"}]
+	}`, string(buf), "Expect field names to be snake case, and map keys unchanged")
+}
+
+func TestWriteAPIVersions(t *testing.T) {
+	data := jobScheduledMsg{JobId: 1234, Seeds: []string{"http://example.com"}, Options: jobOptionsMsg{ForceCrawl: true}, StatusURL: "/status/1234"}
+
+	w := httptest.NewRecorder()
+	apiV1.writeData(w, data, http.StatusOK)
+	assert.JSONEq(t, `{"jobId": 1234, "seeds": ["http://example.com"], "options": {"forceCrawl": true, "delta": false, "noFetchCache": false, "skipAlternates": false, "download": false}, "statusURL": "/status/1234", "resultURL": ""}`,
+		w.Body.String(), "v1 should not be enveloped")
+
+	w = httptest.NewRecorder()
+	apiV2.writeData(w, data, http.StatusOK)
+	assert.JSONEq(t, `{"data": {"job_id": 1234, "seeds": ["http://example.com"], "options": {"force_crawl": true, "delta": false, "no_fetch_cache": false, "skip_alternates": false, "download": false}, "status_url": "/status/1234", "result_url": ""}, "error": null, "meta": {"version": "v2"}}`,
+		w.Body.String(), "v2 should be enveloped")
+
+	w = httptest.NewRecorder()
+	apiV2.writeError(w, "NotFound", "Job not found", http.StatusNotFound)
+	assert.Equal(t, http.StatusNotFound, w.Code, "Code should be set")
+	assert.JSONEq(t, `{"data": null, "error": {"code": "NotFound", "message": "Job not found"}, "meta": {"version": "v2"}}`, w.Body.String(), "v2 error should be enveloped")
+}
+
+func TestAPIVersionPath(t *testing.T) {
+	assert.Equal(t, "/goapps/harvester", apiV1.path("/goapps/harvester", ""), "v1 route is under root")
+	assert.Equal(t, "/goapps/harvester/status/", apiV1.path("/goapps/harvester", "status/"), "Trailing slash should be kept")
+	assert.Equal(t, "/goapps/harvester/v2/status/", apiV2.path("/goapps/harvester", "status/"), "v2 route is prefixed")
+	assert.Equal(t, "/v2", apiV2.path("", ""), "v2 route with empty root")
+	assert.Equal(t, "/v2/", apiV2.path("", "/"), "v2 root with trailing slash")
+}
+
+func TestAPIRootHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("v1"))
+	}))
+	root := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("root"))
+	})
+	mux.Handle(apiV2.path("/harvester", ""), root)
+	mux.Handle(apiV2.path("/harvester", "/"), &apiRootHandler{handler: root, path: apiV2.path("/harvester", "/"), version: apiV2})
+
+	for _, p := range []string{"/harvester/v2", "/harvester/v2/"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", p, nil))
+		assert.Equal(t, "root", w.Body.String(), "Expect %s served by the root handler", p)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/harvester/v2/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"data": null, "error": {"code": "NotFound", "message": "No route at /harvester/v2/unknown"}, "meta": {"version": "v2"}}`, w.Body.String(), "Expect v2 not found")
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"golang.org/x/net/websocket"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Interval the crawl log is polled for the live crawl feed's events.
+const crawlFeedInterval = time.Second
+
+// Most requests, and skipped crawls, read for each query of the feed.
+const crawlFeedBatch = 500
+
+// Longest an event may take to be sent before the client is assumed gone.
+const crawlFeedWriteTimeout = 10 * time.Second
+
+// WebSocket subprotocol of the feed. Browsers sending their API key as a
+// subprotocol must also request this one, so the handshake selects it instead
+// of echoing the key back.
+const crawlFeedProtocol = "harvester.feed"
+
+// Handles the request to follow the crawls of all jobs, or one job, live over
+// a WebSocket. Each URL the workers request is pushed as a fetched event, or
+// an errored event if the request fails or responds with an error status.
+// Crawls skipped before their URL is requested, e.g: disallowed by robots.txt,
+// are pushed as skipped events with the reason they were skipped. Only crawls
+// made after the connection is opened are pushed, polled from the crawl log,
+// so they are delayed by up to the poll interval. The optional 'job' query
+// parameter limits the feed to the job's crawls, and the optional 'domain'
+// query parameter to the crawls of URLs of the domain, or its sub domains.
+// Messages sent by the client are ignored. If the job does not exist a 404
+// status code and message will be returned.
+//
+// Browsers can't set the headers of WebSocket requests, so they may send their
+// API key as the subprotocol "harvester.key.<key>", along with the
+// "harvester.feed" subprotocol. Connections from browsers are only accepted
+// from the web server's own origin, or the configured origins. Clients which
+// don't send an origin, e.g: command line tools, are accepted.
+//
+// e.g:
+// websocat "ws://localhost:8080/feed?job=1234&domain=example.com"
+//
+// Response:
+//	- Success: {event: "fetched", jobId: 1234, url: <url>, on: <time>, status: 200, bytes: 5120, durationMs: 230} ...
+//	- Success: {event: "skipped", jobId: 1234, url: <url>, on: <time>, reason: "robots-disallowed"} ...
+//	- Failure: {code: <code>, message: <message>}
+type CrawlFeedHandler struct {
+	sc *storage.Client
+
+	// Origins, other than the web server's own, browsers are allowed to
+	// connect from, e.g: https://dashboard.example.com.
+	origins []string
+
+	version apiVersion
+}
+
+func (h *CrawlFeedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	filter, err := getCrawlFeedFilter(r.URL.Query())
+	if err != nil {
+		log.Println("routeCrawlFeed invalid parameters.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.jobId != common.InvalidId {
+		if jobErr := jobMustExist(h.sc, filter.jobId, "crawlFeed"); jobErr != nil {
+			log.Println("routeCrawlFeed request job failed.", jobErr)
+			h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+			return
+		}
+	}
+
+	cursor, err := h.sc.JobClient().LatestCrawlFeedCursor()
+	if err != nil {
+		log.Println("routeCrawlFeed request crawl log failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to get crawl feed", http.StatusInternalServerError)
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: h.handshake,
+		Handler: func(ws *websocket.Conn) {
+			if err := h.stream(ws, filter, cursor); err != nil {
+				log.Println("routeCrawlFeed feed ended.", err)
+			}
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// Refuses connections from browsers of other origins, so pages of other sites
+// can't follow the feed with their visitor's credentials. Selects the feed's
+// subprotocol if requested, and never the API key's.
+func (h *CrawlFeedHandler) handshake(cfg *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(cfg, r)
+	if err != nil {
+		return err
+	}
+	if origin != nil && !h.allowOrigin(origin, r) {
+		log.Println("routeCrawlFeed request origin refused.", origin)
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+	cfg.Origin = origin
+
+	protocols := cfg.Protocol
+	cfg.Protocol = nil
+	for _, p := range protocols {
+		if p == crawlFeedProtocol {
+			cfg.Protocol = []string{p}
+		}
+	}
+	return nil
+}
+
+// Returns true if the origin is the web server's own, or one of the
+// configured origins.
+func (h *CrawlFeedHandler) allowOrigin(origin *url.URL, r *http.Request) bool {
+	if strings.EqualFold(origin.Host, r.Host) {
+		return true
+	}
+	o := origin.Scheme + "://" + origin.Host
+	for _, allowed := range h.origins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), o) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pushes the crawls made after the cursor which match the filter to the
+// client, until the client closes the connection.
+func (h *CrawlFeedHandler) stream(ws *websocket.Conn, filter crawlFeedFilter, cursor storage.CrawlFeedCursor) error {
+	// Reading fails once the client closes the connection.
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, ws)
+		close(closed)
+	}()
+
+	ticker := time.NewTicker(crawlFeedInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return nil
+		case <-ticker.C:
+		}
+
+		for {
+			events, next, err := h.sc.JobClient().CrawlFeedSince(cursor, filter.jobId, crawlFeedBatch)
+			if err != nil {
+				return err
+			}
+			cursor = next
+			if len(events) == 0 {
+				break
+			}
+
+			for _, e := range events {
+				if !filter.match(e) {
+					continue
+				}
+				ws.SetWriteDeadline(time.Now().Add(crawlFeedWriteTimeout))
+				if err := websocket.JSON.Send(ws, e); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// Crawls pushed to a client of the live crawl feed.
+type crawlFeedFilter struct {
+	// Job whose crawls are pushed, common.InvalidId for all jobs.
+	jobId common.JobId
+
+	// Lower cased domain whose crawls are pushed, including those of its
+	// sub domains. Empty for all domains.
+	domain string
+}
+
+// Reads the feed's filter from the query's 'job' and 'domain' parameters. An
+// error is returned if either is invalid.
+func getCrawlFeedFilter(query url.Values) (crawlFeedFilter, error) {
+	filter := crawlFeedFilter{jobId: common.InvalidId}
+	if v := query.Get("job"); v != "" {
+		id, err := jobIdFromString(v)
+		if err != nil {
+			return filter, err
+		}
+		filter.jobId = id
+	}
+
+	filter.domain = strings.Trim(strings.ToLower(strings.TrimSpace(query.Get("domain"))), ".")
+	if strings.ContainsAny(filter.domain, "/:@ ") {
+		return filter, fmt.Errorf("Invalid domain: %s", query.Get("domain"))
+	}
+
+	return filter, nil
+}
+
+// Returns true if the crawl event should be pushed by the feed.
+func (f crawlFeedFilter) match(e common.CrawlFeedEvent) bool {
+	if f.jobId != common.InvalidId && e.JobId != f.jobId {
+		return false
+	}
+	if f.domain == "" {
+		return true
+	}
+
+	host := common.URLHost(e.URL)
+	return host == f.domain || strings.HasSuffix(host, "."+f.domain)
+}
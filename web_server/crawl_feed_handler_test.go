@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGetCrawlFeedFilter(t *testing.T) {
+	filter, err := getCrawlFeedFilter(url.Values{})
+	require.NoError(t, err, "Expect no error")
+	assert.Equal(t, crawlFeedFilter{jobId: common.InvalidId}, filter, "Expect all crawls")
+
+	filter, err = getCrawlFeedFilter(url.Values{"job": []string{"1234"}, "domain": []string{" Example.com. "}})
+	require.NoError(t, err, "Expect no error")
+	assert.Equal(t, crawlFeedFilter{jobId: 1234, domain: "example.com"}, filter, "Expect job and domain filter")
+
+	for _, q := range []url.Values{
+		url.Values{"job": []string{"abc"}},
+		url.Values{"domain": []string{"http://example.com"}},
+		url.Values{"domain": []string{"example.com:8080"}},
+	} {
+		_, err := getCrawlFeedFilter(q)
+		assert.Error(t, err, "Expect %v invalid", q)
+	}
+}
+
+func TestCrawlFeedFilterMatch(t *testing.T) {
+	filter := crawlFeedFilter{jobId: 1234, domain: "example.com"}
+
+	assert.True(t, filter.match(common.CrawlFeedEvent{JobId: 1234, URL: "http://example.com/a"}), "Expect domain matched")
+	assert.True(t, filter.match(common.CrawlFeedEvent{JobId: 1234, URL: "https://www.EXAMPLE.com:8080/a"}), "Expect sub domain matched")
+	assert.False(t, filter.match(common.CrawlFeedEvent{JobId: 1234, URL: "http://notexample.com/a"}), "Expect other domain not matched")
+	assert.False(t, filter.match(common.CrawlFeedEvent{JobId: 99, URL: "http://example.com/a"}), "Expect other job not matched")
+
+	all := crawlFeedFilter{jobId: common.InvalidId}
+	assert.True(t, all.match(common.CrawlFeedEvent{JobId: 99, URL: "http://other.com/a"}), "Expect all crawls matched")
+}
+
+func TestCrawlFeedHandshake(t *testing.T) {
+	h := &CrawlFeedHandler{origins: []string{"https://dashboard.example.com/"}}
+	cases := []struct {
+		origin    string
+		protocols []string
+		err       bool
+		protocol  []string
+	}{
+		{origin: "", protocols: nil},
+		{origin: "http://harvester.example.com", protocols: []string{"harvester.feed", "harvester.key.abc"}, protocol: []string{"harvester.feed"}},
+		{origin: "https://Dashboard.example.com", protocols: []string{"harvester.key.abc"}},
+		{origin: "https://evil.example.com", err: true},
+		{origin: "https://dashboard.example.com.evil.com", err: true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "http://harvester.example.com/feed", nil)
+		if c.origin != "" {
+			r.Header.Set("Origin", c.origin)
+		}
+		cfg := &websocket.Config{Version: websocket.ProtocolVersionHybi13, Protocol: c.protocols}
+		err := h.handshake(cfg, r)
+		if c.err {
+			assert.Error(t, err, "Expect origin %q refused", c.origin)
+			continue
+		}
+		require.NoError(t, err, "Expect origin %q allowed", c.origin)
+		assert.Equal(t, c.protocol, cfg.Protocol, "Expect only feed protocol selected for %q", c.origin)
+	}
+}
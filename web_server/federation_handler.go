@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout of requests made to federated peers
+const peerRequestTimeout = 10 * time.Second
+
+// Harvester web server whose jobs are federated with this instance's.
+type PeerConfig struct {
+	// Name the peer's jobs are listed under, e.g: eu-west
+	Name string `json:"name"`
+
+	// Base URL of the peer's web server including its HTTP root path,
+	// e.g: http://eu.example.com:8080/goapps/harvester
+	URL string `json:"url"`
+
+	// API key the peer's requests are authorized with, if the peer
+	// requires API keys.
+	APIKey string `json:"apiKey"`
+}
+
+// Error response returned by a peer
+type peerError struct {
+	status int
+	rsp    ErrorRsp
+}
+
+func (e *peerError) Error() string {
+	return fmt.Sprintf("peer responded with %d %s, %s", e.status, e.rsp.Code, e.rsp.Msg)
+}
+
+// Client for requesting a peer's v2 API.
+type peerClient struct {
+	PeerConfig
+	client *http.Client
+}
+
+// Requests the peer's v2 API route, returning the response envelope's data.
+// A *peerError is returned if the peer responded with an error.
+func (p *peerClient) get(route string) (json.RawMessage, error) {
+	u := strings.TrimSuffix(p.URL, "/") + "/" + apiV2.String() + "/" + route
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.APIKey != "" {
+		req.Header.Set("X-API-Key", p.APIKey)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	rsp := struct {
+		Data  json.RawMessage `json:"data"`
+		Error *ErrorRsp       `json:"error"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&rsp); err != nil {
+		return nil, fmt.Errorf("invalid response from %s, %v", u, err)
+	}
+	if rsp.Error != nil {
+		return nil, &peerError{status: resp.StatusCode, rsp: *rsp.Error}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d from %s", resp.StatusCode, u)
+	}
+
+	return rsp.Data, nil
+}
+
+// Creates clients for each of the configured peers.
+func newPeerClients(peers []PeerConfig) []*peerClient {
+	client := &http.Client{Timeout: peerRequestTimeout}
+	clients := make([]*peerClient, 0, len(peers))
+	for _, p := range peers {
+		clients = append(clients, &peerClient{PeerConfig: p, client: client})
+	}
+	return clients
+}
+
+// Jobs listed by a single harvester instance
+type instanceJobs struct {
+	// Name of the instance
+	Instance string `json:"instance"`
+
+	// The instance's job list. Nil if the instance could not be reached.
+	Jobs interface{} `json:"jobs"`
+
+	// Reason the instance's jobs could not be listed.
+	Error string `json:"error,omitempty"`
+}
+
+// Response to a successful federated job list request
+type federatedJobsMsg struct {
+	Instances []instanceJobs `json:"instances"`
+}
+
+// Handles the request to list the most recent jobs of this instance and all
+// of its configured peers. Peers are requested concurrently, and a peer which
+// can not be reached is listed with an error instead of failing the request.
+// The 'limit' query parameter is applied to each instance. Only served by the
+// v2 API, because peer responses are passed through in their v2 form.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/v2/federated/jobs?limit=10"
+//
+// Response:
+//	- Success: {instances: [{instance: "local", jobs: [{id: 1234, ...}, ...]}, {instance: "eu-west", jobs: null, error: <message>}]}
+//	- Failure: {code: <code>, message: <message>}
+type FederatedJobsHandler struct {
+	sc       *storage.Client
+	instance string
+	peers    []*peerClient
+	version  apiVersion
+}
+
+func (h *FederatedJobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	limit, err := jobListLimit(r)
+	if err != nil {
+		log.Println("routeFederatedJobs invalid limit.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	instances := make([]instanceJobs, len(h.peers)+1)
+	instances[0].Instance = h.instance
+	if jobs, err := h.sc.JobClient().ListJobs(storage.JobListFilter{}, limit, 0); err != nil {
+		log.Println("routeFederatedJobs request local job list failed.", err)
+		instances[0].Error = "Failed to list jobs"
+	} else {
+		instances[0].Jobs = jobs
+	}
+
+	var wg sync.WaitGroup
+	for i, p := range h.peers {
+		wg.Add(1)
+		go func(inst *instanceJobs, p *peerClient) {
+			defer wg.Done()
+			inst.Instance = p.Name
+
+			data, err := p.get(fmt.Sprintf("jobs?limit=%d", limit))
+			if err != nil {
+				log.Println("routeFederatedJobs request peer job list failed.", p.Name, err)
+				inst.Error = fmt.Sprintf("Failed to list jobs of %s", p.Name)
+				return
+			}
+
+			// Peer job lists are enveloped as {jobs: [...]}
+			list := struct {
+				Jobs json.RawMessage `json:"jobs"`
+			}{}
+			if err := json.Unmarshal(data, &list); err != nil {
+				log.Println("routeFederatedJobs invalid peer job list.", p.Name, err)
+				inst.Error = fmt.Sprintf("Invalid job list from %s", p.Name)
+				return
+			}
+			inst.Jobs = list.Jobs
+		}(&instances[i+1], p)
+	}
+	wg.Wait()
+
+	h.version.writeData(w, federatedJobsMsg{Instances: instances}, http.StatusOK)
+}
+
+// Handles the request for the status of a job on this instance, or one of
+// its peers. Requests for this instance's jobs are served the same as the
+// status endpoint. Requests for a peer's jobs are proxied to the peer, and
+// the peer's response, or error, is returned. Only served by the v2 API.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/v2/federated/status/eu-west/1234"
+//
+// Response:
+//	- Success: {completed: 2, pending: 3, elapsed: 5m10s, urls: { <url>: <complete> }, ...}
+//	- Failure: {code: <code>, message: <message>}
+type FederatedStatusHandler struct {
+	instance string
+	local    http.Handler
+	peers    []*peerClient
+	version  apiVersion
+}
+
+func (h *FederatedStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	instance := path.Base(path.Dir(r.URL.Path))
+	if instance == h.instance {
+		h.local.ServeHTTP(w, r)
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeFederatedStatus request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var peer *peerClient
+	for _, p := range h.peers {
+		if p.Name == instance {
+			peer = p
+			break
+		}
+	}
+	if peer == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Unknown instance: %s", instance), http.StatusNotFound)
+		return
+	}
+
+	data, err := peer.get(fmt.Sprintf("status/%d", id))
+	if err != nil {
+		log.Println("routeFederatedStatus request peer job status failed.", peer.Name, id, err)
+		if pErr, ok := err.(*peerError); ok {
+			h.version.writeError(w, pErr.rsp.Code, pErr.rsp.Msg, pErr.status)
+		} else {
+			h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d status from %s", id, peer.Name), http.StatusBadGateway)
+		}
+		return
+	}
+
+	h.version.writeData(w, data, http.StatusOK)
+}
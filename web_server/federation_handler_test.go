@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFederatedStatusPeer(t *testing.T) {
+	thinContent := 2
+	peerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/harvester/v2/status/12":
+			apiV2.writeData(w, jobStatusMsg{Completed: 1, URLs: map[string]bool{"http://example.com": true}, ThinContent: &thinContent}, http.StatusOK)
+		default:
+			apiV2.writeError(w, "NotFound", "Failed to get job status", http.StatusNotFound)
+		}
+	}))
+	defer peerServer.Close()
+
+	h := &FederatedStatusHandler{
+		instance: "local",
+		peers:    newPeerClients([]PeerConfig{{Name: "eu", URL: peerServer.URL + "/harvester/"}}),
+		version:  apiV2,
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/v2/federated/status/eu/12", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, "Expect peer status")
+	assert.JSONEq(t, `{"data": {"completed": 1, "pending": 0, "elapsed": "", "urls": {"http://example.com": true}, "thin_content": 2, "archived": false, "paused": false, "cancelled": false}, "error": null, "meta": {"version": "v2"}}`, w.Body.String(), "Expect peer response passed through")
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/v2/federated/status/eu/13", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code, "Expect peer error status forwarded")
+	assert.Contains(t, w.Body.String(), "Failed to get job status", "Expect peer error message forwarded")
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/v2/federated/status/unknown/12", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNotFound, w.Code, "Expect unknown instance")
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// Maximum size of a GraphQL request body
+	maxGraphQLRequestSize = 1 << 20
+
+	// Maximum depth of the fields selected by a query. Deep queries of the
+	// links between URLs multiply the pages requested from storage at each
+	// level.
+	maxGraphQLQueryDepth = 8
+
+	// Default, and maximum number of URLs of a page of URLs
+	defaultURLPageLimit = 100
+	maxURLPageLimit     = 1000
+)
+
+// Request body of a GraphQL query.
+type graphQLRequest struct {
+	// GraphQL query document
+	Query string `json:"query"`
+
+	// Variables referenced by the query
+	Variables map[string]interface{} `json:"variables"`
+
+	// Name of the operation to execute if the query contains multiple
+	OperationName string `json:"operationName"`
+}
+
+// Handles GraphQL queries over jobs, their results, URLs, and the links between
+// URLs, so clients can select the fields they need in a single round trip
+// instead of stitching together multiple REST requests. Queries can be made
+// with a POST containing a JSON body of {query, variables, operationName}, or a
+// GET with the 'query' query parameter. Responses follow the GraphQL response
+// format of {data, errors}, and are not versioned like the REST endpoints. Lists
+// of URLs are paged, and queries selecting fields deeper than
+// maxGraphQLQueryDepth are refused.
+//
+// e.g: pages with status 200 which link to pages with status 404
+// curl -X POST --data-binary @- "http://localhost:8080/graphql" << EOF
+// {"query": "{ job(id: 1234) { urls(status: 200) { urls { url links(status: 404) { urls { url } } } nextCursor } } }"}
+// EOF
+//
+// e.g: the status, and first page of HTML results of the running jobs
+// curl -X POST --data-binary @- "http://localhost:8080/graphql" << EOF
+// {"query": "{ jobs(status: \"running\") { id status results(mime: \"text/html\", first: 100) { results { url status } nextCursor } } }"}
+// EOF
+//
+// Response:
+//	- Success: {data: {job: {urls: {urls: [{url: <url>, links: {urls: [{url: <url>}, ...]}}, ...], nextCursor: <cursor>}}}}
+//	- Failure: {data: null, errors: [{message: <message>, locations: [...]}]}
+type GraphQLHandler struct {
+	schema graphql.Schema
+}
+
+// Creates a new GraphQL handler with a schema resolved by the storage client.
+func NewGraphQLHandler(sc *storage.Client) (*GraphQLHandler, error) {
+	schema, err := newGraphQLSchema(sc)
+	if err != nil {
+		return nil, err
+	}
+	return &GraphQLHandler{schema: schema}, nil
+}
+
+func (h *GraphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := graphQLRequest{}
+	switch r.Method {
+	case "GET":
+		req.Query = r.URL.Query().Get("query")
+		req.OperationName = r.URL.Query().Get("operationName")
+		if v := r.URL.Query().Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				log.Println("routeGraphQL invalid variables", err)
+				writeJSONError(w, "BadRequest", "Invalid variables", http.StatusBadRequest)
+				return
+			}
+		}
+	case "POST":
+		r.Body = http.MaxBytesReader(w, r.Body, maxGraphQLRequestSize)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.Println("routeGraphQL request parse failed", err)
+			writeJSONError(w, "BadRequest", "Invalid GraphQL request body", http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, "MethodNotAllowed", "Only GET and POST are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if req.Query == "" {
+		writeJSONError(w, "BadRequest", "No query provided", http.StatusBadRequest)
+		return
+	}
+	if depth := graphQLQueryDepth(req.Query); depth > maxGraphQLQueryDepth {
+		log.Println("routeGraphQL query too deep", depth)
+		writeJSONError(w, "BadRequest", fmt.Sprintf("Query depth %d exceeds the maximum of %d", depth, maxGraphQLQueryDepth), http.StatusBadRequest)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         h.schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+	})
+	if result.HasErrors() {
+		log.Println("routeGraphQL query failed", result.Errors)
+	}
+
+	writeJSON(w, result, http.StatusOK)
+}
+
+// Builds the GraphQL schema for querying jobs and URLs. Fields are resolved
+// on demand with the storage client, so only the parts of the graph which are
+// queried are requested from storage.
+func newGraphQLSchema(sc *storage.Client) (graphql.Schema, error) {
+	// Arguments for filtering, and paging lists of URLs
+	urlFilterArgs := graphql.FieldConfigArgument{
+		"status": &graphql.ArgumentConfig{Type: graphql.Int, Description: "HTTP status code the URL was crawled with"},
+		"mime":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Prefix of the URL's mime type"},
+		"first": &graphql.ArgumentConfig{
+			Type:         graphql.Int,
+			DefaultValue: defaultURLPageLimit,
+			Description:  fmt.Sprintf("Number of URLs of the page, 1 to %d", maxURLPageLimit),
+		},
+		"after": &graphql.ArgumentConfig{Type: graphql.String, Description: "Cursor of the page"},
+	}
+
+	urlType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "URL",
+		Description: "URL known to the harvester, and the information extracted when it was crawled.",
+		Fields: graphql.Fields{
+			"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"url":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"mime":        &graphql.Field{Type: graphql.String},
+			"status":      &graphql.Field{Type: graphql.Int, Description: "HTTP status code, null if not crawled"},
+			"crawled":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"crawledOn":   &graphql.Field{Type: graphql.String},
+			"publishedOn": &graphql.Field{Type: graphql.String},
+			"modifiedOn":  &graphql.Field{Type: graphql.String},
+			"wordCount":   &graphql.Field{Type: graphql.Int},
+			"title":       &graphql.Field{Type: graphql.String},
+			"description": &graphql.Field{Type: graphql.String},
+			"h1":          &graphql.Field{Type: graphql.String},
+		},
+	})
+	urlPageType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "URLPage",
+		Description: "Page of a list of URLs.",
+		Fields: graphql.Fields{
+			"urls": &graphql.Field{Type: graphql.NewList(urlType)},
+			"nextCursor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Cursor of the next page, passed as the after argument, null if this is the last page",
+			},
+		},
+	})
+	urlType.AddFieldConfig("links", &graphql.Field{
+		Type:        urlPageType,
+		Description: "Page of the URLs this URL links to",
+		Args:        urlFilterArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			after, limit, err := urlPageFromArgs(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			urls, next, err := sc.URLClient().GetLinkedURLs(sourceURLId(p), urlFilterFromArgs(p.Args), after, limit)
+			if err != nil {
+				return nil, err
+			}
+			return graphQLURLPage(urls, next), nil
+		},
+	})
+	urlType.AddFieldConfig("referrers", &graphql.Field{
+		Type:        urlPageType,
+		Description: "Page of the URLs which link to this URL",
+		Args:        urlFilterArgs,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			after, limit, err := urlPageFromArgs(p.Args)
+			if err != nil {
+				return nil, err
+			}
+			urls, next, err := sc.URLClient().GetReferringURLs(sourceURLId(p), urlFilterFromArgs(p.Args), after, limit)
+			if err != nil {
+				return nil, err
+			}
+			return graphQLURLPage(urls, next), nil
+		},
+	})
+
+	jobURLType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "JobURL",
+		Description: "URL a job was scheduled with, and its completion status.",
+		Fields: graphql.Fields{
+			"url":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"completed":   &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"completedOn": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	resultType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Result",
+		Description: "Result URL of a job, with the refer URL it was found on, and the state it was crawled in.",
+		Fields: graphql.Fields{
+			"url":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"refer":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"status":    &graphql.Field{Type: graphql.Int, Description: "HTTP status code, null if not crawled"},
+			"mime":      &graphql.Field{Type: graphql.String},
+			"crawledOn": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	resultPageType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "ResultPage",
+		Description: "Page of a job's results.",
+		Fields: graphql.Fields{
+			"results": &graphql.Field{Type: graphql.NewList(resultType)},
+			"nextCursor": &graphql.Field{
+				Type:        graphql.String,
+				Description: "Cursor of the next page, passed as the after argument, null if this is the last page",
+			},
+		},
+	})
+
+	jobType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Job",
+		Description: "Scheduled crawl job.",
+		Fields: graphql.Fields{
+			"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"createdOn": &graphql.Field{Type: graphql.String},
+			"completed": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"status": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.String),
+				Description: "State of the job, either running, waiting, completed, paused, or cancelled",
+			},
+			"tags": &graphql.Field{
+				Type:        graphql.NewList(graphql.String),
+				Description: "Tags the job was scheduled with",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if tags, ok := p.Source.(map[string]interface{})["tags"]; ok {
+						return tags, nil
+					}
+					return sc.JobClient().Tags(sourceJobId(p))
+				},
+			},
+			"archived": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "If the job's bodies have been tiered into the cold store",
+			},
+			"paused": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "If the job is paused, and its pending URLs are not being crawled",
+			},
+			"cancelled": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "If the job was cancelled, and its pending URLs were dropped",
+			},
+			"seeds": &graphql.Field{
+				Type:        graphql.NewList(jobURLType),
+				Description: "URLs the job was scheduled with",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					// Jobs don't have their seeds until they are
+					// selected.
+					job, err := sc.JobClient().GetJob(sourceJobId(p))
+					if err != nil || job == nil {
+						return nil, err
+					}
+					return graphQLSeeds(job), nil
+				},
+			},
+			"urls": &graphql.Field{
+				Type:        urlPageType,
+				Description: "Page of the job's URLs and all URLs found while crawling them",
+				Args:        urlFilterArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					after, limit, err := urlPageFromArgs(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					urls, next, err := sc.JobClient().URLPage(sourceJobId(p), urlFilterFromArgs(p.Args), after, limit)
+					if err != nil {
+						return nil, err
+					}
+					return graphQLURLPage(urls, next), nil
+				},
+			},
+			"results": &graphql.Field{
+				Type:        resultPageType,
+				Description: "Page of the job's results, filtered the same as the REST results",
+				Args: graphql.FieldConfigArgument{
+					"mime":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Prefix of the result's mime type"},
+					"status": &graphql.ArgumentConfig{Type: graphql.Int, Description: "HTTP status code the result was crawled with"},
+					"domain": &graphql.ArgumentConfig{Type: graphql.String, Description: "Host of the result, including its sub domains"},
+					"tag":    &graphql.ArgumentConfig{Type: graphql.String, Description: "Tag the result was classified with"},
+					"flag":   &graphql.ArgumentConfig{Type: graphql.String, Description: "Name of the job's flag the result matched"},
+					"first": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: defaultResultPageLimit,
+						Description:  fmt.Sprintf("Number of results of the page, 1 to %d", maxResultPageLimit),
+					},
+					"after": &graphql.ArgumentConfig{Type: graphql.String, Description: "Cursor of the page"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					id := sourceJobId(p)
+					limit, _ := p.Args["first"].(int)
+					if limit <= 0 || limit > maxResultPageLimit {
+						return nil, fmt.Errorf("Invalid first: %d, must be 1 to %d", limit, maxResultPageLimit)
+					}
+					var after *common.ResultCursor
+					if token, ok := p.Args["after"].(string); ok {
+						cursor, err := common.ParseResultCursor(id, token)
+						if err != nil {
+							return nil, err
+						}
+						after = &cursor
+					}
+
+					rows, next, err := sc.JobClient().ResultRowPage(id, resultFilterFromArgs(p.Args), after, limit)
+					if err != nil {
+						return nil, err
+					}
+					return graphQLResultPage(rows, next), nil
+				},
+			},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"jobs": &graphql.Field{
+				Type:        graphql.NewList(jobType),
+				Description: "Most recently scheduled jobs, newest first",
+				Args: graphql.FieldConfigArgument{
+					"status":       &graphql.ArgumentConfig{Type: graphql.String, Description: "State of the jobs"},
+					"tag":          &graphql.ArgumentConfig{Type: graphql.String, Description: "Tag the jobs were scheduled with"},
+					"createdAfter": &graphql.ArgumentConfig{Type: graphql.String, Description: "RFC3339 time the jobs were created after"},
+					"first": &graphql.ArgumentConfig{
+						Type:         graphql.Int,
+						DefaultValue: defaultJobListLimit,
+						Description:  fmt.Sprintf("Number of jobs, 1 to %d", maxJobListLimit),
+					},
+					"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0, Description: "Number of newer jobs skipped"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter, err := jobListFilterFromArgs(p.Args)
+					if err != nil {
+						return nil, err
+					}
+					limit, _ := p.Args["first"].(int)
+					if limit <= 0 || limit > maxJobListLimit {
+						return nil, fmt.Errorf("Invalid first: %d, must be 1 to %d", limit, maxJobListLimit)
+					}
+					offset, _ := p.Args["offset"].(int)
+					if offset < 0 {
+						return nil, fmt.Errorf("Invalid offset: %d, must be 0 or more", offset)
+					}
+
+					jobs, err := sc.JobClient().ListJobs(filter, limit, offset)
+					if err != nil {
+						return nil, err
+					}
+					out := make([]map[string]interface{}, 0, len(jobs))
+					for _, s := range jobs {
+						out = append(out, graphQLJobSummary(s))
+					}
+					return out, nil
+				},
+			},
+			"job": &graphql.Field{
+				Type: jobType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					s, err := sc.JobClient().Summary(common.JobId(p.Args["id"].(int)))
+					if err != nil || s == nil {
+						return nil, err
+					}
+					return graphQLJobSummary(*s), nil
+				},
+			},
+			"url": &graphql.Field{
+				Type: urlType,
+				Args: graphql.FieldConfigArgument{
+					"id":  &graphql.ArgumentConfig{Type: graphql.Int},
+					"url": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					var u *storage.URL
+					var err error
+					if id, ok := p.Args["id"].(int); ok {
+						u, err = sc.URLClient().GetURLById(common.URLId(id))
+					} else if urlStr, ok := p.Args["url"].(string); ok {
+						u, err = sc.URLClient().GetURLByURL(urlStr)
+					} else {
+						return nil, fmt.Errorf("url requires either an id or url argument")
+					}
+					if err != nil || u == nil {
+						return nil, err
+					}
+					return graphQLURL(u), nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+// Returns the id of the job the field is being resolved on.
+func sourceJobId(p graphql.ResolveParams) common.JobId {
+	return common.JobId(p.Source.(map[string]interface{})["id"].(int))
+}
+
+// Returns the id of the URL the field is being resolved on.
+func sourceURLId(p graphql.ResolveParams) common.URLId {
+	return common.URLId(p.Source.(map[string]interface{})["id"].(int))
+}
+
+// Converts the GraphQL URL filter arguments into a storage URL filter.
+func urlFilterFromArgs(args map[string]interface{}) storage.URLFilter {
+	filter := storage.URLFilter{}
+	if status, ok := args["status"].(int); ok {
+		filter.Status = status
+	}
+	if mime, ok := args["mime"].(string); ok {
+		filter.Mime = mime
+	}
+	return filter
+}
+
+// Returns the cursor, and number of URLs of the page of URLs of the GraphQL
+// URL list arguments. An error is returned if either is invalid.
+func urlPageFromArgs(args map[string]interface{}) (*common.URLCursor, int, error) {
+	limit, _ := args["first"].(int)
+	if limit <= 0 || limit > maxURLPageLimit {
+		return nil, 0, fmt.Errorf("Invalid first: %d, must be 1 to %d", limit, maxURLPageLimit)
+	}
+	token, ok := args["after"].(string)
+	if !ok {
+		return nil, limit, nil
+	}
+	cursor, err := common.ParseURLCursor(token)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &cursor, limit, nil
+}
+
+// Converts the GraphQL job results arguments into a storage result filter.
+func resultFilterFromArgs(args map[string]interface{}) storage.ResultFilter {
+	filter := storage.ResultFilter{}
+	filter.Status, _ = args["status"].(int)
+	filter.Mime, _ = args["mime"].(string)
+	filter.Domain, _ = args["domain"].(string)
+	filter.Tag, _ = args["tag"].(string)
+	filter.Flag, _ = args["flag"].(string)
+	return filter
+}
+
+// Converts the GraphQL jobs arguments into a storage job list filter. An
+// error is returned if the status, or time is invalid.
+func jobListFilterFromArgs(args map[string]interface{}) (storage.JobListFilter, error) {
+	filter := storage.JobListFilter{}
+	if tag, _ := args["tag"].(string); tag != "" {
+		filter.Tags = []string{tag}
+	}
+	if status, ok := args["status"].(string); ok {
+		if !common.ValidJobStatus(status) {
+			return filter, fmt.Errorf("Invalid status: %s", status)
+		}
+		filter.Status = status
+	}
+	if v, ok := args["createdAfter"].(string); ok {
+		createdAfter, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid createdAfter: %s, must be a RFC3339 time", v)
+		}
+		filter.CreatedAfter = createdAfter
+	}
+	return filter, nil
+}
+
+// Converts the URLs the job was scheduled with.
+func graphQLSeeds(job *storage.Job) []map[string]interface{} {
+	seeds := make([]map[string]interface{}, 0, len(job.URLs))
+	for _, u := range job.URLs {
+		seeds = append(seeds, map[string]interface{}{
+			"url":         u.URL,
+			"completed":   u.Completed,
+			"completedOn": graphQLTime(u.CompletedOn),
+		})
+	}
+	return seeds
+}
+
+// Converts the job summary, without the job's seeds, which are requested if
+// selected.
+func graphQLJobSummary(s common.JobSummary) map[string]interface{} {
+	tags := s.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return map[string]interface{}{
+		"id":        int(s.Id),
+		"createdOn": graphQLTime(s.CreatedOn),
+		"completed": s.Pending == 0,
+		"status":    s.Status,
+		"archived":  s.Archived,
+		"paused":    s.Paused,
+		"cancelled": s.Cancelled,
+		"tags":      tags,
+	}
+}
+
+// Converts the page of result rows, and the cursor of the next page.
+func graphQLResultPage(rows []common.JobResultRow, next *common.ResultCursor) map[string]interface{} {
+	results := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		r := map[string]interface{}{
+			"url":       row.URL,
+			"refer":     row.Refer,
+			"mime":      row.Mime,
+			"crawledOn": graphQLTime(row.CrawledOn),
+		}
+		if row.Status != 0 {
+			r["status"] = row.Status
+		}
+		results = append(results, r)
+	}
+
+	page := map[string]interface{}{"results": results, "nextCursor": nil}
+	if next != nil {
+		page["nextCursor"] = next.String()
+	}
+	return page
+}
+
+func graphQLURL(u *storage.URL) map[string]interface{} {
+	m := map[string]interface{}{
+		"id":          int(u.Id),
+		"url":         u.URL,
+		"mime":        u.Mime,
+		"crawled":     u.Crawled,
+		"crawledOn":   graphQLTime(u.CrawledOn),
+		"publishedOn": graphQLTime(u.Info.PublishedOn),
+		"modifiedOn":  graphQLTime(u.Info.ModifiedOn),
+		"title":       u.Info.Title,
+		"description": u.Info.Description,
+		"h1":          u.Info.H1,
+	}
+	if u.Crawled {
+		m["status"] = u.Status
+		m["wordCount"] = u.Info.WordCount
+	}
+	return m
+}
+
+// Converts the page of URLs, and the cursor of the next page.
+func graphQLURLPage(urls []*storage.URL, next *common.URLCursor) map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(urls))
+	for _, u := range urls {
+		out = append(out, graphQLURL(u))
+	}
+
+	page := map[string]interface{}{"urls": out, "nextCursor": nil}
+	if next != nil {
+		page["nextCursor"] = next.String()
+	}
+	return page
+}
+
+// Returns the depth of the fields selected by the query's operations, with
+// the fields of fragments counted where they are spread. Zero is returned if
+// the query can't be parsed, so its syntax error is reported by executing it.
+func graphQLQueryDepth(query string) int {
+	doc, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return 0
+	}
+
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if frag, ok := def.(*ast.FragmentDefinition); ok && frag.Name != nil {
+			fragments[frag.Name.Value] = frag
+		}
+	}
+
+	// Depths of fragments are only computed once, and fragments being
+	// spread are tracked, so cyclic fragments, which fail validation, don't
+	// recurse forever.
+	fragmentDepths := map[string]int{}
+	spreading := map[string]bool{}
+	var depth func(set *ast.SelectionSet) int
+	depth = func(set *ast.SelectionSet) int {
+		if set == nil {
+			return 0
+		}
+		max := 0
+		for _, sel := range set.Selections {
+			d := 0
+			switch sel := sel.(type) {
+			case *ast.Field:
+				d = 1 + depth(sel.SelectionSet)
+			case *ast.InlineFragment:
+				d = depth(sel.SelectionSet)
+			case *ast.FragmentSpread:
+				name := sel.Name.Value
+				frag := fragments[name]
+				if frag == nil || spreading[name] {
+					continue
+				}
+				fd, ok := fragmentDepths[name]
+				if !ok {
+					spreading[name] = true
+					fd = depth(frag.SelectionSet)
+					delete(spreading, name)
+					fragmentDepths[name] = fd
+				}
+				d = fd
+			}
+			if d > max {
+				max = d
+			}
+		}
+		return max
+	}
+
+	max := 0
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok {
+			if d := depth(op.SelectionSet); d > max {
+				max = d
+			}
+		}
+	}
+	return max
+}
+
+// Formats the time as RFC3339, or nil if the time is zero.
+func graphQLTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGraphQLHandlerInvalidQuery(t *testing.T) {
+	h, err := NewGraphQLHandler(nil)
+	require.Nil(t, err, "Expect schema to be valid")
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ job(id: 1) { unknownField } }"}`))
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, "GraphQL errors are returned in the response body")
+
+	rsp := struct {
+		Data   interface{}
+		Errors []struct{ Message string }
+	}{}
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), &rsp), "Expect response to be JSON")
+	assert.Nil(t, rsp.Data, "Expect no data for invalid query")
+	require.Len(t, rsp.Errors, 1, "Expect validation error")
+	assert.Contains(t, rsp.Errors[0].Message, "unknownField", "Expect error to reference invalid field")
+}
+
+func TestGraphQLHandlerBadRequest(t *testing.T) {
+	h, err := NewGraphQLHandler(nil)
+	require.Nil(t, err, "Expect schema to be valid")
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/graphql", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expect missing query to be rejected")
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("DELETE", "/graphql", nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "Expect only GET and POST")
+}
+
+func TestGraphQLURL(t *testing.T) {
+	u := &storage.URL{Id: 12, URL: "http://example.com", Mime: "text/html"}
+	m := graphQLURL(u)
+	assert.Equal(t, 12, m["id"], "Expect id to match")
+	assert.Nil(t, m["crawledOn"], "Expect zero time to be null")
+	assert.Nil(t, m["status"], "Expect no status for uncrawled URL")
+
+	u.Crawled = true
+	u.CrawledOn = time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	u.Status = 404
+	m = graphQLURL(u)
+	assert.Equal(t, "2015-01-02T03:04:05Z", m["crawledOn"], "Expect RFC3339 time")
+	assert.Equal(t, 404, m["status"], "Expect status for crawled URL")
+}
+
+func TestGraphQLHandlerInvalidArgs(t *testing.T) {
+	h, err := NewGraphQLHandler(nil)
+	require.Nil(t, err, "Expect schema to be valid")
+
+	cases := map[string]string{
+		`{ jobs(status: "sleeping") { id } }`:           "Invalid status",
+		`{ jobs(first: 0) { id } }`:                     "Invalid first",
+		`{ jobs(createdAfter: "yesterday") { id } }`:    "Invalid createdAfter",
+		`{ jobs(first: 10, offset: -1) { id status } }`: "Invalid offset",
+	}
+	for query, msg := range cases {
+		body, _ := json.Marshal(graphQLRequest{Query: query})
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "/graphql", strings.NewReader(string(body)))
+		h.ServeHTTP(w, r)
+
+		rsp := struct {
+			Errors []struct{ Message string }
+		}{}
+		require.Nil(t, json.Unmarshal(w.Body.Bytes(), &rsp), "Expect response to be JSON")
+		require.Len(t, rsp.Errors, 1, "Expect error for %s", query)
+		assert.Contains(t, rsp.Errors[0].Message, msg, "Expect error for %s", query)
+	}
+}
+
+func TestGraphQLJobSummary(t *testing.T) {
+	m := graphQLJobSummary(common.JobSummary{Id: 7, Pending: 2, Status: common.JobStatusRunning})
+	assert.Equal(t, 7, m["id"])
+	assert.Equal(t, false, m["completed"], "Expect pending job not completed")
+	assert.Equal(t, common.JobStatusRunning, m["status"])
+	assert.Equal(t, []string{}, m["tags"], "Expect empty tags, so they aren't requested")
+	_, ok := m["seeds"]
+	assert.False(t, ok, "Expect seeds to be requested if selected")
+}
+
+func TestGraphQLSeeds(t *testing.T) {
+	job := &storage.Job{Id: 7, URLs: []storage.JobURL{
+		{URL: "http://example.com", Completed: true, CompletedOn: time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{URL: "http://example.com/a"},
+	}}
+	seeds := graphQLSeeds(job)
+	require.Len(t, seeds, 2)
+	assert.Equal(t, "2015-01-02T03:04:05Z", seeds[0]["completedOn"])
+	assert.Equal(t, false, seeds[1]["completed"])
+	assert.Nil(t, seeds[1]["completedOn"], "Expect no time for pending seeds")
+}
+
+func TestGraphQLURLPage(t *testing.T) {
+	urls := []*storage.URL{{Id: 1, URL: "http://example.com"}, {Id: 2, URL: "http://example.com/a"}}
+	next := &common.URLCursor{URLId: 2}
+
+	page := graphQLURLPage(urls, next)
+	assert.Equal(t, next.String(), page["nextCursor"])
+	require.Len(t, page["urls"], 2)
+	assert.Nil(t, graphQLURLPage(urls, nil)["nextCursor"], "Expect no cursor on the last page")
+}
+
+func TestGraphQLQueryDepth(t *testing.T) {
+	cases := map[string]int{
+		`{ job(id: 1) { id } }`: 2,
+		`{ job(id: 1) { urls { urls { links { urls { url } } } } } }`:        6,
+		`{ job(id: 1) { ...f } } fragment f on Job { urls { urls { id } } }`: 4,
+		`{ job(id: 1) { ... on Job { id } } }`:                               2,
+		`{ job(id: 1) { ...f } } fragment f on Job { ...f }`:                 1,
+		`{ job(id: `: 0,
+	}
+	for query, depth := range cases {
+		assert.Equal(t, depth, graphQLQueryDepth(query), query)
+	}
+}
+
+func TestGraphQLHandlerLimits(t *testing.T) {
+	h, err := NewGraphQLHandler(nil)
+	require.Nil(t, err, "Expect schema to be valid")
+
+	w := httptest.NewRecorder()
+	query := `{ url(id: 1) { links { urls { links { urls { links { urls { referrers { urls { url } } } } } } } } } }`
+	r, _ := http.NewRequest("GET", "/graphql?query="+url.QueryEscape(query), nil)
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expect deep query to be rejected")
+
+	w = httptest.NewRecorder()
+	body := `{"query": "{ job(id: 1) { id } }", "operationName": "` + strings.Repeat("a", maxGraphQLRequestSize) + `"}`
+	r, _ = http.NewRequest("POST", "/graphql", strings.NewReader(body))
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expect large body to be rejected")
+}
+
+func TestGraphQLResultPage(t *testing.T) {
+	rows := []common.JobResultRow{
+		{URL: "http://example.com/a", Refer: "http://example.com", Status: 200, Mime: "text/html",
+			CrawledOn: time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{URL: "http://example.com/b", Refer: "http://example.com"},
+	}
+	next := &common.ResultCursor{JobId: 7, ReferId: 1, URLId: 3}
+
+	page := graphQLResultPage(rows, next)
+	assert.Equal(t, next.String(), page["nextCursor"])
+	results := page["results"].([]map[string]interface{})
+	require.Len(t, results, 2)
+	assert.Equal(t, 200, results[0]["status"])
+	assert.Equal(t, "2015-01-02T03:04:05Z", results[0]["crawledOn"])
+	assert.Nil(t, results[1]["status"], "Expect no status for uncrawled result")
+
+	assert.Nil(t, graphQLResultPage(rows, nil)["nextCursor"], "Expect no cursor on the last page")
+}
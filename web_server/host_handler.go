@@ -0,0 +1,25 @@
+package main
+
+import (
+	"net/http"
+	"path"
+)
+
+// Routes requests for a host's resources, e.g: hosts/<host>/history, to the
+// handler of the resource. Unknown resources are responded to with a 404.
+type HostResourceHandler struct {
+	// Handlers keyed by resource name
+	resources map[string]http.Handler
+	version   apiVersion
+}
+
+func (h *HostResourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host := path.Base(path.Dir(r.URL.Path))
+	resource, ok := h.resources[path.Base(r.URL.Path)]
+	if !ok || host == "hosts" || host == "." || host == "/" {
+		h.version.writeError(w, "NotFound", "Unknown host resource", http.StatusNotFound)
+		return
+	}
+
+	resource.ServeHTTP(w, r)
+}
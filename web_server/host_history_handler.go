@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the crawl history of a host. The history summarizes
+// each job which crawled the host: when the host was first and last requested,
+// the number of URLs and requests, the error rate, and the bytes received. Most
+// recent crawls are listed first, and the number of crawls listed can be set with
+// the 'limit' query parameter. A host which was never crawled has an empty history.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/hosts/www.example.com/history"
+//
+// Response:
+//	- Success: {host: <host>, lastCrawled: <time>, crawls: [{jobId: 1234, started: <time>, finished: <time>, urls: 12, requests: 12, errors: 1, errorRate: 0.083, bytes: 524288, avgRequestMs: 230}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type HostHistoryHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *HostHistoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	host := path.Base(path.Dir(r.URL.Path))
+
+	limit, err := jobListLimit(r)
+	if err != nil {
+		log.Println("routeHostHistory invalid limit.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	history, hostErr := h.hostHistory(host, limit)
+	if hostErr != nil {
+		log.Println("routeHostHistory request host history failed.", hostErr)
+		h.version.writeError(w, "DependancyFailure", hostErr.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, history, http.StatusOK)
+}
+
+// Connects to the remote service hosting crawl information, and summarizes
+// the host's crawl history.
+func (h *HostHistoryHandler) hostHistory(host string, limit int) (*common.HostHistory, *ErroMsg) {
+	history, err := h.sc.JobClient().HostHistory(host, limit)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "hostHistory",
+			Info:   fmt.Sprintf("Failed to get host %s history", host),
+			Err:    err,
+		}
+	}
+
+	return history, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the site identity of a host, captured from the host's
+// home page and web app manifest while crawling it. The site name is taken from
+// the home page's og:site_name, or the manifest's name. If the host's identity
+// was never captured a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/hosts/www.example.com/identity"
+//
+// Response:
+//	- Success: {host: <host>, siteName: <name>, iconURL: <url>, iconMime: <mime>, fetchedOn: <time>}
+//	- Failure: {code: <code>, message: <message>}
+type HostIdentityHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *HostIdentityHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	host := path.Base(path.Dir(r.URL.Path))
+
+	identity, hostErr := h.hostIdentity(host)
+	if hostErr != nil {
+		log.Println("routeHostIdentity request host identity failed.", hostErr)
+		h.version.writeError(w, "NotFound", hostErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	h.version.writeData(w, identity, http.StatusOK)
+}
+
+// Connects to the remote service hosting host information, and gets the
+// host's site identity.
+func (h *HostIdentityHandler) hostIdentity(host string) (*common.HostIdentity, *ErroMsg) {
+	identity, err := h.sc.HostClient().Identity(host)
+	if err != nil || identity == nil {
+		return nil, &ErroMsg{
+			Source: "hostIdentity",
+			Info:   fmt.Sprintf("No identity captured for host %s", host),
+			Err:    err,
+		}
+	}
+
+	return identity, nil
+}
+
+// Handles the request for the favicon of a host, captured with the host's site
+// identity. The favicon is served with its own content type. If the host has no
+// stored favicon a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/hosts/www.example.com/favicon"
+//
+// Response:
+//	- Success: favicon image
+//	- Failure: {code: <code>, message: <message>}
+type HostFaviconHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *HostFaviconHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	host := path.Base(path.Dir(r.URL.Path))
+
+	mime, icon, err := h.sc.HostClient().Favicon(host)
+	if err != nil || icon == nil {
+		log.Println("routeHostFavicon request host favicon failed.", host, err)
+		h.version.writeError(w, "NotFound", fmt.Sprintf("No favicon stored for host %s", host), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", mime)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// SVG favicons may contain scripts, which must never run.
+	w.Header().Set("Content-Security-Policy", "sandbox; script-src 'none'; object-src 'none'")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(icon); err != nil {
+		log.Println("routeHostFavicon failed to write favicon", host, err)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Path a site owner serves their opt-out verification token at
+const optOutVerificationPath = "/.well-known/harvester-opt-out.txt"
+
+// Timeout of requests made to verify a site owner's opt out
+const optOutVerifyTimeout = 10 * time.Second
+
+// Maximum size of a host's verification token response, and opt out request body
+const maxOptOutSize = 4096
+
+// Response to a successful host opt-out status request
+type hostOptOutMsg struct {
+	Host string `json:"host"`
+
+	// If the host, or one of its parent domains, is opted out
+	OptedOut bool `json:"optedOut"`
+
+	// The registry entry opting the host out. Nil if not opted out.
+	OptOut *common.HostOptOut `json:"optOut"`
+
+	// Token the site owner must serve at VerificationURL to opt the host
+	// out. Empty if site owner verification is not enabled.
+	VerificationToken string `json:"verificationToken,omitempty"`
+	VerificationURL   string `json:"verificationURL,omitempty"`
+}
+
+// Body of a host opt-out request
+type hostOptOutReq struct {
+	// Reason the host is being opted out, logged when its URLs are skipped.
+	Reason string `json:"reason"`
+}
+
+// Handles requests for a host's entry in the opt-out registry. URLs of an opted
+// out host, or its sub domains, are rejected when scheduling jobs and are skipped
+// by the workers.
+//
+// GET returns the host's opt-out status, and the verification token the site owner
+// must serve to opt the host out themselves.
+//
+// POST opts the host out with the reason in the JSON body. Requests authorized with
+// the admin token are always accepted. Other requests are accepted only if the host
+// serves its verification token at /.well-known/harvester-opt-out.txt, verifying the
+// request was made by the site's owner. The token is only requested from public
+// addresses, and redirects to other hosts are not followed.
+//
+// DELETE removes the host's opt out, and requires the admin token.
+//
+// e.g:
+// curl -X POST "http://localhost:8080/hosts/example.com/optout" --data '{"reason": "Owner request"}'
+//
+// Response:
+//	- Success: {host: <host>, optedOut: true, optOut: {host: <host>, reason: <reason>, requestedBy: "owner", createdOn: <time>}}
+//	- Failure: {code: <code>, message: <message>}
+type HostOptOutHandler struct {
+	sc     *storage.Client
+	client *http.Client
+
+	// Token administrators authorize requests with. Admin requests are
+	// refused if empty.
+	adminToken string
+
+	// Secret site owner verification tokens are derived from. Site owner
+	// opt outs are refused if empty.
+	secret string
+
+	version apiVersion
+}
+
+func (h *HostOptOutHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, err := optOutHost(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeHostOptOut request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		h.serveStatus(w, host)
+	case "POST":
+		h.serveOptOut(w, r, host)
+	case "DELETE":
+		h.serveRemove(w, r, host)
+	default:
+		h.version.methodNotAllowed(w, "GET, POST, DELETE")
+	}
+}
+
+// Writes the host's opt-out status
+func (h *HostOptOutHandler) serveStatus(w http.ResponseWriter, host string) {
+	optOut, err := h.sc.HostClient().GetOptOut(host)
+	if err != nil {
+		log.Println("routeHostOptOut request host opt out failed.", host, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get host %s opt out", host), http.StatusInternalServerError)
+		return
+	}
+
+	msg := hostOptOutMsg{Host: host, OptedOut: optOut != nil, OptOut: optOut}
+	if h.secret != "" {
+		msg.VerificationToken = optOutToken(h.secret, host)
+		msg.VerificationURL = "http://" + host + optOutVerificationPath
+	}
+	h.version.writeData(w, msg, http.StatusOK)
+}
+
+// Opts the host out if the request is from an admin, or verified site owner.
+func (h *HostOptOutHandler) serveOptOut(w http.ResponseWriter, r *http.Request, host string) {
+	req := hostOptOutReq{}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxOptOutSize)).Decode(&req); err != nil {
+		log.Println("routeHostOptOut request parse failed.", err)
+		h.version.writeError(w, "BadRequest", "Invalid opt out request", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		h.version.writeError(w, "BadRequest", "An opt out reason is required", http.StatusBadRequest)
+		return
+	}
+
+	requestedBy := common.HostOptOutAdmin
+	if !isAdminRequest(r, h.adminToken) {
+		if h.secret == "" {
+			h.version.writeError(w, "Forbidden", "Site owner opt outs are not enabled", http.StatusForbidden)
+			return
+		}
+		if err := h.verifyOwner(host); err != nil {
+			log.Println("routeHostOptOut site owner verification failed.", host, err)
+			h.version.writeError(w, "Forbidden", fmt.Sprintf("Failed to verify site owner of %s", host), http.StatusForbidden)
+			return
+		}
+		requestedBy = common.HostOptOutOwner
+	}
+
+	optOut, err := h.sc.HostClient().OptOut(host, req.Reason, requestedBy)
+	if err != nil || optOut == nil {
+		log.Println("routeHostOptOut request opt out failed.", host, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to opt out host %s", host), http.StatusInternalServerError)
+		return
+	}
+	log.Println("routeHostOptOut host opted out", host, "by", requestedBy, "reason:", req.Reason)
+
+	h.version.writeData(w, hostOptOutMsg{Host: host, OptedOut: true, OptOut: optOut}, http.StatusOK)
+}
+
+// Removes the host's opt out if the request is from an admin.
+func (h *HostOptOutHandler) serveRemove(w http.ResponseWriter, r *http.Request, host string) {
+	if !isAdminRequest(r, h.adminToken) {
+		h.version.writeError(w, "Forbidden", "Admin authorization required", http.StatusForbidden)
+		return
+	}
+
+	removed, err := h.sc.HostClient().RemoveOptOut(host)
+	if err != nil {
+		log.Println("routeHostOptOut request remove opt out failed.", host, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to remove host %s opt out", host), http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Host %s is not opted out", host), http.StatusNotFound)
+		return
+	}
+	log.Println("routeHostOptOut host opt out removed", host)
+
+	h.version.writeData(w, hostOptOutMsg{Host: host}, http.StatusOK)
+}
+
+// Verifies the host serves its verification token at the verification path,
+// trying https first, then http.
+func (h *HostOptOutHandler) verifyOwner(host string) error {
+	token := optOutToken(h.secret, host)
+
+	var err error
+	for _, scheme := range []string{"https", "http"} {
+		var served string
+		if served, err = h.fetchToken(scheme + "://" + host + optOutVerificationPath); err != nil {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(served), []byte(token)) == 1 {
+			return nil
+		}
+		err = fmt.Errorf("verification token does not match")
+	}
+	return err
+}
+
+// Requests the verification token served at the URL.
+func (h *HostOptOutHandler) fetchToken(u string) (string, error) {
+	resp, err := h.client.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("verification token request responded with %d", resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOptOutSize))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// Handles the admin request to list all hosts in the opt-out registry.
+//
+// e.g:
+// curl -X GET -H "Authorization: Bearer <token>" "http://localhost:8080/optouts"
+//
+// Response:
+//	- Success: {optOuts: [{host: <host>, reason: <reason>, requestedBy: "admin", createdOn: <time>}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type HostOptOutListHandler struct {
+	sc         *storage.Client
+	adminToken string
+	version    apiVersion
+}
+
+func (h *HostOptOutListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	if !isAdminRequest(r, h.adminToken) {
+		h.version.writeError(w, "Forbidden", "Admin authorization required", http.StatusForbidden)
+		return
+	}
+
+	optOuts, err := h.sc.HostClient().ListOptOuts()
+	if err != nil {
+		log.Println("routeHostOptOutList request list opt outs failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to list opt outs", http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, struct {
+		OptOuts []common.HostOptOut `json:"optOuts"`
+	}{OptOuts: optOuts}, http.StatusOK)
+}
+
+// Validates and normalizes the host of an opt-out request, lower casing it
+// and removing any port.
+func optOutHost(host string) (string, error) {
+	if strings.ContainsAny(host, "/?#@ ") {
+		return "", fmt.Errorf("Invalid host: %s", host)
+	}
+	normalized := common.URLHost("http://" + host)
+	if normalized == "" {
+		return "", fmt.Errorf("Invalid host: %s", host)
+	}
+	return normalized, nil
+}
+
+// Returns the verification token the site owner of the host must serve to
+// opt it out. Tokens are derived from the secret so they do not need to be stored.
+func optOutToken(secret, host string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.ToLower(host)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns true if the request is authorized with the admin token as a bearer
+// token. Always false if no admin token is configured.
+func isAdminRequest(r *http.Request, adminToken string) bool {
+	if adminToken == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(adminToken)) == 1
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOptOutHost(t *testing.T) {
+	host, err := optOutHost("WWW.Example.com:8080")
+	assert.NoError(t, err, "Expect valid host")
+	assert.Equal(t, "www.example.com", host, "Expect host lower cased without port")
+
+	for _, h := range []string{"", "user@example.com", "example.com?q"} {
+		_, err := optOutHost(h)
+		assert.Error(t, err, "Expect invalid host %q", h)
+	}
+}
+
+func TestOptOutToken(t *testing.T) {
+	assert.Equal(t, optOutToken("secret", "example.com"), optOutToken("secret", "Example.com"), "Expect token case insensitive")
+	assert.NotEqual(t, optOutToken("secret", "example.com"), optOutToken("secret", "example.org"), "Expect token per host")
+	assert.NotEqual(t, optOutToken("secret", "example.com"), optOutToken("other", "example.com"), "Expect token per secret")
+}
+
+func TestIsAdminRequest(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/optouts", nil)
+	assert.False(t, isAdminRequest(r, "token"), "Expect no authorization not admin")
+
+	r.Header.Set("Authorization", "Bearer wrong")
+	assert.False(t, isAdminRequest(r, "token"), "Expect wrong token not admin")
+
+	r.Header.Set("Authorization", "Bearer token")
+	assert.True(t, isAdminRequest(r, "token"), "Expect admin token")
+	assert.False(t, isAdminRequest(r, ""), "Expect no admin if token not configured")
+}
+
+func TestVerifyOwner(t *testing.T) {
+	served := optOutToken("secret", "example.com")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != optOutVerificationPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(served + "\n"))
+	}))
+	defer server.Close()
+
+	// Route all hosts to the test server. The https attempt fails, falling back to http.
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			return net.Dial(network, server.Listener.Addr().String())
+		},
+	}}
+	h := &HostOptOutHandler{client: client, secret: "secret", version: apiV1}
+
+	assert.NoError(t, h.verifyOwner("example.com"), "Expect served token verified")
+	assert.Error(t, h.verifyOwner("example.org"), "Expect other host's token rejected")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default, and maximum number of days of a host's reputation.
+const (
+	defaultReputationDays = 30
+	maxReputationDays     = 365
+)
+
+// Handles the request for the reputation of a host, scored from the metrics
+// of its crawls the foreman recorded over the last 'days', default 30, and the
+// anomalies detected in them, e.g: error spikes, response size collapses, and
+// redirects to parked domains. The score is between 0 and 100, reduced by the
+// host's error rate, and by each anomaly. The host's metrics, and anomalies are
+// only recorded if the foreman's host reputation is enabled, so a host without
+// any has a full score.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/hosts/www.example.com/reputation?days=7"
+//
+// Response:
+//	- Success: {host: <host>, score: 80, metrics: {host: <host>, requests: 120, errors: 12, successes: 108, avgBytes: 20480, from: <time>, until: <time>}, history: [<metrics>, ...], anomalies: [{host: <host>, kind: "errorSpike", detail: <detail>, jobId: 1234, detectedOn: <time>}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type HostReputationHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *HostReputationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	host := strings.ToLower(path.Base(path.Dir(r.URL.Path)))
+
+	days, err := reputationDays(r.URL.Query().Get("days"))
+	if err != nil {
+		log.Println("routeHostReputation invalid days.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	rep, hostErr := h.hostReputation(host, since)
+	if hostErr != nil {
+		log.Println("routeHostReputation request host reputation failed.", hostErr)
+		h.version.writeError(w, "DependancyFailure", hostErr.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, rep, http.StatusOK)
+}
+
+// Connects to the remote service hosting crawl information, and scores the
+// host's crawls since the time.
+func (h *HostReputationHandler) hostReputation(host string, since time.Time) (*common.HostReputation, *ErroMsg) {
+	rep, err := h.sc.HostClient().Reputation(host, since)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "hostReputation",
+			Info:   fmt.Sprintf("Failed to get host %s reputation", host),
+			Err:    err,
+		}
+	}
+
+	return rep, nil
+}
+
+// Returns the number of days of the reputation, or the default if not set. An
+// error is returned if the days are not between 1 and maxReputationDays.
+func reputationDays(v string) (int, error) {
+	if v == "" {
+		return defaultReputationDays, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 1 || days > maxReputationDays {
+		return 0, fmt.Errorf("Invalid days: %s, must be between 1 and %d", v, maxReputationDays)
+	}
+	return days, nil
+}
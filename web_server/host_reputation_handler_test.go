@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestReputationDays(t *testing.T) {
+	days, err := reputationDays("")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultReputationDays, days, "Expect default days if not set")
+
+	days, err = reputationDays("7")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, days)
+
+	for _, v := range []string{"0", "-1", "366", "week"} {
+		_, err := reputationDays(v)
+		assert.Error(t, err, "Expect error for days %s", v)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the well-known files found on a host while crawling
+// it, e.g: /.well-known/security.txt, /llms.txt, and /humans.txt. Only the files
+// the host has are listed. A host which was never crawled has no files.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/hosts/www.example.com/wellknown"
+//
+// Response:
+//	- Success: {host: <host>, files: [{path: "/.well-known/security.txt", content: <content>, fetchedOn: <time>}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type HostWellKnownHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *HostWellKnownHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	host := path.Base(path.Dir(r.URL.Path))
+
+	wellKnown, hostErr := h.hostWellKnown(host)
+	if hostErr != nil {
+		log.Println("routeHostWellKnown request host well-known files failed.", hostErr)
+		h.version.writeError(w, "DependancyFailure", hostErr.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, wellKnown, http.StatusOK)
+}
+
+// Connects to the remote service hosting host information, and gets the
+// host's well-known files.
+func (h *HostWellKnownHandler) hostWellKnown(host string) (*common.HostWellKnown, *ErroMsg) {
+	wellKnown, err := h.sc.HostClient().WellKnown(host)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "hostWellKnown",
+			Info:   fmt.Sprintf("Failed to get host %s well-known files", host),
+			Err:    err,
+		}
+	}
+
+	return wellKnown, nil
+}
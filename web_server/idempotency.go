@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Header clients send with a job schedule request, so the job is scheduled
+// at most once when the request is retried.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Header set on the responses of requests replaying an idempotency key.
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// Maximum length of an idempotency key
+const maxIdempotencyKeyLen = 255
+
+// Interval between removals of the expired idempotency keys
+const idempotencyExpireInterval = 10 * time.Minute
+
+// Longest a reserved idempotency key's job may take to be scheduled. Keys not
+// completed within the lease, e.g: because their web server stopped, can be
+// reserved again by a retried request, instead of being refused for the
+// whole idempotency window.
+const idempotencyLease = 5 * time.Minute
+
+// Reserves the request's idempotency key for the job about to be scheduled.
+// Returns the token the key was reserved with, or false if the job must not
+// be scheduled, and the response has been written. Requests replaying a key
+// whose job was scheduled are responded to with the job, and requests
+// replaying a key with a different request, or whose job is still being
+// scheduled are refused.
+func (h *JobScheduleHandler) reserveIdempotencyKey(w http.ResponseWriter, r *http.Request, key string, requested *requestedJobURLs, opts jobOptions) (string, bool) {
+	if len(key) > maxIdempotencyKeyLen || strings.TrimSpace(key) == "" {
+		h.version.writeError(w, "BadRequest",
+			fmt.Sprintf("Invalid %s, must be between 1 and %d characters", idempotencyKeyHeader, maxIdempotencyKeyLen), http.StatusBadRequest)
+		return "", false
+	}
+
+	token, err := newIdempotencyToken()
+	if err != nil {
+		log.Println("routeScheduleJob request idempotency token failed.", err)
+		h.version.writeError(w, "InternalError", "Failed to check Idempotency-Key", http.StatusInternalServerError)
+		return "", false
+	}
+	hash := idempotencyHash(r.URL.Query(), requested.urls)
+	id, reservedHash, reserved, err := h.sc.JobClient().ReserveIdempotencyKey(requestPrincipal(r), key, hash, token, h.idempotencyWindow, idempotencyLease)
+	if err != nil {
+		log.Println("routeScheduleJob request idempotency key reserve failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to check Idempotency-Key", http.StatusInternalServerError)
+		return "", false
+	}
+	if reserved {
+		return token, true
+	}
+
+	if reservedHash != hash {
+		log.Println("routeScheduleJob request idempotency key reused with a different request")
+		h.version.writeError(w, "UnprocessableEntity",
+			fmt.Sprintf("%s was already used with a different request", idempotencyKeyHeader), 422)
+		return "", false
+	}
+	if id == common.InvalidId {
+		h.version.writeError(w, "Conflict",
+			fmt.Sprintf("A request with the %s is still being scheduled", idempotencyKeyHeader), http.StatusConflict)
+		return "", false
+	}
+
+	log.Println("routeScheduleJob request replayed idempotency key of job", id)
+	msg := h.scheduledMsg(id, requested, opts, nil)
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.Header().Set("Location", msg.StatusURL)
+	h.version.writeData(w, msg, http.StatusOK)
+	return "", false
+}
+
+// Completes the idempotency key reserved with the token with the job
+// scheduled, or releases it if the job failed to be scheduled, so the request
+// can be retried.
+func (h *JobScheduleHandler) finishIdempotencyKey(principal, key, token string, id common.JobId) {
+	jobClient := h.sc.JobClient()
+	if id == common.InvalidId {
+		if err := jobClient.ReleaseIdempotencyKey(principal, key, token); err != nil {
+			log.Println("routeScheduleJob failed to release idempotency key.", err)
+		}
+		return
+	}
+	if err := jobClient.CompleteIdempotencyKey(principal, key, token, id); err != nil {
+		log.Println("routeScheduleJob failed to complete idempotency key of job", id, err)
+	}
+}
+
+// Periodically removes the idempotency keys which have expired. Blocks forever,
+// and is expected to be run in its own go routine.
+func expireIdempotencyKeys(sc *storage.Client, window time.Duration) {
+	for {
+		if n, err := sc.JobClient().ExpireIdempotencyKeys(window); err != nil {
+			log.Println("Failed to expire idempotency keys.", err)
+		} else if n > 0 {
+			log.Println("Expired idempotency keys", n)
+		}
+
+		time.Sleep(idempotencyExpireInterval)
+	}
+}
+
+// Returns a new random token an idempotency key is reserved with, so only the
+// request which reserved the key completes, or releases it.
+func newIdempotencyToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Returns the hex SHA-256 hash of the request's query options, and URLs, so
+// a replayed idempotency key can be checked to be of the same request.
+func idempotencyHash(query url.Values, urls []string) string {
+	h := sha256.New()
+	fmt.Fprintln(h, query.Encode())
+	for _, u := range urls {
+		fmt.Fprintln(h, u)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIdempotencyHash(t *testing.T) {
+	urls := []string{"http://example.com/a", "http://example.com/b"}
+	hash := idempotencyHash(url.Values{"depth": {"2"}, "forceCrawl": {""}}, urls)
+
+	assert.Len(t, hash, 64, "Expect hex SHA-256 hash")
+	assert.Equal(t, hash, idempotencyHash(url.Values{"forceCrawl": {""}, "depth": {"2"}}, urls), "Expect hash independent of query order")
+	assert.NotEqual(t, hash, idempotencyHash(url.Values{"depth": {"3"}, "forceCrawl": {""}}, urls), "Expect hash of the query")
+	assert.NotEqual(t, hash, idempotencyHash(url.Values{"depth": {"2"}, "forceCrawl": {""}}, urls[:1]), "Expect hash of the URLs")
+}
+
+func TestReserveIdempotencyKeyInvalid(t *testing.T) {
+	h := &JobScheduleHandler{version: apiV1}
+	for _, key := range []string{" ", strings.Repeat("k", maxIdempotencyKeyLen+1)} {
+		r, _ := http.NewRequest("POST", "/", nil)
+		w := httptest.NewRecorder()
+		_, reserved := h.reserveIdempotencyKey(w, r, key, newRequestedJobURLs(), jobOptions{})
+		assert.False(t, reserved, "Expect invalid key refused")
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expect bad request")
+	}
+}
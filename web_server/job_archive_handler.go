@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/archive"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Maximum size of a compressed job archive which can be imported.
+const maxImportSize = 128 * 1024 * 1024
+
+// Handles the request to export a previously scheduled job as a self-contained
+// gzip compressed tarball. The tarball contains the job, its settings, and its
+// URLs, the crawled URLs' information, results, link graph, and link scores.
+// With the 'bodies' query parameter the raw, and sanitized HTML stored for the
+// job's URLs are included. Jobs with archived results can be exported without
+// restoring them. If the job does not exist a 404 status code and message will
+// be returned.
+//
+// e.g:
+// curl -X GET -o job-1234.tar.gz "http://localhost:8080/job/1234/archive?bodies"
+//
+// Response:
+//	- Success: gzip compressed tarball
+//	- Failure: {code: <code>, message: <message>}
+type JobArchiveHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobArchiveHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobArchive request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, bodies := r.URL.Query()["bodies"]
+	a, jobErr := h.exportJob(id, bodies)
+	if jobErr != nil {
+		log.Println("routeJobArchive request job export failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d.tar.gz"`, id))
+	if err := archive.Write(w, a); err != nil {
+		log.Println("routeJobArchive failed to write archive", id, err)
+	}
+}
+
+// Connects to the remote service hosting job information, and exports
+// the job into an archive.
+func (h *JobArchiveHandler) exportJob(id common.JobId, bodies bool) (*common.JobArchive, *ErroMsg) {
+	a, err := h.sc.JobClient().Export(id, bodies)
+	if err != nil || a == nil {
+		return nil, &ErroMsg{
+			Source: "exportJob",
+			Info:   fmt.Sprintf("Failed to export job %d", id),
+			Err:    err,
+		}
+	}
+
+	return a, nil
+}
+
+// Handles the request to import a job archive exported by JobArchiveHandler,
+// possibly from another harvester instance. The body of the request is the
+// archive's gzip compressed tarball, of up to maxImportSize. The archive is
+// imported as a new job with the archived settings, and the new job's id is
+// returned. Archives with invalid settings are refused with a 400 status code.
+// The crawl information, links, and HTML of URLs already known are not
+// replaced, and the archived sanitized HTML is not imported.
+//
+// e.g:
+// curl -X POST --data-binary @job-1234.tar.gz "http://localhost:8080/jobs/import"
+//
+// Response:
+//	- Success: {jobId: <jobId>}
+//	- Failure: {code: <code>, message: <message>}
+type JobImportHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	a, err := archive.Read(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		log.Println("routeJobImport invalid archive.", err)
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid job archive: %v", err), http.StatusBadRequest)
+		return
+	}
+	if s := a.Job.Settings; s != nil {
+		if err := s.Validate(); err != nil {
+			log.Println("routeJobImport invalid archived job settings.", err)
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid job archive settings: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	id, err := h.sc.JobClient().Import(a)
+	if err != nil {
+		log.Println("routeJobImport failed to import job", a.Job.Id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to import job %d", a.Job.Id), http.StatusInternalServerError)
+		return
+	}
+	log.Println("routeJobImport imported job", a.Job.Id, "as", id)
+
+	h.version.writeData(w, jobScheduledMsg{JobId: id}, http.StatusOK)
+}
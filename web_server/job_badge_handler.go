@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Colors of the job badge's message for each state of the job.
+const (
+	badgeColorCrawling  = "#007ec6"
+	badgeColorPaused    = "#dfb317"
+	badgeColorComplete  = "#4c1"
+	badgeColorCancelled = "#e05d44"
+	badgeColorNotFound  = "#9f9f9f"
+)
+
+// Approximate width in pixels of a character of the badge's 11px Verdana
+// text, and the padding either side of the badge's label and message.
+const (
+	badgeCharWidth = 7
+	badgePadding   = 6
+)
+
+// Flat badge, in the style of shields.io, of a label and colored message.
+const badgeSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[3]s: %[4]s">
+<title>%[3]s: %[4]s</title>
+<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[6]d" height="20" fill="%[5]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="%[7]d" y="14">%[3]s</text>
+<text x="%[8]d" y="14">%[4]s</text>
+</g>
+</svg>
+`
+
+// Handles the request for an SVG badge of a previously scheduled job's state,
+// crawling, paused, cancelled, or complete, and the percentage of its URLs crawled. The
+// badge is intended to be embedded in pages, e.g: internal wikis and
+// dashboards, so is not cached by clients, and a job which does not exist is
+// responded to with a "not found" badge and a 404 status code.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/badge.svg"
+//
+// Response:
+//	- Success: image/svg+xml badge, e.g: "job 1234 | crawling 42%"
+//	- Failure: {code: <code>, message: <message>}
+type JobBadgeHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobBadgeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobBadge request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.sc.JobClient().GetJob(id)
+	if err != nil {
+		log.Println("routeJobBadge request job failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d status", id), http.StatusInternalServerError)
+		return
+	}
+
+	label := fmt.Sprintf("job %d", id)
+	status := http.StatusOK
+	msg, color := "not found", badgeColorNotFound
+	if job == nil {
+		status = http.StatusNotFound
+	} else {
+		msg, color = jobBadge(job.Status())
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(status)
+	w.Write(renderBadge(label, msg, color))
+}
+
+// Returns the badge message, the job's state and percentage of its URLs
+// crawled, and the message's color for the job's status.
+func jobBadge(status *common.JobStatus) (string, string) {
+	percent := 100
+	if total := status.Completed + status.Pending; total > 0 {
+		percent = status.Completed * 100 / total
+	}
+
+	state, color := "crawling", badgeColorCrawling
+	if status.Cancelled {
+		state, color = "cancelled", badgeColorCancelled
+	} else if status.Pending == 0 {
+		state, color = "complete", badgeColorComplete
+	} else if status.Paused {
+		state, color = "paused", badgeColorPaused
+	}
+	return fmt.Sprintf("%s %d%%", state, percent), color
+}
+
+// Renders the badge of the label and message. The label and message are
+// expected to be plain text which does not need escaping.
+func renderBadge(label, msg, color string) []byte {
+	labelWidth := len(label)*badgeCharWidth + 2*badgePadding
+	msgWidth := len(msg)*badgeCharWidth + 2*badgePadding
+
+	return []byte(fmt.Sprintf(badgeSVG,
+		labelWidth+msgWidth, labelWidth, label, msg, color, msgWidth,
+		labelWidth/2, labelWidth+msgWidth/2,
+	))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestJobBadge(t *testing.T) {
+	cases := []struct {
+		status     common.JobStatus
+		msg, color string
+	}{
+		{common.JobStatus{Completed: 21, Pending: 29}, "crawling 42%", badgeColorCrawling},
+		{common.JobStatus{Completed: 1, Pending: 3, Paused: true}, "paused 25%", badgeColorPaused},
+		{common.JobStatus{Completed: 4, Paused: true}, "complete 100%", badgeColorComplete},
+		{common.JobStatus{}, "complete 100%", badgeColorComplete},
+		{common.JobStatus{Completed: 2, Cancelled: true}, "cancelled 100%", badgeColorCancelled},
+	}
+	for _, c := range cases {
+		msg, color := jobBadge(&c.status)
+		assert.Equal(t, c.msg, msg, "Expect badge message")
+		assert.Equal(t, c.color, color, "Expect badge color")
+	}
+}
+
+func TestRenderBadge(t *testing.T) {
+	svg := struct {
+		Width int      `xml:"width,attr"`
+		Title string   `xml:"title"`
+		Text  []string `xml:"g>text"`
+	}{}
+	err := xml.Unmarshal(renderBadge("job 1234", "crawling 42%", badgeColorCrawling), &svg)
+	assert.NoError(t, err, "Expect valid SVG")
+	assert.Equal(t, "job 1234: crawling 42%", svg.Title, "Expect badge title")
+	assert.Equal(t, []string{"job 1234", "crawling 42%"}, svg.Text, "Expect label and message text")
+	assert.Equal(t, (8+12)*badgeCharWidth+4*badgePadding, svg.Width, "Expect width of label and message")
+}
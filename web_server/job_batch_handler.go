@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+)
+
+// Maximum number of jobs a batch can be submitted with.
+const maxBatchJobs = 1000
+
+// Request scheduling a batch of independent jobs
+type jobBatchRequest struct {
+	// URLs of each of the batch's jobs
+	Jobs [][]string `json:"jobs"`
+}
+
+// Response message to a successful batch of jobs being scheduled
+type jobBatchScheduledMsg struct {
+	// Ids of the scheduled jobs, in the order they were requested
+	JobIds []common.JobId `json:"jobIds"`
+
+	// Scheduled response of each job, in the same order
+	Jobs []jobScheduledMsg `json:"jobs"`
+}
+
+// Handles the request to schedule a batch of independent jobs at once, for
+// clients which kick off many small crawls programmatically. The body of the
+// request is a JSON object with the URLs of each job. The query parameters are
+// the same as JobScheduleHandler's, and apply to all of the batch's jobs. Each
+// job's URLs are validated the same way as a scheduled job's, and the whole
+// batch is rejected if any job is invalid, or has no URLs. The jobs are
+// created in a single transaction, so either all of them are scheduled, or
+// none are.
+//
+// Unlike a job group the batch isn't tracked once scheduled, each job's status
+// is checked individually.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080/jobs/batch?forceCrawl" << EOF
+// {"jobs": [["http://example.com"], ["http://example.org", "http://example.net"]]}
+// EOF
+//
+// Response:
+//   - Success: {jobIds: [1234, 1235], jobs: [{jobId: 1234, ...}, {jobId: 1235, ...}]}
+//   - Failure: {code: <code>, message: <message>}
+type JobBatchHandler struct {
+	// Validates, and queues each of the batch's jobs
+	scheduler *JobScheduleHandler
+
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobBatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	opts, err := getRequestedJobOptions(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobBatch request invalid options", err)
+		h.version.writeError(w, "BadRequest", err.Short(), http.StatusBadRequest)
+		return
+	}
+	opts.apiKeyId = requestAPIKeyId(r)
+	partial, partialErr := queryFlag(r.URL.Query(), "partial")
+	if partialErr != nil {
+		log.Println("routeJobBatch request invalid partial", partialErr)
+		h.version.writeError(w, "BadRequest", partialErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body := r.Body
+	if h.scheduler.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.scheduler.maxBodySize)
+	}
+	jobs, err := getRequestedJobBatch(body, partial, h.scheduler.maxURLs)
+	if err != nil {
+		log.Println("routeJobBatch request parse failed", err)
+		code, status := requestErrorStatus(err)
+		h.version.writeError(w, code, err.Short(), status)
+		return
+	}
+
+	// Each of the jobs counts against the client's rate, and quota.
+	if !h.scheduler.limiter.check(w, r, h.version, len(jobs)) {
+		log.Println("routeJobBatch request rate limited")
+		return
+	}
+	if !checkQuota(h.sc, w, r, h.version, len(jobs)) {
+		return
+	}
+
+	// Hosts which have opted out of crawling can not be scheduled
+	for i, requested := range jobs {
+		if optOut, err := h.scheduler.rejectOptedOut(requested, partial); err != nil {
+			log.Println("routeJobBatch request opt out check failed.", err)
+			h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+			return
+		} else if optOut != nil {
+			log.Println("routeJobBatch rejected opted out host", optOut.Host, "reason:", optOut.Reason)
+			h.version.writeError(w, "Forbidden", fmt.Sprintf("Job %d: %s", i, optedOutReason(optOut)), http.StatusForbidden)
+			return
+		}
+		if len(requested.urls) == 0 {
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Job %d: No valid URLs provided, %d rejected", i, len(requested.rejected)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	msg, err := h.scheduleBatch(jobs, opts)
+	if err != nil {
+		log.Println("routeJobBatch request batch schedule failed.", err)
+		h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, msg, http.StatusCreated)
+}
+
+// Reads the job batch request, validating the URLs of each of its jobs. The
+// requested URLs of each job are returned in the order of the batch's jobs.
+// If maxURLs is non-zero a job with more URLs than it is an error.
+func getRequestedJobBatch(in io.Reader, partial bool, maxURLs int) ([]*requestedJobURLs, *ErroMsg) {
+	batch := &jobBatchRequest{}
+	if err := json.NewDecoder(in).Decode(batch); err != nil {
+		if bodyTooLarge(err) {
+			return nil, &ErroMsg{
+				Source: "getRequestedJobBatch",
+				Info:   "Request body too large",
+				Err:    err,
+			}
+		}
+		return nil, &ErroMsg{
+			Source: "getRequestedJobBatch",
+			Info:   "Invalid job batch, expected JSON object",
+			Err:    err,
+		}
+	}
+
+	if len(batch.Jobs) == 0 || len(batch.Jobs) > maxBatchJobs {
+		return nil, &ErroMsg{
+			Source: "getRequestedJobBatch",
+			Info:   fmt.Sprintf("Job batch must have between 1 and %d jobs", maxBatchJobs),
+		}
+	}
+
+	return getRequestedJobsURLs("getRequestedJobBatch", batch.Jobs, partial, maxURLs)
+}
+
+// Creates all of the batch's jobs in a single transaction, and queues their
+// URLs once all of the jobs are created.
+func (h *JobBatchHandler) scheduleBatch(jobs []*requestedJobURLs, opts jobOptions) (*jobBatchScheduledMsg, *ErroMsg) {
+	urls := make([][]string, len(jobs))
+	cached := make([][]string, len(jobs))
+	for i, requested := range jobs {
+		var errMsg *ErroMsg
+		if cached[i], errMsg = h.scheduler.cachedURLs(requested.urls, opts); errMsg != nil {
+			return nil, errMsg
+		}
+		urls[i] = requested.urls
+	}
+
+	created, err := h.sc.JobClient().CreateJobsFromURLs(urls, opts.settings())
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "JobBatchHandler.scheduleBatch",
+			Info:   "Create Job batch failed",
+			Err:    err,
+		}
+	}
+
+	msg := &jobBatchScheduledMsg{
+		JobIds: make([]common.JobId, 0, len(created)),
+		Jobs:   make([]jobScheduledMsg, 0, len(created)),
+	}
+	for i, job := range created {
+		h.scheduler.queueJob(job, opts)
+		msg.JobIds = append(msg.JobIds, job.Id)
+		msg.Jobs = append(msg.Jobs, h.scheduler.scheduledMsg(job.Id, jobs[i], opts, cached[i]))
+	}
+	log.Println("JobBatchHandler.scheduleBatch: scheduled", len(created), "jobs")
+
+	return msg, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Response to a successful job cancel request
+type jobCancelMsg struct {
+	// Job which was requested to be cancelled
+	JobId common.JobId `json:"jobId"`
+
+	// True if the job was cancelled, false if it was already cancelled.
+	Cancelled bool `json:"cancelled"`
+}
+
+// Handles the request to cancel a previously scheduled job, e.g: one scheduled
+// with a bad seed list. The job's frontier of pending URLs is drained, and the
+// job's URLs are marked complete, so the job ends. Queued items of the job are
+// dropped by the foreman, and skipped by workers which have already received
+// them. Links found by URLs being crawled when the job is cancelled are not
+// followed. Cancelling a cancelled job has no effect. If the job does not exist
+// a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X POST "http://localhost:8080/job/1234/cancel"
+//
+// Response:
+//	- Success: {jobId: 1234, cancelled: true}
+//	- Failure: {code: <code>, message: <message>}
+type JobCancelHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobCancelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobCancel request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cancelled, jobErr := h.cancelJob(id)
+	if jobErr != nil {
+		log.Println("routeJobCancel request job cancel failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+	if cancelled {
+		log.Println("routeJobCancel cancelled job", id)
+	}
+
+	h.version.writeData(w, jobCancelMsg{JobId: id, Cancelled: cancelled}, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and cancels the job.
+func (h *JobCancelHandler) cancelJob(id common.JobId) (bool, *ErroMsg) {
+	if jobErr := jobMustExist(h.sc, id, "cancelJob"); jobErr != nil {
+		return false, jobErr
+	}
+
+	cancelled, err := h.sc.JobClient().Cancel(id)
+	if err != nil {
+		return false, &ErroMsg{
+			Source: "cancelJob",
+			Info:   fmt.Sprintf("Failed to cancel job %d", id),
+			Err:    err,
+		}
+	}
+
+	return cancelled, nil
+}
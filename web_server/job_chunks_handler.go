@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+)
+
+// Default number of tokens of a page's text chunks, and the number of tokens
+// each chunk repeats of the chunk before it.
+const (
+	defaultChunkSize    = 512
+	defaultChunkOverlap = 64
+)
+
+// Maximum number of tokens of a text chunk
+const maxChunkSize = 8192
+
+// Line of a job's text chunks export
+type jobChunkLineMsg struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+
+	// Index of the chunk within the page's chunks, and the number of chunks
+	// the page's text was split into.
+	Chunk  int `json:"chunk"`
+	Chunks int `json:"chunks"`
+
+	// Approximate number of tokens of the chunk's text
+	Tokens int    `json:"tokens"`
+	Text   string `json:"text"`
+}
+
+// Handles the request to export the main text content of a previously
+// scheduled job's pages as JSON Lines of token counted chunks, for feeding
+// into embedding or LLM ingestion pipelines. The text is only extracted for
+// jobs scheduled with 'extractText'. Each page's text is split into chunks of
+// at most 'size' tokens, default 512, each repeating 'overlap' tokens of the
+// chunk before it, default 64. Tokens are counted approximately, so the size
+// should leave headroom under the model's limit. Lines are streamed from the
+// database as they are read. An invalid size or overlap is rejected with a
+// 400. If the job does not exists a 404 status code and message will be
+// returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/chunks?size=256&overlap=32" > chunks.jsonl
+//
+// Response:
+//	- Success: {url: <url>, title: <title>, chunk: 0, chunks: 3, tokens: 256, text: <text>} lines
+//	- Failure: {code: <code>, message: <message>}
+type JobChunksHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobChunksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobChunks request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	size, overlap, err := getChunkOptions(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobChunks invalid chunk options.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeChunkLines(w, id, size, overlap)
+}
+
+// Returns the chunk size, and overlap of the query, or their defaults if not
+// set. The default overlap is reduced to an eighth of sizes it isn't less
+// than. An error is returned if the size is not between 1 and maxChunkSize, or
+// the overlap is not less than the size.
+func getChunkOptions(query url.Values) (int, int, error) {
+	size, overlap := defaultChunkSize, defaultChunkOverlap
+	if v := query.Get("size"); v != "" {
+		var err error
+		if size, err = strconv.Atoi(v); err != nil || size < 1 || size > maxChunkSize {
+			return 0, 0, fmt.Errorf("Invalid size: %s, must be between 1 and %d", v, maxChunkSize)
+		}
+		if overlap >= size {
+			overlap = size / 8
+		}
+	}
+	if v := query.Get("overlap"); v != "" {
+		var err error
+		if overlap, err = strconv.Atoi(v); err != nil || overlap < 0 || overlap >= size {
+			return 0, 0, fmt.Errorf("Invalid overlap: %s, must be less than the size %d", v, size)
+		}
+	}
+	return size, overlap, nil
+}
+
+// Streams the chunks of the text of the job's pages as JSON Lines, flushing
+// the response every resultsExportFlushLines lines. If the text can't be read
+// before any is written a 404 status code and message are written instead.
+func (h *JobChunksHandler) writeChunkLines(w http.ResponseWriter, id common.JobId, size, overlap int) {
+	flusher, _ := w.(http.Flusher)
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d-chunks.jsonl"`, id))
+		w.WriteHeader(http.StatusOK)
+	}
+	flush := func() error {
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	lines := 0
+	err := h.sc.JobClient().TextPages(id, func(page storage.TextPage) error {
+		if !started {
+			start()
+		}
+		for _, msg := range chunkLineMsgs(page, size, overlap) {
+			if err := enc.Encode(msg); err != nil {
+				return err
+			}
+			if lines++; lines%resultsExportFlushLines == 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil && !started {
+		jobErr := &ErroMsg{
+			Source: "writeChunkLines",
+			Info:   fmt.Sprintf("Failed to get job %d text", id),
+			Err:    err,
+		}
+		log.Println("routeJobChunks request job text failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("routeJobChunks failed to write chunks", id, err)
+		return
+	}
+
+	if !started {
+		start()
+	}
+	if err := flush(); err != nil {
+		log.Println("routeJobChunks failed to write chunks", id, err)
+	}
+}
+
+// Returns the export lines of the chunks of the page's text.
+func chunkLineMsgs(page storage.TextPage, size, overlap int) []jobChunkLineMsg {
+	chunks := common.ChunkText(page.Text, size, overlap)
+	msgs := make([]jobChunkLineMsg, 0, len(chunks))
+	for i, c := range chunks {
+		msgs = append(msgs, jobChunkLineMsg{
+			URL:    page.URL,
+			Title:  page.Title,
+			Chunk:  i,
+			Chunks: len(chunks),
+			Tokens: c.Tokens,
+			Text:   c.Text,
+		})
+	}
+	return msgs
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestGetChunkOptions(t *testing.T) {
+	cases := []struct {
+		query   string
+		size    int
+		overlap int
+		err     bool
+	}{
+		{query: "", size: defaultChunkSize, overlap: defaultChunkOverlap},
+		{query: "size=256&overlap=32", size: 256, overlap: 32},
+		{query: "size=32", size: 32, overlap: 4},
+		{query: "overlap=0", size: defaultChunkSize, overlap: 0},
+		{query: "size=0", err: true},
+		{query: "size=abc", err: true},
+		{query: "size=100000", err: true},
+		{query: "size=10&overlap=10", err: true},
+		{query: "overlap=-1", err: true},
+	}
+
+	for _, c := range cases {
+		query, _ := url.ParseQuery(c.query)
+		size, overlap, err := getChunkOptions(query)
+		if c.err {
+			assert.Error(t, err, "Expect error for %q", c.query)
+			continue
+		}
+		assert.NoError(t, err, "Expect no error for %q", c.query)
+		assert.Equal(t, c.size, size, "Expect size for %q", c.query)
+		assert.Equal(t, c.overlap, overlap, "Expect overlap for %q", c.query)
+	}
+}
+
+func TestChunkLineMsgs(t *testing.T) {
+	page := storage.TextPage{URL: "http://example.com/post", Title: "Post", Text: "one two six ten red"}
+
+	assert.Equal(t, []jobChunkLineMsg{
+		{URL: page.URL, Title: "Post", Chunk: 0, Chunks: 2, Tokens: 3, Text: "one two six"},
+		{URL: page.URL, Title: "Post", Chunk: 1, Chunks: 2, Tokens: 3, Text: "six ten red"},
+	}, chunkLineMsgs(page, 3, 1), "Expect a line per chunk of the page")
+
+	assert.Empty(t, chunkLineMsgs(storage.TextPage{URL: page.URL}, 3, 1), "Expect no lines for empty text")
+}
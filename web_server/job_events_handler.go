@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Interval the job's crawl log and status are polled for new events.
+const jobEventsInterval = 2 * time.Second
+
+// Longest the event stream is left idle before a keep-alive comment is sent,
+// so proxies don't close the connection.
+const jobEventsKeepAlive = 15 * time.Second
+
+// Most crawl log entries read for each poll of the job's events.
+const jobEventsBatch = 500
+
+// Events sent by the job event stream.
+const (
+	jobEventStatus    = "status"
+	jobEventCrawled   = "crawled"
+	jobEventFailed    = "failed"
+	jobEventCompleted = "completed"
+	jobEventDone      = "done"
+)
+
+// Progress of the job, sent as the data of status and done events.
+type jobEventStatusMsg struct {
+	JobId     common.JobId `json:"jobId"`
+	Completed int          `json:"completed"`
+	Pending   int          `json:"pending"`
+	Paused    bool         `json:"paused"`
+	Cancelled bool         `json:"cancelled"`
+}
+
+// Job URL whose crawl completed, sent as the data of completed events.
+type jobEventCompletedMsg struct {
+	URL         string    `json:"url"`
+	CompletedOn time.Time `json:"completedOn"`
+}
+
+// Handles the request to stream the progress of a previously scheduled job as
+// Server-Sent Events, so dashboards don't need to poll the job's status. The
+// stream starts with a status event of the job's progress. A crawled event is
+// sent for each of the job's requests which succeeds, and a failed event for
+// each which fails or responds with an error status, with the crawled URL's
+// status, size, and duration. A completed event is sent as each Job URL
+// completes, followed by a status event. Once all of the job's URLs complete
+// a done event is sent, and the stream ends. Events are polled from the job's
+// crawl log, so are delayed by up to the poll interval. Crawl events have ids,
+// so a reconnecting client's Last-Event-ID header resumes the stream from the
+// last event received. If the job does not exist a 404 status code and message
+// will be returned.
+//
+// e.g:
+// curl -N "http://localhost:8080/job/1234/events"
+//
+// Response:
+//	- Success: id: 42\nevent: crawled\ndata: {url: <url>, crawledOn: <time>, status: 200, bytes: 5120, durationMs: 230}\n\n ...
+//	- Failure: {code: <code>, message: <message>}
+type JobEventsHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobEventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobEvents request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Println("routeJobEvents response writer does not support streaming")
+		h.version.writeError(w, "DependancyFailure", "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	job, jobErr := h.getJob(id)
+	if jobErr != nil {
+		log.Println("routeJobEvents request job failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Reconnecting clients resume after the last event they received,
+	// otherwise only requests made after the stream starts are sent.
+	var lastId int64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if lastId, err = strconv.ParseInt(v, 10, 64); err != nil {
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid Last-Event-ID: %s", v), http.StatusBadRequest)
+			return
+		}
+	} else if lastId, err = h.sc.JobClient().LastCrawlEventId(id); err != nil {
+		log.Println("routeJobEvents request job crawl log failed.", err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d events", id), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	stream := &jobEventStream{w: w, flusher: flusher, sc: h.sc, id: id, lastId: lastId, completed: map[string]bool{}}
+	if err := stream.run(job, r.Context().Done()); err != nil {
+		log.Println("routeJobEvents stream of job", id, "ended.", err)
+	}
+}
+
+// Connects to the remote service hosting job information, and gets the job.
+func (h *JobEventsHandler) getJob(id common.JobId) (*storage.Job, *ErroMsg) {
+	job, err := h.sc.JobClient().GetJob(id)
+	if err != nil || job == nil {
+		return nil, &ErroMsg{
+			Source: "jobEvents",
+			Info:   fmt.Sprintf("Job %d does not exist", id),
+			Err:    err,
+		}
+	}
+	return job, nil
+}
+
+// Stream of a job's events to a client.
+type jobEventStream struct {
+	w       io.Writer
+	flusher http.Flusher
+	sc      *storage.Client
+	id      common.JobId
+
+	// Id of the last crawl log entry sent
+	lastId int64
+
+	// Job URLs known to be completed
+	completed map[string]bool
+
+	// When an event or keep-alive was last sent
+	lastSent time.Time
+}
+
+// Sends the job's events until all of its URLs complete, or done is closed.
+func (s *jobEventStream) run(job *storage.Job, done <-chan struct{}) error {
+	for _, u := range job.URLs {
+		s.completed[u.URL] = u.Completed
+	}
+	status := job.Status()
+	if err := s.send("", jobEventStatus, newJobEventStatusMsg(status)); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(jobEventsInterval)
+	defer ticker.Stop()
+	for status.Pending > 0 {
+		select {
+		case <-done:
+			return nil
+		case <-ticker.C:
+		}
+
+		var err error
+		if status, err = s.poll(); err != nil {
+			return err
+		}
+	}
+
+	return s.send("", jobEventDone, newJobEventStatusMsg(status))
+}
+
+// Sends the job's events since the previous poll, returning the job's status.
+func (s *jobEventStream) poll() (*common.JobStatus, error) {
+	for {
+		events, err := s.sc.JobClient().CrawlEventsSince(s.id, s.lastId, jobEventsBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range events {
+			event := jobEventCrawled
+			if e.Failed() {
+				event = jobEventFailed
+			}
+			if err := s.send(strconv.FormatInt(e.Id, 10), event, e); err != nil {
+				return nil, err
+			}
+			s.lastId = e.Id
+		}
+		if len(events) < jobEventsBatch {
+			break
+		}
+	}
+
+	job, err := s.sc.JobClient().GetJob(s.id)
+	if err != nil {
+		return nil, err
+	} else if job == nil {
+		return nil, fmt.Errorf("job %d no longer exists", s.id)
+	}
+
+	changed := false
+	for _, u := range job.URLs {
+		if !u.Completed || s.completed[u.URL] {
+			continue
+		}
+		s.completed[u.URL] = true
+		changed = true
+		if err := s.send("", jobEventCompleted, jobEventCompletedMsg{URL: u.URL, CompletedOn: u.CompletedOn}); err != nil {
+			return nil, err
+		}
+	}
+
+	status := job.Status()
+	if changed && status.Pending > 0 {
+		if err := s.send("", jobEventStatus, newJobEventStatusMsg(status)); err != nil {
+			return nil, err
+		}
+	}
+	if time.Now().Sub(s.lastSent) >= jobEventsKeepAlive {
+		if err := s.keepAlive(); err != nil {
+			return nil, err
+		}
+	}
+
+	return status, nil
+}
+
+// Sends the event to the client, flushing it immediately.
+func (s *jobEventStream) send(id, event string, data interface{}) error {
+	if err := writeEvent(s.w, id, event, data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	s.lastSent = time.Now()
+	return nil
+}
+
+// Sends a comment to the client, keeping the connection alive.
+func (s *jobEventStream) keepAlive() error {
+	if _, err := io.WriteString(s.w, ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	s.lastSent = time.Now()
+	return nil
+}
+
+// Returns the status event message of the job's status.
+func newJobEventStatusMsg(status *common.JobStatus) jobEventStatusMsg {
+	return jobEventStatusMsg{
+		JobId:     status.Id,
+		Completed: status.Completed,
+		Pending:   status.Pending,
+		Paused:    status.Paused,
+		Cancelled: status.Cancelled,
+	}
+}
+
+// Writes the Server-Sent Event with the data encoded as JSON. The id is omitted
+// if empty.
+func writeEvent(w io.Writer, id, event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	return err
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestWriteEvent(t *testing.T) {
+	buf := &bytes.Buffer{}
+	crawled := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	require.NoError(t, writeEvent(buf, "42", jobEventCrawled, common.JobCrawlEvent{Id: 42, URL: "http://example.com", CrawledOn: crawled, Status: 200, Bytes: 10, DurationMs: 5}))
+	require.NoError(t, writeEvent(buf, "", jobEventStatus, newJobEventStatusMsg(&common.JobStatus{Id: 1, Completed: 1, Pending: 2})))
+
+	assert.Equal(t, "id: 42\nevent: crawled\n"+
+		`data: {"url":"http://example.com","crawledOn":"2015-01-02T03:04:05Z","status":200,"bytes":10,"durationMs":5}`+"\n\n"+
+		"event: status\n"+
+		`data: {"jobId":1,"completed":1,"pending":2,"paused":false,"cancelled":false}`+"\n\n", buf.String())
+}
+
+func TestJobCrawlEventFailed(t *testing.T) {
+	assert.False(t, common.JobCrawlEvent{Status: 200}.Failed(), "Expect success")
+	assert.True(t, common.JobCrawlEvent{Status: 404}.Failed(), "Expect error status failed")
+	assert.True(t, common.JobCrawlEvent{}.Failed(), "Expect failed request")
+}
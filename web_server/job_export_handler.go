@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// Longest destination name a job can be exported to.
+const maxExportDestinationLen = 100
+
+// Response to a job export watermarks request
+type jobExportWatermarksMsg struct {
+	JobId common.JobId `json:"jobId"`
+
+	// Watermark of each destination the job has been exported to
+	Exports []common.JobExportWatermark `json:"exports"`
+}
+
+// Handles the request to incrementally export a previously scheduled job's
+// crawled URLs to a destination, e.g: for loading a monitoring job's crawls into
+// a warehouse. A POST exports the job's URLs crawled since the job was
+// previously exported to the destination named by the 'destination' query
+// parameter, and records the watermark the next export starts from. URLs
+// re-crawled since the previous export are exported again. Setting the 'full'
+// query parameter to true exports all of the job's crawled URLs, and resets the
+// destination's watermark. Each destination's watermark is independent. A GET
+// lists the watermark of each destination the job has been exported to. If the
+// job does not exist a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X POST "http://localhost:8080/job/1234/export?destination=warehouse"
+//
+// Response:
+//	- Success: {jobId: 1234, destination: "warehouse", since: <time>, until: <time>, urls: [...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobExportHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		h.version.methodNotAllowed(w, "GET, POST")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobExport request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "GET" {
+		watermarks, jobErr := h.jobExportWatermarks(id)
+		if jobErr != nil {
+			log.Println("routeJobExport request job export watermarks failed.", jobErr)
+			h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+			return
+		}
+
+		h.version.writeData(w, jobExportWatermarksMsg{JobId: id, Exports: watermarks}, http.StatusOK)
+		return
+	}
+
+	destination, full, err := exportParams(r)
+	if err != nil {
+		log.Println("routeJobExport invalid parameters.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	export, jobErr := h.exportJob(id, destination, full)
+	if jobErr != nil {
+		log.Println("routeJobExport request job export failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+	log.Println("routeJobExport exported", len(export.URLs), "URLs of job", id, "to", destination)
+
+	h.version.writeData(w, export, http.StatusOK)
+}
+
+// Returns the destination and full query parameters of the export request,
+// failing if either is invalid.
+func exportParams(r *http.Request) (string, bool, error) {
+	q := r.URL.Query()
+
+	destination := q.Get("destination")
+	if destination == "" {
+		return "", false, fmt.Errorf("No destination provided")
+	} else if len(destination) > maxExportDestinationLen {
+		return "", false, fmt.Errorf("Invalid destination, must be at most %d characters", maxExportDestinationLen)
+	}
+
+	full := false
+	if v := q.Get("full"); v != "" {
+		var err error
+		if full, err = strconv.ParseBool(v); err != nil {
+			return "", false, fmt.Errorf("Invalid full: %s", v)
+		}
+	}
+
+	return destination, full, nil
+}
+
+// Connects to the remote service hosting job information, and exports the
+// job's URLs crawled since its previous export to the destination.
+func (h *JobExportHandler) exportJob(id common.JobId, destination string, full bool) (*common.JobExport, *ErroMsg) {
+	export, err := h.sc.JobClient().ExportSince(id, destination, full)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "exportJob",
+			Info:   fmt.Sprintf("Failed to export job %d to %s", id, destination),
+			Err:    err,
+		}
+	}
+
+	return export, nil
+}
+
+// Connects to the remote service hosting job information, and gets the
+// watermark of each destination the job has been exported to.
+func (h *JobExportHandler) jobExportWatermarks(id common.JobId) ([]common.JobExportWatermark, *ErroMsg) {
+	if jobErr := jobMustExist(h.sc, id, "jobExportWatermarks"); jobErr != nil {
+		return nil, jobErr
+	}
+
+	watermarks, err := h.sc.JobClient().ExportWatermarks(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobExportWatermarks",
+			Info:   fmt.Sprintf("Failed to get job %d export watermarks", id),
+			Err:    err,
+		}
+	}
+
+	return watermarks, nil
+}
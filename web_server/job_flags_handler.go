@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Response to a job flags request
+type jobFlagsMsg struct {
+	JobId common.JobId `json:"jobId"`
+
+	// Flags the job's crawled pages were matched against
+	Flags []common.JobFlag `json:"flags"`
+
+	// URLs of the pages which matched each flag, keyed by flag name
+	Flagged map[string][]string `json:"flagged"`
+}
+
+// Handles the request for the flags of a previously scheduled job, and the URLs
+// of its crawled pages whose content matched each, e.g: pages mentioning a
+// product recall. Flags are set by the 'keyword' and 'flag' parameters the job
+// was scheduled with. If the job does not exists a 404 status code and message
+// will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/flags"
+//
+// Response:
+//	- Success: {jobId: 1234, flags: [{name: <name>, pattern: <pattern>}, ...], flagged: {<name>: [<url>, ...], ...}}
+//	- Failure: {code: <code>, message: <message>}
+type JobFlagsHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobFlagsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobFlags request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msg, jobErr := h.jobFlags(id)
+	if jobErr != nil {
+		log.Println("routeJobFlags request job flags failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	h.version.writeData(w, msg, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and gets the job's
+// flags, and the URLs of its pages which matched them.
+func (h *JobFlagsHandler) jobFlags(id common.JobId) (*jobFlagsMsg, *ErroMsg) {
+	flagged, err := h.sc.JobClient().Flagged(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobFlags",
+			Info:   fmt.Sprintf("Failed to get job %d flagged URLs", id),
+			Err:    err,
+		}
+	}
+
+	flags, err := h.sc.JobClient().Flags(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobFlags",
+			Info:   fmt.Sprintf("Failed to get job %d flags", id),
+			Err:    err,
+		}
+	}
+	if flags == nil {
+		flags = []common.JobFlag{}
+	}
+
+	return &jobFlagsMsg{JobId: id, Flags: flags, Flagged: flagged}, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the content freshness report of a previously scheduled
+// job. The report groups the job's crawled URLs by host, and buckets them by the
+// age of their last updated date. The date is extracted from the content's meta
+// tags, JSON-LD, or Last-Modified header. URLs without a known date are counted
+// under the 'unknown' bucket. If the job does not exists a 404 status code and
+// message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/freshness/1234"
+//
+// Response:
+//	- Success: {<host>: {total: 10, buckets: {day: 1, week: 2, unknown: 7}, oldest: <date>, newest: <date>}, ...}
+//	- Failure: {code: <code>, message: <message>}
+type JobFreshnessHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobFreshnessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobFreshness request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, jobErr := h.jobFreshness(id)
+	if jobErr != nil {
+		log.Println("routeJobFreshness request job freshness failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Write job freshness report out
+	h.version.writeData(w, report, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and generates
+// the job's freshness report.
+func (h *JobFreshnessHandler) jobFreshness(id common.JobId) (common.FreshnessReport, *ErroMsg) {
+	report, err := h.sc.JobClient().Freshness(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobFreshness",
+			Info:   fmt.Sprintf("Failed to get job %d freshness report", id),
+			Err:    err,
+		}
+	}
+
+	return report, nil
+}
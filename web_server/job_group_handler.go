@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// Maximum number of jobs a group can be submitted with.
+const maxGroupJobs = 1000
+
+// Request submitting a group of jobs
+type jobGroupRequest struct {
+	// Name of the group
+	Name string `json:"name"`
+
+	// URL notified once all of the group's jobs complete. Optional.
+	Webhook string `json:"webhook"`
+
+	// URLs of each of the group's jobs
+	Jobs [][]string `json:"jobs"`
+}
+
+// Response message to a successful job group being scheduled
+type jobGroupScheduledMsg struct {
+	// Id, and name of the scheduled group
+	GroupId common.GroupId `json:"groupId"`
+	Name    string         `json:"name"`
+
+	// Jobs of the group, in the order they were requested
+	Jobs []jobScheduledMsg `json:"jobs"`
+
+	// Path of the group's status
+	StatusURL string `json:"statusURL"`
+}
+
+// Handles the request to schedule multiple jobs as a named group. The body of
+// the request is a JSON object with the group's name, an optional webhook, and
+// the URLs of each job. The query parameters are the same as JobScheduleHandler's,
+// and apply to all of the group's jobs. Each job's URLs are validated the same
+// way as a scheduled job's, and the whole group is rejected if any job is
+// invalid, or has no URLs.
+//
+// Once all of the group's jobs complete, the foreman posts the group's status,
+// see JobGroupStatusHandler, to the webhook as JSON.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080/groups?forceCrawl" << EOF
+// {"name": "nightly", "webhook": "https://example.com/hooks/nightly", "jobs": [["http://example.com"], ["http://example.org"]]}
+// EOF
+//
+// Response:
+//   - Success: {groupId: 12, name: "nightly", jobs: [{jobId: 1234, ...}, {jobId: 1235, ...}], statusURL: "/groups/12"}
+//   - Failure: {code: <code>, message: <message>}
+type JobGroupHandler struct {
+	// Schedules each of the group's jobs
+	scheduler *JobScheduleHandler
+
+	sc       *storage.Client
+	rootPath string
+	version  apiVersion
+}
+
+func (h *JobGroupHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	opts, err := getRequestedJobOptions(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobGroup request invalid options", err)
+		h.version.writeError(w, "BadRequest", err.Short(), http.StatusBadRequest)
+		return
+	}
+	opts.apiKeyId = requestAPIKeyId(r)
+	partial, partialErr := queryFlag(r.URL.Query(), "partial")
+	if partialErr != nil {
+		log.Println("routeJobGroup request invalid partial", partialErr)
+		h.version.writeError(w, "BadRequest", partialErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body := r.Body
+	if h.scheduler.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.scheduler.maxBodySize)
+	}
+	group, jobs, err := getRequestedJobGroup(body, partial, h.scheduler.maxURLs)
+	if err != nil {
+		log.Println("routeJobGroup request parse failed", err)
+		code, status := requestErrorStatus(err)
+		h.version.writeError(w, code, err.Short(), status)
+		return
+	}
+
+	// Each of the jobs counts against the client's rate, and quota.
+	if !h.scheduler.limiter.check(w, r, h.version, len(jobs)) {
+		log.Println("routeJobGroup request rate limited")
+		return
+	}
+	if !checkQuota(h.sc, w, r, h.version, len(jobs)) {
+		return
+	}
+
+	// Hosts which have opted out of crawling can not be scheduled
+	for i, requested := range jobs {
+		if optOut, err := h.scheduler.rejectOptedOut(requested, partial); err != nil {
+			log.Println("routeJobGroup request opt out check failed.", err)
+			h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+			return
+		} else if optOut != nil {
+			log.Println("routeJobGroup rejected opted out host", optOut.Host, "reason:", optOut.Reason)
+			h.version.writeError(w, "Forbidden", fmt.Sprintf("Job %d: %s", i, optedOutReason(optOut)), http.StatusForbidden)
+			return
+		}
+		if len(requested.urls) == 0 {
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Job %d: No valid URLs provided, %d rejected", i, len(requested.rejected)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	msg, err := h.scheduleGroup(group, jobs, opts)
+	if err != nil {
+		log.Println("routeJobGroup request group schedule failed.", err)
+		h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", msg.StatusURL)
+	h.version.writeData(w, msg, http.StatusCreated)
+}
+
+// Reads the job group request, validating the group, and the URLs of each of
+// its jobs. The requested URLs of each job are returned in the order of the
+// group's jobs. If maxURLs is non-zero a job with more URLs than it is an error.
+func getRequestedJobGroup(in io.Reader, partial bool, maxURLs int) (*jobGroupRequest, []*requestedJobURLs, *ErroMsg) {
+	group := &jobGroupRequest{}
+	if err := json.NewDecoder(in).Decode(group); err != nil {
+		if bodyTooLarge(err) {
+			return nil, nil, &ErroMsg{
+				Source: "getRequestedJobGroup",
+				Info:   "Request body too large",
+				Err:    err,
+			}
+		}
+		return nil, nil, &ErroMsg{
+			Source: "getRequestedJobGroup",
+			Info:   "Invalid job group, expected JSON object",
+			Err:    err,
+		}
+	}
+
+	if group.Name == "" {
+		return nil, nil, &ErroMsg{Source: "getRequestedJobGroup", Info: "Job group name is required"}
+	}
+	if group.Webhook != "" {
+		if u, err := url.Parse(group.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, nil, &ErroMsg{
+				Source: "getRequestedJobGroup",
+				Info:   fmt.Sprintf("Invalid webhook %s, must be an absolute http or https URL", group.Webhook),
+				Err:    err,
+			}
+		}
+	}
+	if len(group.Jobs) == 0 || len(group.Jobs) > maxGroupJobs {
+		return nil, nil, &ErroMsg{
+			Source: "getRequestedJobGroup",
+			Info:   fmt.Sprintf("Job group must have between 1 and %d jobs", maxGroupJobs),
+		}
+	}
+
+	jobs, err := getRequestedJobsURLs("getRequestedJobGroup", group.Jobs, partial, maxURLs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return group, jobs, nil
+}
+
+// Validates the URLs of each of the jobs, returning the requested URLs in the
+// order of the jobs. Errors identify the job by its index.
+func getRequestedJobsURLs(source string, lists [][]string, partial bool, maxURLs int) ([]*requestedJobURLs, *ErroMsg) {
+	jobs := make([]*requestedJobURLs, len(lists))
+	for i, urls := range lists {
+		if maxURLs > 0 && len(urls) > maxURLs {
+			err := tooManyURLsErr(source, maxURLs)
+			err.Info = fmt.Sprintf("Job %d: %s", i, err.Info)
+			return nil, err
+		}
+		jobs[i] = newRequestedJobURLs()
+		for _, u := range urls {
+			if err := jobs[i].add(u, partial); err != nil {
+				err.Info = fmt.Sprintf("Job %d: %s", i, err.Info)
+				return nil, err
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// Creates the group, and schedules each of its jobs. The group is marked as
+// scheduled once all of its jobs are, so it isn't completed early.
+func (h *JobGroupHandler) scheduleGroup(req *jobGroupRequest, jobs []*requestedJobURLs, opts jobOptions) (*jobGroupScheduledMsg, *ErroMsg) {
+	jobClient := h.sc.JobClient()
+
+	group, err := jobClient.CreateGroup(req.Name, req.Webhook)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "JobGroupHandler.scheduleGroup",
+			Info:   "Create Job group failed",
+			Err:    err,
+		}
+	}
+
+	msg := &jobGroupScheduledMsg{
+		GroupId:   group.Id,
+		Name:      group.Name,
+		Jobs:      make([]jobScheduledMsg, 0, len(jobs)),
+		StatusURL: h.version.path(h.rootPath, fmt.Sprintf("groups/%d", group.Id)),
+	}
+	for _, requested := range jobs {
+		cached, errMsg := h.scheduler.cachedURLs(requested.urls, opts)
+		if errMsg != nil {
+			return nil, errMsg
+		}
+
+		id, errMsg := h.scheduler.scheduleJob(requested.urls, requested.checksums, opts)
+		if errMsg != nil {
+			return nil, errMsg
+		}
+		if err := jobClient.SetJobGroup(id, group.Id); err != nil {
+			return nil, &ErroMsg{
+				Source: "JobGroupHandler.scheduleGroup",
+				Info:   fmt.Sprintf("Add Job %d to group failed", id),
+				Err:    err,
+			}
+		}
+		msg.Jobs = append(msg.Jobs, h.scheduler.scheduledMsg(id, requested, opts, cached))
+	}
+
+	if err := jobClient.GroupScheduled(group.Id); err != nil {
+		return nil, &ErroMsg{
+			Source: "JobGroupHandler.scheduleGroup",
+			Info:   "Mark Job group scheduled failed",
+			Err:    err,
+		}
+	}
+	log.Println("JobGroupHandler.scheduleGroup: scheduled group", group.Id, group.Name, "with", len(jobs), "jobs")
+
+	return msg, nil
+}
+
+// Handles the request checking on the status of a job group. The status is
+// aggregated from the status of the group's jobs. If the group does not exist
+// a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/groups/12"
+//
+// Response:
+//	- Success: {groupId: 12, name: "nightly", createdOn: <time>, complete: false, completedJobs: 1, pendingJobs: 1, completedURLs: 1, pendingURLs: 1, jobs: [{id: 1234, ...}]}
+//	- Failure: {code: <code>, message: <message>}
+type JobGroupStatusHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobGroupStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := groupIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobGroupStatus request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status, err := h.sc.JobClient().GroupStatus(id)
+	if err != nil {
+		log.Println("routeJobGroupStatus failed to get group", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get group %d", id), http.StatusInternalServerError)
+		return
+	}
+	if status == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Group %d not found", id), http.StatusNotFound)
+		return
+	}
+
+	h.version.writeData(w, status, http.StatusOK)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestGetRequestedJobGroup(t *testing.T) {
+	body := `{"name": "nightly", "webhook": "https://example.com/hook", "jobs": [["http://example.com", "http://example.com"], ["http://example.org", "gopher://example.org"]]}`
+
+	_, _, err := getRequestedJobGroup(strings.NewReader(body), false, 0)
+	require.NotNil(t, err, "Expect invalid URL to reject group")
+	assert.Equal(t, "Job 1: Invalid URL: gopher://example.org", err.Short(), "Expect invalid job identified")
+
+	group, jobs, err := getRequestedJobGroup(strings.NewReader(body), true, 0)
+	require.Nil(t, err, "Expect partial group accepted")
+	assert.Equal(t, "nightly", group.Name, "Expect group name")
+	assert.Equal(t, "https://example.com/hook", group.Webhook, "Expect group webhook")
+	require.Len(t, jobs, 2, "Expect URLs of each job")
+	assert.Equal(t, []string{"http://example.com"}, jobs[0].urls, "Expect first job's URLs")
+	assert.Len(t, jobs[0].duplicates, 1, "Expect first job's duplicate")
+	assert.Equal(t, []string{"http://example.org"}, jobs[1].urls, "Expect second job's URLs")
+	assert.Len(t, jobs[1].rejected, 1, "Expect second job's rejected URL")
+}
+
+func TestGetRequestedJobGroupInvalid(t *testing.T) {
+	tooMany := make([]string, maxGroupJobs+1)
+	for i := range tooMany {
+		tooMany[i] = `["http://example.com"]`
+	}
+
+	cases := map[string]string{
+		"not JSON":         `http://example.com`,
+		"missing name":     `{"jobs": [["http://example.com"]]}`,
+		"relative webhook": `{"name": "a", "webhook": "/hook", "jobs": [["http://example.com"]]}`,
+		"webhook scheme":   `{"name": "a", "webhook": "ftp://example.com/hook", "jobs": [["http://example.com"]]}`,
+		"no jobs":          `{"name": "a", "jobs": []}`,
+		"too many jobs":    fmt.Sprintf(`{"name": "a", "jobs": [%s]}`, strings.Join(tooMany, ",")),
+	}
+	for name, body := range cases {
+		_, _, err := getRequestedJobGroup(strings.NewReader(body), false, 0)
+		assert.NotNil(t, err, "Expect %s rejected", name)
+	}
+
+	body := `{"name": "a", "jobs": [["http://example.com"], ["http://example.org", "http://example.net"]]}`
+	_, _, err := getRequestedJobGroup(strings.NewReader(body), false, 1)
+	require.NotNil(t, err, "Expect job over the URL limit rejected")
+	assert.Equal(t, "Job 1: Too many URLs, a job can have at most 1 URLs", err.Short(), "Expect job over the limit identified")
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"path"
+)
+
+// Routes requests for a job's resources, e.g: job/<jobId>/archive, to the
+// handler of the resource. Resources may be nested a level deep, e.g:
+// job/<jobId>/results/export. Unknown resources are responded to with a 404.
+type JobResourceHandler struct {
+	// Handlers keyed by resource name, e.g: "archive", or "results/export"
+	resources map[string]http.Handler
+	version   apiVersion
+}
+
+func (h *JobResourceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	dir, name := path.Dir(r.URL.Path), path.Base(r.URL.Path)
+
+	// Nested resources take precedence, so job/<jobId>/results/export isn't
+	// routed as the export resource of job "results".
+	job := path.Base(path.Dir(dir))
+	resource, ok := h.resources[path.Base(dir)+"/"+name]
+	if !ok {
+		job = path.Base(dir)
+		resource, ok = h.resources[name]
+	}
+	if !ok || job == "job" || job == "." || job == "/" {
+		h.version.writeError(w, "NotFound", "Unknown job resource", http.StatusNotFound)
+		return
+	}
+
+	resource.ServeHTTP(w, r)
+}
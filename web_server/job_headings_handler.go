@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the heading report of a previously scheduled job.
+// The report lists the job's crawled HTML pages which share duplicate titles
+// or h1 headings, and the pages which are missing a title or description.
+// If the job does not exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/headings/1234"
+//
+// Response:
+//	- Success: {duplicateTitles: [{value: <title>, urls: [<url>, ...]}, ...], duplicateH1s: [...],
+//	            missingTitles: [<url>, ...], missingDescriptions: [<url>, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobHeadingsHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobHeadingsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobHeadings request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, jobErr := h.jobHeadings(id)
+	if jobErr != nil {
+		log.Println("routeJobHeadings request job headings failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Write job heading report out
+	h.version.writeData(w, report, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and generates
+// the job's heading report.
+func (h *JobHeadingsHandler) jobHeadings(id common.JobId) (*common.HeadingReport, *ErroMsg) {
+	report, err := h.sc.JobClient().Headings(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobHeadings",
+			Info:   fmt.Sprintf("Failed to get job %d heading report", id),
+			Err:    err,
+		}
+	}
+
+	return report, nil
+}
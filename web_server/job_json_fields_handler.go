@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the fields extracted by a previously scheduled job's
+// 'jsonField' JSONPath expressions from its crawled JSON responses. Fields are
+// keyed by URL, then field name, and each field's value is the list of values
+// its expression selected. If the job does not exists a 404 status code and
+// message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/jsonfields/1234"
+//
+// Response:
+//	- Success: {<url>: {<name>: [<value>, ...], ...}, ...}
+//	- Failure: {code: <code>, message: <message>}
+type JobJSONFieldsHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobJSONFieldsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobJSONFields request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields, jobErr := h.jobJSONFields(id)
+	if jobErr != nil {
+		log.Println("routeJobJSONFields request job JSON fields failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Write job JSON fields out
+	h.version.writeData(w, fields, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and gets the fields
+// extracted from the job's JSON responses.
+func (h *JobJSONFieldsHandler) jobJSONFields(id common.JobId) (map[string]map[string]interface{}, *ErroMsg) {
+	fields, err := h.sc.JobClient().JSONFields(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobJSONFields",
+			Info:   fmt.Sprintf("Failed to get job %d JSON fields", id),
+			Err:    err,
+		}
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Default and max number of jobs returned by a job list request
+const (
+	defaultJobListLimit = 100
+	maxJobListLimit     = 1000
+)
+
+// Response to a successful job list request
+type jobListMsg struct {
+	// Summaries of the most recent jobs, newest first
+	Jobs []common.JobSummary `json:"jobs"`
+
+	// Offset of the next page of jobs. Omitted if this is the last page.
+	NextOffset int `json:"nextOffset,omitempty"`
+}
+
+// Handles the request to list the most recently scheduled jobs, and a
+// summary of their progress. The number of jobs listed can be set with
+// the 'limit' query parameter, and the number of newer jobs skipped with
+// the 'offset' parameter. Responses include the offset of the next page
+// if there may be more jobs.
+//
+// The jobs listed can be filtered with the optional 'status' query parameter,
+// one of "running", "waiting", "completed", "paused", or "cancelled", the
+// 'createdAfter' parameter, an RFC 3339 time or a date, e.g: 2017-01-02, and
+// the repeatable 'tag' parameter, the tags the job was scheduled with. Jobs
+// must have all of the tags to be listed. Invalid filters are rejected with a
+// 400.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/jobs?limit=10&offset=20&status=running&tag=team-seo&tag=client-a"
+//
+// Response:
+//	- Success: {jobs: [{id: 1234, createdOn: <time>, completed: 2, pending: 0, archived: false, paused: false, cancelled: false, status: "completed", tags: ["team-seo"]}, ...], nextOffset: 30}
+//	- Failure: {code: <code>, message: <message>}
+type JobListHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	limit, err := jobListLimit(r)
+	if err != nil {
+		log.Println("routeJobList invalid limit.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	offset, err := jobListOffset(r)
+	if err != nil {
+		log.Println("routeJobList invalid offset.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter, err := getJobListFilter(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobList invalid filter.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	jobs, err := h.sc.JobClient().ListJobs(filter, limit, offset)
+	if err != nil {
+		log.Println("routeJobList request job list failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to list jobs", http.StatusInternalServerError)
+		return
+	}
+
+	msg := jobListMsg{Jobs: jobs}
+	if len(jobs) == limit {
+		msg.NextOffset = offset + limit
+	}
+	h.version.writeData(w, msg, http.StatusOK)
+}
+
+// Returns the job list limit from the request's 'limit' query parameter,
+// or the default if not set.
+func jobListLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultJobListLimit, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 || limit > maxJobListLimit {
+		return 0, fmt.Errorf("Invalid limit: %s, must be 1 to %d", v, maxJobListLimit)
+	}
+	return limit, nil
+}
+
+// Returns the job list offset from the request's 'offset' query parameter,
+// or zero if not set.
+func jobListOffset(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("offset")
+	if v == "" {
+		return 0, nil
+	}
+
+	offset, err := strconv.Atoi(v)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("Invalid offset: %s, must be 0 or more", v)
+	}
+	return offset, nil
+}
+
+// Reads the job list filter from the query's 'status', 'createdAfter', and
+// 'tag' parameters. An error is returned if a parameter is invalid.
+func getJobListFilter(query url.Values) (storage.JobListFilter, error) {
+	filter := storage.JobListFilter{}
+
+	if status := query.Get("status"); status != "" {
+		if !common.ValidJobStatus(status) {
+			return filter, fmt.Errorf("Invalid status: %s, must be one of %s, %s, %s, %s, or %s", status,
+				common.JobStatusRunning, common.JobStatusWaiting, common.JobStatusCompleted, common.JobStatusPaused, common.JobStatusCancelled)
+		}
+		filter.Status = status
+	}
+
+	if v := query.Get("createdAfter"); v != "" {
+		after, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			if after, err = time.Parse("2006-01-02", v); err != nil {
+				return filter, fmt.Errorf("Invalid createdAfter: %s, must be an RFC 3339 time or date", v)
+			}
+		}
+		filter.CreatedAfter = after
+	}
+
+	tags, errMsg := getRequestedJobTags(query)
+	if errMsg != nil {
+		return filter, errMsg.Err
+	}
+	filter.Tags = tags
+
+	return filter, nil
+}
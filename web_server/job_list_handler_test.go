@@ -0,0 +1,58 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestJobListOffset(t *testing.T) {
+	offset, err := jobListOffset(httptest.NewRequest("GET", "/jobs", nil))
+	require.NoError(t, err, "Expect default offset")
+	assert.Equal(t, 0, offset)
+
+	offset, err = jobListOffset(httptest.NewRequest("GET", "/jobs?offset=20", nil))
+	require.NoError(t, err, "Expect offset")
+	assert.Equal(t, 20, offset)
+
+	for _, v := range []string{"-1", "abc"} {
+		_, err := jobListOffset(httptest.NewRequest("GET", "/jobs?offset="+v, nil))
+		assert.Error(t, err, v)
+	}
+}
+
+func TestGetJobListFilter(t *testing.T) {
+	filter, err := getJobListFilter(url.Values{})
+	require.NoError(t, err, "Expect empty filter")
+	assert.Equal(t, storage.JobListFilter{}, filter)
+
+	filter, err = getJobListFilter(url.Values{"status": {"paused"}, "createdAfter": {"2017-01-02T03:04:05Z"}, "tag": {"Team-SEO"}})
+	require.NoError(t, err, "Expect filter")
+	assert.Equal(t, storage.JobListFilter{
+		Status:       common.JobStatusPaused,
+		CreatedAfter: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC),
+		Tags:         []string{"team-seo"},
+	}, filter)
+
+	filter, err = getJobListFilter(url.Values{"tag": {"team-seo", "client-a", "team-seo"}})
+	require.NoError(t, err, "Expect tags filter")
+	assert.Equal(t, []string{"team-seo", "client-a"}, filter.Tags, "Expect each tag once")
+
+	filter, err = getJobListFilter(url.Values{"createdAfter": {"2017-01-02"}})
+	require.NoError(t, err, "Expect date filter")
+	assert.Equal(t, time.Date(2017, 1, 2, 0, 0, 0, 0, time.UTC), filter.CreatedAfter)
+
+	for _, q := range []url.Values{
+		{"status": {"archived"}},
+		{"createdAfter": {"yesterday"}},
+		{"tag": {"a b"}},
+	} {
+		_, err := getJobListFilter(q)
+		assert.Error(t, err, q.Encode())
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats the download manifest of a job can be exported in.
+const (
+	manifestFormatJSON   = "json"
+	manifestFormatCSV    = "csv"
+	manifestFormatSHA256 = "sha256"
+)
+
+// Response to a job manifest request in the JSON format
+type jobManifestMsg struct {
+	JobId common.JobId `json:"jobId"`
+
+	// Downloads of each of the job's URLs, ordered by URL
+	Downloads []jobManifestEntry `json:"downloads"`
+}
+
+// Download of a job's URL, and its state
+type jobManifestEntry struct {
+	common.JobDownload
+
+	// One of the common.Download* states
+	Status string `json:"status"`
+}
+
+// Handles the request for the download manifest of a previously scheduled
+// download job, listing the file downloaded for each of the job's URLs, its
+// size, checksum, and if it was verified against the checksum it was scheduled
+// with. The 'format' query parameter selects the format of the manifest,
+// either "json" (the default), "csv", or "sha256". The sha256 format lists the
+// checksum of each downloaded file in the form checked by 'sha256sum -c', run
+// from the workers' download directory. If the job does not exists a 404
+// status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/manifest?format=sha256"
+//
+// Response:
+//	- Success: {jobId: 1234, downloads: [{url: <url>, file: <file>, bytes: <bytes>, sha256: <sha256>, status: "verified", ...}, ...]}
+//	- Success: manifest in the requested csv, or sha256 format
+//	- Failure: {code: <code>, message: <message>}
+type JobManifestHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobManifestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobManifest request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = manifestFormatJSON
+	}
+	var write manifestWriterFn
+	var ext, contentType string
+	if format != manifestFormatJSON {
+		if write, ext, contentType = manifestWriter(format); write == nil {
+			log.Println("routeJobManifest invalid format.", format)
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid format: %s", format), http.StatusBadRequest)
+			return
+		}
+	}
+
+	downloads, jobErr := h.jobDownloads(id)
+	if jobErr != nil {
+		log.Println("routeJobManifest request job downloads failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	if write == nil {
+		msg := jobManifestMsg{JobId: id, Downloads: make([]jobManifestEntry, 0, len(downloads))}
+		for _, d := range downloads {
+			msg.Downloads = append(msg.Downloads, jobManifestEntry{JobDownload: d, Status: d.Status()})
+		}
+		h.version.writeData(w, msg, http.StatusOK)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d-manifest.%s"`, id, ext))
+	if err := write(w, downloads); err != nil {
+		log.Println("routeJobManifest failed to write manifest", id, err)
+	}
+}
+
+// Connects to the remote service hosting job information, and gets the
+// downloads of the job's URLs.
+func (h *JobManifestHandler) jobDownloads(id common.JobId) ([]common.JobDownload, *ErroMsg) {
+	downloads, err := h.sc.JobClient().Downloads(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobDownloads",
+			Info:   fmt.Sprintf("Failed to get job %d downloads", id),
+			Err:    err,
+		}
+	}
+	return downloads, nil
+}
+
+// Writes a download manifest in a format.
+type manifestWriterFn func(w io.Writer, downloads []common.JobDownload) error
+
+// Returns the writer of the format, and the file extension and content type
+// of the format. Nil is returned if the format is unknown, or is written as
+// an API response instead.
+func manifestWriter(format string) (manifestWriterFn, string, string) {
+	switch format {
+	case manifestFormatCSV:
+		return writeManifestCSV, "csv", "text/csv; charset=utf-8"
+	case manifestFormatSHA256:
+		return writeManifestSHA256, "sha256", "text/plain; charset=utf-8"
+	}
+	return nil, "", ""
+}
+
+// Writes the manifest as CSV, with a header row of the downloads' fields.
+func writeManifestCSV(w io.Writer, downloads []common.JobDownload) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"url", "file", "bytes", "sha256", "expected_sha256", "mime", "status", "error", "downloaded_on"})
+	for _, d := range downloads {
+		var downloadedOn string
+		if !d.DownloadedOn.IsZero() {
+			downloadedOn = d.DownloadedOn.UTC().Format(time.RFC3339)
+		}
+		c.Write([]string{d.URL, d.File, strconv.FormatInt(d.Bytes, 10), d.SHA256, d.ExpectedSHA256, d.Mime, d.Status(), d.Error, downloadedOn})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// Writes the checksum of each downloaded file, one per line, in the form
+// checked by 'sha256sum -c'. Files which failed, or haven't been downloaded,
+// are not included.
+func writeManifestSHA256(w io.Writer, downloads []common.JobDownload) error {
+	buf := &strings.Builder{}
+	for _, d := range downloads {
+		if d.File == "" || d.SHA256 == "" || d.Status() == common.DownloadFailed {
+			continue
+		}
+		fmt.Fprintf(buf, "%s  %s\n", d.SHA256, d.File)
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testManifest = []common.JobDownload{
+	{URL: "http://example.com/a.csv", File: "1/2-a.csv", Bytes: 10, SHA256: strings.Repeat("ab", 32), ExpectedSHA256: strings.Repeat("ab", 32),
+		Mime: "text/csv", Resumed: true, DownloadedOn: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)},
+	{URL: "http://example.com/b.pdf", SHA256: strings.Repeat("cd", 32), ExpectedSHA256: strings.Repeat("ef", 32),
+		Error: "checksum mismatch", DownloadedOn: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)},
+	{URL: "http://example.com/c.zip"},
+}
+
+func TestManifestWriter(t *testing.T) {
+	for _, format := range []string{manifestFormatCSV, manifestFormatSHA256} {
+		write, _, _ := manifestWriter(format)
+		assert.NotNil(t, write, "Expect %s writer", format)
+	}
+	write, _, _ := manifestWriter("xml")
+	assert.Nil(t, write, "Expect unknown format rejected")
+}
+
+func TestWriteManifestCSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeManifestCSV(buf, testManifest), "Expect CSV written")
+	assert.Equal(t, `url,file,bytes,sha256,expected_sha256,mime,status,error,downloaded_on
+http://example.com/a.csv,1/2-a.csv,10,`+strings.Repeat("ab", 32)+`,`+strings.Repeat("ab", 32)+`,text/csv,verified,,2017-01-02T03:04:05Z
+http://example.com/b.pdf,,0,`+strings.Repeat("cd", 32)+`,`+strings.Repeat("ef", 32)+`,,failed,checksum mismatch,2017-01-02T03:04:05Z
+http://example.com/c.zip,,0,,,,pending,,
+`, buf.String(), "Expect CSV of downloads")
+}
+
+func TestWriteManifestSHA256(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeManifestSHA256(buf, testManifest), "Expect checksums written")
+	assert.Equal(t, strings.Repeat("ab", 32)+"  1/2-a.csv\n", buf.String(), "Expect only downloaded files")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the content type mismatch report of a previously
+// scheduled job. The report lists the job's crawled URLs whose Content-Type
+// header declared a different kind of content than the workers sniffed from
+// the start of the response, e.g: an image served as text/html, with both
+// content types. Mismatched responses are scraped as their sniffed content
+// type. If the job does not exists a 404 status code and message will be
+// returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/mime/1234"
+//
+// Response:
+//	- Success: {urls: [{url: <url>, declared: "text/html", sniffed: "image/png", detectedOn: <time>}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobMimeMismatchHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobMimeMismatchHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobMimeMismatch request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, jobErr := h.jobMimeMismatches(id)
+	if jobErr != nil {
+		log.Println("routeJobMimeMismatch request job mime mismatches failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	h.version.writeData(w, report, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and generates the
+// job's content type mismatch report.
+func (h *JobMimeMismatchHandler) jobMimeMismatches(id common.JobId) (*common.MimeMismatchReport, *ErroMsg) {
+	if jobErr := jobMustExist(h.sc, id, "jobMimeMismatches"); jobErr != nil {
+		return nil, jobErr
+	}
+
+	report, err := h.sc.JobClient().MimeMismatches(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobMimeMismatches",
+			Info:   fmt.Sprintf("Failed to get job %d content type mismatch report", id),
+			Err:    err,
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/sitemap"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// Timeout for requesting a sitemap when generating an orphan report.
+const sitemapRequestTimeout = 30 * time.Second
+
+// Handles the request for the orphan page report of a previously scheduled job.
+// The report compares the URLs listed in a sitemap with the URLs reachable by
+// crawling the job. URLs in the sitemap which were not linked to are reported as
+// orphaned, and HTML pages linked to which are not in the sitemap are reported as
+// uncharted. One or more sitemaps can be provided with the 'sitemap' query
+// parameter. If none are provided, the /sitemap.xml of each Job URL's host will
+// be used if it exists. Sitemaps are only requested from the hosts of the Job
+// URLs, including the sitemaps of sitemap indexes, and redirects. Provided
+// sitemaps of other hosts are refused with a 400 status code. If the job does
+// not exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/orphans/1234?sitemap=http://www.example.com/sitemap.xml"
+//
+// Response:
+//	- Success: {sitemaps: [<url>, ...], orphaned: [<url>, ...], uncharted: [<url>, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobOrphansHandler struct {
+	sc      *storage.Client
+	client  *http.Client
+	version apiVersion
+}
+
+func (h *JobOrphansHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobOrphans request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	linked, jobErr := h.jobLinkedURLs(id)
+	if jobErr != nil {
+		log.Println("routeJobOrphans request job linked URLs failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	job, err := h.sc.JobClient().GetJob(id)
+	if err != nil || job == nil {
+		log.Println("routeJobOrphans request get job failed.", id, err)
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Failed to get job %d", id), http.StatusNotFound)
+		return
+	}
+
+	provided := r.URL.Query()["sitemap"]
+	hosts := jobHosts(job.URLs)
+	for _, s := range provided {
+		if !sitemapOfHosts(s, hosts) {
+			log.Println("routeJobOrphans request sitemap not of the job's hosts", id, s)
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Sitemap %s must be an http, or https URL of one of the job's hosts", s), http.StatusBadRequest)
+			return
+		}
+	}
+
+	sitemaps, sitemapURLs, jobErr := h.fetchSitemaps(job, provided, hosts)
+	if jobErr != nil {
+		log.Println("routeJobOrphans request sitemaps failed.", jobErr)
+		h.version.writeError(w, "DependancyFailure", jobErr.Short(), http.StatusBadGateway)
+		return
+	}
+	if len(sitemaps) == 0 {
+		log.Println("routeJobOrphans request has no sitemaps", id)
+		h.version.writeError(w, "NotFound", "No sitemap provided or discovered", http.StatusNotFound)
+		return
+	}
+
+	// Write job orphan report out
+	h.version.writeData(w, common.NewOrphanReport(sitemaps, sitemapURLs, linked), http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and the job's
+// linked URLs.
+func (h *JobOrphansHandler) jobLinkedURLs(id common.JobId) (map[string]string, *ErroMsg) {
+	linked, err := h.sc.JobClient().LinkedURLs(id)
+	if err != nil || linked == nil {
+		return nil, &ErroMsg{
+			Source: "jobLinkedURLs",
+			Info:   fmt.Sprintf("Failed to get job %d linked URLs", id),
+			Err:    err,
+		}
+	}
+
+	return linked, nil
+}
+
+// Requests the sitemaps returning the sitemaps successfully fetched, and the URLs
+// listed in them. If no sitemaps are provided the /sitemap.xml of each Job URL's
+// host will be requested. Discovered sitemaps which fail to be requested are
+// ignored, but provided sitemaps failing is an error. Requests to hosts other
+// than the job's fail.
+func (h *JobOrphansHandler) fetchSitemaps(job *storage.Job, provided []string, hosts map[string]struct{}) ([]string, []string, *ErroMsg) {
+	candidates := provided
+	if len(candidates) == 0 {
+		candidates = discoverSitemaps(job.URLs)
+	}
+
+	client := *h.client
+	client.Transport = &jobHostsTransport{hosts: hosts, next: h.client.Transport}
+
+	sitemaps := []string{}
+	urls := []string{}
+	for _, s := range candidates {
+		found, err := sitemap.Fetch(&client, s)
+		if err != nil {
+			if len(provided) > 0 {
+				return nil, nil, &ErroMsg{
+					Source: "fetchSitemaps",
+					Info:   fmt.Sprintf("Failed to get sitemap %s", s),
+					Err:    err,
+				}
+			}
+			log.Println("fetchSitemaps: discovered sitemap not available", s, err)
+			continue
+		}
+
+		sitemaps = append(sitemaps, s)
+		for _, u := range found {
+			urls = append(urls, u.Loc)
+		}
+	}
+
+	return sitemaps, urls, nil
+}
+
+// Returns the default sitemap location for each unique host of the Job URLs.
+func discoverSitemaps(jobURLs []storage.JobURL) []string {
+	known := make(map[string]struct{})
+	sitemaps := []string{}
+	for _, ju := range jobURLs {
+		u, err := url.Parse(ju.URL)
+		if err != nil || u.Host == "" {
+			continue
+		}
+
+		s := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/sitemap.xml"}).String()
+		if _, ok := known[s]; ok {
+			continue
+		}
+		known[s] = struct{}{}
+		sitemaps = append(sitemaps, s)
+	}
+	return sitemaps
+}
+
+// Returns the lower cased hosts of the Job URLs.
+func jobHosts(jobURLs []storage.JobURL) map[string]struct{} {
+	hosts := make(map[string]struct{})
+	for _, ju := range jobURLs {
+		if host := common.URLHost(ju.URL); host != "" {
+			hosts[host] = struct{}{}
+		}
+	}
+	return hosts
+}
+
+// Returns true if the sitemap is an http, or https URL of one of the hosts.
+func sitemapOfHosts(s string, hosts map[string]struct{}) bool {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	_, ok := hosts[strings.ToLower(u.Hostname())]
+	return ok
+}
+
+// Round tripper refusing requests to hosts other than a job's, so a job's
+// sitemaps, and the sitemaps they index, or redirect to, can't be used to
+// request other hosts, e.g: services of the web server's network.
+type jobHostsTransport struct {
+	hosts map[string]struct{}
+	next  http.RoundTripper
+}
+
+func (t *jobHostsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !sitemapOfHosts(r.URL.String(), t.hosts) {
+		return nil, fmt.Errorf("Sitemap %s is not of the job's hosts", r.URL)
+	}
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return next.RoundTrip(r)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSitemapOfHosts(t *testing.T) {
+	hosts := jobHosts([]storage.JobURL{{URL: "http://WWW.Example.com/a"}, {URL: "%zz"}})
+	assert.Equal(t, map[string]struct{}{"www.example.com": {}}, hosts)
+
+	assert.True(t, sitemapOfHosts("https://www.example.com:8443/sitemap.xml", hosts))
+	assert.False(t, sitemapOfHosts("http://169.254.169.254/latest/meta-data", hosts), "Expect other hosts refused")
+	assert.False(t, sitemapOfHosts("file://www.example.com/etc/passwd", hosts), "Expect non http schemes refused")
+}
+
+func TestJobHostsTransport(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expect other hosts not requested")
+	}))
+	defer other.Close()
+
+	// Both servers listen on 127.0.0.1, so the other host is addressed as localhost
+	target := "http://localhost" + other.URL[len("http://127.0.0.1"):] + "/sitemap.xml"
+	server := httptest.NewServer(http.RedirectHandler(target, http.StatusFound))
+	defer server.Close()
+
+	client := &http.Client{Transport: &jobHostsTransport{hosts: map[string]struct{}{"127.0.0.1": {}}}}
+
+	_, err := client.Get(server.URL)
+	require.Error(t, err, "Expect redirect to other host refused")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the panics the workers recovered from while crawling
+// a previously scheduled job's URLs, most recent first. Each panic includes the
+// crawl stage which panicked, and the stack it panicked at. URLs which panicked
+// the workers repeatedly are poisoned, and no longer crawled by any job. If the
+// job does not exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/panics/1234"
+//
+// Response:
+//	- Success: {urls: [{url: <url>, stage: "parse", panic: <value>, stack: <stack>, panickedOn: <time>, poisoned: true}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobPanicHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobPanicHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobPanics request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if jobErr := jobMustExist(h.sc, id, "routeJobPanics"); jobErr != nil {
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	report, err := h.sc.JobClient().Panics(id)
+	if err != nil {
+		log.Println("routeJobPanics request job panics failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d panics", id), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, report, http.StatusOK)
+}
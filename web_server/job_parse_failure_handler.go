@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// Handles the request for the parse failure report of a previously scheduled
+// job. The report lists the job's crawled URLs whose content failed to be
+// parsed, e.g: malformed XML, invalid JSON, HTML without any elements, or
+// content in an encoding the workers can't decode, with the parse error. The
+// start of each failed URL's raw content is quarantined by the workers, and is
+// returned as an attachment instead of the report if the 'url' query parameter
+// is provided. If the job does not exists a 404 status code and message will
+// be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/parse/1234"
+// curl -G "http://localhost:8080/report/parse/1234" --data-urlencode "url=http://example.com/feed"
+//
+// Response:
+//	- Success: {urls: [{url: <url>, mime: "text/xml", error: <error>, size: 1024, truncated: false, failedOn: <time>}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobParseFailureHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobParseFailureHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobParseFailure request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if jobErr := jobMustExist(h.sc, id, "routeJobParseFailure"); jobErr != nil {
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	if u := r.URL.Query().Get("url"); u != "" {
+		h.serveRaw(w, id, u)
+		return
+	}
+
+	report, err := h.sc.JobClient().ParseFailures(id)
+	if err != nil {
+		log.Println("routeJobParseFailure request job parse failures failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d parse failure report", id), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, report, http.StatusOK)
+}
+
+// Writes the quarantined raw content of the job's URL as an attachment, so it
+// is never rendered.
+func (h *JobParseFailureHandler) serveRaw(w http.ResponseWriter, id common.JobId, u string) {
+	failure, err := h.sc.JobClient().ParseFailure(id, u)
+	if err != nil {
+		log.Println("routeJobParseFailure request job parse failure failed.", id, u, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d parse failure of %s", id, u), http.StatusInternalServerError)
+		return
+	}
+	if failure == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("%s did not fail to be parsed by job %d", u, id), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d-quarantined.bin"`, id))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Parse-Error", failure.Error)
+	w.Header().Set("X-Content-Truncated", strconv.FormatBool(failure.Truncated))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(failure.Raw); err != nil {
+		log.Println("routeJobParseFailure failed to write raw content", id, u, err)
+	}
+}
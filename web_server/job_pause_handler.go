@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+)
+
+// Response to a successful job pause request
+type jobPauseMsg struct {
+	// Job which was requested to be paused
+	JobId common.JobId `json:"jobId"`
+
+	// True if the job was paused, false if it was already paused.
+	Paused bool `json:"paused"`
+}
+
+// Handles the request to pause a previously scheduled job. URLs of a paused
+// job which are queued are not crawled, and are kept in the job's frontier of
+// pending URLs until the job is resumed. URLs already being crawled when the job
+// is paused will finish. Pausing a paused job has no effect. The job can be
+// paused at either job/<jobId>/pause, or pause/<jobId>. If the job does not
+// exist a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X POST "http://localhost:8080/job/1234/pause"
+//
+// Response:
+//	- Success: {jobId: 1234, paused: true}
+//	- Failure: {code: <code>, message: <message>}
+type JobPauseHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobPauseHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	id, err := jobIdFromActionPath(r.URL.Path, "pause")
+	if err != nil {
+		log.Println("routeJobPause request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	paused, jobErr := h.pauseJob(id)
+	if jobErr != nil {
+		log.Println("routeJobPause request job pause failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+	if paused {
+		log.Println("routeJobPause paused job", id)
+	}
+
+	h.version.writeData(w, jobPauseMsg{JobId: id, Paused: paused}, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and pauses the job.
+func (h *JobPauseHandler) pauseJob(id common.JobId) (bool, *ErroMsg) {
+	if jobErr := jobMustExist(h.sc, id, "pauseJob"); jobErr != nil {
+		return false, jobErr
+	}
+
+	paused, err := h.sc.JobClient().Pause(id)
+	if err != nil {
+		return false, &ErroMsg{
+			Source: "pauseJob",
+			Info:   fmt.Sprintf("Failed to pause job %d", id),
+			Err:    err,
+		}
+	}
+
+	return paused, nil
+}
+
+// Response to a successful job resume request
+type jobResumeMsg struct {
+	// Job which was requested to be resumed
+	JobId common.JobId `json:"jobId"`
+
+	// True if the job was resumed, false if it was not paused.
+	Resumed bool `json:"resumed"`
+
+	// Number of pending URLs re-queued from the job's frontier
+	Queued int `json:"queued"`
+}
+
+// Handles the request to resume a paused job. The job's frontier of pending URLs
+// is re-queued, so crawling continues where it left off, instead of starting
+// over from the job's URLs. Resuming a job which isn't paused has no effect. The
+// job can be resumed at either job/<jobId>/resume, or resume/<jobId>. If the
+// job does not exist a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X POST "http://localhost:8080/job/1234/resume"
+//
+// Response:
+//	- Success: {jobId: 1234, resumed: true, queued: 42}
+//	- Failure: {code: <code>, message: <message>}
+type JobResumeHandler struct {
+	urlQueuePub queue.Publisher
+	sc          *storage.Client
+	version     apiVersion
+}
+
+func (h *JobResumeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	id, err := jobIdFromActionPath(r.URL.Path, "resume")
+	if err != nil {
+		log.Println("routeJobResume request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	items, jobErr := h.resumeJob(id)
+	if jobErr != nil {
+		log.Println("routeJobResume request job resume failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	for _, item := range items {
+		h.urlQueuePub.Send(item)
+	}
+	if items != nil {
+		log.Println("routeJobResume resumed job", id, "queued", len(items))
+	}
+
+	h.version.writeData(w, jobResumeMsg{JobId: id, Resumed: items != nil, Queued: len(items)}, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and resumes the
+// job, returning the job's frontier to be queued. Nil is returned if the job
+// was not paused.
+func (h *JobResumeHandler) resumeJob(id common.JobId) ([]*common.URLQueueItem, *ErroMsg) {
+	if jobErr := jobMustExist(h.sc, id, "resumeJob"); jobErr != nil {
+		return nil, jobErr
+	}
+
+	resumed, items, err := h.sc.JobClient().Resume(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "resumeJob",
+			Info:   fmt.Sprintf("Failed to resume job %d", id),
+			Err:    err,
+		}
+	}
+	if !resumed {
+		return nil, nil
+	}
+
+	return items, nil
+}
+
+// Returns an error message if the job does not exist.
+func jobMustExist(sc *storage.Client, id common.JobId, source string) *ErroMsg {
+	exists, err := sc.JobClient().JobExists(id)
+	if err != nil || !exists {
+		return &ErroMsg{
+			Source: source,
+			Info:   fmt.Sprintf("Job %d does not exist", id),
+			Err:    err,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// Default and max number of URLs returned by a query request
+const (
+	defaultQueryLimit = 1000
+	maxQueryLimit     = 10000
+)
+
+// Handles requests querying a previously scheduled job's URLs with a filter
+// expression. The expression is provided by the 'q' query parameter, and is
+// made up of field predicates combined with 'and', 'or', 'not', and parentheses.
+// The fields status, depth, words, mime, host, url, title, description, h1,
+// tag, crawled, published, and modified can be compared. The number of URLs returned
+// can be set with the 'limit' query parameter. If the job does not exist a 404
+// status code and message will be returned.
+//
+// e.g:
+// curl -G "http://localhost:8080/query/1234" --data-urlencode 'q=status >= 400 and depth <= 2'
+//
+// Response:
+//	- Success: {query: <q>, urls: [{url: <url>, mime: <mime>, status: 404, depth: 1, words: 0, title: "", tags: ["error"]}, ...], truncated: false}
+//	- Failure: {code: <code>, message: <message>}
+type JobQueryHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobQueryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobQuery request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query().Get("q")
+	expr, err := common.ParseURLQuery(q)
+	if err != nil {
+		log.Println("routeJobQuery invalid query.", q, err)
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid query: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultQueryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxQueryLimit {
+			log.Println("routeJobQuery invalid limit.", v)
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid limit: %s, must be 1 to %d", v, maxQueryLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, jobErr := h.jobQuery(id, expr, limit)
+	if jobErr != nil {
+		log.Println("routeJobQuery request job query failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+	result.Query = q
+
+	// Write job query result out
+	h.version.writeData(w, result, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and queries
+// the job's URLs matching the expression.
+func (h *JobQueryHandler) jobQuery(id common.JobId, expr common.URLQueryExpr, limit int) (*common.URLQueryResult, *ErroMsg) {
+	result, err := h.sc.JobClient().Query(id, expr, limit)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobQuery",
+			Info:   fmt.Sprintf("Failed to query job %d URLs", id),
+			Err:    err,
+		}
+	}
+
+	return result, nil
+}
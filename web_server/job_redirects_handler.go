@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Formats the redirect map of a job can be exported in.
+const (
+	redirectFormatCSV    = "csv"
+	redirectFormatNginx  = "nginx"
+	redirectFormatApache = "apache"
+)
+
+// Handles the request to export the redirect map of a previously scheduled job,
+// mapping each of the job's URLs which redirect to the final URL its chain of
+// redirects ends at, e.g: for a site migration. The map is built from the
+// redirects recorded from the content of the job's crawled pages. The 'format'
+// query parameter selects the format of the map, either "csv" (the default),
+// "nginx", or "apache". The nginx format is a map block of the redirecting URLs
+// to include in the http context, and the apache format is mod_rewrite rules to
+// include in the server context. If the job does not exists a 404 status code
+// and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/redirects?format=nginx"
+//
+// Response:
+//	- Success: redirect map in the requested format
+//	- Failure: {code: <code>, message: <message>}
+type JobRedirectsHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobRedirectsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobRedirects request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = redirectFormatCSV
+	}
+	write, ext, contentType := redirectMapWriter(format)
+	if write == nil {
+		log.Println("routeJobRedirects invalid format.", format)
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	mappings, jobErr := h.jobRedirectMap(id)
+	if jobErr != nil {
+		log.Println("routeJobRedirects request job redirects failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d-redirects.%s"`, id, ext))
+	if err := write(w, mappings); err != nil {
+		log.Println("routeJobRedirects failed to write redirect map", id, err)
+	}
+}
+
+// Connects to the remote service hosting job information, and resolves the
+// job's recorded redirects into its redirect map.
+func (h *JobRedirectsHandler) jobRedirectMap(id common.JobId) ([]common.RedirectMapping, *ErroMsg) {
+	edges, err := h.sc.JobClient().Redirects(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobRedirectMap",
+			Info:   fmt.Sprintf("Failed to get job %d redirects", id),
+			Err:    err,
+		}
+	}
+
+	return common.NewRedirectMap(edges), nil
+}
+
+// Writes a redirect map in a format.
+type redirectMapWriterFn func(w io.Writer, mappings []common.RedirectMapping) error
+
+// Returns the writer of the format, and the file extension and content type
+// of the format. Nil is returned if the format is unknown.
+func redirectMapWriter(format string) (redirectMapWriterFn, string, string) {
+	switch format {
+	case redirectFormatCSV:
+		return writeRedirectCSV, "csv", "text/csv; charset=utf-8"
+	case redirectFormatNginx:
+		return writeRedirectNginx, "conf", "text/plain; charset=utf-8"
+	case redirectFormatApache:
+		return writeRedirectApache, "conf", "text/plain; charset=utf-8"
+	}
+	return nil, "", ""
+}
+
+// Writes the redirect map as CSV, with a header row of from, to, and hops.
+func writeRedirectCSV(w io.Writer, mappings []common.RedirectMapping) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"from", "to", "hops"})
+	for _, m := range mappings {
+		c.Write([]string{m.From, m.To, strconv.Itoa(m.Hops)})
+	}
+	c.Flush()
+	return c.Error()
+}
+
+// Writes the redirect map as an nginx map block, keyed by the full requested
+// URL, so it can be shared by the server blocks of all the redirecting hosts.
+// The server blocks are expected to return the redirect if the map matches.
+func writeRedirectNginx(w io.Writer, mappings []common.RedirectMapping) error {
+	buf := &strings.Builder{}
+	fmt.Fprintln(buf, "# Include in the http context, and in each server block:")
+	fmt.Fprintln(buf, "#     if ($harvester_redirect) { return 301 $harvester_redirect; }")
+	fmt.Fprintln(buf, "map $scheme://$host$request_uri $harvester_redirect {")
+	for _, m := range mappings {
+		fmt.Fprintf(buf, "    %s %s;\n", nginxQuote(m.From), nginxQuote(m.To))
+	}
+	fmt.Fprintln(buf, "}")
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// Writes the redirect map as mod_rewrite rules, matching the host, path, and
+// query of each redirecting URL.
+func writeRedirectApache(w io.Writer, mappings []common.RedirectMapping) error {
+	buf := &strings.Builder{}
+	fmt.Fprintln(buf, "# Include in the server, or virtual host, context.")
+	fmt.Fprintln(buf, "RewriteEngine On")
+	for _, m := range mappings {
+		from, err := url.Parse(m.From)
+		if err != nil {
+			continue
+		}
+		// mod_rewrite matches the decoded path, and the raw query.
+		p := from.Path
+		if p == "" {
+			p = "/"
+		}
+
+		fmt.Fprintf(buf, "\n# %s\n", m.From)
+		fmt.Fprintf(buf, "RewriteCond %%{HTTP_HOST} ^%s$ [NC]\n", regexp.QuoteMeta(from.Host))
+		fmt.Fprintf(buf, "RewriteCond %%{QUERY_STRING} ^%s$\n", regexp.QuoteMeta(from.RawQuery))
+		fmt.Fprintf(buf, "RewriteRule ^%s$ %s [R=301,L,NE,QSD]\n", regexp.QuoteMeta(p), apacheEscape(m.To))
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// Quotes the value as an nginx string.
+func nginxQuote(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// Escapes the characters of the URL mod_rewrite would otherwise interpret
+// in a RewriteRule substitution.
+func apacheEscape(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `$`, `\$`, `%`, `\%`, ` `, `\%20`).Replace(v)
+}
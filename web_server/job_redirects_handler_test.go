@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+var testRedirectMap = []common.RedirectMapping{
+	{From: "http://www.example.com/old?id=1", To: "https://www.example.com/new$page", Hops: 2},
+	{From: "http://www.example.com/a b", To: `https://www.example.com/"quoted"`, Hops: 1},
+}
+
+func TestRedirectMapWriter(t *testing.T) {
+	for _, format := range []string{redirectFormatCSV, redirectFormatNginx, redirectFormatApache} {
+		write, _, _ := redirectMapWriter(format)
+		assert.NotNil(t, write, "Expect %s writer", format)
+	}
+	write, _, _ := redirectMapWriter("yaml")
+	assert.Nil(t, write, "Expect unknown format rejected")
+}
+
+func TestWriteRedirectCSV(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeRedirectCSV(buf, testRedirectMap), "Expect CSV written")
+	assert.Equal(t, `from,to,hops
+http://www.example.com/old?id=1,https://www.example.com/new$page,2
+http://www.example.com/a b,"https://www.example.com/""quoted""",1
+`, buf.String(), "Expect CSV of mappings")
+}
+
+func TestWriteRedirectNginx(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeRedirectNginx(buf, testRedirectMap), "Expect nginx map written")
+	assert.Contains(t, buf.String(), "map $scheme://$host$request_uri $harvester_redirect {\n", "Expect map block")
+	assert.Contains(t, buf.String(), `    "http://www.example.com/old?id=1" "https://www.example.com/new$page";`, "Expect mapping")
+	assert.Contains(t, buf.String(), `    "http://www.example.com/a b" "https://www.example.com/\"quoted\"";`, "Expect quotes escaped")
+}
+
+func TestWriteRedirectApache(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, writeRedirectApache(buf, testRedirectMap[:1]), "Expect apache rules written")
+	assert.Equal(t, `# Include in the server, or virtual host, context.
+RewriteEngine On
+
+# http://www.example.com/old?id=1
+RewriteCond %{HTTP_HOST} ^www\.example\.com$ [NC]
+RewriteCond %{QUERY_STRING} ^id=1$
+RewriteRule ^/old$ https://www.example.com/new\$page [R=301,L,NE,QSD]
+`, buf.String(), "Expect rewrite rules of mapping")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Response to a successful job restore request
+type jobRestoreMsg struct {
+	// Job whose bodies were requested to be restored
+	JobId common.JobId `json:"jobId"`
+
+	// True if the bodies were restored from the cold store, false if
+	// the job was not archived.
+	Restored bool `json:"restored"`
+}
+
+// Handles the request to restore the stored HTML, and cached fetch bodies of an
+// archived job from the cold store into the database, e.g: before the job's
+// pages are requested many times. Archived bodies can be requested without
+// restoring them. Restoring a job which is not archived has no effect. If the
+// job does not exist a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X POST "http://localhost:8080/restore/1234"
+//
+// Response:
+//	- Success: {jobId: 1234, restored: true}
+//	- Failure: {code: <code>, message: <message>}
+type JobRestoreHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobRestoreHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobRestore request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	restored, jobErr := h.restoreJob(id)
+	if jobErr != nil {
+		log.Println("routeJobRestore request job restore failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+	if restored {
+		log.Println("routeJobRestore restored job bodies", id)
+	}
+
+	h.version.writeData(w, jobRestoreMsg{JobId: id, Restored: restored}, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and moves the
+// job's bodies out of the cold store.
+func (h *JobRestoreHandler) restoreJob(id common.JobId) (bool, *ErroMsg) {
+	restored, err := h.sc.JobClient().RestoreResults(id)
+	if err != nil {
+		return false, &ErroMsg{
+			Source: "restoreJob",
+			Info:   fmt.Sprintf("Failed to restore job %d bodies", id),
+			Err:    err,
+		}
+	}
+
+	return restored, nil
+}
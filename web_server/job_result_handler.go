@@ -1,66 +1,251 @@
 package main
 
 import (
+	"encoding/csv"
 	"fmt"
 	"github.com/jasdel/harvester/internal/common"
 	"github.com/jasdel/harvester/internal/storage"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Default and max number of results returned by a page of a job's results
+const (
+	defaultResultPageLimit = 1000
+	maxResultPageLimit     = 10000
+)
+
+// Formats the results of a job can be returned in.
+const (
+	resultFormatJSON = "json"
+	resultFormatCSV  = "csv"
+)
+
+// Header row of results returned as CSV.
+var resultCSVHeader = []string{"url", "status", "mime", "refer", "crawled_at"}
+
+// Response to a job result request for a page of its results
+type jobResultPageMsg struct {
+	// Results of the page, in the same form as unpaged results
+	Results interface{} `json:"results"`
+
+	// Cursor of the next page. Omitted if this is the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
 // Handles the request checking on the status of a previously scheduled job.
 // Returns an error if the job isn't found, or invalid input. If the job
 // exists its status will be returned. A result mime content type filter can
 // also be provided as the 'mime' query parameter. The parameter acts as a prefix
-// filter when returning results of a job. If the job does not exists a 404 status
-// code and message will be returned.
+// filter when returning results of a job. The 'status' query parameter filters
+// the results to those crawled with the HTTP status code, e.g: 404. The
+// 'domain' query parameter filters the results to the URLs of the host, and
+// its sub domains. The 'tag' query parameter filters the results to those
+// classified with the tag, e.g: product. The 'flag' query parameter filters
+// the results to those whose content matched the job's flag of that name. An
+// invalid status is rejected with a 400. If the job does not exists a 404
+// status code and message will be returned.
+//
+// An optional 'scores' query parameter can be provided to include the internal
+// link authority score of each result URL. Scores are computed once the job is
+// completed, and will be null until then. The parameter doesn't take a value.
+//
+// Results are returned as CSV, one row per result URL, if the 'format' query
+// parameter is "csv", or the request accepts text/csv. Each row is the result
+// URL, the status and mime it was crawled with, the refer URL it was found on,
+// and when it was crawled. Rows are streamed as they are read, so the results
+// of large jobs can be exported. CSV results are filtered the same, but can not
+// be paged, or scored.
+//
+// Optional 'limit' and 'cursor' query parameters can be provided to page
+// through the results of large jobs. If either is set up to 'limit' results
+// are returned, 1000 by default, along with the cursor of the next page,
+// omitted once the last page is returned. The cursor is an opaque token,
+// returned as the 'cursor' parameter to request the next page. Invalid
+// limits and cursors are rejected with a 400.
 //
 // e.g:
 // curl -X GET "http://localhost:8080/results/1234?mime=image"
+// curl -X GET "http://localhost:8080/results/1234?status=404&domain=example.com"
+// curl -X GET "http://localhost:8080/results/1234?limit=500&cursor=MTIzNDo1Njo3OA"
+// curl -X GET -H "Accept: text/csv" "http://localhost:8080/results/1234?status=404"
 //
 // Response:
 //	- Success: {<domain>: [ <url>, ... ], ...}
+//	- Success (scores): {<domain>: [ {url: <url>, score: <score>}, ... ], ...}
+//	- Success (paged): {results: {<domain>: [ <url>, ... ], ...}, nextCursor: <cursor>}
+//	- Success (csv): url,status,mime,refer,crawled_at rows
 //	- Failure: {code: <code>, message: <message>}
 type JobResultHandler struct {
-	sc *storage.Client
+	sc      *storage.Client
+	version apiVersion
 }
 
 func (h *JobResultHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		h.version.methodNotAllowed(w, "GET")
 		return
 	}
 
 	id, err := jobIdFromString(path.Base(r.URL.Path))
 	if err != nil {
 		log.Println("routeJobStatus status request failed.", err)
-		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	mimeFilter := r.URL.Query().Get("mime")
+	filter, err := getResultFilter(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobResult invalid filter.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	paged, after, limit, err := getResultPage(id, r)
+	if err != nil {
+		log.Println("routeJobResult invalid page.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	result, jobErr := h.jobResult(id, mimeFilter)
+	format, err := getResultFormat(r)
+	if err != nil {
+		log.Println("routeJobResult invalid format.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == resultFormatCSV {
+		if paged {
+			log.Println("routeJobResult CSV results paged.", id)
+			h.version.writeError(w, "BadRequest", "CSV results can not be paged", http.StatusBadRequest)
+			return
+		}
+		h.writeResultCSV(w, id, filter)
+		return
+	}
+
+	var result common.JobResults
+	var next *common.ResultCursor
+	var jobErr *ErroMsg
+	if paged {
+		result, next, jobErr = h.jobResultPage(id, filter, after, limit)
+	} else {
+		result, jobErr = h.jobResult(id, filter)
+	}
 	if jobErr != nil {
 		log.Println("routeJobResult request job result failed.", jobErr)
-		writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
 		return
 	}
 
+	var data interface{} = result
+	if _, ok := r.URL.Query()["scores"]; ok {
+		scores, err := h.sc.JobClient().LinkScores(id)
+		if err != nil {
+			log.Println("routeJobResult request job link scores failed.", err)
+			h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d link scores", id), http.StatusInternalServerError)
+			return
+		}
+		data = result.WithScores(scores)
+	}
+
+	if paged {
+		msg := jobResultPageMsg{Results: data}
+		if next != nil {
+			msg.NextCursor = next.String()
+		}
+		data = msg
+	}
+
 	// Write job status out
-	writeJSON(w, result, http.StatusOK)
+	h.version.writeData(w, data, http.StatusOK)
+}
+
+// Returns the filter of the job's results from the request's 'mime', 'status',
+// 'domain', 'tag', and 'flag' query parameters. An error is returned if the
+// status is not a HTTP status code.
+func getResultFilter(query url.Values) (storage.ResultFilter, error) {
+	filter := storage.ResultFilter{
+		Mime:   query.Get("mime"),
+		Domain: strings.TrimSuffix(strings.TrimSpace(query.Get("domain")), "."),
+		Tag:    query.Get("tag"),
+		Flag:   query.Get("flag"),
+	}
+
+	if v := query.Get("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil || status < 100 || status > 599 {
+			return filter, fmt.Errorf("Invalid status: %s, must be a HTTP status code", v)
+		}
+		filter.Status = status
+	}
+	return filter, nil
+}
+
+// Returns the format the request's results are returned in, from the 'format'
+// query parameter, or CSV if not set, and the request accepts text/csv. An
+// error is returned if the format is unknown.
+func getResultFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("format"); format {
+	case resultFormatJSON, resultFormatCSV:
+		return format, nil
+	case "":
+	default:
+		return "", fmt.Errorf("Invalid format: %s", format)
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if t, _, err := mime.ParseMediaType(accept); err == nil && t == "text/csv" {
+			return resultFormatCSV, nil
+		}
+	}
+	return resultFormatJSON, nil
+}
+
+// Returns if the request is for a page of the job's results, and the cursor,
+// and limit of the page from the request's 'cursor' and 'limit' query
+// parameters. A nil cursor is the first page. An error is returned if the
+// cursor is invalid, or the limit is out of range.
+func getResultPage(id common.JobId, r *http.Request) (bool, *common.ResultCursor, int, error) {
+	query := r.URL.Query()
+	token, v := query.Get("cursor"), query.Get("limit")
+	if token == "" && v == "" {
+		return false, nil, 0, nil
+	}
+
+	limit := defaultResultPageLimit
+	if v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > maxResultPageLimit {
+			return false, nil, 0, fmt.Errorf("Invalid limit: %s, must be 1 to %d", v, maxResultPageLimit)
+		}
+	}
+
+	if token == "" {
+		return true, nil, limit, nil
+	}
+	after, err := common.ParseResultCursor(id, token)
+	if err != nil {
+		return false, nil, 0, err
+	}
+	return true, &after, limit, nil
 }
 
 // Connects to the remote service hosting job information, and
 // the job's current result information. Filter selects specific
-// mime types of job results. A filter of "" will return all results.
-// the filter acts as the prefix to a mime content type patter.
+// results of the job, e.g: by mime type, or status. The zero value filter
+// will return all results. The filter's mime acts as the prefix to a mime
+// content type patter.
 //
-// e.g: mimeFilter := "image" // returns all image URLs
-func (h *JobResultHandler) jobResult(id common.JobId, mimeFilter string) (common.JobResults, *ErroMsg) {
-	result, err := h.sc.JobClient().Result(id, mimeFilter)
+// e.g: storage.ResultFilter{Mime: "image"} // returns all image URLs
+func (h *JobResultHandler) jobResult(id common.JobId, filter storage.ResultFilter) (common.JobResults, *ErroMsg) {
+	result, err := h.sc.JobClient().Result(id, filter)
 	if err != nil {
 		return nil, &ErroMsg{
 			Source: "jobResult",
@@ -71,3 +256,77 @@ func (h *JobResultHandler) jobResult(id common.JobId, mimeFilter string) (common
 
 	return result, nil
 }
+
+// Connects to the remote service hosting job information, and gets the page
+// of the job's results after the cursor, up to the limit. Results are filtered
+// the same as jobResult. The cursor of the next page is returned, nil if this
+// is the last page.
+func (h *JobResultHandler) jobResultPage(id common.JobId, filter storage.ResultFilter, after *common.ResultCursor, limit int) (common.JobResults, *common.ResultCursor, *ErroMsg) {
+	result, next, err := h.sc.JobClient().ResultPage(id, filter, after, limit)
+	if err != nil {
+		return nil, nil, &ErroMsg{
+			Source: "jobResultPage",
+			Info:   fmt.Sprintf("Failed to get job %d result", id),
+			Err:    err,
+		}
+	}
+
+	return result, next, nil
+}
+
+// Streams the job's results matching the filter as CSV rows, with a header
+// row. If the results can't be read before any are written a 404 status code
+// and message are written instead.
+func (h *JobResultHandler) writeResultCSV(w http.ResponseWriter, id common.JobId, filter storage.ResultFilter) {
+	c := csv.NewWriter(w)
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d-results.csv"`, id))
+		return c.Write(resultCSVHeader)
+	}
+
+	err := h.sc.JobClient().ResultRows(id, filter, func(row common.JobResultRow) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return c.Write(resultCSVRecord(row))
+	})
+	if err != nil && !started {
+		jobErr := &ErroMsg{
+			Source: "writeResultCSV",
+			Info:   fmt.Sprintf("Failed to get job %d result", id),
+			Err:    err,
+		}
+		log.Println("routeJobResult request job result failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("routeJobResult failed to write CSV results", id, err)
+		return
+	}
+
+	if !started {
+		start()
+	}
+	c.Flush()
+	if err := c.Error(); err != nil {
+		log.Println("routeJobResult failed to write CSV results", id, err)
+	}
+}
+
+// Returns the CSV row of the result, in the columns of resultCSVHeader. The
+// status and crawl time are empty if the URL has not been crawled.
+func resultCSVRecord(row common.JobResultRow) []string {
+	var status, crawledAt string
+	if row.Status != 0 {
+		status = strconv.Itoa(row.Status)
+	}
+	if !row.CrawledOn.IsZero() {
+		crawledAt = row.CrawledOn.UTC().Format(time.RFC3339)
+	}
+	return []string{row.URL, status, row.Mime, row.Refer, crawledAt}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetResultPage(t *testing.T) {
+	paged, after, _, err := getResultPage(1234, httptest.NewRequest("GET", "/result/1234", nil))
+	require.NoError(t, err, "Expect unpaged request")
+	assert.False(t, paged, "Expect results not paged")
+	assert.Nil(t, after)
+
+	paged, after, limit, err := getResultPage(1234, httptest.NewRequest("GET", "/result/1234?limit=50", nil))
+	require.NoError(t, err, "Expect first page")
+	assert.True(t, paged, "Expect results paged")
+	assert.Nil(t, after, "Expect first page")
+	assert.Equal(t, 50, limit)
+
+	cursor := common.ResultCursor{JobId: 1234, ReferId: 56, URLId: 78}
+	paged, after, limit, err = getResultPage(1234, httptest.NewRequest("GET", "/result/1234?cursor="+cursor.String(), nil))
+	require.NoError(t, err, "Expect next page")
+	assert.True(t, paged, "Expect results paged")
+	assert.Equal(t, &cursor, after, "Expect cursor of page")
+	assert.Equal(t, defaultResultPageLimit, limit, "Expect default limit")
+
+	for _, q := range []string{"limit=0", "limit=10001", "limit=abc", "cursor=abc", "cursor=" + common.ResultCursor{JobId: 1}.String()} {
+		_, _, _, err := getResultPage(1234, httptest.NewRequest("GET", "/result/1234?"+q, nil))
+		assert.Error(t, err, q)
+	}
+}
+
+func TestGetResultFilter(t *testing.T) {
+	filter, err := getResultFilter(url.Values{})
+	require.NoError(t, err, "Expect no filter")
+	assert.Equal(t, storage.ResultFilter{}, filter)
+
+	q, _ := url.ParseQuery("mime=application/pdf&status=404&domain=Example.com.&tag=product&flag=recall")
+	filter, err = getResultFilter(q)
+	require.NoError(t, err, "Expect filter")
+	assert.Equal(t, storage.ResultFilter{Mime: "application/pdf", Status: 404, Domain: "Example.com", Tag: "product", Flag: "recall"}, filter)
+
+	for _, v := range []string{"abc", "99", "600", "4xx"} {
+		_, err := getResultFilter(url.Values{"status": {v}})
+		assert.Error(t, err, v)
+	}
+}
+
+func TestGetResultFormat(t *testing.T) {
+	cases := []struct {
+		query, accept, format string
+	}{
+		{"", "", resultFormatJSON},
+		{"", "application/json", resultFormatJSON},
+		{"", "text/html, text/csv;q=0.9", resultFormatCSV},
+		{"format=csv", "", resultFormatCSV},
+		{"format=json", "text/csv", resultFormatJSON},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/result/1234?"+c.query, nil)
+		r.Header.Set("Accept", c.accept)
+		format, err := getResultFormat(r)
+		require.NoError(t, err, c.query)
+		assert.Equal(t, c.format, format, "%s %s", c.query, c.accept)
+	}
+
+	_, err := getResultFormat(httptest.NewRequest("GET", "/result/1234?format=xml", nil))
+	assert.Error(t, err, "Expect unknown format rejected")
+}
+
+func TestResultCSVRecord(t *testing.T) {
+	assert.Equal(t, []string{"http://example.com/a.pdf", "404", "application/pdf", "http://example.com", "2017-01-02T03:04:05Z"},
+		resultCSVRecord(common.JobResultRow{URL: "http://example.com/a.pdf", Refer: "http://example.com", Status: 404, Mime: "application/pdf",
+			CrawledOn: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)}))
+	assert.Equal(t, []string{"http://example.com/b", "", "", "http://example.com", ""},
+		resultCSVRecord(common.JobResultRow{URL: "http://example.com/b", Refer: "http://example.com"}), "Expect uncrawled columns empty")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Number of lines of a results export written between each flush of the
+// response to the client.
+const resultsExportFlushLines = 1000
+
+// Line of a job's results export
+type jobResultLineMsg struct {
+	URL   string `json:"url"`
+	Refer string `json:"refer"`
+
+	// HTTP status code, and mime type the URL was crawled with. Omitted if
+	// the URL has not been crawled.
+	Status int    `json:"status,omitempty"`
+	Mime   string `json:"mime,omitempty"`
+
+	// Time the URL was last crawled. Omitted if the URL has not been crawled.
+	CrawledOn *time.Time `json:"crawledOn,omitempty"`
+}
+
+// Handles the request to export the results of a previously scheduled job as
+// JSON Lines, one JSON object per result URL. Each line is the result URL, the
+// refer URL it was found on, and the status, mime, and time it was crawled
+// with. Lines are streamed from the database as they are read, with chunked
+// transfer encoding, so the results of jobs with millions of URLs can be
+// exported without being held in memory. Results are filtered by the same
+// 'mime', 'status', 'domain', 'tag', and 'flag' query parameters as the job's
+// results. An invalid status is rejected with a 400. If the job does not
+// exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/results/export?mime=text/html" > results.jsonl
+//
+// Response:
+//	- Success: {url: <url>, refer: <refer>, status: 200, mime: <mime>, crawledOn: <time>} lines
+//	- Failure: {code: <code>, message: <message>}
+type JobResultsExportHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobResultsExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(path.Dir(r.URL.Path))))
+	if err != nil {
+		log.Println("routeJobResultsExport request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filter, err := getResultFilter(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobResultsExport invalid filter.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeResultLines(w, id, filter)
+}
+
+// Streams the job's results matching the filter as JSON Lines, flushing the
+// response every resultsExportFlushLines lines. If the results can't be read
+// before any are written a 404 status code and message are written instead.
+func (h *JobResultsExportHandler) writeResultLines(w http.ResponseWriter, id common.JobId, filter storage.ResultFilter) {
+	flusher, _ := w.(http.Flusher)
+	buf := bufio.NewWriter(w)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+
+	started := false
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d-results.jsonl"`, id))
+		w.WriteHeader(http.StatusOK)
+	}
+	flush := func() error {
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	lines := 0
+	err := h.sc.JobClient().ResultRows(id, filter, func(row common.JobResultRow) error {
+		if !started {
+			start()
+		}
+		if err := enc.Encode(resultLineMsg(row)); err != nil {
+			return err
+		}
+		if lines++; lines%resultsExportFlushLines == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		jobErr := &ErroMsg{
+			Source: "writeResultLines",
+			Info:   fmt.Sprintf("Failed to get job %d result", id),
+			Err:    err,
+		}
+		log.Println("routeJobResultsExport request job result failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("routeJobResultsExport failed to write results", id, err)
+		return
+	}
+
+	if !started {
+		start()
+	}
+	if err := flush(); err != nil {
+		log.Println("routeJobResultsExport failed to write results", id, err)
+	}
+}
+
+// Returns the export line of the result. The status, mime, and crawl time are
+// omitted if the URL has not been crawled.
+func resultLineMsg(row common.JobResultRow) jobResultLineMsg {
+	msg := jobResultLineMsg{URL: row.URL, Refer: row.Refer, Status: row.Status, Mime: row.Mime}
+	if !row.CrawledOn.IsZero() {
+		crawledOn := row.CrawledOn.UTC()
+		msg.CrawledOn = &crawledOn
+	}
+	return msg
+}
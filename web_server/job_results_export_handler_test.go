@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestResultLineMsg(t *testing.T) {
+	crawledOn := time.Date(2015, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	b, err := json.Marshal(resultLineMsg(common.JobResultRow{
+		URL: "http://example.com/a", Refer: "http://example.com", Status: 200, Mime: "text/html", CrawledOn: crawledOn,
+	}))
+	require.NoError(t, err, "Expect line to marshal")
+	assert.JSONEq(t, `{"url": "http://example.com/a", "refer": "http://example.com", "status": 200, "mime": "text/html", "crawledOn": "2015-01-02T02:04:05Z"}`,
+		string(b), "Expect crawled result line in UTC")
+
+	b, err = json.Marshal(resultLineMsg(common.JobResultRow{URL: "http://example.com/b", Refer: "http://example.com"}))
+	require.NoError(t, err, "Expect line to marshal")
+	assert.JSONEq(t, `{"url": "http://example.com/b", "refer": "http://example.com"}`, string(b), "Expect uncrawled result line")
+}
+
+func TestJobResourceHandlerNested(t *testing.T) {
+	var routed string
+	resource := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { routed = name })
+	}
+	h := &JobResourceHandler{
+		resources: map[string]http.Handler{
+			"export":         resource("export"),
+			"results/export": resource("results/export"),
+		},
+	}
+
+	for p, expect := range map[string]string{
+		"/job/1234/export":         "export",
+		"/job/1234/results/export": "results/export",
+		"/v2/job/1234/export":      "export",
+	} {
+		routed = ""
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		assert.Equal(t, expect, routed, "Expect %s routed", p)
+	}
+
+	for _, p := range []string{"/job/results/export", "/job/1234/results/unknown", "/job/export"} {
+		routed = ""
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code, "Expect %s not found", p)
+		assert.Empty(t, routed, "Expect %s not routed", p)
+	}
+}
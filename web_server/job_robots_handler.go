@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the robots.txt suggestion report of a previously
+// scheduled job. The report suggests Disallow rules for each host crawled by
+// the job, for directories whose URLs were mostly errors, and for query
+// parameters which only produced duplicate content. Each host's suggestion
+// includes the rules formatted as a robots.txt. The suggestion is generated
+// from the URLs crawled so far, so is best requested once the job completes.
+// If the job does not exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/robots/1234"
+//
+// Response:
+//	- Success: {hosts: [{host: <host>, rules: [{disallow: "/old/", reason: "errors", urls: 4, matched: 5}, ...], robotsTxt: <robots.txt>}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobRobotsHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobRobotsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobRobots request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	urls, jobErr := h.jobCrawledURLs(id)
+	if jobErr != nil {
+		log.Println("routeJobRobots request job crawled URLs failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Write job robots.txt suggestion report out
+	h.version.writeData(w, common.NewRobotsSuggestion(urls), http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and gets the
+// job's crawled URLs to suggest robots.txt rules from.
+func (h *JobRobotsHandler) jobCrawledURLs(id common.JobId) ([]common.RobotsCrawledURL, *ErroMsg) {
+	urls, err := h.sc.JobClient().URLs(id, storage.URLFilter{})
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobCrawledURLs",
+			Info:   fmt.Sprintf("Failed to get job %d crawled URLs", id),
+			Err:    err,
+		}
+	}
+
+	crawled := make([]common.RobotsCrawledURL, 0, len(urls))
+	for _, u := range urls {
+		if u.Crawled {
+			crawled = append(crawled, common.RobotsCrawledURL{URL: u.URL, Status: u.Status, ContentHash: u.ContentHash})
+		}
+	}
+	return crawled, nil
+}
@@ -2,26 +2,294 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/jsonpath"
 	"github.com/jasdel/harvester/internal/queue"
 	"github.com/jasdel/harvester/internal/storage"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// Response message to a successful job being scheduled
+// Response message to a successful job being scheduled. The message is the
+// created job resource.
 type jobScheduledMsg struct {
 	// Id of the scheduled job
 	JobId common.JobId `json:"jobId"`
+
+	// Normalized URLs the job was scheduled with
+	Seeds []string `json:"seeds"`
+
+	// Options the job was scheduled with
+	Options jobOptionsMsg `json:"options"`
+
+	// Paths of the job's status, and result resources
+	StatusURL string `json:"statusURL"`
+	ResultURL string `json:"resultURL"`
+
+	// URLs which were not scheduled with the job, when scheduled in
+	// partial mode.
+	Rejected []rejectedJobURL `json:"rejected,omitempty"`
+
+	// URLs which were dropped as duplicates of other URLs of the job
+	Duplicates []duplicateJobURL `json:"duplicates,omitempty"`
+
+	// Active jobs whose seed URLs substantially overlap the job's, which
+	// the job's URLs may be crawled twice with. Omitted if none.
+	Overlaps []common.JobOverlap `json:"overlaps,omitempty"`
+
+	// URLs of the job which were crawled recently enough to be satisfied
+	// by the crawl cache, instead of being crawled again.
+	Cached []string `json:"cached,omitempty"`
+}
+
+// Options a job was scheduled with, as resolved from the request
+type jobOptionsMsg struct {
+	// Crawl flags applied to all of the job's URLs
+	ForceCrawl     bool `json:"forceCrawl"`
+	Delta          bool `json:"delta"`
+	NoFetchCache   bool `json:"noFetchCache"`
+	SkipAlternates bool `json:"skipAlternates"`
+
+	// Hours of the day the job's URLs are allowed to be crawled, and the
+	// window's time zone. Omitted if the job can be crawled at any time.
+	CrawlWindow   string `json:"crawlWindow,omitempty"`
+	CrawlWindowTZ string `json:"crawlWindowTZ,omitempty"`
+
+	// JSONPath expressions applied to the job's JSON responses. Omitted
+	// if the job has none.
+	JSONLinks  []string          `json:"jsonLinks,omitempty"`
+	JSONFields map[string]string `json:"jsonFields,omitempty"`
+
+	// Flags the job's crawled pages are matched against. Omitted if the
+	// job has none.
+	Flags []common.JobFlag `json:"flags,omitempty"`
+
+	// Include, and exclude patterns the links of the job's pages are
+	// matched against. Omitted if the job has none.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+
+	// If the job's URLs are downloaded as files instead of crawled as pages
+	Download bool `json:"download"`
+
+	// If the main text content of the job's crawled pages is extracted.
+	// Omitted if not extracted.
+	ExtractText bool `json:"extractText,omitempty"`
+
+	// Tags the job is listed by. Omitted if the job has none.
+	Tags []string `json:"tags,omitempty"`
+
+	// Rules of how the job handles the responses of status codes, in their
+	// status:action form. Omitted if the job has none.
+	StatusRules []string `json:"onStatus,omitempty"`
+
+	// Priority the job's URLs are dispatched with, low, or high. Omitted if
+	// the job has the normal priority.
+	Priority string `json:"priority,omitempty"`
+
+	// Maximum distance from their origin of the URLs the job crawls.
+	// Omitted if the job has no max depth.
+	MaxDepth *int `json:"maxDepth,omitempty"`
+
+	// Most URLs the job crawls. Omitted if the job is unlimited.
+	MaxURLs int `json:"maxURLs,omitempty"`
+
+	// Time after which the job's URLs are no longer dispatched. Omitted if
+	// the job has no deadline.
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// Scope of the links crawled. Omitted if links to any host are crawled.
+	Scope string `json:"scope,omitempty"`
+
+	// Query parameters stripped from the links of the job's pages, ["none"]
+	// if no parameters are stripped. Omitted if the default tracking
+	// parameters are stripped.
+	StripParams []string `json:"stripParams,omitempty"`
+
+	// If the fragments of the links of the job's pages are kept.
+	KeepFragments bool `json:"keepFragments,omitempty"`
+}
+
+// Returns the message of the job options.
+func newJobOptionsMsg(opts jobOptions) jobOptionsMsg {
+	msg := jobOptionsMsg{
+		ForceCrawl:     opts.forceCrawl,
+		Delta:          opts.delta,
+		NoFetchCache:   opts.noFetchCache,
+		SkipAlternates: opts.skipAlternates,
+	}
+	if opts.window != nil {
+		msg.CrawlWindow = opts.window.String()
+		msg.CrawlWindowTZ = opts.window.Location.String()
+	}
+	if opts.jsonPaths != nil {
+		msg.JSONLinks = opts.jsonPaths.Links
+		msg.JSONFields = opts.jsonPaths.Fields
+	}
+	msg.Flags = opts.flags
+	for _, p := range opts.urlPatterns {
+		if p.Exclude {
+			msg.Exclude = append(msg.Exclude, p.String())
+		} else {
+			msg.Include = append(msg.Include, p.String())
+		}
+	}
+	msg.Download = opts.download
+	msg.ExtractText = opts.extractText
+	msg.Tags = opts.tags
+	for _, rule := range opts.statusRules {
+		msg.StatusRules = append(msg.StatusRules, rule.String())
+	}
+	if opts.priority != common.PriorityNormal {
+		msg.Priority = common.JobPriorityName(opts.priority)
+	}
+	if opts.maxLevel > 0 {
+		depth := opts.maxLevel - 1
+		msg.MaxDepth = &depth
+	}
+	msg.MaxURLs = opts.maxURLs
+	if !opts.deadline.IsZero() {
+		msg.Deadline = &opts.deadline
+	}
+	msg.Scope = opts.scope
+	msg.StripParams = opts.stripParams
+	if opts.stripParams != nil && len(opts.stripParams) == 0 {
+		msg.StripParams = []string{common.StripParamsNone}
+	}
+	msg.KeepFragments = opts.keepFragments
+	return msg
+}
+
+// URL of a job schedule request which was not scheduled with the job
+type rejectedJobURL struct {
+	// URL as it was requested
+	URL string `json:"url"`
+
+	// Reason the URL was rejected
+	Reason string `json:"reason"`
+}
+
+// URL of a job schedule request which was dropped, because once normalized
+// it duplicates another URL of the request.
+type duplicateJobURL struct {
+	// URL as it was requested
+	URL string `json:"url"`
+
+	// Normalized URL of the job it duplicates
+	Of string `json:"of"`
+}
+
+// URLs read from a job schedule request
+type requestedJobURLs struct {
+	// Normalized URLs to schedule, without duplicates
+	urls []string
+
+	// URLs which were rejected, in partial mode
+	rejected []rejectedJobURL
+
+	// URLs dropped as duplicates
+	duplicates []duplicateJobURL
+
+	// Set of the normalized URLs
+	seen map[string]struct{}
+
+	// Checksums the files of a download job are verified against, keyed by
+	// normalized URL. Nil if none were requested.
+	checksums map[string]string
+}
+
+// Returns an empty set of requested URLs.
+func newRequestedJobURLs() *requestedJobURLs {
+	return &requestedJobURLs{urls: []string{}, seen: map[string]struct{}{}}
+}
+
+// Validates, and adds the requested URL, unless it duplicates a URL already
+// added. An invalid URL is an error, unless partial is set, then it is
+// rejected instead.
+func (r *requestedJobURLs) add(rawURL string, partial bool) *ErroMsg {
+	_, err := r.addURL(rawURL, partial)
+	return err
+}
+
+// Validates, and adds the download job's URL line, in the form
+// '<url> [sha256]'. The optional checksum is the file's the URL is verified
+// against once downloaded. An invalid checksum is an error, unless partial
+// is set, then the URL is rejected instead.
+func (r *requestedJobURLs) addDownload(line string, partial bool) *ErroMsg {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	var sum string
+	if len(fields) > 1 {
+		var err error
+		if len(fields) > 2 {
+			err = fmt.Errorf("Invalid download, expected URL and optional checksum")
+		} else {
+			sum, err = common.ParseSHA256(fields[1])
+		}
+		if err != nil && partial {
+			r.rejected = append(r.rejected, rejectedJobURL{URL: fields[0], Reason: err.Error()})
+			return nil
+		} else if err != nil {
+			return &ErroMsg{
+				Source: "requestedJobURLs.addDownload",
+				Info:   fmt.Sprintf("Invalid download: %s", line),
+				Err:    err,
+			}
+		}
+	}
+
+	u, err := r.addURL(fields[0], partial)
+	if err != nil || u == "" || sum == "" {
+		return err
+	}
+	if r.checksums == nil {
+		r.checksums = map[string]string{}
+	}
+	r.checksums[u] = sum
+	return nil
+}
+
+// Validates, and adds the requested URL, returning its normalized form. An
+// empty URL is returned if the URL was rejected, or dropped as a duplicate.
+func (r *requestedJobURLs) addURL(rawURL string, partial bool) (string, *ErroMsg) {
+	u, err := validateJobURL(rawURL)
+	if err != nil && partial {
+		r.rejected = append(r.rejected, rejectedJobURL{URL: rawURL, Reason: err.Error()})
+		return "", nil
+	} else if err != nil {
+		return "", &ErroMsg{
+			Source: "requestedJobURLs.add",
+			Info:   fmt.Sprintf("Invalid URL: %s", rawURL),
+			Err:    err,
+		}
+	}
+	if _, ok := r.seen[u]; ok {
+		r.duplicates = append(r.duplicates, duplicateJobURL{URL: rawURL, Of: u})
+		return "", nil
+	}
+	r.seen[u] = struct{}{}
+
+	r.urls = append(r.urls, u)
+	return u, nil
 }
 
 // Handles the request to schedule a new job. Expects a new line separated
 // list of URLs as input in the request's body. Will respond back with error
-// message, or job id if the schedule was successful.
+// message, or the created job if the schedule was successful. The created
+// job includes its normalized URLs, the options it was scheduled with, and
+// the paths of its status and result. The Location header is set to the
+// job's status path. v2 responds with a 201 status code, and v1 with a 200
+// for existing clients.
 //
 // e.g:
 // curl -X POST --data-binary @- "http://localhost:8080" << EOF
@@ -36,81 +304,546 @@ type jobScheduledMsg struct {
 // If the parameter is present the job's URLs will be crawled,
 // ignoring the cache.
 //
+// An optional 'delta' query parameter can be provided to re-crawl a previously
+// crawled site, only following links from pages whose content changed since
+// they were last crawled. The links of unchanged pages are added to the job's
+// results without being crawled again. Like 'forceCrawl', it takes no value.
+//
+// An optional 'noFetchCache' query parameter can be provided to opt the job out
+// of the workers' shared fetch cache, so every URL crawled by the job is fetched
+// from its host. It takes no value.
+//
+// An optional 'skipAlternates' query parameter can be provided to not crawl the
+// alternate representations of pages, e.g: AMP variants, translations, and
+// feeds. Alternates are still recorded. It takes no value.
+//
+// An optional 'window' query parameter can be provided to restrict the hours of
+// the day the job's URLs are crawled, in the form HH:MM-HH:MM. The optional
+// 'windowTZ' query parameter is the IANA time zone of the crawled site the
+// window is in, e.g: Europe/Berlin, and defaults to UTC. URLs queued outside of
+// the window are parked until it opens. A window whose end is before its start
+// wraps past midnight.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080?window=01:00-05:00&windowTZ=Europe/Berlin" << EOF
+// http://example.com
+// EOF
+//
+// Optional repeatable 'jsonLink' and 'jsonField' query parameters can be provided
+// to crawl JSON APIs. Each 'jsonLink' is a JSONPath expression selecting URLs
+// from the job's application/json responses. If any are provided only the URLs
+// they select are followed from JSON responses, e.g: the next page of a
+// paginated API. Each 'jsonField' is in the form name:expression, and stores
+// the values the JSONPath expression selects from each JSON response under the
+// name. Invalid expressions are rejected with a 400.
+//
+// e.g:
+// curl -g -X POST --data-binary @- "http://localhost:8080?jsonLink=$.links.next&jsonField=ids:$.items[*].id" << EOF
+// http://example.com/api/items
+// EOF
+//
+// Optional repeatable 'keyword' and 'flag' query parameters can be provided to
+// flag the job's crawled pages whose content matches them, e.g: to monitor
+// pages for product recalls. Each 'keyword' matches the word in any case, and
+// flags pages with the lower cased keyword. Each 'flag' is in the form
+// name:pattern, and flags pages matching the RE2 regular expression with the
+// name. The job's results can be filtered by flag. Invalid patterns are
+// rejected with a 400.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080?keyword=recall&flag=price:%5C%24%5Cd%2B" << EOF
+// http://example.com
+// EOF
+//
+// Optional repeatable 'include' and 'exclude' query parameters can be provided
+// to restrict the links of the job's pages which are queued. Each is a glob
+// matched against the URL's path and query, where '*' matches any characters,
+// e.g: /calendar/*, or an RE2 regular expression prefixed with 're:' matched
+// against the whole URL. Links matching any 'exclude' pattern are not queued,
+// and if the job has 'include' patterns links must match one of them. Links
+// which aren't queued are still added to the job's results. Invalid patterns
+// are rejected with a 400.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080?exclude=/calendar/*&exclude=*%3F*&exclude=re:(%3Fi)logout" << EOF
+// http://example.com
+// EOF
+//
+// An optional 'download' query parameter can be provided to download the job's
+// URLs as files, e.g: images, PDFs, and datasets, instead of crawling them as
+// pages. Links are not followed, and files are downloaded even if their URLs
+// were crawled recently. Each line of a download job may include the file's
+// hex SHA-256 checksum after its URL, separated by a space, which the
+// downloaded file is verified against. Interrupted downloads are resumed. The
+// job's downloaded files are listed by its manifest. Like 'forceCrawl', it
+// takes no value.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080?download" << EOF
+// http://example.com/data.csv sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+// http://example.com/report.pdf
+// EOF
+//
+// Optional repeatable 'tag' query parameters can be provided to tag the job, e.g:
+// with the team or client it was scheduled for, so it can be found in the job
+// list. Tags are lower cased, and must be letters, numbers, '-', or '_'.
+//
+// Optional repeatable 'onStatus' query parameters can be provided to change how
+// the job handles the responses of a status code, e.g: 403, or class of status
+// codes, e.g: 4xx, instead of following them like any other response. Each is
+// in the form status:action[:delay[:retries]], where action is one of:
+//   - follow: the response is scraped, and its links followed, the default.
+//   - record: the response is scraped, but its links are not followed.
+//   - fail: the response is not scraped, or added to the job's results.
+//   - retry: the URL is requested again after the delay, or the response's
+//     Retry-After if no delay is given, up to retries times, 3 by default.
+// Rules of a status code take precedence over rules of its class. Invalid
+// rules, and statuses with more than one rule, are rejected with a 400.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080?onStatus=403:fail&onStatus=420:retry:60s" << EOF
+// http://example.com
+// EOF
+//
+// An optional 'priority' query parameter, low, normal, or high, can be provided
+// to dispatch the job's URLs ahead of, or behind, the URLs of other jobs waiting
+// to be crawled. Its descendants are dispatched with the same priority. Jobs
+// have the normal priority by default.
+//
+// An optional 'maxDepth' query parameter can be provided to limit the distance
+// from the job's URLs the job crawls. The links of pages at the max depth are
+// added to the job's results, but not crawled. e.g: 0 only crawls the job's
+// URLs. The foreman and workers' maxLevel still applies if lower.
+//
+// An optional 'maxURLs' query parameter can be provided to limit the number of
+// URLs the job crawls. Once the job has crawled that many URLs the links of its
+// pages are added to its results without being queued, and its remaining
+// pending URLs are dropped, completing the job.
+//
+// An optional 'deadline' query parameter, an RFC 3339 time, or 'timeout' query
+// parameter, a duration after the job is scheduled, e.g: 2h, can be provided
+// to limit how long the job crawls for. Once the deadline passes the foreman
+// stops dispatching the job's URLs, and finalizes the job with its partial
+// results. The URLs which were pending are listed by JobUnattemptedHandler.
+//
+// An optional 'scope' query parameter restricts the links of the job's pages
+// which are crawled to those within the scope of the job URL they descend from.
+// Either 'any', the default, 'same-host', 'subdomains', the host and its
+// subdomains, or 'same-registered-domain', e.g: any host of example.co.uk.
+// Links outside of the scope are added to the job's results, but not crawled.
+//
+// The links of the job's pages are stripped of tracking parameters, e.g: utm_*,
+// gclid, and fbclid, and of their fragment before they are recorded, so links
+// only differing by them are crawled once. Optional 'stripParams' query
+// parameters replace the default tracking parameters stripped. A trailing *
+// strips all parameters with the prefix, 'default' adds the defaults, and
+// 'none' strips no parameters. An optional 'keepFragments' query parameter
+// keeps the links' fragments. See URLStrippingHandler for the effective list.
+//
+// Jobs whose URLs substantially overlap the seed URLs of an active, running or
+// paused, job are scheduled with the overlapped jobs listed in the response's
+// 'overlaps', to warn the URLs may be crawled twice. A job overlaps an active
+// job if at least the web server's 'duplicateJobOverlap' fraction of its URLs
+// are seeds of the active job. An optional 'rejectOverlap' query parameter can
+// be provided to reject overlapping jobs with a 409 instead. Like 'forceCrawl',
+// it takes no value.
+//
+// Jobs with URLs of a host in the opt-out registry are rejected with a 403.
+//
+// URLs which are duplicates of the request's other URLs once normalized are
+// dropped, and reported in the response's 'duplicates' list with the URL they
+// duplicate. URLs which were crawled within the web server's 'cacheMaxAge',
+// and will be satisfied by the crawl cache instead of being crawled again, are
+// reported in the response's 'cached' list. URLs are never reported as cached
+// when the job is scheduled with 'forceCrawl' or 'delta'.
+//
+// An optional 'partial' query parameter can be provided to schedule the valid
+// URLs of the request, instead of rejecting the whole request at the first
+// invalid URL. Invalid URLs, and URLs of opted out hosts, are reported in the
+// response's 'rejected' list with the reason they were rejected. If none of
+// the URLs are valid the request fails with a 400. Like 'forceCrawl', it takes
+// no value, but may be set to true or false, e.g: partial=false.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080?partial" << EOF
+// http://example.com
+// gopher://example.com
+// EOF
+//
 // Response:
-//	- Success: {jobId: 1234}
-//	- Failure: {code: <code>, message: <message>}
+//   - Success: {jobId: 1234, seeds: ["http://example.com"], options: {forceCrawl: false, ...}, statusURL: "/status/1234", resultURL: "/result/1234"}
+//   - Partial: {jobId: 1234, rejected: [{url: "gopher://example.com", reason: <reason>}]}
+//   - Duplicates: {jobId: 1234, duplicates: [{url: "example.com", of: "http://example.com"}], cached: ["http://example.com"]}
+//   - Overlapping: {jobId: 1235, overlaps: [{jobId: 1234, overlapping: 9, seeds: 10}]}
+//   - Failure: {code: <code>, message: <message>}
 type JobScheduleHandler struct {
 	urlQueuePub queue.Publisher
 	sc          *storage.Client
+	cacheMaxAge time.Duration
+
+	// Fraction of a job's URLs which must be seeds of an active job for the
+	// job to overlap it.
+	overlapThreshold float64
+
+	// Limits the rate each client can schedule jobs at, nil if not limited.
+	limiter *scheduleLimiter
+
+	// Maximum URLs a job can be scheduled with, and the maximum size of a
+	// schedule request's body. Not limited if zero.
+	maxURLs     int
+	maxBodySize int64
+
+	// Duration idempotency keys are kept for, after which replaying a key
+	// schedules a new job.
+	idempotencyWindow time.Duration
+
+	// Root path the API's routes are mounted under
+	rootPath string
+
+	version apiVersion
 }
 
 func (h *JobScheduleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		w.Header().Set("Allow", "POST")
-		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	opts, err := getRequestedJobOptions(r.URL.Query())
+	if err != nil {
+		log.Println("routeScheduleJob request invalid options", err)
+		h.version.writeError(w, "BadRequest", err.Short(), http.StatusBadRequest)
 		return
 	}
+	opts.apiKeyId = requestAPIKeyId(r)
 
-	forceCrawl := false
-	if _, ok := r.URL.Query()["forceCrawl"]; ok {
-		forceCrawl = true
+	body := r.Body
+	if h.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
 	}
 
-	urls, err := getRequestedJobURLs(r.Body)
+	partial, partialErr := queryFlag(r.URL.Query(), "partial")
+	if partialErr != nil {
+		log.Println("routeScheduleJob request invalid partial", partialErr)
+		h.version.writeError(w, "BadRequest", partialErr.Error(), http.StatusBadRequest)
+		return
+	}
+	requested, err := getRequestedJobURLs(body, partial, opts.download, h.maxURLs)
 	if err != nil {
 		log.Println("routeScheduleJob request parse failed", err)
-		writeJSONError(w, "BadRequest", err.Short(), http.StatusBadRequest)
+		code, status := requestErrorStatus(err)
+		h.version.writeError(w, code, err.Short(), status)
+		return
+	}
+
+	// Hosts which have opted out of crawling can not be scheduled
+	if optOut, err := h.rejectOptedOut(requested, partial); err != nil {
+		log.Println("routeScheduleJob request opt out check failed.", err)
+		h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+		return
+	} else if optOut != nil {
+		log.Println("routeScheduleJob rejected opted out host", optOut.Host, "reason:", optOut.Reason)
+		h.version.writeError(w, "Forbidden", optedOutReason(optOut), http.StatusForbidden)
 		return
 	}
+	urls, rejected := requested.urls, requested.rejected
 
 	if len(urls) == 0 {
 		// Nothing can be done if there are no URLs to schedule
 		log.Println("routeScheduleJob request has no URLs")
-		writeJSONError(w, "BadRequest", "No URLs provided", http.StatusBadRequest)
+		msg := "No URLs provided"
+		if len(rejected) > 0 {
+			msg = fmt.Sprintf("No valid URLs provided, %d rejected", len(rejected))
+		}
+		h.version.writeError(w, "BadRequest", msg, http.StatusBadRequest)
+		return
+	}
+
+	// Requests replaying the Idempotency-Key of a job already scheduled are
+	// responded to with the job, instead of scheduling a duplicate job. Keys
+	// are reserved before the rate limit, and quota are checked, so replays
+	// aren't limited by them, and are released if the request is limited.
+	var id common.JobId = common.InvalidId
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		token, reserved := h.reserveIdempotencyKey(w, r, key, requested, opts)
+		if !reserved {
+			return
+		}
+		defer func() { h.finishIdempotencyKey(requestPrincipal(r), key, token, id) }()
+	}
+
+	if !h.limiter.check(w, r, h.version, 1) {
+		log.Println("routeScheduleJob request rate limited")
+		return
+	}
+	if !checkQuota(h.sc, w, r, h.version, 1) {
+		return
+	}
+
+	cached, err := h.cachedURLs(urls, opts)
+	if err != nil {
+		log.Println("routeScheduleJob request crawl cache check failed.", err)
+		h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+		return
+	}
+
+	// Jobs overlapping an active job are warned, or rejected if requested,
+	// to prevent accidentally crawling the same URLs twice.
+	overlaps, err := h.overlappingJobs(urls)
+	if err != nil {
+		log.Println("routeScheduleJob request active job overlap check failed.", err)
+		h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+		return
+	}
+	if _, reject := r.URL.Query()["rejectOverlap"]; reject && len(overlaps) > 0 {
+		log.Println("routeScheduleJob rejected job overlapping active job", overlaps[0].JobId)
+		h.version.writeError(w, "Conflict", overlapReason(overlaps[0], len(urls)), http.StatusConflict)
 		return
 	}
 
 	// Create job by sending the URLs to scheduler
-	id, err := h.scheduleJob(urls, forceCrawl)
+	id, err = h.scheduleJob(urls, requested.checksums, opts)
 	if err != nil {
 		log.Println("routeScheduleJob request job schedule failed.", err)
-		writeJSONError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
+		h.version.writeError(w, "DependancyFailure", err.Short(), http.StatusInternalServerError)
 		return
 	}
 
-	// Write job status out
-	writeJSON(w, jobScheduledMsg{JobId: id}, http.StatusOK)
+	if len(rejected) > 0 {
+		log.Println("routeScheduleJob job", id, "scheduled with", len(rejected), "rejected URLs")
+	}
+
+	msg := h.scheduledMsg(id, requested, opts, cached)
+	msg.Overlaps = overlaps
+	if len(overlaps) > 0 {
+		log.Println("routeScheduleJob job", id, "overlaps active job", overlaps[0].JobId)
+	}
+
+	status := http.StatusCreated
+	if h.version == apiV1 {
+		status = http.StatusOK
+	}
+
+	// Write the created job out
+	w.Header().Set("Location", msg.StatusURL)
+	h.version.writeData(w, msg, status)
 }
 
-// Reads the input scanning for URLs. It expects a single URL per
-// line. If there is a failure reading from the input, or a invalid
-// URL is encountered an error will be returned.
-func getRequestedJobURLs(in io.Reader) ([]string, *ErroMsg) {
-	scanner := bufio.NewScanner(in)
+// Returns the message of the scheduled job.
+func (h *JobScheduleHandler) scheduledMsg(id common.JobId, requested *requestedJobURLs, opts jobOptions, cached []string) jobScheduledMsg {
+	return jobScheduledMsg{
+		JobId:      id,
+		Seeds:      requested.urls,
+		Options:    newJobOptionsMsg(opts),
+		StatusURL:  h.version.path(h.rootPath, fmt.Sprintf("status/%d", id)),
+		ResultURL:  h.version.path(h.rootPath, fmt.Sprintf("result/%d", id)),
+		Rejected:   requested.rejected,
+		Duplicates: requested.duplicates,
+		Cached:     cached,
+	}
+}
 
-	urlMap := make(map[string]struct{})
-	urls := []string{}
-	for scanner.Scan() {
-		if scanner.Text() == "" {
-			continue
+// Reads the job's options from the query. An error is returned if an
+// option is invalid.
+func getRequestedJobOptions(query url.Values) (jobOptions, *ErroMsg) {
+	opts := jobOptions{}
+	if _, ok := query["forceCrawl"]; ok {
+		opts.forceCrawl = true
+	}
+	if _, ok := query["delta"]; ok {
+		opts.delta = true
+	}
+	if _, ok := query["noFetchCache"]; ok {
+		opts.noFetchCache = true
+	}
+	if _, ok := query["skipAlternates"]; ok {
+		opts.skipAlternates = true
+	}
+	if _, ok := query["download"]; ok {
+		opts.download = true
+	}
+	if _, ok := query["extractText"]; ok {
+		opts.extractText = true
+	}
+	if _, ok := query["keepFragments"]; ok {
+		opts.keepFragments = true
+	}
+	if window := query.Get("window"); window != "" {
+		crawlWindow, err := common.ParseCrawlWindow(window, query.Get("windowTZ"))
+		if err != nil {
+			return opts, &ErroMsg{
+				Source: "getRequestedJobOptions",
+				Info:   err.Error(),
+				Err:    err,
+			}
+		}
+		opts.window = crawlWindow
+	}
+
+	jsonPaths, err := getRequestedJSONPaths(query)
+	if err != nil {
+		return opts, err
+	}
+	opts.jsonPaths = jsonPaths
+
+	flags, err := getRequestedFlags(query)
+	if err != nil {
+		return opts, err
+	}
+	opts.flags = flags
+
+	urlPatterns, err := getRequestedURLPatterns(query)
+	if err != nil {
+		return opts, err
+	}
+	opts.urlPatterns = urlPatterns
+
+	tags, err := getRequestedJobTags(query)
+	if err != nil {
+		return opts, err
+	}
+	opts.tags = tags
+
+	statusRules, err := getRequestedStatusRules(query)
+	if err != nil {
+		return opts, err
+	}
+	opts.statusRules = statusRules
+
+	priority, perr := common.ParseJobPriority(query.Get("priority"))
+	if perr != nil {
+		return opts, &ErroMsg{
+			Source: "getRequestedJobOptions",
+			Info:   perr.Error(),
+			Err:    perr,
 		}
+	}
+	opts.priority = priority
+
+	if v := query.Get("maxDepth"); v != "" {
+		depth, err := strconv.Atoi(v)
+		if err != nil || depth < 0 {
+			return opts, &ErroMsg{
+				Source: "getRequestedJobOptions",
+				Info:   fmt.Sprintf("Invalid maxDepth %s, must be zero or more", v),
+				Err:    err,
+			}
+		}
+		opts.maxLevel = depth + 1
+	}
+
+	if v := query.Get("maxURLs"); v != "" {
+		max, err := strconv.Atoi(v)
+		if err != nil || max <= 0 {
+			return opts, &ErroMsg{
+				Source: "getRequestedJobOptions",
+				Info:   fmt.Sprintf("Invalid maxURLs %s, must be greater than zero", v),
+				Err:    err,
+			}
+		}
+		opts.maxURLs = max
+	}
+
+	if v, t := query.Get("deadline"), query.Get("timeout"); v != "" || t != "" {
+		deadline, err := common.ParseJobDeadline(v, t, time.Now())
+		if err != nil {
+			return opts, &ErroMsg{
+				Source: "getRequestedJobOptions",
+				Info:   err.Error(),
+				Err:    err,
+			}
+		}
+		opts.deadline = deadline
+	}
+
+	if v := query.Get("scope"); v != "" {
+		scope, err := common.ParseJobScope(v)
+		if err != nil {
+			return opts, &ErroMsg{
+				Source: "getRequestedJobOptions",
+				Info:   err.Error(),
+				Err:    err,
+			}
+		}
+		if scope != common.JobScopeAny {
+			opts.scope = scope
+		}
+	}
+
+	if values := query["stripParams"]; len(values) > 0 {
+		params, err := common.ParseStripParams(values)
+		if err != nil {
+			return opts, &ErroMsg{
+				Source: "getRequestedJobOptions",
+				Info:   err.Error(),
+				Err:    err,
+			}
+		}
+		opts.stripParams = params
+	}
 
-		u, err := validateJobURL(scanner.Text())
+	return opts, nil
+}
+
+// Reads the job's tags from the query's 'tag' parameters, without duplicates.
+// Nil is returned if the query has none. An error is returned if a tag is
+// invalid.
+func getRequestedJobTags(query url.Values) ([]string, *ErroMsg) {
+	var tags []string
+	seen := map[string]struct{}{}
+	for _, v := range query["tag"] {
+		tag, err := common.ParseJobTag(v)
 		if err != nil {
 			return nil, &ErroMsg{
-				Source: "getRequestedJobURLs",
-				Info:   fmt.Sprintf("Invalid URL: %s", scanner.Text()),
+				Source: "getRequestedJobTags",
+				Info:   err.Error(),
 				Err:    err,
 			}
 		}
-		if _, ok := urlMap[u]; ok {
+		if _, ok := seen[tag]; ok {
 			continue
 		}
-		urlMap[u] = struct{}{}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// Reads the input scanning for URLs. It expects a single URL per
+// line. If there is a failure reading from the input an error will be
+// returned. An invalid URL is also an error, unless partial is set, then
+// the invalid URLs are returned as rejected instead. URLs which duplicate
+// an earlier URL once normalized are returned as duplicates. If download
+// is set each URL may be followed by the checksum of its file. If maxURLs is
+// non-zero, more URLs than it, including rejected and duplicate URLs, is an
+// error.
+func getRequestedJobURLs(in io.Reader, partial, download bool, maxURLs int) (*requestedJobURLs, *ErroMsg) {
+	scanner := bufio.NewScanner(in)
 
-		urls = append(urls, u)
+	requested, n := newRequestedJobURLs(), 0
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		if n++; maxURLs > 0 && n > maxURLs {
+			return nil, tooManyURLsErr("getRequestedJobURLs", maxURLs)
+		}
+		add := requested.add
+		if download {
+			add = requested.addDownload
+		}
+		if err := add(scanner.Text(), partial); err != nil {
+			return nil, err
+		}
 	}
 	if err := scanner.Err(); err != nil {
+		if bodyTooLarge(err) {
+			return nil, &ErroMsg{
+				Source: "getRequestedJobURLs",
+				Info:   "Request body too large",
+				Err:    err,
+			}
+		}
 		return nil, &ErroMsg{
 			Source: "getRequestedJobURLs",
 			Info:   "Unexpected error in input",
@@ -118,11 +851,172 @@ func getRequestedJobURLs(in io.Reader) ([]string, *ErroMsg) {
 		}
 	}
 
-	return urls, nil
+	return requested, nil
+}
+
+// Returns the error of a job requested with more than the maximum URLs.
+func tooManyURLsErr(source string, maxURLs int) *ErroMsg {
+	return &ErroMsg{
+		Source: source,
+		Info:   fmt.Sprintf("Too many URLs, a job can have at most %d URLs", maxURLs),
+	}
+}
+
+// Returns true if the error is of a request body read over its size limit.
+func bodyTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// Returns the error code, and status of a request which failed to be read.
+// Requests whose body is over the size limit are 413, others are 400.
+func requestErrorStatus(err *ErroMsg) (string, int) {
+	if err.Err != nil && bodyTooLarge(err.Err) {
+		return "RequestTooLarge", http.StatusRequestEntityTooLarge
+	}
+	return "BadRequest", http.StatusBadRequest
+}
+
+// Reads the job's JSONPath link and field expressions from the query. Nil is
+// returned if the query has none. An error is returned if an expression is
+// invalid, or a field is missing its name.
+func getRequestedJSONPaths(query url.Values) (*common.JobJSONPaths, *ErroMsg) {
+	links, fields := query["jsonLink"], query["jsonField"]
+	if len(links) == 0 && len(fields) == 0 {
+		return nil, nil
+	}
+
+	paths := &common.JobJSONPaths{Links: []string{}, Fields: map[string]string{}}
+	for _, expr := range links {
+		if _, err := jsonpath.Compile(expr); err != nil {
+			return nil, &ErroMsg{
+				Source: "getRequestedJSONPaths",
+				Info:   fmt.Sprintf("Invalid jsonLink: %s", expr),
+				Err:    err,
+			}
+		}
+		paths.Links = append(paths.Links, expr)
+	}
+	for _, field := range fields {
+		i := strings.Index(field, ":")
+		if i <= 0 {
+			return nil, &ErroMsg{
+				Source: "getRequestedJSONPaths",
+				Info:   fmt.Sprintf("Invalid jsonField: %s", field),
+				Err:    fmt.Errorf("jsonField must be in the form name:expression"),
+			}
+		}
+		name, expr := field[:i], field[i+1:]
+		if _, err := jsonpath.Compile(expr); err != nil {
+			return nil, &ErroMsg{
+				Source: "getRequestedJSONPaths",
+				Info:   fmt.Sprintf("Invalid jsonField: %s", field),
+				Err:    err,
+			}
+		}
+		paths.Fields[name] = expr
+	}
+
+	return paths, nil
+}
+
+// Reads the job's flags from the query's 'keyword' and 'flag' parameters. Nil
+// is returned if the query has none. An error is returned if a flag's pattern
+// is invalid, or it is missing its name.
+func getRequestedFlags(query url.Values) ([]common.JobFlag, *ErroMsg) {
+	keywords, patterns := query["keyword"], query["flag"]
+	if len(keywords) == 0 && len(patterns) == 0 {
+		return nil, nil
+	}
+
+	flags := []common.JobFlag{}
+	for _, keyword := range keywords {
+		if strings.TrimSpace(keyword) == "" {
+			return nil, &ErroMsg{
+				Source: "getRequestedFlags",
+				Info:   "Invalid keyword, must not be empty",
+				Err:    fmt.Errorf("empty keyword"),
+			}
+		}
+		flags = append(flags, common.NewKeywordFlag(keyword))
+	}
+	for _, pattern := range patterns {
+		flag, err := common.ParseJobFlag(pattern)
+		if err != nil {
+			return nil, &ErroMsg{
+				Source: "getRequestedFlags",
+				Info:   fmt.Sprintf("Invalid flag: %s", pattern),
+				Err:    err,
+			}
+		}
+		flags = append(flags, flag)
+	}
+
+	return flags, nil
+}
+
+// Reads the job's URL patterns from the query's 'include' and 'exclude'
+// parameters. Nil is returned if the query has none. An error is returned if a
+// pattern is invalid.
+func getRequestedURLPatterns(query url.Values) ([]common.JobURLPattern, *ErroMsg) {
+	includes, excludes := query["include"], query["exclude"]
+	if len(includes) == 0 && len(excludes) == 0 {
+		return nil, nil
+	}
+
+	patterns := []common.JobURLPattern{}
+	for _, params := range []struct {
+		name    string
+		values  []string
+		exclude bool
+	}{{"include", includes, false}, {"exclude", excludes, true}} {
+		for _, v := range params.values {
+			p, err := common.ParseJobURLPattern(v, params.exclude)
+			if err != nil {
+				return nil, &ErroMsg{
+					Source: "getRequestedURLPatterns",
+					Info:   fmt.Sprintf("Invalid %s: %s", params.name, v),
+					Err:    err,
+				}
+			}
+			patterns = append(patterns, p)
+		}
+	}
+
+	return patterns, nil
+}
+
+// Reads the job's status rules from the query's 'onStatus' parameters. Nil is
+// returned if the query has none. An error is returned if a rule is invalid, or
+// more than one rule is for the same status.
+func getRequestedStatusRules(query url.Values) ([]common.JobStatusRule, *ErroMsg) {
+	var rules []common.JobStatusRule
+	seen := map[string]struct{}{}
+	for _, v := range query["onStatus"] {
+		rule, err := common.ParseJobStatusRule(v)
+		if err != nil {
+			return nil, &ErroMsg{
+				Source: "getRequestedStatusRules",
+				Info:   fmt.Sprintf("Invalid onStatus %s, %v", v, err),
+				Err:    err,
+			}
+		}
+		if _, ok := seen[rule.Status]; ok {
+			return nil, &ErroMsg{
+				Source: "getRequestedStatusRules",
+				Info:   fmt.Sprintf("Invalid onStatus %s, status %s already has a rule", v, rule.Status),
+				Err:    fmt.Errorf("duplicate status rule %s", rule.Status),
+			}
+		}
+		seen[rule.Status] = struct{}{}
+		rules = append(rules, rule)
+	}
+	return rules, nil
 }
 
 // Validates the job URL contains at least a host and scheme. The scheme is also validated
-// as being http or https. If no scheme is provided http will be used as the default.
+// as being http, https, or the ftp and sftp schemes of remote file servers. If no scheme
+// is provided http will be used as the default.
 func validateJobURL(jobURL string) (string, error) {
 	if strings.HasPrefix(jobURL, "/") {
 		return "", fmt.Errorf("Invalid URL, does not have host")
@@ -132,7 +1026,9 @@ func validateJobURL(jobURL string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+	switch u.Scheme {
+	case "", "http", "https", "ftp", "sftp":
+	default:
 		return "", fmt.Errorf("Invalid URL scheme")
 	}
 	if u.Scheme == "" {
@@ -142,10 +1038,203 @@ func validateJobURL(jobURL string) (string, error) {
 	return u.String(), nil
 }
 
+// Removes the requested URLs whose hosts have opted out of crawling. If
+// partial is set the URLs are rejected, otherwise the opt out of the first
+// URL's host which has opted out is returned, and the URLs are left as is.
+func (h *JobScheduleHandler) rejectOptedOut(requested *requestedJobURLs, partial bool) (*common.HostOptOut, *ErroMsg) {
+	optOuts, err := h.optedOut(requested.urls)
+	if err != nil {
+		return nil, err
+	}
+	if len(optOuts) == 0 {
+		return nil, nil
+	}
+
+	allowed := make([]string, 0, len(requested.urls))
+	for _, u := range requested.urls {
+		optOut, ok := optOuts[common.URLHost(u)]
+		if !ok {
+			allowed = append(allowed, u)
+			continue
+		}
+		if !partial {
+			return optOut, nil
+		}
+		requested.rejected = append(requested.rejected, rejectedJobURL{URL: u, Reason: optedOutReason(optOut)})
+	}
+	requested.urls = allowed
+	return nil, nil
+}
+
+// Returns the active jobs the URLs overlap, most overlapping first. A job is
+// overlapped if at least the handler's overlap threshold of the URLs are its
+// seeds.
+func (h *JobScheduleHandler) overlappingJobs(urls []string) ([]common.JobOverlap, *ErroMsg) {
+	active, err := h.sc.JobClient().ActiveJobOverlaps(urls)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "JobScheduleHandler.overlappingJobs",
+			Info:   "Failed to check for overlapping active jobs",
+			Err:    err,
+		}
+	}
+
+	var overlaps []common.JobOverlap
+	for _, o := range active {
+		if float64(o.Overlapping) >= h.overlapThreshold*float64(len(urls)) {
+			overlaps = append(overlaps, o)
+		}
+	}
+	return overlaps, nil
+}
+
+// Returns the reason a job of the number of URLs is rejected for overlapping
+// the active job.
+func overlapReason(overlap common.JobOverlap, urls int) string {
+	return fmt.Sprintf("Job overlaps active job %d, %d of its %d URLs are seeds of the active job", overlap.JobId, overlap.Overlapping, urls)
+}
+
+// Returns the reason URLs of the opted out host are not scheduled.
+func optedOutReason(optOut *common.HostOptOut) string {
+	return fmt.Sprintf("Host %s has opted out of crawling: %s", optOut.Host, optOut.Reason)
+}
+
+// Returns the opt outs of the URLs' hosts which have opted out of crawling,
+// keyed by host.
+func (h *JobScheduleHandler) optedOut(urls []string) (map[string]*common.HostOptOut, *ErroMsg) {
+	checked := map[string]struct{}{}
+	optOuts := map[string]*common.HostOptOut{}
+	for _, u := range urls {
+		host := common.URLHost(u)
+		if _, ok := checked[host]; ok {
+			continue
+		}
+		checked[host] = struct{}{}
+
+		optOut, err := h.sc.HostClient().GetOptOut(host)
+		if err != nil {
+			return nil, &ErroMsg{
+				Source: "JobScheduleHandler.optedOut",
+				Info:   "Failed to check host opt outs",
+				Err:    err,
+			}
+		}
+		if optOut != nil {
+			optOuts[host] = optOut
+		}
+	}
+	return optOuts, nil
+}
+
+// Returns the URLs which were crawled within the cache max age, and whose
+// crawl the foreman will satisfy from the crawl cache. None are if the job
+// forces its URLs to be crawled, or downloads them.
+func (h *JobScheduleHandler) cachedURLs(urls []string, opts jobOptions) ([]string, *ErroMsg) {
+	if h.cacheMaxAge <= 0 || opts.forceCrawl || opts.delta || opts.download {
+		return nil, nil
+	}
+
+	var cached []string
+	now := time.Now().UTC()
+	for _, u := range urls {
+		urlRec, err := h.sc.URLClient().GetURLByURL(u)
+		if err != nil {
+			return nil, &ErroMsg{
+				Source: "JobScheduleHandler.cachedURLs",
+				Info:   "Failed to check crawl cache",
+				Err:    err,
+			}
+		}
+		if urlRec != nil && urlRec.Crawled && now.Sub(urlRec.CrawledOn) < h.cacheMaxAge {
+			cached = append(cached, u)
+		}
+	}
+	return cached, nil
+}
+
+// Options a job is scheduled with
+type jobOptions struct {
+	// Crawl flags applied to all of the job's URLs
+	forceCrawl, delta, noFetchCache, skipAlternates bool
+
+	// Hours of the day the job's URLs are allowed to be crawled, nil if any time.
+	window *common.CrawlWindow
+
+	// JSONPath expressions applied to the job's JSON responses, nil if none.
+	jsonPaths *common.JobJSONPaths
+
+	// Flags the job's crawled pages are matched against, nil if none.
+	flags []common.JobFlag
+
+	// Include, and exclude patterns the links of the job's pages are matched
+	// against, nil if none.
+	urlPatterns []common.JobURLPattern
+
+	// If the job's URLs are downloaded as files
+	download bool
+
+	// If the main text content of the job's crawled pages is extracted
+	extractText bool
+
+	// Tags the job is listed by, nil if none.
+	tags []string
+
+	// Rules of how the job handles the responses of status codes, nil if none.
+	statusRules []common.JobStatusRule
+
+	// Priority the job's URLs are dispatched with, one of the common.Priority
+	// constants.
+	priority int
+
+	// Max level of the job's URLs, one more than its max depth, zero if none.
+	maxLevel int
+
+	// Most URLs the job crawls, zero if unlimited.
+	maxURLs int
+
+	// Time after which the job's URLs are no longer dispatched, zero if none.
+	deadline time.Time
+
+	// Scope of the links crawled, one of the JobScope constants. Empty if
+	// links to any host are crawled.
+	scope string
+
+	// Query parameters stripped from the links of the job's pages, nil if
+	// the default tracking parameters are stripped.
+	stripParams []string
+
+	// If the fragments of the links of the job's pages are kept.
+	keepFragments bool
+
+	// API key the job was scheduled with, zero if none.
+	apiKeyId int64
+}
+
+// Returns the options stored with the job's record.
+func (opts jobOptions) settings() storage.JobSettings {
+	return storage.JobSettings{
+		CrawlWindow: opts.window,
+		ExtractText: opts.extractText,
+		JSONPaths:   opts.jsonPaths,
+		Flags:       opts.flags,
+		URLPatterns: opts.urlPatterns,
+		Tags:        opts.tags,
+		StatusRules: opts.statusRules,
+		APIKeyId:    opts.apiKeyId,
+		MaxURLs:     opts.maxURLs,
+		Deadline:    opts.deadline,
+		Scope:       opts.scope,
+
+		StripParams:   opts.stripParams,
+		KeepFragments: opts.keepFragments,
+	}
+}
+
 // Requests that a job be created, and the parts of it be scheduled.
 // a job id will be returned if the job was successfully created, and
-// error if there was a failure.
-func (h *JobScheduleHandler) scheduleJob(urls []string, forceCrawl bool) (common.JobId, *ErroMsg) {
+// error if there was a failure. The checksums of a download job's files
+// are keyed by URL, and may be nil.
+func (h *JobScheduleHandler) scheduleJob(urls []string, checksums map[string]string, opts jobOptions) (common.JobId, *ErroMsg) {
 	job, err := h.sc.JobClient().CreateJobFromURLs(urls)
 	if err != nil {
 		return common.InvalidId, &ErroMsg{
@@ -155,20 +1244,169 @@ func (h *JobScheduleHandler) scheduleJob(urls []string, forceCrawl bool) (common
 		}
 	}
 
+	if opts.window != nil {
+		if err := h.sc.JobClient().SetCrawlWindow(job.Id, opts.window); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job crawl window failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.extractText {
+		if err := h.sc.JobClient().SetExtractText(job.Id, true); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job extract text failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.jsonPaths != nil {
+		if err := h.sc.JobClient().SetJSONPaths(job.Id, opts.jsonPaths); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job JSONPaths failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.flags != nil {
+		if err := h.sc.JobClient().SetFlags(job.Id, opts.flags); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job flags failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.urlPatterns != nil {
+		if err := h.sc.JobClient().SetURLPatterns(job.Id, opts.urlPatterns); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job URL patterns failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.tags != nil {
+		if err := h.sc.JobClient().SetTags(job.Id, opts.tags); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job tags failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.statusRules != nil {
+		if err := h.sc.JobClient().SetStatusRules(job.Id, opts.statusRules); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job status rules failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.maxURLs > 0 {
+		if err := h.sc.JobClient().SetMaxURLs(job.Id, opts.maxURLs); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job max URLs failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if !opts.deadline.IsZero() {
+		if err := h.sc.JobClient().SetDeadline(job.Id, opts.deadline); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job deadline failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.scope != "" {
+		if err := h.sc.JobClient().SetScope(job.Id, opts.scope); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job scope failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.stripParams != nil || opts.keepFragments {
+		if err := h.sc.JobClient().SetURLStripping(job.Id, opts.stripParams, opts.keepFragments); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job URL stripping failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if opts.apiKeyId != 0 {
+		if err := h.sc.JobClient().SetAPIKey(job.Id, opts.apiKeyId); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job API key failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	if len(checksums) > 0 {
+		// The job's URLs are in the order they were created with
+		expected := map[common.URLId]string{}
+		for i, u := range job.URLs {
+			if sum, ok := checksums[urls[i]]; ok {
+				expected[u.URLId] = sum
+			}
+		}
+		if err := h.sc.JobClient().SetExpectedChecksums(job.Id, expected); err != nil {
+			return common.InvalidId, &ErroMsg{
+				Source: "JobScheduleHandler.scheduleJob",
+				Info:   fmt.Sprintf("Set Job download checksums failed"),
+				Err:    err,
+			}
+		}
+	}
+
+	h.queueJob(job, opts)
+
+	return job.Id, nil
+}
+
+// Queues the created job's URLs to be crawled in the background.
+func (h *JobScheduleHandler) queueJob(job *storage.Job, opts jobOptions) {
 	go func() {
 		for _, u := range job.URLs {
-			if err := h.sc.URLClient().AddPending(job.Id, u.URLId, u.URLId); err != nil {
-				log.Println("JobScheduleHandler.scheduleJob: failed to add job URL to pending list", err)
+			item := &common.URLQueueItem{
+				JobId:          job.Id,
+				OriginId:       u.URLId,
+				URLId:          u.URLId,
+				ReferId:        common.InvalidId,
+				ForceCrawl:     opts.forceCrawl || opts.delta,
+				Delta:          opts.delta,
+				NoFetchCache:   opts.noFetchCache,
+				SkipAlternates: opts.skipAlternates,
+				Download:       opts.download,
+				Priority:       opts.priority,
+				MaxLevel:       opts.maxLevel,
 			}
-			h.urlQueuePub.Send(&common.URLQueueItem{
-				JobId:      job.Id,
-				OriginId:   u.URLId,
-				URLId:      u.URLId,
-				ReferId:    common.InvalidId,
-				ForceCrawl: forceCrawl,
-			})
+			if err := h.sc.URLClient().AddPending(item); err != nil {
+				log.Println("JobScheduleHandler.queueJob: failed to add job URL to pending list", err)
+			}
+			h.urlQueuePub.Send(item)
 		}
 	}()
-
-	return job.Id, nil
 }
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"github.com/jasdel/harvester/internal/common"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetRequestedJobURLs(t *testing.T) {
@@ -14,8 +20,11 @@ example.com
 
 http://www.reddit.com
 `)
-	urls, err := getRequestedJobURLs(reader)
+	requested, err := getRequestedJobURLs(reader, false, false, 0)
 	require.Nil(t, err, "Expect no error")
+	assert.Len(t, requested.rejected, 0, "Expect no URLs rejected")
+	assert.Len(t, requested.duplicates, 0, "Expect no duplicate URLs")
+	urls := requested.urls
 	assert.Len(t, urls, 3, "Expect lengths to match")
 	assert.Equal(t, `https://www.google.com`, urls[0], "URL entry should match")
 	assert.Equal(t, `http://example.com`, urls[1], "URL entry should match")
@@ -24,9 +33,64 @@ http://www.reddit.com
 
 func TestGetRequestedJobURLsFail(t *testing.T) {
 	reader := strings.NewReader(`/something/not/a/URL`)
-	urls, err := getRequestedJobURLs(reader)
+	requested, err := getRequestedJobURLs(reader, false, false, 0)
 	assert.NotNil(t, err, "Expected error to be found")
-	assert.Len(t, urls, 0, "Expect no URLs returned")
+	assert.Nil(t, requested, "Expect no URLs returned")
+}
+
+func TestGetRequestedJobURLsPartial(t *testing.T) {
+	reader := strings.NewReader(`https://www.google.com
+/something/not/a/URL
+example.com
+gopher://example.com
+example.com
+`)
+	requested, err := getRequestedJobURLs(reader, true, false, 0)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{`https://www.google.com`, `http://example.com`}, requested.urls, "Expect valid URLs")
+	require.Len(t, requested.rejected, 2, "Expect invalid URLs rejected")
+	assert.Equal(t, `/something/not/a/URL`, requested.rejected[0].URL, "Rejected URL should match")
+	assert.Equal(t, `gopher://example.com`, requested.rejected[1].URL, "Rejected URL should match")
+	assert.Equal(t, "Invalid URL scheme", requested.rejected[1].Reason, "Expect rejected reason")
+}
+
+func TestGetRequestedJobURLsDuplicates(t *testing.T) {
+	reader := strings.NewReader(`example.com
+http://example.com
+https://example.com
+example.com
+`)
+	requested, err := getRequestedJobURLs(reader, false, false, 0)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{`http://example.com`, `https://example.com`}, requested.urls, "Expect distinct URLs")
+	assert.Equal(t, []duplicateJobURL{
+		{URL: `http://example.com`, Of: `http://example.com`},
+		{URL: `example.com`, Of: `http://example.com`},
+	}, requested.duplicates, "Expect duplicates of the normalized URL")
+}
+
+func TestGetRequestedJobURLsLimits(t *testing.T) {
+	body := "example.com\nexample.org\n\nexample.net\n"
+
+	requested, err := getRequestedJobURLs(strings.NewReader(body), false, false, 3)
+	require.Nil(t, err, "Expect URLs within the limit")
+	assert.Len(t, requested.urls, 3, "Expect all URLs")
+
+	_, err = getRequestedJobURLs(strings.NewReader(body), false, false, 2)
+	require.NotNil(t, err, "Expect URLs over the limit rejected")
+	assert.Equal(t, "Too many URLs, a job can have at most 2 URLs", err.Short(), "Expect limit in error")
+	code, status := requestErrorStatus(err)
+	assert.Equal(t, "BadRequest", code, "Expect bad request code")
+	assert.Equal(t, http.StatusBadRequest, status, "Expect bad request status")
+
+	w := httptest.NewRecorder()
+	in := http.MaxBytesReader(w, ioutil.NopCloser(strings.NewReader(body)), 8)
+	_, err = getRequestedJobURLs(in, false, false, 0)
+	require.NotNil(t, err, "Expect body over the limit rejected")
+	assert.Equal(t, "Request body too large", err.Short(), "Expect body size error")
+	code, status = requestErrorStatus(err)
+	assert.Equal(t, "RequestTooLarge", code, "Expect request too large code")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status, "Expect request too large status")
 }
 
 type validateTestCase struct {
@@ -40,6 +104,9 @@ var validateTestCases = []validateTestCase{
 	validateTestCase{in: `http://example.com`, out: `http://example.com`, err: false},
 	validateTestCase{in: `reddit.com`, out: `http://reddit.com`, err: false},
 	validateTestCase{in: `/something/else`, out: ``, err: true},
+	validateTestCase{in: `ftp://ftp.example.com/pub/`, out: `ftp://ftp.example.com/pub/`, err: false},
+	validateTestCase{in: `sftp://user@example.com/data`, out: `sftp://user@example.com/data`, err: false},
+	validateTestCase{in: `gopher://example.com`, out: ``, err: true},
 }
 
 func TestValidateJobURL(t *testing.T) {
@@ -55,3 +122,261 @@ func TestValidateJobURL(t *testing.T) {
 		assert.Equal(t, c.out, o, "Expect values to match")
 	}
 }
+
+func TestGetRequestedJSONPaths(t *testing.T) {
+	paths, err := getRequestedJSONPaths(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Nil(t, paths, "Expect no JSONPaths")
+
+	paths, err = getRequestedJSONPaths(url.Values{
+		"jsonLink":  []string{"$.links.next", "$.items[*].url"},
+		"jsonField": []string{"ids:$.items[*].id"},
+	})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{"$.links.next", "$.items[*].url"}, paths.Links, "Expect link expressions")
+	assert.Equal(t, map[string]string{"ids": "$.items[*].id"}, paths.Fields, "Expect field expressions")
+
+	for _, q := range []url.Values{
+		url.Values{"jsonLink": []string{"links.next"}},
+		url.Values{"jsonField": []string{"$.items[*].id"}},
+		url.Values{"jsonField": []string{"ids:$.items[?(@.id)]"}},
+	} {
+		_, err := getRequestedJSONPaths(q)
+		assert.NotNil(t, err, "Expect %v invalid", q)
+	}
+}
+
+func TestGetRequestedFlags(t *testing.T) {
+	flags, err := getRequestedFlags(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Nil(t, flags, "Expect no flags")
+
+	flags, err = getRequestedFlags(url.Values{
+		"keyword": []string{"Recall"},
+		"flag":    []string{`price:\$\d+`},
+	})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []common.JobFlag{
+		common.NewKeywordFlag("Recall"),
+		{Name: "price", Pattern: `\$\d+`},
+	}, flags, "Expect keyword and pattern flags")
+
+	for _, q := range []url.Values{
+		url.Values{"keyword": []string{" "}},
+		url.Values{"flag": []string{`\$\d+`}},
+		url.Values{"flag": []string{"price:(abc"}},
+	} {
+		_, err := getRequestedFlags(q)
+		assert.NotNil(t, err, "Expect %v invalid", q)
+	}
+}
+
+func TestGetRequestedStatusRules(t *testing.T) {
+	rules, err := getRequestedStatusRules(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Nil(t, rules, "Expect no rules")
+
+	rules, err = getRequestedStatusRules(url.Values{
+		"onStatus": []string{"403:fail", "420:retry:60s", "4xx:record"},
+	})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []common.JobStatusRule{
+		{Status: "403", Action: common.StatusActionFail},
+		{Status: "420", Action: common.StatusActionRetry, RetryDelay: time.Minute, Retries: common.DefaultStatusRetries},
+		{Status: "4xx", Action: common.StatusActionRecord},
+	}, rules, "Expect status rules")
+
+	for _, q := range []url.Values{
+		url.Values{"onStatus": []string{"403"}},
+		url.Values{"onStatus": []string{"403:ignore"}},
+		url.Values{"onStatus": []string{"403:fail", "403:retry"}},
+	} {
+		_, err := getRequestedStatusRules(q)
+		assert.NotNil(t, err, "Expect %v invalid", q)
+	}
+}
+
+func TestNewJobOptionsMsg(t *testing.T) {
+	assert.Equal(t, jobOptionsMsg{ForceCrawl: true, NoFetchCache: true},
+		newJobOptionsMsg(jobOptions{forceCrawl: true, noFetchCache: true}), "Expect crawl flags")
+
+	window, err := common.ParseCrawlWindow("01:00-05:00", "Europe/Berlin")
+	require.NoError(t, err, "Expect crawl window")
+	msg := newJobOptionsMsg(jobOptions{
+		window:    window,
+		jsonPaths: &common.JobJSONPaths{Links: []string{"$.next"}, Fields: map[string]string{"ids": "$.ids"}},
+	})
+	assert.Equal(t, "01:00-05:00", msg.CrawlWindow, "Expect crawl window")
+	assert.Equal(t, "Europe/Berlin", msg.CrawlWindowTZ, "Expect crawl window time zone")
+	assert.Equal(t, []string{"$.next"}, msg.JSONLinks, "Expect JSONPath links")
+	assert.Equal(t, map[string]string{"ids": "$.ids"}, msg.JSONFields, "Expect JSONPath fields")
+
+	flags := []common.JobFlag{common.NewKeywordFlag("recall")}
+	assert.Equal(t, flags, newJobOptionsMsg(jobOptions{flags: flags}).Flags, "Expect flags")
+
+	assert.Equal(t, "high", newJobOptionsMsg(jobOptions{priority: common.PriorityHigh}).Priority, "Expect priority")
+	assert.Empty(t, newJobOptionsMsg(jobOptions{}).Priority, "Expect normal priority omitted")
+}
+
+func TestGetRequestedJobOptionsPriority(t *testing.T) {
+	opts, err := getRequestedJobOptions(url.Values{"priority": {"low"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, common.PriorityLow, opts.priority, "Expect low priority")
+
+	opts, err = getRequestedJobOptions(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, common.PriorityNormal, opts.priority, "Expect normal priority by default")
+
+	_, err = getRequestedJobOptions(url.Values{"priority": {"urgent"}})
+	assert.NotNil(t, err, "Expect unknown priority invalid")
+}
+
+func TestGetRequestedJobOptionsMaxDepth(t *testing.T) {
+	opts, err := getRequestedJobOptions(url.Values{"maxDepth": {"0"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, 1, opts.maxLevel, "Expect only the job's URLs crawled")
+	require.NotNil(t, newJobOptionsMsg(opts).MaxDepth, "Expect max depth")
+	assert.Equal(t, 0, *newJobOptionsMsg(opts).MaxDepth, "Expect max depth")
+
+	opts, err = getRequestedJobOptions(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, 0, opts.maxLevel, "Expect no max level by default")
+	assert.Nil(t, newJobOptionsMsg(opts).MaxDepth, "Expect max depth omitted")
+
+	for _, v := range []string{"-1", "deep"} {
+		_, err = getRequestedJobOptions(url.Values{"maxDepth": {v}})
+		assert.NotNil(t, err, "Expect %s invalid", v)
+	}
+}
+
+func TestGetRequestedJobOptionsMaxURLs(t *testing.T) {
+	opts, err := getRequestedJobOptions(url.Values{"maxURLs": {"500"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, 500, opts.maxURLs, "Expect max URLs")
+	assert.Equal(t, 500, opts.settings().MaxURLs, "Expect max URLs stored")
+	assert.Equal(t, 500, newJobOptionsMsg(opts).MaxURLs, "Expect max URLs")
+
+	opts, err = getRequestedJobOptions(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, 0, opts.maxURLs, "Expect unlimited by default")
+
+	for _, v := range []string{"0", "-5", "many"} {
+		_, err = getRequestedJobOptions(url.Values{"maxURLs": {v}})
+		assert.NotNil(t, err, "Expect %s invalid", v)
+	}
+}
+
+func TestGetRequestedJobOptionsDeadline(t *testing.T) {
+	opts, err := getRequestedJobOptions(url.Values{"timeout": {"2h"}})
+	require.Nil(t, err, "Expect no error")
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), opts.deadline, time.Minute, "Expect deadline after timeout")
+	assert.Equal(t, opts.deadline, opts.settings().Deadline, "Expect deadline stored")
+	require.NotNil(t, newJobOptionsMsg(opts).Deadline, "Expect deadline")
+
+	opts, err = getRequestedJobOptions(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.True(t, opts.deadline.IsZero(), "Expect no deadline by default")
+	assert.Nil(t, newJobOptionsMsg(opts).Deadline, "Expect deadline omitted")
+
+	_, err = getRequestedJobOptions(url.Values{"deadline": {"2015-01-01T00:00:00Z"}})
+	assert.NotNil(t, err, "Expect past deadline invalid")
+	_, err = getRequestedJobOptions(url.Values{"timeout": {"1h"}, "deadline": {time.Now().Add(time.Hour).Format(time.RFC3339)}})
+	assert.NotNil(t, err, "Expect only one of deadline, or timeout")
+}
+
+func TestGetRequestedJobOptionsScope(t *testing.T) {
+	opts, err := getRequestedJobOptions(url.Values{"scope": {"subdomains"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, common.JobScopeSubdomains, opts.scope)
+	assert.Equal(t, common.JobScopeSubdomains, opts.settings().Scope, "Expect scope stored")
+	assert.Equal(t, common.JobScopeSubdomains, newJobOptionsMsg(opts).Scope)
+
+	opts, err = getRequestedJobOptions(url.Values{"scope": {"any"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, "", opts.scope, "Expect any scope not stored")
+	assert.Equal(t, "", newJobOptionsMsg(opts).Scope, "Expect any scope omitted")
+
+	_, err = getRequestedJobOptions(url.Values{"scope": {"elsewhere"}})
+	assert.NotNil(t, err, "Expect unknown scope invalid")
+}
+
+func TestGetRequestedJobOptionsStripParams(t *testing.T) {
+	opts, err := getRequestedJobOptions(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Nil(t, opts.settings().StripParams, "Expect default strip params")
+	assert.Nil(t, newJobOptionsMsg(opts).StripParams, "Expect default strip params omitted")
+
+	opts, err = getRequestedJobOptions(url.Values{"stripParams": {"ref", "sid_*"}, "keepFragments": {""}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{"ref", "sid_*"}, opts.settings().StripParams)
+	assert.True(t, opts.settings().KeepFragments, "Expect fragments kept")
+
+	opts, err = getRequestedJobOptions(url.Values{"stripParams": {"none"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{}, opts.settings().StripParams, "Expect no params stripped")
+	assert.Equal(t, []string{"none"}, newJobOptionsMsg(opts).StripParams)
+
+	_, err = getRequestedJobOptions(url.Values{"stripParams": {"a=b"}})
+	assert.NotNil(t, err, "Expect invalid strip param")
+}
+
+func TestGetRequestedJobOptionsURLPatterns(t *testing.T) {
+	opts, err := getRequestedJobOptions(url.Values{"include": {"/blog/*"}, "exclude": {"/blog/drafts/*", "re:(?i)logout"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []common.JobURLPattern{
+		{Pattern: "/blog/*"},
+		{Pattern: "/blog/drafts/*", Exclude: true},
+		{Pattern: "(?i)logout", Regexp: true, Exclude: true},
+	}, opts.urlPatterns)
+	assert.Equal(t, opts.urlPatterns, opts.settings().URLPatterns, "Expect patterns stored")
+
+	msg := newJobOptionsMsg(opts)
+	assert.Equal(t, []string{"/blog/*"}, msg.Include)
+	assert.Equal(t, []string{"/blog/drafts/*", "re:(?i)logout"}, msg.Exclude)
+
+	opts, err = getRequestedJobOptions(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Nil(t, opts.urlPatterns, "Expect no patterns by default")
+
+	_, err = getRequestedJobOptions(url.Values{"exclude": {"re:("}})
+	assert.NotNil(t, err, "Expect invalid regexp rejected")
+}
+
+func TestGetRequestedJobURLsDownload(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	reader := strings.NewReader(`http://example.com/a.csv sha256:` + strings.ToUpper(sum) + `
+example.com/b.pdf
+http://example.com/a.csv ` + strings.Repeat("cd", 32) + `
+`)
+	requested, err := getRequestedJobURLs(reader, false, true, 0)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{`http://example.com/a.csv`, `http://example.com/b.pdf`}, requested.urls, "Expect download URLs")
+	assert.Equal(t, map[string]string{`http://example.com/a.csv`: sum}, requested.checksums, "Expect checksum of first URL")
+	assert.Len(t, requested.duplicates, 1, "Expect duplicate URL dropped")
+
+	reader = strings.NewReader(`http://example.com/a.csv not-a-checksum`)
+	_, err = getRequestedJobURLs(reader, false, true, 0)
+	assert.NotNil(t, err, "Expect invalid checksum error")
+
+	reader = strings.NewReader(`http://example.com/a.csv not-a-checksum
+http://example.com/b.pdf ` + sum + `
+`)
+	requested, err = getRequestedJobURLs(reader, true, true, 0)
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{`http://example.com/b.pdf`}, requested.urls, "Expect valid URLs")
+	require.Len(t, requested.rejected, 1, "Expect invalid checksum rejected")
+	assert.Equal(t, `http://example.com/a.csv`, requested.rejected[0].URL, "Rejected URL should match")
+}
+
+func TestGetRequestedJobTags(t *testing.T) {
+	tags, err := getRequestedJobTags(url.Values{})
+	require.Nil(t, err, "Expect no error")
+	assert.Nil(t, tags, "Expect no tags")
+
+	tags, err = getRequestedJobTags(url.Values{"tag": {"Team-SEO", "client_1", "team-seo"}})
+	require.Nil(t, err, "Expect no error")
+	assert.Equal(t, []string{"team-seo", "client_1"}, tags, "Expect lower cased tags without duplicates")
+
+	_, err = getRequestedJobTags(url.Values{"tag": {"a,b"}})
+	assert.NotNil(t, err, "Expect invalid tag error")
+}
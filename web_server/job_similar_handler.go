@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/embedding"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Default, and maximum number of chunks a similarity search returns.
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 100
+)
+
+// Response message of a similarity search over a job's pages
+type jobSimilarMsg struct {
+	JobId common.JobId `json:"jobId"`
+	Query string       `json:"query"`
+
+	// Model the query, and the pages' chunks were embedded with
+	Model string `json:"model"`
+
+	// Chunks most similar to the query, most similar first
+	Results []jobSimilarResultMsg `json:"results"`
+}
+
+// Chunk of a page's text matching a similarity search
+type jobSimilarResultMsg struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+
+	// Index of the chunk within the page's chunks, and its text
+	Chunk int    `json:"chunk"`
+	Text  string `json:"text"`
+
+	// Cosine similarity of the chunk to the query, up to 1 for the most
+	// similar.
+	Score float64 `json:"score"`
+}
+
+// Handles the request to search a previously scheduled job's pages for the
+// chunks of text most similar in meaning to the query text 'q'. The query is
+// embedded with the web server's embeddings endpoint, and compared to the
+// vectors the workers stored of the job's pages, see the worker's embeddings
+// setting. Only vectors of the same model as the query are compared, so both
+// must be configured with the same model. Up to 'limit' chunks are returned,
+// default 10, most similar first. If embeddings are not configured a 403 is
+// returned, and if the job does not exist a 404 status code and message.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/similar?q=return+policy&limit=5"
+//
+// Response:
+//	- Success: {jobId: 1234, query: "return policy", model: <model>, results: [{url: <url>, title: <title>, chunk: 0, text: <text>, score: 0.82}]}
+//	- Failure: {code: <code>, message: <message>}
+type JobSimilarHandler struct {
+	sc *storage.Client
+
+	// Embeds the search queries, nil if embeddings are not configured.
+	embedder *embedding.Client
+
+	version apiVersion
+}
+
+func (h *JobSimilarHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	if h.embedder == nil {
+		h.version.writeError(w, "Forbidden", "Similarity search is not enabled", http.StatusForbidden)
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobSimilar request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query, limit, err := getSimilarOptions(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobSimilar invalid search options.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	vectors, err := h.embedder.Embed([]string{query})
+	if err != nil {
+		log.Println("routeJobSimilar failed to embed query.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to embed query", http.StatusBadGateway)
+		return
+	}
+
+	results := newSimilarResults(limit)
+	err = h.sc.JobClient().Embeddings(id, h.embedder.Model(), func(e storage.PageEmbedding) error {
+		results.add(jobSimilarResultMsg{
+			URL:   e.URL,
+			Title: e.Title,
+			Chunk: e.Embedding.Chunk,
+			Text:  e.Embedding.Text,
+			Score: embedding.CosineSimilarity(vectors[0], e.Embedding.Vector),
+		})
+		return nil
+	})
+	if err != nil {
+		jobErr := &ErroMsg{
+			Source: "JobSimilarHandler",
+			Info:   fmt.Sprintf("Failed to get job %d embeddings", id),
+			Err:    err,
+		}
+		log.Println("routeJobSimilar request job embeddings failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	h.version.writeData(w, jobSimilarMsg{
+		JobId:   id,
+		Query:   query,
+		Model:   h.embedder.Model(),
+		Results: results.msgs,
+	}, http.StatusOK)
+}
+
+// Returns the query text, and the limit of chunks of the search, or the
+// default limit if not set. An error is returned if the query is empty, or
+// longer than the largest chunk, or the limit is not between 1 and
+// maxSimilarLimit.
+func getSimilarOptions(query url.Values) (string, int, error) {
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		return "", 0, fmt.Errorf("Query text q is required")
+	}
+	if tokens := common.CountTokens(q); tokens > maxChunkSize {
+		return "", 0, fmt.Errorf("Query text too long, %d tokens, must be at most %d", tokens, maxChunkSize)
+	}
+
+	limit := defaultSimilarLimit
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxSimilarLimit {
+			return "", 0, fmt.Errorf("Invalid limit: %s, must be between 1 and %d", v, maxSimilarLimit)
+		}
+	}
+	return q, limit, nil
+}
+
+// Chunks most similar to a query, keeping up to the limit of the chunks
+// added, ordered most similar first.
+type similarResults struct {
+	limit int
+	msgs  []jobSimilarResultMsg
+}
+
+func newSimilarResults(limit int) *similarResults {
+	return &similarResults{limit: limit, msgs: make([]jobSimilarResultMsg, 0, limit)}
+}
+
+// Adds the chunk if it is more similar than the least similar chunk kept, or
+// fewer than the limit are kept. Chunks as similar as one already kept are
+// ordered after it.
+func (s *similarResults) add(msg jobSimilarResultMsg) {
+	if len(s.msgs) == s.limit && msg.Score <= s.msgs[len(s.msgs)-1].Score {
+		return
+	}
+
+	i := sort.Search(len(s.msgs), func(i int) bool { return s.msgs[i].Score < msg.Score })
+	if len(s.msgs) < s.limit {
+		s.msgs = append(s.msgs, jobSimilarResultMsg{})
+	}
+	copy(s.msgs[i+1:], s.msgs[i:])
+	s.msgs[i] = msg
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetSimilarOptions(t *testing.T) {
+	cases := []struct {
+		query string
+		q     string
+		limit int
+		err   bool
+	}{
+		{query: "q=return+policy", q: "return policy", limit: defaultSimilarLimit},
+		{query: "q=+shipping+&limit=5", q: "shipping", limit: 5},
+		{query: "q=a&limit=100", q: "a", limit: maxSimilarLimit},
+		{query: "", err: true},
+		{query: "q=+", err: true},
+		{query: "q=a&limit=0", err: true},
+		{query: "q=a&limit=101", err: true},
+		{query: "q=a&limit=abc", err: true},
+		{query: "q=" + strings.Repeat("word+", maxChunkSize+1), err: true},
+	}
+
+	for _, c := range cases {
+		query, _ := url.ParseQuery(c.query)
+		q, limit, err := getSimilarOptions(query)
+		if c.err {
+			assert.Error(t, err, "Expect error for %q", c.query)
+			continue
+		}
+		assert.NoError(t, err, "Expect no error for %q", c.query)
+		assert.Equal(t, c.q, q, "Expect query text for %q", c.query)
+		assert.Equal(t, c.limit, limit, "Expect limit for %q", c.query)
+	}
+}
+
+func TestSimilarResults(t *testing.T) {
+	results := newSimilarResults(3)
+	for i, score := range []float64{0.2, 0.9, 0.5, 0.1, 0.7, 0.5} {
+		results.add(jobSimilarResultMsg{Chunk: i, Score: score})
+	}
+
+	chunks := []int{}
+	for _, msg := range results.msgs {
+		chunks = append(chunks, msg.Chunk)
+	}
+	assert.Equal(t, []int{1, 4, 2}, chunks, "Expect most similar chunks kept, most similar first")
+
+	results = newSimilarResults(3)
+	results.add(jobSimilarResultMsg{Chunk: 0, Score: 0.5})
+	results.add(jobSimilarResultMsg{Chunk: 1, Score: 0.5})
+	assert.Equal(t, 0, results.msgs[0].Chunk, "Expect equally similar chunks in the order added")
+	assert.Len(t, results.msgs, 2, "Expect fewer chunks than the limit kept")
+}
+
+func TestJobSimilarHandlerNotEnabled(t *testing.T) {
+	h := &JobSimilarHandler{version: apiV2}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v2/job/1/similar?q=a", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, "Expect search refused without embeddings")
+}
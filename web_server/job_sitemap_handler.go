@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/sitemap"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Handles the request to generate a sitemap of a previously scheduled job's
+// successfully crawled HTML pages. Each page's lastmod is the date its content
+// was last modified, or published, as stored when it was crawled, and is
+// omitted if unknown. Jobs with more pages than a sitemap may list are split
+// into multiple sitemaps selected with the 'page' query parameter, and the
+// request without a page responds with a sitemap index of them. If the job
+// does not exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/job/1234/sitemap.xml"
+// curl -X GET "http://localhost:8080/job/1234/sitemap.xml?page=2"
+//
+// Response:
+//	- Success: <urlset>, or <sitemapindex> if split, sitemap XML document
+//	- Failure: {code: <code>, message: <message>}
+type JobSitemapHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobSitemapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobSitemap request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page := 0
+	if v := r.URL.Query().Get("page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			log.Println("routeJobSitemap invalid page.", v)
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid page: %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	pages, jobErr := h.jobSitemapPages(id)
+	if jobErr != nil {
+		log.Println("routeJobSitemap request job sitemap failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	count := sitemapCount(len(pages))
+	if page > count {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Job %d sitemap only has %d pages", id, count), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if page == 0 && count > 1 {
+		err = sitemap.WriteIndex(w, sitemapIndexURLs(requestURL(r), count))
+	} else {
+		if page == 0 {
+			page = 1
+		}
+		err = sitemap.WriteURLSet(w, sitemapURLs(sitemapSplit(pages, page)))
+	}
+	if err != nil {
+		log.Println("routeJobSitemap failed to write sitemap", id, err)
+	}
+}
+
+// Connects to the remote service hosting job information, and gets the
+// job's pages to be listed in its sitemap.
+func (h *JobSitemapHandler) jobSitemapPages(id common.JobId) ([]common.SitemapPage, *ErroMsg) {
+	pages, err := h.sc.JobClient().SitemapPages(id)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobSitemapPages",
+			Info:   fmt.Sprintf("Failed to get job %d sitemap", id),
+			Err:    err,
+		}
+	}
+
+	return pages, nil
+}
+
+// Returns the number of sitemaps needed to list the number of pages. A job
+// without pages still has a single empty sitemap.
+func sitemapCount(pages int) int {
+	if pages == 0 {
+		return 1
+	}
+	return (pages + sitemap.MaxURLs - 1) / sitemap.MaxURLs
+}
+
+// Returns the pages listed in the sitemap, numbered from 1.
+func sitemapSplit(pages []common.SitemapPage, page int) []common.SitemapPage {
+	start := (page - 1) * sitemap.MaxURLs
+	if start >= len(pages) {
+		return nil
+	}
+	end := start + sitemap.MaxURLs
+	if end > len(pages) {
+		end = len(pages)
+	}
+	return pages[start:end]
+}
+
+// Converts the pages to sitemap URLs, formatting their last updated dates.
+func sitemapURLs(pages []common.SitemapPage) []sitemap.URL {
+	urls := make([]sitemap.URL, len(pages))
+	for i, p := range pages {
+		urls[i].Loc = p.URL
+		if !p.LastUpdated.IsZero() {
+			urls[i].LastMod = p.LastUpdated.UTC().Format(time.RFC3339)
+		}
+	}
+	return urls
+}
+
+// Returns the URLs of each of the sitemaps, selected by the page query
+// parameter of the sitemap's URL.
+func sitemapIndexURLs(sitemapURL string, count int) []sitemap.URL {
+	urls := make([]sitemap.URL, count)
+	for i := range urls {
+		urls[i].Loc = fmt.Sprintf("%s?page=%d", sitemapURL, i+1)
+	}
+	return urls
+}
+
+// Returns the absolute URL of the request, without its query. The scheme is
+// taken from the X-Forwarded-Proto header if the web server is behind a
+// reverse proxy.
+func requestURL(r *http.Request) string {
+	scheme := "http"
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	} else if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, r.Host, r.URL.Path)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/sitemap"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSitemapSplit(t *testing.T) {
+	pages := make([]common.SitemapPage, sitemap.MaxURLs+2)
+
+	assert.Equal(t, 1, sitemapCount(0), "Expect empty sitemap")
+	assert.Equal(t, 1, sitemapCount(sitemap.MaxURLs), "Expect single full sitemap")
+	assert.Equal(t, 2, sitemapCount(len(pages)), "Expect sitemap split")
+
+	assert.Len(t, sitemapSplit(pages, 1), sitemap.MaxURLs, "Expect first sitemap full")
+	assert.Len(t, sitemapSplit(pages, 2), 2, "Expect remaining pages in second sitemap")
+	assert.Len(t, sitemapSplit(nil, 1), 0, "Expect empty sitemap")
+}
+
+func TestSitemapURLs(t *testing.T) {
+	modified := time.Date(2015, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	urls := sitemapURLs([]common.SitemapPage{
+		{URL: "http://www.example.com/", LastUpdated: modified},
+		{URL: "http://www.example.com/about"},
+	})
+
+	assert.Equal(t, []sitemap.URL{
+		{Loc: "http://www.example.com/", LastMod: "2015-01-02T02:04:05Z"},
+		{Loc: "http://www.example.com/about"},
+	}, urls, "Expect URLs with lastmod when known")
+}
+
+func TestSitemapIndexURLs(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/harvester/job/1234/sitemap.xml?page=1", nil)
+	r.Host = "example.com"
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	urls := sitemapIndexURLs(requestURL(r), 2)
+	assert.Equal(t, []sitemap.URL{
+		{Loc: "https://example.com/harvester/job/1234/sitemap.xml?page=1"},
+		{Loc: "https://example.com/harvester/job/1234/sitemap.xml?page=2"},
+	}, urls, "Expect a URL for each sitemap")
+}
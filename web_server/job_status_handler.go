@@ -7,8 +7,12 @@ import (
 	"log"
 	"net/http"
 	"path"
+	"time"
 )
 
+// Maximum number of a job's legally restricted URLs listed in its status.
+const maxStatusLegalRestrictions = 100
+
 // Response to a successful request of a Job
 type jobStatusMsg struct {
 	// The Number of completely crawled Job URLs
@@ -23,51 +27,159 @@ type jobStatusMsg struct {
 	// Mapping of individual URL status.  A true for a URL means that
 	// it has been processed, and only the false, URLs are pending.
 	URLs map[string]bool `json:"urls"`
+
+	// Number of crawled HTML pages with fewer visible words than
+	// the thin content threshold. Omitted if it couldn't be counted.
+	ThinContent *int `json:"thinContent,omitempty"`
+
+	// The job's URLs which responded 451 Unavailable For Legal Reasons, and
+	// the most recent of them. Omitted if not reported, e.g: by older peers.
+	LegalRestrictions *common.JobLegalRestrictions `json:"legalRestrictions,omitempty"`
+
+	// Most URLs the job may crawl, how many it has, and when it ran out.
+	// Omitted if the job was scheduled without a max.
+	URLBudget *common.JobURLBudget `json:"urlBudget,omitempty"`
+
+	// Deadline of the job, when it was finalized because of it, and how many
+	// of its URLs were never attempted. Omitted if the job has no deadline.
+	Deadline *common.JobDeadline `json:"deadline,omitempty"`
+
+	// If the job's stored HTML, and cached fetch bodies have been tiered
+	// into the cold store. Its results and reports are still available.
+	Archived bool `json:"archived"`
+
+	// If the job is paused, and its pending URLs are not being crawled.
+	Paused bool `json:"paused"`
+
+	// If the job was cancelled, and its pending URLs were dropped.
+	Cancelled bool `json:"cancelled"`
+
+	// If the job is waiting for a running job slot before its URLs are
+	// crawled. Omitted if the job isn't waiting.
+	Waiting bool `json:"waiting,omitempty"`
+
+	// Position of the waiting job in the queue of waiting jobs, and when it
+	// is estimated to start. Omitted if the job isn't waiting.
+	Queue *common.JobQueuePosition `json:"queue,omitempty"`
+
+	// Tags the job was scheduled with. Omitted if the job has none.
+	Tags []string `json:"tags,omitempty"`
+
+	// Hours of the day the job's URLs are allowed to be crawled, and the
+	// window's time zone. Omitted if the job can be crawled at any time.
+	CrawlWindow   string `json:"crawlWindow,omitempty"`
+	CrawlWindowTZ string `json:"crawlWindowTZ,omitempty"`
 }
 
 // Handles the request checking on the status of a previously scheduled job.
 // Returns an error if the job isn't found, or invalid input. If the job
-// exists its status will be returned. If the job does not exists a 404 status
-// code and message will be returned.
+// exists its status will be returned. The status also summarizes the number of
+// thin content pages, see JobThinContentHandler for the full report, omitted if
+// it can't be counted, and lists
+// the legal restrictions of the job's URLs which responded 451 Unavailable For
+// Legal Reasons, up to the 100 most recent, with the entity blocking each. If
+// the job does not exists a 404 status code and message will be returned. The
+// crawl window, URL budget, and deadline are only included if the job was
+// scheduled with them.
+//
+// Jobs waiting for a running job slot include their position in the queue,
+// and when they are estimated to start, based on how many jobs were started
+// in the last hour. No estimate is made if none were.
 //
 // e.g:
 // curl -X GET "http://localhost:8080/status/1234"
 //
 // Response:
-//	- Success: {completed: 2, pending: 3, elapsed: 5m10s, urls: { <url>: <complete> } }
+//	- Success: {completed: 2, pending: 3, elapsed: 5m10s, urls: { <url>: <complete> }, thinContent: 1, legalRestrictions: {count: 1, urls: [{url: <url>, host: <host>, blockedBy: <url>, recordedOn: <time>}]}, urlBudget: {max: 500, crawled: 500, exhaustedOn: <time>}, deadline: {deadline: <time>, expiredOn: <time>, unattempted: 12}, archived: false, paused: false, cancelled: false, waiting: true, queue: {position: 3, recentlyStarted: 12, estimatedStart: <time>}, tags: ["team-seo"], crawlWindow: "01:00-05:00", crawlWindowTZ: "Europe/Berlin" }
 //	- Failure: {code: <code>, message: <message>}
 type JobStatusHandler struct {
 	sc *storage.Client
+
+	// Word count HTML pages must be under to be considered thin content
+	thinContentWords int
+
+	version apiVersion
 }
 
 func (h *JobStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		w.Header().Set("Allow", "GET")
-		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+		h.version.methodNotAllowed(w, "GET")
 		return
 	}
 
 	id, err := jobIdFromString(path.Base(r.URL.Path))
 	if err != nil {
 		log.Println("routeJobStatus status request failed.", err)
-		writeJSONError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	status, jobErr := h.jobStatus(id)
 	if jobErr != nil {
 		log.Println("routeJobStatus request job status failed.", jobErr)
-		writeJSONError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
 		return
 	}
 
-	// Write job status out
-	writeJSON(w, jobStatusMsg{
+	msg := jobStatusMsg{
 		Completed: status.Completed,
 		Pending:   status.Pending,
 		URLs:      status.URLs,
 		Elapsed:   status.Elapsed.String(),
-	}, http.StatusOK)
+		Archived:  status.Archived,
+		Paused:    status.Paused,
+		Cancelled: status.Cancelled,
+		Waiting:   status.Waiting,
+	}
+	if status.CrawlWindow != nil {
+		msg.CrawlWindow = status.CrawlWindow.String()
+		msg.CrawlWindowTZ = status.CrawlWindow.Location.String()
+	}
+
+	// The thin content count is only a summary, so the status is still
+	// returned without it.
+	if thinContent, err := h.sc.JobClient().ThinContentCount(id, h.thinContentWords); err != nil {
+		log.Println("routeJobStatus request job thin content count failed.", id, err)
+	} else {
+		msg.ThinContent = &thinContent
+	}
+
+	legal, err := h.sc.JobClient().LegalRestrictions(id, maxStatusLegalRestrictions)
+	if err != nil {
+		log.Println("routeJobStatus request job legal restrictions failed.", err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d legal restrictions", id), http.StatusInternalServerError)
+		return
+	}
+	msg.LegalRestrictions = legal
+
+	if msg.URLBudget, err = h.sc.JobClient().URLBudget(id); err != nil {
+		log.Println("routeJobStatus request job URL budget failed.", err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d URL budget", id), http.StatusInternalServerError)
+		return
+	}
+
+	if msg.Deadline, err = h.sc.JobClient().DeadlineStatus(id); err != nil {
+		log.Println("routeJobStatus request job deadline failed.", err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d deadline", id), http.StatusInternalServerError)
+		return
+	}
+
+	if msg.Tags, err = h.sc.JobClient().Tags(id); err != nil {
+		log.Println("routeJobStatus request job tags failed.", err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d tags", id), http.StatusInternalServerError)
+		return
+	}
+
+	if status.Waiting {
+		if msg.Queue, err = h.sc.JobClient().QueuePosition(id, time.Now().UTC()); err != nil {
+			log.Println("routeJobStatus request job queue position failed.", err)
+			h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d queue position", id), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Write job status out
+	h.version.writeData(w, msg, http.StatusOK)
 }
 
 // Connects to the remote service hosting job information, and
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+)
+
+// Handles the request for the thin content report of a previously scheduled job.
+// The report lists the job's crawled HTML pages which have fewer visible words
+// than the threshold. The threshold defaults to the server's configured value,
+// but can be overridden with the 'threshold' query parameter. If the job does
+// not exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/thin/1234?threshold=300"
+//
+// Response:
+//	- Success: {threshold: 300, pages: [{url: <url>, words: 42}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobThinContentHandler struct {
+	sc        *storage.Client
+	threshold int
+	version   apiVersion
+}
+
+func (h *JobThinContentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobThinContent request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	threshold := h.threshold
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		if threshold, err = strconv.Atoi(v); err != nil || threshold < 0 {
+			log.Println("routeJobThinContent invalid threshold.", v)
+			h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid threshold: %s", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, jobErr := h.jobThinContent(id, threshold)
+	if jobErr != nil {
+		log.Println("routeJobThinContent request job thin content failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	// Write job thin content report out
+	h.version.writeData(w, report, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and generates
+// the job's thin content report.
+func (h *JobThinContentHandler) jobThinContent(id common.JobId, threshold int) (*common.ThinContentReport, *ErroMsg) {
+	report, err := h.sc.JobClient().ThinContent(id, threshold)
+	if err != nil {
+		return nil, &ErroMsg{
+			Source: "jobThinContent",
+			Info:   fmt.Sprintf("Failed to get job %d thin content report", id),
+			Err:    err,
+		}
+	}
+
+	return report, nil
+}
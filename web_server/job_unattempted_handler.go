@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for the URLs a previously scheduled job never attempted,
+// because the job's deadline passed while they were pending. Each URL is listed
+// with the page it was found on, and its distance from the job's URL. The list
+// is empty if the job finished before its deadline. If the job does not exists
+// a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/report/unattempted/1234"
+//
+// Response:
+//	- Success: {urls: [{url: <url>, refer: <url>, level: 1}, ...]}
+//	- Failure: {code: <code>, message: <message>}
+type JobUnattemptedHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobUnattemptedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobUnattempted request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if jobErr := jobMustExist(h.sc, id, "routeJobUnattempted"); jobErr != nil {
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	report, err := h.sc.JobClient().Unattempted(id)
+	if err != nil {
+		log.Println("routeJobUnattempted request job unattempted URLs failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d unattempted URLs", id), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, report, http.StatusOK)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/errreport"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"runtime/debug"
+	"time"
+)
+
+// Maximum size of a seed list which can be uploaded.
+const maxUploadSize = 1 << 30
+
+// Age after which uploads still parsing, or scheduling, when the web server
+// starts are failed, since the web server ingesting them must have stopped.
+// Long enough for other web servers to finish ingesting their uploads.
+const staleUploadAge = time.Hour
+
+// Response message of a job upload
+type jobUploadMsg struct {
+	// Id of the upload
+	UploadId common.UploadId `json:"uploadId"`
+
+	// State of the upload: parsing, scheduling, completed, or failed
+	State string `json:"state"`
+
+	// Number of valid, rejected, and duplicate URLs parsed from the seed
+	// list. Zero until the seed list is parsed.
+	URLs       int `json:"urls"`
+	Rejected   int `json:"rejected"`
+	Duplicates int `json:"duplicates"`
+
+	// Id of the job the upload was scheduled as. Omitted until completed.
+	JobId common.JobId `json:"jobId,omitempty"`
+
+	// Reason the upload failed. Omitted unless failed.
+	Error string `json:"error,omitempty"`
+
+	// Path of the upload's status, and of its job's status once completed
+	StatusURL    string `json:"statusURL"`
+	JobStatusURL string `json:"jobStatusURL,omitempty"`
+}
+
+// Returns the message of the upload, with paths under the API root path.
+func newJobUploadMsg(u *common.JobUpload, version apiVersion, rootPath string) jobUploadMsg {
+	msg := jobUploadMsg{
+		UploadId:   u.Id,
+		State:      u.State,
+		URLs:       u.URLs,
+		Rejected:   u.Rejected,
+		Duplicates: u.Duplicates,
+		Error:      u.Error,
+		StatusURL:  version.path(rootPath, fmt.Sprintf("uploads/%d", u.Id)),
+	}
+	if u.JobId != common.InvalidId {
+		msg.JobId = u.JobId
+		msg.JobStatusURL = version.path(rootPath, fmt.Sprintf("status/%d", u.JobId))
+	}
+	return msg
+}
+
+// Handles the request to upload a seed list to be scheduled as a job in the
+// background. Very large seed lists take minutes to parse, validate, and add
+// to a job, so instead of waiting for the job to be scheduled, the upload is
+// stored, and its id is returned once the seed list is received. The upload's
+// status, and its job id once completed, are polled with JobUploadStatusHandler.
+//
+// The body, and query parameters, are the same as JobScheduleHandler's. With
+// the 'partial' query parameter invalid and opted out URLs are counted as
+// rejected, otherwise the upload fails at the first one. Only the number of
+// rejected and duplicate URLs are reported. The Location header is set to the
+// upload's status path.
+//
+// Uploads being ingested when the web server stops are not resumed. They are
+// failed when a web server starts, once older than staleUploadAge. A panic
+// while ingesting an upload is recovered from, reported, and fails the upload.
+//
+// e.g:
+// curl -X POST --data-binary @seeds.txt "http://localhost:8080/uploads?partial"
+//
+// Response:
+//	- Success: {uploadId: 12, state: "parsing", urls: 0, rejected: 0, duplicates: 0, statusURL: "/uploads/12"}
+//	- Failure: {code: <code>, message: <message>}
+type JobUploadHandler struct {
+	// Schedules the upload's job, once its seed list is parsed
+	scheduler *JobScheduleHandler
+
+	sc       *storage.Client
+	rootPath string
+	version  apiVersion
+
+	// Reports panics recovered from while ingesting uploads
+	reporter *errreport.Reporter
+}
+
+func (h *JobUploadHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		h.version.methodNotAllowed(w, "POST")
+		return
+	}
+
+	if !h.scheduler.limiter.check(w, r, h.version, 1) {
+		log.Println("routeJobUpload request rate limited")
+		return
+	}
+	if !checkQuota(h.sc, w, r, h.version, 1) {
+		return
+	}
+
+	opts, err := getRequestedJobOptions(r.URL.Query())
+	if err != nil {
+		log.Println("routeJobUpload request invalid options", err)
+		h.version.writeError(w, "BadRequest", err.Short(), http.StatusBadRequest)
+		return
+	}
+	opts.apiKeyId = requestAPIKeyId(r)
+	partial, partialErr := queryFlag(r.URL.Query(), "partial")
+	if partialErr != nil {
+		log.Println("routeJobUpload request invalid partial", partialErr)
+		h.version.writeError(w, "BadRequest", partialErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The seed list is spooled to disk, so the request completes once it
+	// is received, instead of once it is parsed.
+	file, spoolErr := spoolUpload(http.MaxBytesReader(w, r.Body, maxUploadSize))
+	if spoolErr != nil {
+		log.Println("routeJobUpload failed to receive seed list.", spoolErr)
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Failed to receive seed list: %v", spoolErr), http.StatusBadRequest)
+		return
+	}
+
+	upload, uploadErr := h.sc.JobClient().CreateUpload()
+	if uploadErr != nil {
+		log.Println("routeJobUpload failed to create upload.", uploadErr)
+		file.Close()
+		os.Remove(file.Name())
+		h.version.writeError(w, "DependancyFailure", "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+
+	go h.ingest(upload, file, opts, partial)
+
+	msg := newJobUploadMsg(upload, h.version, h.rootPath)
+	w.Header().Set("Location", msg.StatusURL)
+	h.version.writeData(w, msg, http.StatusAccepted)
+}
+
+// Copies the seed list into a temporary file, returning the file rewound
+// to its start.
+func spoolUpload(in io.Reader) (*os.File, error) {
+	file, err := ioutil.TempFile("", "harvester-upload")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(file, in); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return file, nil
+}
+
+// Parses, and validates the upload's seed list, and schedules its URLs as a
+// job. The upload's state is updated as it progresses. The spooled seed list
+// is removed once done.
+func (h *JobUploadHandler) ingest(upload *common.JobUpload, file *os.File, opts jobOptions, partial bool) {
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	jobClient := h.sc.JobClient()
+	update := func(state, reason string) {
+		upload.State, upload.Error = state, reason
+		if err := jobClient.UpdateUpload(upload); err != nil {
+			log.Println("JobUploadHandler.ingest: failed to update upload", upload.Id, err)
+		}
+	}
+
+	// Ingested in the background, so a panic would otherwise crash the web
+	// server, and leave the upload parsing forever.
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		stack := debug.Stack()
+		log.Printf("JobUploadHandler.ingest: recovered from panic ingesting upload %d: %v\n%s", upload.Id, rec, stack)
+		h.reporter.Panic(h.version.path("", "uploads"), rec, stack, map[string]string{
+			"upload": fmt.Sprint(upload.Id),
+		})
+		update(common.JobUploadFailed, "Failed to ingest upload")
+	}()
+
+	requested, err := getRequestedJobURLs(file, partial, opts.download, h.scheduler.maxURLs)
+	if err != nil {
+		log.Println("JobUploadHandler.ingest: upload", upload.Id, "parse failed", err)
+		update(common.JobUploadFailed, err.Short())
+		return
+	}
+
+	// Hosts which have opted out of crawling can not be scheduled
+	if optOut, err := h.scheduler.rejectOptedOut(requested, partial); err != nil {
+		log.Println("JobUploadHandler.ingest: upload", upload.Id, "opt out check failed", err)
+		update(common.JobUploadFailed, err.Short())
+		return
+	} else if optOut != nil {
+		update(common.JobUploadFailed, optedOutReason(optOut))
+		return
+	}
+
+	upload.URLs = len(requested.urls)
+	upload.Rejected = len(requested.rejected)
+	upload.Duplicates = len(requested.duplicates)
+	if upload.URLs == 0 {
+		update(common.JobUploadFailed, "No URLs provided")
+		return
+	}
+	update(common.JobUploadScheduling, "")
+
+	id, err := h.scheduler.scheduleJob(requested.urls, requested.checksums, opts)
+	if err != nil {
+		log.Println("JobUploadHandler.ingest: upload", upload.Id, "job schedule failed", err)
+		update(common.JobUploadFailed, err.Short())
+		return
+	}
+
+	upload.JobId = id
+	update(common.JobUploadCompleted, "")
+	log.Println("JobUploadHandler.ingest: upload", upload.Id, "scheduled as job", id, "with", upload.URLs, "URLs")
+}
+
+// Fails the uploads left parsing, or scheduling, by web servers which stopped
+// while ingesting them, so their clients don't poll them forever.
+func failStaleUploads(sc *storage.Client) {
+	if n, err := sc.JobClient().FailStaleUploads(staleUploadAge, "Upload was interrupted, web server stopped"); err != nil {
+		log.Println("Failed to fail stale uploads.", err)
+	} else if n > 0 {
+		log.Println("Failed stale uploads", n)
+	}
+}
+
+// Handles the request checking on the status of a job upload. Once the
+// upload is completed its job id is included. If the upload does not exist
+// a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/uploads/12"
+//
+// Response:
+//	- Success: {uploadId: 12, state: "completed", urls: 5000000, rejected: 12, duplicates: 40, jobId: 1234, statusURL: "/uploads/12", jobStatusURL: "/status/1234"}
+//	- Failure: {code: <code>, message: <message>}
+type JobUploadStatusHandler struct {
+	sc       *storage.Client
+	rootPath string
+	version  apiVersion
+}
+
+func (h *JobUploadStatusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := uploadIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeJobUploadStatus request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := h.sc.JobClient().Upload(id)
+	if err != nil {
+		log.Println("routeJobUploadStatus failed to get upload", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get upload %d", id), http.StatusInternalServerError)
+		return
+	}
+	if upload == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Upload %d not found", id), http.StatusNotFound)
+		return
+	}
+
+	h.version.writeData(w, newJobUploadMsg(upload, h.version, h.rootPath), http.StatusOK)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpoolUpload(t *testing.T) {
+	file, err := spoolUpload(strings.NewReader("http://example.com\nhttp://example.org\n"))
+	require.NoError(t, err, "Expect seed list spooled")
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	requested, parseErr := getRequestedJobURLs(file, false, false, 0)
+	require.Nil(t, parseErr, "Expect spooled seed list parsed from its start")
+	assert.Equal(t, []string{"http://example.com", "http://example.org"}, requested.urls, "Expect spooled URLs")
+
+	b, err := ioutil.ReadFile(file.Name())
+	require.NoError(t, err, "Expect spooled file")
+	assert.Equal(t, "http://example.com\nhttp://example.org\n", string(b), "Expect seed list spooled as is")
+}
+
+func TestNewJobUploadMsg(t *testing.T) {
+	upload := &common.JobUpload{Id: 12, State: common.JobUploadParsing, JobId: common.InvalidId}
+	msg := newJobUploadMsg(upload, apiV1, "/goapps/harvester")
+	assert.Equal(t, jobUploadMsg{UploadId: 12, State: "parsing", StatusURL: "/goapps/harvester/uploads/12"}, msg, "Expect upload without job")
+
+	upload = &common.JobUpload{Id: 12, State: common.JobUploadCompleted, URLs: 3, Rejected: 1, Duplicates: 2, JobId: 1234}
+	msg = newJobUploadMsg(upload, apiV2, "")
+	assert.Equal(t, jobUploadMsg{
+		UploadId: 12, State: "completed", URLs: 3, Rejected: 1, Duplicates: 2, JobId: 1234,
+		StatusURL: "/v2/uploads/12", JobStatusURL: "/v2/status/1234",
+	}, msg, "Expect completed upload with its job")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Response to a successful job urgent request
+type jobUrgentMsg struct {
+	// Job which was requested to be flagged, or unflagged
+	JobId common.JobId `json:"jobId"`
+
+	// True if the job is flagged as urgent
+	Urgent bool `json:"urgent"`
+}
+
+// Handles the admin requests to flag a job as urgent, and to unflag it. While
+// an urgent job is being crawled the foreman throttles the items of all other
+// jobs, parking the items over the throttled rate until no urgent job is
+// active, so the urgent job gets the workers' capacity. Cancelled jobs can not
+// be flagged. If the job does not exist a 404 status code and message will be
+// returned.
+//
+// POST flags the job as urgent, DELETE unflags it.
+//
+// e.g:
+// curl -X POST -H "Authorization: Bearer <token>" "http://localhost:8080/job/1234/urgent"
+//
+// Response:
+//	- Success: {jobId: 1234, urgent: true}
+//	- Failure: {code: <code>, message: <message>}
+type JobUrgentHandler struct {
+	sc         *storage.Client
+	adminToken string
+	version    apiVersion
+}
+
+func (h *JobUrgentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "DELETE" {
+		h.version.methodNotAllowed(w, "POST, DELETE")
+		return
+	}
+
+	if !isAdminRequest(r, h.adminToken) {
+		h.version.writeError(w, "Forbidden", "Admin authorization required", http.StatusForbidden)
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobUrgent request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	urgent := r.Method == "POST"
+	if jobErr := h.setUrgent(id, urgent); jobErr != nil {
+		log.Println("routeJobUrgent request job urgent failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+	log.Println("routeJobUrgent job", id, "urgent", urgent)
+
+	h.version.writeData(w, jobUrgentMsg{JobId: id, Urgent: urgent}, http.StatusOK)
+}
+
+// Connects to the remote service hosting job information, and flags, or
+// unflags the job as urgent.
+func (h *JobUrgentHandler) setUrgent(id common.JobId, urgent bool) *ErroMsg {
+	if jobErr := jobMustExist(h.sc, id, "setUrgent"); jobErr != nil {
+		return jobErr
+	}
+
+	updated, err := h.sc.JobClient().SetUrgent(id, urgent)
+	if err != nil || !updated {
+		return &ErroMsg{
+			Source: "setUrgent",
+			Info:   fmt.Sprintf("Failed to update urgent flag of job %d, job may be cancelled", id),
+			Err:    err,
+		}
+	}
+
+	return nil
+}
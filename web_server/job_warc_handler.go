@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/jasdel/harvester/internal/warc"
+	"log"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Handles the request to export the stored pages of a previously scheduled job
+// as a gzip compressed WARC file, so they can be replayed by web-archiving
+// tools, e.g: pywb. Each page whose raw HTML was stored by the workers, see the
+// worker's 'storeHTML' setting, is a response record of the stored HTML, with
+// the status and content type the page was crawled with. The pages' other
+// response headers are not stored, and are not included. Records are streamed
+// as the pages are read. If the job does not exist a 404 status code and
+// message will be returned.
+//
+// e.g:
+// curl -X GET -o job-1234.warc.gz "http://localhost:8080/job/1234/warc"
+//
+// Response:
+//	- Success: gzip compressed WARC file
+//	- Failure: {code: <code>, message: <message>}
+type JobWARCHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *JobWARCHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(path.Dir(r.URL.Path)))
+	if err != nil {
+		log.Println("routeJobWARC request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeWARC(w, id)
+}
+
+// Streams the job's stored pages as WARC response records, after a warcinfo
+// record. If the pages can't be read before any are written a 404 status code
+// and message are written instead.
+func (h *JobWARCHandler) writeWARC(w http.ResponseWriter, id common.JobId) {
+	ww := warc.NewWriter(w, true)
+	started := false
+	start := func() error {
+		started = true
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="job-%d.warc.gz"`, id))
+		_, err := ww.WriteRecord(warc.NewWarcinfo(time.Now(), warcinfoFields(id)))
+		return err
+	}
+
+	err := h.sc.JobClient().StoredPages(id, func(page storage.StoredPage) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		_, err := ww.WriteRecord(storedPageRecord(page))
+		return err
+	})
+	if err != nil && !started {
+		jobErr := &ErroMsg{
+			Source: "writeWARC",
+			Info:   fmt.Sprintf("Failed to get job %d stored pages", id),
+			Err:    err,
+		}
+		log.Println("routeJobWARC request job stored pages failed.", jobErr)
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("routeJobWARC failed to write WARC", id, err)
+		return
+	}
+
+	if !started {
+		if err := start(); err != nil {
+			log.Println("routeJobWARC failed to write WARC", id, err)
+		}
+	}
+}
+
+// Returns the fields of the warcinfo record of the job's WARC file.
+func warcinfoFields(id common.JobId) map[string]string {
+	return map[string]string{
+		"software":    "harvester",
+		"format":      "WARC File Format 1.1",
+		"description": fmt.Sprintf("Stored pages of job %d", id),
+	}
+}
+
+// Returns the response record of the stored page. Pages without a status
+// are recorded as 200 OK.
+func storedPageRecord(page storage.StoredPage) *warc.Record {
+	status := page.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	header := http.Header{}
+	if page.Mime != "" {
+		header.Set("Content-Type", page.Mime)
+	}
+	return warc.NewResponse(page.URL, page.StoredOn, status, header, []byte(page.Raw), false)
+}
@@ -3,12 +3,18 @@ package main
 import (
 	"encoding/json"
 	"flag"
+	"fmt"
+	"github.com/jasdel/harvester/internal/embedding"
+	"github.com/jasdel/harvester/internal/errreport"
+	"github.com/jasdel/harvester/internal/jwt"
 	"github.com/jasdel/harvester/internal/queue"
+	"github.com/jasdel/harvester/internal/safehttp"
 	"github.com/jasdel/harvester/internal/storage"
 	"log"
 	"net/http"
 	"os"
 	"path"
+	"time"
 )
 
 // Web server for exposing an interface for scheduling jobs, checking their status, and
@@ -17,12 +23,222 @@ import (
 // The endpoints exposed are:
 // POST: /
 //		- Schedule Job. Body is newline separated list of URls to scheduled to be crawled.
+//		  Responds with the created job, and its status path in the Location header.
+//		  Warns of active jobs the job's URLs overlap, or rejects the job if rejectOverlap is set.
+//
+// POST: /uploads
+//		- Upload a seed list to be scheduled as a job in the background. Body is the same as
+//		  Schedule Job's. Responds with the upload's id once the seed list is received.
+//
+// GET: /uploads/:uploadId
+//		- Get the status of an upload, and its job id once scheduled.
+//
+// GET, POST: /recurring?cron=<expr>&cronTZ=<tz>&name=<name>
+//		- List the recurring jobs, or create a recurring job scheduling a job of the URLs in the body,
+//		  the same as Schedule Job's, each time the cron expression matches.
+//
+// GET, DELETE: /recurring/:recurringJobId
+//		- Get a recurring job, or delete it so it schedules no more jobs.
+//
+// POST: /groups
+//		- Schedule multiple Jobs as a named group. Body is a JSON object of the group's name,
+//		  optional completion webhook, and the URLs of each job.
+//
+// GET: /groups/:groupId
+//		- Get the status of a group, aggregated from the status of its jobs.
 //
 // GET: /status/:jobId
 //		- Get the status of an already scheduled job.
 //
-// GET: /result/:jobId
-//		- Get the result of an already scheduled job
+// GET: /result/:jobId[?limit=<limit>&cursor=<cursor>&mime=<mime>&status=<status>&domain=<domain>]
+//		- Get the result of an already scheduled job, or a page of it continuing from the cursor.
+//		  Results can be filtered by mime type, status code, domain, tag, or flag.
+//		  Results are streamed as CSV rows if format=csv, or text/csv is accepted.
+//
+// GET: /report/freshness/:jobId
+//		- Get the content freshness report of a job, grouped by host.
+//
+// GET: /report/thin/:jobId
+//		- Get the thin content report of a job's HTML pages.
+//
+// GET: /report/mime/:jobId
+//		- Get the URLs of a job whose declared Content-Type mismatched the content type sniffed from their content.
+//
+// GET: /report/parse/:jobId[?url=<url>]
+//		- Get the URLs of a job whose content failed to be parsed, or the quarantined raw content of one.
+//
+// GET: /report/panics/:jobId
+//		- Get the panics the workers recovered from while crawling a job's URLs, with their stacks.
+//
+// GET: /report/unattempted/:jobId
+//		- Get the URLs a job never attempted because its deadline passed.
+//
+// GET: /stripping[/:jobId]
+//		- Get the default tracking parameters stripped from the links of crawled pages, or
+//		  the parameters, and fragments stripped from the links of a job's pages.
+//
+// GET: /report/headings/:jobId
+//		- Get the duplicate and missing title, h1, and description report of a job's HTML pages.
+//
+// GET: /report/orphans/:jobId
+//		- Get the sitemap orphaned and uncharted pages report of a job.
+//
+// GET: /report/robots/:jobId
+//		- Get a suggested robots.txt for each host of a job, disallowing error-prone directories
+//		  and duplicate query parameters.
+//
+// GET: /query/:jobId?q=<expression>
+//		- Get the URLs of a job matching the filter expression.
+//
+// GET: /jsonfields/:jobId
+//		- Get the fields extracted by a job's JSONPath expressions from its crawled JSON responses.
+//
+// POST: /restore/:jobId
+//		- Restore an archived job's bodies from the cold store into the database.
+//
+// POST: /pause/:jobId, /job/:jobId/pause
+//		- Pause a job, keeping its pending URLs in its frontier instead of crawling them.
+//
+// POST: /resume/:jobId, /job/:jobId/resume
+//		- Resume a paused job, re-queuing its frontier of pending URLs.
+//
+// GET: /job/:jobId/archive
+//		- Export a job as a self-contained tarball.
+//
+// POST: /job/:jobId/cancel
+//		- Cancel a job, draining its pending URLs, and skipping any of its URLs already queued.
+//
+// POST, DELETE: /job/:jobId/urgent
+//		- Flag a job as urgent, throttling all other jobs while it is crawled, or unflag it. Requires the admin token.
+//
+// GET: /job/:jobId/events
+//		- Stream a job's progress as Server-Sent Events as its URLs are crawled, fail, and complete.
+//
+// POST: /job/:jobId/export?destination=<name>[&full=true]
+//		- Export a job's URLs crawled since it was previously exported to the destination.
+//
+// GET: /job/:jobId/export
+//		- Get the watermark of each destination a job has been exported to.
+//
+// GET: /job/:jobId/results/export[?mime=<mime>&status=<status>&domain=<domain>]
+//		- Stream a job's results as JSON Lines, filtered the same as its result, e.g: to export
+//		  the results of jobs too large to be returned at once.
+//
+// GET: /job/:jobId/flags
+//		- Get the flags of a job, and the URLs of its crawled pages whose content matched each.
+//
+// GET: /job/:jobId/manifest?format=<json|csv|sha256>
+//		- Get the manifest of a download job's files, their checksums, and if they were verified.
+//
+// GET: /job/:jobId/badge.svg
+//		- Get an SVG badge of a job's state and completion percentage, to be embedded in pages.
+//
+// GET: /job/:jobId/sitemap.xml
+//		- Get a sitemap of a job's crawled HTML pages, or a sitemap index if split across
+//		  multiple sitemaps selected with the page query parameter.
+//
+// GET: /job/:jobId/redirects?format=<csv|nginx|apache>
+//		- Export a job's redirect map of redirecting URLs to their final URL, e.g: for a site migration.
+//
+// GET: /job/:jobId/warc
+//		- Export the pages of a job whose HTML was stored by the workers as a gzip compressed WARC
+//		  file, e.g: to replay them with pywb.
+//
+// GET: /job/:jobId/chunks?size=<tokens>&overlap=<tokens>
+//		- Export the main text of a job's pages as JSON Lines of token counted chunks, e.g: for
+//		  embedding or LLM ingestion pipelines.
+//
+// GET: /job/:jobId/similar?q=<text>&limit=<limit>
+//		- Search the chunks of a job's pages embedded by the workers for those most similar to the
+//		  query text. Only enabled if the embeddings endpoint is configured.
+//
+// GET: /feed?job=<jobId>&domain=<domain>
+//		- Follow the crawls of all jobs, or a job, live over a WebSocket as URLs are fetched, skipped,
+//		  and errored. The job and domain parameters are optional.
+//
+// POST: /jobs/batch
+//		- Schedule multiple independent Jobs at once. Body is a JSON object of the URLs of each job.
+//		  The jobs are created in a single transaction. Responds with the ids of the created jobs.
+//
+// POST: /jobs/import
+//		- Import a job tarball exported by /job/:jobId/archive as a new job.
+//
+// GET: /jobs?limit=<limit>&offset=<offset>&status=<status>&createdAfter=<time>&tag=<tag>
+//		- List the most recent jobs, and their progress, filtered by status, creation time, and tag.
+//
+// GET: /hosts/:host/history
+//		- Get the crawl history of a host, summarized per job.
+//
+// GET: /hosts/:host/wellknown
+//		- Get the well-known files, e.g: security.txt, llms.txt, and humans.txt, found on a host.
+//
+// GET: /hosts/:host/identity
+//		- Get the site name and favicon information captured for a host.
+//
+// GET: /hosts/:host/favicon
+//		- Get the favicon image captured for a host.
+//
+// GET: /hosts/:host/reputation?days=<days>
+//		- Get the reputation score of a host, and the anomalies detected in its recent crawls.
+//
+// GET: /html?url=<url>
+//		- Get the sanitized, or raw, HTML stored for a crawled URL.
+//
+// GET: /snapshot?url=<url>
+//		- View a crawled URL's stored HTML, with its links rewritten to the
+//		  snapshots of other crawled pages.
+//
+// GET: /text?url=<url>
+//		- Get the main text content extracted from a crawled URL.
+//
+// GET, POST, DELETE: /hosts/:host/optout
+//		- Get, add, or remove a host's entry in the opt-out registry. Opted out hosts are not crawled.
+//
+// GET: /optouts
+//		- List all hosts in the opt-out registry. Requires the admin token.
+//
+// GET, POST: /apikeys
+//		- List the API keys, or create a new key. Requires the admin token.
+//
+// POST: /apikeys/:id/enable, /apikeys/:id/disable
+//		- Enable, or disable an API key. Requires the admin token.
+//
+// DELETE: /apikeys/:id
+//		- Revoke an API key. Requires the admin token.
+//
+// GET, PUT, DELETE: /apikeys/:id/quota
+//		- Get, set, or remove the monthly quota of the jobs scheduled with an API key. Requires the admin token.
+//
+// GET: /apikeys/usage[?from=<YYYY-MM>&to=<YYYY-MM>&apiKey=<id>]
+//		- Get the monthly usage of the crawls of the jobs scheduled with each API key. Requires the admin token.
+//
+// GET: /v2/federated/jobs
+//		- List the most recent jobs of this instance and its configured peers.
+//
+// GET: /v2/federated/status/:instance/:jobId
+//		- Get the status of a job on this instance, or proxied from a peer.
+//
+// The endpoints above are also served under the /v2/ path prefix, e.g: /v2/status/:jobId.
+// v2 responses are wrapped in a {data, error, meta} envelope with snake_case field names.
+// The un-prefixed v1 endpoints are deprecated, and respond with Deprecation and Link headers
+// pointing to their v2 successor.
+//
+// GET, POST: /graphql
+//		- Query jobs, their results, URLs, and the links between URLs with GraphQL. Not versioned.
+//
+// GET: /openapi.json
+//		- Get the OpenAPI 3 document of the endpoints above. Not versioned. Requests to the
+//		  endpoints with parameters, or JSON bodies not matching the document are refused.
+//
+// If requireAPIKeys is set all endpoints refuse requests without an enabled API key, sent with
+// the X-API-Key header, or as a bearer token. Requests with the admin token are always accepted.
+// If the jwt configuration's issuer is set JWT bearer tokens of the issuer are accepted as well,
+// and all endpoints require either.
+//
+// Panics while serving a request are recovered from, and responded as an internal error.
+// Each panic is logged with its stack, counted by route, and reported to the Sentry compatible
+// service of the errorReporting configuration's dsn if set. If metricsAddr is set the panic
+// counts are served as JSON from /debug/vars on that address.
 //
 // Queues Used:
 // Publish to URL Queue:
@@ -62,12 +278,60 @@ func main() {
 	}
 	defer sc.Close()
 
+	// Authorize requests with the stored API keys, or the identity provider's
+	// JWTs if required
+	var auth *apiKeyAuth
+	if cfg.RequireAPIKeys || cfg.JWT.Enabled() {
+		auth = &apiKeyAuth{adminToken: cfg.AdminToken, lookup: sc.APIKeyClient().GetByKey}
+		if cfg.JWT.Enabled() {
+			auth.tokens = jwt.NewVerifier(cfg.JWT)
+		}
+	}
+
+	// Recovered panics are counted, and reported if an error reporting
+	// service is configured.
+	reporter, err := errreport.New(cfg.ErrorReporting, "web_server")
+	if err != nil {
+		log.Fatalln("Error reporter initialization failed:", err)
+	}
+	if cfg.MetricsAddr != "" {
+		go func() {
+			log.Fatalln("Metrics serve failed:", servePanicMetrics(cfg.MetricsAddr, reporter))
+		}()
+	}
+
+	// Limits the rate each client can schedule jobs at, shared by the API
+	// versions so clients can't exceed it by alternating versions.
+	limiter := newScheduleLimiter(cfg.ScheduleLimit)
+
 	// Create the HTTP handlers to be able to provide an interface for serving
-	// job schedule, status, and result requests. The Trailing '/' have to be append
-	// because path.Join will strip off the trailing '/'
-	http.Handle(path.Join("/", cfg.HTTPRootPath), &JobScheduleHandler{urlQueuePub: urlQueuePub, sc: sc})
-	http.Handle(path.Join("/", cfg.HTTPRootPath, "status")+"/", &JobStatusHandler{sc: sc})
-	http.Handle(path.Join("/", cfg.HTTPRootPath, "result")+"/", &JobResultHandler{sc: sc})
+	// job schedule, status, and result requests, for each API version.
+	for _, version := range []apiVersion{apiV1, apiV2} {
+		handleAPI(cfg, version, auth, limiter, reporter, urlQueuePub, sc)
+	}
+
+	// Schedules the jobs of recurring jobs as they come due. Runs are claimed
+	// in storage, so each is only scheduled by one of the web servers.
+	go runRecurringJobs(&JobScheduleHandler{urlQueuePub: urlQueuePub, sc: sc, version: apiV2}, recurringJobInterval)
+
+	// Uploads left ingesting by web servers which stopped are failed.
+	failStaleUploads(sc)
+
+	// Idempotency keys are removed once they expire, instead of by the
+	// requests reserving them.
+	go expireIdempotencyKeys(sc, cfg.IdempotencyWindow)
+
+	graphQLHandler, err := NewGraphQLHandler(sc)
+	if err != nil {
+		log.Fatalln("GraphQL schema initialization failed:", err)
+	}
+	http.Handle(path.Join("/", cfg.HTTPRootPath, "graphql"), recoverPanics(auth.handler(graphQLHandler, apiV1), apiV1, "graphql", reporter))
+
+	openAPIHandler, err := NewOpenAPIHandler(cfg.HTTPRootPath)
+	if err != nil {
+		log.Fatalln("OpenAPI document initialization failed:", err)
+	}
+	http.Handle(path.Join("/", cfg.HTTPRootPath, "openapi.json"), recoverPanics(auth.handler(openAPIHandler, apiV1), apiV1, "openapi.json", reporter))
 
 	log.Println("Listening on", cfg.HTTPAddr)
 	if err := http.ListenAndServe(cfg.HTTPAddr, nil); err != nil {
@@ -75,6 +339,151 @@ func main() {
 	}
 }
 
+// Registers the API's HTTP handlers for the version under the root path. v1 routes
+// are wrapped so they advertise their v2 successor route. If auth is set routes
+// require an API key, except the public resources third parties request, job
+// badges embedded in pages, and site owners' host opt outs. Requests are validated
+// against the API's operations before reaching the handlers. Panics of the routes
+// are recovered from, and reported.
+func handleAPI(cfg Config, version apiVersion, auth *apiKeyAuth, limiter *scheduleLimiter, reporter *errreport.Reporter, urlQueuePub queue.Publisher, sc *storage.Client) {
+	root := cfg.HTTPRootPath
+	serve := func(route string, h http.Handler) {
+		if version == apiV1 {
+			h = deprecated(h, apiV2.path(root, route))
+		}
+		h = recoverPanics(h, version, version.path("", route), reporter)
+		http.Handle(version.path(root, route), h)
+	}
+	handle := func(route string, h http.Handler) {
+		serve(route, auth.handler(validateRequests(h, version, root, apiOperations), version))
+	}
+	// Wraps the handlers of a route's resources, so all but the public
+	// resources require an API key.
+	resources := func(handlers map[string]http.Handler, public ...string) map[string]http.Handler {
+		wrapped := make(map[string]http.Handler, len(handlers))
+		for name, h := range handlers {
+			wrapped[name] = auth.handler(validateRequests(h, version, root, apiOperations), version)
+		}
+		for _, name := range public {
+			wrapped[name] = validateRequests(handlers[name], version, root, apiOperations)
+		}
+		return wrapped
+	}
+
+	scheduler := &JobScheduleHandler{
+		urlQueuePub:       urlQueuePub,
+		sc:                sc,
+		cacheMaxAge:       cfg.CacheMaxAge,
+		overlapThreshold:  cfg.DuplicateJobOverlap,
+		limiter:           limiter,
+		maxURLs:           cfg.MaxJobURLs,
+		maxBodySize:       int64(cfg.MaxRequestBodyMB) << 20,
+		idempotencyWindow: cfg.IdempotencyWindow,
+		rootPath:          root,
+		version:           version,
+	}
+	handle("", scheduler)
+	if version != apiV1 {
+		// path.Join drops the trailing '/' of the version's root, e.g: /v2, so
+		// its path with the '/' is mounted as well.
+		handle("/", &apiRootHandler{handler: scheduler, path: version.path(root, "/"), version: version})
+	}
+	handle("uploads", &JobUploadHandler{scheduler: scheduler, sc: sc, rootPath: root, version: version, reporter: reporter})
+	handle("uploads/", &JobUploadStatusHandler{sc: sc, rootPath: root, version: version})
+	handle("recurring", &RecurringJobListHandler{scheduler: scheduler, sc: sc, rootPath: root, version: version})
+	handle("recurring/", &RecurringJobHandler{sc: sc, version: version})
+	handle("groups", &JobGroupHandler{scheduler: scheduler, sc: sc, rootPath: root, version: version})
+	handle("groups/", &JobGroupStatusHandler{sc: sc, version: version})
+	handle("status/", &JobStatusHandler{sc: sc, thinContentWords: cfg.ThinContentWords, version: version})
+	handle("result/", &JobResultHandler{sc: sc, version: version})
+	handle("report/freshness/", &JobFreshnessHandler{sc: sc, version: version})
+	handle("report/thin/", &JobThinContentHandler{sc: sc, threshold: cfg.ThinContentWords, version: version})
+	handle("report/mime/", &JobMimeMismatchHandler{sc: sc, version: version})
+	handle("report/parse/", &JobParseFailureHandler{sc: sc, version: version})
+	handle("report/panics/", &JobPanicHandler{sc: sc, version: version})
+	handle("report/unattempted/", &JobUnattemptedHandler{sc: sc, version: version})
+	handle("report/headings/", &JobHeadingsHandler{sc: sc, version: version})
+	handle("stripping", &URLStrippingHandler{sc: sc, version: version})
+	handle("stripping/", &URLStrippingHandler{sc: sc, version: version})
+	handle("report/orphans/", &JobOrphansHandler{sc: sc, client: &http.Client{Timeout: sitemapRequestTimeout}, version: version})
+	handle("report/robots/", &JobRobotsHandler{sc: sc, version: version})
+	handle("query/", &JobQueryHandler{sc: sc, version: version})
+	handle("jsonfields/", &JobJSONFieldsHandler{sc: sc, version: version})
+	handle("restore/", &JobRestoreHandler{sc: sc, version: version})
+	jobPause := &JobPauseHandler{sc: sc, version: version}
+	jobResume := &JobResumeHandler{urlQueuePub: urlQueuePub, sc: sc, version: version}
+	handle("pause/", jobPause)
+	handle("resume/", jobResume)
+
+	// Embeds the queries of similarity searches, nil if not configured
+	var queryEmbedder *embedding.Client
+	if cfg.Embeddings.Enabled() {
+		queryEmbedder = embedding.NewClient(cfg.Embeddings.URL, cfg.Embeddings.Model, cfg.Embeddings.APIKey,
+			&http.Client{Timeout: cfg.Embeddings.Timeout})
+	}
+	serve("job/", &JobResourceHandler{
+		resources: resources(map[string]http.Handler{
+			"archive":        &JobArchiveHandler{sc: sc, version: version},
+			"badge.svg":      &JobBadgeHandler{sc: sc, version: version},
+			"cancel":         &JobCancelHandler{sc: sc, version: version},
+			"chunks":         &JobChunksHandler{sc: sc, version: version},
+			"events":         &JobEventsHandler{sc: sc, version: version},
+			"export":         &JobExportHandler{sc: sc, version: version},
+			"flags":          &JobFlagsHandler{sc: sc, version: version},
+			"manifest":       &JobManifestHandler{sc: sc, version: version},
+			"pause":          jobPause,
+			"redirects":      &JobRedirectsHandler{sc: sc, version: version},
+			"results/export": &JobResultsExportHandler{sc: sc, version: version},
+			"resume":         jobResume,
+			"similar":        &JobSimilarHandler{sc: sc, embedder: queryEmbedder, version: version},
+			"sitemap.xml":    &JobSitemapHandler{sc: sc, version: version},
+			"urgent":         &JobUrgentHandler{sc: sc, adminToken: cfg.AdminToken, version: version},
+			"warc":           &JobWARCHandler{sc: sc, version: version},
+		}, "badge.svg"),
+		version: version,
+	})
+	handle("feed", &CrawlFeedHandler{sc: sc, origins: cfg.CrawlFeedOrigins, version: version})
+	handle("jobs/batch", &JobBatchHandler{scheduler: scheduler, sc: sc, version: version})
+	handle("jobs/import", &JobImportHandler{sc: sc, version: version})
+	handle("jobs", &JobListHandler{sc: sc, version: version})
+	serve("hosts/", &HostResourceHandler{
+		resources: resources(map[string]http.Handler{
+			"history":    &HostHistoryHandler{sc: sc, version: version},
+			"wellknown":  &HostWellKnownHandler{sc: sc, version: version},
+			"identity":   &HostIdentityHandler{sc: sc, version: version},
+			"favicon":    &HostFaviconHandler{sc: sc, version: version},
+			"reputation": &HostReputationHandler{sc: sc, version: version},
+			"optout": &HostOptOutHandler{
+				sc:         sc,
+				client:     safehttp.NewClient(optOutVerifyTimeout),
+				adminToken: cfg.AdminToken,
+				secret:     cfg.OptOutSecret,
+				version:    version,
+			},
+		}, "optout"),
+		version: version,
+	})
+	handle("html", &URLHTMLHandler{sc: sc, version: version})
+	handle("snapshot", &URLSnapshotHandler{sc: sc, rootPath: root, version: version})
+	handle("text", &URLTextHandler{sc: sc, version: version})
+	handle("optouts", &HostOptOutListHandler{sc: sc, adminToken: cfg.AdminToken, version: version})
+	handle("apikeys", &APIKeyListHandler{sc: sc, adminToken: cfg.AdminToken, version: version})
+	handle("apikeys/", &APIKeyHandler{sc: sc, adminToken: cfg.AdminToken, version: version})
+	handle("apikeys/usage", &APIKeyUsageHandler{sc: sc, adminToken: cfg.AdminToken, version: version})
+
+	// Federation passes the peers' v2 responses through as is, so is only served by v2.
+	if version == apiV2 {
+		peers := newPeerClients(cfg.Peers)
+		handle("federated/jobs", &FederatedJobsHandler{sc: sc, instance: cfg.InstanceName, peers: peers, version: version})
+		handle("federated/status/", &FederatedStatusHandler{
+			instance: cfg.InstanceName,
+			local:    &JobStatusHandler{sc: sc, thinContentWords: cfg.ThinContentWords, version: version},
+			peers:    peers,
+			version:  version,
+		})
+	}
+}
+
 // Provides the web server's configuration information. For connecting to
 // Queues, storage, and other runtime settings.
 type Config struct {
@@ -90,8 +499,108 @@ type Config struct {
 	// Root path the HTTP routes should be based of of. Useful when
 	// nesting the service behind a reverse proxy
 	HTTPRootPath string `json:"httpRootPath"`
+
+	// Word count HTML pages must be under to be reported as thin
+	// content. Defaults to defaultThinContentWords if not set.
+	ThinContentWords int `json:"thinContentWords"`
+
+	// Name this instance's jobs are listed under when federated with
+	// peers. Defaults to defaultInstanceName if not set.
+	InstanceName string `json:"instanceName"`
+
+	// Other harvester web servers whose jobs are federated with this
+	// instance's jobs.
+	Peers []PeerConfig `json:"peers"`
+
+	// Bearer token administrators authorize requests with, e.g: to opt
+	// hosts out. Admin requests are refused if not set.
+	AdminToken string `json:"adminToken"`
+
+	// If requests to all endpoints require an enabled API key. Keys are
+	// managed with the admin token, so it must be set.
+	RequireAPIKeys bool `json:"requireAPIKeys"`
+
+	// JWT bearer tokens of an identity provider accepted in addition to API
+	// keys. If the issuer is set all endpoints require a key or token.
+	JWT jwt.Config `json:"jwt"`
+
+	// Origins of the pages, other than the web server's own, browsers may
+	// follow the live crawl feed from, e.g: https://dashboard.example.com.
+	CrawlFeedOrigins []string `json:"crawlFeedOrigins"`
+
+	// Secret site owner opt-out verification tokens are derived from.
+	// Site owners can not opt their hosts out if not set.
+	OptOutSecret string `json:"optOutSecret"`
+
+	// Maximum age a URL is cached for, used to report the scheduled job
+	// URLs the crawl cache will satisfy. Should match the foreman's
+	// cacheMaxAge. No URLs are reported as cached if not set.
+	// See http://golang.org/pkg/time/#ParseDuration for formatting
+	CacheMaxAgeStr string `json:"cacheMaxAge"`
+
+	// The CacheMaxAgeStr will be parsed, and its value placed into the CacheMaxAge field.
+	CacheMaxAge time.Duration `json:"-"`
+
+	// Fraction of a scheduled job's URLs, greater than 0 and at most 1, which
+	// must be seeds of an active job for the job to be warned as overlapping
+	// it. Defaults to defaultDuplicateJobOverlap if not set.
+	DuplicateJobOverlap float64 `json:"duplicateJobOverlap"`
+
+	// Maximum URLs a job can be scheduled with, including the jobs of job
+	// groups, and uploaded seed lists. Defaults to defaultMaxJobURLs if not
+	// set, and -1 does not limit jobs.
+	MaxJobURLs int `json:"maxJobURLs"`
+
+	// Maximum size in megabytes of the body of job schedule, and job group
+	// requests. Seed lists are uploaded instead of larger requests. Defaults
+	// to defaultMaxRequestBodyMB if not set, and -1 does not limit requests.
+	MaxRequestBodyMB int `json:"maxRequestBodyMB"`
+
+	// Duration the Idempotency-Key of a job schedule request is kept for,
+	// after which replaying the key schedules a new job. Defaults to
+	// defaultIdempotencyWindow. time.Duration string formated value, e.g: 24h
+	IdempotencyWindowStr string `json:"idempotencyWindow"`
+
+	// The IdempotencyWindowStr will be parsed, and its value placed into this field.
+	IdempotencyWindow time.Duration `json:"-"`
+
+	// Rate each client can schedule jobs at, including job groups, and
+	// uploaded seed lists. Not limited if not set.
+	ScheduleLimit ScheduleLimitConfig `json:"scheduleLimit"`
+
+	// Embeddings endpoint the queries of similarity searches are embedded
+	// with. Must use the same model as the workers' embeddings setting.
+	// Similarity search is not enabled if not set.
+	Embeddings embedding.Config `json:"embeddings"`
+
+	// Sentry compatible service the panics recovered from while serving
+	// requests are reported to. Panics are only logged, and counted if not set.
+	ErrorReporting errreport.Config `json:"errorReporting"`
+
+	// Address the counts of recovered panics are served from. Kept off of
+	// the HTTP address so they aren't public. Not served if not set.
+	MetricsAddr string `json:"metricsAddr"`
 }
 
+// Default word count pages must be under to be reported as thin content
+const defaultThinContentWords = 250
+
+// Default name of this instance when federated with peers
+const defaultInstanceName = "local"
+
+// Default fraction of a job's URLs which must be seeds of an active job for
+// the job to overlap it
+const defaultDuplicateJobOverlap = 0.5
+
+// Default maximum URLs a job can be scheduled with
+const defaultMaxJobURLs = 1000000
+
+// Default maximum size in megabytes of a job schedule request's body
+const defaultMaxRequestBodyMB = 64
+
+// Default duration idempotency keys are kept for
+const defaultIdempotencyWindow = 24 * time.Hour
+
 // Loads the configuration file from disk in as a JSON blob.
 func LoadConfig(filename string) (Config, error) {
 	cfg := Config{}
@@ -106,5 +615,77 @@ func LoadConfig(filename string) (Config, error) {
 		return cfg, err
 	}
 
+	if cfg.ThinContentWords <= 0 {
+		cfg.ThinContentWords = defaultThinContentWords
+	}
+
+	if cfg.CacheMaxAgeStr != "" {
+		cfg.CacheMaxAge, err = time.ParseDuration(cfg.CacheMaxAgeStr)
+		if err != nil {
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.CacheMaxAgeStr)
+		} else if cfg.CacheMaxAge < 0 {
+			return cfg, fmt.Errorf("Invalid cache max age %s, must be positive", cfg.CacheMaxAgeStr)
+		}
+	}
+
+	if cfg.DuplicateJobOverlap == 0 {
+		cfg.DuplicateJobOverlap = defaultDuplicateJobOverlap
+	} else if cfg.DuplicateJobOverlap < 0 || cfg.DuplicateJobOverlap > 1 {
+		return cfg, fmt.Errorf("Invalid duplicate job overlap %v, must be greater than 0, and at most 1", cfg.DuplicateJobOverlap)
+	}
+
+	if cfg.MaxJobURLs == 0 {
+		cfg.MaxJobURLs = defaultMaxJobURLs
+	} else if cfg.MaxJobURLs < -1 {
+		return cfg, fmt.Errorf("Invalid max job URLs %d, must be positive, or -1", cfg.MaxJobURLs)
+	}
+
+	if cfg.MaxRequestBodyMB == 0 {
+		cfg.MaxRequestBodyMB = defaultMaxRequestBodyMB
+	} else if cfg.MaxRequestBodyMB < -1 {
+		return cfg, fmt.Errorf("Invalid max request body %d MB, must be positive, or -1", cfg.MaxRequestBodyMB)
+	}
+
+	if cfg.IdempotencyWindowStr == "" {
+		cfg.IdempotencyWindow = defaultIdempotencyWindow
+	} else {
+		cfg.IdempotencyWindow, err = time.ParseDuration(cfg.IdempotencyWindowStr)
+		if err != nil {
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.IdempotencyWindowStr)
+		} else if cfg.IdempotencyWindow <= 0 {
+			return cfg, fmt.Errorf("Invalid idempotency window %s, must be positive", cfg.IdempotencyWindowStr)
+		}
+	}
+
+	if err := cfg.ScheduleLimit.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if cfg.RequireAPIKeys && cfg.AdminToken == "" {
+		return cfg, fmt.Errorf("Requiring API keys requires an admin token to manage the keys")
+	}
+
+	if err := cfg.JWT.SetDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Embeddings.SetDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if cfg.InstanceName == "" {
+		cfg.InstanceName = defaultInstanceName
+	}
+	names := map[string]struct{}{cfg.InstanceName: struct{}{}}
+	for _, p := range cfg.Peers {
+		if p.Name == "" || p.URL == "" {
+			return cfg, fmt.Errorf("Peers require both a name and url")
+		}
+		if _, ok := names[p.Name]; ok {
+			return cfg, fmt.Errorf("Duplicate instance name %s", p.Name)
+		}
+		names[p.Name] = struct{}{}
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,972 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Maximum size of a JSON request body which is validated. Larger bodies are
+// passed on to their handler unvalidated, which validates them as it reads them.
+const maxValidatedBodySize = 1 << 20
+
+// Types of API parameters, and JSON request body fields. Flag parameters are
+// enabled by being present, and their value is ignored.
+const (
+	apiTypeString  = "string"
+	apiTypeInteger = "integer"
+	apiTypeBoolean = "boolean"
+	apiTypeArray   = "array"
+	apiTypeObject  = "object"
+	apiTypeFlag    = "flag"
+)
+
+// Parameter of an API operation, in the request's path, query, or header.
+type apiParam struct {
+	Name string
+
+	// Where the parameter is, "path", "query", or "header"
+	In string
+
+	// Type the parameter's value must be, one of the apiType constants
+	Type string
+
+	// If the request must have the parameter. Path parameters always must.
+	Required bool
+
+	// Values the parameter is limited to, any if nil.
+	Enum []string
+
+	Description string
+}
+
+// Field of an API operation's JSON request body.
+type apiField struct {
+	Name string
+
+	// Type the field's value must be, one of the apiType constants
+	Type string
+
+	// Type of an array field's items, nil if not an array.
+	Items *apiField
+
+	// If the body must have the field, and it must not be null.
+	Required bool
+
+	Description string
+}
+
+// Request body of an API operation.
+type apiBody struct {
+	// Content type of the body
+	ContentType string
+
+	// Fields of a JSON object body. Only JSON bodies with fields are validated.
+	Fields []apiField
+
+	Description string
+}
+
+// Operation of the API, an HTTP method of a route. The operations describe the
+// API's OpenAPI document, and requests are validated against them before they
+// reach their handler.
+type apiOperation struct {
+	// Unique id of the operation, and its HTTP method
+	Id     string
+	Method string
+
+	// Path of the route relative to the API version's path, with the route's
+	// path parameters in braces, e.g: /status/{jobId}
+	Path string
+
+	Summary string
+	Params  []apiParam
+	Body    *apiBody
+
+	// Status code of the operation's successful response, 200 if not set, and
+	// of its v1 response if it differs.
+	Status   int
+	V1Status int
+
+	// If the operation is only served by v2
+	V2Only bool
+}
+
+// Path parameters shared by operations.
+var (
+	apiJobIdParam = apiParam{Name: "jobId", In: "path", Type: apiTypeInteger, Required: true, Description: "Id of the job"}
+	apiHostParam  = apiParam{Name: "host", In: "path", Type: apiTypeString, Required: true, Description: "Host name, e.g: www.example.com"}
+	apiKeyIdParam = apiParam{Name: "id", In: "path", Type: apiTypeInteger, Required: true, Description: "Id of the API key"}
+
+	apiRecurringJobIdParam = apiParam{Name: "recurringJobId", In: "path", Type: apiTypeInteger, Required: true, Description: "Id of the recurring job"}
+)
+
+// Query parameters of the options jobs are scheduled with.
+var apiJobOptionParams = []apiParam{
+	{Name: "forceCrawl", In: "query", Type: apiTypeFlag, Description: "Crawl the job's URLs even if they are cached"},
+	{Name: "delta", In: "query", Type: apiTypeFlag, Description: "Only follow the links of pages whose content changed"},
+	{Name: "noFetchCache", In: "query", Type: apiTypeFlag, Description: "Always fetch from the URL's host instead of the shared fetch cache"},
+	{Name: "skipAlternates", In: "query", Type: apiTypeFlag, Description: "Record, but don't crawl the alternates of pages"},
+	{Name: "download", In: "query", Type: apiTypeFlag, Description: "Download the job's URLs as files"},
+	{Name: "extractText", In: "query", Type: apiTypeFlag, Description: "Extract the main text content of the job's pages"},
+	{Name: "partial", In: "query", Type: apiTypeFlag, Description: "Reject invalid URLs instead of refusing the job"},
+	{Name: "window", In: "query", Type: apiTypeString, Description: "Hours of the day the job is crawled, HH:MM-HH:MM"},
+	{Name: "windowTZ", In: "query", Type: apiTypeString, Description: "IANA time zone of the crawl window"},
+	{Name: "tag", In: "query", Type: apiTypeString, Description: "Tag the job is listed by, may be repeated"},
+	{Name: "jsonLink", In: "query", Type: apiTypeString, Description: "JSONPath expression selecting the links to follow, may be repeated"},
+	{Name: "jsonField", In: "query", Type: apiTypeString, Description: "name=expression JSONPath field to store, may be repeated"},
+	{Name: "flag", In: "query", Type: apiTypeString, Description: "name=pattern flag pages are matched against, may be repeated"},
+	{Name: "keyword", In: "query", Type: apiTypeString, Description: "name=keyword flag pages are matched against, may be repeated"},
+	{Name: "onStatus", In: "query", Type: apiTypeString, Description: "status:action rule of how responses are handled, may be repeated"},
+	{Name: "priority", In: "query", Type: apiTypeString, Description: "Priority the job's URLs are dispatched with, low, normal, or high"},
+	{Name: "maxDepth", In: "query", Type: apiTypeInteger, Description: "Maximum distance from the job's URLs of the pages crawled"},
+	{Name: "maxURLs", In: "query", Type: apiTypeInteger, Description: "Most URLs the job crawls before it completes"},
+	{Name: "deadline", In: "query", Type: apiTypeString, Description: "RFC 3339 time after which the job's URLs are not crawled"},
+	{Name: "timeout", In: "query", Type: apiTypeString, Description: "Duration after which the job's URLs are not crawled, e.g: 2h"},
+	{Name: "include", In: "query", Type: apiTypeString, Description: "Glob, or 're:' prefixed regular expression the links queued must match one of, may be repeated"},
+	{Name: "exclude", In: "query", Type: apiTypeString, Description: "Glob, or 're:' prefixed regular expression of the links never queued, may be repeated"},
+	{Name: "scope", In: "query", Type: apiTypeString, Description: "Scope of the links crawled, relative to the job's URLs",
+		Enum: []string{common.JobScopeAny, common.JobScopeSameHost, common.JobScopeSubdomains, common.JobScopeSameDomain}},
+	{Name: "stripParams", In: "query", Type: apiTypeString, Description: "Query parameter stripped from links instead of the default tracking parameters, 'default', or 'none', may be repeated"},
+	{Name: "keepFragments", In: "query", Type: apiTypeFlag, Description: "Keep the fragments of links instead of stripping them"},
+}
+
+// Query parameters of the filter of a job's results.
+var apiResultFilterParams = []apiParam{
+	{Name: "mime", In: "query", Type: apiTypeString, Description: "Mime type of the results"},
+	{Name: "status", In: "query", Type: apiTypeInteger, Description: "HTTP status code of the results"},
+	{Name: "domain", In: "query", Type: apiTypeString, Description: "Domain of the results, including its sub domains"},
+	{Name: "tag", In: "query", Type: apiTypeString, Description: "Kind of content of the results"},
+	{Name: "flag", In: "query", Type: apiTypeString, Description: "Flag the results' content matched"},
+}
+
+// Returns the parameters joined into a single list.
+func apiParams(params ...[]apiParam) []apiParam {
+	joined := []apiParam{}
+	for _, p := range params {
+		joined = append(joined, p...)
+	}
+	return joined
+}
+
+// Operations of the API, in the order they are listed in the web server's
+// documentation.
+var apiOperations = []apiOperation{
+	{
+		Id: "scheduleJob", Method: "POST", Path: "/", Status: http.StatusCreated, V1Status: http.StatusOK,
+		Summary: "Schedule a job of the newline separated URLs of the body",
+		Params: apiParams(apiJobOptionParams, []apiParam{
+			{Name: "rejectOverlap", In: "query", Type: apiTypeFlag, Description: "Reject the job if it overlaps an active job"},
+			{Name: idempotencyKeyHeader, In: "header", Type: apiTypeString, Description: "Key the job is scheduled at most once with"},
+		}),
+		Body: &apiBody{ContentType: "text/plain", Description: "Newline separated URLs of the job"},
+	},
+	{
+		Id: "uploadJob", Method: "POST", Path: "/uploads", Status: http.StatusAccepted,
+		Summary: "Upload a seed list to be scheduled as a job in the background",
+		Params:  apiJobOptionParams,
+		Body:    &apiBody{ContentType: "text/plain", Description: "Newline separated URLs of the job"},
+	},
+	{
+		Id: "getUpload", Method: "GET", Path: "/uploads/{uploadId}",
+		Summary: "Get the status of an upload, and its job id once scheduled",
+		Params:  []apiParam{{Name: "uploadId", In: "path", Type: apiTypeInteger, Required: true, Description: "Id of the upload"}},
+	},
+	{
+		Id: "listRecurringJobs", Method: "GET", Path: "/recurring",
+		Summary: "List the recurring jobs",
+	},
+	{
+		Id: "createRecurringJob", Method: "POST", Path: "/recurring", Status: http.StatusCreated,
+		Summary: "Create a recurring job scheduling a job of the body's URLs each time its cron expression matches",
+		Params: apiParams([]apiParam{
+			{Name: "cron", In: "query", Type: apiTypeString, Required: true, Description: "Five field cron expression the jobs are scheduled by"},
+			{Name: "cronTZ", In: "query", Type: apiTypeString, Description: "IANA time zone of the cron expression, default UTC"},
+			{Name: "name", In: "query", Type: apiTypeString, Description: "Name describing the recurring job"},
+		}, apiJobOptionParams),
+		Body: &apiBody{ContentType: "text/plain", Description: "Newline separated URLs of each job"},
+	},
+	{
+		Id: "getRecurringJob", Method: "GET", Path: "/recurring/{recurringJobId}",
+		Summary: "Get a recurring job, and the last job it scheduled",
+		Params:  []apiParam{apiRecurringJobIdParam},
+	},
+	{
+		Id: "deleteRecurringJob", Method: "DELETE", Path: "/recurring/{recurringJobId}",
+		Summary: "Delete a recurring job, so it schedules no more jobs",
+		Params:  []apiParam{apiRecurringJobIdParam},
+	},
+	{
+		Id: "scheduleJobGroup", Method: "POST", Path: "/groups", Status: http.StatusCreated,
+		Summary: "Schedule multiple jobs as a named group",
+		Params:  apiJobOptionParams,
+		Body: &apiBody{ContentType: "application/json", Fields: []apiField{
+			{Name: "name", Type: apiTypeString, Required: true, Description: "Name of the group"},
+			{Name: "webhook", Type: apiTypeString, Description: "URL notified once all of the group's jobs complete"},
+			{Name: "jobs", Type: apiTypeArray, Required: true, Description: "URLs of each of the group's jobs",
+				Items: &apiField{Type: apiTypeArray, Items: &apiField{Type: apiTypeString}}},
+		}},
+	},
+	{
+		Id: "getJobGroup", Method: "GET", Path: "/groups/{groupId}",
+		Summary: "Get the status of a group, aggregated from the status of its jobs",
+		Params:  []apiParam{{Name: "groupId", In: "path", Type: apiTypeInteger, Required: true, Description: "Id of the group"}},
+	},
+	{
+		Id: "getJobStatus", Method: "GET", Path: "/status/{jobId}",
+		Summary: "Get the status of a job",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobResult", Method: "GET", Path: "/result/{jobId}",
+		Summary: "Get the result of a job, or a page of it continuing from the cursor",
+		Params: apiParams([]apiParam{apiJobIdParam}, apiResultFilterParams, []apiParam{
+			{Name: "limit", In: "query", Type: apiTypeInteger, Description: "Results of the page"},
+			{Name: "cursor", In: "query", Type: apiTypeString, Description: "Cursor of the page, returned by the previous page"},
+			{Name: "format", In: "query", Type: apiTypeString, Enum: []string{resultFormatJSON, resultFormatCSV}},
+			{Name: "scores", In: "query", Type: apiTypeFlag, Description: "Include the link scores of the results"},
+		}),
+	},
+	{
+		Id: "getJobFreshnessReport", Method: "GET", Path: "/report/freshness/{jobId}",
+		Summary: "Get the content freshness report of a job, grouped by host",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobThinContentReport", Method: "GET", Path: "/report/thin/{jobId}",
+		Summary: "Get the thin content report of a job's HTML pages",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "threshold", In: "query", Type: apiTypeInteger, Description: "Word count pages must be under to be thin"}},
+	},
+	{
+		Id: "getJobMimeMismatchReport", Method: "GET", Path: "/report/mime/{jobId}",
+		Summary: "Get the URLs of a job whose declared content type mismatched their sniffed content type",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobParseFailureReport", Method: "GET", Path: "/report/parse/{jobId}",
+		Summary: "Get the URLs of a job whose content failed to be parsed, or the raw content of one",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "url", In: "query", Type: apiTypeString, Description: "URL whose quarantined raw content is returned"}},
+	},
+	{
+		Id: "getJobPanicReport", Method: "GET", Path: "/report/panics/{jobId}",
+		Summary: "Get the panics the workers recovered from while crawling a job's URLs",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobUnattemptedReport", Method: "GET", Path: "/report/unattempted/{jobId}",
+		Summary: "Get the URLs a job never attempted because its deadline passed",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getDefaultURLStripping", Method: "GET", Path: "/stripping",
+		Summary: "Get the default tracking parameters stripped from the links of crawled pages",
+	},
+	{
+		Id: "getJobURLStripping", Method: "GET", Path: "/stripping/{jobId}",
+		Summary: "Get the query parameters, and fragments stripped from the links of a job's pages",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobHeadingsReport", Method: "GET", Path: "/report/headings/{jobId}",
+		Summary: "Get the duplicate and missing title, h1, and description report of a job's HTML pages",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobOrphansReport", Method: "GET", Path: "/report/orphans/{jobId}",
+		Summary: "Get the sitemap orphaned and uncharted pages report of a job",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "sitemap", In: "query", Type: apiTypeString, Description: "URL of a sitemap on one of the job's hosts, may be repeated"}},
+	},
+	{
+		Id: "getJobRobotsReport", Method: "GET", Path: "/report/robots/{jobId}",
+		Summary: "Get a suggested robots.txt for each host of a job",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "queryJob", Method: "GET", Path: "/query/{jobId}",
+		Summary: "Get the URLs of a job matching the filter expression",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "q", In: "query", Type: apiTypeString, Required: true, Description: "Filter expression"},
+			{Name: "limit", In: "query", Type: apiTypeInteger, Description: "Most URLs returned"}},
+	},
+	{
+		Id: "getJobJSONFields", Method: "GET", Path: "/jsonfields/{jobId}",
+		Summary: "Get the fields extracted by a job's JSONPath expressions",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "restoreJob", Method: "POST", Path: "/restore/{jobId}",
+		Summary: "Restore an archived job's bodies from the cold store into the database",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "pauseJob", Method: "POST", Path: "/job/{jobId}/pause",
+		Summary: "Pause a job",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "resumeJob", Method: "POST", Path: "/job/{jobId}/resume",
+		Summary: "Resume a paused job",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "pauseJobLegacy", Method: "POST", Path: "/pause/{jobId}",
+		Summary: "Pause a job, same as /job/{jobId}/pause",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "resumeJobLegacy", Method: "POST", Path: "/resume/{jobId}",
+		Summary: "Resume a paused job, same as /job/{jobId}/resume",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobArchive", Method: "GET", Path: "/job/{jobId}/archive",
+		Summary: "Export a job as a self-contained tarball",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "bodies", In: "query", Type: apiTypeFlag, Description: "Include the raw, and sanitized HTML stored for the job's URLs"}},
+	},
+	{
+		Id: "cancelJob", Method: "POST", Path: "/job/{jobId}/cancel",
+		Summary: "Cancel a job",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "flagJobUrgent", Method: "POST", Path: "/job/{jobId}/urgent",
+		Summary: "Flag a job as urgent. Requires the admin token",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "unflagJobUrgent", Method: "DELETE", Path: "/job/{jobId}/urgent",
+		Summary: "Unflag an urgent job. Requires the admin token",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobEvents", Method: "GET", Path: "/job/{jobId}/events",
+		Summary: "Stream a job's progress as Server-Sent Events",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "exportJob", Method: "POST", Path: "/job/{jobId}/export",
+		Summary: "Export a job's URLs crawled since it was previously exported to the destination",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "destination", In: "query", Type: apiTypeString, Required: true, Description: "Name of the destination"},
+			{Name: "full", In: "query", Type: apiTypeBoolean, Description: "Export all of the job's URLs"}},
+	},
+	{
+		Id: "getJobExports", Method: "GET", Path: "/job/{jobId}/export",
+		Summary: "Get the watermark of each destination a job has been exported to",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "exportJobResults", Method: "GET", Path: "/job/{jobId}/results/export",
+		Summary: "Stream a job's results as JSON Lines",
+		Params:  apiParams([]apiParam{apiJobIdParam}, apiResultFilterParams),
+	},
+	{
+		Id: "getJobFlags", Method: "GET", Path: "/job/{jobId}/flags",
+		Summary: "Get the flags of a job, and the URLs of its pages which matched each",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobManifest", Method: "GET", Path: "/job/{jobId}/manifest",
+		Summary: "Get the manifest of a download job's files",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "format", In: "query", Type: apiTypeString, Enum: []string{manifestFormatJSON, manifestFormatCSV, manifestFormatSHA256}}},
+	},
+	{
+		Id: "getJobBadge", Method: "GET", Path: "/job/{jobId}/badge.svg",
+		Summary: "Get an SVG badge of a job's state and completion percentage",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobSitemap", Method: "GET", Path: "/job/{jobId}/sitemap.xml",
+		Summary: "Get a sitemap of a job's crawled HTML pages",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "page", In: "query", Type: apiTypeInteger, Description: "Sitemap of the sitemap index"}},
+	},
+	{
+		Id: "getJobRedirects", Method: "GET", Path: "/job/{jobId}/redirects",
+		Summary: "Export a job's redirect map",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "format", In: "query", Type: apiTypeString, Enum: []string{redirectFormatCSV, redirectFormatNginx, redirectFormatApache}}},
+	},
+	{
+		Id: "getJobWARC", Method: "GET", Path: "/job/{jobId}/warc",
+		Summary: "Export the stored pages of a job as a gzip compressed WARC file",
+		Params:  []apiParam{apiJobIdParam},
+	},
+	{
+		Id: "getJobChunks", Method: "GET", Path: "/job/{jobId}/chunks",
+		Summary: "Stream the main text of a job's pages as JSON Lines of token counted chunks",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "size", In: "query", Type: apiTypeInteger, Description: "Maximum tokens of a chunk"},
+			{Name: "overlap", In: "query", Type: apiTypeInteger, Description: "Tokens each chunk repeats of the chunk before it"}},
+	},
+	{
+		Id: "getJobSimilar", Method: "GET", Path: "/job/{jobId}/similar",
+		Summary: "Search the embedded chunks of a job's pages for those most similar to the query text",
+		Params: []apiParam{apiJobIdParam,
+			{Name: "q", In: "query", Type: apiTypeString, Required: true, Description: "Query text"},
+			{Name: "limit", In: "query", Type: apiTypeInteger, Description: "Chunks returned"}},
+	},
+	{
+		Id: "getCrawlFeed", Method: "GET", Path: "/feed",
+		Summary: "Follow the crawls of all jobs, or a job, live over a WebSocket",
+		Params: []apiParam{
+			{Name: "job", In: "query", Type: apiTypeInteger, Description: "Id of the job"},
+			{Name: "domain", In: "query", Type: apiTypeString, Description: "Domain of the crawled URLs"}},
+	},
+	{
+		Id: "scheduleJobBatch", Method: "POST", Path: "/jobs/batch", Status: http.StatusCreated,
+		Summary: "Schedule multiple independent jobs at once, created in a single transaction",
+		Params:  apiJobOptionParams,
+		Body: &apiBody{ContentType: "application/json", Fields: []apiField{
+			{Name: "jobs", Type: apiTypeArray, Required: true, Description: "URLs of each of the batch's jobs",
+				Items: &apiField{Type: apiTypeArray, Items: &apiField{Type: apiTypeString}}},
+		}},
+	},
+	{
+		Id: "importJob", Method: "POST", Path: "/jobs/import",
+		Summary: "Import a job tarball exported by /job/{jobId}/archive as a new job",
+		Body:    &apiBody{ContentType: "application/gzip", Description: "Job tarball"},
+	},
+	{
+		Id: "listJobs", Method: "GET", Path: "/jobs",
+		Summary: "List the most recent jobs, and their progress",
+		Params: []apiParam{
+			{Name: "limit", In: "query", Type: apiTypeInteger, Description: "Jobs listed"},
+			{Name: "offset", In: "query", Type: apiTypeInteger, Description: "Jobs skipped"},
+			{Name: "status", In: "query", Type: apiTypeString,
+				Enum: []string{common.JobStatusRunning, common.JobStatusWaiting, common.JobStatusCompleted, common.JobStatusPaused, common.JobStatusCancelled}},
+			{Name: "createdAfter", In: "query", Type: apiTypeString, Description: "RFC 3339 time or date"},
+			{Name: "tag", In: "query", Type: apiTypeString, Description: "Tag the jobs listed must have, may be repeated"}},
+	},
+	{
+		Id: "getHostHistory", Method: "GET", Path: "/hosts/{host}/history",
+		Summary: "Get the crawl history of a host, summarized per job",
+		Params:  []apiParam{apiHostParam},
+	},
+	{
+		Id: "getHostWellKnown", Method: "GET", Path: "/hosts/{host}/wellknown",
+		Summary: "Get the well-known files found on a host",
+		Params:  []apiParam{apiHostParam},
+	},
+	{
+		Id: "getHostIdentity", Method: "GET", Path: "/hosts/{host}/identity",
+		Summary: "Get the site name and favicon information captured for a host",
+		Params:  []apiParam{apiHostParam},
+	},
+	{
+		Id: "getHostFavicon", Method: "GET", Path: "/hosts/{host}/favicon",
+		Summary: "Get the favicon image captured for a host",
+		Params:  []apiParam{apiHostParam},
+	},
+	{
+		Id: "getHostReputation", Method: "GET", Path: "/hosts/{host}/reputation",
+		Summary: "Get the reputation score of a host, and the anomalies detected in its recent crawls",
+		Params: []apiParam{apiHostParam,
+			{Name: "days", In: "query", Type: apiTypeInteger, Description: "Days of the host's crawls scored, default 30"}},
+	},
+	{
+		Id: "getHostOptOut", Method: "GET", Path: "/hosts/{host}/optout",
+		Summary: "Get a host's opt-out status, and verification token",
+		Params:  []apiParam{apiHostParam},
+	},
+	{
+		Id: "optOutHost", Method: "POST", Path: "/hosts/{host}/optout",
+		Summary: "Opt a host out of crawling",
+		Params:  []apiParam{apiHostParam},
+		Body: &apiBody{ContentType: "application/json", Fields: []apiField{
+			{Name: "reason", Type: apiTypeString, Required: true, Description: "Reason the host is opted out"},
+		}},
+	},
+	{
+		Id: "deleteHostOptOut", Method: "DELETE", Path: "/hosts/{host}/optout",
+		Summary: "Remove a host from the opt-out registry. Requires the admin token",
+		Params:  []apiParam{apiHostParam},
+	},
+	{
+		Id: "getURLHTML", Method: "GET", Path: "/html",
+		Summary: "Get the sanitized, or raw, HTML stored for a crawled URL",
+		Params: []apiParam{
+			{Name: "url", In: "query", Type: apiTypeString, Required: true, Description: "Crawled URL"},
+			{Name: "version", In: "query", Type: apiTypeString, Enum: []string{"sanitized", "raw"}}},
+	},
+	{
+		Id: "getURLSnapshot", Method: "GET", Path: "/snapshot",
+		Summary: "View a crawled URL's stored HTML, with its links rewritten",
+		Params:  []apiParam{{Name: "url", In: "query", Type: apiTypeString, Required: true, Description: "Crawled URL"}},
+	},
+	{
+		Id: "getURLText", Method: "GET", Path: "/text",
+		Summary: "Get the main text content extracted from a crawled URL",
+		Params: []apiParam{
+			{Name: "url", In: "query", Type: apiTypeString, Required: true, Description: "Crawled URL"},
+			{Name: "format", In: "query", Type: apiTypeString, Enum: []string{"json", "text"}}},
+	},
+	{
+		Id: "listOptOuts", Method: "GET", Path: "/optouts",
+		Summary: "List all hosts in the opt-out registry. Requires the admin token",
+	},
+	{
+		Id: "listAPIKeys", Method: "GET", Path: "/apikeys",
+		Summary: "List the API keys. Requires the admin token",
+	},
+	{
+		Id: "createAPIKey", Method: "POST", Path: "/apikeys", Status: http.StatusCreated,
+		Summary: "Create a new API key. Requires the admin token",
+		Body: &apiBody{ContentType: "application/json", Fields: []apiField{
+			{Name: "name", Type: apiTypeString, Required: true, Description: "Who, or what, the key is for"},
+		}},
+	},
+	{
+		Id: "getAPIKeyUsage", Method: "GET", Path: "/apikeys/usage",
+		Summary: "Get the monthly usage of the jobs scheduled with each API key. Requires the admin token",
+		Params: []apiParam{
+			{Name: "from", In: "query", Type: apiTypeString, Description: "First month, YYYY-MM"},
+			{Name: "to", In: "query", Type: apiTypeString, Description: "Last month, YYYY-MM"},
+			{Name: "apiKey", In: "query", Type: apiTypeInteger, Description: "Id of the API key"}},
+	},
+	{
+		Id: "enableAPIKey", Method: "POST", Path: "/apikeys/{id}/enable",
+		Summary: "Enable an API key. Requires the admin token",
+		Params:  []apiParam{apiKeyIdParam},
+	},
+	{
+		Id: "disableAPIKey", Method: "POST", Path: "/apikeys/{id}/disable",
+		Summary: "Disable an API key. Requires the admin token",
+		Params:  []apiParam{apiKeyIdParam},
+	},
+	{
+		Id: "revokeAPIKey", Method: "DELETE", Path: "/apikeys/{id}",
+		Summary: "Revoke an API key. Requires the admin token",
+		Params:  []apiParam{apiKeyIdParam},
+	},
+	{
+		Id: "getAPIKeyQuota", Method: "GET", Path: "/apikeys/{id}/quota",
+		Summary: "Get the monthly quota of an API key, and its usage. Requires the admin token",
+		Params:  []apiParam{apiKeyIdParam},
+	},
+	{
+		Id: "setAPIKeyQuota", Method: "PUT", Path: "/apikeys/{id}/quota",
+		Summary: "Set the monthly quota of an API key. Requires the admin token",
+		Params:  []apiParam{apiKeyIdParam},
+		Body: &apiBody{ContentType: "application/json", Fields: []apiField{
+			{Name: "urls", Type: apiTypeInteger, Description: "URLs the key's jobs can request a month, 0 for no limit"},
+			{Name: "bytes", Type: apiTypeInteger, Description: "Bytes the key's jobs can download a month, 0 for no limit"},
+			{Name: "jobs", Type: apiTypeInteger, Description: "Jobs which can be scheduled with the key a month, 0 for no limit"},
+			{Name: "webhook", Type: apiTypeString, Description: "URL notified as the key's usage crosses the thresholds"},
+		}},
+	},
+	{
+		Id: "deleteAPIKeyQuota", Method: "DELETE", Path: "/apikeys/{id}/quota",
+		Summary: "Remove the monthly quota of an API key. Requires the admin token",
+		Params:  []apiParam{apiKeyIdParam},
+	},
+	{
+		Id: "listFederatedJobs", Method: "GET", Path: "/federated/jobs", V2Only: true,
+		Summary: "List the most recent jobs of this instance and its peers",
+	},
+	{
+		Id: "getFederatedJobStatus", Method: "GET", Path: "/federated/status/{instance}/{jobId}", V2Only: true,
+		Summary: "Get the status of a job on this instance, or proxied from a peer",
+		Params: []apiParam{
+			{Name: "instance", In: "path", Type: apiTypeString, Required: true, Description: "Name of the instance"},
+			apiJobIdParam},
+	},
+}
+
+// Returns the OpenAPI 3 document of the API's operations served under the
+// root path. The operations are documented for each API version, and the
+// un-prefixed v1 operations are marked deprecated.
+func newOpenAPIDocument(root string, ops []apiOperation) map[string]interface{} {
+	paths := map[string]map[string]interface{}{}
+	for _, version := range []apiVersion{apiV1, apiV2} {
+		for _, op := range ops {
+			if op.V2Only && version != apiV2 {
+				continue
+			}
+
+			p := version.path("", strings.TrimPrefix(op.Path, "/"))
+			if paths[p] == nil {
+				paths[p] = map[string]interface{}{}
+			}
+			paths[p][strings.ToLower(op.Method)] = openAPIOperation(op, version)
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Harvester",
+			"version": apiV2.String(),
+			"description": "Schedules jobs of URLs to be crawled, and reports their status and results. " +
+				"v2 responses are wrapped in a {data, error, meta} envelope with snake_case field names.",
+		},
+		"servers": []interface{}{map[string]interface{}{"url": path.Join("/", root)}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"code":    map[string]interface{}{"type": "string"},
+						"message": map[string]interface{}{"type": "string"},
+					},
+				},
+			},
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{},
+			map[string]interface{}{"apiKey": []string{}},
+			map[string]interface{}{"bearer": []string{}},
+		},
+	}
+}
+
+// Returns the OpenAPI operation object of the operation for the API version.
+func openAPIOperation(op apiOperation, version apiVersion) map[string]interface{} {
+	status := op.Status
+	if version == apiV1 && op.V1Status != 0 {
+		status = op.V1Status
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	params := []interface{}{}
+	for _, p := range op.Params {
+		param := map[string]interface{}{
+			"name":     p.Name,
+			"in":       p.In,
+			"required": p.Required || p.In == "path",
+			"schema":   openAPISchema(p.Type, nil, p.Enum),
+		}
+		if p.Type == apiTypeFlag {
+			param["allowEmptyValue"] = true
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+
+	o := map[string]interface{}{
+		"operationId": op.Id,
+		"summary":     op.Summary,
+		"parameters":  params,
+		"responses": map[string]interface{}{
+			strconv.Itoa(status): map[string]interface{}{"description": http.StatusText(status)},
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{
+						"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+					},
+				},
+			},
+		},
+	}
+	if version == apiV1 {
+		o["operationId"] = op.Id + "V1"
+		o["deprecated"] = true
+	}
+
+	if op.Body != nil {
+		schema := map[string]interface{}{"type": "string"}
+		if op.Body.ContentType == "application/gzip" {
+			schema["format"] = "binary"
+		}
+		if len(op.Body.Fields) > 0 {
+			props, required := map[string]interface{}{}, []string{}
+			for _, f := range op.Body.Fields {
+				props[f.Name] = openAPISchema(f.Type, f.Items, nil)
+				if f.Description != "" {
+					props[f.Name].(map[string]interface{})["description"] = f.Description
+				}
+				if f.Required {
+					required = append(required, f.Name)
+				}
+			}
+			schema = map[string]interface{}{"type": "object", "properties": props, "required": required}
+		}
+		body := map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{op.Body.ContentType: map[string]interface{}{"schema": schema}},
+		}
+		if op.Body.Description != "" {
+			body["description"] = op.Body.Description
+		}
+		o["requestBody"] = body
+	}
+	return o
+}
+
+// Returns the JSON schema of the type, with the type of its items if an array.
+func openAPISchema(typ string, items *apiField, enum []string) map[string]interface{} {
+	if typ == apiTypeFlag {
+		typ = apiTypeBoolean
+	}
+	schema := map[string]interface{}{"type": typ}
+	if items != nil {
+		schema["items"] = openAPISchema(items.Type, items.Items, nil)
+	}
+	if enum != nil {
+		schema["enum"] = enum
+	}
+	return schema
+}
+
+// Serves the OpenAPI document of the API. Not versioned, the document describes
+// all versions of the API.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/openapi.json"
+//
+// Response:
+//	- Success: OpenAPI 3 document
+type OpenAPIHandler struct {
+	doc []byte
+}
+
+// Creates a handler serving the OpenAPI document of the API's operations served
+// under the root path.
+func NewOpenAPIHandler(root string) (*OpenAPIHandler, error) {
+	doc, err := json.Marshal(newOpenAPIDocument(root, apiOperations))
+	if err != nil {
+		return nil, err
+	}
+	return &OpenAPIHandler{doc: doc}, nil
+}
+
+func (h *OpenAPIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		apiV1.methodNotAllowed(w, "GET")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(h.doc); err != nil {
+		log.Println("routeOpenAPI failed to write document", err)
+	}
+}
+
+// Wraps the handler so requests of the API version's operations are validated
+// against the operation before reaching the handler. Requests with path, query,
+// or header parameters of the wrong type, missing required parameters, or JSON
+// bodies with fields of the wrong type, or missing required fields are refused
+// with 400. Requests which don't match an operation are passed to the handler
+// as is.
+func validateRequests(h http.Handler, version apiVersion, root string, ops []apiOperation) http.Handler {
+	prefix := strings.TrimSuffix(version.path(root, ""), "/")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, pathParams := matchAPIOperation(ops, version, r.Method, strings.TrimPrefix(r.URL.Path, prefix))
+		if op != nil {
+			if err := validateAPIRequest(op, pathParams, r); err != nil {
+				log.Println("validateRequests request invalid.", op.Id, err)
+				version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Returns the operation of the method matching the path relative to the API
+// version's path, and the values of the path's parameters. Nil is returned if
+// no operation matches.
+func matchAPIOperation(ops []apiOperation, version apiVersion, method, p string) (*apiOperation, map[string]string) {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i := range ops {
+		op := &ops[i]
+		if op.Method != method || (op.V2Only && version != apiV2) {
+			continue
+		}
+
+		opSegments := strings.Split(strings.Trim(op.Path, "/"), "/")
+		if len(opSegments) != len(segments) {
+			continue
+		}
+		params := map[string]string{}
+		for j, s := range opSegments {
+			if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") && segments[j] != "" {
+				params[s[1:len(s)-1]] = segments[j]
+			} else if s != segments[j] {
+				params = nil
+				break
+			}
+		}
+		if params != nil {
+			return op, params
+		}
+	}
+	return nil, nil
+}
+
+// Validates the request's parameters, and JSON body against the operation.
+// The body is restored to be read by the operation's handler.
+func validateAPIRequest(op *apiOperation, pathParams map[string]string, r *http.Request) error {
+	query := r.URL.Query()
+	for _, p := range op.Params {
+		var values []string
+		switch p.In {
+		case "path":
+			values = []string{pathParams[p.Name]}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header[http.CanonicalHeaderKey(p.Name)]
+		}
+
+		if len(values) == 0 {
+			if p.Required {
+				return fmt.Errorf("Missing required %s parameter %s", p.In, p.Name)
+			}
+			continue
+		}
+		for _, v := range values {
+			// Same as the handlers, empty values are treated as not set.
+			if v == "" {
+				continue
+			}
+			if err := validateAPIParam(p, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	if op.Body == nil || len(op.Body.Fields) == 0 || r.Body == nil {
+		return nil
+	}
+	return validateAPIBody(op.Body, r)
+}
+
+// Validates the value is of the parameter's type, and one of its values.
+func validateAPIParam(p apiParam, v string) error {
+	switch p.Type {
+	case apiTypeFlag:
+		return nil
+	case apiTypeInteger:
+		if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+			return fmt.Errorf("Invalid %s: %s, must be an integer", p.Name, v)
+		}
+	case apiTypeBoolean:
+		if _, err := strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("Invalid %s: %s, must be true or false", p.Name, v)
+		}
+	}
+
+	if p.Enum != nil {
+		for _, e := range p.Enum {
+			if v == e {
+				return nil
+			}
+		}
+		return fmt.Errorf("Invalid %s: %s, must be one of %s", p.Name, v, strings.Join(p.Enum, ", "))
+	}
+	return nil
+}
+
+// Validates the request's JSON body has the body's required fields, and its
+// fields are of their types. Bodies larger than maxValidatedBodySize are not
+// validated. The body read is restored to be read by the operation's handler.
+func validateAPIBody(body *apiBody, r *http.Request) error {
+	buf, err := ioutil.ReadAll(io.LimitReader(r.Body, maxValidatedBodySize+1))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if err != nil || len(buf) > maxValidatedBodySize {
+		// Failed, and oversized bodies are reported by their handler
+		return nil
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return fmt.Errorf("Invalid request body, must be a JSON object")
+	}
+	for _, f := range body.Fields {
+		v, ok := fields[f.Name]
+		if !ok || v == nil {
+			if f.Required {
+				return fmt.Errorf("Invalid request body, missing required field %s", f.Name)
+			}
+			continue
+		}
+		if !validAPIFieldType(f, v) {
+			return fmt.Errorf("Invalid request body, field %s must be %s", f.Name, apiFieldTypeName(f))
+		}
+	}
+	return nil
+}
+
+// Returns true if the decoded JSON value is of the field's type.
+func validAPIFieldType(f apiField, v interface{}) bool {
+	switch f.Type {
+	case apiTypeString:
+		_, ok := v.(string)
+		return ok
+	case apiTypeInteger:
+		n, ok := v.(float64)
+		return ok && n == math.Trunc(n)
+	case apiTypeBoolean:
+		_, ok := v.(bool)
+		return ok
+	case apiTypeObject:
+		_, ok := v.(map[string]interface{})
+		return ok
+	case apiTypeArray:
+		items, ok := v.([]interface{})
+		if !ok {
+			return false
+		}
+		if f.Items != nil {
+			for _, item := range items {
+				if !validAPIFieldType(*f.Items, item) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return true
+}
+
+// Returns the description of the field's type, e.g: "an array of strings".
+func apiFieldTypeName(f apiField) string {
+	switch f.Type {
+	case apiTypeArray, apiTypeInteger, apiTypeObject:
+		return "an " + apiFieldTypeNoun(f, false)
+	default:
+		return "a " + apiFieldTypeNoun(f, false)
+	}
+}
+
+// Returns the noun of the field's type, plural if set, including the types of
+// an array's items.
+func apiFieldTypeNoun(f apiField, plural bool) string {
+	noun := f.Type
+	if plural {
+		noun += "s"
+	}
+	if f.Type == apiTypeArray && f.Items != nil {
+		noun += " of " + apiFieldTypeNoun(*f.Items, true)
+	}
+	return noun
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := newOpenAPIDocument("harvester", apiOperations)
+	assert.Equal(t, "3.0.3", doc["openapi"], "Expect OpenAPI 3 document")
+	assert.Equal(t, []interface{}{map[string]interface{}{"url": "/harvester"}}, doc["servers"], "Expect root path server")
+
+	paths := doc["paths"].(map[string]map[string]interface{})
+	for _, p := range []string{"/", "/v2", "/status/{jobId}", "/v2/status/{jobId}", "/v2/federated/jobs"} {
+		assert.Contains(t, paths, p, "Expect path documented")
+	}
+	assert.NotContains(t, paths, "/federated/jobs", "Expect v2 only path not documented for v1")
+
+	v1 := paths["/"]["post"].(map[string]interface{})
+	assert.Equal(t, "scheduleJobV1", v1["operationId"], "Expect v1 operation id")
+	assert.Equal(t, true, v1["deprecated"], "Expect v1 deprecated")
+	assert.Contains(t, v1["responses"], "200", "Expect v1 status")
+	v2 := paths["/v2"]["post"].(map[string]interface{})
+	assert.Contains(t, v2["responses"], "201", "Expect v2 status")
+
+	ids := map[string]bool{}
+	for _, methods := range paths {
+		for _, o := range methods {
+			id := o.(map[string]interface{})["operationId"].(string)
+			assert.False(t, ids[id], "Expect unique operation id %s", id)
+			ids[id] = true
+		}
+	}
+
+	_, err := NewOpenAPIHandler("")
+	assert.NoError(t, err, "Expect document marshaled")
+}
+
+func TestValidateRequests(t *testing.T) {
+	var body string
+	h := validateRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		w.WriteHeader(http.StatusOK)
+	}), apiV2, "", apiOperations)
+
+	cases := []struct {
+		method, url, body string
+		status            int
+	}{
+		{"GET", "/v2/status/1234", "", http.StatusOK},
+		{"GET", "/v2/status/abc", "", http.StatusBadRequest},
+		{"GET", "/v2/result/1234?limit=10&format=csv&forceCrawl", "", http.StatusOK},
+		{"GET", "/v2/result/1234?limit=ten", "", http.StatusBadRequest},
+		{"GET", "/v2/result/1234?format=xml", "", http.StatusBadRequest},
+		{"GET", "/v2/result/1234?limit=", "", http.StatusOK},
+		{"GET", "/v2/query/1234", "", http.StatusBadRequest},
+		{"POST", "/v2/job/1234/export?destination=s3&full=yes", "", http.StatusBadRequest},
+		{"POST", "/v2/groups", `{"name": "g", "jobs": [["http://example.com"]]}`, http.StatusOK},
+		{"POST", "/v2/groups", `{"name": "g", "jobs": [[1]]}`, http.StatusBadRequest},
+		{"POST", "/v2/groups", `{"jobs": [["http://example.com"]]}`, http.StatusBadRequest},
+		{"POST", "/v2/groups", `[]`, http.StatusBadRequest},
+		{"PUT", "/v2/apikeys/12/quota", `{"urls": 1.5}`, http.StatusBadRequest},
+		{"GET", "/v2/unknown/abc", "", http.StatusOK},
+	}
+
+	for i, c := range cases {
+		body = ""
+		r, _ := http.NewRequest(c.method, c.url, strings.NewReader(c.body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, c.status, w.Code, "Case %d: %s %s, %s", i, c.method, c.url, w.Body.String())
+		if c.status == http.StatusOK {
+			assert.Equal(t, c.body, body, "Case %d: expect body restored", i)
+		}
+	}
+}
+
+func TestAPIFieldTypeName(t *testing.T) {
+	f := apiField{Type: apiTypeArray, Items: &apiField{Type: apiTypeArray, Items: &apiField{Type: apiTypeString}}}
+	assert.Equal(t, "an array of arrays of strings", apiFieldTypeName(f))
+	assert.Equal(t, "an integer", apiFieldTypeName(apiField{Type: apiTypeInteger}))
+}
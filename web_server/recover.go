@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/errreport"
+	"log"
+	"net/http"
+	"runtime/debug"
+)
+
+// Wraps the handler so a panic while serving a request is recovered from,
+// instead of dropping the client's connection. The panic is logged with its
+// stack, counted by the route, and reported if configured, and the client is
+// responded an internal error. Panics aborting the handler, see
+// http.ErrAbortHandler, are let through.
+func recoverPanics(h http.Handler, version apiVersion, route string, reporter *errreport.Reporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			stack := debug.Stack()
+			log.Printf("Recovered from panic serving %s %s: %v\n%s", r.Method, r.URL.Path, rec, stack)
+			reporter.Panic(route, rec, stack, map[string]string{
+				"method": r.Method,
+				"path":   r.URL.Path,
+			})
+
+			// The response can't be replaced if the handler already wrote
+			// its header, the client only receives what was written.
+			version.writeError(w, "InternalError", "Failed to process request", http.StatusInternalServerError)
+		}()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Serves the counts of the panics recovered from by route, as JSON, on its
+// own address so they aren't served publicly with the API.
+func servePanicMetrics(addr string, reporter *errreport.Reporter) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/vars", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, "{\"panics\": %s}\n", reporter.Panics())
+	})
+	return http.ListenAndServe(addr, mux)
+}
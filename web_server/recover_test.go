@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jasdel/harvester/internal/errreport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	reporter, err := errreport.New(errreport.Config{}, "web_server")
+	require.NoError(t, err)
+
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}), apiV2, "/v2/status/", reporter)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/v2/status/1", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	var rsp apiEnvelope
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rsp))
+	require.NotNil(t, rsp.Error)
+	assert.Equal(t, "InternalError", rsp.Error.Code)
+
+	counts := reporter.Panics().Snapshot()
+	assert.Equal(t, int64(1), counts.Total)
+	assert.Equal(t, int64(1), counts.Labels["/v2/status/"], "Expect panic counted by route")
+}
+
+func TestRecoverPanicsAbortHandler(t *testing.T) {
+	h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}), apiV1, "/status/", nil)
+
+	assert.Panics(t, func() {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/status/1", nil))
+	}, "Expect aborted handlers not recovered")
+}
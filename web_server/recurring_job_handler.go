@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Interval recurring jobs are checked for runs which are due. Cron schedules
+// match whole minutes, so runs are scheduled within this of their time.
+const recurringJobInterval = 30 * time.Second
+
+// Query parameters of a recurring job create request which describe the
+// recurring job, instead of the options of its jobs.
+var recurringJobParams = []string{"cron", "cronTZ", "name", "partial"}
+
+// Handles the requests to list the recurring jobs, and create a new recurring
+// job, which schedules a job with the same URLs and options each time its cron
+// expression matches.
+//
+// GET lists all recurring jobs, with when each will next schedule a job, and
+// the last job it scheduled.
+//
+// POST creates a recurring job. The body is the same as JobScheduleHandler's,
+// and is validated the same way when created. The 'cron' query parameter is a
+// five field cron expression, e.g: "0 3 * * *" for 03:00 every day, in the IANA
+// time zone of the optional 'cronTZ' parameter, UTC by default. The 'name'
+// parameter describes the recurring job. All other query parameters are the
+// options of the schedule job API each job is scheduled with, except for the
+// 'deadline' parameter, since each job's 'timeout' is from when it is scheduled.
+// Hosts which have opted out by the time a job is scheduled are left out of the
+// job.
+//
+// Jobs are scheduled by the web server in the background. If no web server is
+// running when a run is due, only the latest missed run is scheduled once one
+// is, instead of all missed runs. Recurring jobs whose API key was revoked,
+// disabled, or exceeded its quota by the time a run is due are disabled.
+//
+// e.g:
+// curl -X POST --data-binary @- "http://localhost:8080/recurring?cron=0+3+*+*+*&cronTZ=Europe/Berlin&name=nightly&forceCrawl" << EOF
+// http://example.com
+// EOF
+//
+// Response:
+//	- Success: {id: 7, name: "nightly", cron: "0 3 * * *", cronTZ: "Europe/Berlin", urls: ["http://example.com"], options: "forceCrawl=", createdOn: <time>, nextRunOn: <time>, lastRunOn: <time>, lastJobId: 0}
+//	- Failure: {code: <code>, message: <message>}
+type RecurringJobListHandler struct {
+	// Validates the recurring job's URLs
+	scheduler *JobScheduleHandler
+
+	sc       *storage.Client
+	rootPath string
+	version  apiVersion
+}
+
+func (h *RecurringJobListHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		h.version.methodNotAllowed(w, "GET, POST")
+		return
+	}
+
+	if r.Method == "POST" {
+		h.serveCreate(w, r)
+		return
+	}
+
+	jobs, err := h.sc.RecurringJobClient().List()
+	if err != nil {
+		log.Println("routeRecurringJobList request list recurring jobs failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to list recurring jobs", http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, struct {
+		RecurringJobs []common.RecurringJob `json:"recurringJobs"`
+	}{RecurringJobs: jobs}, http.StatusOK)
+}
+
+// Creates a recurring job of the request's cron expression, and URLs.
+func (h *RecurringJobListHandler) serveCreate(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	schedule, err := common.ParseCronSchedule(query.Get("cron"), query.Get("cronTZ"))
+	if err != nil {
+		log.Println("routeRecurringJobList request invalid cron.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now().UTC()
+	next := schedule.Next(now)
+	if next.IsZero() {
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Cron expression %s never matches", schedule), http.StatusBadRequest)
+		return
+	}
+
+	opts, errMsg := getRequestedJobOptions(query)
+	if errMsg != nil {
+		log.Println("routeRecurringJobList request invalid options", errMsg)
+		h.version.writeError(w, "BadRequest", errMsg.Short(), http.StatusBadRequest)
+		return
+	}
+	if opts.download {
+		h.version.writeError(w, "BadRequest", "Download jobs can not be recurring", http.StatusBadRequest)
+		return
+	}
+	if query.Get("deadline") != "" {
+		// Each job would have the same deadline, which only the first can meet.
+		h.version.writeError(w, "BadRequest", "Recurring jobs can not have a deadline, use timeout instead", http.StatusBadRequest)
+		return
+	}
+	partial, partialErr := queryFlag(query, "partial")
+	if partialErr != nil {
+		log.Println("routeRecurringJobList request invalid partial", partialErr)
+		h.version.writeError(w, "BadRequest", partialErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	body := r.Body
+	if h.scheduler.maxBodySize > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.scheduler.maxBodySize)
+	}
+	requested, errMsg := getRequestedJobURLs(body, partial, false, h.scheduler.maxURLs)
+	if errMsg != nil {
+		log.Println("routeRecurringJobList request parse failed", errMsg)
+		code, status := requestErrorStatus(errMsg)
+		h.version.writeError(w, code, errMsg.Short(), status)
+		return
+	}
+
+	if optOut, errMsg := h.scheduler.rejectOptedOut(requested, partial); errMsg != nil {
+		log.Println("routeRecurringJobList request opt out check failed.", errMsg)
+		h.version.writeError(w, "DependancyFailure", errMsg.Short(), http.StatusInternalServerError)
+		return
+	} else if optOut != nil {
+		log.Println("routeRecurringJobList rejected opted out host", optOut.Host, "reason:", optOut.Reason)
+		h.version.writeError(w, "Forbidden", optedOutReason(optOut), http.StatusForbidden)
+		return
+	}
+	if len(requested.urls) == 0 {
+		h.version.writeError(w, "BadRequest", "No valid URLs provided", http.StatusBadRequest)
+		return
+	}
+
+	rj, err := h.sc.RecurringJobClient().Create(common.RecurringJob{
+		Name:      query.Get("name"),
+		Cron:      schedule.String(),
+		CronTZ:    schedule.Location.String(),
+		URLs:      requested.urls,
+		Options:   recurringJobOptions(query),
+		APIKeyId:  requestAPIKeyId(r),
+		NextRunOn: next,
+	})
+	if err != nil {
+		log.Println("routeRecurringJobList request create recurring job failed.", err)
+		h.version.writeError(w, "DependancyFailure", "Failed to create recurring job", http.StatusInternalServerError)
+		return
+	}
+	log.Println("routeRecurringJobList recurring job created", rj.Id, "next run on", rj.NextRunOn)
+
+	w.Header().Set("Location", h.version.path(h.rootPath, fmt.Sprintf("recurring/%d", rj.Id)))
+	h.version.writeData(w, rj, http.StatusCreated)
+}
+
+// Returns the query parameters of the job options, without those describing
+// the recurring job itself, encoded as they are stored.
+func recurringJobOptions(query url.Values) string {
+	opts := url.Values{}
+	for k, v := range query {
+		opts[k] = v
+	}
+	for _, k := range recurringJobParams {
+		delete(opts, k)
+	}
+	return opts.Encode()
+}
+
+// Handles the requests to get, and delete a recurring job. Deleting a recurring
+// job stops it from scheduling any more jobs, the jobs it already scheduled are
+// not affected. A recurring job which does not exist is responded to with a 404.
+//
+// e.g:
+// curl -X DELETE "http://localhost:8080/recurring/7"
+//
+// Response:
+//	- Success: {id: 7, deleted: true}
+//	- Failure: {code: <code>, message: <message>}
+type RecurringJobHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *RecurringJobHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "DELETE" {
+		h.version.methodNotAllowed(w, "GET, DELETE")
+		return
+	}
+
+	id, err := strconv.ParseInt(path.Base(r.URL.Path), 10, 64)
+	if err != nil || id <= 0 {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Invalid recurring job id %s", path.Base(r.URL.Path)), http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "DELETE" {
+		deleted, err := h.sc.RecurringJobClient().Delete(id)
+		if err != nil {
+			log.Println("routeRecurringJob request delete recurring job failed.", id, err)
+			h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to delete recurring job %d", id), http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			h.version.writeError(w, "NotFound", fmt.Sprintf("Recurring job %d does not exist", id), http.StatusNotFound)
+			return
+		}
+		log.Println("routeRecurringJob recurring job deleted", id)
+
+		h.version.writeData(w, struct {
+			Id      int64 `json:"id"`
+			Deleted bool  `json:"deleted"`
+		}{Id: id, Deleted: true}, http.StatusOK)
+		return
+	}
+
+	rj, err := h.sc.RecurringJobClient().Get(id)
+	if err != nil {
+		log.Println("routeRecurringJob request get recurring job failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get recurring job %d", id), http.StatusInternalServerError)
+		return
+	}
+	if rj == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Recurring job %d does not exist", id), http.StatusNotFound)
+		return
+	}
+
+	h.version.writeData(w, rj, http.StatusOK)
+}
+
+// Periodically schedules the jobs of the recurring jobs which are due. Blocks
+// forever, and is expected to be run in its own go routine.
+func runRecurringJobs(scheduler *JobScheduleHandler, interval time.Duration) {
+	for {
+		if err := scheduleRecurringJobs(scheduler, time.Now().UTC()); err != nil {
+			log.Println("runRecurringJobs: failed to schedule recurring jobs.", err)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// Schedules a job of each recurring job due at the time. Each run is claimed
+// before its job is scheduled, so web servers running concurrently only
+// schedule it once.
+func scheduleRecurringJobs(h *JobScheduleHandler, now time.Time) error {
+	due, err := h.sc.RecurringJobClient().Due(now)
+	if err != nil {
+		return err
+	}
+
+	for _, rj := range due {
+		schedule, err := common.ParseCronSchedule(rj.Cron, rj.CronTZ)
+		if err != nil {
+			log.Println("scheduleRecurringJobs: recurring job", rj.Id, "has invalid schedule.", err)
+			continue
+		}
+
+		// Runs missed while no web server was running are skipped, by
+		// moving the next run after the current time.
+		next := schedule.Next(now)
+		if next.IsZero() {
+			log.Println("scheduleRecurringJobs: recurring job", rj.Id, "never matches again, deleting it")
+			if _, err := h.sc.RecurringJobClient().Delete(rj.Id); err != nil {
+				return err
+			}
+			continue
+		}
+		claimed, err := h.sc.RecurringJobClient().Claim(rj.Id, rj.NextRunOn, next)
+		if err != nil {
+			return err
+		} else if !claimed {
+			continue
+		}
+
+		// Recurring jobs whose API key can no longer schedule jobs are
+		// disabled, instead of scheduling jobs on the key's behalf.
+		if reason, err := h.recurringJobRefused(rj, now); err != nil {
+			log.Println("scheduleRecurringJobs: recurring job", rj.Id, "failed to check API key.", err)
+			continue
+		} else if reason != "" {
+			log.Println("scheduleRecurringJobs: disabling recurring job", rj.Id, reason)
+			if _, err := h.sc.RecurringJobClient().Disable(rj.Id, reason, now); err != nil {
+				return err
+			}
+			continue
+		}
+
+		id, errMsg := h.scheduleRecurringJob(rj)
+		if errMsg != nil {
+			log.Println("scheduleRecurringJobs: recurring job", rj.Id, "failed to schedule job.", errMsg)
+			continue
+		}
+		if err := h.sc.RecurringJobClient().SetLastRun(rj.Id, id, now); err != nil {
+			return err
+		}
+		log.Println("scheduleRecurringJobs: recurring job", rj.Id, "scheduled job", id)
+	}
+	return nil
+}
+
+// Returns why the recurring job's API key may no longer schedule its jobs, the
+// key was revoked, disabled, or exceeded its quota. Empty if the key may, or
+// the recurring job has no key.
+func (h *JobScheduleHandler) recurringJobRefused(rj common.RecurringJob, now time.Time) (string, error) {
+	if rj.APIKeyId == 0 {
+		return "", nil
+	}
+
+	key, err := h.sc.APIKeyClient().Get(rj.APIKeyId)
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		return fmt.Sprintf("API key %d was revoked", rj.APIKeyId), nil
+	}
+	if !key.Enabled {
+		return fmt.Sprintf("API key %d is disabled", rj.APIKeyId), nil
+	}
+	return quotaExceeded(h.sc, rj.APIKeyId, now, 1)
+}
+
+// Schedules a job of the recurring job's URLs, and options. URLs whose hosts
+// have opted out since the recurring job was created are left out.
+func (h *JobScheduleHandler) scheduleRecurringJob(rj common.RecurringJob) (common.JobId, *ErroMsg) {
+	query, err := url.ParseQuery(rj.Options)
+	if err != nil {
+		return common.InvalidId, &ErroMsg{
+			Source: "JobScheduleHandler.scheduleRecurringJob",
+			Info:   fmt.Sprintf("Invalid recurring job %d options", rj.Id),
+			Err:    err,
+		}
+	}
+	opts, errMsg := getRequestedJobOptions(query)
+	if errMsg != nil {
+		return common.InvalidId, errMsg
+	}
+	opts.apiKeyId = rj.APIKeyId
+
+	requested := newRequestedJobURLs()
+	requested.urls = rj.URLs
+	if _, errMsg := h.rejectOptedOut(requested, true); errMsg != nil {
+		return common.InvalidId, errMsg
+	}
+	if len(requested.urls) == 0 {
+		return common.InvalidId, &ErroMsg{
+			Source: "JobScheduleHandler.scheduleRecurringJob",
+			Info:   fmt.Sprintf("All of recurring job %d URLs' hosts have opted out", rj.Id),
+		}
+	}
+
+	return h.scheduleJob(requested.urls, nil, opts)
+}
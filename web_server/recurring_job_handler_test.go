@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+func TestRecurringJobOptions(t *testing.T) {
+	query, err := url.ParseQuery("cron=0+3+*+*+*&cronTZ=Europe/Berlin&name=nightly&partial&forceCrawl&tag=b&tag=a&window=22:00-04:00")
+	require.NoError(t, err)
+
+	opts := recurringJobOptions(query)
+	assert.Equal(t, "forceCrawl=&tag=b&tag=a&window=22%3A00-04%3A00", opts, "Expect only the job options stored")
+
+	stored, err := url.ParseQuery(opts)
+	require.NoError(t, err)
+	jobOpts, errMsg := getRequestedJobOptions(stored)
+	require.Nil(t, errMsg)
+	assert.True(t, jobOpts.forceCrawl)
+	assert.Equal(t, []string{"b", "a"}, jobOpts.tags, "Expect stored options parsed as scheduled")
+	assert.NotNil(t, jobOpts.window)
+
+	assert.Equal(t, "", recurringJobOptions(url.Values{"cron": {"@daily"}}), "Expect no options")
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interval idle clients are removed from the schedule limiter at.
+const scheduleLimitPruneInterval = time.Minute
+
+// Configuration of the rate each client can schedule jobs at. Clients are
+// identified by the API key their requests are authorized by, or their IP
+// address if requests are not authorized by a key.
+type ScheduleLimitConfig struct {
+	// Jobs each client can schedule per minute. Not limited if not set.
+	PerMinute float64 `json:"perMinute"`
+
+	// Jobs a client can schedule at once, before being limited to the rate.
+	// Defaults to the per minute rate, rounded up.
+	Burst int `json:"burst"`
+
+	// If the client IP is the last address of the X-Forwarded-For header,
+	// instead of the address the request was received from. Only set when
+	// the web server is behind a reverse proxy appending the header.
+	TrustForwardedFor bool `json:"trustForwardedFor"`
+}
+
+// Validates the configuration, and sets the burst if not set.
+func (c *ScheduleLimitConfig) setDefaults() error {
+	if c.PerMinute < 0 {
+		return fmt.Errorf("Invalid scheduleLimit perMinute %v, must be positive", c.PerMinute)
+	}
+	if c.Burst < 0 {
+		return fmt.Errorf("Invalid scheduleLimit burst %d, must be positive", c.Burst)
+	}
+	if c.Burst == 0 {
+		c.Burst = int(math.Ceil(c.PerMinute))
+	}
+	return nil
+}
+
+// Token bucket of a client's schedule requests.
+type scheduleBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limits the rate each client can schedule jobs at, so a single client can't
+// flood the scheduler, and starve other clients.
+type scheduleLimiter struct {
+	// Tokens added to each client's bucket per second
+	rate float64
+
+	// Maximum tokens of a client's bucket
+	burst float64
+
+	trustForwardedFor bool
+
+	// Returns the current time, replaced by tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	buckets  map[string]*scheduleBucket
+	prunedOn time.Time
+}
+
+// Creates the limiter of the configuration. Nil is returned if scheduling
+// is not limited.
+func newScheduleLimiter(cfg ScheduleLimitConfig) *scheduleLimiter {
+	if cfg.PerMinute <= 0 {
+		return nil
+	}
+	return &scheduleLimiter{
+		rate:              cfg.PerMinute / 60,
+		burst:             math.Max(1, float64(cfg.Burst)),
+		trustForwardedFor: cfg.TrustForwardedFor,
+		now:               time.Now,
+		buckets:           map[string]*scheduleBucket{},
+	}
+}
+
+// Returns true if the request's client can schedule the number of jobs. If
+// not the time until the client can schedule them is returned. Requests are
+// always allowed by a nil limiter.
+func (l *scheduleLimiter) allow(r *http.Request, jobs int) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	client := l.client(r)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &scheduleBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	n := float64(jobs)
+	if b.tokens < n {
+		return false, time.Duration((n - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens -= n
+	return true, 0
+}
+
+// Removes the buckets of clients which have refilled, since they are the same
+// as the buckets of new clients. Expects the lock to be held.
+func (l *scheduleLimiter) prune(now time.Time) {
+	if now.Sub(l.prunedOn) < scheduleLimitPruneInterval {
+		return
+	}
+	l.prunedOn = now
+
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// Returns the client the request is limited as, the API key the request was
+// authorized by, or the client's IP address.
+func (l *scheduleLimiter) client(r *http.Request) string {
+	if id := requestAPIKeyId(r); id != 0 {
+		return "key:" + strconv.FormatInt(id, 10)
+	}
+
+	if l.trustForwardedFor {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			addrs := strings.Split(fwd, ",")
+			return "ip:" + strings.TrimSpace(addrs[len(addrs)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// Refuses the request with 429 if the request's client would schedule the
+// number of jobs over its rate, and returns false. The Retry-After header is
+// set to when the client can schedule them. Requests scheduling more jobs than
+// the burst can never be allowed, and are refused with 400.
+func (l *scheduleLimiter) check(w http.ResponseWriter, r *http.Request, version apiVersion, jobs int) bool {
+	if l != nil && float64(jobs) > l.burst {
+		version.writeError(w, "BadRequest",
+			fmt.Sprintf("Too many jobs scheduled at once, %d, at most %d are allowed", jobs, int(l.burst)), http.StatusBadRequest)
+		return false
+	}
+
+	ok, wait := l.allow(r, jobs)
+	if ok {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	version.writeError(w, "TooManyRequests",
+		fmt.Sprintf("Too many jobs scheduled, retry after %d seconds", retryAfter), http.StatusTooManyRequests)
+	return false
+}
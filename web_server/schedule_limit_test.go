@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestScheduleLimiter(t *testing.T) {
+	cfg := ScheduleLimitConfig{PerMinute: 6}
+	assert.NoError(t, cfg.setDefaults(), "Expect valid config")
+	assert.Equal(t, 6, cfg.Burst, "Expect burst of the per minute rate")
+
+	now := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	cfg.Burst = 2
+	l := newScheduleLimiter(cfg)
+	l.now = func() time.Time { return now }
+
+	request := func(remoteAddr string) *http.Request {
+		r, _ := http.NewRequest("POST", "/", nil)
+		r.RemoteAddr = remoteAddr
+		return r
+	}
+
+	for i := 0; i < 2; i++ {
+		ok, _ := l.allow(request("10.0.0.1:1234"), 1)
+		assert.True(t, ok, "Expect burst allowed")
+	}
+	ok, wait := l.allow(request("10.0.0.1:4321"), 1)
+	assert.False(t, ok, "Expect client over rate refused")
+	assert.Equal(t, 10*time.Second, wait, "Expect wait until next token")
+
+	ok, _ = l.allow(request("10.0.0.2:1234"), 1)
+	assert.True(t, ok, "Expect other client allowed")
+
+	now = now.Add(10 * time.Second)
+	ok, _ = l.allow(request("10.0.0.1:1234"), 1)
+	assert.True(t, ok, "Expect client allowed once refilled")
+
+	// Clients authorized by an API key are limited by key, not address.
+	keyed := request("10.0.0.1:1234")
+	keyed = keyed.WithContext(context.WithValue(keyed.Context(), apiKeyContextKey{}, &common.APIKey{Id: 7}))
+	assert.Equal(t, "key:7", l.client(keyed), "Expect client of API key")
+
+	fwd := request("10.0.0.9:1234")
+	fwd.Header.Set("X-Forwarded-For", "1.2.3.4, 5.6.7.8")
+	assert.Equal(t, "ip:10.0.0.9", l.client(fwd), "Expect forwarded header not trusted")
+	l.trustForwardedFor = true
+	assert.Equal(t, "ip:5.6.7.8", l.client(fwd), "Expect address appended by proxy")
+
+	w := httptest.NewRecorder()
+	assert.False(t, l.check(w, request("10.0.0.1:1234"), apiV2, 1), "Expect request refused")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "Expect too many requests")
+	assert.Equal(t, "10", w.Header().Get("Retry-After"), "Expect retry after")
+
+	// Batches take a token for each of their jobs.
+	ok, _ = l.allow(request("10.0.0.3:1234"), 2)
+	assert.True(t, ok, "Expect batch within burst allowed")
+	ok, _ = l.allow(request("10.0.0.3:1234"), 1)
+	assert.False(t, ok, "Expect batch to use a token per job")
+	w = httptest.NewRecorder()
+	assert.False(t, l.check(w, request("10.0.0.4:1234"), apiV2, 3), "Expect batch over burst refused")
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expect batch over burst never allowed")
+
+	var none *scheduleLimiter
+	ok, _ = none.allow(request("10.0.0.1:1234"), 1)
+	assert.True(t, ok, "Expect requests allowed without limiter")
+	assert.Nil(t, newScheduleLimiter(ScheduleLimitConfig{}), "Expect no limiter if not configured")
+}
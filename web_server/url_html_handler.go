@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+)
+
+// Handles the request for the HTML content stored for a crawled URL, provided by
+// the 'url' query parameter. The sanitized HTML, with scripts and dangerous attributes
+// removed, is returned by default. The raw HTML is returned if the 'version' query
+// parameter is 'raw', and is served as plain text so it is never rendered. HTML is
+// only stored if the workers are configured to store it. If no HTML is stored for
+// the URL a 404 status code and message will be returned.
+//
+// e.g:
+// curl -G "http://localhost:8080/html" --data-urlencode "url=http://example.com/"
+//
+// Response:
+//	- Success: HTML document
+//	- Failure: {code: <code>, message: <message>}
+type URLHTMLHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *URLHTMLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	u := r.URL.Query().Get("url")
+	if u == "" {
+		h.version.writeError(w, "BadRequest", "No url provided", http.StatusBadRequest)
+		return
+	}
+	htmlVersion := r.URL.Query().Get("version")
+	if htmlVersion == "" {
+		htmlVersion = "sanitized"
+	}
+	if htmlVersion != "sanitized" && htmlVersion != "raw" {
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid version: %s, must be raw or sanitized", htmlVersion), http.StatusBadRequest)
+		return
+	}
+
+	stored, urlErr := urlHTML(h.sc, u)
+	if urlErr != nil {
+		log.Println("routeURLHTML request URL HTML failed.", urlErr)
+		h.version.writeError(w, "NotFound", urlErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	content, mime := stored.Sanitized, "text/html; charset=utf-8"
+	if htmlVersion == "raw" {
+		content, mime = stored.Raw, "text/plain; charset=utf-8"
+	}
+	if content == "" {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("No %s HTML stored for %s", htmlVersion, u), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", mime)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Defense in depth, the stored page is rendered without script or plugins
+	// even if something slipped by the sanitizer.
+	w.Header().Set("Content-Security-Policy", "sandbox; script-src 'none'; object-src 'none'")
+	w.Header().Set("Last-Modified", stored.StoredOn.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(content)); err != nil {
+		log.Println("routeURLHTML failed to write HTML", u, err)
+	}
+}
+
+// Connects to the remote service hosting URL information, and requests
+// the HTML stored for the URL.
+func urlHTML(sc *storage.Client, u string) (*storage.URLHTML, *ErroMsg) {
+	urlRec, err := sc.URLClient().GetURLByURL(u)
+	if err != nil || urlRec == nil {
+		return nil, &ErroMsg{
+			Source: "urlHTML",
+			Info:   fmt.Sprintf("Unknown URL %s", u),
+			Err:    err,
+		}
+	}
+
+	stored, err := sc.URLClient().GetHTML(urlRec.Id)
+	if err != nil || stored == nil {
+		return nil, &ErroMsg{
+			Source: "urlHTML",
+			Info:   fmt.Sprintf("No HTML stored for %s", u),
+			Err:    err,
+		}
+	}
+
+	return stored, nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"golang.org/x/net/html"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Attributes whose values are URLs of resources the page links to, or loads.
+var snapshotURLAttrs = map[string]bool{
+	"href":       true,
+	"src":        true,
+	"action":     true,
+	"formaction": true,
+	"background": true,
+	"poster":     true,
+	"data":       true,
+	"cite":       true,
+}
+
+// Handles the request for a snapshot of a crawled URL, provided by the 'url'
+// query parameter, so the page can be viewed roughly as it appeared when it
+// was crawled. The snapshot is the URL's sanitized stored HTML, with its links
+// to pages which have HTML stored rewritten to their snapshots. The page's
+// other links and resources are rewritten to their absolute URLs, so they are
+// loaded from the live site. HTML is only stored if the workers are configured
+// to store it. If no sanitized HTML is stored for the URL a 404 status code and
+// message will be returned.
+//
+// e.g:
+// curl -G "http://localhost:8080/snapshot" --data-urlencode "url=http://example.com/"
+//
+// Response:
+//	- Success: HTML document
+//	- Failure: {code: <code>, message: <message>}
+type URLSnapshotHandler struct {
+	sc       *storage.Client
+	rootPath string
+	version  apiVersion
+}
+
+func (h *URLSnapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	u := r.URL.Query().Get("url")
+	if u == "" {
+		h.version.writeError(w, "BadRequest", "No url provided", http.StatusBadRequest)
+		return
+	}
+	page, err := url.Parse(u)
+	if err != nil || !page.IsAbs() {
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid url: %s", u), http.StatusBadRequest)
+		return
+	}
+
+	stored, urlErr := urlHTML(h.sc, u)
+	if urlErr != nil {
+		log.Println("routeURLSnapshot request URL HTML failed.", urlErr)
+		h.version.writeError(w, "NotFound", urlErr.Short(), http.StatusNotFound)
+		return
+	}
+	if stored.Sanitized == "" {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("No sanitized HTML stored for %s", u), http.StatusNotFound)
+		return
+	}
+
+	// The page's links are collected first, so the snapshots available are
+	// looked up at once.
+	links := []string{}
+	rewriteSnapshot(stored.Sanitized, func(link string) string {
+		if abs, _ := resolveSnapshotLink(page, link); abs != "" {
+			links = append(links, abs)
+		}
+		return link
+	})
+	snapshots, err := h.sc.URLClient().HTMLStored(links)
+	if err != nil {
+		log.Println("routeURLSnapshot request stored HTML lookup failed.", u, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get snapshot of %s", u), http.StatusInternalServerError)
+		return
+	}
+
+	snapshotPath := h.version.path(h.rootPath, "snapshot")
+	content := rewriteSnapshot(stored.Sanitized, func(link string) string {
+		abs, fragment := resolveSnapshotLink(page, link)
+		switch {
+		case abs == "":
+			return link
+		case snapshots[abs]:
+			return snapshotPath + "?url=" + url.QueryEscape(abs) + fragment
+		default:
+			return abs + fragment
+		}
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Same as the stored HTML, the snapshot is rendered without script or
+	// plugins even if something slipped by the sanitizer.
+	w.Header().Set("Content-Security-Policy", "sandbox; script-src 'none'; object-src 'none'")
+	w.Header().Set("Last-Modified", stored.StoredOn.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(content)); err != nil {
+		log.Println("routeURLSnapshot failed to write snapshot", u, err)
+	}
+}
+
+// Returns the HTML document with the URLs of its link and resource attributes,
+// including srcset candidates, replaced with the values returned by rewrite.
+// The document's other markup and text are preserved.
+func rewriteSnapshot(doc string, rewrite func(link string) string) string {
+	z := html.NewTokenizer(strings.NewReader(doc))
+	out := bytes.Buffer{}
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// End of the document, or input which could not be read.
+			return out.String()
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			out.Write(z.Raw())
+			continue
+		}
+
+		tok := z.Token()
+		for i, a := range tok.Attr {
+			if a.Namespace != "" {
+				continue
+			}
+			switch key := strings.ToLower(a.Key); {
+			case snapshotURLAttrs[key]:
+				tok.Attr[i].Val = rewrite(a.Val)
+			case key == "srcset":
+				tok.Attr[i].Val = rewriteSrcset(a.Val, rewrite)
+			}
+		}
+		out.WriteString(tok.String())
+	}
+}
+
+// Returns the srcset with the URL of each of its image candidates replaced
+// with the value returned by rewrite, keeping the candidates' descriptors.
+func rewriteSrcset(srcset string, rewrite func(link string) string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, c := range candidates {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = rewrite(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// Resolves the link against the page's URL, returning the absolute URL without
+// its fragment, and the fragment including its '#'. An empty URL is returned
+// for links which are not http or https URLs, or only a fragment of the page,
+// and must be left as is.
+func resolveSnapshotLink(page *url.URL, link string) (string, string) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return "", ""
+	}
+	ref, err := url.Parse(link)
+	if err != nil {
+		return "", ""
+	}
+
+	abs := page.ResolveReference(ref)
+	if abs.Scheme != "http" && abs.Scheme != "https" {
+		return "", ""
+	}
+
+	fragment := ""
+	if abs.Fragment != "" {
+		fragment = "#" + abs.EscapedFragment()
+	}
+	abs.Fragment, abs.RawFragment = "", ""
+	return abs.String(), fragment
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestRewriteSnapshot(t *testing.T) {
+	page, _ := url.Parse("http://example.com/blog/post")
+	stored := map[string]bool{"http://example.com/blog/other": true}
+
+	doc := `<html><body><p class="intro">Fish &amp; chips</p>` +
+		`<a href="other#comments">Other</a><a href="/about">About</a><a href="#top">Top</a>` +
+		`<img src="//cdn.example.com/a.png" srcset="a-1x.png 1x, a-2x.png 2x"><a href="mailto:a@example.com">Mail</a></body></html>`
+
+	out := rewriteSnapshot(doc, func(link string) string {
+		abs, fragment := resolveSnapshotLink(page, link)
+		switch {
+		case abs == "":
+			return link
+		case stored[abs]:
+			return "/snapshot?url=" + url.QueryEscape(abs) + fragment
+		default:
+			return abs + fragment
+		}
+	})
+
+	assert.Equal(t, `<html><body><p class="intro">Fish &amp; chips</p>`+
+		`<a href="/snapshot?url=http%3A%2F%2Fexample.com%2Fblog%2Fother#comments">Other</a>`+
+		`<a href="http://example.com/about">About</a><a href="#top">Top</a>`+
+		`<img src="http://cdn.example.com/a.png" srcset="http://example.com/blog/a-1x.png 1x, http://example.com/blog/a-2x.png 2x">`+
+		`<a href="mailto:a@example.com">Mail</a></body></html>`, out, "Expect links rewritten")
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"path"
+)
+
+// Handles the request for what is stripped from the links found on crawled
+// pages before they are recorded. Without a job id the default tracking
+// parameters are returned, otherwise the job's effective rules, either the
+// defaults, or the strip params it was scheduled with. If the job does not
+// exists a 404 status code and message will be returned.
+//
+// e.g:
+// curl -X GET "http://localhost:8080/stripping"
+// curl -X GET "http://localhost:8080/stripping/1234"
+//
+// Response:
+//	- Success: {params: ["utm_*", "gclid", ...], default: true, keepFragments: false}
+//	- Failure: {code: <code>, message: <message>}
+type URLStrippingHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *URLStrippingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	if path.Base(r.URL.Path) == "stripping" {
+		h.version.writeData(w, common.NewURLStripping(nil, false), http.StatusOK)
+		return
+	}
+
+	id, err := jobIdFromString(path.Base(r.URL.Path))
+	if err != nil {
+		log.Println("routeURLStripping request failed.", err)
+		h.version.writeError(w, "BadRequest", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if jobErr := jobMustExist(h.sc, id, "routeURLStripping"); jobErr != nil {
+		h.version.writeError(w, "NotFound", jobErr.Short(), http.StatusNotFound)
+		return
+	}
+
+	stripping, err := h.sc.JobClient().URLStripping(id)
+	if err != nil {
+		log.Println("routeURLStripping request job URL stripping failed.", id, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get job %d URL stripping", id), http.StatusInternalServerError)
+		return
+	}
+
+	h.version.writeData(w, stripping, http.StatusOK)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Main text content of a crawled URL
+type urlTextMsg struct {
+	URL string `json:"url"`
+
+	// Title of the page, omitted if none
+	Title string `json:"title,omitempty"`
+
+	// Paragraphs of the page's main content, separated by blank lines
+	Text string `json:"text"`
+
+	StoredOn time.Time `json:"storedOn"`
+}
+
+// Handles the request for the main text content extracted from a crawled URL,
+// provided by the 'url' query parameter, without the page's navigation, footer,
+// and other boilerplate. Text is only extracted from the HTML pages of jobs
+// scheduled with the 'extractText' query parameter. If the 'format' query
+// parameter is 'text' only the text is returned, as plain text. If no text is
+// stored for the URL a 404 status code and message will be returned.
+//
+// e.g:
+// curl -G "http://localhost:8080/text" --data-urlencode "url=http://example.com/"
+//
+// Response:
+//	- Success: {url: <url>, title: <title>, text: <text>, storedOn: <storedOn>}
+//	- Failure: {code: <code>, message: <message>}
+type URLTextHandler struct {
+	sc      *storage.Client
+	version apiVersion
+}
+
+func (h *URLTextHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		h.version.methodNotAllowed(w, "GET")
+		return
+	}
+
+	u := r.URL.Query().Get("url")
+	if u == "" {
+		h.version.writeError(w, "BadRequest", "No url provided", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "text" {
+		h.version.writeError(w, "BadRequest", fmt.Sprintf("Invalid format: %s, must be json or text", format), http.StatusBadRequest)
+		return
+	}
+
+	urlRec, err := h.sc.URLClient().GetURLByURL(u)
+	if err != nil || urlRec == nil {
+		log.Println("routeURLText request unknown URL.", u, err)
+		h.version.writeError(w, "NotFound", fmt.Sprintf("Unknown URL %s", u), http.StatusNotFound)
+		return
+	}
+	stored, err := h.sc.URLClient().GetText(urlRec.Id)
+	if err != nil {
+		log.Println("routeURLText request URL text failed.", u, err)
+		h.version.writeError(w, "DependancyFailure", fmt.Sprintf("Failed to get text of %s", u), http.StatusInternalServerError)
+		return
+	}
+	if stored == nil {
+		h.version.writeError(w, "NotFound", fmt.Sprintf("No text stored for %s", u), http.StatusNotFound)
+		return
+	}
+
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Last-Modified", stored.StoredOn.UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte(stored.Text)); err != nil {
+			log.Println("routeURLText failed to write text", u, err)
+		}
+		return
+	}
+
+	h.version.writeData(w, urlTextMsg{
+		URL:      u,
+		Title:    stored.Title,
+		Text:     stored.Text,
+		StoredOn: stored.StoredOn.UTC(),
+	}, http.StatusOK)
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/jasdel/harvester/internal/common"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 )
 
@@ -48,3 +50,58 @@ func jobIdFromString(idStr string) (common.JobId, error) {
 
 	return common.JobId(id), nil
 }
+
+// Converts the job ID of a job action's URL path validating that it is a valid
+// value. The path can either be the action's legacy form, e.g: /pause/<jobId>,
+// or the job resource form, e.g: /job/<jobId>/pause.
+func jobIdFromActionPath(p, action string) (common.JobId, error) {
+	if path.Base(p) == action {
+		p = path.Dir(p)
+	}
+	return jobIdFromString(path.Base(p))
+}
+
+// Converts a string into an Upload ID validating that it is a valid value
+func uploadIdFromString(idStr string) (common.UploadId, error) {
+	if idStr == "" {
+		return common.InvalidId, fmt.Errorf("No uploadId provided")
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return common.InvalidId, fmt.Errorf("Invalid uploadId: %s", idStr)
+	}
+
+	return common.UploadId(id), nil
+}
+
+// Converts a string into a Group ID validating that it is a valid value
+func groupIdFromString(idStr string) (common.GroupId, error) {
+	if idStr == "" {
+		return common.InvalidId, fmt.Errorf("No groupId provided")
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return common.InvalidId, fmt.Errorf("Invalid groupId: %s", idStr)
+	}
+
+	return common.GroupId(id), nil
+}
+
+// Returns if the flag query parameter is set. A flag without a value, e.g:
+// ?partial, is set, otherwise its value is parsed as a boolean.
+func queryFlag(query url.Values, name string) (bool, error) {
+	values, ok := query[name]
+	if !ok {
+		return false, nil
+	}
+	if len(values) == 0 || values[0] == "" {
+		return true, nil
+	}
+	set, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s: %s, must be true or false", name, values[0])
+	}
+	return set, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
 )
 
@@ -26,3 +27,62 @@ func TestJobIdFromString(t *testing.T) {
 	assert.Nil(t, err, "Valid job id")
 	assert.Equal(t, common.JobId(12345), id, "Correct job id decoded")
 }
+
+func TestJobIdFromActionPath(t *testing.T) {
+	id, err := jobIdFromActionPath("/pause/12345", "pause")
+	assert.Nil(t, err, "Valid legacy path")
+	assert.Equal(t, common.JobId(12345), id, "Correct legacy path job id decoded")
+
+	id, err = jobIdFromActionPath("/v2/job/12345/pause", "pause")
+	assert.Nil(t, err, "Valid job resource path")
+	assert.Equal(t, common.JobId(12345), id, "Correct job resource path job id decoded")
+
+	_, err = jobIdFromActionPath("/pause/", "pause")
+	assert.NotNil(t, err, "No job id")
+}
+
+func TestUploadIdFromString(t *testing.T) {
+	_, err := uploadIdFromString("hello")
+	assert.NotNil(t, err, "Not valid upload id")
+
+	id, err := uploadIdFromString("12")
+	assert.Nil(t, err, "Valid upload id")
+	assert.Equal(t, common.UploadId(12), id, "Correct upload id decoded")
+}
+
+func TestGroupIdFromString(t *testing.T) {
+	_, err := groupIdFromString("hello")
+	assert.NotNil(t, err, "Not valid group id")
+
+	id, err := groupIdFromString("12")
+	assert.Nil(t, err, "Valid group id")
+	assert.Equal(t, common.GroupId(12), id, "Correct group id decoded")
+}
+
+func TestQueryFlag(t *testing.T) {
+	cases := []struct {
+		query string
+		set   bool
+		err   bool
+	}{
+		{"", false, false},
+		{"partial", true, false},
+		{"partial=", true, false},
+		{"partial=true", true, false},
+		{"partial=1", true, false},
+		{"partial=false", false, false},
+		{"partial=0", false, false},
+		{"partial=maybe", false, true},
+	}
+	for _, c := range cases {
+		q, err := url.ParseQuery(c.query)
+		require.NoError(t, err)
+		set, err := queryFlag(q, "partial")
+		if c.err {
+			assert.NotNil(t, err, "Expect %q invalid", c.query)
+			continue
+		}
+		assert.Nil(t, err, "Expect %q valid", c.query)
+		assert.Equal(t, c.set, set, "Expect %q flag", c.query)
+	}
+}
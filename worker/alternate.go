@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+)
+
+// Kinds of alternate representations of a page
+const (
+	// Accelerated Mobile Pages variant, rel="amphtml"
+	alternateAMP = "amp"
+
+	// Translation of the page, rel="alternate" with a hreflang
+	alternateLanguage = "language"
+
+	// RSS or Atom feed of the page, rel="alternate" with a feed type
+	alternateFeed = "feed"
+
+	// Variant for a media, e.g: mobile screens, rel="alternate" with a media
+	alternateMedia = "media"
+
+	// Any other rel="alternate" representation, e.g: a PDF version
+	alternateOther = "alternate"
+)
+
+// Alternate representation of a page, found in the page's link tags.
+type Alternate struct {
+	// URL of the alternate representation
+	URL string
+
+	// Kind of the alternate, e.g: alternateAMP
+	Kind string
+
+	// Language of the alternate, only set for alternateLanguage
+	Lang string
+}
+
+// Searches the HTML document's link tags for AMP variants, and alternate
+// representations of the page. The returned URLs are not normalized.
+func findHTMLAlternates(doc []byte) []Alternate {
+	scan, _ := scanHTML(bytes.NewReader(doc), 0)
+	return scan.alternates
+}
+
+// Returns the alternate representation of the link tag's attributes, and false
+// if the link is not to an AMP variant, or alternate. Attribute values are
+// expected unescaped.
+func linkAlternate(attrs map[string]string) (Alternate, bool) {
+	href := attrs["href"]
+	if href == "" {
+		return Alternate{}, false
+	}
+
+	rels := map[string]bool{}
+	for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+		rels[rel] = true
+	}
+
+	// Alternate stylesheets are themes of the page, not representations of it.
+	if rels["amphtml"] {
+		return Alternate{URL: href, Kind: alternateAMP}, true
+	} else if rels["alternate"] && !rels["stylesheet"] {
+		return alternateOf(href, attrs), true
+	}
+	return Alternate{}, false
+}
+
+// Returns the alternate representation described by the link tag's attributes.
+func alternateOf(href string, attrs map[string]string) Alternate {
+	typ := strings.ToLower(attrs["type"])
+	switch {
+	case attrs["hreflang"] != "":
+		return Alternate{URL: href, Kind: alternateLanguage, Lang: attrs["hreflang"]}
+	case typ == "application/rss+xml" || typ == "application/atom+xml":
+		return Alternate{URL: href, Kind: alternateFeed}
+	case attrs["media"] != "":
+		return Alternate{URL: href, Kind: alternateMedia}
+	default:
+		return Alternate{URL: href, Kind: alternateOther}
+	}
+}
+
+// Normalizes the alternates relative to the page's URL, dropping invalid, non
+// http(s), and duplicate alternates, and alternates of the page itself.
+func normalizeAlternates(page *url.URL, alternates []Alternate) []Alternate {
+	normalized := []Alternate{}
+	seen := map[Alternate]struct{}{}
+	for _, a := range alternates {
+		u, err := normalizeURL(page, a.URL)
+		if err != nil || u == page.String() || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) {
+			continue
+		}
+		a.URL = u
+		if _, ok := seen[a]; ok {
+			continue
+		}
+		seen[a] = struct{}{}
+		normalized = append(normalized, a)
+	}
+	return normalized
+}
+
+// Returns the URLs with the URLs of the alternates removed.
+func withoutAlternates(urls []string, alternates []Alternate) []string {
+	skip := make(map[string]struct{}, len(alternates))
+	for _, a := range alternates {
+		skip[a.URL] = struct{}{}
+	}
+
+	kept := []string{}
+	for _, u := range urls {
+		if _, ok := skip[u]; !ok {
+			kept = append(kept, u)
+		}
+	}
+	return kept
+}
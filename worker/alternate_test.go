@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestFindHTMLAlternates(t *testing.T) {
+	alternates := findHTMLAlternates([]byte(`<html><head>
+<link rel="amphtml" href="/page/amp">
+<link rel="alternate" hreflang="de" href="/de/page">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="alternate" media="only screen and (max-width: 640px)" href="http://m.example.com/page">
+<link rel="alternate" type="application/pdf" href="/page.pdf">
+<link rel="stylesheet" href="/style.css">
+<link rel="Alternate Stylesheet" href="/dark.css">
+<link rel="alternate" href="">
+</head></html>`))
+
+	assert.Equal(t, []Alternate{
+		{URL: "/page/amp", Kind: alternateAMP},
+		{URL: "/de/page", Kind: alternateLanguage, Lang: "de"},
+		{URL: "/feed.xml", Kind: alternateFeed},
+		{URL: "http://m.example.com/page", Kind: alternateMedia},
+		{URL: "/page.pdf", Kind: alternateOther},
+	}, alternates, "Expect typed alternates")
+}
+
+func TestNormalizeAlternates(t *testing.T) {
+	page, _ := url.Parse("http://example.com/page")
+	alternates := normalizeAlternates(page, []Alternate{
+		{URL: "/page/amp", Kind: alternateAMP},
+		{URL: "//example.com/page/amp", Kind: alternateAMP},
+		{URL: "/page", Kind: alternateLanguage, Lang: "en"},
+		{URL: "mailto:a@example.com", Kind: alternateOther},
+	})
+	assert.Equal(t, []Alternate{{URL: "http://example.com/page/amp", Kind: alternateAMP}}, alternates, "Expect normalized, de-duped alternates")
+}
+
+func TestWithoutAlternates(t *testing.T) {
+	urls := withoutAlternates(
+		[]string{"http://example.com/a", "http://example.com/page/amp", "http://example.com/b"},
+		[]Alternate{{URL: "http://example.com/page/amp", Kind: alternateAMP}})
+	assert.Equal(t, []string{"http://example.com/a", "http://example.com/b"}, urls, "Expect alternate removed")
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Modes cassettes are used in
+const (
+	cassetteRecord = "record"
+	cassetteReplay = "replay"
+)
+
+// Name of the cassette recording the responses fetched outside of a job's
+// crawl, e.g: robots.txt, and well-known files.
+const sharedCassette = "shared"
+
+// Record and replay of the responses fetched by the worker.
+type CassetteConfig struct {
+	// Either "record", recording every fetched response into the cassette
+	// of its job, or "replay", fetching responses from the recorded
+	// cassettes instead of their hosts. Disabled if not set.
+	Mode string `json:"mode"`
+
+	// Directory of the cassettes.
+	Dir string `json:"dir"`
+}
+
+// Validates the cassette configuration.
+func (c CassetteConfig) validate() error {
+	switch c.Mode {
+	case "":
+		return nil
+	case cassetteRecord, cassetteReplay:
+	default:
+		return fmt.Errorf("Invalid cassette mode %s", c.Mode)
+	}
+	if c.Dir == "" {
+		return fmt.Errorf("Cassette directory is required for cassette mode %s", c.Mode)
+	}
+	return nil
+}
+
+// Response of a URL recorded in a cassette. Only the part of the body read
+// is recorded.
+type cassetteEntry struct {
+	URL        string    `json:"url"`
+	RecordedOn time.Time `json:"recordedOn"`
+
+	// Response of the URL, nil if the fetch failed.
+	Response *traceResponse `json:"response,omitempty"`
+
+	// Reason the fetch failed.
+	Error string `json:"error,omitempty"`
+}
+
+// Returns the cassette file of the name in the directory.
+func cassetteFilename(dir, name string) string {
+	return filepath.Join(dir, name+".cassette")
+}
+
+// Returns the name of the job's cassette.
+func jobCassette(jobId common.JobId) string {
+	return fmt.Sprintf("job-%d", jobId)
+}
+
+// Records the responses fetched by the worker into cassettes. Each line of a
+// cassette file is a JSON cassetteEntry. Recording a URL again appends it to
+// the cassette, and the latest recording is replayed.
+type cassetteRecorder struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Creates a recorder of the cassettes in the directory.
+func newCassetteRecorder(dir string) (*cassetteRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &cassetteRecorder{dir: dir}, nil
+}
+
+// Returns a fetcher recording the responses fetched by the next fetcher into
+// the named cassette. Responses are recorded once their body is closed. If
+// the recorder is nil the next fetcher is returned.
+func (r *cassetteRecorder) fetcher(name string, next Fetcher) Fetcher {
+	if r == nil {
+		return next
+	}
+	return FetcherFunc(func(ctx context.Context, u string) (*http.Response, error) {
+		resp, err := next.Fetch(ctx, u)
+		if err != nil {
+			r.record(name, cassetteEntry{URL: u, RecordedOn: time.Now().UTC(), Error: err.Error()})
+			return nil, err
+		}
+
+		recorded := &traceResponse{Status: resp.StatusCode, Header: resp.Header}
+		resp.Body = &cassetteBody{
+			traceBody: traceBody{ReadCloser: resp.Body, resp: recorded},
+			done: func() {
+				r.record(name, cassetteEntry{URL: u, RecordedOn: time.Now().UTC(), Response: recorded})
+			},
+		}
+		return resp, nil
+	})
+}
+
+// Appends the entry to the named cassette. Failures are logged, and don't
+// affect the fetch.
+func (r *cassetteRecorder) record(name string, e cassetteEntry) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		log.Println("cassette: failed to encode entry", name, e.URL, err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.OpenFile(cassetteFilename(r.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("cassette: failed to open cassette", name, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		log.Println("cassette: failed to write entry", name, e.URL, err)
+	}
+}
+
+// Response body recording the bytes read from it, and recording its response
+// once closed.
+type cassetteBody struct {
+	traceBody
+	done func()
+	once sync.Once
+}
+
+func (b *cassetteBody) Close() error {
+	err := b.traceBody.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// Reads the entries of a cassette file, in the order recorded.
+func readCassette(in io.Reader) ([]cassetteEntry, error) {
+	entries := []cassetteEntry{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 4*maxTraceBody)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := cassetteEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("Invalid cassette entry %d, %v", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harvester-cassette")
+	require.NoError(t, err, "Expect cassette directory")
+	defer os.RemoveAll(dir)
+
+	recorder, err := newCassetteRecorder(dir)
+	require.NoError(t, err, "Expect recorder")
+
+	fetcher := recorder.fetcher(jobCassette(7), staticFetcher(`<a href="/a">a</a>`))
+	page, err := Scrape("http://example.com/", fetcher, scrapeOptions{})
+	require.NoError(t, err, "Expect recorded page scraped")
+	page.Release()
+
+	failing := recorder.fetcher(sharedCassette, FetcherFunc(func(ctx context.Context, u string) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	}))
+	_, err = failing.Fetch(context.Background(), "http://example.com/robots.txt")
+	assert.Error(t, err, "Expect failed fetch returned")
+
+	_, err = os.Stat(cassetteFilename(dir, "job-7"))
+	assert.NoError(t, err, "Expect job's cassette")
+
+	// A subsequent crawl is served from the cassettes, without the host.
+	replay, err := loadFixtureFetcher(dir)
+	require.NoError(t, err, "Expect cassettes loaded")
+
+	page, err = Scrape("http://example.com/", replay, scrapeOptions{})
+	require.NoError(t, err, "Expect replayed page scraped")
+	assert.Equal(t, []string{"http://example.com/a"}, page.URLs, "Expect replayed page's URLs")
+	page.Release()
+
+	_, err = replay.Fetch(context.Background(), "http://example.com/robots.txt")
+	assert.Error(t, err, "Expect recorded failure replayed")
+}
+
+func TestCassetteReplayLatest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harvester-cassette")
+	require.NoError(t, err, "Expect cassette directory")
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(cassetteFilename(dir, "job-2"), []byte(
+		`{"url": "http://example.com/", "recordedOn": "2015-01-01T00:00:00Z", "response": {"status": 500}}
+`), 0644), "Expect cassette written")
+	require.NoError(t, ioutil.WriteFile(cassetteFilename(dir, "job-10"), []byte(
+		`{"url": "http://example.com/", "recordedOn": "2015-01-02T00:00:00Z", "response": {"status": 200}}
+`), 0644), "Expect cassette written")
+
+	replay, err := loadFixtureFetcher(dir)
+	require.NoError(t, err, "Expect cassettes loaded")
+
+	resp, err := replay.Fetch(context.Background(), "http://example.com/")
+	require.NoError(t, err, "Expect recorded response")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Expect latest recording replayed")
+}
+
+func TestCassetteConfigValidate(t *testing.T) {
+	assert.NoError(t, CassetteConfig{}.validate(), "Expect disabled cassettes valid")
+	assert.NoError(t, CassetteConfig{Mode: cassetteRecord, Dir: "cassettes"}.validate(), "Expect record mode valid")
+	assert.Error(t, CassetteConfig{Mode: cassetteReplay}.validate(), "Expect directory required")
+	assert.Error(t, CassetteConfig{Mode: "rewind", Dir: "cassettes"}.validate(), "Expect unknown mode invalid")
+}
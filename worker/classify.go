@@ -0,0 +1,243 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tags the built-in heuristics classify pages with.
+const (
+	tagProduct  = "product"
+	tagArticle  = "article"
+	tagCategory = "category"
+	tagLogin    = "login"
+	tagError    = "error"
+)
+
+// Fewest visible words of a page with a publish date to be an article.
+const classifyArticleMinWords = 300
+
+// Most visible words of a page whose title states it wasn't found to be a
+// soft error page. Longer pages are assumed to be content about errors.
+const classifySoftErrorMaxWords = 200
+
+// Fewest anchors of a page, and most visible words per anchor, for the page
+// to be a category listing of links.
+const (
+	classifyCategoryMinLinks        = 40
+	classifyCategoryMaxWordsPerLink = 8
+)
+
+// Regex for JSON-LD @type properties, either a single type or a list of types.
+const jsonLDTypeRegexp = `"@type"\s*:\s*(?:"([^"]+)"|\[([^\]]*)\])`
+
+// Regex for the quoted strings within a JSON list.
+const jsonStringRegexp = `"([^"]+)"`
+
+// Regex of valid tags, lower cased letters, numbers, '-', and '_'.
+const classifyTagRegexp = `^[a-z0-9_-]+$`
+
+var jsonLDTypeRegexpComp *regexp.Regexp
+var jsonStringRegexpComp *regexp.Regexp
+var classifyTagRegexpComp *regexp.Regexp
+
+func init() {
+	jsonLDTypeRegexpComp = regexp.MustCompile(jsonLDTypeRegexp)
+	jsonStringRegexpComp = regexp.MustCompile(jsonStringRegexp)
+	classifyTagRegexpComp = regexp.MustCompile(classifyTagRegexp)
+}
+
+// Structure of an HTML document, found while it is scanned, which hints at
+// the kind of page it is.
+type pageHints struct {
+	// Lower cased schema.org types of the document's JSON-LD and microdata,
+	// e.g: "product"
+	SchemaTypes []string
+
+	// Lower cased content of the document's og:type meta tag
+	OGType string
+
+	// Number of anchor elements
+	Links int
+
+	// If the document has a password input, e.g: a login form
+	Password bool
+}
+
+// Adds the schema.org type to the hints, if not already added. Types may be
+// a full URL, e.g: "https://schema.org/Product", or prefixed, e.g: "schema:Product".
+func (h *pageHints) addSchemaType(t string) {
+	t = strings.TrimSpace(t)
+	if i := strings.LastIndexAny(t, "/:#"); i >= 0 {
+		t = t[i+1:]
+	}
+	if t == "" {
+		return
+	}
+	t = strings.ToLower(t)
+	for _, known := range h.SchemaTypes {
+		if known == t {
+			return
+		}
+	}
+	h.SchemaTypes = append(h.SchemaTypes, t)
+}
+
+// Adds the JSON-LD @type properties found in the script's text to the hints.
+func (h *pageHints) addJSONLDTypes(script []byte) {
+	for _, m := range jsonLDTypeRegexpComp.FindAllSubmatch(script, -1) {
+		if len(m[1]) > 0 {
+			h.addSchemaType(string(m[1]))
+			continue
+		}
+		for _, s := range jsonStringRegexpComp.FindAllSubmatch(m[2], -1) {
+			h.addSchemaType(string(s[1]))
+		}
+	}
+}
+
+// Returns true if the hints include any of the schema.org types.
+func (h *pageHints) hasSchemaType(types ...string) bool {
+	for _, known := range h.SchemaTypes {
+		for _, t := range types {
+			if known == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Tags crawled pages by the kind of content they are, e.g: product pages, so
+// the results of large crawls can be triaged. Classifiers return the tags which
+// apply to the page, none if the page isn't recognized. Tags should be short
+// names of letters, numbers, '-', and '_', and are lower cased. The page's body
+// is only set if the page's HTML is kept, so classifiers should prefer the
+// page's information and hints.
+type Classifier interface {
+	Classify(page *Page, pageURL *url.URL) []string
+}
+
+// Adapter allowing functions to be used as classifiers.
+type ClassifierFunc func(page *Page, pageURL *url.URL) []string
+
+func (f ClassifierFunc) Classify(page *Page, pageURL *url.URL) []string {
+	return f(page, pageURL)
+}
+
+// Registry of the classifiers every crawled page is classified by, keyed by name.
+var classifiers = map[string]Classifier{}
+
+func init() {
+	registerClassifier("heuristic", ClassifierFunc(classifyHeuristic))
+}
+
+// Registers the classifier with the name. Registering a name again replaces
+// its classifier.
+func registerClassifier(name string, c Classifier) {
+	classifiers[name] = c
+}
+
+// Classifies the page with every registered classifier, returning the sorted
+// and de-duped tags of the page. Invalid tags are dropped.
+func classifyPage(page *Page, pageURL *url.URL) []string {
+	found := map[string]struct{}{}
+	for name, c := range classifiers {
+		for _, tag := range c.Classify(page, pageURL) {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if !classifyTagRegexpComp.MatchString(tag) {
+				log.Println("classify: Dropping invalid tag", tag, "of classifier", name)
+				continue
+			}
+			found[tag] = struct{}{}
+		}
+	}
+
+	tags := make([]string, 0, len(found))
+	for tag := range found {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// URL path segments of each kind of page.
+var (
+	productPathSegments  = []string{"product", "products", "dp", "item"}
+	categoryPathSegments = []string{"category", "categories", "collections", "shop", "department"}
+	loginPathSegments    = []string{"login", "log-in", "signin", "sign-in", "logon"}
+)
+
+// Classifies the page as a product, article, category, login, or error page
+// using built-in heuristics. Error responses are error pages, as are short
+// HTML pages whose title or heading states they were not found. Other pages
+// are classified by their schema.org types, og:type, structure, and URL path.
+func classifyHeuristic(page *Page, pageURL *url.URL) []string {
+	if page.Status >= 400 {
+		return []string{tagError}
+	}
+	if page.Mime != "text/html" {
+		return nil
+	}
+
+	info, hints := page.Info, page.Hints
+	heading := strings.ToLower(info.Title + " " + info.H1)
+	if info.WordCount <= classifySoftErrorMaxWords && (strings.Contains(heading, "not found") || strings.Contains(heading, "404")) {
+		return []string{tagError}
+	}
+
+	var segments []string
+	if pageURL != nil {
+		segments = strings.Split(strings.ToLower(pageURL.Path), "/")
+	}
+
+	tags := []string{}
+	if hints.Password || hasPathSegment(segments, loginPathSegments) {
+		tags = append(tags, tagLogin)
+	}
+
+	switch {
+	case hints.hasSchemaType("product", "productgroup", "offer") || hints.OGType == "product" || hints.OGType == "og:product":
+		tags = append(tags, tagProduct)
+	case hints.hasSchemaType("article", "newsarticle", "blogposting", "techarticle", "report") || hints.OGType == "article":
+		tags = append(tags, tagArticle)
+	case hints.hasSchemaType("collectionpage", "itemlist", "offercatalog"):
+		tags = append(tags, tagCategory)
+	case hasPathSegment(segments, productPathSegments):
+		tags = append(tags, tagProduct)
+	case hasPathSegment(segments, categoryPathSegments):
+		tags = append(tags, tagCategory)
+	case !info.PublishedOn.IsZero() && info.WordCount >= classifyArticleMinWords:
+		tags = append(tags, tagArticle)
+	case hints.Links >= classifyCategoryMinLinks && info.WordCount <= hints.Links*classifyCategoryMaxWordsPerLink:
+		tags = append(tags, tagCategory)
+	}
+
+	return tags
+}
+
+// Returns true if any of the path segments is one of the names.
+func hasPathSegment(segments, names []string) bool {
+	for _, s := range segments {
+		for _, n := range names {
+			if s == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Classify stage of the crawl. Tags the page with the kinds of content it is,
+// and flags it with the job's flags its content matches.
+func (c *Crawler) classify(t *crawlTask) bool {
+	pageURL, _ := url.Parse(t.urlRec.URL)
+	t.tags = classifyPage(t.page, pageURL)
+	if t.flags != nil {
+		t.flagged = flagPage(t.flags, t.page.Body)
+	}
+	return true
+}
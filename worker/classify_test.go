@@ -0,0 +1,79 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClassifyHeuristic(t *testing.T) {
+	published := time.Date(2015, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name string
+		url  string
+		page Page
+		tags []string
+	}{
+		{"error status", "http://example.com/a", Page{Mime: "text/html", Status: 500}, []string{tagError}},
+		{"non-HTML error", "http://example.com/a.png", Page{Mime: "image/png", Status: 404}, []string{tagError}},
+		{"soft not found", "http://example.com/a", Page{Mime: "text/html", Status: 200, Info: common.PageInfo{Title: "Page Not Found", WordCount: 20}}, []string{tagError}},
+		{"long not found content", "http://example.com/a", Page{Mime: "text/html", Status: 200, Info: common.PageInfo{Title: "Not found errors explained", WordCount: 1000}}, []string{}},
+		{"non-HTML", "http://example.com/products/a.pdf", Page{Mime: "application/pdf", Status: 200}, nil},
+		{"product schema", "http://example.com/a", Page{Mime: "text/html", Status: 200, Hints: pageHints{SchemaTypes: []string{"product"}}}, []string{tagProduct}},
+		{"product og:type", "http://example.com/a", Page{Mime: "text/html", Status: 200, Hints: pageHints{OGType: "og:product"}}, []string{tagProduct}},
+		{"product path", "http://example.com/Products/shoe", Page{Mime: "text/html", Status: 200}, []string{tagProduct}},
+		{"article schema", "http://example.com/a", Page{Mime: "text/html", Status: 200, Hints: pageHints{SchemaTypes: []string{"newsarticle"}}}, []string{tagArticle}},
+		{"published long page", "http://example.com/a", Page{Mime: "text/html", Status: 200, Info: common.PageInfo{PublishedOn: published, WordCount: 800}}, []string{tagArticle}},
+		{"published short page", "http://example.com/a", Page{Mime: "text/html", Status: 200, Info: common.PageInfo{PublishedOn: published, WordCount: 50}}, []string{}},
+		{"category schema", "http://example.com/a", Page{Mime: "text/html", Status: 200, Hints: pageHints{SchemaTypes: []string{"collectionpage"}}}, []string{tagCategory}},
+		{"category path", "http://example.com/category/shoes", Page{Mime: "text/html", Status: 200}, []string{tagCategory}},
+		{"link listing", "http://example.com/a", Page{Mime: "text/html", Status: 200, Info: common.PageInfo{WordCount: 200}, Hints: pageHints{Links: 60}}, []string{tagCategory}},
+		{"login form", "http://example.com/account", Page{Mime: "text/html", Status: 200, Hints: pageHints{Password: true}}, []string{tagLogin}},
+		{"login path", "http://example.com/sign-in", Page{Mime: "text/html", Status: 200}, []string{tagLogin}},
+		{"login product", "http://example.com/products/a", Page{Mime: "text/html", Status: 200, Hints: pageHints{Password: true}}, []string{tagLogin, tagProduct}},
+	}
+
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.tags, classifyHeuristic(&c.page, u), c.name)
+	}
+}
+
+func TestClassifyPage(t *testing.T) {
+	defer func(orig map[string]Classifier) { classifiers = orig }(classifiers)
+	classifiers = map[string]Classifier{}
+
+	registerClassifier("heuristic", ClassifierFunc(classifyHeuristic))
+	registerClassifier("custom", ClassifierFunc(func(page *Page, pageURL *url.URL) []string {
+		return []string{" Pricing ", "product", "not valid", ""}
+	}))
+
+	u, _ := url.Parse("http://example.com/products/a")
+	tags := classifyPage(&Page{Mime: "text/html", Status: 200}, u)
+	assert.Equal(t, []string{"pricing", "product"}, tags, "Expect tags of all classifiers, de-duped, sorted, and valid")
+}
+
+func TestScanHTMLHints(t *testing.T) {
+	doc := `<html><head>
+<meta property="og:type" content="Article">
+<script type="application/ld+json">{"@type": ["BreadcrumbList", "https://schema.org/NewsArticle"]}</script>
+</head><body itemscope itemtype="http://schema.org/WebPage">
+<a href="/a">a</a><a href="/b">b</a>
+<form><input type="PASSWORD" name="p"></form>
+</body></html>`
+
+	scan, err := scanHTML(strings.NewReader(doc), 0)
+	require.NoError(t, err, "Expect document scanned")
+	assert.Equal(t, pageHints{
+		SchemaTypes: []string{"breadcrumblist", "newsarticle", "webpage"},
+		OGType:      "article",
+		Links:       2,
+		Password:    true,
+	}, scan.hints, "Expect page hints")
+}
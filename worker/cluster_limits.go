@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Limits shared by all workers of the cluster, so the sum of all jobs' crawls
+// can't exceed the cluster's egress budget.
+type ClusterLimitsConfig struct {
+	// Maximum HTTP fetches in flight across all workers. A fetch holds its
+	// slot until its response body is closed. Unlimited if not set.
+	MaxFetches int `json:"maxFetches"`
+
+	// Maximum bandwidth, in megabits per second, of the HTTP response bodies
+	// read by all workers. Unlimited if not set.
+	MaxMbps float64 `json:"maxMbps"`
+}
+
+// Validates the limits.
+func (c ClusterLimitsConfig) validate() error {
+	if c.MaxFetches < 0 {
+		return fmt.Errorf("Invalid cluster limits maxFetches %d, must be positive", c.MaxFetches)
+	}
+	if c.MaxMbps < 0 {
+		return fmt.Errorf("Invalid cluster limits maxMbps %v, must be positive", c.MaxMbps)
+	}
+	return nil
+}
+
+// Returns true if either limit is set.
+func (c ClusterLimitsConfig) enabled() bool {
+	return c.MaxFetches > 0 || c.MaxMbps > 0
+}
+
+// Fetch slots not renewed within the TTL are freed, e.g: of a worker which
+// was killed. Slots are renewed at half the TTL.
+const fetchSlotTTL = 2 * time.Minute
+
+// Time waited between attempts to acquire a fetch slot, or bandwidth, while
+// the cluster's limit is reached.
+const clusterLimitWait = 100 * time.Millisecond
+
+// Bounds of the bytes of bandwidth reserved from the cluster at a time.
+const (
+	minBandwidthReserve = 16 * 1024
+	maxBandwidthReserve = 1024 * 1024
+)
+
+// Shared counters of the cluster's limits.
+type clusterCounters interface {
+	AcquireFetchSlot(worker string, limit int, ttl time.Duration) (int64, bool, error)
+	ReleaseFetchSlot(id int64) error
+	RenewFetchSlots(worker string, ttl time.Duration) error
+	ReserveBandwidth(n, limit int64) (int64, error)
+	Usage() (storage.ClusterUsage, error)
+}
+
+// Enforces the cluster's limits on the worker's HTTP fetches with counters
+// shared by all workers. Each fetch acquires a slot of the cluster's
+// concurrent fetches, and response bodies are read only as fast as bandwidth
+// can be reserved from the current second's cluster bandwidth. Bandwidth is
+// reserved in chunks, so the counters aren't updated for every read. Fetches
+// wait while a limit is reached. If the counters fail the fetch is failed.
+type clusterLimiter struct {
+	counters clusterCounters
+	worker   string
+
+	maxFetches     int
+	bytesPerSecond int64
+	reserveSize    int64
+
+	mu        sync.Mutex
+	available int64
+	expires   time.Time
+}
+
+// Creates a limiter of the configuration's limits, identifying the worker's
+// fetch slots by the worker's host name, and a random suffix.
+func newClusterLimiter(counters clusterCounters, cfg ClusterLimitsConfig) (*clusterLimiter, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+
+	l := &clusterLimiter{
+		counters:       counters,
+		worker:         host + "-" + hex.EncodeToString(b),
+		maxFetches:     cfg.MaxFetches,
+		bytesPerSecond: int64(cfg.MaxMbps * 1000 * 1000 / 8),
+	}
+	l.reserveSize = l.bytesPerSecond / 10
+	if l.reserveSize < minBandwidthReserve {
+		l.reserveSize = minBandwidthReserve
+	} else if l.reserveSize > maxBandwidthReserve {
+		l.reserveSize = maxBandwidthReserve
+	}
+	return l, nil
+}
+
+// Returns a round tripper limiting the requests made by the next round
+// tripper. If the limiter is nil the next round tripper is returned.
+func (l *clusterLimiter) transport(next http.RoundTripper) http.RoundTripper {
+	if l == nil {
+		return next
+	}
+	return &limitedTransport{limiter: l, next: next}
+}
+
+// Renews the worker's fetch slots until the worker stops, so slots of long
+// fetches, e.g: downloads, don't expire.
+func (l *clusterLimiter) renewSlots() {
+	if l.maxFetches <= 0 {
+		return
+	}
+	for {
+		time.Sleep(fetchSlotTTL / 2)
+		if err := l.counters.RenewFetchSlots(l.worker, fetchSlotTTL); err != nil {
+			log.Println("clusterLimiter: failed to renew fetch slots", err)
+		}
+	}
+}
+
+// Acquires a fetch slot, waiting while the cluster's slots are all held.
+// Returns zero if fetches aren't limited.
+func (l *clusterLimiter) acquireSlot(ctx context.Context) (int64, error) {
+	if l.maxFetches <= 0 {
+		return 0, nil
+	}
+	for {
+		id, ok, err := l.counters.AcquireFetchSlot(l.worker, l.maxFetches, fetchSlotTTL)
+		if err != nil || ok {
+			return id, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(clusterLimitWait):
+		}
+	}
+}
+
+// Releases the fetch slot, unless fetches aren't limited.
+func (l *clusterLimiter) releaseSlot(id int64) {
+	if id == 0 {
+		return
+	}
+	if err := l.counters.ReleaseFetchSlot(id); err != nil {
+		log.Println("clusterLimiter: failed to release fetch slot", id, err)
+	}
+}
+
+// Takes up to n bytes of the bandwidth reserved by the worker, reserving
+// more from the cluster when the worker's reservation is used up, or a second
+// has passed since it was reserved. Waits while the cluster's bandwidth of
+// the second is exhausted. Returns n if bandwidth isn't limited.
+func (l *clusterLimiter) take(ctx context.Context, n int) (int, error) {
+	if l.bytesPerSecond <= 0 {
+		return n, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.available <= 0 || time.Now().After(l.expires) {
+		reserved, err := l.counters.ReserveBandwidth(l.reserveSize, l.bytesPerSecond)
+		if err != nil {
+			return 0, err
+		}
+		// Seconds are of the storage's clock, which the worker's clock may
+		// differ from, so reservations are used for a second from now.
+		l.available, l.expires = reserved, time.Now().Add(time.Second)
+		if reserved > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(clusterLimitWait):
+		}
+	}
+
+	if int64(n) > l.available {
+		n = int(l.available)
+	}
+	l.available -= int64(n)
+	return n, nil
+}
+
+// Returns bytes taken but not read to the worker's reservation.
+func (l *clusterLimiter) untake(n int) {
+	if l.bytesPerSecond <= 0 || n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.available += int64(n)
+}
+
+// Returns the current utilization of the cluster's limits, and the limits,
+// to be published with expvar. Fails with the error's message if the usage
+// can't be read.
+func (l *clusterLimiter) vars() expvar.Func {
+	return expvar.Func(func() interface{} {
+		usage, err := l.counters.Usage()
+		if err != nil {
+			return map[string]interface{}{"error": err.Error()}
+		}
+		return map[string]interface{}{
+			"fetches":    usage.Fetches,
+			"maxFetches": l.maxFetches,
+			"mbps":       float64(usage.BytesPerSecond) * 8 / 1000 / 1000,
+			"maxMbps":    float64(l.bytesPerSecond) * 8 / 1000 / 1000,
+		}
+	})
+}
+
+// Round tripper holding a fetch slot for each request until its response's
+// body is closed, and reading the body within the cluster's bandwidth.
+type limitedTransport struct {
+	limiter *clusterLimiter
+	next    http.RoundTripper
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slot, err := t.limiter.acquireSlot(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.limiter.releaseSlot(slot)
+		return nil, err
+	}
+	resp.Body = &limitedBody{ReadCloser: resp.Body, ctx: req.Context(), limiter: t.limiter, slot: slot}
+	return resp, nil
+}
+
+// Response body read within the cluster's bandwidth, releasing its fetch
+// slot once closed.
+type limitedBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *clusterLimiter
+	slot    int64
+	once    sync.Once
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return b.ReadCloser.Read(p)
+	}
+	taken, err := b.limiter.take(b.ctx, len(p))
+	if err != nil {
+		return 0, err
+	}
+	n, err := b.ReadCloser.Read(p[:taken])
+	b.limiter.untake(taken - n)
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.limiter.releaseSlot(b.slot) })
+	return err
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// In memory cluster counters, of a single second of bandwidth.
+type memClusterCounters struct {
+	mu       sync.Mutex
+	slots    map[int64]bool
+	nextSlot int64
+	reserved int64
+}
+
+func (c *memClusterCounters) AcquireFetchSlot(worker string, limit int, ttl time.Duration) (int64, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.slots) >= limit {
+		return 0, false, nil
+	}
+	c.nextSlot++
+	c.slots[c.nextSlot] = true
+	return c.nextSlot, true, nil
+}
+
+func (c *memClusterCounters) ReleaseFetchSlot(id int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.slots, id)
+	return nil
+}
+
+func (c *memClusterCounters) RenewFetchSlots(worker string, ttl time.Duration) error {
+	return nil
+}
+
+func (c *memClusterCounters) ReserveBandwidth(n, limit int64) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if n > limit-c.reserved {
+		n = limit - c.reserved
+	}
+	c.reserved += n
+	return n, nil
+}
+
+func (c *memClusterCounters) Usage() (storage.ClusterUsage, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return storage.ClusterUsage{Fetches: len(c.slots), BytesPerSecond: c.reserved}, nil
+}
+
+// Round tripper responding to every request with the body.
+type staticTransport string
+
+func (t staticTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(strings.NewReader(string(t))), Request: req}, nil
+}
+
+func TestClusterLimiterFetchSlots(t *testing.T) {
+	counters := &memClusterCounters{slots: map[int64]bool{}}
+	limiter, err := newClusterLimiter(counters, ClusterLimitsConfig{MaxFetches: 1})
+	require.NoError(t, err, "Expect limiter")
+	client := &http.Client{Transport: limiter.transport(staticTransport("body"))}
+
+	first, err := client.Get("http://example.com/first")
+	require.NoError(t, err, "Expect first fetch")
+
+	// The second fetch waits for the first's slot.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*clusterLimitWait)
+	defer cancel()
+	req, _ := http.NewRequest("GET", "http://example.com/second", nil)
+	_, err = client.Do(req.WithContext(ctx))
+	assert.Error(t, err, "Expect fetch to wait for a slot")
+
+	first.Body.Close()
+	first.Body.Close()
+	usage, _ := counters.Usage()
+	assert.Equal(t, 0, usage.Fetches, "Expect slot released once")
+
+	second, err := client.Get("http://example.com/second")
+	require.NoError(t, err, "Expect fetch once slot released")
+	second.Body.Close()
+}
+
+func TestClusterLimiterBandwidth(t *testing.T) {
+	counters := &memClusterCounters{slots: map[int64]bool{}}
+	limiter, err := newClusterLimiter(counters, ClusterLimitsConfig{MaxMbps: 1})
+	require.NoError(t, err, "Expect limiter")
+	assert.Equal(t, int64(125000), limiter.bytesPerSecond, "Expect bytes per second of Mbps")
+	assert.Equal(t, int64(minBandwidthReserve), limiter.reserveSize, "Expect minimum reservation")
+
+	body := strings.Repeat("a", 100)
+	resp, err := (&http.Client{Transport: limiter.transport(staticTransport(body))}).Get("http://example.com/")
+	require.NoError(t, err, "Expect fetch")
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err, "Expect body read")
+	assert.Equal(t, body, string(b), "Expect whole body")
+
+	assert.Equal(t, int64(minBandwidthReserve), counters.reserved, "Expect bandwidth reserved once")
+	assert.Equal(t, int64(minBandwidthReserve-100), limiter.available, "Expect unread bytes returned to reservation")
+
+	// The second's bandwidth is exhausted, so reads wait.
+	counters.reserved = limiter.bytesPerSecond
+	limiter.available = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 3*clusterLimitWait)
+	defer cancel()
+	_, err = limiter.take(ctx, 10)
+	assert.Equal(t, context.DeadlineExceeded, err, "Expect read to wait for bandwidth")
+}
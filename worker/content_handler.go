@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/net/html"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Scrapes the body of responses of the content types it is registered for.
+// Handlers add the information they find to the page, and return the URLs found
+// in the body. The URLs do not need to be normalized, or de-duped.
+type ContentHandler interface {
+	Scrape(page *Page, pageURL *url.URL, header http.Header, body []byte) []string
+}
+
+// Content handler which scrapes the response body as it is read, so the body
+// does not need to be buffered in memory. Scrape is still used for bodies which
+// are already buffered. The information found before a read error is kept.
+type StreamContentHandler interface {
+	ContentHandler
+	ScrapeStream(page *Page, pageURL *url.URL, header http.Header, body io.Reader) ([]string, error)
+}
+
+// Adapter allowing functions to be used as content handlers.
+type ContentHandlerFunc func(page *Page, pageURL *url.URL, header http.Header, body []byte) []string
+
+func (f ContentHandlerFunc) Scrape(page *Page, pageURL *url.URL, header http.Header, body []byte) []string {
+	return f(page, pageURL, header, body)
+}
+
+// Mime types of HTML documents handled by the HTML content handler
+var htmlMimes = []string{"text/html", "application/xhtml+xml"}
+
+// Mime types of XML documents handled by the XML content handler
+var xmlMimes = []string{"text/xml", "application/xml", "application/atom+xml", "application/rss+xml", "application/rdf+xml"}
+
+// Registry of content handlers keyed by mime type.
+var contentHandlers = map[string]ContentHandler{}
+
+func init() {
+	registerContentHandler(htmlHandler{}, htmlMimes...)
+	registerContentHandler(newXMLHandler(defaultXMLURLNames), xmlMimes...)
+	registerContentHandler(ContentHandlerFunc(scrapeJSON), "application/json")
+	registerContentHandler(ContentHandlerFunc(scrapeGeneric), "application/pdf", "text/plain")
+}
+
+// Registers the handler for the mime types. A mime type can also be registered
+// as "type/*", which handles all subtypes of the type that do not have their own
+// handler. Registering a mime type again replaces its handler.
+func registerContentHandler(h ContentHandler, mimes ...string) {
+	for _, mime := range mimes {
+		contentHandlers[mime] = h
+	}
+}
+
+// Returns the handler for the mime type, or nil if there isn't one.
+func contentHandlerFor(mime string) ContentHandler {
+	if h, ok := contentHandlers[mime]; ok {
+		return h
+	}
+	if i := strings.Index(mime, "/"); i >= 0 {
+		return contentHandlers[mime[:i]+"/*"]
+	}
+	return nil
+}
+
+// Scrapes HTML documents for links, page information, redirects, and alternates.
+// Documents are scanned token by token, so are never buffered to be scraped.
+type htmlHandler struct {
+	// Largest single token, e.g: an inline script, the handler will buffer.
+	// Zero for no limit.
+	maxToken int
+}
+
+func (h htmlHandler) Scrape(page *Page, pageURL *url.URL, header http.Header, body []byte) []string {
+	urls, _ := h.ScrapeStream(page, pageURL, header, bytes.NewReader(body))
+	return urls
+}
+
+func (h htmlHandler) ScrapeStream(page *Page, pageURL *url.URL, header http.Header, body io.Reader) ([]string, error) {
+	scan, err := scanHTML(body, h.maxToken)
+	if err == html.ErrBufferExceeded {
+		err = errOverMemoryBudget
+	}
+	page.Info = scan.info
+	page.Hints = scan.hints
+	if err == nil && scan.elements == 0 && scan.info.WordCount > 0 {
+		page.ParseError = "No HTML elements found"
+	}
+	addHeaderPageInfo(&page.Info, header)
+	page.Redirects = normalizeRedirects(pageURL, scan.redirects)
+	page.Alternates = normalizeAlternates(pageURL, scan.alternates)
+	return scan.urls, err
+}
+
+// Scrapes JSON documents for strings which look like URLs. Escaped forward
+// slashes, e.g: "http:\/\/example.com", are unescaped first. Invalid JSON is
+// scraped the same way, but is reported as a parse error of the page.
+func scrapeJSON(page *Page, pageURL *url.URL, header http.Header, body []byte) []string {
+	if !json.Valid(body) {
+		err := json.Unmarshal(body, &json.RawMessage{})
+		page.ParseError = fmt.Sprintf("Invalid JSON, %v", err)
+	}
+	return findGenericDocURLs(bytes.Replace(body, []byte(`\/`), []byte("/"), -1))
+}
+
+// Scrapes any document for strings which look like URLs. For PDFs this only
+// finds the URLs of links which are not within compressed streams.
+func scrapeGeneric(page *Page, pageURL *url.URL, header http.Header, body []byte) []string {
+	return findGenericDocURLs(body)
+}
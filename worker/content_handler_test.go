@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestContentHandlerFor(t *testing.T) {
+	assert.NotNil(t, contentHandlerFor("text/html"), "Expect HTML handler")
+	assert.NotNil(t, contentHandlerFor("application/pdf"), "Expect PDF handler")
+	assert.Nil(t, contentHandlerFor("image/png"), "Expect no image handler")
+	assert.Nil(t, contentHandlerFor("video/x-custom"), "Expect no handler before registered")
+
+	var handled *url.URL
+	registerContentHandler(ContentHandlerFunc(func(page *Page, pageURL *url.URL, header http.Header, body []byte) []string {
+		handled = pageURL
+		return []string{"/found"}
+	}), "video/*")
+	defer delete(contentHandlers, "video/*")
+
+	h := contentHandlerFor("video/x-custom")
+	require.NotNil(t, h, "Expect wildcard handler")
+	pageURL, _ := url.Parse("http://example.com/")
+	assert.Equal(t, []string{"/found"}, h.Scrape(&Page{}, pageURL, nil, nil), "Expect handler URLs")
+	assert.Equal(t, pageURL, handled, "Expect handler called with page URL")
+}
+
+func TestScrapeXML(t *testing.T) {
+	h := newXMLHandler(defaultXMLURLNames)
+	urls := h.Scrape(&Page{}, nil, nil, []byte(`<urlset><url><loc>http://example.com/a</loc></url></urlset>`))
+	assert.Equal(t, []string{"http://example.com/a"}, urls, "Expect sitemap URLs")
+
+	urls = h.Scrape(&Page{}, nil, nil, []byte(`<rss><channel><link>http://example.com/b</link></channel></rss>`))
+	assert.Equal(t, []string{"http://example.com/b"}, urls, "Expect generic XML URLs")
+}
+
+func TestScrapeJSON(t *testing.T) {
+	urls := scrapeJSON(&Page{}, nil, nil, []byte(`{"next": "http:\/\/example.com\/page\/2", "home": "https://example.com/"}`))
+	assert.Equal(t, []string{"http://example.com/page/2", "https://example.com/"}, urls, "Expect unescaped JSON URLs")
+}
+
+func TestScrapeContentHandlers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.4 << /A << /S /URI /URI (http://example.com/linked) >> >>"))
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.Write([]byte(`{"url": "http://example.com/json", "again": "http://example.com/json"}`))
+		case "/image.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("http://example.com/not-scraped"))
+		}
+	}))
+	defer server.Close()
+
+	page, err := Scrape(server.URL+"/doc.pdf", httpFetcher{client: http.DefaultClient}, scrapeOptions{})
+	require.NoError(t, err, "Expect PDF scraped")
+	assert.Equal(t, []string{"http://example.com/linked"}, page.URLs, "Expect PDF link URL")
+
+	page, err = Scrape(server.URL+"/data.json", httpFetcher{client: http.DefaultClient}, scrapeOptions{})
+	require.NoError(t, err, "Expect JSON scraped")
+	assert.Equal(t, []string{"http://example.com/json"}, page.URLs, "Expect de-duped JSON URLs")
+
+	page, err = Scrape(server.URL+"/image.png", httpFetcher{client: http.DefaultClient}, scrapeOptions{})
+	require.NoError(t, err, "Expect image requested")
+	assert.Nil(t, page.Body, "Expect image body not read")
+	assert.Empty(t, page.URLs, "Expect image not scraped")
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"log"
+	"sync"
+	"time"
+)
+
+// Interval the URLs crawled by jobs without a max are added to their job's
+// count.
+const crawledFlushInterval = 5 * time.Second
+
+// Counts the URLs crawled by jobs without a max URLs budget, and adds them to
+// their job's count in batches, so concurrent crawls of a job don't all update
+// the job's row. Safe to use across multiple go routines.
+type crawledCounter struct {
+	jc *storage.JobClient
+
+	mu     sync.Mutex
+	counts map[common.JobId]int
+}
+
+// Creates a counter adding the counts with the job client.
+func newCrawledCounter(jc *storage.JobClient) *crawledCounter {
+	return &crawledCounter{jc: jc, counts: map[common.JobId]int{}}
+}
+
+// Counts a URL crawled by the job. A nil counter counts nothing.
+func (c *crawledCounter) add(jobId common.JobId) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.counts[jobId]++
+	c.mu.Unlock()
+}
+
+// Adds the counted URLs to their job's count. Counts which fail to be added
+// are kept to be added by the next flush.
+func (c *crawledCounter) flush() {
+	c.mu.Lock()
+	counts := c.counts
+	c.counts = map[common.JobId]int{}
+	c.mu.Unlock()
+
+	for jobId, n := range counts {
+		if err := c.jc.AddURLsCrawled(jobId, n); err != nil {
+			log.Println("crawl: Failed to add job's crawled URLs", jobId, n, err)
+			c.mu.Lock()
+			c.counts[jobId] += n
+			c.mu.Unlock()
+		}
+	}
+}
+
+// Periodically flushes the counts. Blocks forever, and is expected to be run
+// in its own go routine.
+func (c *crawledCounter) flushEvery(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		c.flush()
+	}
+}
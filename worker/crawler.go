@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/errreport"
 	"github.com/jasdel/harvester/internal/queue"
 	"github.com/jasdel/harvester/internal/storage"
 	"log"
@@ -16,15 +18,132 @@ type Crawler struct {
 	urlQueuePub queue.Publisher
 	sc          *storage.Client
 	maxLevel    int
+
+	// Algorithm used to score the job's internal links once the job completes.
+	linkScoring string
+
+	// Versions of crawled HTML pages to store. None are stored if empty.
+	storeHTML string
+
+	// Fetcher URLs are fetched with. May reuse responses from the fetch cache.
+	fetcher Fetcher
+
+	// Fetcher of the jobs which opted out of the fetch cache, and of the
+	// requests made on behalf of crawls, e.g: well-known files.
+	uncached Fetcher
+
+	// Robots.txt policy URLs are checked against before being crawled. Nil
+	// if robots.txt files are ignored.
+	robots *robotsPolicy
+
+	// Policy of which redirects found in page content are followed.
+	redirectPolicy string
+
+	// Checks the well-known files, e.g: security.txt, of crawled hosts.
+	wellKnown *wellKnownChecker
+
+	// Captures the favicon and name of crawled sites.
+	siteIdentity *siteIdentityChecker
+
+	// Memory budget response bodies are buffered within.
+	budget *memoryBudget
+
+	// Records the crawled queue items into replayable traces. Nil if
+	// crawls are not traced.
+	tracer *crawlTracer
+
+	// Records the fetched responses into the cassette of their job. Nil if
+	// responses are not recorded.
+	recorder *cassetteRecorder
+
+	// Writes the fetched responses into the WARC file of their job. Nil if
+	// responses are not written.
+	warcs *warcRecorder
+
+	// Times the stages of sampled crawls. Nil if stages are not timed.
+	metrics *stageMetrics
+
+	// Downloads the files of download jobs. Nil if the worker doesn't
+	// download files.
+	downloads *downloader
+
+	// Embeds the main text extracted from pages. Nil if text is not
+	// embedded.
+	embeddings *embedder
+
+	// What is skipped once a URL responds 451 Unavailable For Legal Reasons.
+	// One of the legalSkip constants.
+	legalSkip string
+
+	// Panics of a URL's crawls before the URL is poisoned, and no longer
+	// crawled. Zero if URLs are never poisoned.
+	poisonAfter int
+
+	// Counts the recovered panics, and reports them to the error reporting
+	// service if configured. Nil if panics are only logged.
+	reporter *errreport.Reporter
+
+	// Counts the URLs crawled by jobs without a max, to be added to their
+	// job's count in batches.
+	crawled *crawledCounter
+}
+
+// Dependencies, and settings a Crawler is created with. See the Crawler's
+// fields for what each is used for. Optional dependencies are nil if their
+// feature isn't enabled.
+type CrawlerConfig struct {
+	URLQueuePub queue.Publisher
+	Storage     *storage.Client
+	MaxLevel    int
+
+	LinkScoring    string
+	StoreHTML      string
+	RedirectPolicy string
+	LegalSkip      string
+	PoisonAfter    int
+
+	// Fetchers of URLs, and of the jobs which opted out of the fetch cache
+	Fetcher  Fetcher
+	Uncached Fetcher
+
+	Robots     *robotsPolicy
+	Budget     *memoryBudget
+	Tracer     *crawlTracer
+	Recorder   *cassetteRecorder
+	WARCs      *warcRecorder
+	Metrics    *stageMetrics
+	Downloads  *downloader
+	Embeddings *embedder
+	Reporter   *errreport.Reporter
+	Crawled    *crawledCounter
 }
 
 // Creates a new instance of the Crawler. The crawler is save to be run across multiple
 // go-routines.
-func NewCrawler(urlQueuePub queue.Publisher, sc *storage.Client, maxLevel int) *Crawler {
+func NewCrawler(cfg CrawlerConfig) *Crawler {
 	return &Crawler{
-		urlQueuePub: urlQueuePub,
-		sc:          sc,
-		maxLevel:    maxLevel,
+		urlQueuePub:    cfg.URLQueuePub,
+		sc:             cfg.Storage,
+		maxLevel:       cfg.MaxLevel,
+		linkScoring:    cfg.LinkScoring,
+		storeHTML:      cfg.StoreHTML,
+		fetcher:        cfg.Fetcher,
+		uncached:       cfg.Uncached,
+		robots:         cfg.Robots,
+		redirectPolicy: cfg.RedirectPolicy,
+		wellKnown:      newWellKnownChecker(fetcherClient(cfg.Recorder.fetcher(sharedCassette, cfg.Uncached)), cfg.Storage, cfg.Robots),
+		siteIdentity:   newSiteIdentityChecker(fetcherClient(cfg.Recorder.fetcher(sharedCassette, cfg.Uncached)), cfg.Storage, cfg.Robots),
+		budget:         cfg.Budget,
+		tracer:         cfg.Tracer,
+		recorder:       cfg.Recorder,
+		warcs:          cfg.WARCs,
+		metrics:        cfg.Metrics,
+		downloads:      cfg.Downloads,
+		embeddings:     cfg.Embeddings,
+		legalSkip:      cfg.LegalSkip,
+		poisonAfter:    cfg.PoisonAfter,
+		reporter:       cfg.Reporter,
+		crawled:        cfg.Crawled,
 	}
 }
 
@@ -37,59 +156,667 @@ func NewCrawler(urlQueuePub queue.Publisher, sc *storage.Client, maxLevel int) *
 // and a check to determine if there are anymore pending URLs for the item's Origin
 // will be made. If there are no longer any pending URLs the Origin's Job URL entry
 // will be marked as completed.
+//
+// Crawl runs each stage of the crawl in turn. See Run for running the stages
+// of many crawls concurrently. Panics of the crawl's stages are recovered from,
+// and recorded against the item's URL.
 func (c *Crawler) Crawl(item *common.URLQueueItem) {
-	startedAt := time.Now()
-	urlClient := c.sc.URLClient()
+	t := newCrawlTask(item)
+	// Make sure the Job is cleaned up even in if an error happens.
+	defer c.finishRecovered(t)
 
-	defer func() {
-		// Make sure the Job is cleaned up even in if an error happens.
-		if err := urlClient.DeletePending(item.JobId, item.URLId, item.OriginId); err != nil {
-			log.Println("crawl: Failed to delete pending record for", item.URLId, item.OriginId)
+	for _, stage := range c.stages() {
+		if !stage(t) {
+			return
 		}
-		log.Println("crawl: Finished crawling of", item.URLId, item.Level, "duration", time.Now().Sub(startedAt).String())
+	}
+}
 
-		// If there are no more pending entries for this origin, all jobs which contain that
-		// origin which are not already complete can be marked as complete.
-		if complete, err := urlClient.UpdateJobURLIfComplete(item.JobId, item.OriginId); err != nil {
-			log.Println("crawl: Failed to update if Job URL is complete", item.OriginId, err)
-		} else if complete {
-			log.Println("crawl: Marked Job URL as complete", item.JobId, item.OriginId)
-		}
+// State of a URL's crawl as it is passed between the stages of the crawl.
+type crawlTask struct {
+	item      *common.URLQueueItem
+	startedAt time.Time
 
-	}()
+	// URL record of the item, set by the fetch stage.
+	urlRec *storage.URL
+
+	// Response of the URL, set by the fetch stage. Its body is unread until
+	// the parse stage scrapes it, and is nil once scraped.
+	resp        *http.Response
+	requestedAt time.Time
+
+	// Page scraped from the response, set by the parse stage.
+	page *Page
+
+	// Tags of the kinds of content the page is, set by the classify stage.
+	tags []string
+
+	// Flags of the job the page is matched against, set by the parse stage,
+	// and the names of those the page matched, set by the classify stage.
+	flags   []common.JobFlag
+	flagged []string
+
+	// If the main text of the page is extracted, set by the parse stage.
+	extractText bool
+
+	// Descendant URLs of the page, and if the page's content is unchanged
+	// since it was last crawled, set by the extract stage.
+	urls      []string
+	unchanged bool
+
+	// If the response's links are not followed, and the delay before the
+	// URL is retried, set by the fetch stage from the job's status rules.
+	recordOnly bool
+	retryDelay time.Duration
+
+	// Decision the crawl ended with, and the traced response of the URL,
+	// recorded if the crawl is traced.
+	decision  string
+	traceResp *traceResponse
+
+	// Duration of each stage of the crawl, nil if the crawl isn't sampled.
+	timing *stageTiming
+}
+
+// Creates a crawl task of the item.
+func newCrawlTask(item *common.URLQueueItem) *crawlTask {
+	return &crawlTask{item: item, startedAt: time.Now()}
+}
+
+// A stage of a crawl. Returns false if the crawl should not continue on to
+// its next stage.
+type crawlStage func(t *crawlTask) bool
+
+// Fetch stage of the crawl. Checks the item's URL may be crawled, and requests
+// it. The response's body is left unread, to be streamed by the parse stage.
+func (c *Crawler) fetch(t *crawlTask) bool {
+	item := t.item
+
+	// Items of jobs cancelled after the item was queued are skipped.
+	if c.jobCancelled(item.JobId) {
+		log.Println("crawl: Skipping item of cancelled job", item.JobId, item.URLId)
+		t.decision = traceJobCancelled
+		return false
+	}
+
+	// URLs which repeatedly panicked workers are not crawled again.
+	if c.poisoned(item.URLId) {
+		log.Println("crawl: Skipping poisoned URL", item.JobId, item.URLId)
+		t.decision = tracePoisoned
+		return false
+	}
 
 	urlRec, err := c.sc.URLClient().GetURLById(item.URLId)
 	if err != nil || urlRec == nil {
 		log.Println("Failed to get URL record for URLId", item.URLId)
-		return
+		t.decision = traceNoURLRecord
+		return false
+	}
+	t.urlRec = urlRec
+
+	// Opted out hosts are never crawled. If the registry can't be checked
+	// the URL is skipped, instead of risking crawling an opted out host.
+	host := common.URLHost(urlRec.URL)
+	if optOut, err := c.sc.HostClient().GetOptOut(host); err != nil {
+		log.Println("crawl: Failed to check opt out, skipping", item.URLId, urlRec.URL, err)
+		t.decision = traceOptOutUnavailable
+		return false
+	} else if optOut != nil {
+		log.Println("crawl: Skipping opted out host", optOut.Host, "url", urlRec.URL, "reason:", optOut.Reason)
+		t.decision = traceOptedOut
+		return false
+	}
+
+	// URLs which responded 451 are not crawled again, if the worker skips them.
+	if c.legallyRestricted(item.URLId) {
+		log.Println("crawl: Skipping legally restricted URL", item.URLId, urlRec.URL)
+		t.decision = traceLegallyRestricted
+		return false
+	}
+
+	// URLs disallowed by their host's robots.txt are not crawled. If the
+	// robots.txt can't be requested the URL is skipped. Remote file servers
+	// don't have a robots.txt.
+	remoteFile := isRemoteFileURL(urlRec.URL)
+	if c.robots != nil && !remoteFile {
+		if allowed, err := c.robots.allow(urlRec.URL); err != nil {
+			log.Println("crawl: Failed to get robots.txt, skipping", item.URLId, urlRec.URL, err)
+			t.decision = traceRobotsUnavailable
+			return false
+		} else if !allowed {
+			log.Println("crawl: Skipping URL disallowed by robots.txt", item.URLId, urlRec.URL)
+			t.decision = traceRobotsDisallowed
+			return false
+		}
+	}
+
+	// Download jobs save the URL's content as a file, instead of crawling it.
+	if item.Download {
+		if c.claimURLBudget(t) {
+			c.download(t)
+		}
+		return false
 	}
 
-	mime, urls, err := Scrape(urlRec.URL, http.DefaultClient)
+	// The well-known files of the URL's host are stored as the host's metadata,
+	// and the favicon and name of the URL's site are captured once per job, in
+	// the background. Remote file servers don't have either.
+	if !remoteFile {
+		c.wellKnown.check(urlRec.URL)
+		c.siteIdentity.check(item.JobId, urlRec.URL)
+	}
+
+	// Jobs which opted out of the fetch cache always fetch from the URL's host.
+	fetcher := c.fetcher
+	if item.NoFetchCache {
+		fetcher = c.uncached
+	}
+	fetcher = c.recorder.fetcher(jobCassette(item.JobId), fetcher)
+	fetcher = c.warcs.fetcher(item.JobId, fetcher)
+
+	ctx := context.Background()
+	if t.timing = c.metrics.sample(); t.timing != nil {
+		ctx = t.timing.trace(ctx)
+	}
+
+	// The URL is only counted against the job's budget once nothing else
+	// can skip it.
+	if !c.claimURLBudget(t) {
+		return false
+	}
+
+	t.requestedAt = time.Now()
+	resp, err := fetcher.Fetch(ctx, urlRec.URL)
 	if err != nil {
-		log.Println("crawl: Failed to request and scrape", item.URLId, urlRec.URL, err)
-		return
+		c.logCrawl(item, urlRec.URL, t.requestedAt, nil)
+		log.Println("crawl: Failed to request", item.URLId, urlRec.URL, err)
+		t.decision = traceFetchFailed
+		return false
+	}
+	t.resp = resp
+	if t.timing != nil {
+		t.resp.Body = t.timing.timeBody(t.resp.Body)
+	}
+	if c.tracer != nil {
+		c.tracer.capture(t)
+	}
+	if resp.StatusCode == http.StatusUnavailableForLegalReasons {
+		c.recordLegalRestriction(t)
 	}
+	return c.applyStatusRule(t)
+}
+
+// Parse stage of the crawl. Scrapes the fetched response as its body is read.
+func (c *Crawler) parse(t *crawlTask) bool {
+	item, urlRec := t.item, t.urlRec
+	start := time.Now()
 
-	log.Println("crawl: Request and Scrape complete URL", item.URLId, urlRec.URL, "mime:", mime, "level", item.Level, "descendants", len(urls), "duration", time.Now().Sub(startedAt).String(), "error", err)
+	// HTML is kept if it is stored, matched against the job's flags, or its
+	// main text is extracted.
+	t.flags = c.jobFlags(item.JobId)
+	t.extractText = c.jobExtractText(item.JobId)
+
+	resp := t.resp
+	t.resp = nil
+	keepHTML := c.storeHTML != "" || len(t.flags) > 0 || t.extractText
+	page, err := scrapeResponse(resp, urlRec.URL, scrapeOptions{budget: c.budget, keepHTML: keepHTML})
+	if t.timing != nil {
+		t.timing.parsed(time.Now().Sub(start))
+	}
+	c.logCrawl(item, urlRec.URL, t.requestedAt, page)
+	if err != nil {
+		log.Println("crawl: Failed to scrape", item.URLId, urlRec.URL, err)
+		t.decision = traceScrapeFailed
+		return false
+	}
+	t.page = page
+	if page.Shed {
+		log.Println("crawl: Content exceeded memory budget, only partially scraped", item.URLId, urlRec.URL)
+	}
+
+	log.Println("crawl: Request and Scrape complete URL", item.URLId, urlRec.URL, "mime:", page.Mime, "level", item.Level, "descendants", len(page.URLs), "duration", time.Now().Sub(t.startedAt).String())
+	return true
+}
+
+// Extract stage of the crawl. Finds the descendant URLs of the page to be
+// followed, recording the page's alternates and redirects.
+func (c *Crawler) extract(t *crawlTask) bool {
+	item, urlRec, page := t.item, t.urlRec, t.page
+	urls := page.URLs
+
+	// A delta crawl only follows the links of pages whose content changed. The
+	// hash is compared before being replaced by marking the URL as crawled.
+	contentHash := page.ContentHash()
+	t.unchanged = item.Delta && contentHash != "" && contentHash == urlRec.ContentHash
+
+	// JSON responses of jobs with JSONPath expressions store the fields they
+	// select, and follow only the links they select.
+	if page.Mime == "application/json" && page.Body != nil {
+		if jsonURLs, ok := c.applyJSONPaths(item, urlRec.URL, page.Body); ok {
+			urls = jsonURLs
+		}
+	}
+
+	if t.unchanged {
+		return true
+	}
+
+	// Alternate representations of the page are recorded, and not crawled if
+	// the job skips alternates.
+	c.addAlternates(item, page.Alternates)
+	if item.SkipAlternates {
+		urls = withoutAlternates(urls, page.Alternates)
+	}
+
+	// Redirects found in the page's content are followed as descendants if
+	// allowed by the redirect policy.
+	urls = appendNewURLs(urls, c.addRedirects(item, urlRec.URL, page.Redirects))
+
+	// Job URLs also discover the URLs listed by the sitemaps of their host's
+	// robots.txt.
+	if item.Level == 0 && c.robots != nil {
+		urls = appendNewURLs(urls, c.robots.sitemapURLs(urlRec.URL))
+	}
+
+	t.urls = urls
+	return true
+}
+
+// Persist stage of the crawl. Stores the page's crawl, and adds its descendants
+// to the job's results, or the URL queue.
+func (c *Crawler) persist(t *crawlTask) bool {
+	item, urlRec, page := t.item, t.urlRec, t.page
+	urlClient := c.sc.URLClient()
+	mime := page.Mime
+
+	if t.timing != nil {
+		defer func(start time.Time) {
+			t.timing.persisted(time.Now().Sub(start))
+		}(time.Now())
+	}
 
 	// Update mime type for the URL
-	if err := urlClient.MarkCrawled(item.URLId, mime); err != nil {
+	if err := urlClient.MarkCrawled(item.URLId, mime, page.Status, page.ContentHash()); err != nil {
 		log.Println("crawl: failed to add update URL's mime type", item.URLId, mime, err)
-		return
+		t.decision = tracePersistFailed
+		return false
 	}
 	// Update the local urlRec mime value so don't need to re-query for it.
 	urlRec.Mime = mime
 
+	if page.ParseError != "" {
+		c.quarantine(t)
+	}
+	if page.DeclaredMime != "" {
+		mismatch := common.MimeMismatch{Declared: page.DeclaredMime, Sniffed: mime, DetectedOn: time.Now().UTC()}
+		if err := urlClient.AddMimeMismatch(item.JobId, item.URLId, mismatch); err != nil {
+			log.Println("crawl: failed to record URL's content type mismatch", item.URLId, err)
+		}
+	}
+	if err := urlClient.UpdatePageInfo(item.URLId, page.Info); err != nil {
+		log.Println("crawl: failed to update URL's page info", item.URLId, err)
+	}
+	if err := urlClient.SetTags(item.URLId, t.tags); err != nil {
+		log.Println("crawl: failed to update URL's tags", item.URLId, err)
+	}
+	if t.flags != nil {
+		if err := c.sc.JobClient().StoreFlagged(item.JobId, item.URLId, t.flagged); err != nil {
+			log.Println("crawl: failed to store URL's flags", item.URLId, err)
+		}
+	}
+
+	if c.storeHTML != "" && mime == "text/html" && page.Body != nil {
+		if err := urlClient.StoreHTML(c.pageHTML(item.URLId, page.Body)); err != nil {
+			log.Println("crawl: failed to store URL's HTML", item.URLId, err)
+		}
+	}
+	if t.extractText && mime == "text/html" && page.Body != nil {
+		text := storage.URLText{
+			URLId:    item.URLId,
+			Title:    page.Info.Title,
+			Text:     ExtractMainText(page.Body),
+			StoredOn: time.Now().UTC(),
+		}
+		if err := urlClient.StoreText(text); err != nil {
+			log.Println("crawl: failed to store URL's text", item.URLId, err)
+		}
+		c.embeddings.embedText(item.URLId, urlRec.URL, text.Title, text.Text)
+	}
+
 	// Only add items to the result if they are greater than the first layer
 	// because the first layer is the URLs that are used to start a job,
 	// so they do not make sense to be inserted into the results without a refer.
 	if item.Level > 0 {
-		urlClient.AddResult(item.JobId, item.ReferId, item.URLId)
+		urlClient.AddResult(item.JobId, item.ReferId, item.URLId, item.Level)
 	}
 
-	if err := c.processURLDescendants(item, urls); err != nil {
+	// Descendants are not queued if the job was cancelled during the crawl.
+	if c.jobCancelled(item.JobId) {
+		log.Println("crawl: Job cancelled, not following links of", item.URLId, urlRec.URL)
+		t.decision = traceJobCancelled
+		return true
+	}
+
+	// Responses recorded by the job's status rules don't have their links
+	// followed.
+	if t.recordOnly {
+		t.decision = traceStatusRecorded
+		log.Println("crawl: Status recorded, not following links of", item.URLId, urlRec.URL, "status", page.Status)
+		return true
+	}
+
+	t.decision = traceCrawled
+	if t.unchanged {
+		t.decision = traceUnchanged
+		log.Println("crawl: Content unchanged, not following links of", item.URLId, urlRec.URL)
+		if err := c.addKnownDescendants(item); err != nil {
+			log.Println("crawl: failed to add known descendants", err)
+		}
+		return true
+	}
+
+	if err := c.processURLDescendants(item, t.urls); err != nil {
 		log.Println("crawl: failed to process descendants", err)
 	}
+	return true
+}
+
+// Completes the crawl, whichever stage it ended at. Releases the crawl's
+// response and page, removes the item's pending URL, and marks the Job URL
+// complete if the origin has no more pending URLs.
+func (c *Crawler) finish(t *crawlTask) {
+	item := t.item
+	urlClient := c.sc.URLClient()
+
+	if t.resp != nil {
+		t.resp.Body.Close()
+		t.resp = nil
+	}
+	if c.tracer != nil {
+		c.tracer.record(t)
+	}
+	if skippedDecisions[t.decision] {
+		c.logSkip(t)
+	}
+	if t.timing != nil {
+		c.metrics.observe(t.timing)
+	}
+	if t.page != nil {
+		t.page.Release()
+	}
+
+	// Items retried by the job's status rules remain pending until retried.
+	if t.decision == traceStatusRetry {
+		c.retry(t)
+		log.Println("crawl: Finished crawling of", item.URLId, item.Level, "duration", time.Now().Sub(t.startedAt).String(), "retrying in", t.retryDelay)
+		return
+	}
+
+	if err := urlClient.DeletePending(item.JobId, item.URLId, item.OriginId); err != nil {
+		log.Println("crawl: Failed to delete pending record for", item.URLId, item.OriginId)
+	}
+	log.Println("crawl: Finished crawling of", item.URLId, item.Level, "duration", time.Now().Sub(t.startedAt).String())
+
+	// If there are no more pending entries for this origin, all jobs which contain that
+	// origin which are not already complete can be marked as complete.
+	if complete, err := urlClient.UpdateJobURLIfComplete(item.JobId, item.OriginId); err != nil {
+		log.Println("crawl: Failed to update if Job URL is complete", item.OriginId, err)
+	} else if complete {
+		log.Println("crawl: Marked Job URL as complete", item.JobId, item.OriginId)
+		c.scoreLinksIfJobComplete(item.JobId)
+	}
+}
+
+// Adds the previously found descendants of the item's URL to the job results
+// without queuing them to be crawled.
+func (c *Crawler) addKnownDescendants(referItem *common.URLQueueItem) error {
+	urlClient := c.sc.URLClient()
+
+	urlRecs, err := urlClient.GetAllURLsWithReferById(referItem.URLId)
+	if err != nil {
+		return fmt.Errorf("Failed to get URL descendants of %d, %v", referItem.URLId, err)
+	}
+	return urlClient.AddURLsToResults(referItem.JobId, referItem.URLId, urlRecs, referItem.Level+1)
+}
+
+// Records the redirects found in the content of the item's URL as redirect
+// edges, returning the URLs of the redirects the redirect policy allows to be
+// followed.
+func (c *Crawler) addRedirects(item *common.URLQueueItem, from string, redirects []Redirect) []string {
+	urlClient := c.sc.URLClient()
+
+	follow := []string{}
+	for _, r := range redirects {
+		urlRec, err := urlClient.GetOrAddURLByURL(r.URL, common.GuessURLsMime(r.URL))
+		if err != nil {
+			log.Println("crawl: failed to get or add redirect URL", r.URL, err)
+			continue
+		}
+		if err := urlClient.AddRedirect(item.URLId, urlRec.Id, r.Kind); err != nil {
+			log.Println("crawl: failed to add redirect", item.URLId, r.URL, err)
+		}
+
+		if followRedirect(c.redirectPolicy, from, r.URL) {
+			follow = append(follow, r.URL)
+		} else {
+			log.Println("crawl: Not following redirect", from, r.Kind, r.URL, "policy", c.redirectPolicy)
+		}
+	}
+	return follow
+}
+
+// Records the alternate representations of the item's URL. The alternates are
+// also linked to the URL, so they are known even if they are not crawled.
+func (c *Crawler) addAlternates(item *common.URLQueueItem, alternates []Alternate) {
+	urlClient := c.sc.URLClient()
+
+	for _, a := range alternates {
+		urlRec, err := urlClient.GetOrAddURLByURL(a.URL, common.GuessURLsMime(a.URL))
+		if err != nil {
+			log.Println("crawl: failed to get or add alternate URL", a.URL, err)
+			continue
+		}
+		urlClient.AddLink(urlRec.Id, item.URLId)
+		if err := urlClient.AddAlternate(item.URLId, urlRec.Id, a.Kind, a.Lang); err != nil {
+			log.Println("crawl: failed to add alternate", item.URLId, a.URL, err)
+		}
+	}
+}
+
+// Returns the versions of the page's HTML the crawler is configured to store.
+func (c *Crawler) pageHTML(urlId common.URLId, body []byte) storage.URLHTML {
+	h := storage.URLHTML{URLId: urlId, StoredOn: time.Now().UTC()}
+	if c.storeHTML == storeHTMLRaw || c.storeHTML == storeHTMLBoth {
+		h.Raw = string(body)
+	}
+	if c.storeHTML == storeHTMLSanitized || c.storeHTML == storeHTMLBoth {
+		h.Sanitized = string(SanitizeHTML(body))
+	}
+	return h
+}
+
+// Records the request of the URL in the crawl log, so the host's crawl history
+// is known. A nil page records a failed request. Pages reused from the fetch
+// cache were not requested from the host, and are not recorded.
+func (c *Crawler) logCrawl(item *common.URLQueueItem, u string, requestedAt time.Time, page *Page) {
+	if page != nil && page.Cached {
+		return
+	}
+	entry := storage.CrawlLogEntry{
+		JobId:     item.JobId,
+		URLId:     item.URLId,
+		Host:      common.URLHost(u),
+		CrawledOn: requestedAt.UTC(),
+		Duration:  time.Now().Sub(requestedAt),
+	}
+	if page != nil {
+		entry.Status = page.Status
+		entry.Bytes = page.Size
+	}
+
+	if err := c.sc.URLClient().AddCrawlLog(entry); err != nil {
+		log.Println("crawl: failed to add crawl log", item.URLId, err)
+	}
+}
+
+// Decisions of crawls skipped before their URL was requested.
+var skippedDecisions = map[string]bool{
+	traceJobCancelled:      true,
+	traceURLBudgetSpent:    true,
+	traceOptOutUnavailable: true,
+	traceOptedOut:          true,
+	traceRobotsUnavailable: true,
+	traceRobotsDisallowed:  true,
+	traceLegallyRestricted: true,
+	tracePoisoned:          true,
+}
+
+// Records the skipped crawl of the task's item, with the decision it was
+// skipped by, so it is included in the live crawl feed.
+func (c *Crawler) logSkip(t *crawlTask) {
+	entry := storage.CrawlSkipEntry{
+		JobId:     t.item.JobId,
+		URLId:     t.item.URLId,
+		SkippedOn: time.Now().UTC(),
+		Reason:    t.decision,
+	}
+
+	if err := c.sc.URLClient().AddCrawlSkip(entry); err != nil {
+		log.Println("crawl: failed to add crawl skip", t.item.URLId, err)
+	}
+}
+
+// Returns true if the job has been cancelled. If the job can't be checked
+// it is assumed not to be cancelled.
+func (c *Crawler) jobCancelled(jobId common.JobId) bool {
+	cancelled, err := c.sc.JobClient().IsCancelled(jobId)
+	if err != nil {
+		log.Println("crawl: Failed to check if job is cancelled", jobId, err)
+		return false
+	}
+	return cancelled
+}
+
+// Claims a URL of the job's budget for the task's URL about to be fetched. If
+// the job has already crawled its max URLs false is returned, and the job's
+// remaining pending URLs are dropped, so the job completes. URLs of jobs
+// without a max are counted in batches. If the budget can't be claimed the
+// URL is crawled anyway.
+func (c *Crawler) claimURLBudget(t *crawlTask) bool {
+	jobId := t.item.JobId
+	claimed, capped, err := c.sc.JobClient().ClaimURLBudget(jobId)
+	if err != nil {
+		log.Println("crawl: Failed to claim job URL budget", jobId, err)
+		return true
+	} else if claimed {
+		if !capped {
+			c.crawled.add(jobId)
+		}
+		return true
+	}
+
+	log.Println("crawl: Skipping item of job which has crawled its max URLs", jobId, t.item.URLId)
+	t.decision = traceURLBudgetSpent
+	if exhausted, err := c.sc.JobClient().ExhaustURLBudget(jobId); err != nil {
+		log.Println("crawl: Failed to drop pending URLs of job over its max URLs", jobId, err)
+	} else if exhausted {
+		log.Println("crawl: Job crawled its max URLs, dropped its pending URLs", jobId)
+		c.scoreLinksIfJobComplete(jobId)
+	}
+	return false
+}
+
+// Returns true if the job has crawled its max URLs, and its descendants should
+// no longer be queued. If the job can't be checked it is assumed not to have.
+func (c *Crawler) urlBudgetSpent(jobId common.JobId) bool {
+	spent, err := c.sc.JobClient().URLBudgetSpent(jobId)
+	if err != nil {
+		log.Println("crawl: Failed to check job URL budget", jobId, err)
+		return false
+	}
+	return spent
+}
+
+// Returns the check of whether the descendants of the item are within its job's
+// scope, relative to the job URL the item descends from. If the scope can't be
+// determined all descendants are considered within it.
+func (c *Crawler) jobScope(item *common.URLQueueItem) func(string) bool {
+	scope, err := c.sc.JobClient().Scope(item.JobId)
+	if err != nil {
+		log.Println("crawl: Failed to get job scope", item.JobId, err)
+		return func(string) bool { return true }
+	}
+	if scope == common.JobScopeAny {
+		return func(string) bool { return true }
+	}
+
+	origin, err := c.sc.URLClient().GetURLById(item.OriginId)
+	if err != nil {
+		log.Println("crawl: Failed to get job URL for scope", item.JobId, item.OriginId, err)
+		return func(string) bool { return true }
+	}
+	return func(u string) bool { return common.InJobScope(scope, origin.URL, u) }
+}
+
+// Returns the filter of the job's include, and exclude URL patterns. Nil, which
+// allows all URLs, is returned if the job has none, or they can't be read.
+func (c *Crawler) jobURLFilter(jobId common.JobId) *common.JobURLFilter {
+	patterns, err := c.sc.JobClient().URLPatterns(jobId)
+	if err != nil {
+		log.Println("crawl: Failed to get job URL patterns", jobId, err)
+		return nil
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	filter, err := common.NewJobURLFilter(patterns)
+	if err != nil {
+		log.Println("crawl: Failed to compile job URL patterns", jobId, err)
+		return nil
+	}
+	return filter
+}
+
+// Returns what is stripped from the links found on the job's pages. The default
+// tracking parameters are stripped if the job's rules can't be read.
+func (c *Crawler) jobURLStripping(jobId common.JobId) common.URLStripping {
+	stripping, err := c.sc.JobClient().URLStripping(jobId)
+	if err != nil {
+		log.Println("crawl: Failed to get job URL stripping", jobId, err)
+		return common.NewURLStripping(nil, false)
+	}
+	return stripping
+}
+
+// Strips the URLs with the stripping rules, dropping the URLs which duplicate
+// an earlier URL once stripped.
+func stripURLs(stripping common.URLStripping, urls []string) []string {
+	stripped := make([]string, 0, len(urls))
+	seen := make(map[string]struct{}, len(urls))
+	for _, u := range urls {
+		u = stripping.Strip(u)
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		seen[u] = struct{}{}
+		stripped = append(stripped, u)
+	}
+	return stripped
+}
+
+// Scores the job's internal links if all of the job's URLs have been completed.
+func (c *Crawler) scoreLinksIfJobComplete(jobId common.JobId) {
+	jobClient := c.sc.JobClient()
+	if complete, err := jobClient.IsComplete(jobId); err != nil || !complete {
+		return
+	}
+
+	if err := jobClient.ScoreLinks(jobId, c.linkScoring); err != nil {
+		log.Println("crawl: Failed to score job links", jobId, c.linkScoring, err)
+		return
+	}
+	log.Println("crawl: Scored job links", jobId, c.linkScoring)
 }
 
 // Iterates over the raw URLs fond on the page. These URLs will be added back into the
@@ -98,6 +825,20 @@ func (c *Crawler) Crawl(item *common.URLQueueItem) {
 func (c *Crawler) processURLDescendants(referItem *common.URLQueueItem, urls []string) error {
 	urlClient := c.sc.URLClient()
 
+	// Links which only differ by their tracking parameters, or fragment are
+	// recorded once.
+	urls = stripURLs(c.jobURLStripping(referItem.JobId), urls)
+
+	// Descendants of jobs which have crawled their max URLs are only added
+	// to the results.
+	queue := referItem.QueuesDescendants(c.maxLevel) && !c.urlBudgetSpent(referItem.JobId)
+	var inScope func(string) bool
+	var urlFilter *common.JobURLFilter
+	if queue {
+		inScope = c.jobScope(referItem)
+		urlFilter = c.jobURLFilter(referItem.JobId)
+	}
+
 	for i := 0; i < len(urls); i++ {
 		u := urls[i]
 
@@ -111,28 +852,23 @@ func (c *Crawler) processURLDescendants(referItem *common.URLQueueItem, urls []s
 		urlClient.AddLink(urlRec.Id, referItem.URLId)
 
 		// Only process the URLs for queue, or skipping, if the max level would
-		// wouldn't be reached yet.
-		if referItem.Level+1 < c.maxLevel {
+		// wouldn't be reached yet, or the job's max depth, or max URLs exceeded.
+		// Links outside of the job's scope, or excluded by its URL patterns
+		// are never queued.
+		if queue && inScope(u) && urlFilter.Allows(u) {
 			if common.CanSkipMime(kind) {
-				urlClient.AddResult(referItem.JobId, referItem.URLId, urlRec.Id)
+				urlClient.AddResult(referItem.JobId, referItem.URLId, urlRec.Id, referItem.Level+1)
 			}
 
-			q := &common.URLQueueItem{
-				JobId:      referItem.JobId,
-				OriginId:   referItem.OriginId,
-				ReferId:    referItem.URLId,
-				URLId:      urlRec.Id,
-				Level:      referItem.Level + 1,
-				ForceCrawl: referItem.ForceCrawl,
-			}
-			if err := urlClient.AddPending(referItem.JobId, urlRec.Id, q.OriginId); err != nil {
+			q := referItem.Descendant(urlRec.Id)
+			if err := urlClient.AddPending(q); err != nil {
 				log.Println("crawl: failed to add pending URL", err)
 			}
 
 			c.urlQueuePub.Send(q)
 		} else {
 			// For any URL that will not be enqueued, add it as a result instead
-			urlClient.AddResult(referItem.JobId, referItem.URLId, urlRec.Id)
+			urlClient.AddResult(referItem.JobId, referItem.URLId, urlRec.Id, referItem.Level+1)
 		}
 	}
 
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// IP families hosts can be connected with
+const (
+	ipFamilyIPv4 = "ipv4"
+	ipFamilyIPv6 = "ipv6"
+)
+
+// Timeout and keep alive of connections, the same as http.DefaultTransport's.
+const (
+	dialTimeout   = 30 * time.Second
+	dialKeepAlive = 30 * time.Second
+)
+
+// Fallback delay of happy eyeballs if not configured, the same as net.Dialer's.
+const defaultFallbackDelay = 300 * time.Millisecond
+
+// Connections to the hosts crawled, for hosts whose IPv4 or IPv6 addresses
+// are broken, e.g: AAAA records of hosts which aren't reachable over IPv6.
+type DialConfig struct {
+	// IP family hosts are connected with, either "ipv4" or "ipv6". The
+	// addresses of the other family are never connected to. Both families
+	// are used if not set.
+	IPFamily string `json:"ipFamily"`
+
+	// Delay after connecting to a host's first address before connecting to
+	// its address of the other family in parallel, if the first hasn't
+	// connected yet, RFC 6555 happy eyeballs. A negative delay disables the
+	// fallback. Defaults to 300ms. time.Duration string formated value, e.g: 100ms
+	FallbackDelayStr string `json:"fallbackDelay"`
+
+	// The FallbackDelayStr will be parsed, and its value placed into this field.
+	FallbackDelay time.Duration `json:"-"`
+}
+
+// Validates the IP family and parses the fallback delay if configured.
+func (c *DialConfig) setDefaults() error {
+	switch c.IPFamily {
+	case "", ipFamilyIPv4, ipFamilyIPv6:
+	default:
+		return fmt.Errorf("Invalid dial ipFamily %s, must be %s or %s", c.IPFamily, ipFamilyIPv4, ipFamilyIPv6)
+	}
+
+	if c.FallbackDelayStr != "" {
+		delay, err := time.ParseDuration(c.FallbackDelayStr)
+		if err != nil {
+			return fmt.Errorf("Invalid dial fallbackDelay %q, %v", c.FallbackDelayStr, err)
+		}
+		c.FallbackDelay = delay
+	}
+	return nil
+}
+
+// Returns the dialer of the configuration's fallback delay.
+func (c DialConfig) dialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout:       dialTimeout,
+		KeepAlive:     dialKeepAlive,
+		FallbackDelay: c.FallbackDelay,
+	}
+}
+
+// Returns the network restricted to the configured IP family, e.g: tcp4
+// instead of tcp. Networks of a specific family are returned as is.
+func (c DialConfig) network(network string) string {
+	if network != "tcp" && network != "udp" && network != "ip" {
+		return network
+	}
+	switch c.IPFamily {
+	case ipFamilyIPv4:
+		return network + "4"
+	case ipFamilyIPv6:
+		return network + "6"
+	}
+	return network
+}
+
+// Returns the dial function connecting with the configuration, resolving
+// hosts with the system resolver.
+func (c DialConfig) dialContext() dialContextFn {
+	d := c.dialer()
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, c.network(network), addr)
+	}
+}
+
+// Connects to the first of the IPs which connects. IPs of the first IP's
+// family are connected to in turn, and the IPs of the other family are
+// connected to in parallel after the dialer's fallback delay, unless it is
+// negative.
+func dialIPs(ctx context.Context, d *net.Dialer, network string, ips []net.IP, port string) (net.Conn, error) {
+	var primaries, fallbacks []string
+	for _, ip := range ips {
+		addr := net.JoinHostPort(ip.String(), port)
+		if (ip.To4() != nil) == (ips[0].To4() != nil) {
+			primaries = append(primaries, addr)
+		} else {
+			fallbacks = append(fallbacks, addr)
+		}
+	}
+	if len(fallbacks) == 0 || d.FallbackDelay < 0 {
+		return dialSerial(ctx, d, network, append(primaries, fallbacks...))
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	results := make(chan dialResult, 2)
+	race := func(addrs []string, primary bool) {
+		conn, err := dialSerial(ctx, d, network, addrs)
+		results <- dialResult{conn: conn, err: err, primary: primary}
+	}
+	go race(primaries, true)
+
+	delay := d.FallbackDelay
+	if delay == 0 {
+		delay = defaultFallbackDelay
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var firstErr error
+	pending := 1
+	fallbackStarted := false
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go race(fallbacks, false)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				// Connections of the race which lost are closed.
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						if other := <-results; other.conn != nil {
+							other.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			if firstErr == nil || res.primary {
+				firstErr = res.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				go race(fallbacks, false)
+			} else if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// Connects to each of the addresses in turn, until one connects. The error
+// of the last address is returned if none connect.
+func dialSerial(ctx context.Context, d *net.Dialer, network string, addrs []string) (net.Conn, error) {
+	err := fmt.Errorf("No addresses to connect to")
+	for _, addr := range addrs {
+		var conn net.Conn
+		if conn, err = d.DialContext(ctx, network, addr); err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+// Creates a HTTP transport, with the settings of the default transport,
+// connecting to hosts with the dial function.
+func newDialTransport(dial dialContextFn) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.DialContext = dial
+	return t
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialConfigSetDefaults(t *testing.T) {
+	cfg := DialConfig{}
+	require.NoError(t, cfg.setDefaults())
+	assert.Equal(t, time.Duration(0), cfg.FallbackDelay, "Expect net.Dialer's default delay")
+
+	cfg = DialConfig{IPFamily: ipFamilyIPv4, FallbackDelayStr: "-1ms"}
+	require.NoError(t, cfg.setDefaults())
+	assert.Equal(t, -time.Millisecond, cfg.FallbackDelay, "Expect fallback disabled")
+
+	for _, c := range []DialConfig{{IPFamily: "ipv5"}, {FallbackDelayStr: "soon"}} {
+		assert.Error(t, c.setDefaults(), "Expect %v invalid", c)
+	}
+}
+
+func TestDialConfigNetwork(t *testing.T) {
+	assert.Equal(t, "tcp", DialConfig{}.network("tcp"))
+	assert.Equal(t, "tcp4", DialConfig{IPFamily: ipFamilyIPv4}.network("tcp"))
+	assert.Equal(t, "udp6", DialConfig{IPFamily: ipFamilyIPv6}.network("udp"))
+	assert.Equal(t, "tcp6", DialConfig{IPFamily: ipFamilyIPv4}.network("tcp6"), "Expect specific family unchanged")
+	assert.Equal(t, "unix", DialConfig{IPFamily: ipFamilyIPv4}.network("unix"))
+}
+
+func TestDialIPsFallback(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err, "Expect listener")
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	// Nothing listens on the IPv6 loopback, so the IPv4 fallback connects.
+	ips := []net.IP{net.ParseIP("::1"), net.ParseIP("127.0.0.1")}
+	for _, delay := range []time.Duration{0, time.Hour, -1} {
+		d := DialConfig{FallbackDelay: delay}.dialer()
+		conn, err := dialIPs(context.Background(), d, "tcp", ips, port)
+		require.NoError(t, err, "Expect fallback connected, delay %v", delay)
+		assert.Equal(t, l.Addr().String(), conn.RemoteAddr().String())
+		conn.Close()
+	}
+
+	_, err = dialIPs(context.Background(), DialConfig{}.dialer(), "tcp", ips[:1], port)
+	assert.Error(t, err, "Expect no connection")
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"golang.org/x/net/dns/dnsmessage"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Content type of DNS messages exchanged with DNS-over-HTTPS endpoints.
+const dohMessageType = "application/dns-message"
+
+// Timeout of resolving a name with the DNS-over-HTTPS endpoint if not
+// configured.
+const defaultDoHTimeout = 5 * time.Second
+
+// Largest DNS-over-HTTPS response read, the largest DNS message.
+const maxDoHResponseSize = 65535
+
+// Maximum number of hosts whose addresses are cached by the resolver.
+const maxDoHCachedHosts = 10000
+
+// Resolution of the names of the hosts the worker connects to.
+type DNSConfig struct {
+	// URL of a DNS-over-HTTPS (RFC 8484) endpoint names are resolved with,
+	// instead of the system resolver, for networks where plain DNS is
+	// filtered or monitored, e.g: https://1.1.1.1/dns-query. The endpoint's
+	// own host is resolved by the system resolver, so the URL should use its
+	// IP address for no plain DNS to be sent. Not used if not set.
+	DoHURL string `json:"dohURL"`
+
+	// Timeout of each query to the endpoint. Defaults to 5s.
+	// time.Duration string formated value, e.g: 2s
+	TimeoutStr string `json:"timeout"`
+
+	// The TimeoutStr will be parsed, and its value placed into this field.
+	Timeout time.Duration `json:"-"`
+}
+
+// Sets the default timeout if not configured, and validates the endpoint.
+func (c *DNSConfig) setDefaults() error {
+	c.Timeout = defaultDoHTimeout
+	if c.TimeoutStr != "" {
+		timeout, err := time.ParseDuration(c.TimeoutStr)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid dns timeout %q, must be a positive duration", c.TimeoutStr)
+		}
+		c.Timeout = timeout
+	}
+
+	if c.DoHURL != "" {
+		u, err := url.Parse(c.DoHURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("Invalid dns dohURL %s, must be a https URL", c.DoHURL)
+		}
+	}
+	return nil
+}
+
+// Dials connections to a network address, e.g: net.Dialer.DialContext.
+type dialContextFn func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// Resolver of host names with a DNS-over-HTTPS endpoint. Addresses are
+// cached for the TTL of their records, so each host is only resolved once
+// per TTL, instead of once per connection. At most maxDoHCachedHosts hosts
+// are cached. Only the addresses of the dial
+// configuration's IP family are resolved.
+type dohResolver struct {
+	endpoint string
+	client   *http.Client
+	dial     DialConfig
+	dialer   *net.Dialer
+
+	mu    sync.Mutex
+	cache map[string]dohCacheEntry
+
+	// Current time, replaced by tests.
+	now func() time.Time
+}
+
+// Addresses of a host cached until they expire.
+type dohCacheEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// Creates a resolver querying the configured DNS-over-HTTPS endpoint, and
+// connecting to the addresses resolved with the dial configuration.
+func newDoHResolver(cfg DNSConfig, dial DialConfig) *dohResolver {
+	return &dohResolver{
+		endpoint: cfg.DoHURL,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		dial:     dial,
+		dialer:   dial.dialer(),
+		cache:    map[string]dohCacheEntry{},
+		now:      time.Now,
+	}
+}
+
+// Dials the address, resolving its host with the endpoint. The host's IPv4
+// addresses are dialed first, falling back to its IPv6 addresses after the
+// dial configuration's fallback delay, see dialIPs. Reports the resolution to
+// the context's httptrace.ClientTrace, so it is timed as the crawl's DNS stage.
+func (r *dohResolver) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	ips, err := r.LookupIP(ctx, host)
+	if trace != nil && trace.DNSDone != nil {
+		addrs := make([]net.IPAddr, 0, len(ips))
+		for _, ip := range ips {
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+		trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return dialIPs(ctx, r.dialer, r.dial.network(network), ips, port)
+}
+
+// Returns the IPv4 and IPv6 addresses of the host, from the cache if they
+// haven't expired. Addresses of the family not configured to be dialed are
+// not queried. IP addresses are returned as is.
+func (r *dohResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	now := r.now()
+	r.mu.Lock()
+	entry, ok := r.cache[host]
+	r.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.ips, nil
+	}
+
+	name, err := dnsmessage.NewName(dnsName(host))
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: host}
+	}
+	var ips, ips6 []net.IP
+	var ttl, ttl6 uint32
+	if r.dial.IPFamily != ipFamilyIPv6 {
+		if ips, ttl, err = r.query(ctx, name, dnsmessage.TypeA); err != nil {
+			return nil, &net.DNSError{Err: err.Error(), Name: host, Server: r.endpoint}
+		}
+	}
+	if r.dial.IPFamily != ipFamilyIPv4 {
+		if ips6, ttl6, err = r.query(ctx, name, dnsmessage.TypeAAAA); err != nil {
+			return nil, &net.DNSError{Err: err.Error(), Name: host, Server: r.endpoint}
+		}
+	}
+	if len(ips) == 0 || (len(ips6) > 0 && ttl6 < ttl) {
+		ttl = ttl6
+	}
+	ips = append(ips, ips6...)
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host, Server: r.endpoint, IsNotFound: true}
+	}
+
+	r.mu.Lock()
+	r.cache[host] = dohCacheEntry{ips: ips, expires: now.Add(time.Duration(ttl) * time.Second)}
+	r.prune(now)
+	r.mu.Unlock()
+	return ips, nil
+}
+
+// Drops cached addresses once more than maxDoHCachedHosts hosts are cached.
+// Expired addresses are dropped first, then of any host, until half are left.
+// Expects the lock to be held.
+func (r *dohResolver) prune(now time.Time) {
+	if len(r.cache) <= maxDoHCachedHosts {
+		return
+	}
+	for host, entry := range r.cache {
+		if !now.Before(entry.expires) {
+			delete(r.cache, host)
+		}
+	}
+	for host := range r.cache {
+		if len(r.cache) <= maxDoHCachedHosts/2 {
+			break
+		}
+		delete(r.cache, host)
+	}
+}
+
+// Queries the endpoint for the name's records of the type, returning their
+// addresses, and the lowest TTL of the records. A name which does not exist
+// has no addresses.
+func (r *dohResolver) query(ctx context.Context, name dnsmessage.Name, qtype dnsmessage.Type) ([]net.IP, uint32, error) {
+	// The ID is always 0, as RFC 8484 recommends. Queries are POSTed, so
+	// aren't cached by HTTP caches, the resolver caches their addresses.
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: true})
+	b.EnableCompression()
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: name, Type: qtype, Class: dnsmessage.ClassINET})
+	msg, err := b.Finish()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest("POST", r.endpoint, bytes.NewReader(msg))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", dohMessageType)
+	req.Header.Set("Accept", dohMessageType)
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DNS-over-HTTPS endpoint responded with %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return parseDoHAnswers(body, qtype)
+}
+
+// Returns the addresses of the response's records of the type, and their
+// lowest TTL. Records of other types, e.g: the CNAMEs the addresses were
+// resolved through, are skipped.
+func parseDoHAnswers(msg []byte, qtype dnsmessage.Type) ([]net.IP, uint32, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch h.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("DNS query failed, %v", h.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+
+	var ips []net.IP
+	var ttl uint32
+	for {
+		rh, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+		if rh.Type != qtype || rh.Class != dnsmessage.ClassINET {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+
+		switch qtype {
+		case dnsmessage.TypeA:
+			a, err := p.AResource()
+			if err != nil {
+				return nil, 0, err
+			}
+			ips = append(ips, net.IP(a.A[:]))
+		case dnsmessage.TypeAAAA:
+			aaaa, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, err
+			}
+			ips = append(ips, net.IP(aaaa.AAAA[:]))
+		}
+		if len(ips) == 1 || rh.TTL < ttl {
+			ttl = rh.TTL
+		}
+	}
+	return ips, ttl, nil
+}
+
+// Returns the host as a fully qualified DNS name, ending with a dot.
+func dnsName(host string) string {
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		return host
+	}
+	return host + "."
+}
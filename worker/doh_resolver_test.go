@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Serves the answers of each name's A and AAAA records, or NXDOMAIN for
+// names without records.
+func testDoHServer(t *testing.T, records map[string][]dnsmessage.Resource) (*httptest.Server, *int) {
+	queries := 0
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, dohMessageType, r.Header.Get("Content-Type"))
+
+		body, _ := ioutil.ReadAll(r.Body)
+		var query dnsmessage.Message
+		require.NoError(t, query.Unpack(body), "Expect DNS query")
+		q := query.Questions[0]
+
+		resp := dnsmessage.Message{
+			Header:    dnsmessage.Header{Response: true, RecursionAvailable: true},
+			Questions: query.Questions,
+		}
+		answers, ok := records[q.Name.String()]
+		if !ok {
+			resp.Header.RCode = dnsmessage.RCodeNameError
+		}
+		for _, a := range answers {
+			if a.Header.Type == q.Type || a.Header.Type == dnsmessage.TypeCNAME {
+				resp.Answers = append(resp.Answers, a)
+			}
+		}
+		msg, err := resp.Pack()
+		require.NoError(t, err, "Expect DNS response")
+		w.Header().Set("Content-Type", dohMessageType)
+		w.Write(msg)
+	}))
+	return s, &queries
+}
+
+func testDoHRecord(name string, ttl uint32, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	var rtype dnsmessage.Type
+	switch body.(type) {
+	case *dnsmessage.AResource:
+		rtype = dnsmessage.TypeA
+	case *dnsmessage.AAAAResource:
+		rtype = dnsmessage.TypeAAAA
+	case *dnsmessage.CNAMEResource:
+		rtype = dnsmessage.TypeCNAME
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: rtype, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   body,
+	}
+}
+
+func TestDoHResolverLookupIP(t *testing.T) {
+	server, queries := testDoHServer(t, map[string][]dnsmessage.Resource{
+		"www.example.com.": {
+			testDoHRecord("www.example.com.", 300, &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName("example.com.")}),
+			testDoHRecord("example.com.", 60, &dnsmessage.AResource{A: [4]byte{93, 184, 216, 34}}),
+			testDoHRecord("example.com.", 120, &dnsmessage.AAAAResource{AAAA: [16]byte{0x26, 0x06, 0x28, 0x00, 0x02, 0x20, 0, 0x01, 0x02, 0x48, 0x18, 0x93, 0x25, 0xc8, 0x19, 0x46}}),
+		},
+	})
+	defer server.Close()
+
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := newDoHResolver(DNSConfig{DoHURL: server.URL, Timeout: time.Second}, DialConfig{})
+	r.client = server.Client()
+	r.now = func() time.Time { return now }
+
+	ips, err := r.LookupIP(context.Background(), "www.example.com")
+	require.NoError(t, err, "Expect host resolved")
+	assert.Equal(t, []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"}, ipStrings(ips), "Expect IPv4 addresses first")
+	assert.Equal(t, 2, *queries, "Expect A and AAAA queried")
+
+	now = now.Add(59 * time.Second)
+	_, err = r.LookupIP(context.Background(), "www.example.com")
+	require.NoError(t, err, "Expect cached host")
+	assert.Equal(t, 2, *queries, "Expect addresses cached for the lowest TTL")
+
+	now = now.Add(time.Second)
+	_, err = r.LookupIP(context.Background(), "www.example.com")
+	require.NoError(t, err, "Expect host resolved again")
+	assert.Equal(t, 4, *queries, "Expect expired addresses queried")
+
+	ips, err = r.LookupIP(context.Background(), "10.0.0.1")
+	require.NoError(t, err, "Expect IP address")
+	assert.Equal(t, []string{"10.0.0.1"}, ipStrings(ips))
+	assert.Equal(t, 4, *queries, "Expect IP addresses not queried")
+
+	_, err = r.LookupIP(context.Background(), "missing.example.com")
+	require.Error(t, err, "Expect unknown host error")
+	dnsErr, ok := err.(*net.DNSError)
+	require.True(t, ok, "Expect DNS error, got %T", err)
+	assert.True(t, dnsErr.IsNotFound, "Expect host not found")
+}
+
+func TestDoHResolverIPFamily(t *testing.T) {
+	server, queries := testDoHServer(t, map[string][]dnsmessage.Resource{
+		"example.com.": {
+			testDoHRecord("example.com.", 60, &dnsmessage.AResource{A: [4]byte{93, 184, 216, 34}}),
+			testDoHRecord("example.com.", 60, &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}),
+		},
+	})
+	defer server.Close()
+
+	for family, expected := range map[string]string{ipFamilyIPv4: "93.184.216.34", ipFamilyIPv6: "2001:db8::1"} {
+		*queries = 0
+		r := newDoHResolver(DNSConfig{DoHURL: server.URL, Timeout: time.Second}, DialConfig{IPFamily: family})
+		r.client = server.Client()
+
+		ips, err := r.LookupIP(context.Background(), "example.com")
+		require.NoError(t, err, "Expect %s host resolved", family)
+		assert.Equal(t, []string{expected}, ipStrings(ips), "Expect only %s addresses", family)
+		assert.Equal(t, 1, *queries, "Expect other family not queried")
+	}
+}
+
+func TestDoHResolverDialContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Expect listener")
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Write([]byte("hello"))
+			conn.Close()
+		}
+	}()
+
+	server, _ := testDoHServer(t, map[string][]dnsmessage.Resource{
+		"service.test.": {testDoHRecord("service.test.", 60, &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}})},
+	})
+	defer server.Close()
+	r := newDoHResolver(DNSConfig{DoHURL: server.URL, Timeout: time.Second}, DialConfig{})
+	r.client = server.Client()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	conn, err := r.DialContext(context.Background(), "tcp", net.JoinHostPort("service.test", port))
+	require.NoError(t, err, "Expect resolved address dialed")
+	defer conn.Close()
+	b, _ := ioutil.ReadAll(conn)
+	assert.Equal(t, "hello", string(b))
+}
+
+func TestDNSConfigSetDefaults(t *testing.T) {
+	cfg := DNSConfig{}
+	require.NoError(t, cfg.setDefaults())
+	assert.Equal(t, defaultDoHTimeout, cfg.Timeout)
+
+	cfg = DNSConfig{DoHURL: "https://1.1.1.1/dns-query", TimeoutStr: "2s"}
+	require.NoError(t, cfg.setDefaults())
+	assert.Equal(t, 2*time.Second, cfg.Timeout)
+
+	for _, c := range []DNSConfig{{DoHURL: "http://1.1.1.1/dns-query"}, {DoHURL: "1.1.1.1"}, {TimeoutStr: "-1s"}} {
+		assert.Error(t, c.setDefaults(), "Expect %v invalid", c)
+	}
+}
+
+func ipStrings(ips []net.IP) []string {
+	s := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		s = append(s, ip.String())
+	}
+	return s
+}
+
+func TestDoHResolverPrune(t *testing.T) {
+	now := time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)
+	r := newDoHResolver(DNSConfig{}, DialConfig{})
+	for i := 0; i < maxDoHCachedHosts; i++ {
+		r.cache[fmt.Sprintf("host%d.example.com", i)] = dohCacheEntry{expires: now.Add(time.Minute)}
+	}
+	r.prune(now)
+	assert.Len(t, r.cache, maxDoHCachedHosts, "Expect cache within bound kept")
+
+	// Expired addresses are dropped first.
+	r.cache["expired.example.com"] = dohCacheEntry{expires: now}
+	r.cache["new.example.com"] = dohCacheEntry{expires: now.Add(time.Minute)}
+	r.prune(now)
+	assert.Len(t, r.cache, maxDoHCachedHosts/2, "Expect cache pruned to half")
+	assert.NotContains(t, r.cache, "expired.example.com", "Expect expired addresses dropped")
+
+	// Caches of only expired addresses drop all of them.
+	for host := range r.cache {
+		r.cache[host] = dohCacheEntry{expires: now}
+	}
+	for i := 0; i <= maxDoHCachedHosts/2; i++ {
+		r.cache[fmt.Sprintf("other%d.example.com", i)] = dohCacheEntry{expires: now}
+	}
+	r.prune(now)
+	assert.Empty(t, r.cache, "Expect expired addresses dropped")
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Suffix of the files downloads are written to until complete, so they can be
+// resumed if interrupted.
+const downloadPartSuffix = ".part"
+
+// Longest name of a downloaded file, without its URL id prefix.
+const maxDownloadNameLen = 100
+
+// Regex of the characters not allowed in the name of a downloaded file.
+const downloadNameRegexp = `[^A-Za-z0-9._-]+`
+
+var downloadNameRegexpComp = regexp.MustCompile(downloadNameRegexp)
+
+// Downloads the files of download jobs into a directory, keeping the partial
+// downloads of failed requests so they can be resumed. Each job's files are
+// downloaded into a sub directory named by the job's id.
+type downloader struct {
+	dir    string
+	client *http.Client
+
+	// Longest a file may take to download. Downloads which time out are
+	// resumed from where they ended when retried. No limit if zero.
+	timeout time.Duration
+}
+
+// Creates a downloader of files into the directory, requested with the client,
+// each limited to the timeout.
+func newDownloader(dir string, client *http.Client, timeout time.Duration) *downloader {
+	return &downloader{dir: dir, client: client, timeout: timeout}
+}
+
+// Downloads the job's URL, resuming its partial download if one was kept. If
+// the URL's file was already downloaded, and still exists, it is kept instead
+// of downloaded again, unless forced. The file's checksum is verified against
+// the expected checksum if set. Returns the download, and the status code of
+// the URL's response, zero if not requested. A failed download is returned
+// with its error set, along with the error.
+func (d *downloader) download(ctx context.Context, item *common.URLQueueItem, u string, prev *common.JobDownload) (common.JobDownload, int, error) {
+	dl := common.JobDownload{JobId: item.JobId, URLId: item.URLId, URL: u}
+	if prev != nil {
+		dl.ExpectedSHA256 = prev.ExpectedSHA256
+		if !item.ForceCrawl && prev.Status() != common.DownloadFailed && prev.File != "" {
+			if info, err := os.Stat(filepath.Join(d.dir, prev.File)); err == nil && info.Size() == prev.Bytes {
+				return *prev, 0, nil
+			}
+		}
+	}
+
+	dl.File = downloadFile(item.JobId, item.URLId, u)
+	name := filepath.Join(d.dir, dl.File)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return d.failed(dl, err), 0, err
+	}
+
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+
+	status, err := d.fetch(ctx, &dl, name+downloadPartSuffix)
+	dl.DownloadedOn = time.Now().UTC()
+	if err != nil {
+		return d.failed(dl, err), status, err
+	}
+
+	if dl.ExpectedSHA256 != "" && dl.SHA256 != dl.ExpectedSHA256 {
+		// The file is downloaded again from the start the next time.
+		os.Remove(name + downloadPartSuffix)
+		err := fmt.Errorf("checksum mismatch, expected %s, got %s", dl.ExpectedSHA256, dl.SHA256)
+		return d.failed(dl, err), status, err
+	}
+	if err := os.Rename(name+downloadPartSuffix, name); err != nil {
+		return d.failed(dl, err), status, err
+	}
+
+	return dl, status, nil
+}
+
+// Returns the download as failed with the error. Failed downloads don't have a
+// file, but keep their checksum if it was computed.
+func (d *downloader) failed(dl common.JobDownload, err error) common.JobDownload {
+	dl.Error = err.Error()
+	dl.File = ""
+	if dl.DownloadedOn.IsZero() {
+		dl.DownloadedOn = time.Now().UTC()
+	}
+	return dl
+}
+
+// Requests the download's URL into the partial file, resuming from the end of
+// the file if it exists. The download's size, checksum, mime, and if it was
+// resumed are set once the file is complete. The partial file is kept if the
+// request fails, or the response is shorter than its length.
+func (d *downloader) fetch(ctx context.Context, dl *common.JobDownload, part string) (int, error) {
+	hash := sha256.New()
+	var offset int64
+	if f, err := os.Open(part); err == nil {
+		offset, err = io.Copy(hash, f)
+		f.Close()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest("GET", dl.URL, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := d.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	dl.Mime, _ = contentMime(resp)
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0 && contentRangeStart(resp) == offset:
+		flags |= os.O_APPEND
+		dl.Resumed = true
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && contentRangeSize(resp) == offset:
+		// The partial download is already the complete file.
+		dl.Bytes, dl.SHA256, dl.Resumed = offset, hex.EncodeToString(hash.Sum(nil)), true
+		return resp.StatusCode, nil
+	case resp.StatusCode == http.StatusOK:
+		// Hosts not supporting ranges respond with the whole file.
+		flags |= os.O_TRUNC
+		hash.Reset()
+		offset = 0
+	case offset > 0 && (resp.StatusCode == http.StatusPartialContent || resp.StatusCode == http.StatusRequestedRangeNotSatisfiable):
+		// The partial download doesn't match the file, so is restarted
+		// the next time.
+		os.Remove(part)
+		return resp.StatusCode, fmt.Errorf("unexpected range of partial download, %s", resp.Header.Get("Content-Range"))
+	default:
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	f, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	n, err := io.Copy(io.MultiWriter(f, hash), resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return resp.StatusCode, fmt.Errorf("incomplete download, %d of %d bytes", n, resp.ContentLength)
+	}
+
+	dl.Bytes, dl.SHA256 = offset+n, hex.EncodeToString(hash.Sum(nil))
+	return resp.StatusCode, nil
+}
+
+// Returns the path of the job URL's downloaded file, relative to the download
+// directory. The file is named by the URL id, and the last segment of the URL's
+// path, so files with the same name don't collide.
+func downloadFile(jobId common.JobId, urlId common.URLId, u string) string {
+	name := "download"
+	if parsed, err := url.Parse(u); err == nil {
+		if base := path.Base(parsed.Path); base != "/" && base != "." {
+			name = base
+		}
+	}
+	name = strings.Trim(downloadNameRegexpComp.ReplaceAllString(name, "_"), "._")
+	if len(name) > maxDownloadNameLen {
+		name = name[len(name)-maxDownloadNameLen:]
+	}
+	if name == "" {
+		name = "download"
+	}
+	return filepath.Join(jobId.String(), fmt.Sprintf("%d-%s", urlId, name))
+}
+
+// Returns the first byte of the partial response's Content-Range, -1 if it
+// doesn't have one.
+func contentRangeStart(resp *http.Response) int64 {
+	var start, end int64
+	var size string
+	if _, err := fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return -1
+	}
+	return start
+}
+
+// Returns the size of the file of the unsatisfiable range response's
+// Content-Range, -1 if it doesn't have one.
+func contentRangeSize(resp *http.Response) int64 {
+	v := resp.Header.Get("Content-Range")
+	if !strings.HasPrefix(v, "bytes */") {
+		return -1
+	}
+	size, err := strconv.ParseInt(strings.TrimPrefix(v, "bytes */"), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// Downloads the task's URL as a file of its download job, recording the
+// download. Downloads are logged as requests in the crawl log, and the URL is
+// marked as crawled once downloaded.
+func (c *Crawler) download(t *crawlTask) {
+	item, urlRec := t.item, t.urlRec
+	jobClient := c.sc.JobClient()
+
+	if c.downloads == nil {
+		log.Println("crawl: Unable to download, no download directory configured", item.URLId, urlRec.URL)
+		t.decision = traceDownloadFailed
+		return
+	}
+
+	prev, err := jobClient.Download(item.JobId, item.URLId)
+	if err != nil {
+		log.Println("crawl: Failed to get previous download", item.URLId, err)
+		t.decision = traceDownloadFailed
+		return
+	}
+
+	t.requestedAt = time.Now()
+	dl, status, err := c.downloads.download(context.Background(), item, urlRec.URL, prev)
+	if status == 0 && err == nil {
+		log.Println("crawl: Skipping download of file already downloaded", item.URLId, urlRec.URL, dl.File)
+		t.decision = traceDownloaded
+		return
+	}
+	c.logCrawl(item, urlRec.URL, t.requestedAt, &Page{Status: status, Size: dl.Bytes})
+	if err := jobClient.StoreDownload(dl); err != nil {
+		log.Println("crawl: Failed to store download", item.URLId, err)
+	}
+	if err != nil {
+		log.Println("crawl: Failed to download", item.URLId, urlRec.URL, err)
+		t.decision = traceDownloadFailed
+		return
+	}
+
+	if err := c.sc.URLClient().MarkCrawled(item.URLId, dl.Mime, status, dl.SHA256); err != nil {
+		log.Println("crawl: failed to mark download crawled", item.URLId, err)
+	}
+	log.Println("crawl: Downloaded", item.URLId, urlRec.URL, "to", dl.File, "bytes", dl.Bytes, "resumed", dl.Resumed)
+	t.decision = traceDownloaded
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloaderDownload(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	ranges := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "harvester-download")
+	require.NoError(t, err, "Expect download directory")
+	defer os.RemoveAll(dir)
+
+	d := newDownloader(dir, http.DefaultClient, time.Minute)
+	item := &common.URLQueueItem{JobId: 12, URLId: 34}
+	u := server.URL + "/files/data.bin?v=1"
+
+	// A partial download is resumed from where it ended.
+	part := filepath.Join(dir, "12", "34-data.bin") + downloadPartSuffix
+	require.NoError(t, os.MkdirAll(filepath.Dir(part), 0755))
+	require.NoError(t, ioutil.WriteFile(part, content[:4000], 0644))
+
+	dl, status, err := d.download(context.Background(), item, u, &common.JobDownload{ExpectedSHA256: checksum})
+	require.NoError(t, err, "Expect file downloaded")
+	assert.Equal(t, http.StatusPartialContent, status)
+	assert.Equal(t, []string{"bytes=4000-"}, ranges, "Expect download resumed")
+	assert.Equal(t, filepath.Join("12", "34-data.bin"), dl.File)
+	assert.Equal(t, int64(len(content)), dl.Bytes)
+	assert.Equal(t, checksum, dl.SHA256)
+	assert.Equal(t, "application/octet-stream", dl.Mime)
+	assert.True(t, dl.Resumed, "Expect resumed")
+	assert.Equal(t, common.DownloadVerified, dl.Status())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, dl.File))
+	require.NoError(t, err, "Expect downloaded file")
+	assert.Equal(t, content, b, "Expect file content")
+	_, err = os.Stat(part)
+	assert.True(t, os.IsNotExist(err), "Expect partial file renamed")
+
+	// Files already downloaded are kept, unless forced.
+	ranges = nil
+	kept, status, err := d.download(context.Background(), item, u, &dl)
+	require.NoError(t, err, "Expect file kept")
+	assert.Equal(t, 0, status, "Expect not requested")
+	assert.Equal(t, dl, kept)
+	assert.Empty(t, ranges)
+
+	forced := *item
+	forced.ForceCrawl = true
+	dl, status, err = d.download(context.Background(), &forced, u, &dl)
+	require.NoError(t, err, "Expect file downloaded again")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{""}, ranges, "Expect whole file requested")
+	assert.False(t, dl.Resumed, "Expect not resumed")
+	assert.Equal(t, checksum, dl.SHA256)
+}
+
+func TestDownloaderChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("tampered"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "harvester-download")
+	require.NoError(t, err, "Expect download directory")
+	defer os.RemoveAll(dir)
+
+	d := newDownloader(dir, http.DefaultClient, time.Minute)
+	expected := strings.Repeat("ab", 32)
+	dl, status, err := d.download(context.Background(), &common.URLQueueItem{JobId: 1, URLId: 2}, server.URL+"/a.txt", &common.JobDownload{ExpectedSHA256: expected})
+	require.Error(t, err, "Expect checksum mismatch")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, common.DownloadFailed, dl.Status())
+	assert.Contains(t, dl.Error, "checksum mismatch")
+	assert.Empty(t, dl.File, "Expect no file")
+	assert.NotEmpty(t, dl.SHA256, "Expect checksum of downloaded content")
+
+	files, err := ioutil.ReadDir(filepath.Join(dir, "1"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "Expect mismatched download removed")
+}
+
+func TestDownloadFile(t *testing.T) {
+	assert.Equal(t, filepath.Join("1", "2-report.pdf"), downloadFile(1, 2, "http://example.com/docs/report.pdf?x=1"))
+	assert.Equal(t, filepath.Join("1", "2-My_Report_v2_.pdf"), downloadFile(1, 2, "http://example.com/My%20Report%20(v2).pdf"))
+	assert.Equal(t, filepath.Join("1", "2-c.csv"), downloadFile(1, 2, "http://example.com/a%2F..%2F..%2Fc.csv"))
+	assert.Equal(t, filepath.Join("1", "2-download"), downloadFile(1, 2, "http://example.com/"))
+	assert.Equal(t, filepath.Join("1", "2-"+strings.Repeat("a", maxDownloadNameLen)), downloadFile(1, 2, "http://example.com/"+strings.Repeat("a", 150)))
+}
+
+func TestDownloaderDownloadRemoteFile(t *testing.T) {
+	content := "a,b\n1,2\n"
+	fs := &memRemoteFS{files: map[string]string{"/pub/data.csv": content}}
+	ranges := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "data.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	remote := &remoteFileFetcher{next: httpFetcher{client: http.DefaultClient}, dialers: map[string]remoteFSDialer{
+		remoteSchemeFTP: func(ctx context.Context, u *url.URL) (remoteFS, error) {
+			return fs, nil
+		},
+	}}
+
+	dir, err := ioutil.TempDir("", "harvester-download")
+	require.NoError(t, err, "Expect download directory")
+	defer os.RemoveAll(dir)
+
+	d := newDownloader(dir, fetcherClient(remote), time.Minute)
+
+	// Remote files don't support ranges, and are downloaded from the start.
+	part := filepath.Join(dir, "1", "2-data.csv") + downloadPartSuffix
+	require.NoError(t, os.MkdirAll(filepath.Dir(part), 0755))
+	require.NoError(t, ioutil.WriteFile(part, []byte(content[:3]), 0644))
+
+	dl, status, err := d.download(context.Background(), &common.URLQueueItem{JobId: 1, URLId: 2}, "ftp://ftp.example.com/pub/data.csv", nil)
+	require.NoError(t, err, "Expect remote file downloaded")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, int64(len(content)), dl.Bytes)
+	assert.Equal(t, "text/csv", dl.Mime)
+	assert.False(t, dl.Resumed, "Expect not resumed")
+	assert.Equal(t, 1, fs.closed, "Expect connection closed")
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, dl.File))
+	require.NoError(t, err, "Expect downloaded file")
+	assert.Equal(t, content, string(b), "Expect file content")
+
+	// Other URLs are requested with the wrapped fetcher's client, keeping
+	// the range of their resumed download.
+	part = filepath.Join(dir, "1", "3-data.bin") + downloadPartSuffix
+	require.NoError(t, ioutil.WriteFile(part, []byte(content[:3]), 0644))
+
+	dl, status, err = d.download(context.Background(), &common.URLQueueItem{JobId: 1, URLId: 3}, server.URL+"/data.bin", nil)
+	require.NoError(t, err, "Expect file downloaded")
+	assert.Equal(t, http.StatusPartialContent, status)
+	assert.Equal(t, []string{"bytes=3-"}, ranges, "Expect download resumed")
+	assert.True(t, dl.Resumed, "Expect resumed")
+}
+
+func TestDownloaderTimeout(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content[:4000])
+		w.(http.Flusher).Flush()
+		<-stalled
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	dir, err := ioutil.TempDir("", "harvester-download")
+	require.NoError(t, err, "Expect download directory")
+	defer os.RemoveAll(dir)
+
+	d := newDownloader(dir, http.DefaultClient, 50*time.Millisecond)
+	dl, _, err := d.download(context.Background(), &common.URLQueueItem{JobId: 1, URLId: 2}, server.URL+"/data.bin", nil)
+	require.Error(t, err, "Expect stalled download timed out")
+	assert.Equal(t, common.DownloadFailed, dl.Status())
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, "1", "2-data.bin") + downloadPartSuffix)
+	require.NoError(t, err, "Expect partial download kept")
+	assert.Equal(t, content[:4000], b, "Expect partial content to resume from")
+}
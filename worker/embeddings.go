@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/embedding"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sinks the embedding vectors of crawled pages are written to
+const (
+	embeddingSinkStorage = "storage"
+	embeddingSinkQdrant  = "qdrant"
+)
+
+// Timeout of each request to the embedding endpoint, and vector database if
+// not configured.
+const defaultEmbeddingsTimeout = 30 * time.Second
+
+// Number of tokens of the chunks of a page's text each embedded, and the
+// number of tokens each chunk repeats of the chunk before it, if not
+// configured.
+const (
+	defaultEmbeddingChunkSize    = 512
+	defaultEmbeddingChunkOverlap = 64
+)
+
+// Number of chunks embedded by each request to the embedding endpoint if not
+// configured.
+const defaultEmbeddingBatchSize = 16
+
+// Embedding of the main text extracted from crawled pages, so crawls directly
+// populate semantic indexes. The text of each page is split into chunks,
+// which are embedded by an OpenAI compatible embeddings endpoint, e.g: a
+// self-hosted model server. The vectors are stored with the page's URL, or
+// written to a Qdrant collection.
+type EmbeddingsConfig struct {
+	// URL of the embeddings endpoint, e.g: https://api.openai.com/v1/embeddings.
+	// Text is not embedded if not set.
+	URL string `json:"url"`
+
+	// Model the endpoint embeds text with.
+	Model string `json:"model"`
+
+	// Bearer token requests to the endpoint are authorized with, if set.
+	APIKey string `json:"apiKey"`
+
+	// Maximum tokens of each chunk of a page's text, and the number of
+	// tokens each chunk repeats of the chunk before it. Default to 512, and
+	// 64. Tokens are counted approximately, so the size should be under the
+	// model's limit.
+	ChunkSize    int `json:"chunkSize"`
+	ChunkOverlap int `json:"chunkOverlap"`
+
+	// Number of chunks embedded by each request. Defaults to 16.
+	BatchSize int `json:"batchSize"`
+
+	// Timeout of each request. Defaults to 30s.
+	// time.Duration string formated value, e.g: 1m
+	TimeoutStr string `json:"timeout"`
+
+	// The TimeoutStr will be parsed, and its value placed into this field.
+	Timeout time.Duration `json:"-"`
+
+	// Where the vectors are written. Either "storage", or "qdrant". Defaults
+	// to "storage".
+	Sink string `json:"sink"`
+
+	// Qdrant collection the vectors are written to if the sink is "qdrant".
+	Qdrant QdrantConfig `json:"qdrant"`
+}
+
+// Qdrant collection embedding vectors are written to. The collection must
+// exist, with vectors of the model's dimensions.
+type QdrantConfig struct {
+	// URL of the Qdrant server's REST API, e.g: http://localhost:6333
+	URL string `json:"url"`
+
+	// Name of the collection
+	Collection string `json:"collection"`
+
+	// API key requests to the server are authorized with, if set.
+	APIKey string `json:"apiKey"`
+}
+
+// Sets the defaults of the options not configured, and validates the
+// configuration. Nothing is validated if text is not embedded.
+func (c *EmbeddingsConfig) setDefaults() error {
+	if c.URL == "" {
+		return nil
+	}
+	if u, err := url.Parse(c.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid embeddings url %s, must be a http or https URL", c.URL)
+	}
+	if c.Model == "" {
+		return fmt.Errorf("Invalid embeddings, model must be set")
+	}
+
+	if c.ChunkSize == 0 {
+		c.ChunkSize = defaultEmbeddingChunkSize
+		if c.ChunkOverlap == 0 {
+			c.ChunkOverlap = defaultEmbeddingChunkOverlap
+		}
+	}
+	if c.ChunkSize < 0 {
+		return fmt.Errorf("Invalid embeddings chunkSize %d, must be positive", c.ChunkSize)
+	}
+	if c.ChunkOverlap < 0 || c.ChunkOverlap >= c.ChunkSize {
+		return fmt.Errorf("Invalid embeddings chunkOverlap %d, must be less than the chunkSize %d", c.ChunkOverlap, c.ChunkSize)
+	}
+
+	if c.BatchSize == 0 {
+		c.BatchSize = defaultEmbeddingBatchSize
+	} else if c.BatchSize < 0 {
+		return fmt.Errorf("Invalid embeddings batchSize %d, must be positive", c.BatchSize)
+	}
+
+	c.Timeout = defaultEmbeddingsTimeout
+	if c.TimeoutStr != "" {
+		timeout, err := time.ParseDuration(c.TimeoutStr)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid embeddings timeout %q, must be a positive duration", c.TimeoutStr)
+		}
+		c.Timeout = timeout
+	}
+
+	switch c.Sink {
+	case "":
+		c.Sink = embeddingSinkStorage
+	case embeddingSinkStorage:
+	case embeddingSinkQdrant:
+		if u, err := url.Parse(c.Qdrant.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid embeddings qdrant url %s, must be a http or https URL", c.Qdrant.URL)
+		}
+		if c.Qdrant.Collection == "" {
+			return fmt.Errorf("Invalid embeddings qdrant, collection must be set")
+		}
+	default:
+		return fmt.Errorf("Invalid embeddings sink %s, must be %s, or %s", c.Sink, embeddingSinkStorage, embeddingSinkQdrant)
+	}
+	return nil
+}
+
+// Writes the embedding vectors of the chunks of a page's text.
+type embeddingSink interface {
+	// Writes the vectors of the URL's chunks, replacing all previously
+	// written for the URL.
+	write(urlId common.URLId, u, title string, embeddings []storage.URLEmbedding) error
+}
+
+// Embeds the main text of crawled pages with the embeddings endpoint, writing
+// the vectors to the sink.
+type embedder struct {
+	cfg    EmbeddingsConfig
+	client *embedding.Client
+	sink   embeddingSink
+}
+
+// Creates an embedder of the configuration, writing the vectors to storage,
+// or the Qdrant collection.
+func newEmbedder(cfg EmbeddingsConfig, sc *storage.Client) *embedder {
+	client := &http.Client{Timeout: cfg.Timeout}
+	var sink embeddingSink = storageEmbeddingSink{sc: sc}
+	if cfg.Sink == embeddingSinkQdrant {
+		sink = &qdrantSink{cfg: cfg.Qdrant, client: client}
+	}
+	return &embedder{
+		cfg:    cfg,
+		client: embedding.NewClient(cfg.URL, cfg.Model, cfg.APIKey, client),
+		sink:   sink,
+	}
+}
+
+// Embeds the chunks of the URL's text, and writes their vectors to the sink.
+// Failures are logged, and leave the URL's previously written vectors. Does
+// nothing if the embedder is nil.
+func (e *embedder) embedText(urlId common.URLId, u, title, text string) {
+	if e == nil {
+		return
+	}
+
+	chunks := common.ChunkText(text, e.cfg.ChunkSize, e.cfg.ChunkOverlap)
+	embeddings := make([]storage.URLEmbedding, 0, len(chunks))
+	for start := 0; start < len(chunks); start += e.cfg.BatchSize {
+		end := start + e.cfg.BatchSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		inputs := []string{}
+		for _, c := range chunks[start:end] {
+			inputs = append(inputs, c.Text)
+		}
+
+		vectors, err := e.client.Embed(inputs)
+		if err != nil {
+			log.Println("crawl: failed to embed URL's text", urlId, u, err)
+			return
+		}
+		for i, v := range vectors {
+			c := chunks[start+i]
+			embeddings = append(embeddings, storage.URLEmbedding{
+				URLId:    urlId,
+				Chunk:    start + i,
+				Text:     c.Text,
+				Tokens:   c.Tokens,
+				Model:    e.cfg.Model,
+				Vector:   v,
+				StoredOn: time.Now().UTC(),
+			})
+		}
+	}
+
+	if err := e.sink.write(urlId, u, title, embeddings); err != nil {
+		log.Println("crawl: failed to write URL's embeddings", urlId, u, err)
+	}
+}
+
+// Sink storing the vectors with the URL they were embedded from.
+type storageEmbeddingSink struct {
+	sc *storage.Client
+}
+
+func (s storageEmbeddingSink) write(urlId common.URLId, u, title string, embeddings []storage.URLEmbedding) error {
+	return s.sc.URLClient().StoreEmbeddings(urlId, embeddings)
+}
+
+// Sink writing the vectors to a Qdrant collection as points, with the URL,
+// title, chunk, and text as their payload. Points are identified by their URL
+// and chunk, so crawling a URL again replaces its points.
+type qdrantSink struct {
+	cfg    QdrantConfig
+	client *http.Client
+}
+
+// Point of a Qdrant collection
+type qdrantPoint struct {
+	Id      string                 `json:"id"`
+	Vector  []float32              `json:"vector"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+func (s *qdrantSink) write(urlId common.URLId, u, title string, embeddings []storage.URLEmbedding) error {
+	// The URL's points are deleted first, so none remain of chunks the text
+	// no longer has.
+	deleteFilter := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"must": []interface{}{
+				map[string]interface{}{"key": "url", "match": map[string]interface{}{"value": u}},
+			},
+		},
+	}
+	if err := s.request("POST", "/points/delete", deleteFilter); err != nil {
+		return err
+	}
+	if len(embeddings) == 0 {
+		return nil
+	}
+
+	points := make([]qdrantPoint, 0, len(embeddings))
+	for _, e := range embeddings {
+		points = append(points, qdrantPoint{
+			Id:     qdrantPointId(u, e.Chunk),
+			Vector: e.Vector,
+			Payload: map[string]interface{}{
+				"url":    u,
+				"title":  title,
+				"chunk":  e.Chunk,
+				"text":   e.Text,
+				"tokens": e.Tokens,
+				"model":  e.Model,
+			},
+		})
+	}
+	return s.request("PUT", "/points", map[string]interface{}{"points": points})
+}
+
+// Makes the request to the collection's endpoint at the path, waiting for the
+// changes to be applied.
+func (s *qdrantSink) request(method, p string, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	endpoint := strings.TrimRight(s.cfg.URL, "/") + "/collections/" + url.PathEscape(s.cfg.Collection) + p + "?wait=true"
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.cfg.APIKey != "" {
+		req.Header.Set("api-key", s.cfg.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("qdrant responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Returns the UUID the point of the URL's chunk is identified by, derived from
+// the URL and chunk, since Qdrant only accepts UUIDs, and integers as ids.
+func qdrantPointId(u string, chunk int) string {
+	sum := sha256.Sum256([]byte(u + "#" + strconv.Itoa(chunk)))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/embedding"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingsConfigDefaults(t *testing.T) {
+	cfg := EmbeddingsConfig{}
+	assert.NoError(t, cfg.setDefaults(), "Expect no validation if not embedding")
+
+	cfg = EmbeddingsConfig{URL: "http://localhost:8000/v1/embeddings", Model: "m"}
+	require.NoError(t, cfg.setDefaults())
+	assert.Equal(t, defaultEmbeddingChunkSize, cfg.ChunkSize)
+	assert.Equal(t, defaultEmbeddingChunkOverlap, cfg.ChunkOverlap)
+	assert.Equal(t, defaultEmbeddingBatchSize, cfg.BatchSize)
+	assert.Equal(t, defaultEmbeddingsTimeout, cfg.Timeout)
+	assert.Equal(t, embeddingSinkStorage, cfg.Sink)
+
+	invalid := []EmbeddingsConfig{
+		{URL: "ftp://localhost/embeddings", Model: "m"},
+		{URL: "http://localhost/embeddings"},
+		{URL: "http://localhost/embeddings", Model: "m", ChunkSize: 10, ChunkOverlap: 10},
+		{URL: "http://localhost/embeddings", Model: "m", BatchSize: -1},
+		{URL: "http://localhost/embeddings", Model: "m", TimeoutStr: "soon"},
+		{URL: "http://localhost/embeddings", Model: "m", Sink: "files"},
+		{URL: "http://localhost/embeddings", Model: "m", Sink: embeddingSinkQdrant},
+		{URL: "http://localhost/embeddings", Model: "m", Sink: embeddingSinkQdrant, Qdrant: QdrantConfig{URL: "http://localhost:6333"}},
+	}
+	for i, c := range invalid {
+		assert.Error(t, c.setDefaults(), "Expect error for config %d", i)
+	}
+}
+
+// Serves vectors of each input's length, in reverse order of the inputs.
+func testEmbeddingsServer(t *testing.T, requests *[][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test-model", req.Model)
+		*requests = append(*requests, req.Input)
+
+		data := []map[string]interface{}{}
+		for i := len(req.Input) - 1; i >= 0; i-- {
+			data = append(data, map[string]interface{}{"index": i, "embedding": []float32{float32(len(req.Input[i])), 1}})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+	}))
+}
+
+type testEmbeddingSink struct {
+	urlId      common.URLId
+	url, title string
+	embeddings []storage.URLEmbedding
+}
+
+func (s *testEmbeddingSink) write(urlId common.URLId, u, title string, embeddings []storage.URLEmbedding) error {
+	s.urlId, s.url, s.title, s.embeddings = urlId, u, title, embeddings
+	return nil
+}
+
+func TestEmbedderEmbedText(t *testing.T) {
+	requests := [][]string{}
+	s := testEmbeddingsServer(t, &requests)
+	defer s.Close()
+
+	sink := &testEmbeddingSink{}
+	e := &embedder{
+		cfg: EmbeddingsConfig{
+			URL: s.URL, Model: "test-model", APIKey: "secret",
+			ChunkSize: 2, ChunkOverlap: 0, BatchSize: 2,
+		},
+		client: embedding.NewClient(s.URL, "test-model", "secret", &http.Client{Timeout: time.Second}),
+		sink:   sink,
+	}
+
+	e.embedText(42, "http://example.com/post", "Post", "one two six ten red")
+	assert.Equal(t, [][]string{{"one two", "six ten"}, {"red"}}, requests, "Expect chunks embedded in batches")
+
+	assert.Equal(t, common.URLId(42), sink.urlId)
+	assert.Equal(t, "http://example.com/post", sink.url)
+	assert.Equal(t, "Post", sink.title)
+	require.Len(t, sink.embeddings, 3)
+	for i, text := range []string{"one two", "six ten", "red"} {
+		emb := sink.embeddings[i]
+		assert.Equal(t, i, emb.Chunk)
+		assert.Equal(t, text, emb.Text)
+		assert.Equal(t, "test-model", emb.Model)
+		assert.Equal(t, []float32{float32(len(text)), 1}, emb.Vector, "Expect vectors in order of the inputs")
+	}
+
+	var nilEmbedder *embedder
+	nilEmbedder.embedText(42, "http://example.com/post", "Post", "text")
+}
+
+func TestEmbedderEmbedFailure(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [{"index": 0, "embedding": [1]}]}`))
+	}))
+	defer s.Close()
+
+	sink := &testEmbeddingSink{}
+	e := &embedder{
+		cfg:    EmbeddingsConfig{URL: s.URL, Model: "test-model", ChunkSize: 1, BatchSize: 4},
+		client: embedding.NewClient(s.URL, "test-model", "", &http.Client{Timeout: time.Second}),
+		sink:   sink,
+	}
+
+	e.embedText(42, "http://example.com/post", "Post", "a b")
+	assert.Nil(t, sink.embeddings, "Expect nothing written if embedding fails")
+}
+
+func TestQdrantSink(t *testing.T) {
+	type request struct {
+		method, path string
+		body         map[string]interface{}
+	}
+	requests := []request{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("api-key"))
+		assert.Equal(t, "true", r.URL.Query().Get("wait"))
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, request{method: r.Method, path: r.URL.Path, body: body})
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer s.Close()
+
+	sink := &qdrantSink{cfg: QdrantConfig{URL: s.URL + "/", Collection: "pages", APIKey: "key"}, client: &http.Client{}}
+	err := sink.write(42, "http://example.com/post", "Post", []storage.URLEmbedding{
+		{URLId: 42, Chunk: 0, Text: "one two", Tokens: 2, Model: "m", Vector: []float32{0.5, 1}},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, "POST", requests[0].method)
+	assert.Equal(t, "/collections/pages/points/delete", requests[0].path, "Expect URL's points deleted first")
+	assert.Equal(t, "PUT", requests[1].method)
+	assert.Equal(t, "/collections/pages/points", requests[1].path)
+
+	points := requests[1].body["points"].([]interface{})
+	require.Len(t, points, 1)
+	point := points[0].(map[string]interface{})
+	assert.Equal(t, qdrantPointId("http://example.com/post", 0), point["id"])
+	assert.Equal(t, []interface{}{0.5, 1.0}, point["vector"])
+	assert.Equal(t, "http://example.com/post", point["payload"].(map[string]interface{})["url"])
+	assert.Equal(t, "one two", point["payload"].(map[string]interface{})["text"])
+
+	requests = requests[:0]
+	require.NoError(t, sink.write(42, "http://example.com/post", "Post", nil))
+	assert.Len(t, requests, 1, "Expect only delete for a page without chunks")
+}
+
+func TestQdrantPointId(t *testing.T) {
+	id := qdrantPointId("http://example.com/", 1)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`, id)
+	assert.Equal(t, id, qdrantPointId("http://example.com/", 1), "Expect ids stable")
+	assert.NotEqual(t, id, qdrantPointId("http://example.com/", 2), "Expect ids of chunks differ")
+}
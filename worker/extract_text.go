@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/common"
+	"golang.org/x/net/html"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Fewest characters of a paragraph's text for the paragraph to count towards
+// the score of the element containing it.
+const extractMinParagraphLen = 25
+
+// Regex of the class and id attributes of elements which are unlikely to be
+// part of a page's main content, e.g: navigation menus, and share buttons.
+const extractUnlikelyRegexp = `(?i)banner|breadcrumb|combx|comment|community|cookie|disqus|footer|header|menu|modal|nav|newsletter|outbrain|popup|related|remark|share|shoutbox|sidebar|social|sponsor|subscribe|taboola|tool|widget`
+
+// Regex of the class and id attributes of elements which may be part of a
+// page's main content, even if they also match the unlikely regex.
+const extractLikelyRegexp = `(?i)and|article|body|column|content|main|post|shadow|story|text`
+
+var extractUnlikelyRegexpComp *regexp.Regexp
+var extractLikelyRegexpComp *regexp.Regexp
+
+func init() {
+	extractUnlikelyRegexpComp = regexp.MustCompile(extractUnlikelyRegexp)
+	extractLikelyRegexpComp = regexp.MustCompile(extractLikelyRegexp)
+}
+
+// Elements removed along with all of their content before the main content
+// is found, because they are never part of it.
+var extractDropElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"iframe":   true,
+	"object":   true,
+	"embed":    true,
+	"svg":      true,
+	"canvas":   true,
+	"nav":      true,
+	"header":   true,
+	"footer":   true,
+	"aside":    true,
+	"form":     true,
+	"button":   true,
+	"select":   true,
+	"textarea": true,
+}
+
+// ARIA roles of elements which are never part of the main content.
+var extractDropRoles = map[string]bool{
+	"navigation":    true,
+	"banner":        true,
+	"contentinfo":   true,
+	"complementary": true,
+	"search":        true,
+	"dialog":        true,
+}
+
+// Elements whose text is a paragraph of the extracted text, separated from
+// the text around it.
+var extractBlockElements = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "br": true, "dd": true,
+	"div": true, "dl": true, "dt": true, "figcaption": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "li": true, "main": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true,
+	"th": true, "tr": true, "ul": true,
+}
+
+// Initial score of the elements which may contain the main content, by
+// how likely they are to be its container.
+var extractInitialScores = map[string]float64{
+	"article":    10,
+	"main":       10,
+	"section":    5,
+	"div":        5,
+	"pre":        3,
+	"td":         3,
+	"blockquote": 3,
+}
+
+// Returns the main text content of the HTML document, without the page's
+// navigation, header, footer, and other boilerplate, similar to the reader
+// views of browsers. Paragraphs are scored by their length, and the element
+// whose paragraphs score highest, with the fewest links, is taken as the main
+// content, along with its siblings which also score well. Paragraphs of the
+// text are separated by blank lines. The document's visible text is returned
+// if no main content is found.
+func ExtractMainText(doc []byte) string {
+	root, err := html.Parse(bytes.NewReader(doc))
+	if err != nil {
+		return ""
+	}
+	body := findElement(root, "body")
+	if body == nil {
+		body = root
+	}
+	pruneBoilerplate(body)
+
+	top, scores := topCandidate(body)
+	if top == nil {
+		return mainText([]*html.Node{body})
+	}
+
+	// Siblings of the top candidate which score well, or are long paragraphs
+	// with few links, are part of the same content, e.g: an article split
+	// into several divs.
+	nodes := []*html.Node{top}
+	if top.Parent != nil && top != body {
+		nodes = nodes[:0]
+		threshold := scores[top] * 0.2
+		if threshold < 10 {
+			threshold = 10
+		}
+		for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+			if s.Type != html.ElementNode {
+				continue
+			}
+			switch {
+			case s == top, scores[s] >= threshold:
+				nodes = append(nodes, s)
+			case s.Data == "p":
+				text := nodeText(s)
+				if len(text) > 80 && linkDensity(s, text) < 0.25 {
+					nodes = append(nodes, s)
+				}
+			}
+		}
+	}
+	return mainText(nodes)
+}
+
+// Returns the first element of the name within the node, nil if none.
+func findElement(n *html.Node, name string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == name {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Removes the elements within the node which are never part of the main
+// content, hidden elements, and those whose class or id is unlikely to be.
+func pruneBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && isBoilerplate(c):
+			n.RemoveChild(c)
+		default:
+			pruneBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+// Returns true if the element is not part of the main content.
+func isBoilerplate(n *html.Node) bool {
+	if extractDropElements[n.Data] {
+		return true
+	}
+
+	var classId string
+	for _, a := range n.Attr {
+		switch strings.ToLower(a.Key) {
+		case "hidden":
+			return true
+		case "aria-hidden":
+			if strings.EqualFold(a.Val, "true") {
+				return true
+			}
+		case "role":
+			if extractDropRoles[strings.ToLower(a.Val)] {
+				return true
+			}
+		case "class", "id":
+			classId += " " + a.Val
+		}
+	}
+
+	// Containers of the whole document may have boilerplate sounding names,
+	// e.g: "page-with-sidebar".
+	if n.Data == "article" || n.Data == "main" || n.Data == "body" {
+		return false
+	}
+	return extractUnlikelyRegexpComp.MatchString(classId) && !extractLikelyRegexpComp.MatchString(classId)
+}
+
+// Scores the parents, and grandparents of the node's paragraphs by the length
+// and commas of the paragraphs' text, scaled down by their link density.
+// Returns the highest scoring element, and the scores of all the elements.
+// Nil is returned if the node has no paragraphs.
+func topCandidate(n *html.Node) (*html.Node, map[*html.Node]float64) {
+	scores := map[*html.Node]float64{}
+	candidates := []*html.Node{}
+	addScore := func(c *html.Node, score float64) {
+		if c == nil || c.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[c]; !ok {
+			scores[c] = extractInitialScores[c.Data]
+			candidates = append(candidates, c)
+		}
+		scores[c] += score
+	}
+
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && (c.Data == "p" || c.Data == "pre" || c.Data == "td") {
+			text := nodeText(c)
+			if len(text) >= extractMinParagraphLen {
+				score := 1 + float64(strings.Count(text, ","))
+				if l := float64(len(text)) / 100; l < 3 {
+					score += l
+				} else {
+					score += 3
+				}
+				addScore(c.Parent, score)
+				if c.Parent != nil {
+					addScore(c.Parent.Parent, score/2)
+				}
+			}
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	var top *html.Node
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(c, nodeText(c))
+		if top == nil || scores[c] > scores[top] {
+			top = c
+		}
+	}
+	return top, scores
+}
+
+// Returns the portion of the node's text which is the text of links.
+func linkDensity(n *html.Node, text string) float64 {
+	if len(text) == 0 {
+		return 0
+	}
+	linkLen := 0
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.ElementNode && c.Data == "a" {
+			linkLen += len(nodeText(c))
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return float64(linkLen) / float64(len(text))
+}
+
+// Returns the node's text, with white space collapsed.
+func nodeText(n *html.Node) string {
+	buf := bytes.Buffer{}
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		if c.Type == html.TextNode {
+			buf.WriteString(c.Data)
+			buf.WriteByte(' ')
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+	return collapseText(&buf)
+}
+
+// Returns the text of the nodes, with each paragraph separated by a blank
+// line, and white space within paragraphs collapsed.
+func mainText(nodes []*html.Node) string {
+	paragraphs := []string{}
+	buf := &bytes.Buffer{}
+	flush := func() {
+		if p := collapseText(buf); p != "" {
+			paragraphs = append(paragraphs, p)
+		}
+		buf.Reset()
+	}
+
+	var walk func(*html.Node)
+	walk = func(c *html.Node) {
+		switch {
+		case c.Type == html.TextNode:
+			buf.WriteString(c.Data)
+		case c.Type == html.ElementNode && extractBlockElements[c.Data]:
+			flush()
+			for child := c.FirstChild; child != nil; child = child.NextSibling {
+				walk(child)
+			}
+			flush()
+			return
+		}
+		for child := c.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+		flush()
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// Returns if the main text content of the job's crawled pages is extracted.
+// False if it could not be read.
+func (c *Crawler) jobExtractText(id common.JobId) bool {
+	extract, err := c.sc.JobClient().ExtractText(id)
+	if err != nil {
+		log.Println("crawl: failed to get if job extracts text", id, err)
+		return false
+	}
+	return extract
+}
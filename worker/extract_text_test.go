@@ -0,0 +1,34 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExtractMainText(t *testing.T) {
+	doc := `<html><head><title>Post</title><script>var x = 1;</script></head><body>
+<header><a href="/">Home</a> <a href="/blog">Blog</a></header>
+<nav><ul><li><a href="/a">A link to a section of the site</a></li></ul></nav>
+<div class="page">
+  <div class="post-body">
+    <h1>Harvesting the web</h1>
+    <p>Crawlers follow the links of pages, fetching each page, and queuing its links to be crawled in turn.</p>
+    <p>Politeness limits how often a host is requested, so crawling a site doesn't overload it, even when many jobs crawl it.</p>
+  </div>
+  <div class="share-buttons"><p>Share this post with your friends on all of the networks</p></div>
+  <aside><p>Other posts you may like, which are about other things entirely</p></aside>
+</div>
+<div class="links"><p><a href="/1">A list of links to other pages of the site, which are not content</a></p></div>
+<footer><p>Copyright 2015, all rights reserved by the authors of this site</p></footer>
+</body></html>`
+
+	assert.Equal(t, "Harvesting the web\n\n"+
+		"Crawlers follow the links of pages, fetching each page, and queuing its links to be crawled in turn.\n\n"+
+		"Politeness limits how often a host is requested, so crawling a site doesn't overload it, even when many jobs crawl it.",
+		ExtractMainText([]byte(doc)), "Expect main content without boilerplate")
+}
+
+func TestExtractMainTextNoParagraphs(t *testing.T) {
+	doc := `<body><nav>Menu</nav><div>Short <b>text</b></div><div hidden>Hidden</div><ul><li>one</li><li>two</li></ul></body>`
+	assert.Equal(t, "Short text\n\none\n\ntwo", ExtractMainText([]byte(doc)), "Expect visible text without paragraphs")
+}
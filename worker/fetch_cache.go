@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Header set on responses served from the fetch cache.
+const fetchCacheHeader = "X-Harvester-Fetch-Cache"
+
+// Interval between removing expired responses from the fetch cache.
+const fetchCachePruneInterval = time.Hour
+
+// Largest response body cached. Larger bodies are passed through uncached, so
+// they aren't buffered in memory to be cached.
+const maxFetchCacheBodySize = 4 * 1024 * 1024
+
+// Storage of fetched responses shared between workers.
+type fetchCache interface {
+	Get(key string, notBefore time.Time) (*storage.CachedResponse, error)
+	Put(r *storage.CachedResponse) error
+}
+
+// Round tripper which reuses responses fetched within the TTL, instead of
+// fetching them again. Only successful text responses to GET requests are
+// cached, because the bodies of other content are never read by the scraper.
+// Errors reading or writing the cache are logged, and the request is made as
+// if the cache was not used. Bodies are buffered to be cached within the memory
+// budget, and bodies larger than maxFetchCacheBodySize, or over the budget, are
+// not cached.
+type cachingTransport struct {
+	cache  fetchCache
+	ttl    time.Duration
+	budget *memoryBudget
+	next   http.RoundTripper
+}
+
+// Creates a HTTP client which uses the fetch cache for the TTL, and requests
+// responses not cached with the next round tripper.
+func newFetchCacheClient(cache fetchCache, ttl time.Duration, budget *memoryBudget, next http.RoundTripper) *http.Client {
+	return &http.Client{
+		Transport: &cachingTransport{cache: cache, ttl: ttl, budget: budget, next: next},
+	}
+}
+
+func (t *cachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" {
+		return t.next.RoundTrip(req)
+	}
+
+	key := fetchCacheKey(req)
+	if cached, err := t.cache.Get(key, time.Now().UTC().Add(-t.ttl)); err != nil {
+		log.Println("fetchCache: failed to get cached response", req.URL, err)
+	} else if cached != nil {
+		return cachedHTTPResponse(req, cached), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text") {
+		return resp, err
+	}
+
+	// The body's length is reserved if known, or the largest body cached
+	// otherwise, and it is read up to one more byte than reserved, to know
+	// if it is too large to cache.
+	size := resp.ContentLength
+	if size > maxFetchCacheBodySize {
+		return resp, nil
+	} else if size < 0 {
+		size = maxFetchCacheBodySize
+	}
+	if !t.budget.reserve(size) {
+		return resp, nil
+	}
+	defer t.budget.release(size)
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, size+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if int64(len(body)) > size {
+		// Too large to cache, the read part is passed through ahead of
+		// the rest of the body.
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if err := t.cache.Put(&storage.CachedResponse{
+		Key:       key,
+		URL:       req.URL.String(),
+		Status:    resp.StatusCode,
+		Header:    resp.Header,
+		Body:      body,
+		FetchedOn: time.Now().UTC(),
+	}); err != nil {
+		log.Println("fetchCache: failed to cache response", req.URL, err)
+	}
+
+	return resp, nil
+}
+
+// Returns the key a request's response is cached under, the hash of the request's
+// method, URL, and headers. Requests with different headers can receive different
+// responses, so are cached separately.
+func fetchCacheKey(req *http.Request) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.String() + "\n"))
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.Write([]byte(name + ": " + strings.Join(req.Header[name], ",") + "\n"))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Creates a HTTP response for the request from the cached response.
+func cachedHTTPResponse(req *http.Request, cached *storage.CachedResponse) *http.Response {
+	header := http.Header{}
+	for name, values := range cached.Header {
+		header[name] = values
+	}
+	header.Set(fetchCacheHeader, "hit")
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", cached.Status, http.StatusText(cached.Status)),
+		StatusCode:    cached.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(cached.Body)),
+		ContentLength: int64(len(cached.Body)),
+		Request:       req,
+	}
+}
+
+// Periodically removes responses older than the TTL from the fetch cache.
+// Blocks forever, and is expected to be run in its own go routine.
+func pruneFetchCache(sc *storage.Client, ttl time.Duration) {
+	for {
+		n, err := sc.FetchCacheClient().Prune(time.Now().UTC().Add(-ttl))
+		if err != nil {
+			log.Println("fetchCache: failed to prune expired responses", err)
+		} else if n > 0 {
+			log.Println("fetchCache: pruned expired responses", n)
+		}
+
+		time.Sleep(fetchCachePruneInterval)
+	}
+}
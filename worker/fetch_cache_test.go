@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// In memory fetch cache
+type mockFetchCache map[string]*storage.CachedResponse
+
+func (m mockFetchCache) Get(key string, notBefore time.Time) (*storage.CachedResponse, error) {
+	if r, ok := m[key]; ok && !r.FetchedOn.Before(notBefore) {
+		return r, nil
+	}
+	return nil, nil
+}
+
+func (m mockFetchCache) Put(r *storage.CachedResponse) error {
+	m[r.Key] = r
+	return nil
+}
+
+func TestFetchCacheKey(t *testing.T) {
+	a, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	b, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	assert.Equal(t, fetchCacheKey(a), fetchCacheKey(b), "Expect same request same key")
+
+	b.Header.Set("Accept-Language", "fr")
+	assert.NotEqual(t, fetchCacheKey(a), fetchCacheKey(b), "Expect different headers different key")
+
+	c, _ := http.NewRequest("GET", "http://example.com/b", nil)
+	assert.NotEqual(t, fetchCacheKey(a), fetchCacheKey(c), "Expect different URL different key")
+}
+
+func TestCachingTransport(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/other">other</a>`))
+		case "/large":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(bytes.Repeat([]byte("a"), maxFetchCacheBodySize+1))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cache := mockFetchCache{}
+	client := newFetchCacheClient(cache, time.Minute, nil, http.DefaultTransport)
+
+	page, err := Scrape(server.URL+"/page", httpFetcher{client: client}, scrapeOptions{})
+	require.NoError(t, err, "Expect page scraped")
+	assert.False(t, page.Cached, "Expect first fetch not cached")
+
+	page, err = Scrape(server.URL+"/page", httpFetcher{client: client}, scrapeOptions{})
+	require.NoError(t, err, "Expect page scraped")
+	assert.True(t, page.Cached, "Expect second fetch cached")
+	assert.Equal(t, http.StatusOK, page.Status, "Expect cached status")
+	assert.Equal(t, []string{server.URL + "/other"}, page.URLs, "Expect cached body scraped")
+	assert.Equal(t, 1, requests, "Expect page only requested once")
+
+	Scrape(server.URL+"/image", httpFetcher{client: client}, scrapeOptions{})
+	Scrape(server.URL+"/missing", httpFetcher{client: client}, scrapeOptions{})
+	Scrape(server.URL+"/missing", httpFetcher{client: client}, scrapeOptions{})
+	assert.Equal(t, 4, requests, "Expect non-text and error responses not cached")
+
+	for _, r := range cache {
+		r.FetchedOn = r.FetchedOn.Add(-2 * time.Minute)
+	}
+	page, err = Scrape(server.URL+"/page", httpFetcher{client: client}, scrapeOptions{})
+	require.NoError(t, err, "Expect page scraped")
+	assert.False(t, page.Cached, "Expect expired response fetched again")
+	assert.Equal(t, 5, requests, "Expect expired response requested")
+
+	rsp, err := client.Get(server.URL + "/large")
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	require.NoError(t, err)
+	assert.Len(t, body, maxFetchCacheBodySize+1, "Expect whole large body read")
+	_, ok := cache[fetchCacheKey(rsp.Request)]
+	assert.False(t, ok, "Expect large body not cached")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Name of the manifest of a fixture directory's responses.
+const fixtureManifest = "fixtures.json"
+
+// Fetches the responses of the URLs requested by the worker. The context
+// may carry a httptrace.ClientTrace, which fetchers requesting URLs from
+// their hosts report the request's progress to.
+type Fetcher interface {
+	Fetch(ctx context.Context, u string) (*http.Response, error)
+}
+
+// Function fetching the response of a URL.
+type FetcherFunc func(ctx context.Context, u string) (*http.Response, error)
+
+func (f FetcherFunc) Fetch(ctx context.Context, u string) (*http.Response, error) {
+	return f(ctx, u)
+}
+
+// Fetcher requesting URLs with a HTTP client.
+type httpFetcher struct {
+	client *http.Client
+}
+
+func (f httpFetcher) Fetch(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return f.client.Do(req.WithContext(ctx))
+}
+
+// Round tripper requesting URLs with a fetcher, so requests made with a HTTP
+// client, e.g: robots.txt and sitemaps, use the same fetcher as crawls.
+type fetcherTransport struct {
+	fetcher Fetcher
+}
+
+// Creates a HTTP client requesting URLs with the fetcher. Clients of remote
+// file fetchers request other URLs with the client of the fetcher they wrap,
+// so the requests keep their headers, e.g: a download's Range.
+func fetcherClient(f Fetcher) *http.Client {
+	switch v := f.(type) {
+	case httpFetcher:
+		return v.client
+	case *remoteFileFetcher:
+		client := *fetcherClient(v.next)
+		client.Transport = remoteFileTransport{remote: v, next: client.Transport}
+		return &client
+	}
+	return &http.Client{Transport: fetcherTransport{fetcher: f}}
+}
+
+func (t fetcherTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" {
+		return nil, fmt.Errorf("Method %s of %s not supported by fetcher", req.Method, req.URL)
+	}
+	resp, err := t.fetcher.Fetch(req.Context(), req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	return resp, nil
+}
+
+// Fixture of a URL's response in a fixture directory's manifest.
+type fixture struct {
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+
+	// File of the response's body, relative to the fixture directory. The
+	// body is empty if not set.
+	File string `json:"file"`
+
+	// If fetching the URL fails, instead of responding.
+	Fail bool `json:"fail"`
+}
+
+// Fetcher serving recorded responses, instead of requesting them, so crawls
+// run offline, and are reproducible. URLs whose fetch is recorded as failed
+// fail, and URLs without a recorded response are not found.
+type fixtureFetcher struct {
+	responses map[string]*traceResponse
+	failures  map[string]struct{}
+}
+
+// Creates a fetcher without any recorded responses.
+func newFixtureFetcher() *fixtureFetcher {
+	return &fixtureFetcher{responses: map[string]*traceResponse{}, failures: map[string]struct{}{}}
+}
+
+// Creates a fetcher serving the responses recorded in the fixture directory.
+// The responses listed by the directory's fixtures.json manifest are served,
+// along with the responses of any crawl traces, *.trace, and cassettes,
+// *.cassette, in the directory.
+func loadFixtureFetcher(dir string) (*fixtureFetcher, error) {
+	f := newFixtureFetcher()
+
+	cassettes, err := filepath.Glob(filepath.Join(dir, "*.cassette"))
+	if err != nil {
+		return nil, err
+	}
+	recorded := []cassetteEntry{}
+	for _, name := range cassettes {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := readCassette(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid cassette %s, %v", name, err)
+		}
+		recorded = append(recorded, entries...)
+	}
+	// The latest recording of a URL in any of the cassettes is served.
+	sort.SliceStable(recorded, func(i, j int) bool { return recorded[i].RecordedOn.Before(recorded[j].RecordedOn) })
+	f.addCassette(recorded)
+
+	traces, err := filepath.Glob(filepath.Join(dir, "*.trace"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range traces {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := readTrace(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trace %s, %v", name, err)
+		}
+		f.addTrace(entries)
+	}
+
+	file, err := os.Open(filepath.Join(dir, fixtureManifest))
+	if os.IsNotExist(err) {
+		return f, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	fixtures := []fixture{}
+	if err := json.NewDecoder(file).Decode(&fixtures); err != nil {
+		return nil, fmt.Errorf("Invalid fixture manifest %s, %v", file.Name(), err)
+	}
+	for _, fx := range fixtures {
+		if fx.Fail {
+			f.failures[fx.URL] = struct{}{}
+			continue
+		}
+
+		resp := &traceResponse{Status: fx.Status, Header: fx.Header}
+		if resp.Status == 0 {
+			resp.Status = http.StatusOK
+		}
+		if fx.File != "" {
+			if resp.Body, err = ioutil.ReadFile(filepath.Join(dir, fx.File)); err != nil {
+				return nil, err
+			}
+		}
+		f.add(fx.URL, resp)
+	}
+	return f, nil
+}
+
+// Records the response of the URL.
+func (f *fixtureFetcher) add(u string, resp *traceResponse) {
+	delete(f.failures, u)
+	f.responses[u] = resp
+}
+
+// Records the responses, and failed fetches of the cassette.
+func (f *fixtureFetcher) addCassette(entries []cassetteEntry) {
+	for _, e := range entries {
+		if e.Response != nil {
+			f.add(e.URL, e.Response)
+		} else {
+			f.failures[e.URL] = struct{}{}
+		}
+	}
+}
+
+// Records the responses, and failed fetches of the trace's crawls.
+func (f *fixtureFetcher) addTrace(entries []traceEntry) {
+	for _, e := range entries {
+		if e.Response != nil {
+			f.add(e.URL, e.Response)
+		} else if e.Decision == traceFetchFailed {
+			f.failures[e.URL] = struct{}{}
+		}
+	}
+}
+
+func (f *fixtureFetcher) Fetch(ctx context.Context, u string) (*http.Response, error) {
+	if _, ok := f.failures[u]; ok {
+		return nil, fmt.Errorf("Fetch of %s recorded as failed", u)
+	}
+
+	r, ok := f.responses[u]
+	if !ok {
+		r = &traceResponse{Status: http.StatusNotFound}
+	}
+	header := http.Header{}
+	for name, values := range r.Header {
+		header[name] = values
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+	}, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Writes the fixture directory's files, returning the directory.
+func writeFixtures(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "harvester-fixtures")
+	require.NoError(t, err, "Expect fixture directory")
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), "Expect fixture written")
+	}
+	return dir
+}
+
+func TestLoadFixtureFetcher(t *testing.T) {
+	dir := writeFixtures(t, map[string]string{
+		"fixtures.json": `[
+			{"url": "http://example.com/", "header": {"Content-Type": ["text/html"]}, "file": "index.html"},
+			{"url": "http://example.com/gone", "status": 410},
+			{"url": "http://example.com/down", "fail": true}
+		]`,
+		"index.html": `<a href="/a">a</a>`,
+		"job-7.trace": `{"seq": 1, "url": "http://example.com/a", "decision": "crawled", "response": {"status": 200, "header": {"Content-Type": ["text/plain"]}, "body": "aGk="}}
+{"seq": 2, "url": "http://example.com/b", "decision": "fetch-failed"}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	f, err := loadFixtureFetcher(dir)
+	require.NoError(t, err, "Expect fixtures loaded")
+
+	cases := []struct {
+		url    string
+		status int
+		body   string
+		fail   bool
+	}{
+		{url: "http://example.com/", status: http.StatusOK, body: `<a href="/a">a</a>`},
+		{url: "http://example.com/gone", status: http.StatusGone},
+		{url: "http://example.com/down", fail: true},
+		{url: "http://example.com/a", status: http.StatusOK, body: "hi"},
+		{url: "http://example.com/b", fail: true},
+		{url: "http://example.com/missing", status: http.StatusNotFound},
+	}
+	for _, c := range cases {
+		resp, err := f.Fetch(context.Background(), c.url)
+		if c.fail {
+			assert.Error(t, err, "Expect %s fetch to fail", c.url)
+			continue
+		}
+		require.NoError(t, err, "Expect %s fetched", c.url)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, c.status, resp.StatusCode, "Expect %s status", c.url)
+		assert.Equal(t, c.body, string(body), "Expect %s body", c.url)
+	}
+}
+
+func TestFixtureFetcherOfflineCrawl(t *testing.T) {
+	f := newFixtureFetcher()
+	html := http.Header{"Content-Type": []string{"text/html"}}
+	f.add("http://example.com/robots.txt", &traceResponse{Status: http.StatusOK, Header: http.Header{"Content-Type": []string{"text/plain"}}, Body: []byte("User-agent: *\nDisallow: /private\n")})
+	f.add("http://example.com/", &traceResponse{Status: http.StatusOK, Header: html, Body: []byte(`<a href="/a">a</a><a href="/private/b">b</a><a href="http://example.org/">c</a>`)})
+	f.add("http://example.com/a", &traceResponse{Status: http.StatusOK, Header: html, Body: []byte(`<a href="/">home</a><a href="/c">c</a>`)})
+
+	// Crawls the fixture site's allowed URLs on its own host, as a job would.
+	robots := newRobotsPolicy(fetcherClient(f), "harvester")
+	crawled := []string{}
+	queue, seen := []string{"http://example.com/"}, map[string]bool{"http://example.com/": true}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		if allowed, err := robots.allow(u); err != nil || !allowed {
+			continue
+		}
+
+		page, err := Scrape(u, f, scrapeOptions{})
+		require.NoError(t, err, "Expect %s scraped offline", u)
+		page.Release()
+		crawled = append(crawled, u)
+		for _, found := range page.URLs {
+			if !seen[found] && common.URLHost(found) == common.URLHost(u) {
+				seen[found] = true
+				queue = append(queue, found)
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"http://example.com/", "http://example.com/a", "http://example.com/c"}, crawled, "Expect allowed URLs of the host crawled in order")
+}
+
+func TestFetcherClient(t *testing.T) {
+	f := newFixtureFetcher()
+	f.add("http://example.com/", &traceResponse{Status: http.StatusOK, Body: []byte("hi")})
+
+	resp, err := fetcherClient(f).Get("http://example.com/")
+	require.NoError(t, err, "Expect client to fetch with fetcher")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "Expect fixture's status")
+
+	_, err = fetcherClient(f).Head("http://example.com/")
+	assert.Error(t, err, "Expect only GET requests fetched")
+
+	assert.Equal(t, http.DefaultClient, fetcherClient(httpFetcher{client: http.DefaultClient}), "Expect HTTP fetcher's own client")
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"sort"
+)
+
+// Returns the job's flags the crawled pages are matched against, nil if the
+// job has none, or they could not be read.
+func (c *Crawler) jobFlags(id common.JobId) []common.JobFlag {
+	flags, err := c.sc.JobClient().Flags(id)
+	if err != nil {
+		log.Println("crawl: failed to get job's flags", id, err)
+		return nil
+	}
+	return flags
+}
+
+// Returns the sorted and de-duped names of the flags whose pattern matches the
+// page's content. Flags whose pattern is invalid are skipped. None match if
+// the page's content wasn't kept, e.g: it exceeded the memory budget.
+func flagPage(flags []common.JobFlag, body []byte) []string {
+	found := map[string]struct{}{}
+	for _, flag := range flags {
+		if _, ok := found[flag.Name]; ok || body == nil {
+			continue
+		}
+		re, err := flag.Compile()
+		if err != nil {
+			log.Println("flag: Skipping invalid flag", flag.Name, err)
+			continue
+		}
+		if re.Match(body) {
+			found[flag.Name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFlagPage(t *testing.T) {
+	flags := []common.JobFlag{
+		common.NewKeywordFlag("Recall"),
+		{Name: "price", Pattern: `\$\d+\.\d\d`},
+		{Name: "price", Pattern: `\d+ EUR`},
+		{Name: "invalid", Pattern: `(abc`},
+		{Name: "stock", Pattern: `(?i)out of stock`},
+	}
+
+	body := []byte(`<html><body><h1>RECALL notice</h1><p>Was 20 EUR</p></body></html>`)
+	assert.Equal(t, []string{"price", "recall"}, flagPage(flags, body), "Expect matched flags, de-duped and sorted")
+	assert.Equal(t, []string{}, flagPage(flags, []byte("nothing here")), "Expect no flags matched")
+	assert.Equal(t, []string{}, flagPage(flags, nil), "Expect no flags of page without content")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"github.com/jlaffaye/ftp"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+)
+
+// Port of FTP servers if the URL doesn't have one.
+const defaultFTPPort = "21"
+
+// Connection to a FTP server.
+type ftpFS struct {
+	conn *ftp.ServerConn
+}
+
+// Creates a dialer of the FTP servers of ftp:// URLs, connecting with the
+// dial function.
+func newFTPDialer(cfg RemoteFilesConfig, dial dialContextFn) remoteFSDialer {
+	return func(ctx context.Context, u *url.URL) (remoteFS, error) {
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), defaultFTPPort)
+		}
+		ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		conn, err := ftp.Dial(addr, ftp.DialWithContext(ctx), ftp.DialWithTimeout(cfg.Timeout),
+			ftp.DialWithDialFunc(func(network, address string) (net.Conn, error) {
+				return dial(ctx, network, address)
+			}))
+		if err != nil {
+			return nil, err
+		}
+
+		user, pass := "anonymous", "anonymous"
+		if u.User != nil {
+			user = u.User.Username()
+			pass, _ = u.User.Password()
+		}
+		if err := conn.Login(user, pass); err != nil {
+			conn.Quit()
+			return nil, err
+		}
+		return ftpFS{conn: conn}, nil
+	}
+}
+
+func (f ftpFS) Stat(p string) (os.FileInfo, error) {
+	// FTP has no portable stat, so a path is a directory if it can be
+	// changed into, and otherwise a file if its size is known.
+	if err := f.conn.ChangeDir(p); err == nil {
+		return remoteFileInfo{name: path.Base(p), dir: true}, nil
+	}
+	size, err := f.conn.FileSize(p)
+	if err != nil {
+		return nil, ftpError("stat", p, err)
+	}
+
+	info := remoteFileInfo{name: path.Base(p), size: size}
+	if f.conn.IsGetTimeSupported() {
+		info.modTime, _ = f.conn.GetTime(p)
+	}
+	return info, nil
+}
+
+func (f ftpFS) ReadDir(p string) ([]os.FileInfo, error) {
+	entries, err := f.conn.List(p)
+	if err != nil {
+		return nil, ftpError("readdir", p, err)
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		infos = append(infos, remoteFileInfo{
+			name:    e.Name,
+			size:    int64(e.Size),
+			dir:     e.Type == ftp.EntryTypeFolder,
+			modTime: e.Time,
+		})
+	}
+	return infos, nil
+}
+
+func (f ftpFS) Open(p string) (io.ReadCloser, error) {
+	resp, err := f.conn.Retr(p)
+	if err != nil {
+		return nil, ftpError("open", p, err)
+	}
+	return resp, nil
+}
+
+func (f ftpFS) Close() error {
+	return f.conn.Quit()
+}
+
+// Returns the error of the FTP server's reply as a path error, satisfying
+// os.IsNotExist if the file is unavailable, and os.IsPermission if the user
+// isn't logged in. FTP servers reply with 550 to both missing files, and
+// files the user can't access.
+func ftpError(op, p string, err error) error {
+	if tpErr, ok := err.(*textproto.Error); ok {
+		switch tpErr.Code {
+		case ftp.StatusFileUnavailable:
+			return &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+		case ftp.StatusNotLoggedIn:
+			return &os.PathError{Op: op, Path: p, Err: os.ErrPermission}
+		}
+	}
+	return err
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/common"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Elements whose text is not visible when the document is displayed.
+var htmlHiddenElements = map[atom.Atom]struct{}{
+	atom.Script:   struct{}{},
+	atom.Style:    struct{}{},
+	atom.Noscript: struct{}{},
+	atom.Template: struct{}{},
+}
+
+// Information found in an HTML document by a single streaming pass over it.
+type htmlScan struct {
+	// Page information from the document's meta tags, JSON-LD, title, h1,
+	// and visible text. Does not include information from response headers.
+	info common.PageInfo
+
+	// Values of the document's href and src attributes, not normalized.
+	urls []string
+
+	// Meta refresh and trivial JavaScript redirects, not normalized.
+	redirects []Redirect
+
+	// Alternate representations of the page, not normalized.
+	alternates []Alternate
+
+	// Structure of the document hinting at the kind of page it is.
+	hints pageHints
+
+	// Number of elements the document was tokenized into. Zero for content
+	// which isn't HTML, or can't be decoded, e.g: UTF-16.
+	elements int
+}
+
+// Scans the HTML document token by token as it is read, so the document never
+// needs to be buffered. Tokens larger than maxBuf bytes stop the scan with an
+// error, zero for no limit. The information found before an error is returned
+// with the error.
+func scanHTML(r io.Reader, maxBuf int) (*htmlScan, error) {
+	scan := &htmlScan{urls: []string{}, redirects: []Redirect{}, alternates: []Alternate{}}
+
+	z := html.NewTokenizer(r)
+	if maxBuf > 0 {
+		z.SetMaxBuf(maxBuf)
+	}
+
+	var (
+		// Depth of hidden elements, and if within the document's head.
+		hidden int
+		inHead bool
+
+		inScript bool
+
+		// Text of the first title and h1 elements, nil once the element ends.
+		title, h1         *bytes.Buffer
+		titleDone, h1Done bool
+
+		// Attributes of the meta or link tag being scanned. Reused for
+		// every tag, so tags don't allocate a map each.
+		attrs = map[string]string{}
+	)
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			scan.info.Title = collapseText(title)
+			scan.info.H1 = collapseText(h1)
+			if err := z.Err(); err != io.EOF {
+				return scan, err
+			}
+			return scan, nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			scan.elements++
+			name, hasAttr := z.TagName()
+			tag := atom.Lookup(name)
+
+			// Only meta, link, and input tags need all of their attributes.
+			// The URLs of other tags are taken directly from the tokenizer.
+			full := tag == atom.Meta || tag == atom.Link || tag == atom.Input
+			for k := range attrs {
+				delete(attrs, k)
+			}
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				if full {
+					attrs[strings.ToLower(string(k))] = strings.TrimSpace(string(v))
+				} else if isURLAttr(k) {
+					if u := bytes.TrimSpace(v); len(u) > 0 {
+						scan.urls = append(scan.urls, string(u))
+					}
+				} else if bytes.EqualFold(k, []byte("itemtype")) {
+					for _, t := range strings.Fields(string(v)) {
+						scan.hints.addSchemaType(t)
+					}
+				}
+			}
+			if full {
+				for _, attr := range []string{"href", "src"} {
+					if u := attrs[attr]; u != "" {
+						scan.urls = append(scan.urls, u)
+					}
+				}
+			}
+
+			switch tag {
+			case atom.Meta:
+				addMetaPageInfo(&scan.info, attrs)
+				if strings.EqualFold(attrs["property"], "og:type") {
+					scan.hints.OGType = strings.ToLower(attrs["content"])
+				}
+				if r, ok := metaRefreshRedirect(attrs); ok {
+					scan.redirects = append(scan.redirects, r)
+				}
+			case atom.Link:
+				if a, ok := linkAlternate(attrs); ok {
+					scan.alternates = append(scan.alternates, a)
+				}
+			case atom.Input:
+				if strings.EqualFold(attrs["type"], "password") {
+					scan.hints.Password = true
+				}
+			case atom.A:
+				scan.hints.Links++
+			case atom.Head:
+				inHead = true
+			case atom.Body:
+				// The head ends at the body even if it isn't closed.
+				inHead = false
+			case atom.Title:
+				if !titleDone && tt == html.StartTagToken {
+					title = &bytes.Buffer{}
+				}
+			case atom.H1:
+				if !h1Done && tt == html.StartTagToken {
+					h1 = &bytes.Buffer{}
+				}
+			case atom.Script:
+				inScript = tt == html.StartTagToken
+			}
+			if _, ok := htmlHiddenElements[tag]; ok && tt == html.StartTagToken {
+				hidden++
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			tag := atom.Lookup(name)
+			switch tag {
+			case atom.Head:
+				inHead = false
+			case atom.Title:
+				if title != nil {
+					titleDone = true
+				}
+			case atom.H1:
+				if h1 != nil {
+					h1Done = true
+				}
+			case atom.Script:
+				inScript = false
+			}
+			if _, ok := htmlHiddenElements[tag]; ok && hidden > 0 {
+				hidden--
+			}
+
+		case html.TextToken:
+			text := z.Text()
+			if inScript {
+				addJSONLDPageInfo(&scan.info, text)
+				scan.hints.addJSONLDTypes(text)
+				scan.redirects = append(scan.redirects, scriptRedirects(text)...)
+			}
+			if title != nil && !titleDone {
+				title.Write(text)
+			}
+			if h1 != nil && !h1Done {
+				// Tags within the h1 separate its words.
+				h1.Write(text)
+				h1.WriteByte(' ')
+			}
+			if hidden == 0 && !inHead {
+				scan.info.WordCount += countWords(text)
+			}
+		}
+	}
+}
+
+// Returns the buffer's text with white space collapsed. Empty if nil.
+func collapseText(b *bytes.Buffer) string {
+	if b == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// Returns true if the attribute name is href or src, in any case.
+func isURLAttr(k []byte) bool {
+	return bytes.EqualFold(k, []byte("href")) || bytes.EqualFold(k, []byte("src"))
+}
+
+// Counts the words of the text. Words are separated by white space, and must
+// contain at least one letter or number. The text is not copied.
+func countWords(text []byte) int {
+	count := 0
+	inWord, hasWordRune := false, false
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+		if unicode.IsSpace(r) {
+			if inWord && hasWordRune {
+				count++
+			}
+			inWord, hasWordRune = false, false
+			continue
+		}
+		inWord = true
+		hasWordRune = hasWordRune || isWordRune(r)
+	}
+	if inWord && hasWordRune {
+		count++
+	}
+	return count
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/html"
+	"strings"
+	"testing"
+)
+
+func TestScanHTMLUnclosedHead(t *testing.T) {
+	scan, err := scanHTML(strings.NewReader(`<html><head><title>Title</title>
+<body><p>Two words</p><img src="/a.png"></body>`), 0)
+	require.NoError(t, err, "Expect document scanned")
+	assert.Equal(t, "Title", scan.info.Title, "Expect title")
+	assert.Equal(t, 2, scan.info.WordCount, "Expect body words counted after unclosed head")
+	assert.Equal(t, []string{"/a.png"}, scan.urls, "Expect src URL")
+}
+
+func TestScanHTMLMaxBuf(t *testing.T) {
+	doc := `<a href="/before">a</a><script>` + strings.Repeat("x", 4096) + `</script><a href="/after">b</a>`
+
+	scan, err := scanHTML(strings.NewReader(doc), 1024)
+	assert.Equal(t, html.ErrBufferExceeded, err, "Expect token over max buffer error")
+	assert.Equal(t, []string{"/before"}, scan.urls, "Expect URLs found before the error")
+
+	scan, err = scanHTML(strings.NewReader(doc), 0)
+	require.NoError(t, err, "Expect unlimited buffer")
+	assert.Equal(t, []string{"/before", "/after"}, scan.urls, "Expect all URLs")
+}
+
+func TestCountWords(t *testing.T) {
+	assert.Equal(t, 0, countWords(nil), "Expect no words in empty text")
+	assert.Equal(t, 3, countWords([]byte("  Tom & Jerry\n2015 ")), "Expect words with letters or numbers")
+	assert.Equal(t, 2, countWords([]byte("naïve café")), "Expect unicode space and letters")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/jsonpath"
+	"log"
+	"net/url"
+)
+
+// Applies the job's JSONPath expressions to the JSON document. Returns the
+// normalized URLs selected by the link expressions, and the JSON encoded values
+// selected by each field expression. Values selected by link expressions which
+// are not strings, or not valid URLs, are ignored.
+func extractJSONPaths(paths *common.JobJSONPaths, pageURL *url.URL, doc []byte) ([]string, map[string]string, error) {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil, nil, err
+	}
+
+	urls := []string{}
+	for _, expr := range paths.Links {
+		p, err := jsonpath.Compile(expr)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, selected := range p.Eval(v) {
+			s, ok := selected.(string)
+			if !ok || s == "" {
+				continue
+			}
+			if u, err := normalizeURL(pageURL, s); err == nil {
+				urls = append(urls, u)
+			}
+		}
+	}
+
+	fields := make(map[string]string, len(paths.Fields))
+	for name, expr := range paths.Fields {
+		p, err := jsonpath.Compile(expr)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := json.Marshal(p.Eval(v))
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to encode JSON field %s, %v", name, err)
+		}
+		fields[name] = string(value)
+	}
+
+	return urls, fields, nil
+}
+
+// Applies the job's JSONPath expressions to the item's JSON response, storing
+// the selected fields. Returns the URLs selected by the link expressions, and
+// if the job has any link expressions. Jobs with link expressions follow only
+// the URLs they select, instead of all URLs found in the response.
+func (c *Crawler) applyJSONPaths(item *common.URLQueueItem, pageURL string, body []byte) ([]string, bool) {
+	paths, err := c.sc.JobClient().JSONPaths(item.JobId)
+	if err != nil {
+		log.Println("crawl: failed to get job's JSONPaths", item.JobId, err)
+		return nil, false
+	} else if paths == nil {
+		return nil, false
+	}
+
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		log.Println("crawl: failed to parse JSON response URL", item.URLId, pageURL, err)
+		return nil, false
+	}
+	urls, fields, err := extractJSONPaths(paths, u, body)
+	if err != nil {
+		log.Println("crawl: failed to apply JSONPaths", item.URLId, pageURL, err)
+		return nil, false
+	}
+
+	if len(fields) > 0 {
+		if err := c.sc.JobClient().StoreJSONFields(item.JobId, item.URLId, fields); err != nil {
+			log.Println("crawl: failed to store JSON fields", item.URLId, err)
+		}
+	}
+	return urls, len(paths.Links) > 0
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"testing"
+)
+
+func TestExtractJSONPaths(t *testing.T) {
+	pageURL, _ := url.Parse("http://example.com/api/items?page=1")
+	doc := []byte(`{"next": "/api/items?page=2", "prev": null, "items": [{"id": 1, "url": "/api/items/1"}, {"id": 2, "url": 5}]}`)
+
+	paths := &common.JobJSONPaths{
+		Links:  []string{"$.next", "$.prev", "$.items[*].url"},
+		Fields: map[string]string{"ids": "$.items[*].id", "missing": "$.total"},
+	}
+	urls, fields, err := extractJSONPaths(paths, pageURL, doc)
+	require.NoError(t, err, "Expect JSONPaths applied")
+	assert.Equal(t, []string{"http://example.com/api/items?page=2", "http://example.com/api/items/1"}, urls, "Expect only string link URLs")
+	assert.Equal(t, map[string]string{"ids": "[1,2]", "missing": "[]"}, fields, "Expect JSON encoded fields")
+
+	_, _, err = extractJSONPaths(paths, pageURL, []byte(`not json`))
+	assert.Error(t, err, "Expect invalid document error")
+}
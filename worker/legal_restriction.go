@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Reason hosts are opted out with, once one of their URLs responds 451.
+const legalOptOutReason = "Unavailable for legal reasons"
+
+// Records the fetched response of the crawl which responded 451 Unavailable
+// For Legal Reasons. The URL is added to the skip list of the worker's legal
+// skip policy, so the URL, or its whole host, is not crawled again.
+func (c *Crawler) recordLegalRestriction(t *crawlTask) {
+	item, urlRec := t.item, t.urlRec
+	host := common.URLHost(urlRec.URL)
+
+	restriction := common.LegalRestriction{
+		URL:        urlRec.URL,
+		Host:       host,
+		BlockedBy:  blockedBy(t.resp.Header),
+		RecordedOn: t.requestedAt.UTC(),
+	}
+	log.Println("crawl: Unavailable for legal reasons", item.URLId, urlRec.URL, "blocked by:", restriction.BlockedBy)
+	if err := c.sc.URLClient().AddLegalRestriction(item.JobId, item.URLId, restriction); err != nil {
+		log.Println("crawl: failed to record legal restriction", item.URLId, err)
+	}
+
+	if c.legalSkip == legalSkipHost {
+		if _, err := c.sc.HostClient().OptOut(host, legalOptOutReason, common.HostOptOutLegal); err != nil {
+			log.Println("crawl: failed to opt out legally restricted host", host, err)
+		}
+	}
+}
+
+// Returns true if the URL is legally restricted, and the worker's legal skip
+// policy skips such URLs. If the restriction can't be checked the URL is
+// crawled.
+func (c *Crawler) legallyRestricted(urlId common.URLId) bool {
+	if c.legalSkip != legalSkipURL {
+		return false
+	}
+	restricted, err := c.sc.URLClient().IsLegallyRestricted(urlId)
+	if err != nil {
+		log.Println("crawl: Failed to check legal restriction", urlId, err)
+		return false
+	}
+	return restricted
+}
+
+// Returns the entity implementing a legal block, from the response's Link
+// header with the "blocked-by" relation, RFC 7725. Empty if there is none.
+func blockedBy(header http.Header) string {
+	for _, v := range header[http.CanonicalHeaderKey("Link")] {
+		for _, link := range strings.Split(v, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(kv[0], "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(kv[1], `"`)) {
+					if strings.EqualFold(rel, "blocked-by") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+)
+
+func TestBlockedBy(t *testing.T) {
+	cases := []struct {
+		links  []string
+		expect string
+	}{
+		{nil, ""},
+		{[]string{`<https://search.example.net/legal>; rel="blocked-by"`}, "https://search.example.net/legal"},
+		{[]string{`<https://example.com/style.css>; rel=stylesheet, <https://isp.example.org/>; rel="Blocked-By"`}, "https://isp.example.org/"},
+		{[]string{`<https://example.com/next>; rel="next"`, `<https://isp.example.org/>; rel="nofollow blocked-by"`}, "https://isp.example.org/"},
+		{[]string{`https://isp.example.org/; rel="blocked-by"`}, ""},
+		{[]string{`<https://example.com/>; title="blocked-by"`}, ""},
+	}
+	for i, c := range cases {
+		header := http.Header{}
+		for _, l := range c.links {
+			header.Add("Link", l)
+		}
+		assert.Equal(t, c.expect, blockedBy(header), "Expect blocked by of case %d", i)
+	}
+}
@@ -2,12 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"expvar"
 	"flag"
 	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/errreport"
 	"github.com/jasdel/harvester/internal/queue"
 	"github.com/jasdel/harvester/internal/storage"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -25,6 +31,87 @@ import (
 // If crawling a work item produces any descendant URLs those URLs will be enqueued to be
 // crawled, or added to the origin Job URL's results.
 //
+// If the fetchCacheTTL configuration is set, responses fetched by any worker are
+// stored in a shared fetch cache, and reused by other jobs crawling the same URLs
+// within the TTL.
+//
+// Unless the ignoreRobots configuration is set, URLs disallowed by their host's
+// robots.txt for the configured userAgent are not crawled, and requests to a
+// host are delayed by its Crawl-delay. The URLs listed by the sitemaps of a job
+// URL host's robots.txt are crawled as descendants of the job URL.
+//
+// Crawled content is scraped for URLs by the content handler registered for its
+// mime type, see registerContentHandler. HTML, XML and sitemaps, JSON, PDF, and
+// plain text are handled. Content without a handler is not scraped. URLs are
+// found in generic XML documents, e.g: feeds and catalogs, from the elements
+// and attributes named by the xmlURLs configuration.
+//
+// HTML is scraped as it is streamed, and never buffered unless it is stored.
+// Other bodies are buffered within the memoryBudgetMB configuration. Content
+// exceeding the budget is shed, and the worker stops accepting work while its
+// heap is over the budget.
+//
+// The /.well-known/security.txt, /llms.txt, and /humans.txt files of each
+// crawled host are requested once a day, and stored as the host's metadata.
+// The favicon and site name of each host are captured once per job which
+// crawls the host.
+//
+// URLs are crawled through a pipeline of fetch, parse, classify, extract, and
+// persist stages, each run by the number of goroutines set by the pipeline
+// configuration. Responses are handed from the fetchers to the parsers unread,
+// and streamed from the connection as they are scraped.
+//
+// Crawled pages are tagged with the kinds of content they are, e.g: product,
+// article, category, login, or error pages, by the classifiers registered
+// with registerClassifier. The built-in heuristics are always registered.
+//
+// Meta refresh and trivial JavaScript redirects found in crawled HTML pages are
+// recorded as redirect edges, and followed according to the followRedirects
+// configuration.
+//
+// URLs responding 451 Unavailable For Legal Reasons are recorded with the
+// entity blocking them, if the response names one. The skipLegallyRestricted
+// configuration stops the worker crawling the URL again, or opts its host out.
+//
+// If the traceDir configuration is set, the queue items crawled for each job,
+// the responses fetched for them, and how each crawl ended are recorded into
+// a trace file of the job, which can be replayed in tests, see replayTrace.
+//
+// If the fixtures configuration is set, URLs are fetched from the recorded
+// responses of the fixture directory instead of their hosts, see fixtureFetcher.
+// The cassette configuration records every response fetched into a cassette
+// of its job, and replays the cassettes for subsequent crawls.
+//
+// If the metrics configuration is set, the duration of each network and
+// processing stage of a sample of crawls is served as histograms.
+//
+// The URLs of download jobs are downloaded as files into the downloadDir
+// configuration's directory, instead of being crawled. The size and SHA-256
+// checksum of each file is recorded, and verified against the checksum the
+// job was scheduled with. Interrupted downloads are resumed with range requests.
+//
+// ftp:// and sftp:// URLs are fetched from their servers, configured by the
+// remoteFiles configuration. Directories are crawled as HTML listings linking
+// to their entries, and files as their content.
+//
+// If the dns configuration's dohURL is set, the hosts crawled are resolved
+// with the DNS-over-HTTPS endpoint, instead of the system resolver. The dial
+// configuration restricts connections to IPv4 or IPv6, and sets the delay
+// before falling back to a host's addresses of the other family.
+//
+// The clusterLimits configuration limits the HTTP fetches in flight, and the
+// bandwidth of the responses read, across all workers, with counters shared
+// in storage. Their utilization is served with the metrics.
+//
+// If the embeddings configuration's url is set, the main text extracted from
+// the pages of jobs which extract text is split into chunks, embedded by the
+// OpenAI compatible endpoint, and the vectors stored with the page's URL, or
+// written to a Qdrant collection.
+//
+// Once interrupted, or terminated, the worker stops accepting work, and exits
+// after the crawls it accepted finish, adding the URLs they crawled to their
+// jobs' counts.
+//
 func main() {
 	// Configuration file containing all basic configuration for a server instance to run
 	cfgFilename := flag.String("config", "config.json", "The web server configuration file.")
@@ -59,15 +146,181 @@ func main() {
 	}
 	defer sc.Close()
 
-	crawler := NewCrawler(urlQueuePub, sc, cfg.MaxLevel)
+	// Hosts are connected to with the dial configuration's IP family, and
+	// resolved with the DNS-over-HTTPS endpoint if configured, instead of the
+	// system resolver.
+	dial := cfg.Dial.dialContext()
+	if cfg.DNS.DoHURL != "" {
+		dial = newDoHResolver(cfg.DNS, cfg.Dial).DialContext
+	}
+	var transport http.RoundTripper = newDialTransport(dial)
 
-	log.Println("Ready: Waiting for URL work items...")
-	for {
-		item := <-workQueueRecv.Receive()
-		crawler.Crawl(item)
+	// HTTP fetches are limited by the limits shared by all workers if set.
+	var limiter *clusterLimiter
+	if cfg.ClusterLimits.enabled() {
+		if limiter, err = newClusterLimiter(sc.ClusterLimitClient(), cfg.ClusterLimits); err != nil {
+			log.Fatalln("Worker Cluster Limiter: initialization failed:", err)
+		}
+		transport = limiter.transport(transport)
+		go limiter.renewSlots()
+	}
+
+	// Crawls run offline against the fixture directory's responses if set,
+	// and are never cached.
+	var uncached Fetcher = httpFetcher{client: &http.Client{Transport: transport}}
+	fixtures := cfg.Fixtures
+	if cfg.Cassette.Mode == cassetteReplay {
+		fixtures = cfg.Cassette.Dir
+	}
+	if fixtures != "" {
+		if uncached, err = loadFixtureFetcher(fixtures); err != nil {
+			log.Fatalln("Worker Fixture Fetcher: initialization failed:", err)
+		}
+	}
+
+	// Fetched responses are recorded into the cassette of their job.
+	var recorder *cassetteRecorder
+	if cfg.Cassette.Mode == cassetteRecord {
+		if recorder, err = newCassetteRecorder(cfg.Cassette.Dir); err != nil {
+			log.Fatalln("Worker Cassette Recorder: initialization failed:", err)
+		}
+	}
+
+	budget := newMemoryBudget(int64(cfg.MemoryBudgetMB) * 1024 * 1024)
+	go budget.sampleEvery(memorySampleInterval)
+
+	fetcher := uncached
+	if cfg.FetchCacheTTL > 0 && fixtures == "" {
+		fetcher = httpFetcher{client: newFetchCacheClient(sc.FetchCacheClient(), cfg.FetchCacheTTL, budget, transport)}
+		go pruneFetchCache(sc, cfg.FetchCacheTTL)
+	}
+
+	var robots *robotsPolicy
+	if !cfg.IgnoreRobots {
+		robots = newRobotsPolicy(fetcherClient(recorder.fetcher(sharedCassette, uncached)), cfg.UserAgent)
+	}
+
+	registerContentHandler(newXMLHandler(cfg.XMLURLs), xmlMimes...)
+
+	registerContentHandler(htmlHandler{maxToken: int(budget.limit)}, htmlMimes...)
+
+	var tracer *crawlTracer
+	if cfg.TraceDir != "" {
+		if tracer, err = newCrawlTracer(cfg.TraceDir); err != nil {
+			log.Fatalln("Worker Crawl Tracer: initialization failed:", err)
+		}
+	}
+
+	// Recovered panics are counted, and reported if an error reporting
+	// service is configured.
+	reporter, err := errreport.New(cfg.ErrorReporting, "worker")
+	if err != nil {
+		log.Fatalln("Worker Error Reporter: initialization failed:", err)
+	}
 
-		<-time.After(cfg.WorkDelay)
+	// Stage durations of sampled crawls are served with expvar.
+	var stages *stageMetrics
+	if cfg.Metrics.Addr != "" {
+		stages = newStageMetrics(cfg.Metrics.SampleRate)
+		expvar.Publish("stages", stages.vars())
+		expvar.Publish("panics", reporter.Panics())
+		if limiter != nil {
+			expvar.Publish("cluster", limiter.vars())
+		}
+		go func() {
+			log.Fatalln("Worker Metrics: serve failed:", http.ListenAndServe(cfg.Metrics.Addr, nil))
+		}()
+	}
+
+	// ftp:// and sftp:// URLs are fetched from their file servers, unless
+	// crawls run offline.
+	if fixtures == "" {
+		if fetcher, err = newRemoteFileFetcher(fetcher, cfg.RemoteFiles, dial); err != nil {
+			log.Fatalln("Worker Remote File Fetcher: initialization failed:", err)
+		}
+		if uncached, err = newRemoteFileFetcher(uncached, cfg.RemoteFiles, dial); err != nil {
+			log.Fatalln("Worker Remote File Fetcher: initialization failed:", err)
+		}
 	}
+
+	// Files are downloaded without the crawl cache, from web servers and
+	// remote file servers.
+	var downloads *downloader
+	if cfg.DownloadDir != "" {
+		downloads = newDownloader(cfg.DownloadDir, fetcherClient(uncached), cfg.DownloadTimeout)
+	}
+
+	// Fetched responses are written into the WARC file of their job.
+	var warcs *warcRecorder
+	if cfg.WARC.Dir != "" {
+		if warcs, err = newWARCRecorder(cfg.WARC.Dir); err != nil {
+			log.Fatalln("Worker WARC Recorder: initialization failed:", err)
+		}
+	}
+
+	// The main text extracted from pages is embedded if an embeddings
+	// endpoint is configured.
+	var embeddings *embedder
+	if cfg.Embeddings.URL != "" {
+		embeddings = newEmbedder(cfg.Embeddings, sc)
+	}
+
+	// URLs crawled by jobs without a max are counted in batches.
+	crawled := newCrawledCounter(sc.JobClient())
+	go crawled.flushEvery(crawledFlushInterval)
+
+	crawler := NewCrawler(CrawlerConfig{
+		URLQueuePub:    urlQueuePub,
+		Storage:        sc,
+		MaxLevel:       cfg.MaxLevel,
+		LinkScoring:    cfg.LinkScoring,
+		StoreHTML:      cfg.StoreHTML,
+		RedirectPolicy: cfg.FollowRedirects,
+		LegalSkip:      cfg.SkipLegallyRestricted,
+		PoisonAfter:    cfg.PoisonAfterPanics,
+		Fetcher:        fetcher,
+		Uncached:       uncached,
+		Robots:         robots,
+		Budget:         budget,
+		Tracer:         tracer,
+		Recorder:       recorder,
+		WARCs:          warcs,
+		Metrics:        stages,
+		Downloads:      downloads,
+		Embeddings:     embeddings,
+		Reporter:       reporter,
+		Crawled:        crawled,
+	})
+
+	// Once interrupted, or terminated, the worker stops accepting work, and
+	// stops after the crawls it accepted finish.
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	work := make(chan *common.URLQueueItem)
+	go func() {
+		for {
+			// Work isn't accepted while the worker is over its memory budget,
+			// leaving it for other workers.
+			budget.shedLoad()
+
+			select {
+			case <-stop:
+				log.Println("Stopping: Waiting for accepted URL work items to finish...")
+				close(work)
+				return
+			case item := <-workQueueRecv.Receive():
+				work <- item
+			}
+		}
+	}()
+
+	log.Println("Ready: Waiting for URL work items...")
+	crawler.Run(work, cfg.Pipeline, cfg.WorkDelay)
+
+	// Counts not yet flushed would be lost once the worker exits.
+	crawled.flush()
+	log.Println("Stopped")
 }
 
 // Provides the Foreman's configuration information. For connecting to
@@ -86,7 +339,7 @@ type Config struct {
 	// the maximum level the crawling should be allowed to travel
 	MaxLevel int `json:"maxLevel"`
 
-	// Delay before requesting additional work. Indented to prevent
+	// Delay before each fetcher requests additional work. Indented to prevent
 	// flooding domain's with too many requests back to back.
 	// time.Duration string formated value.
 	// e.g: 1m23s for 1 minute and 23 seconds
@@ -96,8 +349,156 @@ type Config struct {
 	// The WorkDelayStr will be parsed, and its value placed into the WorkDelay field.
 	// Used to provide delay between accepting more work.
 	WorkDelay time.Duration `json:"-"`
+
+	// Algorithm used to score a job's internal links once the job completes.
+	// Either "pagerank" or "indegree". Defaults to "pagerank".
+	LinkScoring string `json:"linkScoring"`
+
+	// Versions of crawled HTML pages to store, so they can be requested
+	// later. Either "raw", "sanitized", or "both". Sanitized HTML has scripts
+	// and dangerous attributes removed, and is safe to render. HTML is
+	// not stored if not set.
+	StoreHTML string `json:"storeHTML"`
+
+	// Duration responses fetched by any worker are reused for, instead of
+	// being fetched again. Jobs crawling overlapping URLs within the TTL
+	// share responses. Jobs scheduled with 'noFetchCache' always fetch.
+	// Disabled if not set. time.Duration string formated value, e.g: 10m
+	FetchCacheTTLStr string `json:"fetchCacheTTL"`
+
+	// The FetchCacheTTLStr will be parsed, and its value placed into this field.
+	FetchCacheTTL time.Duration `json:"-"`
+
+	// User agent product token the groups of robots.txt files are matched
+	// against. Defaults to "harvester".
+	UserAgent string `json:"userAgent"`
+
+	// If robots.txt files are ignored, and all URLs are crawled.
+	IgnoreRobots bool `json:"ignoreRobots"`
+
+	// Which meta refresh and JavaScript redirects found in page content are
+	// followed. Either "all", "same-host", or "none". Redirects are recorded
+	// even if not followed. Defaults to "same-host".
+	FollowRedirects string `json:"followRedirects"`
+
+	// What is skipped once a URL responds 451 Unavailable For Legal Reasons.
+	// Either "none", "url" to not crawl the URL again, or "host" to add its
+	// host to the opt-out registry. 451 responses are always recorded.
+	// Defaults to "none".
+	SkipLegallyRestricted string `json:"skipLegallyRestricted"`
+
+	// Panics of a URL's crawls, by any job, before the URL is poisoned,
+	// and no longer crawled. Panics are always recovered from, and recorded
+	// with their stack. Defaults to 2, negative never poisons URLs.
+	PoisonAfterPanics int `json:"poisonAfterPanics"`
+
+	// Sentry compatible service the recovered panics are reported to, with
+	// their stack. Panics are only logged, and counted if not set.
+	ErrorReporting errreport.Config `json:"errorReporting"`
+
+	// Names of the elements and attributes whose values are URLs in XML
+	// documents which are not sitemaps, e.g: feeds and catalogs. Each list
+	// not set defaults to the names used by RSS, Atom, and RDF.
+	XMLURLs XMLURLNames `json:"xmlURLs"`
+
+	// Memory in megabytes the worker buffers response bodies within. Bodies
+	// exceeding the budget are not buffered, and the worker stops accepting
+	// work while its heap exceeds the budget. HTML is streamed, so only
+	// bodies of other content, and stored HTML, count against the budget.
+	// Defaults to 256.
+	MemoryBudgetMB int `json:"memoryBudgetMB"`
+
+	// Concurrency of the stages URLs are crawled through, and the number of
+	// crawls queued between them.
+	Pipeline PipelineConfig `json:"pipeline"`
+
+	// Directory the crawls of each job are traced into, so a failed crawl
+	// can be replayed. Traces include the bodies of fetched responses, and
+	// are never removed. Crawls are not traced if not set.
+	TraceDir string `json:"traceDir"`
+
+	// Directory of recorded responses URLs are fetched from, instead of
+	// their hosts, so crawls run offline. Responses are listed by the
+	// directory's fixtures.json, or recorded by crawl traces in it. URLs
+	// without a response are not found. The fetch cache is not used.
+	Fixtures string `json:"fixtures"`
+
+	// Records every fetched response into a cassette of its job, or replays
+	// the recorded cassettes instead of fetching from the URLs' hosts.
+	Cassette CassetteConfig `json:"cassette"`
+
+	// Writes every response fetched by a job's crawls into a WARC file of
+	// the job, so crawls can be replayed by web-archiving tools.
+	WARC WARCConfig `json:"warc"`
+
+	// Serves the durations of the DNS, connect, TLS, time to first byte,
+	// download, parse, and persist stages of sampled crawls.
+	Metrics MetricsConfig `json:"metrics"`
+
+	// Directory the files of download jobs are downloaded into, in a sub
+	// directory of each job. Partial downloads are kept, and resumed when
+	// retried. Workers without a download directory fail download jobs.
+	DownloadDir string `json:"downloadDir"`
+
+	// Longest each file of a download job may take to download, after which
+	// the download fails, and is resumed when retried. Defaults to 1h.
+	// time.Duration string formated value, e.g: 30m
+	DownloadTimeoutStr string `json:"downloadTimeout"`
+
+	// The DownloadTimeoutStr will be parsed, and its value placed into this field.
+	DownloadTimeout time.Duration `json:"-"`
+
+	// Connections to the FTP and SFTP servers of ftp:// and sftp:// URLs.
+	RemoteFiles RemoteFilesConfig `json:"remoteFiles"`
+
+	// Resolution of the names of the hosts crawled. Hosts are resolved by
+	// the system resolver unless a DNS-over-HTTPS endpoint is configured.
+	DNS DNSConfig `json:"dns"`
+
+	// IP family, and happy eyeballs fallback of the connections to the hosts
+	// crawled.
+	Dial DialConfig `json:"dial"`
+
+	// Concurrent fetch, and bandwidth limits shared by all workers, so the
+	// sum of all jobs' crawls stays within the cluster's egress budget.
+	ClusterLimits ClusterLimitsConfig `json:"clusterLimits"`
+
+	// Embedding endpoint the main text extracted from pages is embedded
+	// with, and where the vectors are written. Text is not embedded if not
+	// set.
+	Embeddings EmbeddingsConfig `json:"embeddings"`
 }
 
+// Memory budget of the worker if not configured.
+const defaultMemoryBudgetMB = 256
+
+// Longest a file of a download job may take to download if not configured.
+const defaultDownloadTimeout = time.Hour
+
+// User agent robots.txt groups are matched against if not configured.
+const defaultUserAgent = "harvester"
+
+// Policies of which redirects found in page content are followed
+const (
+	redirectPolicyAll      = "all"
+	redirectPolicySameHost = "same-host"
+	redirectPolicyNone     = "none"
+)
+
+// Policies of what is skipped once a URL responds 451
+const (
+	legalSkipNone = "none"
+	legalSkipURL  = "url"
+	legalSkipHost = "host"
+)
+
+// Versions of crawled HTML pages which can be stored
+const (
+	storeHTMLRaw       = "raw"
+	storeHTMLSanitized = "sanitized"
+	storeHTMLBoth      = "both"
+)
+
 // Loads the configuration file from disk in as a JSON blob.
 func LoadConfig(filename string) (Config, error) {
 	cfg := Config{}
@@ -121,5 +522,110 @@ func LoadConfig(filename string) (Config, error) {
 		}
 	}
 
+	if cfg.LinkScoring == "" {
+		cfg.LinkScoring = common.LinkScorePageRank
+	} else if !common.ValidLinkScoreAlgorithm(cfg.LinkScoring) {
+		return cfg, fmt.Errorf("Invalid link scoring algorithm %s", cfg.LinkScoring)
+	}
+
+	if cfg.FetchCacheTTLStr != "" {
+		cfg.FetchCacheTTL, err = time.ParseDuration(cfg.FetchCacheTTLStr)
+		if err != nil {
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.FetchCacheTTLStr)
+		} else if cfg.FetchCacheTTL < 0 {
+			return cfg, fmt.Errorf("Invalid fetch cache TTL %s, must be positive", cfg.FetchCacheTTLStr)
+		}
+	}
+
+	if cfg.DownloadTimeoutStr == "" {
+		cfg.DownloadTimeout = defaultDownloadTimeout
+	} else {
+		cfg.DownloadTimeout, err = time.ParseDuration(cfg.DownloadTimeoutStr)
+		if err != nil {
+			return cfg, fmt.Errorf("%s, %s", err.Error(), cfg.DownloadTimeoutStr)
+		} else if cfg.DownloadTimeout <= 0 {
+			return cfg, fmt.Errorf("Invalid download timeout %s, must be positive", cfg.DownloadTimeoutStr)
+		}
+	}
+
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = defaultUserAgent
+	}
+
+	switch cfg.FollowRedirects {
+	case "":
+		cfg.FollowRedirects = redirectPolicySameHost
+	case redirectPolicyAll, redirectPolicySameHost, redirectPolicyNone:
+	default:
+		return cfg, fmt.Errorf("Invalid follow redirects policy %s", cfg.FollowRedirects)
+	}
+
+	switch cfg.SkipLegallyRestricted {
+	case "":
+		cfg.SkipLegallyRestricted = legalSkipNone
+	case legalSkipNone, legalSkipURL, legalSkipHost:
+	default:
+		return cfg, fmt.Errorf("Invalid skip legally restricted policy %s", cfg.SkipLegallyRestricted)
+	}
+
+	if cfg.PoisonAfterPanics == 0 {
+		cfg.PoisonAfterPanics = defaultPoisonAfterPanics
+	} else if cfg.PoisonAfterPanics < 0 {
+		cfg.PoisonAfterPanics = 0
+	}
+
+	if len(cfg.XMLURLs.Elements) == 0 {
+		cfg.XMLURLs.Elements = defaultXMLURLNames.Elements
+	}
+	if len(cfg.XMLURLs.Attributes) == 0 {
+		cfg.XMLURLs.Attributes = defaultXMLURLNames.Attributes
+	}
+
+	if cfg.MemoryBudgetMB == 0 {
+		cfg.MemoryBudgetMB = defaultMemoryBudgetMB
+	} else if cfg.MemoryBudgetMB < 0 {
+		return cfg, fmt.Errorf("Invalid memory budget %d, must be positive", cfg.MemoryBudgetMB)
+	}
+
+	if err := cfg.Pipeline.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Metrics.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.RemoteFiles.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.DNS.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Dial.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Embeddings.setDefaults(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.ClusterLimits.validate(); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.Cassette.validate(); err != nil {
+		return cfg, err
+	} else if cfg.Cassette.Mode == cassetteReplay && cfg.Fixtures != "" {
+		return cfg, fmt.Errorf("Cassette replay can not be used with fixtures")
+	}
+
+	switch cfg.StoreHTML {
+	case "", storeHTMLRaw, storeHTMLSanitized, storeHTMLBoth:
+	default:
+		return cfg, fmt.Errorf("Invalid store HTML setting %s", cfg.StoreHTML)
+	}
+
 	return cfg, nil
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Returned when buffering a response body would exceed the worker's memory budget.
+var errOverMemoryBudget = errors.New("Response body exceeds memory budget")
+
+// Size of the chunks response bodies are buffered, and reserved from the memory
+// budget, in.
+const bodyChunkSize = 32 * 1024
+
+// Largest body buffer returned to the pool. Larger buffers are left to the
+// GC, so a few large bodies don't pin their memory in the pool.
+const maxPooledBodySize = 4 * 1024 * 1024
+
+// Pools of the chunks bodies are read with, and the buffers they are read
+// into, so each crawl doesn't allocate its own.
+var (
+	bodyChunkPool = sync.Pool{New: func() interface{} {
+		return make([]byte, bodyChunkSize)
+	}}
+	bodyBufferPool = sync.Pool{New: func() interface{} {
+		return make([]byte, 0, bodyChunkSize)
+	}}
+)
+
+// Returns a chunk of bodyChunkSize bytes from the pool.
+func getBodyChunk() []byte {
+	return bodyChunkPool.Get().([]byte)
+}
+
+// Returns the chunk to the pool.
+func putBodyChunk(chunk []byte) {
+	bodyChunkPool.Put(chunk)
+}
+
+// Returns the body buffer to the pool, if not too large.
+func putBodyBuffer(buf []byte) {
+	if cap(buf) == 0 || cap(buf) > maxPooledBodySize {
+		return
+	}
+	bodyBufferPool.Put(buf[:0])
+}
+
+// Longest a worker sheds load for, waiting for its heap to return within the
+// budget, before accepting work again.
+const maxShedWait = 30 * time.Second
+
+// Interval between sampling the worker's heap. Reading the heap stops the
+// world, so it isn't read before accepting each item of work.
+const memorySampleInterval = time.Second
+
+// Limits the memory a worker uses buffering response bodies. Bodies are
+// reserved from the budget as they are read, and released once the page is
+// crawled. A body which can't be reserved is not buffered. The budget is also
+// compared against the last sample of the worker's heap before accepting work,
+// so an over budget worker sheds load to other workers instead of thrashing the
+// GC.
+type memoryBudget struct {
+	limit int64
+
+	// Bytes of the worker's heap when last sampled, accessed atomically
+	heap int64
+
+	mu       sync.Mutex
+	reserved int64
+}
+
+// Creates a memory budget limited to the number of bytes.
+func newMemoryBudget(limit int64) *memoryBudget {
+	return &memoryBudget{limit: limit}
+}
+
+// Reserves the number of bytes from the budget. False is returned if the
+// reservation would exceed the budget. A nil budget is unlimited.
+func (b *memoryBudget) reserve(n int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reserved+n > b.limit {
+		return false
+	}
+	b.reserved += n
+	return true
+}
+
+// Releases bytes previously reserved from the budget.
+func (b *memoryBudget) release(n int64) {
+	if b == nil || n == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reserved -= n
+}
+
+// Samples the worker's heap every interval. Blocks forever, and is expected
+// to be run in its own go routine.
+func (b *memoryBudget) sampleEvery(interval time.Duration) {
+	for {
+		b.sample()
+		time.Sleep(interval)
+	}
+}
+
+// Records the worker's current heap as the sample compared to the budget.
+func (b *memoryBudget) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	atomic.StoreInt64(&b.heap, int64(m.HeapAlloc))
+}
+
+// Returns true if the last sample of the worker's heap exceeds the budget.
+func (b *memoryBudget) overBudget() bool {
+	return atomic.LoadInt64(&b.heap) > b.limit
+}
+
+// Blocks while the worker's heap exceeds the budget, so no more work is
+// accepted until the worker is within budget. Memory is returned to the OS
+// once when the worker starts shedding load. Gives up waiting after the
+// maxShedWait.
+func (b *memoryBudget) shedLoad() {
+	if b == nil || !b.overBudget() {
+		return
+	}
+
+	log.Println("memoryBudget: heap over budget, shedding load")
+	debug.FreeOSMemory()
+	b.sample()
+	for started := time.Now(); time.Now().Sub(started) < maxShedWait; {
+		if !b.overBudget() {
+			log.Println("memoryBudget: heap within budget, accepting work after", time.Now().Sub(started).String())
+			return
+		}
+		<-time.After(memorySampleInterval)
+	}
+	log.Println("memoryBudget: heap still over budget after", maxShedWait.String(), "accepting work")
+}
+
+// Buffer of a response body whose memory is reserved from a budget as it is
+// written. Once a write would exceed the budget the buffer is discarded, and
+// further writes are ignored.
+type budgetBuffer struct {
+	budget *memoryBudget
+
+	buf      []byte
+	reserved int64
+	over     bool
+}
+
+func (b *budgetBuffer) Write(p []byte) (int, error) {
+	if b.over {
+		return len(p), nil
+	}
+	if need := int64(len(b.buf) + len(p)); need > b.reserved {
+		// Reserve in chunks so the budget isn't locked for every write.
+		n := ((need-b.reserved)/bodyChunkSize + 1) * bodyChunkSize
+		if !b.budget.reserve(n) {
+			b.discard()
+			b.over = true
+			return len(p), nil
+		}
+		b.reserved += n
+	}
+	if b.buf == nil {
+		b.buf = bodyBufferPool.Get().([]byte)
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// Returns the buffered bytes, and false if the buffer exceeded the budget.
+// The bytes are from the body buffer pool, and should be returned to it with
+// putBodyBuffer once no longer used.
+func (b *budgetBuffer) Bytes() ([]byte, bool) {
+	if b.over {
+		return nil, false
+	}
+	if b.buf == nil {
+		return []byte{}, true
+	}
+	return b.buf, true
+}
+
+// Drops the buffered bytes, releasing their reservation.
+func (b *budgetBuffer) discard() {
+	putBodyBuffer(b.buf)
+	b.buf = nil
+	b.budget.release(b.reserved)
+	b.reserved = 0
+}
+
+// Reads the body into memory reserved from the budget. Returns the body, and
+// the number of bytes reserved for it, which must be released once the body
+// is no longer used. errOverMemoryBudget is returned if the body exceeds the
+// budget, and the remainder of the body is not read.
+func readBody(r io.Reader, budget *memoryBudget) ([]byte, int64, error) {
+	b := &budgetBuffer{budget: budget}
+	chunk := getBodyChunk()
+	defer putBodyChunk(chunk)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			b.Write(chunk[:n])
+			if b.over {
+				return nil, 0, errOverMemoryBudget
+			}
+		}
+		if err == io.EOF {
+			body, _ := b.Bytes()
+			return body, b.reserved, nil
+		} else if err != nil {
+			b.discard()
+			return nil, 0, err
+		}
+	}
+}
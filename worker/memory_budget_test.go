@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMemoryBudgetReserve(t *testing.T) {
+	b := newMemoryBudget(100)
+	assert.True(t, b.reserve(60), "Expect reservation within budget")
+	assert.False(t, b.reserve(50), "Expect reservation over budget refused")
+	b.release(60)
+	assert.True(t, b.reserve(100), "Expect released memory reservable")
+
+	var unlimited *memoryBudget
+	assert.True(t, unlimited.reserve(1<<40), "Expect nil budget unlimited")
+}
+
+func TestMemoryBudgetOverBudget(t *testing.T) {
+	b := newMemoryBudget(1)
+	assert.False(t, b.overBudget(), "Expect within budget until sampled")
+	b.sample()
+	assert.True(t, b.overBudget(), "Expect sampled heap over budget")
+}
+
+func TestReadBody(t *testing.T) {
+	b := newMemoryBudget(2 * bodyChunkSize)
+
+	body, reserved, err := readBody(strings.NewReader("content"), b)
+	require.NoError(t, err, "Expect body read")
+	assert.Equal(t, []byte("content"), body, "Expect body")
+	assert.Equal(t, int64(bodyChunkSize), reserved, "Expect chunk reserved")
+	b.release(reserved)
+
+	_, _, err = readBody(bytes.NewReader(make([]byte, 3*bodyChunkSize)), b)
+	assert.Equal(t, errOverMemoryBudget, err, "Expect body over budget")
+	assert.Equal(t, int64(0), b.reserved, "Expect reservation released")
+}
+
+func TestScrapeMemoryBudget(t *testing.T) {
+	big := strings.Repeat("x", 2*bodyChunkSize)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/first">` + big + `</a><a href="/last">last</a>`))
+		case "/doc.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("http://example.com/linked " + big))
+		}
+	}))
+	defer server.Close()
+
+	b := newMemoryBudget(bodyChunkSize)
+
+	page, err := Scrape(server.URL+"/page", httpFetcher{client: http.DefaultClient}, scrapeOptions{budget: b})
+	require.NoError(t, err, "Expect HTML scraped")
+	assert.False(t, page.Shed, "Expect streamed HTML not shed")
+	assert.Nil(t, page.Body, "Expect HTML not kept")
+	assert.Equal(t, []string{server.URL + "/first", server.URL + "/last"}, page.URLs, "Expect all HTML URLs")
+	assert.NotEmpty(t, page.ContentHash(), "Expect streamed HTML hashed")
+
+	page, err = Scrape(server.URL+"/page", httpFetcher{client: http.DefaultClient}, scrapeOptions{budget: b, keepHTML: true})
+	require.NoError(t, err, "Expect HTML scraped")
+	assert.Nil(t, page.Body, "Expect HTML over budget not kept")
+	assert.Len(t, page.URLs, 2, "Expect HTML over budget still scraped")
+
+	page, err = Scrape(server.URL+"/doc.pdf", httpFetcher{client: http.DefaultClient}, scrapeOptions{budget: b})
+	require.NoError(t, err, "Expect PDF requested")
+	assert.True(t, page.Shed, "Expect PDF over budget shed")
+	assert.Empty(t, page.URLs, "Expect shed PDF not scraped")
+	assert.Equal(t, int64(0), b.reserved, "Expect no memory left reserved")
+
+	b = newMemoryBudget(4 * bodyChunkSize)
+	page, err = Scrape(server.URL+"/page", httpFetcher{client: http.DefaultClient}, scrapeOptions{budget: b, keepHTML: true})
+	require.NoError(t, err, "Expect HTML scraped")
+	assert.Len(t, page.Body, int(page.Size), "Expect HTML within budget kept")
+	assert.NotZero(t, b.reserved, "Expect kept HTML reserved")
+	page.Release()
+	assert.Equal(t, int64(0), b.reserved, "Expect released page's memory returned")
+}
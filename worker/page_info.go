@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/common"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// Regex for finding all meta tags within an HTML document.
+	htmlMetaTagRegexp = `(?i)<meta\s[^>]+>`
+
+	// Regex for extracting the attributes and their values from an HTML tag.
+	htmlAttrRegexp = `([\w:.-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`
+
+	// Regex for finding all link tags within an HTML document.
+	htmlLinkTagRegexp = `(?i)<link\s[^>]+>`
+
+	// Regex for JSON-LD datePublished and dateModified properties.
+	jsonLDDateRegexp = `"(datePublished|dateModified)"\s*:\s*"([^"]+)"`
+)
+
+var htmlMetaTagRegexpComp *regexp.Regexp
+var htmlAttrRegexpComp *regexp.Regexp
+var htmlLinkTagRegexpComp *regexp.Regexp
+var jsonLDDateRegexpComp *regexp.Regexp
+
+func init() {
+	htmlMetaTagRegexpComp = regexp.MustCompile(htmlMetaTagRegexp)
+	htmlAttrRegexpComp = regexp.MustCompile(htmlAttrRegexp)
+	htmlLinkTagRegexpComp = regexp.MustCompile(htmlLinkTagRegexp)
+	jsonLDDateRegexpComp = regexp.MustCompile(jsonLDDateRegexp)
+}
+
+// Meta tag names, properties, or itemprops which specify when the content was published.
+var metaPublishedNames = map[string]struct{}{
+	"article:published_time": struct{}{},
+	"og:published_time":      struct{}{},
+	"datepublished":          struct{}{},
+	"date":                   struct{}{},
+	"pubdate":                struct{}{},
+	"publish-date":           struct{}{},
+	"dc.date.issued":         struct{}{},
+}
+
+// Meta tag names, properties, or itemprops which specify when the content was last modified.
+var metaModifiedNames = map[string]struct{}{
+	"article:modified_time": struct{}{},
+	"og:updated_time":       struct{}{},
+	"datemodified":          struct{}{},
+	"last-modified":         struct{}{},
+	"dc.date.modified":      struct{}{},
+}
+
+// Date formats content dates are commonly written in.
+var contentDateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123,
+	time.RFC1123Z,
+}
+
+// Extracts the page information from the response header, and HTML document body.
+// Dates found within the content are preferred over the Last-Modified header,
+// because dynamic pages commonly set the header to the time of the request.
+func findPageInfo(header http.Header, body []byte) common.PageInfo {
+	info := common.PageInfo{}
+	if len(body) > 0 {
+		scan, _ := scanHTML(bytes.NewReader(body), 0)
+		info = scan.info
+	}
+	addHeaderPageInfo(&info, header)
+	return info
+}
+
+// Sets the modified date of the page information from the response's
+// Last-Modified header, if the content did not provide one.
+func addHeaderPageInfo(info *common.PageInfo, header http.Header) {
+	if info.ModifiedOn.IsZero() && header != nil {
+		if t, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+			info.ModifiedOn = t.UTC()
+		}
+	}
+}
+
+// Adds the dates and description of the meta tag's attributes to the page
+// information, if not already set. Attribute values are expected unescaped.
+func addMetaPageInfo(info *common.PageInfo, attrs map[string]string) {
+	name := attrs["property"]
+	if name == "" {
+		name = attrs["name"]
+	}
+	if name == "" {
+		name = attrs["itemprop"]
+	}
+	name = strings.ToLower(name)
+
+	if _, ok := metaPublishedNames[name]; ok && info.PublishedOn.IsZero() {
+		info.PublishedOn = parseContentDate(attrs["content"])
+	} else if _, ok := metaModifiedNames[name]; ok && info.ModifiedOn.IsZero() {
+		info.ModifiedOn = parseContentDate(attrs["content"])
+	} else if name == "description" && info.Description == "" {
+		info.Description = attrs["content"]
+	}
+}
+
+// Adds the JSON-LD datePublished and dateModified found in the script's text
+// to the page information, if not already set.
+func addJSONLDPageInfo(info *common.PageInfo, script []byte) {
+	for _, m := range jsonLDDateRegexpComp.FindAllSubmatch(script, -1) {
+		if string(m[1]) == "datePublished" && info.PublishedOn.IsZero() {
+			info.PublishedOn = parseContentDate(string(m[2]))
+		} else if string(m[1]) == "dateModified" && info.ModifiedOn.IsZero() {
+			info.ModifiedOn = parseContentDate(string(m[2]))
+		}
+	}
+}
+
+// Counts the words of the HTML document which would be visible when displayed.
+// Text of hidden elements, e.g: script and style, and of the head, is not
+// counted. Words are separated by white space, and must contain at least one
+// letter or number.
+func countVisibleWords(doc []byte) int {
+	if len(doc) == 0 {
+		return 0
+	}
+	scan, _ := scanHTML(bytes.NewReader(doc), 0)
+	return scan.info.WordCount
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// Returns a mapping of the HTML tag's lower cased attribute names to their values.
+func htmlTagAttrs(tag []byte) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range htmlAttrRegexpComp.FindAllSubmatch(tag, -1) {
+		value := m[2]
+		if len(m[3]) > 0 {
+			value = m[3]
+		}
+		attrs[strings.ToLower(string(m[1]))] = strings.TrimSpace(string(value))
+	}
+	return attrs
+}
+
+// Attempts to parse the date string using the common content date formats.
+// A zero time is returned if the date could not be parsed.
+func parseContentDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range contentDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
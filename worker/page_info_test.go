@@ -0,0 +1,74 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFindPageInfoMetaTags(t *testing.T) {
+	doc := []byte(`
+<head>
+<meta content="2015-01-02T10:30:00Z" property="article:published_time"/>
+<meta name="last-modified" content='2015-01-05'>
+</head>
+`)
+	info := findPageInfo(nil, doc)
+	assert.Equal(t, time.Date(2015, 1, 2, 10, 30, 0, 0, time.UTC), info.PublishedOn, "Expect published date from meta tag")
+	assert.Equal(t, time.Date(2015, 1, 5, 0, 0, 0, 0, time.UTC), info.ModifiedOn, "Expect modified date from meta tag")
+}
+
+func TestFindPageInfoJSONLD(t *testing.T) {
+	doc := []byte(`
+<script type="application/ld+json">
+{"@type": "Article", "datePublished": "2014-12-24", "dateModified": "2015-01-03T08:00:00+01:00"}
+</script>
+`)
+	header := make(http.Header)
+	header.Set("Last-Modified", "Tue, 06 Jan 2015 10:00:00 GMT")
+
+	info := findPageInfo(header, doc)
+	assert.Equal(t, time.Date(2014, 12, 24, 0, 0, 0, 0, time.UTC), info.PublishedOn, "Expect published date from JSON-LD")
+	assert.Equal(t, time.Date(2015, 1, 3, 7, 0, 0, 0, time.UTC), info.ModifiedOn, "Expect JSON-LD modified date preferred over header")
+}
+
+func TestFindPageInfoHeader(t *testing.T) {
+	header := make(http.Header)
+	header.Set("Last-Modified", "Tue, 06 Jan 2015 10:00:00 GMT")
+
+	info := findPageInfo(header, nil)
+	assert.True(t, info.PublishedOn.IsZero(), "Expect no published date")
+	assert.Equal(t, time.Date(2015, 1, 6, 10, 0, 0, 0, time.UTC), info.ModifiedOn, "Expect modified date from header")
+}
+
+func TestCountVisibleWords(t *testing.T) {
+	doc := []byte(`<html>
+<head><title>Not counted</title><meta name="description" content="not counted"></head>
+<body>
+<!-- a comment that isn't visible -->
+<script type="text/javascript">var notCounted = "words";</script>
+<style>.hidden { display: none; }</style>
+<h1>Three visible words</h1>
+<p>Tom &amp; Jerry - 2015</p>
+</body>
+</html>`)
+	assert.Equal(t, 6, countVisibleWords(doc), "Expect only visible words to be counted")
+	assert.Equal(t, 0, countVisibleWords(nil), "Expect no words in empty doc")
+}
+
+func TestFindPageInfoHeadings(t *testing.T) {
+	doc := []byte(`<html>
+<head>
+<title>
+	Tom &amp; Jerry
+</title>
+<meta name="Description" content="All about Tom &amp; Jerry">
+</head>
+<body><h1 class="main">The <em>Cat</em> and Mouse</h1><h1>Second</h1></body>
+</html>`)
+	info := findPageInfo(nil, doc)
+	assert.Equal(t, "Tom & Jerry", info.Title, "Expect title to match")
+	assert.Equal(t, "All about Tom & Jerry", info.Description, "Expect description to match")
+	assert.Equal(t, "The Cat and Mouse", info.H1, "Expect first h1 to match")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"runtime/debug"
+	"strconv"
+)
+
+// Panics of a URL's crawls, by any job, before the URL is poisoned if not
+// configured.
+const defaultPoisonAfterPanics = 2
+
+// Wraps the stage so a panic while running it is recovered from, instead of
+// crashing the worker. The panic is passed to onPanic with the stack it
+// panicked at, and the stage returns false, so the crawl is finished.
+func recoverStage(name string, stage crawlStage, onPanic func(t *crawlTask, stage string, r interface{}, stack []byte)) crawlStage {
+	return func(t *crawlTask) (ok bool) {
+		defer func() {
+			if r := recover(); r != nil {
+				onPanic(t, name, r, debug.Stack())
+				ok = false
+			}
+		}()
+		return stage(t)
+	}
+}
+
+// Returns the stages of the crawl in order: fetch, parse, classify, extract,
+// and persist, each recovering from its panics.
+func (c *Crawler) stages() []crawlStage {
+	return []crawlStage{
+		recoverStage("fetch", c.fetch, c.recordPanic),
+		recoverStage("parse", c.parse, c.recordPanic),
+		recoverStage("classify", c.classify, c.recordPanic),
+		recoverStage("extract", c.extract, c.recordPanic),
+		recoverStage("persist", c.persist, c.recordPanic),
+	}
+}
+
+// Completes the crawl, recovering from a panic while doing so. The crawl's
+// pending URL is left pending if finishing it panicked.
+func (c *Crawler) finishRecovered(t *crawlTask) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.recordPanic(t, "finish", r, debug.Stack())
+		}
+	}()
+	c.finish(t)
+}
+
+// Records the panic of the task's crawl against its URL, and ends the crawl.
+// The URL is poisoned once it has panicked the worker's poison threshold
+// number of times, so it doesn't keep panicking the workers of later crawls.
+// The panic is counted by its stage, and reported if configured.
+func (c *Crawler) recordPanic(t *crawlTask, stage string, r interface{}, stack []byte) {
+	item := t.item
+	log.Printf("crawl: Recovered from panic in %s of %d, job %d: %v\n%s", stage, item.URLId, item.JobId, r, stack)
+	t.decision = tracePanicked
+	c.reporter.Panic(stage, r, stack, map[string]string{
+		"stage": stage,
+		"jobId": strconv.FormatInt(int64(item.JobId), 10),
+		"urlId": strconv.FormatInt(int64(item.URLId), 10),
+	})
+
+	poisoned, err := c.sc.URLClient().AddPanic(item.JobId, item.URLId, stage, fmt.Sprint(r), string(stack), c.poisonAfter)
+	if err != nil {
+		log.Println("crawl: Failed to record panic", item.URLId, err)
+	} else if poisoned {
+		log.Println("crawl: Poisoned URL which repeatedly panicked", item.URLId)
+	}
+}
+
+// Returns true if the URL has been poisoned by repeatedly panicking workers.
+// If the URL can't be checked it is assumed not to be poisoned.
+func (c *Crawler) poisoned(urlId common.URLId) bool {
+	poisoned, err := c.sc.URLClient().IsPoisoned(urlId)
+	if err != nil {
+		log.Println("crawl: Failed to check if URL is poisoned", urlId, err)
+		return false
+	}
+	return poisoned
+}
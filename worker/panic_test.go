@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRecoverStage(t *testing.T) {
+	var panicked []string
+	var stacks [][]byte
+	onPanic := func(task *crawlTask, stage string, r interface{}, stack []byte) {
+		task.decision = tracePanicked
+		panicked = append(panicked, stage+": "+r.(string))
+		stacks = append(stacks, stack)
+	}
+
+	stage := recoverStage("parse", func(t *crawlTask) bool {
+		panic("boom")
+	}, onPanic)
+	task := newCrawlTask(&common.URLQueueItem{URLId: 1})
+	assert.False(t, stage(task), "Expect panicked stage not to continue")
+	assert.Equal(t, tracePanicked, task.decision)
+	assert.Equal(t, []string{"parse: boom"}, panicked)
+	assert.Contains(t, string(stacks[0]), "TestRecoverStage", "Expect stack of the panic")
+
+	stage = recoverStage("extract", func(t *crawlTask) bool { return true }, onPanic)
+	assert.True(t, stage(newCrawlTask(&common.URLQueueItem{URLId: 2})), "Expect stage result passed through")
+	assert.Len(t, panicked, 1, "Expect no panic recorded")
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Most bytes of a page's raw content stored when the page fails to be parsed.
+const quarantineMaxBytes = 64 << 10
+
+// Byte order marks of the encodings the workers can't decode, longest first
+// so UTF-32 isn't mistaken for UTF-16.
+var unsupportedBOMs = []struct {
+	bom     []byte
+	charset string
+}{
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, "utf-32be"},
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, "utf-32le"},
+	{[]byte{0xFE, 0xFF}, "utf-16be"},
+	{[]byte{0xFF, 0xFE}, "utf-16le"},
+}
+
+// Checks the encoding of content as it is written. Content declaring a UTF-16,
+// or UTF-32 charset, or starting with their byte order mark, can't be decoded
+// by the workers' scrapers. Content declaring UTF-8, and JSON, which is always
+// UTF-8, must be valid UTF-8.
+type encodingCheck struct {
+	// Charset of the content the workers can't decode, empty if none.
+	unsupported string
+
+	// If the content is validated as UTF-8
+	validate bool
+
+	// Bytes validated, and the bytes of a rune split across writes.
+	offset  int64
+	pending []byte
+
+	// Offset of the first invalid byte, -1 if none found.
+	invalidAt int64
+}
+
+// Creates a check of the encoding of the response's content, declared by its
+// Content-Type header, or the byte order mark of the start of its content.
+func newEncodingCheck(header http.Header, contentType string, start []byte) *encodingCheck {
+	c := &encodingCheck{invalidAt: -1}
+
+	charset := ""
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		charset = strings.ToLower(params["charset"])
+	}
+	for _, b := range unsupportedBOMs {
+		if bytes.HasPrefix(start, b.bom) {
+			c.unsupported = b.charset
+			return c
+		}
+	}
+	if strings.HasPrefix(charset, "utf-16") || strings.HasPrefix(charset, "utf-32") || charset == "ucs-2" {
+		c.unsupported = charset
+		return c
+	}
+
+	isJSON := contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+	c.validate = charset == "utf-8" || charset == "utf8" || (charset == "" && isJSON)
+	return c
+}
+
+func (c *encodingCheck) Write(p []byte) (int, error) {
+	n := len(p)
+	if !c.validate || c.invalidAt >= 0 {
+		return n, nil
+	}
+
+	// Completes the rune split across the previous write.
+	for len(c.pending) > 0 && len(p) > 0 && !utf8.FullRune(c.pending) {
+		c.pending = append(c.pending, p[0])
+		p = p[1:]
+	}
+	if len(c.pending) > 0 {
+		if !utf8.FullRune(c.pending) {
+			return n, nil
+		}
+		if r, size := utf8.DecodeRune(c.pending); r == utf8.RuneError && size <= 1 {
+			c.invalidAt = c.offset
+			return n, nil
+		}
+		c.offset += int64(len(c.pending))
+		c.pending = c.pending[:0]
+	}
+
+	// A rune split at the end of the write is left pending.
+	i := 0
+	for i < len(p) {
+		if p[i] < utf8.RuneSelf {
+			i++
+			continue
+		}
+		if !utf8.FullRune(p[i:]) {
+			c.pending = append(c.pending, p[i:]...)
+			break
+		}
+		r, size := utf8.DecodeRune(p[i:])
+		if r == utf8.RuneError && size == 1 {
+			c.invalidAt = c.offset + int64(i)
+			return n, nil
+		}
+		i += size
+	}
+	c.offset += int64(i)
+	return n, nil
+}
+
+// Returns the encoding error of the content written, empty if none. Expects
+// all of the content to have been written.
+func (c *encodingCheck) err() string {
+	if c.unsupported != "" {
+		return fmt.Sprintf("Unsupported charset %s", c.unsupported)
+	}
+	if c.invalidAt < 0 && len(c.pending) > 0 {
+		// The content ended within a rune.
+		c.invalidAt = c.offset
+	}
+	if c.invalidAt >= 0 {
+		return fmt.Sprintf("Invalid UTF-8 at byte %d", c.invalidAt)
+	}
+	return ""
+}
+
+// Keeps the first max bytes written to it.
+type headBuffer struct {
+	max int
+	b   []byte
+}
+
+func (h *headBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if room := h.max - len(h.b); room > 0 {
+		if len(p) > room {
+			p = p[:room]
+		}
+		h.b = append(h.b, p...)
+	}
+	return n, nil
+}
+
+// Quarantines the crawled page which failed to be parsed, storing its raw
+// content with the parse error, so it can be reviewed in the job's parse
+// failure report. Up to quarantineMaxBytes of the content are stored.
+func (c *Crawler) quarantine(t *crawlTask) {
+	item, urlRec, page := t.item, t.urlRec, t.page
+	log.Println("crawl: Failed to parse", item.URLId, urlRec.URL, page.ParseError)
+
+	raw := page.Body
+	if raw == nil {
+		raw = page.rawHead
+	}
+	failure := common.ParseFailure{
+		Mime:      page.Mime,
+		Error:     page.ParseError,
+		Size:      page.Size,
+		Truncated: int64(len(raw)) < page.Size,
+		FailedOn:  time.Now().UTC(),
+	}
+	if len(raw) > quarantineMaxBytes {
+		raw, failure.Truncated = raw[:quarantineMaxBytes], true
+	}
+	failure.Raw = raw
+
+	if err := c.sc.URLClient().AddParseFailure(item.JobId, item.URLId, failure); err != nil {
+		log.Println("crawl: failed to quarantine URL's content", item.URLId, err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEncodingCheckSplitRune(t *testing.T) {
+	header := http.Header{"Content-Type": []string{"text/html; charset=utf-8"}}
+	c := newEncodingCheck(header, "text/html", nil)
+
+	content := []byte("café 世界")
+	for i := range content {
+		c.Write(content[i : i+1])
+	}
+	assert.Empty(t, c.err(), "Expect runes split across writes to be valid")
+}
+
+func TestEncodingCheckInvalid(t *testing.T) {
+	header := http.Header{"Content-Type": []string{"text/html; charset=UTF-8"}}
+	c := newEncodingCheck(header, "text/html", nil)
+	c.Write([]byte("abc"))
+	c.Write([]byte("de\xff"))
+	assert.Equal(t, "Invalid UTF-8 at byte 5", c.err())
+
+	// Content ending within a rune is invalid.
+	c = newEncodingCheck(header, "text/html", nil)
+	c.Write([]byte("abc\xe4\xb8"))
+	assert.Equal(t, "Invalid UTF-8 at byte 3", c.err())
+
+	// Content without a declared charset is only validated if JSON.
+	c = newEncodingCheck(http.Header{}, "text/html", nil)
+	c.Write([]byte("\xff"))
+	assert.Empty(t, c.err(), "Expect undeclared charset not validated")
+
+	c = newEncodingCheck(http.Header{}, "application/json", nil)
+	c.Write([]byte("\xff"))
+	assert.NotEmpty(t, c.err(), "Expect JSON validated")
+}
+
+func TestEncodingCheckUnsupported(t *testing.T) {
+	c := newEncodingCheck(http.Header{}, "text/html", []byte{0xFF, 0xFE, '<', 0})
+	assert.Equal(t, "Unsupported charset utf-16le", c.err())
+
+	c = newEncodingCheck(http.Header{}, "text/html", []byte{0xFF, 0xFE, 0, 0})
+	assert.Equal(t, "Unsupported charset utf-32le", c.err())
+
+	header := http.Header{"Content-Type": []string{"text/xml; charset=UTF-16"}}
+	c = newEncodingCheck(header, "text/xml", []byte("<"))
+	assert.Equal(t, "Unsupported charset utf-16", c.err())
+}
+
+func TestHeadBuffer(t *testing.T) {
+	h := &headBuffer{max: 5}
+	n, err := h.Write([]byte("abc"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	n, err = h.Write([]byte("defgh"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, n, "Expect full write reported")
+	assert.Equal(t, "abcde", string(h.b))
+}
+
+func TestScrapeResponseParseError(t *testing.T) {
+	cases := []struct {
+		mime, content, expect string
+	}{
+		{"application/json", `{"next": "http://example.com/page/2"`, "Invalid JSON"},
+		{"text/xml", `<?xml version="1.0"?><urlset><url><loc>http://example.com/a</loc>`, "Malformed XML"},
+		{"text/html", "just some words, no markup", "No HTML elements found"},
+		{"text/html; charset=utf-8", "<html><p>caf\xe9</p></html>", "Invalid UTF-8 at byte 12"},
+	}
+	for _, c := range cases {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{c.mime}},
+			Body:       ioutil.NopCloser(strings.NewReader(c.content)),
+		}
+		page, err := scrapeResponse(resp, "http://example.com/", scrapeOptions{})
+		require.NoError(t, err, "Expect response scraped, %s", c.mime)
+		assert.True(t, strings.HasPrefix(page.ParseError, c.expect), "Expect %q parse error, got %q", c.expect, page.ParseError)
+		raw := page.Body
+		if raw == nil {
+			raw = page.rawHead
+		}
+		assert.Equal(t, c.content, string(raw), "Expect raw content kept")
+	}
+
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`<html><a href="/a">a</a></html>`)),
+	}
+	page, err := scrapeResponse(resp, "http://example.com/", scrapeOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, page.ParseError, "Expect no parse error")
+	assert.Nil(t, page.rawHead, "Expect raw content not kept")
+}
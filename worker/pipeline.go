@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Number of goroutines running each stage of the crawl pipeline, and the
+// number of crawls queued between each stage. Stages not set use their
+// default concurrency.
+type PipelineConfig struct {
+	// Goroutines requesting URLs. Each waits for the work delay after each
+	// request. Defaults to 1, so hosts are requested no more often than
+	// without the pipeline.
+	Fetchers int `json:"fetchers"`
+
+	// Goroutines scraping the fetched responses as they are read. Defaults
+	// to the number of CPUs.
+	Parsers int `json:"parsers"`
+
+	// Goroutines classifying scraped pages. Defaults to 1.
+	Classifiers int `json:"classifiers"`
+
+	// Goroutines finding the descendant URLs of scraped pages. Defaults to 1.
+	Extractors int `json:"extractors"`
+
+	// Goroutines storing crawled pages and their descendants. Defaults to 1.
+	Persisters int `json:"persisters"`
+
+	// Crawls queued between each stage, before the previous stage blocks.
+	// Defaults to 4.
+	QueueSize int `json:"queueSize"`
+}
+
+// Crawls queued between pipeline stages if not configured.
+const defaultPipelineQueueSize = 4
+
+// Sets the default concurrency of the stages not configured. Returns an
+// error if any are negative.
+func (p *PipelineConfig) setDefaults() error {
+	for _, v := range []struct {
+		name string
+		n    *int
+		def  int
+	}{
+		{"fetchers", &p.Fetchers, 1},
+		{"parsers", &p.Parsers, runtime.NumCPU()},
+		{"classifiers", &p.Classifiers, 1},
+		{"extractors", &p.Extractors, 1},
+		{"persisters", &p.Persisters, 1},
+		{"queueSize", &p.QueueSize, defaultPipelineQueueSize},
+	} {
+		if *v.n == 0 {
+			*v.n = v.def
+		} else if *v.n < 0 {
+			return fmt.Errorf("Invalid pipeline %s %d, must be positive", v.name, *v.n)
+		}
+	}
+	return nil
+}
+
+// Crawls the items received from the work channel through a pipeline of the
+// crawl's stages: fetch, parse, classify, extract, and persist. Each stage runs with its
+// configured concurrency, and is connected to the next by a bounded channel,
+// so a slow stage blocks the stages before it instead of buffering crawls.
+// Fetched responses are handed to the parse stage unread, and streamed from
+// the connection as they are scraped. The fetchDelay is waited after each
+// request by each fetcher. Blocks until the work channel is closed, and all
+// received items are crawled.
+func (c *Crawler) Run(work <-chan *common.URLQueueItem, cfg PipelineConfig, fetchDelay time.Duration) {
+	tasks := make(chan *crawlTask)
+	go func() {
+		for item := range work {
+			tasks <- newCrawlTask(item)
+		}
+		close(tasks)
+	}()
+
+	// Panics of each stage are recovered from, so a URL which panics its
+	// crawl doesn't crash the worker.
+	stages := c.stages()
+	fetch := func(t *crawlTask) bool {
+		ok := stages[0](t)
+		<-time.After(fetchDelay)
+		return ok
+	}
+
+	fetched := make(chan *crawlTask, cfg.QueueSize)
+	parsed := make(chan *crawlTask, cfg.QueueSize)
+	classified := make(chan *crawlTask, cfg.QueueSize)
+	extracted := make(chan *crawlTask, cfg.QueueSize)
+
+	runStage(cfg.Fetchers, tasks, fetched, fetch, c.finishRecovered)
+	runStage(cfg.Parsers, fetched, parsed, stages[1], c.finishRecovered)
+	runStage(cfg.Classifiers, parsed, classified, stages[2], c.finishRecovered)
+	runStage(cfg.Extractors, classified, extracted, stages[3], c.finishRecovered)
+	<-runStage(cfg.Persisters, extracted, nil, stages[4], c.finishRecovered)
+}
+
+// Runs the stage with the number of goroutines, for each task received from
+// the in channel. Tasks which complete the stage are sent to the out channel,
+// and tasks which don't are passed to done. If out is nil all tasks are passed
+// to done. The out channel is closed once the in channel is closed, and all
+// of its tasks have run. The returned channel is closed at the same time.
+func runStage(workers int, in <-chan *crawlTask, out chan<- *crawlTask, stage crawlStage, done func(*crawlTask)) <-chan struct{} {
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for t := range in {
+				if stage(t) && out != nil {
+					out <- t
+				} else {
+					done(t)
+				}
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		if out != nil {
+			close(out)
+		}
+		close(finished)
+	}()
+	return finished
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestRunStage(t *testing.T) {
+	in := make(chan *crawlTask)
+	out := make(chan *crawlTask, 1)
+
+	var mu sync.Mutex
+	done := []common.URLId{}
+	finished := runStage(3, in, out, func(t *crawlTask) bool {
+		return t.item.URLId%2 == 0
+	}, func(t *crawlTask) {
+		mu.Lock()
+		defer mu.Unlock()
+		done = append(done, t.item.URLId)
+	})
+
+	go func() {
+		for i := 1; i <= 10; i++ {
+			in <- newCrawlTask(&common.URLQueueItem{URLId: common.URLId(i)})
+		}
+		close(in)
+	}()
+
+	passed := []common.URLId{}
+	for t := range out {
+		passed = append(passed, t.item.URLId)
+	}
+	<-finished
+
+	sort.Slice(passed, func(i, j int) bool { return passed[i] < passed[j] })
+	sort.Slice(done, func(i, j int) bool { return done[i] < done[j] })
+	assert.Equal(t, []common.URLId{2, 4, 6, 8, 10}, passed, "Expect completed tasks sent to next stage")
+	assert.Equal(t, []common.URLId{1, 3, 5, 7, 9}, done, "Expect incomplete tasks done")
+}
+
+func TestRunStageLast(t *testing.T) {
+	in := make(chan *crawlTask, 2)
+	in <- newCrawlTask(&common.URLQueueItem{URLId: 1})
+	in <- newCrawlTask(&common.URLQueueItem{URLId: 2})
+	close(in)
+
+	var mu sync.Mutex
+	done := []common.URLId{}
+	<-runStage(1, in, nil, func(t *crawlTask) bool {
+		return t.item.URLId == 1
+	}, func(t *crawlTask) {
+		mu.Lock()
+		defer mu.Unlock()
+		done = append(done, t.item.URLId)
+	})
+
+	assert.Equal(t, []common.URLId{1, 2}, done, "Expect all tasks of last stage done")
+}
+
+func TestPipelineConfigDefaults(t *testing.T) {
+	cfg := PipelineConfig{Parsers: 2}
+	require.NoError(t, cfg.setDefaults(), "Expect valid config")
+	assert.Equal(t, PipelineConfig{Fetchers: 1, Parsers: 2, Classifiers: 1, Extractors: 1, Persisters: 1, QueueSize: defaultPipelineQueueSize}, cfg, "Expect defaults of stages not set")
+
+	cfg = PipelineConfig{Persisters: -1}
+	assert.Error(t, cfg.setDefaults(), "Expect negative concurrency invalid")
+}
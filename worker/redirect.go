@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jasdel/harvester/internal/common"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Regex for trivial JavaScript redirects, assigning a string literal to the
+	// location, or passing one to location.replace or location.assign.
+	jsRedirectRegexp = `(?:\b(?:window|document|self|top)\.)?\blocation(?:\.href)?\s*=\s*["']([^"']+)["']|\blocation\.(?:replace|assign)\(\s*["']([^"']+)["']\s*\)`
+)
+
+// Kinds of redirects found in the content of a page
+const (
+	redirectMetaRefresh = "meta-refresh"
+	redirectJavaScript  = "javascript"
+)
+
+var jsRedirectRegexpComp *regexp.Regexp
+
+func init() {
+	jsRedirectRegexpComp = regexp.MustCompile(jsRedirectRegexp)
+}
+
+// Redirect found in the content of a page, which a browser would follow after
+// rendering the page.
+type Redirect struct {
+	// URL the page redirects to
+	URL string
+
+	// How the page redirects, redirectMetaRefresh or redirectJavaScript
+	Kind string
+}
+
+// Searches the HTML document for meta refresh, and trivial JavaScript redirects.
+// Only redirects which can be found without rendering the page are detected,
+// e.g: location.href = "/new", but not a location built from variables. The
+// returned URLs are not normalized.
+func findHTMLRedirects(doc []byte) []Redirect {
+	scan, _ := scanHTML(bytes.NewReader(doc), 0)
+	return scan.redirects
+}
+
+// Returns the redirect of the meta tag's attributes, and false if the tag is
+// not a meta refresh to another URL. Attribute values are expected unescaped.
+func metaRefreshRedirect(attrs map[string]string) (Redirect, bool) {
+	if !strings.EqualFold(attrs["http-equiv"], "refresh") {
+		return Redirect{}, false
+	}
+	u := metaRefreshURL(attrs["content"])
+	return Redirect{URL: u, Kind: redirectMetaRefresh}, u != ""
+}
+
+// Returns the trivial JavaScript redirects found in the script's text.
+func scriptRedirects(script []byte) []Redirect {
+	redirects := []Redirect{}
+	for _, u := range findURLs(script, jsRedirectRegexpComp) {
+		redirects = append(redirects, Redirect{URL: u, Kind: redirectJavaScript})
+	}
+	return redirects
+}
+
+// Returns the URL of a meta refresh's content, e.g: "0; url=http://example.com".
+// An empty string is returned if the refresh only reloads the page.
+func metaRefreshURL(content string) string {
+	// Skip the delay, and the separator following it.
+	i := strings.IndexAny(content, ";,")
+	if i < 0 {
+		return ""
+	}
+	u := strings.TrimSpace(content[i+1:])
+
+	if len(u) >= 3 && strings.EqualFold(u[:3], "url") {
+		if rest := strings.TrimSpace(u[3:]); strings.HasPrefix(rest, "=") {
+			u = strings.TrimSpace(rest[1:])
+		}
+	}
+	return strings.Trim(u, `"'`)
+}
+
+// Normalizes the redirects relative to the page's URL, dropping invalid, non
+// http(s), and duplicate URLs, and redirects to the page itself.
+func normalizeRedirects(page *url.URL, redirects []Redirect) []Redirect {
+	normalized := []Redirect{}
+	seen := map[string]struct{}{page.String(): struct{}{}}
+	for _, r := range redirects {
+		u, err := normalizeURL(page, r.URL)
+		if err != nil || !(strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://")) {
+			continue
+		}
+		if _, ok := seen[u]; ok {
+			continue
+		}
+		seen[u] = struct{}{}
+		normalized = append(normalized, Redirect{URL: u, Kind: r.Kind})
+	}
+	return normalized
+}
+
+// Returns true if the redirect policy allows the redirect from the page's URL
+// to be followed.
+func followRedirect(policy, from, to string) bool {
+	switch policy {
+	case redirectPolicyAll:
+		return true
+	case redirectPolicySameHost:
+		return common.URLHost(from) == common.URLHost(to)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"testing"
+)
+
+func TestFindHTMLRedirects(t *testing.T) {
+	redirects := findHTMLRedirects([]byte(`<html><head>
+<meta http-equiv="Refresh" content="0; URL='/moved'">
+<meta http-equiv="refresh" content="30">
+<meta name="description" content="0; url=/not-a-redirect">
+<script>
+if (location.hash == "#old") { window.location.href = "https://example.com/new"; }
+location.replace('/replaced');
+var next = "/variable"; location.href = next;
+</script>
+</head><body>location.href = "/not-script"</body></html>`))
+
+	assert.Equal(t, []Redirect{
+		{URL: "/moved", Kind: redirectMetaRefresh},
+		{URL: "https://example.com/new", Kind: redirectJavaScript},
+		{URL: "/replaced", Kind: redirectJavaScript},
+	}, redirects, "Expect meta refresh and trivial JavaScript redirects")
+}
+
+func TestMetaRefreshURL(t *testing.T) {
+	assert.Equal(t, "http://example.com/", metaRefreshURL("0; url=http://example.com/"), "Expect URL")
+	assert.Equal(t, "/a", metaRefreshURL(`5;URL="/a"`), "Expect quoted URL")
+	assert.Equal(t, "/b", metaRefreshURL("0, /b"), "Expect URL without url=")
+	assert.Equal(t, "", metaRefreshURL("10"), "Expect no URL for reload")
+}
+
+func TestNormalizeRedirects(t *testing.T) {
+	page, _ := url.Parse("http://example.com/dir/page")
+	redirects := normalizeRedirects(page, []Redirect{
+		{URL: "/dir/next", Kind: redirectMetaRefresh},
+		{URL: "//example.com/dir/next", Kind: redirectJavaScript},
+		{URL: "http://example.com/dir/page", Kind: redirectJavaScript},
+		{URL: "javascript:void(0)", Kind: redirectJavaScript},
+	})
+	assert.Equal(t, []Redirect{{URL: "http://example.com/dir/next", Kind: redirectMetaRefresh}}, redirects, "Expect normalized, de-duped redirects")
+}
+
+func TestFollowRedirect(t *testing.T) {
+	from := "http://example.com/a"
+	assert.True(t, followRedirect(redirectPolicyAll, from, "http://other.com/"), "Expect all followed")
+	assert.True(t, followRedirect(redirectPolicySameHost, from, "https://example.com/b"), "Expect same host followed")
+	assert.False(t, followRedirect(redirectPolicySameHost, from, "http://other.com/"), "Expect other host not followed")
+	assert.False(t, followRedirect(redirectPolicyNone, from, "http://example.com/b"), "Expect none followed")
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schemes of the URLs of files on remote file servers
+const (
+	remoteSchemeFTP  = "ftp"
+	remoteSchemeSFTP = "sftp"
+)
+
+// Timeout of connecting, and logging in to a remote file server if not
+// configured.
+const defaultRemoteFilesTimeout = 30 * time.Second
+
+// Connections to the FTP and SFTP servers of ftp:// and sftp:// URLs. The
+// user and password of a URL's user info are logged in with, anonymous FTP
+// if not set.
+type RemoteFilesConfig struct {
+	// Timeout of connecting, and logging in to a server. Defaults to 30s.
+	// time.Duration string formated value, e.g: 1m
+	TimeoutStr string `json:"timeout"`
+
+	// The TimeoutStr will be parsed, and its value placed into this field.
+	Timeout time.Duration `json:"-"`
+
+	// Private key file SFTP servers are authenticated with, in addition to
+	// the password of the URL if set.
+	SFTPKeyFile string `json:"sftpKeyFile"`
+
+	// known_hosts file the host keys of SFTP servers are verified against.
+	// SFTP URLs fail to be fetched if not set, unless the host keys are
+	// configured to be ignored.
+	SFTPKnownHosts string `json:"sftpKnownHosts"`
+
+	// If the host keys of SFTP servers are not verified. Only intended for
+	// servers on trusted networks.
+	SFTPInsecureIgnoreHostKey bool `json:"sftpInsecureIgnoreHostKey"`
+}
+
+// Sets the default timeout if not configured, and validates the configuration.
+func (c *RemoteFilesConfig) setDefaults() error {
+	c.Timeout = defaultRemoteFilesTimeout
+	if c.TimeoutStr != "" {
+		timeout, err := time.ParseDuration(c.TimeoutStr)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("Invalid remoteFiles timeout %q, must be a positive duration", c.TimeoutStr)
+		}
+		c.Timeout = timeout
+	}
+	return nil
+}
+
+// Connection to a remote file server, logged in as the user of the URL it
+// was dialed for.
+type remoteFS interface {
+	// Returns the information of the file or directory at the path. The
+	// error satisfies os.IsNotExist if the path does not exist, and
+	// os.IsPermission if the user is not allowed to access it.
+	Stat(p string) (os.FileInfo, error)
+
+	// Returns the entries of the directory at the path.
+	ReadDir(p string) ([]os.FileInfo, error)
+
+	// Opens the file at the path to be read. The connection must not be
+	// used until the file is closed.
+	Open(p string) (io.ReadCloser, error)
+
+	// Closes the connection.
+	Close() error
+}
+
+// Connects, and logs in to the remote file server of the URL.
+type remoteFSDialer func(ctx context.Context, u *url.URL) (remoteFS, error)
+
+// Fetcher of the files on remote file servers, e.g: legacy data sources only
+// available over FTP or SFTP. Directories are fetched as HTML listings of
+// links to their entries, so they are crawled as pages, and files as their
+// content. URLs of other schemes are fetched by the fetcher it wraps.
+type remoteFileFetcher struct {
+	next    Fetcher
+	dialers map[string]remoteFSDialer
+}
+
+// Creates a fetcher of ftp:// and sftp:// URLs, connecting to their servers
+// with the dial function, and fetching other URLs with the next fetcher.
+func newRemoteFileFetcher(next Fetcher, cfg RemoteFilesConfig, dial dialContextFn) (*remoteFileFetcher, error) {
+	sftpDialer, err := newSFTPDialer(cfg, dial)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteFileFetcher{
+		next: next,
+		dialers: map[string]remoteFSDialer{
+			remoteSchemeFTP:  newFTPDialer(cfg, dial),
+			remoteSchemeSFTP: sftpDialer,
+		},
+	}, nil
+}
+
+// Round tripper requesting ftp:// and sftp:// URLs with the remote file
+// fetcher, and other URLs with the next round tripper, or the default
+// transport if nil.
+type remoteFileTransport struct {
+	remote *remoteFileFetcher
+	next   http.RoundTripper
+}
+
+func (t remoteFileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, ok := t.remote.dialers[req.URL.Scheme]; ok {
+		return fetcherTransport{fetcher: t.remote}.RoundTrip(req)
+	}
+	if t.next == nil {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// Returns if the URL is of a file on a remote file server, instead of a web
+// server.
+func isRemoteFileURL(u string) bool {
+	return strings.HasPrefix(u, remoteSchemeFTP+"://") || strings.HasPrefix(u, remoteSchemeSFTP+"://")
+}
+
+func (f *remoteFileFetcher) Fetch(ctx context.Context, rawURL string) (*http.Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	dial, ok := f.dialers[u.Scheme]
+	if !ok {
+		return f.next.Fetch(ctx, rawURL)
+	}
+
+	fs, err := dial(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	info, err := fs.Stat(p)
+	if err != nil {
+		fs.Close()
+		return remoteErrorResponse(err)
+	}
+
+	if info.IsDir() {
+		entries, err := fs.ReadDir(p)
+		fs.Close()
+		if err != nil {
+			return remoteErrorResponse(err)
+		}
+		body := remoteDirListing(p, entries)
+		header := http.Header{"Content-Type": {"text/html; charset=utf-8"}}
+		return remoteResponse(http.StatusOK, header, ioutil.NopCloser(bytes.NewReader(body)), int64(len(body))), nil
+	}
+
+	file, err := fs.Open(p)
+	if err != nil {
+		fs.Close()
+		return remoteErrorResponse(err)
+	}
+	header := http.Header{"Content-Type": {remoteFileMime(p)}}
+	if !info.ModTime().IsZero() {
+		header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	return remoteResponse(http.StatusOK, header, &remoteFileBody{ReadCloser: file, fs: fs}, info.Size()), nil
+}
+
+// Body of a remote file's response, closing the connection to the server the
+// file was opened on once closed.
+type remoteFileBody struct {
+	io.ReadCloser
+	fs remoteFS
+}
+
+func (b *remoteFileBody) Close() error {
+	err := b.ReadCloser.Close()
+	if fsErr := b.fs.Close(); err == nil {
+		err = fsErr
+	}
+	return err
+}
+
+// Returns the response of the remote file server's error. Paths which don't
+// exist are not found, and paths the user can't access are forbidden. Other
+// errors are returned as failed fetches.
+func remoteErrorResponse(err error) (*http.Response, error) {
+	var status int
+	switch {
+	case os.IsNotExist(err):
+		status = http.StatusNotFound
+	case os.IsPermission(err):
+		status = http.StatusForbidden
+	default:
+		return nil, err
+	}
+	return remoteResponse(status, http.Header{}, ioutil.NopCloser(bytes.NewReader(nil)), 0), nil
+}
+
+// Returns a response of a remote file server's file or directory, in the
+// form of a HTTP response.
+func remoteResponse(status int, header http.Header, body io.ReadCloser, length int64) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          body,
+		ContentLength: length,
+	}
+}
+
+// Returns the mime type of the remote file by its extension, or
+// application/octet-stream if unknown.
+func remoteFileMime(p string) string {
+	if t := mime.TypeByExtension(path.Ext(p)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Returns the HTML listing of the directory's entries, ordered by name. Each
+// entry is linked by its absolute path, with a trailing slash if it is a
+// directory.
+func remoteDirListing(dir string, entries []os.FileInfo) []byte {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	buf := &bytes.Buffer{}
+	title := html.EscapeString("Index of " + dir)
+	fmt.Fprintf(buf, "<!DOCTYPE html>\n<html><head><title>%s</title></head>\n<body><h1>%s</h1>\n<ul>\n", title, title)
+	for _, e := range entries {
+		name := e.Name()
+		if name == "." || name == ".." || name == "" {
+			continue
+		}
+		p := path.Join("/", dir, name)
+		if e.IsDir() {
+			name, p = name+"/", p+"/"
+		}
+		href := (&url.URL{Path: p}).EscapedPath()
+		fmt.Fprintf(buf, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(href), html.EscapeString(name))
+	}
+	fmt.Fprint(buf, "</ul>\n</body></html>\n")
+	return buf.Bytes()
+}
+
+// Information of a remote file server's file or directory.
+type remoteFileInfo struct {
+	name    string
+	size    int64
+	dir     bool
+	modTime time.Time
+}
+
+func (i remoteFileInfo) Name() string       { return i.name }
+func (i remoteFileInfo) Size() int64        { return i.size }
+func (i remoteFileInfo) ModTime() time.Time { return i.modTime }
+func (i remoteFileInfo) IsDir() bool        { return i.dir }
+func (i remoteFileInfo) Sys() interface{}   { return nil }
+
+func (i remoteFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
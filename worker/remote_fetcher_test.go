@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+// Remote file server of files and directories held in memory.
+type memRemoteFS struct {
+	files  map[string]string
+	dirs   map[string][]os.FileInfo
+	denied map[string]bool
+	closed int
+}
+
+func (f *memRemoteFS) Stat(p string) (os.FileInfo, error) {
+	if f.denied[p] {
+		return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrPermission}
+	}
+	if _, ok := f.dirs[p]; ok {
+		return remoteFileInfo{name: path.Base(p), dir: true}, nil
+	}
+	if content, ok := f.files[p]; ok {
+		return remoteFileInfo{name: path.Base(p), size: int64(len(content)), modTime: time.Date(2017, 1, 2, 3, 4, 5, 0, time.UTC)}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: p, Err: os.ErrNotExist}
+}
+
+func (f *memRemoteFS) ReadDir(p string) ([]os.FileInfo, error) {
+	return f.dirs[p], nil
+}
+
+func (f *memRemoteFS) Open(p string) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bytes.NewReader([]byte(f.files[p]))), nil
+}
+
+func (f *memRemoteFS) Close() error {
+	f.closed++
+	return nil
+}
+
+func TestRemoteFileFetcher(t *testing.T) {
+	fs := &memRemoteFS{
+		files: map[string]string{"/pub/data.csv": "a,b\n1,2\n"},
+		dirs: map[string][]os.FileInfo{
+			"/pub": {
+				remoteFileInfo{name: "data.csv", size: 8},
+				remoteFileInfo{name: "a <b>", dir: true},
+				remoteFileInfo{name: ".."},
+			},
+		},
+		denied: map[string]bool{"/private": true},
+	}
+	dialed := []string{}
+	next := FetcherFunc(func(ctx context.Context, u string) (*http.Response, error) {
+		return nil, fmt.Errorf("fetched %s", u)
+	})
+	f := &remoteFileFetcher{next: next, dialers: map[string]remoteFSDialer{
+		remoteSchemeFTP: func(ctx context.Context, u *url.URL) (remoteFS, error) {
+			dialed = append(dialed, u.Host)
+			return fs, nil
+		},
+	}}
+
+	resp, err := f.Fetch(context.Background(), "ftp://ftp.example.com/pub")
+	require.NoError(t, err, "Expect directory fetched")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	assert.Contains(t, string(body), `<li><a href="/pub/a%20%3Cb%3E/">a &lt;b&gt;/</a></li>`+"\n"+`<li><a href="/pub/data.csv">data.csv</a></li>`, "Expect entries linked by name")
+	assert.NotContains(t, string(body), `..`, "Expect parent not linked")
+	assert.Equal(t, 1, fs.closed, "Expect connection closed once listed")
+
+	resp, err = f.Fetch(context.Background(), "ftp://ftp.example.com/pub/data.csv")
+	require.NoError(t, err, "Expect file fetched")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "Mon, 02 Jan 2017 03:04:05 GMT", resp.Header.Get("Last-Modified"))
+	assert.Equal(t, int64(8), resp.ContentLength)
+	body, _ = ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "a,b\n1,2\n", string(body))
+	assert.Equal(t, 1, fs.closed, "Expect connection open while file read")
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, 2, fs.closed, "Expect connection closed with file")
+
+	resp, err = f.Fetch(context.Background(), "ftp://ftp.example.com/missing")
+	require.NoError(t, err, "Expect missing file response")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = f.Fetch(context.Background(), "ftp://ftp.example.com/private")
+	require.NoError(t, err, "Expect denied file response")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Equal(t, 4, fs.closed, "Expect connections closed")
+
+	_, err = f.Fetch(context.Background(), "http://www.example.com")
+	assert.EqualError(t, err, "fetched http://www.example.com", "Expect other schemes fetched by next fetcher")
+	assert.Equal(t, []string{"ftp.example.com", "ftp.example.com", "ftp.example.com", "ftp.example.com"}, dialed)
+}
+
+func TestIsRemoteFileURL(t *testing.T) {
+	assert.True(t, isRemoteFileURL("ftp://ftp.example.com/pub/"))
+	assert.True(t, isRemoteFileURL("sftp://user@example.com/data"))
+	assert.False(t, isRemoteFileURL("http://example.com/ftp://"))
+}
+
+func TestFTPError(t *testing.T) {
+	assert.True(t, os.IsNotExist(ftpError("stat", "/a", &textproto.Error{Code: 550, Msg: "No such file"})))
+	assert.True(t, os.IsPermission(ftpError("stat", "/a", &textproto.Error{Code: 530, Msg: "Not logged in"})))
+
+	err := &textproto.Error{Code: 421, Msg: "Service not available"}
+	assert.Equal(t, err, ftpError("stat", "/a", err), "Expect other errors unchanged")
+}
+
+func TestNewSFTPDialerRequiresHostKeys(t *testing.T) {
+	dial, err := newSFTPDialer(RemoteFilesConfig{}, (&net.Dialer{}).DialContext)
+	require.NoError(t, err, "Expect dialer")
+	u, _ := url.Parse("sftp://user@example.com/data")
+	_, err = dial(context.Background(), u)
+	assert.Error(t, err, "Expect unverifiable host keys rejected")
+
+	_, err = newSFTPDialer(RemoteFilesConfig{SFTPKnownHosts: "/does/not/exist"}, (&net.Dialer{}).DialContext)
+	assert.Error(t, err, "Expect missing known hosts file error")
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/robots"
+	"github.com/jasdel/harvester/internal/sitemap"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Duration a host's robots.txt is reused for before being requested again.
+const robotsCacheTTL = 24 * time.Hour
+
+// Most hosts the worker keeps per host state of, e.g: robots.txt files, or when
+// the host was last checked. Once exceeded the state of hosts no longer needed
+// is dropped, then of any host, down to half, so the state doesn't grow with
+// every host the worker crawls.
+const maxTrackedHosts = 10000
+
+// Enforces the robots.txt of the hosts crawled by the worker. Each host's
+// robots.txt is requested once, and reused for the robotsCacheTTL. Requests
+// to a host are delayed by the host's crawl delay for the user agent. The
+// delay is only enforced between the requests of this worker.
+type robotsPolicy struct {
+	client    *http.Client
+	userAgent string
+
+	mu    sync.Mutex
+	hosts map[string]*hostRobots
+}
+
+// Robots.txt of a host, and when the host was last requested.
+type hostRobots struct {
+	robots      *robots.Robots
+	fetchedOn   time.Time
+	lastRequest time.Time
+}
+
+// Creates a robots policy for the user agent, requesting robots.txt files with
+// the client.
+func newRobotsPolicy(client *http.Client, userAgent string) *robotsPolicy {
+	return &robotsPolicy{
+		client:    client,
+		userAgent: userAgent,
+		hosts:     map[string]*hostRobots{},
+	}
+}
+
+// Returns the robots.txt of the URL's host, requesting it if not already known,
+// or the known robots.txt has expired.
+func (p *robotsPolicy) hostRobots(u *url.URL) (*hostRobots, error) {
+	key := u.Scheme + "://" + u.Host
+
+	p.mu.Lock()
+	h, ok := p.hosts[key]
+	p.mu.Unlock()
+	if ok && time.Now().Sub(h.fetchedOn) < robotsCacheTTL {
+		return h, nil
+	}
+
+	r, err := robots.Fetch(p.client, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	// The robots.txt of a host is never modified once known, so it can be
+	// read without holding the lock. Only the last request time is updated.
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fetched := &hostRobots{robots: r, fetchedOn: time.Now()}
+	if h, ok := p.hosts[key]; ok {
+		fetched.lastRequest = h.lastRequest
+	}
+	p.hosts[key] = fetched
+	p.prune(fetched.fetchedOn)
+	return fetched, nil
+}
+
+// Drops the robots.txt of hosts once more than maxTrackedHosts are known. The
+// expired robots.txt files of hosts not waiting for their crawl delay are
+// dropped first, then of any host not waiting. Expects the lock to be held.
+func (p *robotsPolicy) prune(now time.Time) {
+	if len(p.hosts) <= maxTrackedHosts {
+		return
+	}
+	for key, h := range p.hosts {
+		if now.Sub(h.fetchedOn) >= robotsCacheTTL && h.lastRequest.Before(now) {
+			delete(p.hosts, key)
+		}
+	}
+	if len(p.hosts) <= maxTrackedHosts {
+		return
+	}
+	for key, h := range p.hosts {
+		if len(p.hosts) <= maxTrackedHosts/2 {
+			break
+		}
+		if h.lastRequest.Before(now) {
+			delete(p.hosts, key)
+		}
+	}
+}
+
+// Returns true if the URL is allowed to be crawled by the host's robots.txt.
+// If allowed, waits until the host's crawl delay has passed since the worker's
+// last request to the host.
+func (p *robotsPolicy) allow(rawURL string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+	h, err := p.hostRobots(u)
+	if err != nil {
+		return false, err
+	}
+	if !h.robots.Allowed(p.userAgent, rawURL) {
+		return false, nil
+	}
+
+	p.mu.Lock()
+	wait := time.Duration(0)
+	if delay, ok := h.robots.CrawlDelay(p.userAgent); ok {
+		wait = h.lastRequest.Add(delay).Sub(time.Now())
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	h.lastRequest = time.Now().Add(wait)
+	p.mu.Unlock()
+
+	time.Sleep(wait)
+	return true, nil
+}
+
+// Returns the URLs listed by the sitemaps of the URL's host robots.txt, which
+// are on the same host and allowed to be crawled. Sitemaps which fail to be
+// requested are logged and skipped.
+func (p *robotsPolicy) sitemapURLs(rawURL string) []string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	h, err := p.hostRobots(u)
+	if err != nil {
+		log.Println("robots: Failed to get robots.txt", u.Host, err)
+		return nil
+	}
+
+	urls := []string{}
+	for _, s := range h.robots.Sitemaps {
+		found, err := sitemap.Fetch(p.client, s)
+		if err != nil {
+			log.Println("robots: Failed to fetch sitemap", s, err)
+			continue
+		}
+		for _, f := range found {
+			fu, err := url.Parse(f.Loc)
+			if err != nil || fu.Host != u.Host || !h.robots.Allowed(p.userAgent, f.Loc) {
+				continue
+			}
+			urls = append(urls, f.Loc)
+		}
+	}
+	return urls
+}
+
+// Appends the URLs which are not already in the list.
+func appendNewURLs(urls []string, add []string) []string {
+	known := make(map[string]struct{}, len(urls))
+	for _, u := range urls {
+		known[u] = struct{}{}
+	}
+	for _, u := range add {
+		if _, ok := known[u]; !ok {
+			known[u] = struct{}{}
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRobotsPolicy(t *testing.T) {
+	robotsRequests := 0
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			robotsRequests++
+			fmt.Fprintf(w, "user-agent: harvester\ncrawl-delay: 0.05\ndisallow: /private\n\nsitemap: %s/sitemap.xml\n", ts.URL)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%[1]s/a</loc></url><url><loc>%[1]s/private/b</loc></url><url><loc>http://other.example.com/c</loc></url></urlset>`, ts.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	p := newRobotsPolicy(http.DefaultClient, "harvester")
+
+	allowed, err := p.allow(ts.URL + "/private/page")
+	require.NoError(t, err, "Expect robots.txt fetched")
+	assert.False(t, allowed, "Expect private page disallowed")
+
+	start := time.Now()
+	allowed, err = p.allow(ts.URL + "/public")
+	require.NoError(t, err, "Expect robots.txt reused")
+	assert.True(t, allowed, "Expect public page allowed")
+	allowed, _ = p.allow(ts.URL + "/public2")
+	assert.True(t, allowed, "Expect public page allowed")
+	assert.True(t, time.Now().Sub(start) >= 50*time.Millisecond, "Expect crawl delay between requests")
+	assert.Equal(t, 1, robotsRequests, "Expect robots.txt requested once")
+
+	urls := p.sitemapURLs(ts.URL + "/")
+	assert.Equal(t, []string{ts.URL + "/a"}, urls, "Expect only allowed sitemap URLs of the host")
+}
+
+func TestAppendNewURLs(t *testing.T) {
+	urls := appendNewURLs([]string{"http://a.com/", "http://a.com/x"}, []string{"http://a.com/x", "http://a.com/y", "http://a.com/y"})
+	assert.Equal(t, []string{"http://a.com/", "http://a.com/x", "http://a.com/y"}, urls, "Expect only new URLs appended")
+}
+
+func TestRobotsPolicyPrune(t *testing.T) {
+	p := newRobotsPolicy(http.DefaultClient, "harvester")
+	now := time.Now()
+	for i := 0; i <= maxTrackedHosts; i++ {
+		p.hosts[fmt.Sprintf("http://%d.example.com", i)] = &hostRobots{fetchedOn: now.Add(-robotsCacheTTL)}
+	}
+	p.hosts["http://delayed.example.com"] = &hostRobots{fetchedOn: now, lastRequest: now.Add(time.Minute)}
+
+	p.prune(now)
+	assert.Len(t, p.hosts, 1, "Expect expired hosts dropped")
+	assert.Contains(t, p.hosts, "http://delayed.example.com", "Expect host waiting for its crawl delay kept")
+}
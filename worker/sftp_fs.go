@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+)
+
+// Port of SFTP servers if the URL doesn't have one.
+const defaultSFTPPort = "22"
+
+// Connection to a SFTP server, over its SSH connection.
+type sftpFS struct {
+	*sftp.Client
+	conn *ssh.Client
+}
+
+// Creates a dialer of the SFTP servers of sftp:// URLs, connecting with the
+// dial function, and authenticating with the configured private key, and the
+// password of the URL. An error is returned if the key, or known hosts files
+// can't be read.
+func newSFTPDialer(cfg RemoteFilesConfig, dial dialContextFn) (remoteFSDialer, error) {
+	var signers []ssh.Signer
+	if cfg.SFTPKeyFile != "" {
+		key, err := ioutil.ReadFile(cfg.SFTPKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid sftpKeyFile %s, %v", cfg.SFTPKeyFile, err)
+		}
+		signers = append(signers, signer)
+	}
+
+	var hostKeys ssh.HostKeyCallback
+	switch {
+	case cfg.SFTPKnownHosts != "":
+		var err error
+		if hostKeys, err = knownhosts.New(cfg.SFTPKnownHosts); err != nil {
+			return nil, fmt.Errorf("Invalid sftpKnownHosts %s, %v", cfg.SFTPKnownHosts, err)
+		}
+	case cfg.SFTPInsecureIgnoreHostKey:
+		hostKeys = ssh.InsecureIgnoreHostKey()
+	}
+
+	return func(ctx context.Context, u *url.URL) (remoteFS, error) {
+		if hostKeys == nil {
+			return nil, fmt.Errorf("Unable to verify the host key of %s, sftpKnownHosts not configured", u.Host)
+		}
+		if u.User == nil || u.User.Username() == "" {
+			return nil, fmt.Errorf("SFTP URL %s has no user", u.Redacted())
+		}
+
+		auth := []ssh.AuthMethod{}
+		if len(signers) > 0 {
+			auth = append(auth, ssh.PublicKeys(signers...))
+		}
+		if pass, ok := u.User.Password(); ok {
+			auth = append(auth, ssh.Password(pass))
+		}
+		sshCfg := &ssh.ClientConfig{
+			User:            u.User.Username(),
+			Auth:            auth,
+			HostKeyCallback: hostKeys,
+			Timeout:         cfg.Timeout,
+		}
+
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), defaultSFTPPort)
+		}
+		dialCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		netConn, err := dial(dialCtx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		c, chans, reqs, err := ssh.NewClientConn(netConn, addr, sshCfg)
+		if err != nil {
+			netConn.Close()
+			return nil, err
+		}
+		conn := ssh.NewClient(c, chans, reqs)
+
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return sftpFS{Client: client, conn: conn}, nil
+	}, nil
+}
+
+func (f sftpFS) Open(p string) (io.ReadCloser, error) {
+	return f.Client.Open(p)
+}
+
+func (f sftpFS) Close() error {
+	err := f.Client.Close()
+	if connErr := f.conn.Close(); err == nil {
+		err = connErr
+	}
+	return err
+}
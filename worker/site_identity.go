@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Maximum size of a favicon which will be stored. Larger icons are not stored.
+const maxFaviconSize = 256 * 1024
+
+// Maximum size of a site's home page, or web app manifest, read when capturing
+// its identity.
+const maxIdentityDocSize = 1024 * 1024
+
+// Captures the favicon and name of the sites crawled by the worker. Each host's
+// identity is captured once per job which crawls the host. Identities are
+// captured in the background, so crawls don't wait on the requests, or the
+// host's crawl delay.
+type siteIdentityChecker struct {
+	client *http.Client
+	sc     *storage.Client
+
+	// Robots.txt policy the home page is requested with. Nil if robots.txt
+	// files are ignored.
+	robots *robotsPolicy
+
+	// Limits the identities captured at once to maxHostChecks
+	checks chan struct{}
+
+	mu sync.Mutex
+	// Job each host's identity was last captured for, keyed by scheme and host.
+	checked map[string]common.JobId
+}
+
+// Creates a site identity checker requesting sites with the client, and
+// storing their identity with the storage client.
+func newSiteIdentityChecker(client *http.Client, sc *storage.Client, robots *robotsPolicy) *siteIdentityChecker {
+	return &siteIdentityChecker{
+		client:  client,
+		sc:      sc,
+		robots:  robots,
+		checks:  make(chan struct{}, maxHostChecks),
+		checked: map[string]common.JobId{},
+	}
+}
+
+// Captures and stores the site identity of the URL's host in the background,
+// if not already captured for the job. A host's identity is only captured
+// once however many of its URLs are crawled meanwhile.
+func (s *siteIdentityChecker) check(jobId common.JobId, rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	key := u.Scheme + "://" + u.Host
+
+	s.mu.Lock()
+	if id, ok := s.checked[key]; ok && id == jobId {
+		s.mu.Unlock()
+		return
+	}
+	s.checked[key] = jobId
+	s.prune()
+	s.mu.Unlock()
+
+	go func() {
+		s.checks <- struct{}{}
+		defer func() { <-s.checks }()
+		s.capture(jobId, key, common.URLHost(rawURL))
+	}()
+}
+
+// Drops hosts once more than maxTrackedHosts are tracked. Hosts dropped are
+// checked again, and found already captured in storage. Expects the lock to be
+// held.
+func (s *siteIdentityChecker) prune() {
+	if len(s.checked) <= maxTrackedHosts {
+		return
+	}
+	for key := range s.checked {
+		if len(s.checked) <= maxTrackedHosts/2 {
+			break
+		}
+		delete(s.checked, key)
+	}
+}
+
+// Captures and stores the site identity of the host at the scheme and host
+// key for the job.
+func (s *siteIdentityChecker) capture(jobId common.JobId, key, host string) {
+	// Another worker may have already captured the identity for the job.
+	if captured, err := s.sc.HostClient().IdentityCapturedBy(host, jobId); err != nil {
+		log.Println("siteIdentity: failed to check identity of", host, err)
+		return
+	} else if captured {
+		return
+	}
+
+	home := key + "/"
+	if s.robots != nil {
+		if allowed, err := s.robots.allow(home); err != nil || !allowed {
+			return
+		}
+	}
+
+	identity, icon, err := fetchSiteIdentity(s.client, home)
+	if err != nil {
+		log.Println("siteIdentity: failed to capture identity of", home, err)
+		return
+	}
+	identity.Host = host
+	if err := s.sc.HostClient().StoreIdentity(jobId, identity, icon); err != nil {
+		log.Println("siteIdentity: failed to store identity of", host, err)
+	}
+}
+
+// Identity information found in a site's home page.
+type siteIdentityLinks struct {
+	// Value of the og:site_name meta tag
+	SiteName string
+
+	// URLs of the favicons linked by the page, in order of preference
+	Icons []string
+
+	// URL of the web app manifest linked by the page
+	Manifest string
+}
+
+// Web app manifest members used for a site's identity.
+type webManifest struct {
+	Name      string `json:"name"`
+	ShortName string `json:"short_name"`
+	Icons     []struct {
+		Src string `json:"src"`
+	} `json:"icons"`
+}
+
+// Requests the site's home page, and web app manifest, capturing the site's
+// name and favicon. The site name is taken from og:site_name, then the manifest.
+// The favicon is the first icon linked by the home page, then the manifest's,
+// then /favicon.ico. Returns the identity, and the favicon's content, nil if
+// the site has no favicon.
+func fetchSiteIdentity(client *http.Client, homeURL string) (*common.HostIdentity, []byte, error) {
+	home, err := url.Parse(homeURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	links := siteIdentityLinks{}
+	if body, typ, err := fetchIdentityDoc(client, homeURL, maxIdentityDocSize); err != nil {
+		return nil, nil, err
+	} else if typ == "text/html" {
+		links = findSiteIdentityLinks(body)
+	}
+
+	identity := &common.HostIdentity{SiteName: links.SiteName}
+	icons := links.Icons
+	if links.Manifest != "" {
+		if manifestURL, err := normalizeURL(home, links.Manifest); err == nil {
+			if manifest, err := fetchWebManifest(client, manifestURL); err != nil {
+				log.Println("siteIdentity: failed to request manifest", manifestURL, err)
+			} else {
+				if identity.SiteName == "" {
+					identity.SiteName = manifest.Name
+				}
+				if identity.SiteName == "" {
+					identity.SiteName = manifest.ShortName
+				}
+				// Manifest icons are relative to the manifest, not the page.
+				base, _ := url.Parse(manifestURL)
+				for _, i := range manifest.Icons {
+					if u, err := url.Parse(i.Src); err == nil {
+						icons = append(icons, base.ResolveReference(u).String())
+					}
+				}
+			}
+		}
+	}
+	icons = append(icons, "/favicon.ico")
+
+	var ok bool
+	for _, icon := range icons {
+		iconURL, err := normalizeURL(home, icon)
+		if err != nil {
+			continue
+		}
+		body, typ, err := fetchIdentityDoc(client, iconURL, maxFaviconSize)
+		if err != nil || body == nil {
+			continue
+		}
+		if typ, ok = faviconMime(iconURL, typ); !ok {
+			continue
+		}
+		identity.IconURL, identity.IconMime = iconURL, typ
+		return identity, body, nil
+	}
+
+	return identity, nil, nil
+}
+
+// Requests the document, returning its content and content type. Nil content
+// is returned if the response is not successful, or is larger than the max size.
+func fetchIdentityDoc(client *http.Client, docURL string, maxSize int64) ([]byte, string, error) {
+	resp, err := client.Get(docURL)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", nil
+	}
+	typ, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	var buf bytes.Buffer
+	if n, err := io.Copy(&buf, io.LimitReader(resp.Body, maxSize+1)); err != nil {
+		return nil, "", err
+	} else if n > maxSize {
+		return nil, typ, nil
+	}
+	return buf.Bytes(), typ, nil
+}
+
+// Requests and decodes the web app manifest.
+func fetchWebManifest(client *http.Client, manifestURL string) (*webManifest, error) {
+	body, _, err := fetchIdentityDoc(client, manifestURL, maxIdentityDocSize)
+	if err != nil || body == nil {
+		return nil, err
+	}
+	manifest := &webManifest{}
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Searches the HTML document for the site's name, favicons, and web app
+// manifest. The returned URLs are not normalized.
+func findSiteIdentityLinks(doc []byte) siteIdentityLinks {
+	links := siteIdentityLinks{Icons: []string{}}
+
+	for _, tag := range htmlMetaTagRegexpComp.FindAll(doc, -1) {
+		attrs := htmlTagAttrs(tag)
+		if strings.ToLower(attrs["property"]) == "og:site_name" && links.SiteName == "" {
+			links.SiteName = strings.TrimSpace(html.UnescapeString(attrs["content"]))
+		}
+	}
+
+	appleIcons := []string{}
+	for _, tag := range htmlLinkTagRegexpComp.FindAll(doc, -1) {
+		attrs := htmlTagAttrs(tag)
+		href := html.UnescapeString(attrs["href"])
+		if href == "" {
+			continue
+		}
+		for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+			switch rel {
+			case "icon":
+				links.Icons = append(links.Icons, href)
+			case "apple-touch-icon":
+				appleIcons = append(appleIcons, href)
+			case "manifest":
+				if links.Manifest == "" {
+					links.Manifest = href
+				}
+			}
+		}
+	}
+	// Touch icons are only used if the page has no favicon.
+	links.Icons = append(links.Icons, appleIcons...)
+
+	return links
+}
+
+// Returns the content type the favicon is stored as, and if the response is an
+// image. Many hosts serve .ico files without an image content type.
+func faviconMime(iconURL, typ string) (string, bool) {
+	if strings.HasPrefix(typ, "image/") {
+		return typ, true
+	}
+	if (typ == "" || typ == "application/octet-stream" || typ == "text/plain") && strings.HasSuffix(strings.ToLower(iconURL), ".ico") {
+		return "image/x-icon", true
+	}
+	return "", false
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFindSiteIdentityLinks(t *testing.T) {
+	links := findSiteIdentityLinks([]byte(`<html><head>
+<meta property="og:site_name" content="Example &amp; Co">
+<link rel="apple-touch-icon" href="/touch.png">
+<link rel="shortcut icon" href="/static/favicon.png">
+<link rel="manifest" href="/app.webmanifest">
+</head></html>`))
+
+	assert.Equal(t, "Example & Co", links.SiteName, "Expect OpenGraph site name")
+	assert.Equal(t, []string{"/static/favicon.png", "/touch.png"}, links.Icons, "Expect favicon before touch icon")
+	assert.Equal(t, "/app.webmanifest", links.Manifest, "Expect manifest")
+}
+
+func TestFetchSiteIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<link rel="manifest" href="/static/app.json">`))
+		case "/static/app.json":
+			w.Header().Set("Content-Type", "application/manifest+json")
+			w.Write([]byte(`{"name": "Example App", "short_name": "Example", "icons": [{"src": "missing.png"}, {"src": "icon.png"}]}`))
+		case "/static/icon.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	identity, icon, err := fetchSiteIdentity(http.DefaultClient, server.URL+"/")
+	require.NoError(t, err, "Expect identity captured")
+	assert.Equal(t, "Example App", identity.SiteName, "Expect manifest name")
+	assert.Equal(t, server.URL+"/static/icon.png", identity.IconURL, "Expect manifest icon relative to manifest")
+	assert.Equal(t, "image/png", identity.IconMime, "Expect icon mime")
+	assert.Equal(t, []byte("png"), icon, "Expect icon content")
+}
+
+func TestFetchSiteIdentityFaviconICO(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<meta property="og:site_name" content="Example">`))
+		case "/favicon.ico":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("ico"))
+		}
+	}))
+	defer server.Close()
+
+	identity, icon, err := fetchSiteIdentity(http.DefaultClient, server.URL+"/")
+	require.NoError(t, err, "Expect identity captured")
+	assert.Equal(t, "Example", identity.SiteName, "Expect OpenGraph site name")
+	assert.Equal(t, server.URL+"/favicon.ico", identity.IconURL, "Expect default favicon")
+	assert.Equal(t, "image/x-icon", identity.IconMime, "Expect ico mime")
+	assert.Equal(t, []byte("ico"), icon, "Expect icon content")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"expvar"
+	"fmt"
+	"github.com/jasdel/harvester/internal/metrics"
+	"io"
+	"math/rand"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Rate of crawls sampled if not configured.
+const defaultMetricsSampleRate = 0.1
+
+// Exposing the worker's metrics.
+type MetricsConfig struct {
+	// Address the metrics are served on, as JSON at /debug/vars, e.g: ":9100".
+	// Metrics are not collected if not set.
+	Addr string `json:"addr"`
+
+	// Rate, 0 to 1, of crawls whose stages are timed. Defaults to 0.1.
+	SampleRate float64 `json:"sampleRate"`
+}
+
+// Sets the default sample rate if not configured, and validates it.
+func (c *MetricsConfig) setDefaults() error {
+	if c.SampleRate == 0 {
+		c.SampleRate = defaultMetricsSampleRate
+	} else if c.SampleRate < 0 || c.SampleRate > 1 {
+		return fmt.Errorf("Invalid metrics sample rate %v, must be between 0 and 1", c.SampleRate)
+	}
+	return nil
+}
+
+// Histograms of the duration of each stage of the sampled crawls. Network
+// stages, DNS, connect, TLS, time to first byte, and download, are separated
+// from the worker's own processing, parse and persist, so slow crawls can be
+// attributed to one or the other. Stages which don't occur, e.g: DNS of a
+// reused connection, or any network stage of a response from the fetch
+// cache, are not observed.
+type stageMetrics struct {
+	sampleRate float64
+
+	dns, connect, tls, ttfb, download *metrics.Histogram
+	parse, persist                    *metrics.Histogram
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// Creates the stage metrics, sampling the rate, 0 to 1, of crawls.
+func newStageMetrics(sampleRate float64) *stageMetrics {
+	return &stageMetrics{
+		sampleRate: sampleRate,
+		dns:        metrics.NewHistogram(nil),
+		connect:    metrics.NewHistogram(nil),
+		tls:        metrics.NewHistogram(nil),
+		ttfb:       metrics.NewHistogram(nil),
+		download:   metrics.NewHistogram(nil),
+		parse:      metrics.NewHistogram(nil),
+		persist:    metrics.NewHistogram(nil),
+		rand:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Returns the histograms of each stage, keyed by the stage's name, to be
+// published with expvar.
+func (m *stageMetrics) vars() *expvar.Map {
+	v := new(expvar.Map).Init()
+	v.Set("dns", m.dns)
+	v.Set("connect", m.connect)
+	v.Set("tls", m.tls)
+	v.Set("ttfb", m.ttfb)
+	v.Set("download", m.download)
+	v.Set("parse", m.parse)
+	v.Set("persist", m.persist)
+	return v
+}
+
+// Returns the timing of a crawl if the crawl is sampled, nil otherwise.
+func (m *stageMetrics) sample() *stageTiming {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	sampled := m.rand.Float64() < m.sampleRate
+	m.mu.Unlock()
+
+	if !sampled {
+		return nil
+	}
+	return &stageTiming{}
+}
+
+// Observes the duration of each stage of the crawl's timing which occurred.
+func (m *stageMetrics) observe(t *stageTiming) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, s := range []struct {
+		h *metrics.Histogram
+		d time.Duration
+	}{
+		{m.dns, t.dns}, {m.connect, t.connect}, {m.tls, t.tls}, {m.ttfb, t.ttfb},
+		{m.download, t.download}, {m.parse, t.parse}, {m.persist, t.persist},
+	} {
+		if s.d > 0 {
+			s.h.Observe(s.d)
+		}
+	}
+}
+
+// Duration of each stage of a sampled crawl.
+type stageTiming struct {
+	mu sync.Mutex
+
+	// Start of the request, and of its network stages in progress.
+	requestStart, dnsStart, connectStart, tlsStart time.Time
+
+	dns, connect, tls, ttfb, download time.Duration
+	parse, persist                    time.Duration
+}
+
+// Returns the context tracing the network stages of the request made with it.
+// Requests made with the context start the timing's time to first byte.
+func (t *stageTiming) trace(ctx context.Context) context.Context {
+	t.requestStart = time.Now()
+
+	lock := func(fn func()) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		fn()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			lock(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			lock(func() { t.dns = time.Now().Sub(t.dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			lock(func() { t.connectStart = time.Now() })
+		},
+		ConnectDone: func(network, addr string, err error) {
+			lock(func() {
+				if err == nil {
+					t.connect = time.Now().Sub(t.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			lock(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			lock(func() { t.tls = time.Now().Sub(t.tlsStart) })
+		},
+		GotFirstResponseByte: func() {
+			lock(func() { t.ttfb = time.Now().Sub(t.requestStart) })
+		},
+	})
+}
+
+// Wraps the response body, so the time spent reading it is the timing's
+// download duration.
+func (t *stageTiming) timeBody(body io.ReadCloser) io.ReadCloser {
+	return &timedBody{ReadCloser: body, timing: t}
+}
+
+// Sets the parse duration, excluding the time the parse spent downloading
+// the response's body as it was streamed.
+func (t *stageTiming) parsed(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.parse = d - t.download
+}
+
+// Sets the persist duration.
+func (t *stageTiming) persisted(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.persist = d
+}
+
+// Response body adding the time spent reading it to its timing's download.
+type timedBody struct {
+	io.ReadCloser
+	timing *stageTiming
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := b.ReadCloser.Read(p)
+	d := time.Now().Sub(start)
+
+	b.timing.mu.Lock()
+	b.timing.download += d
+	b.timing.mu.Unlock()
+	return n, err
+}
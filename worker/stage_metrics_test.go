@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStageTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-time.After(5 * time.Millisecond)
+		w.Write([]byte("<html></html>"))
+	}))
+	defer server.Close()
+
+	m := newStageMetrics(1)
+	timing := m.sample()
+	require.NotNil(t, timing, "Expect crawl sampled")
+
+	fetcher := httpFetcher{client: &http.Client{Transport: &http.Transport{}}}
+	resp, err := fetcher.Fetch(timing.trace(context.Background()), server.URL)
+	require.NoError(t, err, "Expect fetch")
+	body := timing.timeBody(resp.Body)
+	_, err = ioutil.ReadAll(body)
+	require.NoError(t, err, "Expect body read")
+	body.Close()
+	timing.parsed(time.Hour)
+	timing.persisted(time.Millisecond)
+
+	assert.True(t, timing.connect > 0, "Expect connect timed")
+	assert.True(t, timing.ttfb >= 5*time.Millisecond, "Expect time to first byte timed")
+	assert.True(t, timing.download > 0, "Expect download timed")
+	assert.Equal(t, time.Hour-timing.download, timing.parse, "Expect download excluded from parse")
+	assert.Equal(t, time.Duration(0), timing.tls, "Expect no TLS of HTTP request")
+
+	m.observe(timing)
+	assert.Equal(t, int64(1), m.connect.Snapshot().Count, "Expect connect observed")
+	assert.Equal(t, int64(1), m.persist.Snapshot().Count, "Expect persist observed")
+	assert.Equal(t, int64(0), m.tls.Snapshot().Count, "Expect TLS not observed")
+}
+
+func TestStageMetricsSample(t *testing.T) {
+	assert.Nil(t, newStageMetrics(0).sample(), "Expect no crawls sampled")
+	assert.NotNil(t, newStageMetrics(1).sample(), "Expect all crawls sampled")
+
+	var m *stageMetrics
+	assert.Nil(t, m.sample(), "Expect crawls not sampled without metrics")
+}
+
+func TestMetricsConfigDefaults(t *testing.T) {
+	cfg := MetricsConfig{}
+	require.NoError(t, cfg.setDefaults(), "Expect valid config")
+	assert.Equal(t, defaultMetricsSampleRate, cfg.SampleRate, "Expect default sample rate")
+
+	cfg = MetricsConfig{SampleRate: 1.5}
+	assert.Error(t, cfg.setDefaults(), "Expect sample rate over 1 invalid")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delay before retrying a URL whose retry rule has no delay, and whose
+// response has no Retry-After header.
+const defaultStatusRetryDelay = 30 * time.Second
+
+// Returns the job's rules of how the responses of status codes are handled,
+// nil if the job has none, or they could not be read.
+func (c *Crawler) jobStatusRules(id common.JobId) []common.JobStatusRule {
+	rules, err := c.sc.JobClient().StatusRules(id)
+	if err != nil {
+		log.Println("crawl: failed to get job's status rules", id, err)
+		return nil
+	}
+	return rules
+}
+
+// Applies the job's rule of the fetched response's status, if it has one.
+// Returns false if the crawl should not continue, because the response failed,
+// or the URL will be retried. Responses of record rules continue, without
+// their links being followed. Retry rules which ran out of retries fail the
+// response.
+func (c *Crawler) applyStatusRule(t *crawlTask) bool {
+	item, urlRec, resp := t.item, t.urlRec, t.resp
+	rule, ok := common.MatchJobStatusRule(c.jobStatusRules(item.JobId), resp.StatusCode)
+	if !ok {
+		return true
+	}
+
+	switch rule.Action {
+	case common.StatusActionRecord:
+		t.recordOnly = true
+		return true
+	case common.StatusActionRetry:
+		if item.Attempt < rule.Retries {
+			t.retryDelay = statusRetryDelay(rule, resp.Header, time.Now())
+			c.logCrawl(item, urlRec.URL, t.requestedAt, &Page{Status: resp.StatusCode})
+			log.Println("crawl: Retrying", item.URLId, urlRec.URL, "status", resp.StatusCode, "in", t.retryDelay, "attempt", item.Attempt+1, "of", rule.Retries)
+			t.decision = traceStatusRetry
+			return false
+		}
+		log.Println("crawl: Out of retries", item.URLId, urlRec.URL, "status", resp.StatusCode)
+	case common.StatusActionFail:
+	default:
+		return true
+	}
+
+	c.logCrawl(item, urlRec.URL, t.requestedAt, &Page{Status: resp.StatusCode})
+	log.Println("crawl: Failing response", item.URLId, urlRec.URL, "status", resp.StatusCode, "rule", rule)
+	t.decision = traceStatusFailed
+	return false
+}
+
+// Queues the crawl's item to be crawled again after the crawl's retry delay.
+// The item's pending record is kept until the retry is crawled, so the job
+// isn't completed while it waits.
+func (c *Crawler) retry(t *crawlTask) {
+	retry := *t.item
+	retry.Attempt++
+	time.AfterFunc(t.retryDelay, func() {
+		c.urlQueuePub.Send(&retry)
+	})
+}
+
+// Returns the delay before retrying the URL of a response matching the retry
+// rule. The rule's delay is used if it has one, otherwise the response's
+// Retry-After header, in seconds or as a HTTP date. The delay is never longer
+// than common.MaxStatusRetryDelay.
+func statusRetryDelay(rule common.JobStatusRule, header http.Header, now time.Time) time.Duration {
+	if rule.RetryDelay > 0 {
+		return rule.RetryDelay
+	}
+
+	delay := defaultStatusRetryDelay
+	if v := strings.TrimSpace(header.Get("Retry-After")); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			delay = common.MaxStatusRetryDelay
+			if secs < int(common.MaxStatusRetryDelay/time.Second) {
+				delay = time.Duration(secs) * time.Second
+			}
+		} else if date, err := http.ParseTime(v); err == nil {
+			delay = date.Sub(now)
+			if delay < 0 {
+				delay = 0
+			}
+		}
+	}
+	if delay > common.MaxStatusRetryDelay {
+		delay = common.MaxStatusRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestStatusRetryDelay(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	rule := common.JobStatusRule{Status: "429", Action: common.StatusActionRetry, Retries: 3}
+
+	assert.Equal(t, defaultStatusRetryDelay, statusRetryDelay(rule, http.Header{}, now), "Expect default delay without Retry-After")
+	assert.Equal(t, 2*time.Minute, statusRetryDelay(rule, http.Header{"Retry-After": []string{"120"}}, now), "Expect Retry-After seconds")
+	assert.Equal(t, 90*time.Second, statusRetryDelay(rule, http.Header{"Retry-After": []string{now.Add(90 * time.Second).Format(http.TimeFormat)}}, now), "Expect Retry-After date")
+	assert.Equal(t, time.Duration(0), statusRetryDelay(rule, http.Header{"Retry-After": []string{now.Add(-time.Minute).Format(http.TimeFormat)}}, now), "Expect past Retry-After date retried now")
+	assert.Equal(t, common.MaxStatusRetryDelay, statusRetryDelay(rule, http.Header{"Retry-After": []string{"999999999999"}}, now), "Expect Retry-After capped")
+	assert.Equal(t, defaultStatusRetryDelay, statusRetryDelay(rule, http.Header{"Retry-After": []string{"soon"}}, now), "Expect default delay of invalid Retry-After")
+
+	rule.RetryDelay = time.Minute
+	assert.Equal(t, time.Minute, statusRetryDelay(rule, http.Header{"Retry-After": []string{"120"}}, now), "Expect rule's delay over Retry-After")
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Longest response body recorded in a crawl trace. Longer bodies are
+// truncated, and can't be replayed exactly.
+const maxTraceBody = 10 << 20
+
+// Decisions the crawl of a queue item ended with
+const (
+	traceNoURLRecord       = "no-url-record"
+	traceJobCancelled      = "job-cancelled"
+	traceURLBudgetSpent    = "url-budget-spent"
+	traceOptOutUnavailable = "opt-out-unavailable"
+	traceOptedOut          = "opted-out"
+	traceRobotsUnavailable = "robots-unavailable"
+	traceRobotsDisallowed  = "robots-disallowed"
+	traceLegallyRestricted = "legally-restricted"
+	traceFetchFailed       = "fetch-failed"
+	traceScrapeFailed      = "scrape-failed"
+	tracePersistFailed     = "persist-failed"
+	traceUnchanged         = "unchanged"
+	traceCrawled           = "crawled"
+	traceDownloaded        = "downloaded"
+	traceDownloadFailed    = "download-failed"
+	traceStatusFailed      = "status-failed"
+	traceStatusRetry       = "status-retry"
+	traceStatusRecorded    = "status-recorded"
+	tracePoisoned          = "poisoned"
+	tracePanicked          = "panicked"
+)
+
+// Record of a queue item crawled by the worker, and how its crawl ended.
+type traceEntry struct {
+	// Order the worker finished crawling the item in, within its job.
+	Seq int `json:"seq"`
+
+	// Queue item crawled, and the URL of its record.
+	Item common.URLQueueItem `json:"item"`
+	URL  string              `json:"url"`
+
+	// Decision the crawl ended with. See the trace* constants.
+	Decision string `json:"decision"`
+
+	StartedAt time.Time `json:"startedAt"`
+
+	// Response fetched for the URL, nil if the URL was not fetched.
+	Response *traceResponse `json:"response,omitempty"`
+
+	// URLs scraped from the response, and the descendants of the URL
+	// followed once extracted.
+	Scraped     []string `json:"scraped,omitempty"`
+	Descendants []string `json:"descendants,omitempty"`
+}
+
+// Response of a traced URL. Only the part of the body read by the scraper
+// is recorded.
+type traceResponse struct {
+	Status    int         `json:"status"`
+	Header    http.Header `json:"header"`
+	Body      []byte      `json:"body"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// Records the queue items crawled by the worker into a trace file of each
+// job in the trace directory. Each line of a trace file is a JSON traceEntry.
+// Workers sharing the directory append to the same trace files.
+type crawlTracer struct {
+	dir string
+
+	mu  sync.Mutex
+	seq map[common.JobId]int
+}
+
+// Creates a tracer recording the trace files of jobs in the directory.
+func newCrawlTracer(dir string) (*crawlTracer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &crawlTracer{dir: dir, seq: map[common.JobId]int{}}, nil
+}
+
+// Returns the trace file of the job in the directory.
+func traceFilename(dir string, jobId common.JobId) string {
+	return filepath.Join(dir, fmt.Sprintf("job-%d.trace", jobId))
+}
+
+// Wraps the body of the crawl's response, so the part of it read by the
+// scraper is recorded.
+func (r *crawlTracer) capture(t *crawlTask) {
+	t.traceResp = &traceResponse{Status: t.resp.StatusCode, Header: t.resp.Header}
+	t.resp.Body = &traceBody{ReadCloser: t.resp.Body, resp: t.traceResp}
+}
+
+// Appends the finished crawl to its job's trace file. Failures are logged,
+// and don't affect the crawl.
+func (r *crawlTracer) record(t *crawlTask) {
+	entry := traceEntry{
+		Item:        *t.item,
+		Decision:    t.decision,
+		StartedAt:   t.startedAt.UTC(),
+		Response:    t.traceResp,
+		Descendants: t.urls,
+	}
+	if t.urlRec != nil {
+		entry.URL = t.urlRec.URL
+	}
+	if t.page != nil {
+		entry.Scraped = t.page.URLs
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seq[t.item.JobId]++
+	entry.Seq = r.seq[t.item.JobId]
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		log.Println("trace: failed to encode entry", t.item.JobId, t.item.URLId, err)
+		return
+	}
+
+	f, err := os.OpenFile(traceFilename(r.dir, t.item.JobId), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("trace: failed to open trace of job", t.item.JobId, err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		log.Println("trace: failed to write entry", t.item.JobId, t.item.URLId, err)
+	}
+}
+
+// Response body recording the bytes read from it, up to the maximum traced.
+type traceBody struct {
+	io.ReadCloser
+	resp *traceResponse
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if room := maxTraceBody - len(b.resp.Body); room < n {
+			b.resp.Body = append(b.resp.Body, p[:room]...)
+			b.resp.Truncated = true
+		} else {
+			b.resp.Body = append(b.resp.Body, p[:n]...)
+		}
+	}
+	return n, err
+}
+
+// Reads the entries of a trace file, ordered by their sequence.
+func readTrace(in io.Reader) ([]traceEntry, error) {
+	entries := []traceEntry{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 4*maxTraceBody)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := traceEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("Invalid trace entry %d, %v", len(entries)+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries, nil
+}
+
+// Difference between a traced crawl, and its replay.
+type traceDivergence struct {
+	Seq    int
+	URL    string
+	Reason string
+}
+
+func (d traceDivergence) String() string {
+	return fmt.Sprintf("%d %s: %s", d.Seq, d.URL, d.Reason)
+}
+
+// Re-executes the fetch, and scrape of each traced crawl in order, with the
+// fetcher, e.g: a fixtureFetcher of the trace. Returns where the replay's
+// responses, or scraped URLs differ from the trace's. Crawls which ended
+// before their URL was fetched are not replayed.
+func replayTrace(entries []traceEntry, fetcher Fetcher) []traceDivergence {
+	diffs := []traceDivergence{}
+	for _, e := range entries {
+		diverged := func(format string, args ...interface{}) {
+			diffs = append(diffs, traceDivergence{Seq: e.Seq, URL: e.URL, Reason: fmt.Sprintf(format, args...)})
+		}
+
+		if e.Decision == traceFetchFailed {
+			if resp, err := fetcher.Fetch(context.Background(), e.URL); err == nil {
+				resp.Body.Close()
+				diverged("expected fetch to fail, got status %d", resp.StatusCode)
+			}
+			continue
+		}
+		if e.Response == nil {
+			continue
+		}
+		if e.Response.Truncated {
+			diverged("traced body truncated, replay not exact")
+		}
+
+		page, err := Scrape(e.URL, fetcher, scrapeOptions{})
+		if err != nil {
+			if e.Decision != traceScrapeFailed {
+				diverged("scrape failed, %v", err)
+			}
+			continue
+		}
+		page.Release()
+
+		if e.Decision == traceScrapeFailed {
+			diverged("expected scrape to fail")
+		}
+		if page.Status != e.Response.Status {
+			diverged("status %d, traced %d", page.Status, e.Response.Status)
+		}
+		if !reflect.DeepEqual(page.URLs, e.Scraped) && (len(page.URLs) != 0 || len(e.Scraped) != 0) {
+			diverged("scraped %v, traced %v", page.URLs, e.Scraped)
+		}
+	}
+	return diffs
+}
+
+// Replays the trace file with the responses recorded in it. See replayTrace.
+func replayTraceFile(filename string) ([]traceDivergence, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := readTrace(f)
+	if err != nil {
+		return nil, err
+	}
+	fetcher := newFixtureFetcher()
+	fetcher.addTrace(entries)
+	return replayTrace(entries, fetcher), nil
+}
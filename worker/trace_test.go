@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+// Creates a crawl task of the URL fetched with the HTML body, scraping it
+// through the tracer as the parse stage would.
+func tracedTask(t *testing.T, tracer *crawlTracer, id common.URLId, u, body string) *crawlTask {
+	task := newCrawlTask(&common.URLQueueItem{JobId: 7, OriginId: 1, URLId: id, Level: 1})
+	task.urlRec = &storage.URL{Id: id, URL: u}
+	task.resp = &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+	tracer.capture(task)
+
+	page, err := scrapeResponse(task.resp, u, scrapeOptions{})
+	require.NoError(t, err, "Expect traced response scraped")
+	task.resp, task.page = nil, page
+	task.urls, task.decision = page.URLs, traceCrawled
+	return task
+}
+
+func TestCrawlTraceReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harvester-trace")
+	require.NoError(t, err, "Expect trace directory")
+	defer os.RemoveAll(dir)
+
+	tracer, err := newCrawlTracer(dir)
+	require.NoError(t, err, "Expect tracer")
+
+	tracer.record(tracedTask(t, tracer, 1, "http://example.com/", `<a href="/a">a</a><a href="/b">b</a>`))
+	skipped := newCrawlTask(&common.URLQueueItem{JobId: 7, OriginId: 1, URLId: 2, Level: 2})
+	skipped.urlRec = &storage.URL{Id: 2, URL: "http://example.com/a"}
+	skipped.decision = traceRobotsDisallowed
+	tracer.record(skipped)
+	tracer.record(tracedTask(t, tracer, 3, "http://example.com/b", `<a href="http://example.org/">c</a>`))
+
+	f, err := os.Open(traceFilename(dir, 7))
+	require.NoError(t, err, "Expect trace file of job")
+	entries, err := readTrace(f)
+	f.Close()
+	require.NoError(t, err, "Expect trace read")
+
+	require.Len(t, entries, 3, "Expect each crawl traced")
+	for i, e := range entries {
+		assert.Equal(t, i+1, e.Seq, "Expect entries in order")
+	}
+	assert.Equal(t, traceRobotsDisallowed, entries[1].Decision, "Expect skipped crawl's decision")
+	assert.Nil(t, entries[1].Response, "Expect skipped crawl not fetched")
+	assert.Equal(t, []string{"http://example.com/a", "http://example.com/b"}, entries[0].Scraped, "Expect scraped URLs traced")
+
+	diffs, err := replayTraceFile(traceFilename(dir, 7))
+	require.NoError(t, err, "Expect trace replayed")
+	assert.Empty(t, diffs, "Expect replay of traced responses to match")
+}
+
+// Fetcher serving the same HTML body for every URL.
+func staticFetcher(body string) Fetcher {
+	return FetcherFunc(func(ctx context.Context, u string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/html"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+}
+
+func TestCrawlTraceReplayDiverged(t *testing.T) {
+	trace := `{"seq": 2, "url": "http://example.com/b", "decision": "fetch-failed"}
+{"seq": 1, "url": "http://example.com/", "decision": "crawled", "response": {"status": 200, "header": {"Content-Type": ["text/html"]}}, "scraped": ["http://example.com/a"]}
+`
+	entries, err := readTrace(bytes.NewBufferString(trace))
+	require.NoError(t, err, "Expect trace read")
+	require.Len(t, entries, 2, "Expect trace entries")
+	assert.Equal(t, "http://example.com/", entries[0].URL, "Expect entries ordered by sequence")
+
+	diffs := replayTrace(entries, staticFetcher(`<a href="/c">c</a>`))
+	require.Len(t, diffs, 2, "Expect replay to diverge")
+	assert.Equal(t, 1, diffs[0].Seq, "Expect scraped URLs to diverge")
+	assert.Contains(t, diffs[0].Reason, "http://example.com/c", "Expect replayed URLs reported")
+	assert.Equal(t, 2, diffs[1].Seq, "Expect failed fetch to diverge")
+}
+
+func TestTraceBodyTruncated(t *testing.T) {
+	resp := &traceResponse{}
+	body := &traceBody{ReadCloser: ioutil.NopCloser(bytes.NewReader(make([]byte, maxTraceBody+10))), resp: resp}
+
+	read, err := ioutil.ReadAll(body)
+	require.NoError(t, err, "Expect body read")
+	assert.Len(t, read, maxTraceBody+10, "Expect whole body read")
+	assert.Len(t, resp.Body, maxTraceBody, "Expect traced body truncated")
+	assert.True(t, resp.Truncated, "Expect truncation recorded")
+}
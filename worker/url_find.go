@@ -1,15 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"regexp"
 	"strings"
 )
 
 const (
-	// Regex for searching an HTML document for URL patterns.
-	// The patterns are limit to just href and src attributes for simplicity.
-	htmlURLRegexp = `href="([^"]+)|src="([^"]+)`
-
 	// CSS URL regex pattern. Matches only the url(...) pattern
 	cssURLRegexp = `url\(['"](.+?)['"]\)`
 
@@ -19,19 +16,19 @@ const (
 	genericURLRegexp = `(https?:\/\/[\w.\/=&?:-]+)|(\/\/[\w.\/=&?:-]+)`
 )
 
-var htmlURLRegexpComp *regexp.Regexp
 var cssURLRegexpComp *regexp.Regexp
 var genericURLregexpComp *regexp.Regexp
 
 func init() {
-	htmlURLRegexpComp = regexp.MustCompile(htmlURLRegexp)
 	cssURLRegexpComp = regexp.MustCompile(cssURLRegexp)
 	genericURLregexpComp = regexp.MustCompile(genericURLRegexp)
 }
 
-// Searches through the HTML document for for strings which look or are used like URLs
+// Searches through the HTML document for the values of href and src attributes.
+// Character references in the values are unescaped.
 func findHTMLDocURLs(doc []byte) []string {
-	return findURLs(doc, htmlURLRegexpComp)
+	scan, _ := scanHTML(bytes.NewReader(doc), 0)
+	return scan.urls
 }
 
 // Searches through a CSS document for strings which look or are used as URLs
@@ -30,7 +30,7 @@ data:image/jpeg;base64,/9j/4AAQSkZJRgABAQAAAQABAAD/2wBDAAoHBwgH
 		Results: []string{
 			"some-URL",
 			"some-url2",
-			"https://www.google.com/imghp?hl=en&amp;tab=wi&amp;authuser=0",
+			"https://www.google.com/imghp?hl=en&tab=wi&authuser=0",
 			"data:image/jpeg;base64,/9j/4AAQSkZJRgABAQAAAQABAAD/2wBDAAoHBwgH",
 			"/assets/application-3eb6399a0c53c9273cc25d871fbf02a4.js",
 		},
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/warc"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Writing of the responses fetched for each job's crawls into WARC files.
+type WARCConfig struct {
+	// Directory the gzip compressed WARC file of each job's fetched responses
+	// is written to, named job-<jobId>.warc.gz, e.g: to be replayed with pywb.
+	// Workers sharing the directory append to the same files. Disabled if not
+	// set.
+	Dir string `json:"dir"`
+}
+
+// Returns the WARC file of the job in the directory.
+func warcFilename(dir string, jobId common.JobId) string {
+	return filepath.Join(dir, fmt.Sprintf("job-%d.warc.gz", jobId))
+}
+
+// Writes the responses fetched for each job's crawls into the WARC file of the
+// job. Only the part of a response's body read by the crawl is written, up to
+// maxTraceBody, and the records of responses which weren't read whole are
+// marked as truncated.
+type warcRecorder struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// Creates a recorder of the WARC files in the directory.
+func newWARCRecorder(dir string) (*warcRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &warcRecorder{dir: dir}, nil
+}
+
+// Returns a fetcher writing the responses fetched by the next fetcher into the
+// job's WARC file. Responses are written once their body is closed. Failed
+// fetches are not written. If the recorder is nil the next fetcher is returned.
+func (r *warcRecorder) fetcher(jobId common.JobId, next Fetcher) Fetcher {
+	if r == nil {
+		return next
+	}
+	return FetcherFunc(func(ctx context.Context, u string) (*http.Response, error) {
+		fetchedOn := time.Now()
+		resp, err := next.Fetch(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+
+		recorded := &traceResponse{Status: resp.StatusCode, Header: resp.Header}
+		body := &warcBody{traceBody: traceBody{ReadCloser: resp.Body, resp: recorded}}
+		body.done = func() {
+			truncated := recorded.Truncated || !body.eof
+			r.record(jobId, warc.NewResponse(u, fetchedOn, recorded.Status, recorded.Header, recorded.Body, truncated))
+		}
+		resp.Body = body
+		return resp, nil
+	})
+}
+
+// Appends the record to the job's WARC file, after a warcinfo record if the
+// file is new. Each record is written in a single write, so records appended
+// by workers sharing the file aren't interleaved. Failures are logged, and
+// don't affect the fetch.
+func (r *warcRecorder) record(jobId common.JobId, rec *warc.Record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	f, err := os.OpenFile(warcFilename(r.dir, jobId), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Println("warc: failed to open WARC file", jobId, err)
+		return
+	}
+	defer f.Close()
+
+	buf := &bytes.Buffer{}
+	w := warc.NewWriter(buf, true)
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		if _, err := w.WriteRecord(warc.NewWarcinfo(time.Now(), map[string]string{
+			"software":    "harvester",
+			"format":      "WARC File Format 1.1",
+			"description": fmt.Sprintf("Responses fetched by job %d", jobId),
+		})); err != nil {
+			log.Println("warc: failed to encode warcinfo", jobId, err)
+			return
+		}
+	}
+	if _, err := w.WriteRecord(rec); err != nil {
+		log.Println("warc: failed to encode record", jobId, rec.TargetURI, err)
+		return
+	}
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		log.Println("warc: failed to write record", jobId, rec.TargetURI, err)
+	}
+}
+
+// Response body recording the bytes read from it, and if it was read to its
+// end. Its response is written once closed.
+type warcBody struct {
+	traceBody
+	eof  bool
+	done func()
+	once sync.Once
+}
+
+func (b *warcBody) Read(p []byte) (int, error) {
+	n, err := b.traceBody.Read(p)
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *warcBody) Close() error {
+	err := b.traceBody.Close()
+	b.once.Do(b.done)
+	return err
+}
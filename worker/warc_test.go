@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWARCRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "harvester-warc")
+	require.NoError(t, err, "Expect WARC directory")
+	defer os.RemoveAll(dir)
+
+	recorder, err := newWARCRecorder(dir)
+	require.NoError(t, err, "Expect recorder")
+
+	fetcher := recorder.fetcher(7, staticFetcher(`<a href="/a">a</a>`))
+	page, err := Scrape("http://example.com/", fetcher, scrapeOptions{})
+	require.NoError(t, err, "Expect page scraped")
+	page.Release()
+
+	// A response whose body isn't read to its end is truncated.
+	resp, err := fetcher.Fetch(context.Background(), "http://example.com/partial")
+	require.NoError(t, err, "Expect response")
+	resp.Body.Read(make([]byte, 4))
+	resp.Body.Close()
+
+	b, err := ioutil.ReadFile(warcFilename(dir, 7))
+	require.NoError(t, err, "Expect job's WARC file")
+	gr, err := gzip.NewReader(bytes.NewReader(b))
+	require.NoError(t, err, "Expect gzip compressed WARC file")
+	content, err := ioutil.ReadAll(gr)
+	require.NoError(t, err, "Expect WARC records")
+
+	records := strings.Split(string(content), "WARC/1.1\r\n")[1:]
+	require.Len(t, records, 3, "Expect warcinfo, and response records")
+	assert.Contains(t, records[0], "WARC-Type: warcinfo\r\n", "Expect warcinfo record first")
+	assert.Contains(t, records[1], "WARC-Target-URI: http://example.com/\r\n", "Expect scraped response")
+	assert.Contains(t, records[1], "\r\n\r\n<a href=\"/a\">a</a>\r\n\r\n", "Expect response body")
+	assert.NotContains(t, records[1], "WARC-Truncated", "Expect whole response")
+	assert.Contains(t, records[2], "WARC-Target-URI: http://example.com/partial\r\n", "Expect partial response")
+	assert.Contains(t, records[2], "WARC-Truncated: length\r\n", "Expect partial response truncated")
+}
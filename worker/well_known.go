@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/jasdel/harvester/internal/common"
+	"github.com/jasdel/harvester/internal/storage"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Duration a host's well-known files are not requested again for, once checked.
+const wellKnownCheckTTL = 24 * time.Hour
+
+// Maximum size of a well-known file which will be stored. Larger files are
+// truncated.
+const maxWellKnownSize = 64 * 1024
+
+// Most hosts whose well-known files, or site identity, are checked at once by
+// a worker.
+const maxHostChecks = 4
+
+// Checks the well-known files, e.g: security.txt, of the hosts crawled by the
+// worker, storing the files a host has as its metadata. Each host is checked
+// once, and again after the wellKnownCheckTTL. Hosts are checked in the
+// background, so crawls don't wait on the requests, or the host's crawl delay.
+type wellKnownChecker struct {
+	client *http.Client
+	sc     *storage.Client
+
+	// Robots.txt policy the files are requested with. Nil if robots.txt
+	// files are ignored.
+	robots *robotsPolicy
+
+	// Limits the hosts checked at once to maxHostChecks
+	checks chan struct{}
+
+	mu      sync.Mutex
+	checked map[string]time.Time
+}
+
+// Creates a well-known file checker requesting files with the client, and
+// storing them with the storage client.
+func newWellKnownChecker(client *http.Client, sc *storage.Client, robots *robotsPolicy) *wellKnownChecker {
+	return &wellKnownChecker{
+		client:  client,
+		sc:      sc,
+		robots:  robots,
+		checks:  make(chan struct{}, maxHostChecks),
+		checked: map[string]time.Time{},
+	}
+}
+
+// Checks the well-known files of the URL's host in the background, if not
+// checked recently. A host is only checked once however many of its URLs are
+// crawled meanwhile.
+func (w *wellKnownChecker) check(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	key := u.Scheme + "://" + u.Host
+
+	now := time.Now()
+	w.mu.Lock()
+	if checkedOn, ok := w.checked[key]; ok && now.Sub(checkedOn) < wellKnownCheckTTL {
+		w.mu.Unlock()
+		return
+	}
+	w.checked[key] = now
+	w.prune(now)
+	w.mu.Unlock()
+
+	go func() {
+		w.checks <- struct{}{}
+		defer func() { <-w.checks }()
+		w.fetch(key, common.URLHost(rawURL))
+	}()
+}
+
+// Drops the hosts checked once more than maxTrackedHosts are tracked, those
+// checked longer ago than the TTL first. Expects the lock to be held.
+func (w *wellKnownChecker) prune(now time.Time) {
+	if len(w.checked) <= maxTrackedHosts {
+		return
+	}
+	for key, checkedOn := range w.checked {
+		if now.Sub(checkedOn) >= wellKnownCheckTTL {
+			delete(w.checked, key)
+		}
+	}
+	if len(w.checked) <= maxTrackedHosts {
+		return
+	}
+	for key := range w.checked {
+		if len(w.checked) <= maxTrackedHosts/2 {
+			break
+		}
+		delete(w.checked, key)
+	}
+}
+
+// Requests the well-known files of the host at the scheme and host key, and
+// stores the files the host has. Files the host no longer has are removed.
+func (w *wellKnownChecker) fetch(key, host string) {
+	for _, path := range common.WellKnownPaths {
+		fileURL := key + path
+		if w.robots != nil {
+			if allowed, err := w.robots.allow(fileURL); err != nil || !allowed {
+				continue
+			}
+		}
+
+		content, ok, err := fetchWellKnown(w.client, fileURL)
+		if err != nil {
+			log.Println("wellKnown: failed to request", fileURL, err)
+			continue
+		}
+
+		if ok {
+			err = w.sc.HostClient().StoreWellKnown(host, path, content)
+		} else {
+			err = w.sc.HostClient().RemoveWellKnown(host, path)
+		}
+		if err != nil {
+			log.Println("wellKnown: failed to update", host, path, err)
+		}
+	}
+}
+
+// Requests the well-known file. False is returned if the host does not have
+// the file. Only successful plain text responses are considered files, since
+// many hosts respond to missing files with an HTML page.
+func fetchWellKnown(client *http.Client, fileURL string) (string, bool, error) {
+	resp, err := client.Get(fileURL)
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return "", false, fmt.Errorf("Server error %d", resp.StatusCode)
+	} else if resp.StatusCode != http.StatusOK {
+		return "", false, nil
+	}
+	if typ, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err != nil || typ != "text/plain" {
+		return "", false, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, io.LimitReader(resp.Body, maxWellKnownSize)); err != nil {
+		return "", false, err
+	}
+	return buf.String(), true, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFetchWellKnown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/security.txt":
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte("Contact: mailto:security@example.com\n"))
+		case "/llms.txt":
+			// Soft 404 page
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>Not found</html>"))
+		case "/error":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	content, ok, err := fetchWellKnown(http.DefaultClient, server.URL+"/.well-known/security.txt")
+	require.NoError(t, err, "Expect security.txt requested")
+	assert.True(t, ok, "Expect security.txt found")
+	assert.Equal(t, "Contact: mailto:security@example.com\n", content, "Expect security.txt content")
+
+	_, ok, err = fetchWellKnown(http.DefaultClient, server.URL+"/llms.txt")
+	require.NoError(t, err, "Expect llms.txt requested")
+	assert.False(t, ok, "Expect HTML response not a file")
+
+	_, ok, err = fetchWellKnown(http.DefaultClient, server.URL+"/humans.txt")
+	require.NoError(t, err, "Expect humans.txt requested")
+	assert.False(t, ok, "Expect missing file")
+
+	_, _, err = fetchWellKnown(http.DefaultClient, server.URL+"/error")
+	assert.Error(t, err, "Expect server error")
+}
+
+func TestWellKnownCheckerPrune(t *testing.T) {
+	w := newWellKnownChecker(http.DefaultClient, nil, nil)
+	now := time.Now()
+	for i := 0; i < maxTrackedHosts; i++ {
+		w.checked[fmt.Sprintf("http://%d.example.com", i)] = now
+	}
+	w.checked["http://expired.example.com"] = now.Add(-wellKnownCheckTTL)
+
+	w.prune(now)
+	assert.NotContains(t, w.checked, "http://expired.example.com", "Expect expired host dropped first")
+	assert.Len(t, w.checked, maxTrackedHosts, "Expect hosts checked within the TTL kept")
+
+	w.checked["http://new.example.com"] = now
+	w.prune(now)
+	assert.Len(t, w.checked, maxTrackedHosts/2, "Expect hosts dropped down to half")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"github.com/jasdel/harvester/internal/sitemap"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Names of the XML elements and attributes whose values are URLs. Names are
+// matched against the local name, without any namespace prefix, e.g: "href"
+// matches both href and xlink:href attributes.
+type XMLURLNames struct {
+	// Elements whose text content is a URL, e.g: RSS <link>
+	Elements []string `json:"elements"`
+
+	// Attributes whose value is a URL, e.g: Atom <link href="...">
+	Attributes []string `json:"attributes"`
+}
+
+// Element and attribute names used to find URLs in generic XML documents if not
+// configured. Covers RSS, Atom, RDF, and most XML catalogs.
+var defaultXMLURLNames = XMLURLNames{
+	Elements:   []string{"link", "loc", "url", "guid", "comments", "docs"},
+	Attributes: []string{"href", "src", "url", "about", "resource"},
+}
+
+// Content handler for XML documents. Sitemaps are scraped for their listed
+// URLs, and other XML documents for the values of the configured URL elements
+// and attributes.
+type xmlHandler struct {
+	elements   map[string]struct{}
+	attributes map[string]struct{}
+}
+
+// Creates a new XML content handler finding URLs in the named elements and
+// attributes.
+func newXMLHandler(names XMLURLNames) *xmlHandler {
+	h := &xmlHandler{elements: map[string]struct{}{}, attributes: map[string]struct{}{}}
+	for _, name := range names.Elements {
+		h.elements[name] = struct{}{}
+	}
+	for _, name := range names.Attributes {
+		h.attributes[name] = struct{}{}
+	}
+	return h
+}
+
+// Scrapes the XML document. If the document is not well formed any strings
+// which look like URLs are found instead, and the page's parse error is set.
+func (h *xmlHandler) Scrape(page *Page, pageURL *url.URL, header http.Header, body []byte) []string {
+	urls, sitemaps, err := sitemap.Parse(bytes.NewReader(body))
+	if err == nil {
+		found := make([]string, 0, len(urls)+len(sitemaps))
+		for _, u := range append(urls, sitemaps...) {
+			found = append(found, u.Loc)
+		}
+		return found
+	}
+
+	found, err := h.findURLs(body)
+	if err != nil {
+		page.ParseError = fmt.Sprintf("Malformed XML, %v", err)
+		return findGenericDocURLs(body)
+	}
+	return found
+}
+
+// Returns the values of the document's URL elements and attributes. Values
+// which are not http(s) or relative URLs are ignored. Returns an error if the
+// document is not well formed.
+func (h *xmlHandler) findURLs(doc []byte) ([]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	dec.Strict = false
+
+	found := []string{}
+	// Text of the URL element currently being read, nil if not in one.
+	var text *bytes.Buffer
+	depth, textDepth := 0, 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			for _, attr := range t.Attr {
+				if _, ok := h.attributes[attr.Name.Local]; ok && isXMLURL(attr.Value) {
+					found = append(found, strings.TrimSpace(attr.Value))
+				}
+			}
+			if _, ok := h.elements[t.Name.Local]; ok && text == nil {
+				text, textDepth = &bytes.Buffer{}, depth
+			}
+		case xml.CharData:
+			if text != nil {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if text != nil && depth == textDepth {
+				if v := text.String(); isXMLURL(v) {
+					found = append(found, strings.TrimSpace(v))
+				}
+				text = nil
+			}
+			depth--
+		}
+	}
+	return found, nil
+}
+
+// Returns if the value is an http(s), or relative, URL.
+func isXMLURL(v string) bool {
+	v = strings.TrimSpace(v)
+	if v == "" || strings.ContainsAny(v, " \t\r\n") {
+		return false
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "" || u.Scheme == "http" || u.Scheme == "https"
+}
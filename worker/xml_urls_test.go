@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestXMLHandlerAtom(t *testing.T) {
+	doc := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<link href="http://example.com/" rel="alternate"/>
+	<id>tag:example.com,2005:feed</id>
+	<entry>
+		<link href="/posts/1"/>
+		<id>urn:uuid:1225c695</id>
+	</entry>
+</feed>`)
+	urls := newXMLHandler(defaultXMLURLNames).Scrape(&Page{}, nil, nil, doc)
+	assert.Equal(t, []string{"http://example.com/", "/posts/1"}, urls, "Expect Atom link hrefs, not ids")
+}
+
+func TestXMLHandlerConfiguredNames(t *testing.T) {
+	doc := []byte(`<catalog xmlns:x="http://www.w3.org/1999/xlink">
+	<product x:href="http://example.com/p/1">
+		<image>http://example.com/p/1.png</image>
+		<link>http://example.com/not-configured</link>
+	</product>
+	<product><image>
+		not a url
+	</image></product>
+	<product><image>mailto:someone@example.com</image></product>
+</catalog>`)
+	h := newXMLHandler(XMLURLNames{Elements: []string{"image"}, Attributes: []string{"href"}})
+	urls, err := h.findURLs(doc)
+	require.NoError(t, err, "Expect valid XML")
+	assert.Equal(t, []string{"http://example.com/p/1", "http://example.com/p/1.png"}, urls, "Expect configured element and attribute URLs")
+}
+
+func TestXMLHandlerMalformed(t *testing.T) {
+	urls := newXMLHandler(defaultXMLURLNames).Scrape(&Page{}, nil, nil, []byte(`<rss><link>http://example.com/a</link></channel>`))
+	assert.Equal(t, []string{"http://example.com/a"}, urls, "Expect generic URLs of malformed XML")
+}